@@ -0,0 +1,306 @@
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var ErrUnknownFormat = errors.New("unknown audio format")
+
+// GetDuration returns the duration of the audio in seconds, read from the headers of WAV, FLAC, MP3, MP4 (M4A) and Ogg files.
+// The audio is read as a stream, the media data is skipped rather than held in memory
+func GetDuration(r io.Reader) (float64, error) {
+	reader := bufio.NewReaderSize(r, 4096)
+	header, err := reader.Peek(12)
+	if err != nil && len(header) < 4 {
+		return 0, ErrUnknownFormat
+	}
+	switch {
+	case bytes.HasPrefix(header, []byte("RIFF")) && len(header) >= 12 && string(header[8:12]) == "WAVE":
+		return getWAVDuration(reader)
+	case bytes.HasPrefix(header, []byte("fLaC")):
+		return getFLACDuration(reader)
+	case bytes.HasPrefix(header, []byte("OggS")):
+		return getOggDuration(reader)
+	case len(header) >= 8 && string(header[4:8]) == "ftyp":
+		return getMP4Duration(reader)
+	case bytes.HasPrefix(header, []byte("ID3")) || (header[0] == 0xFF && header[1]&0xE0 == 0xE0):
+		return getMP3Duration(reader)
+	}
+	return 0, ErrUnknownFormat
+}
+
+func readBytes(reader io.Reader, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	_, err := io.ReadFull(reader, buf)
+	return buf, err
+}
+
+func skip(reader io.Reader, n int64) error {
+	skipped, err := io.CopyN(io.Discard, reader, n)
+	if err == io.EOF && skipped < n {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func getWAVDuration(reader *bufio.Reader) (float64, error) {
+	err := skip(reader, 12)
+	if err != nil {
+		return 0, err
+	}
+	var byteRate uint32
+	for {
+		chunk, err := readBytes(reader, 8)
+		if err != nil {
+			return 0, err
+		}
+		size := binary.LittleEndian.Uint32(chunk[4:])
+		switch string(chunk[:4]) {
+		case "fmt ":
+			format, err := readBytes(reader, 16)
+			if err != nil {
+				return 0, err
+			}
+			byteRate = binary.LittleEndian.Uint32(format[8:12])
+			err = skip(reader, int64(size)-16+int64(size%2))
+			if err != nil {
+				return 0, err
+			}
+		case "data":
+			if byteRate == 0 {
+				return 0, ErrUnknownFormat
+			}
+			if size == 0 || size == 0xFFFFFFFF {
+				// the size is unknown if the audio was recorded as a stream
+				remaining, err := io.Copy(io.Discard, reader)
+				if err != nil {
+					return 0, err
+				}
+				return float64(remaining) / float64(byteRate), nil
+			}
+			return float64(size) / float64(byteRate), nil
+		default:
+			err = skip(reader, int64(size)+int64(size%2))
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+}
+
+func getFLACDuration(reader *bufio.Reader) (float64, error) {
+	// the STREAMINFO block is always the first one
+	header, err := readBytes(reader, 8)
+	if err != nil {
+		return 0, err
+	}
+	if header[4]&0x7F != 0 {
+		return 0, ErrUnknownFormat
+	}
+	info, err := readBytes(reader, 18)
+	if err != nil {
+		return 0, err
+	}
+	b := info[10:18]
+	sampleRate := uint32(b[0])<<12 | uint32(b[1])<<4 | uint32(b[2])>>4
+	totalSamples := uint64(b[3]&0x0F)<<32 | uint64(binary.BigEndian.Uint32(b[4:8]))
+	if sampleRate == 0 {
+		return 0, ErrUnknownFormat
+	}
+	return float64(totalSamples) / float64(sampleRate), nil
+}
+
+var mp3Bitrates = [2][15]int{
+	{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320}, // MPEG-1 Layer III
+	{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},     // MPEG-2 and 2.5 Layer III
+}
+
+var mp3SampleRates = map[byte][3]int{
+	3: {44100, 48000, 32000}, // MPEG-1
+	2: {22050, 24000, 16000}, // MPEG-2
+	0: {11025, 12000, 8000},  // MPEG-2.5
+}
+
+// getMP3Duration reads the frame count of the Xing or Info header of VBR files,
+// the duration of CBR files is derived from the size and the bitrate of the first frame
+func getMP3Duration(reader *bufio.Reader) (float64, error) {
+	header, err := reader.Peek(10)
+	if err == nil && bytes.HasPrefix(header, []byte("ID3")) {
+		size := int64(header[6]&0x7F)<<21 | int64(header[7]&0x7F)<<14 | int64(header[8]&0x7F)<<7 | int64(header[9]&0x7F)
+		if header[5]&0x10 != 0 {
+			size += 10 // footer
+		}
+		err = skip(reader, 10+size)
+		if err != nil {
+			return 0, err
+		}
+	}
+	frame, err := reader.Peek(4)
+	if err != nil {
+		return 0, err
+	}
+	version := (frame[1] >> 3) & 0x03
+	layer := (frame[1] >> 1) & 0x03
+	bitrateIndex := frame[2] >> 4
+	sampleRateIndex := (frame[2] >> 2) & 0x03
+	if frame[0] != 0xFF || frame[1]&0xE0 != 0xE0 || version == 1 || layer != 1 || bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return 0, ErrUnknownFormat
+	}
+	sampleRate := mp3SampleRates[version][sampleRateIndex]
+	mono := frame[3]>>6 == 3
+	bitrates, samplesPerFrame, sideInfoSize := mp3Bitrates[1], 576, 17
+	if version == 3 {
+		bitrates, samplesPerFrame, sideInfoSize = mp3Bitrates[0], 1152, 32
+		if mono {
+			sideInfoSize = 17
+		}
+	} else if mono {
+		sideInfoSize = 9
+	}
+	xing, _ := reader.Peek(4 + sideInfoSize + 12)
+	if len(xing) == 4+sideInfoSize+12 {
+		tag := xing[4+sideInfoSize:]
+		if (string(tag[:4]) == "Xing" || string(tag[:4]) == "Info") && tag[7]&0x01 != 0 {
+			frames := binary.BigEndian.Uint32(tag[8:12])
+			return float64(frames) * float64(samplesPerFrame) / float64(sampleRate), nil
+		}
+	}
+	size, err := io.Copy(io.Discard, reader)
+	if err != nil {
+		return 0, err
+	}
+	return float64(size) * 8 / float64(bitrates[bitrateIndex]*1000), nil
+}
+
+// getMP4Duration reads the duration of the movie header, which is in the moov box, before or after the media data
+func getMP4Duration(reader *bufio.Reader) (float64, error) {
+	for {
+		boxType, size, err := readMP4BoxHeader(reader)
+		if err != nil {
+			return 0, err
+		}
+		switch boxType {
+		case "moov":
+			// descend into the box
+		case "mvhd":
+			header, err := readBytes(reader, 4)
+			if err != nil {
+				return 0, err
+			}
+			var timescale uint32
+			var duration uint64
+			if header[0] == 1 {
+				data, err := readBytes(reader, 28)
+				if err != nil {
+					return 0, err
+				}
+				timescale, duration = binary.BigEndian.Uint32(data[16:20]), binary.BigEndian.Uint64(data[20:28])
+			} else {
+				data, err := readBytes(reader, 16)
+				if err != nil {
+					return 0, err
+				}
+				timescale, duration = binary.BigEndian.Uint32(data[8:12]), uint64(binary.BigEndian.Uint32(data[12:16]))
+			}
+			if timescale == 0 {
+				return 0, ErrUnknownFormat
+			}
+			return float64(duration) / float64(timescale), nil
+		default:
+			if size < 0 {
+				return 0, ErrUnknownFormat
+			}
+			err = skip(reader, size)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+}
+
+// readMP4BoxHeader returns the size of the box without the header, -1 if the box extends to the end of the file
+func readMP4BoxHeader(reader io.Reader) (string, int64, error) {
+	header, err := readBytes(reader, 8)
+	if err != nil {
+		return "", 0, err
+	}
+	size := int64(binary.BigEndian.Uint32(header[:4]))
+	switch size {
+	case 0:
+		return string(header[4:]), -1, nil
+	case 1:
+		largeSize, err := readBytes(reader, 8)
+		if err != nil {
+			return "", 0, err
+		}
+		size = int64(binary.BigEndian.Uint64(largeSize)) - 16
+	default:
+		size -= 8
+	}
+	if size < 0 {
+		return "", 0, ErrUnknownFormat
+	}
+	return string(header[4:]), size, nil
+}
+
+// getOggDuration reads the sample rate of the Vorbis or Opus header, and the granule position of the last page
+func getOggDuration(reader *bufio.Reader) (float64, error) {
+	var sampleRate, preSkip uint64
+	var serial uint32
+	var granule uint64
+	for first := true; ; first = false {
+		header, err := readBytes(reader, 27)
+		if err == io.EOF && !first {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		if string(header[:4]) != "OggS" {
+			return 0, ErrUnknownFormat
+		}
+		segments, err := readBytes(reader, int(header[26]))
+		if err != nil {
+			return 0, err
+		}
+		var size int64
+		for _, segment := range segments {
+			size += int64(segment)
+		}
+		if first {
+			serial = binary.LittleEndian.Uint32(header[14:18])
+			packet, err := readBytes(reader, int(size))
+			if err != nil {
+				return 0, err
+			}
+			switch {
+			case bytes.HasPrefix(packet, []byte("\x01vorbis")) && len(packet) >= 16:
+				sampleRate = uint64(binary.LittleEndian.Uint32(packet[12:16]))
+			case bytes.HasPrefix(packet, []byte("OpusHead")) && len(packet) >= 12:
+				// opus is always decoded at 48 kHz
+				sampleRate = 48000
+				preSkip = uint64(binary.LittleEndian.Uint16(packet[10:12]))
+			default:
+				return 0, ErrUnknownFormat
+			}
+			continue
+		}
+		if binary.LittleEndian.Uint32(header[14:18]) == serial {
+			if position := binary.LittleEndian.Uint64(header[6:14]); position != 0xFFFFFFFFFFFFFFFF {
+				granule = position
+			}
+		}
+		err = skip(reader, size)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if sampleRate == 0 || granule < preSkip {
+		return 0, ErrUnknownFormat
+	}
+	return float64(granule-preSkip) / float64(sampleRate), nil
+}
@@ -0,0 +1,74 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func wav(seconds int) []byte {
+	var buf bytes.Buffer
+	byteRate := 16000 * 2
+	dataSize := seconds * byteRate
+	buf.WriteString("RIFF")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(36+dataSize))
+	buf.WriteString("WAVEfmt ")
+	for _, field := range []any{uint32(16), uint16(1), uint16(1), uint32(16000), uint32(byteRate), uint16(2), uint16(16)} {
+		_ = binary.Write(&buf, binary.LittleEndian, field)
+	}
+	buf.WriteString("data")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(dataSize))
+	buf.Write(make([]byte, dataSize))
+	return buf.Bytes()
+}
+
+func mp4Box(boxType string, payload []byte) []byte {
+	box := binary.BigEndian.AppendUint32(nil, uint32(8+len(payload)))
+	return append(append(box, boxType...), payload...)
+}
+
+func oggPage(granule uint64, packet []byte) []byte {
+	page := []byte("OggS\x00\x00")
+	page = binary.LittleEndian.AppendUint64(page, granule)
+	page = binary.LittleEndian.AppendUint32(page, 1) // serial
+	page = append(page, make([]byte, 8)...)          // sequence and checksum
+	return append(append(page, 1, byte(len(packet))), packet...)
+}
+
+func TestGetDuration(t *testing.T) {
+	Convey("GetDuration", t, func() {
+		duration, err := GetDuration(bytes.NewReader(wav(3)))
+		So(err, ShouldBeNil)
+		So(duration, ShouldEqual, 3)
+
+		// MPEG-1 Layer III, 128 kbps, 44.1 kHz, stereo, 417 bytes per frame
+		frame := append([]byte{0xFF, 0xFB, 0x90, 0x00}, make([]byte, 413)...)
+		mp3 := append([]byte("ID3\x03\x00\x00\x00\x00\x00\x0A"), make([]byte, 10)...)
+		for i := 0; i < 100; i++ {
+			mp3 = append(mp3, frame...)
+		}
+		duration, err = GetDuration(bytes.NewReader(mp3))
+		So(err, ShouldBeNil)
+		So(duration, ShouldAlmostEqual, 417*100*8/128000.0)
+
+		mvhd := append(make([]byte, 12), binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, 1000), 90500)...)
+		m4a := append(mp4Box("ftyp", []byte("M4A \x00\x00\x00\x00")), mp4Box("mdat", make([]byte, 1024))...)
+		m4a = append(m4a, mp4Box("moov", mp4Box("mvhd", append(mvhd, make([]byte, 80)...)))...)
+		duration, err = GetDuration(bytes.NewReader(m4a))
+		So(err, ShouldBeNil)
+		So(duration, ShouldEqual, 90.5)
+
+		opusHead := append([]byte("OpusHead\x01\x01"), binary.LittleEndian.AppendUint16(nil, 312)...)
+		ogg := append(oggPage(0, append(opusHead, make([]byte, 7)...)), oggPage(0, []byte("OpusTags"))...)
+		ogg = append(ogg, oggPage(48000+312, make([]byte, 100))...)
+		ogg = append(ogg, oggPage(2*48000+312, make([]byte, 100))...)
+		duration, err = GetDuration(bytes.NewReader(ogg))
+		So(err, ShouldBeNil)
+		So(duration, ShouldEqual, 2)
+
+		_, err = GetDuration(bytes.NewReader([]byte("not an audio file")))
+		So(err, ShouldEqual, ErrUnknownFormat)
+	})
+}
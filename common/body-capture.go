@@ -0,0 +1,31 @@
+package common
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+// CaptureBody decides whether the body of a request to the model should be logged, and caps its size,
+// the policy of the model takes precedence over the global one
+func CaptureBody(modelName string, body []byte) (string, bool) {
+	sampleRate := config.BodyCaptureSampleRate
+	maxBytes := config.BodyCaptureMaxBytes
+	if policy, ok := config.ModelBodyCapturePolicy[modelName]; ok {
+		sampleRate = policy.SampleRate
+		maxBytes = policy.MaxBytes
+	}
+	if sampleRate < 1 && rand.Float64() >= sampleRate {
+		return "", false
+	}
+	return TruncateBody(body, maxBytes), true
+}
+
+// TruncateBody keeps the first maxBytes bytes of the body, 0 means no limit
+func TruncateBody(body []byte, maxBytes int) string {
+	if maxBytes <= 0 || len(body) <= maxBytes {
+		return string(body)
+	}
+	return fmt.Sprintf("%s...(truncated, %d bytes in total)", body[:maxBytes], len(body))
+}
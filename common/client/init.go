@@ -13,6 +13,9 @@ var HTTPClient *http.Client
 var ImpatientHTTPClient *http.Client
 var UserContentRequestHTTPClient *http.Client
 
+// WebhookHTTPClient posts to the urls given by users, without a proxy it only connects to public addresses
+var WebhookHTTPClient *http.Client
+
 func Init() {
 	if config.UserContentRequestProxy != "" {
 		logger.SysLog(fmt.Sprintf("using %s as proxy to fetch user content", config.UserContentRequestProxy))
@@ -27,8 +30,13 @@ func Init() {
 			Transport: transport,
 			Timeout:   time.Second * time.Duration(config.UserContentRequestTimeout),
 		}
+		// the proxy is trusted to keep the requests away from the internal network
+		WebhookHTTPClient = UserContentRequestHTTPClient
 	} else {
 		UserContentRequestHTTPClient = &http.Client{}
+		WebhookHTTPClient = &http.Client{
+			Transport: newPublicOnlyTransport(),
+		}
 	}
 	var transport http.RoundTripper
 	if config.RelayProxy != "" {
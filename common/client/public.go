@@ -0,0 +1,41 @@
+package client
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/network"
+)
+
+var ErrPrivateAddress = errors.New("requests to private, loopback or link-local addresses are not allowed")
+
+// publicOnlyControl is checked after the host is resolved right before connecting, so that a host resolving
+// to another address the second time can't get around the check
+func publicOnlyControl(_ string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !network.IsPublicIP(ip) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// newPublicOnlyTransport only connects to public addresses, redirects are checked as well
+// as every connection is dialed by it
+func newPublicOnlyTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   publicOnlyControl,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
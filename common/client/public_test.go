@@ -0,0 +1,27 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPublicOnlyTransport(t *testing.T) {
+	Convey("the public only transport doesn't connect to the internal network", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+		httpClient := &http.Client{Transport: newPublicOnlyTransport()}
+		_, err := httpClient.Post(server.URL, "application/json", nil)
+		So(errors.Is(err, ErrPrivateAddress), ShouldBeTrue)
+
+		So(publicOnlyControl("tcp4", "127.0.0.1:80", nil), ShouldEqual, ErrPrivateAddress)
+		So(publicOnlyControl("tcp4", "169.254.169.254:80", nil), ShouldEqual, ErrPrivateAddress)
+		So(publicOnlyControl("tcp6", "[::1]:443", nil), ShouldEqual, ErrPrivateAddress)
+		So(publicOnlyControl("tcp4", "8.8.8.8:443", nil), ShouldBeNil)
+	})
+}
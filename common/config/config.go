@@ -87,14 +87,154 @@ var ChannelDisableThreshold = 5.0
 var AutomaticDisableChannelEnabled = false
 var AutomaticEnableChannelEnabled = false
 var QuotaRemindThreshold int64 = 1000
+
+// the keys of every channel are checked every KeySweepFrequency minutes with an endpoint which costs nothing, 0 means never,
+// the channels whose keys are all invalid are disabled if KeySweepAutoDisableEnabled
+var KeySweepFrequency = env.Int("KEY_SWEEP_FREQUENCY", 0)
+var KeySweepAutoDisableEnabled = false
+
+// users may transfer quota to each other only if enabled, admins always can
+var QuotaTransferEnabled = false
+var QuotaTransferMaxQuota int64 = 0      // per transfer, 0 means no limit
+var QuotaTransferDailyMaxQuota int64 = 0 // sent by a user in 24 hours, 0 means no limit
+
+// the unauthenticated /status endpoint reports the availability of the models of PublicStatusGroup only if enabled
+var PublicStatusEnabled = false
+var PublicStatusGroup = env.String("PUBLIC_STATUS_GROUP", "default")
+
+// if StreamTraceEnabled, the streams end with a comment of the hash of the token and the channel serving them,
+// the hash is signed with StreamTraceSecret, which is generated once and saved as an option
+var StreamTraceEnabled = false
+var StreamTraceSecret = ""
+
+// tokens with a webhook url are notified of each billed request only if enabled, the url is requested by the server
+var TokenWebhookEnabled = false
 var PreConsumedQuota int64 = 500
 var ApproximateTokenEnabled = false
 var RetryTimes = 0
 
+// the delay before a retry doubles from RetryBaseDelay on every attempt up to RetryMaxDelay, in milliseconds,
+// with up to RetryJitter of it taken off at random, so that the retries of many requests spread out
+var RetryBaseDelay = 0
+var RetryMaxDelay = 5000
+var RetryJitter = 0.5
+
+// RetryStatusCodes are the status codes retried on another channel, e.g. 429,500-599, empty means the built-in rules
+var RetryStatusCodes = ""
+
+// GlobalSpendRateLimit caps the quota spent per minute by all the users of the deployment, 0 means no limit,
+// requests are rejected once it's exceeded, so that a leaked key or a runaway loop can't drain the upstream accounts
+var GlobalSpendRateLimit int64 = 0
+
+var ModelNameNormalizationEnabled = true
+var ContextWindowCheckEnabled = true
+var ModelCapabilityCheckEnabled = true
+
+// chat completions converted from other APIs are checked against the OpenAI schema before sent if enabled
+var StrictResponseValidationEnabled = false
+
+// the non-stream structured outputs are checked against the json_schema of the request before sent if enabled
+var StructuredOutputValidationEnabled = false
+
+var PromptCompressionEnabled = false
+var PromptCompressionModel = "gpt-3.5-turbo"
+var PromptCompressionKeepMessages = env.Int("PROMPT_COMPRESSION_KEEP_MESSAGES", 4)
+
+// PromptCompressionGroupThreshold maps group name to the prompt token count above which
+// a conversation is compressed, missing or zero means compression is disabled for this group
+var PromptCompressionGroupThreshold = map[string]int{}
+var PromptCompressionGroupThresholdLock sync.RWMutex
+
+// bodies are only captured in debug mode, these keep the logs of busy or large-context models small
+var BodyCaptureSampleRate = env.Float64("BODY_CAPTURE_SAMPLE_RATE", 1)
+var BodyCaptureMaxBytes = env.Int("BODY_CAPTURE_MAX_BYTES", 0) // 0 means no limit
+
+type BodyCapturePolicy struct {
+	SampleRate float64 `json:"sample_rate"`
+	MaxBytes   int     `json:"max_bytes"`
+}
+
+// ModelBodyCapturePolicy overrides the sample rate and the size cap of body capture for some models
+var ModelBodyCapturePolicy = map[string]BodyCapturePolicy{}
+
+type ExperimentVariant struct {
+	Model     string `json:"model"`
+	ChannelId int    `json:"channel_id,omitempty"` // 0 means any channel of the model
+}
+
+type ModelExperiment struct {
+	Name             string            `json:"name"` // defaults to the model requested
+	Control          ExperimentVariant `json:"control"`
+	Treatment        ExperimentVariant `json:"treatment"`
+	TreatmentPercent int               `json:"treatment_percent"`
+}
+
+// ModelExperiments maps the model requested by users to the experiment splitting its traffic
+var ModelExperiments = map[string]ModelExperiment{}
+
+// relay requests taking longer than SlowRequestThreshold milliseconds are saved with their timing, 0 means disabled.
+// It doesn't depend on debug mode or the body capture settings above.
+var SlowRequestThreshold = env.Int("SLOW_REQUEST_THRESHOLD", 0)
+var SlowRequestBodyCaptureEnabled = false
+var SlowRequestBodyMaxBytes = env.Int("SLOW_REQUEST_BODY_MAX_BYTES", 64*1024)
+
+// the audio to transcribe or translate larger than this is rejected, the limit of OpenAI is 25 MB
+var AudioMaxUploadBytes = env.Int("AUDIO_MAX_UPLOAD_BYTES", 25*1024*1024)
+
+// the files uploaded to the Files API larger than this are rejected, the limit of OpenAI is 512 MB
+var FileMaxUploadBytes = env.Int("FILE_MAX_UPLOAD_BYTES", 512*1024*1024)
+
+// the most bytes the files uploaded by a user can take on the upstreams, 0 means no limit
+var UserFileStorageQuota int64 = 1024 * 1024 * 1024
+
+// if ChatImageRehostEnabled, the images generated in chat completions are saved in HostedImagePath, which all the nodes
+// should share, and sent to the client as signed links valid for HostedImageTTL seconds instead of data URLs,
+// it can't be enabled unless HostedImagePath and SignedLinkSecret are set
+var ChatImageRehostEnabled = false
+var HostedImagePath = env.String("HOSTED_IMAGE_PATH", "")
+var HostedImageTTL = env.Int("HOSTED_IMAGE_TTL", 24*60*60)
+
+// request bodies smaller than this are sent as is to channels with request compression enabled
+var RequestCompressionMinBytes = env.Int("REQUEST_COMPRESSION_MIN_BYTES", 64*1024)
+
+// GroupStreamPolicy maps group name to its stream policy, tokens with their own policy are not affected
+var GroupStreamPolicy = map[string]string{}
+
+// GroupContentPolicy maps group name to its content policy profile, tokens with their own profile are not affected
+var GroupContentPolicy = map[string]string{}
+
+// the category thresholds of content policy profiles are checked against the scores of this model
+var ContentModerationModel = "text-moderation-latest"
+
+// the users of SandboxGroup are on the sandbox plan for trial access, they may send SandboxRequestRateLimit
+// requests per minute and spend SandboxDailyQuota per day as counted by the consume logs, the completions are cut
+// at SandboxMaxTokens and SandboxWatermark is appended to the chat completions, 0 or empty means no limit
+const SandboxGroup = "sandbox"
+
+var SandboxRequestRateLimit = 10
+var SandboxDailyQuota int64 = 50000
+var SandboxMaxTokens = 512
+var SandboxWatermark = "\n\n（本回复由试用额度生成）"
+
+// ModelCandidateEmulation maps model name to the most candidates emulated for it, for upstreams not supporting n,
+// a chat request with n > 1 is then sent as that many parallel requests whose choices are merged and billed together
+var ModelCandidateEmulation = map[string]int{}
+
+// ForceStreamMaxTokensThreshold is the max_tokens from which a request is a long generation,
+// requests without max_tokens are long generations too
+var ForceStreamMaxTokensThreshold = env.Int("FORCE_STREAM_MAX_TOKENS_THRESHOLD", 4096)
+
 var RootUserEmail = ""
 
 var IsMasterNode = os.Getenv("NODE_TYPE") != "slave"
 
+// in the multi-region mode every region runs against its own database, the quota ledger entries
+// of each region are pulled by the master node of every other region and applied to the local balances
+var RegionId = env.String("REGION_ID", "")
+var RegionPeers = env.String("REGION_PEERS", "") // base URLs of the other regions, separated by comma
+var RegionSyncSecret = env.String("REGION_SYNC_SECRET", "")
+var RegionSyncFrequency = env.Int("REGION_SYNC_FREQUENCY", 5) // unit is second
+
 var requestInterval, _ = strconv.Atoi(os.Getenv("POLLING_INTERVAL"))
 var RequestInterval = time.Duration(requestInterval) * time.Second
 
@@ -103,8 +243,30 @@ var SyncFrequency = env.Int("SYNC_FREQUENCY", 10*60) // unit is second
 var BatchUpdateEnabled = false
 var BatchUpdateInterval = env.Int("BATCH_UPDATE_INTERVAL", 5)
 
+var EphemeralKeyDefaultTTL = env.Int("EPHEMERAL_KEY_DEFAULT_TTL", 10*60) // unit is second
+var EphemeralKeyMaxTTL = env.Int("EPHEMERAL_KEY_MAX_TTL", 24*60*60)      // unit is second
+
+// the links to the exported files and the hosted images are signed with SignedLinkSecret, which must be the same on
+// all the nodes, the features are refused if it's not set
+var SignedLinkSecret = env.String("SIGNED_LINK_SECRET", "")
+
+// the exported files are saved in ExportPath, which all the nodes should share, the temp directory if it's empty,
+// at most ExportConcurrency of them are generated at the same time on each node
+var ExportPath = env.String("EXPORT_PATH", "")
+var ExportConcurrency = env.Int("EXPORT_CONCURRENCY", 2)
+
+// the exported files are deleted, and the links to them expire, this long after they are generated
+var ExportLinkTTL = env.Int("EXPORT_LINK_TTL", 60*60) // unit is second
+
+var QuotaSnapshotFrequency = env.Int("QUOTA_SNAPSHOT_FREQUENCY", 24*60*60) // unit is second, 0 means disabled
+var QuotaReconciliationAutoFix = env.Bool("QUOTA_RECONCILIATION_AUTO_FIX", false)
+
 var RelayTimeout = env.Int("RELAY_TIMEOUT", 0) // unit is second
 
+// BodyPassthroughThreshold is the body size in bytes from which the requests to openai compatible channels are relayed
+// as is without being decoded, the streams only if they ask for the usage, 0 means disabled. The body is buffered all the same
+var BodyPassthroughThreshold = env.Int("BODY_PASSTHROUGH_THRESHOLD", 0)
+
 var GeminiSafetySetting = env.String("GEMINI_SAFETY_SETTING", "BLOCK_NONE")
 
 var Theme = env.String("THEME", "default")
@@ -141,6 +303,16 @@ var MetricSuccessRateThreshold = env.Float64("METRIC_SUCCESS_RATE_THRESHOLD", 0.
 var MetricSuccessChanSize = env.Int("METRIC_SUCCESS_CHAN_SIZE", 1024)
 var MetricFailChanSize = env.Int("METRIC_FAIL_CHAN_SIZE", 128)
 
+var UsageReportEnabled = env.Bool("USAGE_REPORT_ENABLED", false)
+var UsageReportHour = env.Int("USAGE_REPORT_HOUR", 8) // local hour of the day at which reports are sent
+
+var KeyHealthWindowSize = env.Int("KEY_HEALTH_WINDOW_SIZE", 20)
+
+// ChannelSaturationThreshold is the number of in-flight requests from which a channel is saturated,
+// batch requests wait for a saturated channel while interactive ones go through, 0 means disabled
+var ChannelSaturationThreshold = env.Int("CHANNEL_SATURATION_THRESHOLD", 0)
+var BatchQueueTimeout = env.Int("BATCH_QUEUE_TIMEOUT", 60) // unit is second
+
 var InitialRootToken = os.Getenv("INITIAL_ROOT_TOKEN")
 
 var GeminiVersion = env.String("GEMINI_VERSION", "v1")
@@ -148,3 +320,13 @@ var GeminiVersion = env.String("GEMINI_VERSION", "v1")
 var RelayProxy = env.String("RELAY_PROXY", "")
 var UserContentRequestProxy = env.String("USER_CONTENT_REQUEST_PROXY", "")
 var UserContentRequestTimeout = env.Int("USER_CONTENT_REQUEST_TIMEOUT", 30)
+
+// base64 images larger than this are rejected before relaying, unit is MB, 0 means no limit
+var InlineImageMaxSize = env.Int("INLINE_IMAGE_MAX_SIZE", 20)
+
+// the request id sent by another one-api in front of this one is reused, so the logs of both can be matched
+var AcceptRequestId = env.Bool("ACCEPT_REQUEST_ID", false)
+
+// the completion tokens pre-consumed for a model are this percentile of its recent completions,
+// PreConsumedQuota is used until enough completions are seen, 0 means always PreConsumedQuota
+var PreConsumeCompletionPercentile = env.Float64("PRE_CONSUME_COMPLETION_PERCENTILE", 95)
@@ -0,0 +1,199 @@
+package credential
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// Token is an upstream credential that expires, such as an OAuth access token
+type Token struct {
+	AccessToken string    `json:"access_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// Fetcher exchanges the key of a channel for a new token
+type Fetcher func(key string) (*Token, error)
+
+const (
+	refreshInterval = 30 * time.Second
+	// a token this close to expiring is not handed out anymore
+	expirySafetyMargin = time.Minute
+	lockTimeout        = 30 * time.Second
+	// tokens not used for this long are not renewed in the background anymore
+	unusedTimeout    = time.Hour
+	waitForOtherNode = 5 * time.Second
+)
+
+type entry struct {
+	mutex     sync.Mutex
+	provider  string
+	key       string
+	token     *Token
+	refreshAt time.Time
+	lastUsed  time.Time
+}
+
+var fetchers = make(map[string]Fetcher)
+
+var entries sync.Map // cache key -> *entry
+
+// Register should be called in init, fetchers are not expected to change afterwards
+func Register(provider string, fetcher Fetcher) {
+	fetchers[provider] = fetcher
+}
+
+func (t *Token) valid() bool {
+	return t != nil && time.Now().Add(expirySafetyMargin).Before(t.ExpiresAt)
+}
+
+func cacheKey(provider string, key string) string {
+	// the key of a channel is a secret, it should not show up in the key names of Redis
+	sum := sha256.Sum256([]byte(key))
+	return provider + ":" + hex.EncodeToString(sum[:])
+}
+
+// nextRefreshAt is somewhere between 10% and 20% of the lifetime before expiry,
+// so the tokens fetched at the same time, for example after a restart, are not renewed at the same time
+func nextRefreshAt(token *Token) time.Time {
+	lifetime := time.Until(token.ExpiresAt)
+	if lifetime <= 0 {
+		return time.Now()
+	}
+	lead := lifetime/10 + time.Duration(rand.Int63n(int64(lifetime/10)+1))
+	return token.ExpiresAt.Add(-lead)
+}
+
+// Get returns a valid access token for the key, it's fetched only if there isn't one cached locally or in Redis
+func Get(provider string, key string) (string, error) {
+	if _, ok := fetchers[provider]; !ok {
+		return "", fmt.Errorf("unknown credential provider: %s", provider)
+	}
+	ck := cacheKey(provider, key)
+	value, _ := entries.LoadOrStore(ck, &entry{provider: provider, key: key})
+	e := value.(*entry)
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.lastUsed = time.Now()
+	if e.token.valid() {
+		return e.token.AccessToken, nil
+	}
+	err := e.refresh(ck, false)
+	if err != nil {
+		return "", err
+	}
+	return e.token.AccessToken, nil
+}
+
+// refresh must be called with the mutex of the entry held. Without force, a token another node
+// has put in Redis is taken as is, with force it's taken only if it's newer than the local one.
+func (e *entry) refresh(ck string, force bool) error {
+	if !common.RedisEnabled {
+		return e.fetch(ck)
+	}
+	if token := getRedisToken(ck); token.valid() && (!force || e.token == nil || token.ExpiresAt.After(e.token.ExpiresAt)) {
+		e.setToken(token)
+		return nil
+	}
+	locked, err := common.RedisSetNX("credential_lock:"+ck, "1", lockTimeout)
+	if err != nil {
+		logger.SysError("failed to acquire credential lock: " + err.Error())
+		return e.fetch(ck)
+	}
+	if locked {
+		defer func() {
+			_ = common.RedisDel("credential_lock:" + ck)
+		}()
+		return e.fetch(ck)
+	}
+	// another node is refreshing this token, keep using the current one if it's still valid
+	if e.token.valid() {
+		return nil
+	}
+	deadline := time.Now().Add(waitForOtherNode)
+	for time.Now().Before(deadline) {
+		time.Sleep(200 * time.Millisecond)
+		if token := getRedisToken(ck); token.valid() {
+			e.setToken(token)
+			return nil
+		}
+	}
+	return e.fetch(ck)
+}
+
+func (e *entry) fetch(ck string) error {
+	token, err := fetchers[e.provider](e.key)
+	if err != nil {
+		return err
+	}
+	if token == nil || token.AccessToken == "" {
+		return fmt.Errorf("%s returned an empty access token", e.provider)
+	}
+	e.setToken(token)
+	if common.RedisEnabled {
+		jsonToken, err := json.Marshal(token)
+		if err == nil {
+			err = common.RedisSet("credential:"+ck, string(jsonToken), time.Until(token.ExpiresAt))
+		}
+		if err != nil {
+			logger.SysError("failed to save credential to Redis: " + err.Error())
+		}
+	}
+	return nil
+}
+
+func (e *entry) setToken(token *Token) {
+	e.token = token
+	e.refreshAt = nextRefreshAt(token)
+}
+
+func getRedisToken(ck string) *Token {
+	value, err := common.RedisGet("credential:" + ck)
+	if err != nil {
+		return nil
+	}
+	var token Token
+	if json.Unmarshal([]byte(value), &token) != nil {
+		return nil
+	}
+	return &token
+}
+
+// AutomaticallyRefreshTokens renews the tokens in use before they expire, so that requests don't wait
+// for the token exchange. Tokens not used for a while are dropped, their channels are probably gone
+// or disabled, and the next request fetches a new one anyway.
+func AutomaticallyRefreshTokens() {
+	for {
+		time.Sleep(refreshInterval)
+		now := time.Now()
+		entries.Range(func(ck, value any) bool {
+			e := value.(*entry)
+			if !e.mutex.TryLock() {
+				// a request is already fetching it
+				return true
+			}
+			defer e.mutex.Unlock()
+			if e.token == nil || now.Before(e.refreshAt) {
+				return true
+			}
+			if now.Sub(e.lastUsed) > unusedTimeout {
+				entries.Delete(ck)
+				return true
+			}
+			err := e.refresh(ck.(string), true)
+			if err != nil {
+				logger.SysError(fmt.Sprintf("failed to refresh %s credential: %s", e.provider, err.Error()))
+				// try again later, but not on every round
+				e.refreshAt = now.Add(time.Duration(60+rand.Intn(60)) * time.Second)
+			}
+			return true
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package credential
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common"
+)
+
+func TestGet(t *testing.T) {
+	common.RedisEnabled = false
+	fetched := 0
+	Register("test", func(key string) (*Token, error) {
+		fetched++
+		return &Token{AccessToken: key + "-token", ExpiresAt: time.Now().Add(time.Hour)}, nil
+	})
+	Convey("get", t, func() {
+		token, err := Get("test", "a")
+		So(err, ShouldBeNil)
+		So(token, ShouldEqual, "a-token")
+		_, _ = Get("test", "a")
+		So(fetched, ShouldEqual, 1)
+		_, _ = Get("test", "b")
+		So(fetched, ShouldEqual, 2)
+		_, err = Get("unknown", "a")
+		So(err, ShouldNotBeNil)
+	})
+	Convey("refresh with jitter", t, func() {
+		token := &Token{ExpiresAt: time.Now().Add(100 * time.Minute)}
+		refreshAt := nextRefreshAt(token)
+		So(refreshAt, ShouldHappenOnOrBetween, token.ExpiresAt.Add(-20*time.Minute-time.Second), token.ExpiresAt.Add(-10*time.Minute+time.Second))
+		So(nextRefreshAt(&Token{ExpiresAt: time.Now().Add(-time.Minute)}), ShouldHappenOnOrBefore, time.Now())
+	})
+}
@@ -8,7 +8,10 @@ const (
 	Status            = "status"
 	Channel           = "channel"
 	ChannelId         = "channel_id"
+	ChannelKeyIndex   = "channel_key_index"
+	ChannelKeyHash    = "channel_key_hash" // the key of a channel of several keys, for its health
 	SpecificChannelId = "specific_channel_id"
+	SpecificKeyIndex  = "specific_key_index" // the key which the object of the Assistants API belongs to the account of
 	RequestModel      = "request_model"
 	ConvertedRequest  = "converted_request"
 	OriginalModel     = "original_model"
@@ -17,7 +20,20 @@ const (
 	ChannelName       = "channel_name"
 	TokenId           = "token_id"
 	TokenName         = "token_name"
+	TokenStreamPolicy = "token_stream_policy"
+	TokenLane         = "token_lane"
+	LaneRelease       = "lane_release" // gives back the slot of the channel taken by the priority lane
+	TokenWebhookURL   = "token_webhook_url"
+	ContentPolicy     = "content_policy" // the profile of the token
+	TokenKey          = "token_key"
 	BaseURL           = "base_url"
 	AvailableModels   = "available_models"
 	KeyRequestBody    = "key_request_body"
+	// the uploads are spooled to a file instead, see common.SpoolRequestBody
+	SpooledRequestBody = "spooled_request_body"
+	PreConsumedQuota   = "pre_consumed_quota"
+	CacheStorage       = "cache_storage"
+	Trace              = "trace"
+	// the usage is asked for by the relay itself, the client didn't ask for the last chunk carrying it
+	HideUsageChunk = "hide_usage_chunk"
 )
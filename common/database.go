@@ -10,3 +10,6 @@ var UsingMySQL = false
 
 var SQLitePath = "one-api.db"
 var SQLiteBusyTimeout = env.Int("SQLITE_BUSY_TIMEOUT", 3000)
+
+// e.g. WAL, for the requests not to be blocked by the writes, empty means the default of SQLite
+var SQLiteJournalMode = env.String("SQLITE_JOURNAL_MODE", "")
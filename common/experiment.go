@@ -0,0 +1,70 @@
+package common
+
+import (
+	"context"
+	"hash/fnv"
+	"strconv"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+const (
+	ExperimentControl   = "control"
+	ExperimentTreatment = "treatment"
+)
+
+type ExperimentAssignment struct {
+	Experiment string
+	Variant    string
+	Model      string
+	ChannelId  int
+	StartedAt  time.Time
+}
+
+type experimentContextKey struct{}
+
+// AssignExperiment returns the variant serving the model for the user, nil if the model is not in an experiment.
+// A user always gets the same variant of an experiment, so that answers from both models don't mix in a conversation.
+func AssignExperiment(modelName string, userId int) *ExperimentAssignment {
+	experiment, ok := config.ModelExperiments[modelName]
+	if !ok {
+		return nil
+	}
+	if experiment.Name == "" {
+		experiment.Name = modelName
+	}
+	assignment := &ExperimentAssignment{
+		Experiment: experiment.Name,
+		StartedAt:  time.Now(),
+	}
+	variant := experiment.Control
+	assignment.Variant = ExperimentControl
+	if experimentBucket(experiment.Name, userId) < experiment.TreatmentPercent {
+		variant = experiment.Treatment
+		assignment.Variant = ExperimentTreatment
+	}
+	assignment.Model = variant.Model
+	if assignment.Model == "" {
+		assignment.Model = modelName
+	}
+	assignment.ChannelId = variant.ChannelId
+	return assignment
+}
+
+// experimentBucket spreads users over 100 buckets, differently for each experiment
+func experimentBucket(experiment string, userId int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(experiment + ":" + strconv.Itoa(userId)))
+	return int(h.Sum32() % 100)
+}
+
+// WithExperiment tags the request context, logs recorded with it are attributed to the variant
+func WithExperiment(ctx context.Context, assignment *ExperimentAssignment) context.Context {
+	return context.WithValue(ctx, experimentContextKey{}, assignment)
+}
+
+func GetExperiment(ctx context.Context) *ExperimentAssignment {
+	assignment, _ := ctx.Value(experimentContextKey{}).(*ExperimentAssignment)
+	return assignment
+}
@@ -0,0 +1,39 @@
+package common
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestAssignExperiment(t *testing.T) {
+	Convey("AssignExperiment", t, func() {
+		config.ModelExperiments = map[string]config.ModelExperiment{
+			"gpt-4o": {
+				Control:          config.ExperimentVariant{Model: "gpt-4o"},
+				Treatment:        config.ExperimentVariant{Model: "gpt-4o-mini", ChannelId: 3},
+				TreatmentPercent: 20,
+			},
+		}
+		defer func() {
+			config.ModelExperiments = map[string]config.ModelExperiment{}
+		}()
+		So(AssignExperiment("gpt-4", 1), ShouldBeNil)
+
+		treated := 0
+		for userId := 1; userId <= 1000; userId++ {
+			assignment := AssignExperiment("gpt-4o", userId)
+			So(assignment.Experiment, ShouldEqual, "gpt-4o")
+			So(AssignExperiment("gpt-4o", userId).Variant, ShouldEqual, assignment.Variant)
+			if assignment.Variant == ExperimentTreatment {
+				So(assignment.Model, ShouldEqual, "gpt-4o-mini")
+				So(assignment.ChannelId, ShouldEqual, 3)
+				treated++
+			} else {
+				So(assignment.Model, ShouldEqual, "gpt-4o")
+			}
+		}
+		So(treated, ShouldBeBetween, 150, 250)
+	})
+}
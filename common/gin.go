@@ -10,6 +10,9 @@ import (
 )
 
 func GetRequestBody(c *gin.Context) ([]byte, error) {
+	if _, ok := c.Get(ctxkey.SpooledRequestBody); ok {
+		return nil, ErrRequestBodySpooled
+	}
 	requestBody, _ := c.Get(ctxkey.KeyRequestBody)
 	if requestBody != nil {
 		return requestBody.([]byte), nil
@@ -23,6 +26,13 @@ func GetRequestBody(c *gin.Context) ([]byte, error) {
 	return requestBody.([]byte), nil
 }
 
+// SetRequestBody replaces the request body, the cached one included
+func SetRequestBody(c *gin.Context, requestBody []byte) {
+	c.Set(ctxkey.KeyRequestBody, requestBody)
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	c.Request.ContentLength = int64(len(requestBody))
+}
+
 func UnmarshalBodyReusable(c *gin.Context, v any) error {
 	requestBody, err := GetRequestBody(c)
 	if err != nil {
@@ -43,6 +53,26 @@ func UnmarshalBodyReusable(c *gin.Context, v any) error {
 	return nil
 }
 
+// PeekBodyReusable is like UnmarshalBodyReusable, but only the given top-level fields are decoded,
+// which is much cheaper for huge requests of which only the model name or so is needed. The body is
+// still buffered like with UnmarshalBodyReusable
+func PeekBodyReusable(c *gin.Context, fields map[string]any) error {
+	requestBody, err := GetRequestBody(c)
+	if err != nil {
+		return err
+	}
+	contentType := c.Request.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "application/json") {
+		err = PeekJSONFields(requestBody, fields)
+	}
+	if err != nil {
+		return err
+	}
+	// Reset request body
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	return nil
+}
+
 func SetEventStreamHeaders(c *gin.Context) {
 	c.Writer.Header().Set("Content-Type", "text/event-stream")
 	c.Writer.Header().Set("Cache-Control", "no-cache")
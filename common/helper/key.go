@@ -1,5 +1,6 @@
 package helper
 
 const (
-	RequestIdKey = "X-Oneapi-Request-Id"
+	RequestIdKey      = "X-Oneapi-Request-Id"
+	ConversationIdKey = "X-Conversation-Id"
 )
@@ -0,0 +1,19 @@
+package helper
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Sign is the hex HMAC-SHA256 of the message, for the links and the identifiers which must not be forged
+func Sign(secret string, message string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature compares the signature with the one of the message in constant time
+func VerifySignature(secret string, message string, signature string) bool {
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, message)))
+}
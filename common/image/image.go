@@ -6,13 +6,13 @@ import (
 	"github.com/songquanpeng/one-api/common/client"
 	"image"
 	_ "image/gif"
-	_ "image/jpeg"
-	_ "image/png"
+	"image/jpeg"
+	"image/png"
 	"net/http"
 	"regexp"
 	"strings"
-	"sync"
 
+	"golang.org/x/image/draw"
 	_ "golang.org/x/image/webp"
 )
 
@@ -76,32 +76,78 @@ func GetImageFromUrl(url string) (mimeType string, data string, err error) {
 	return
 }
 
-var (
-	reg = regexp.MustCompile(`data:image/([^;]+);base64,`)
-)
-
-var readerPool = sync.Pool{
-	New: func() interface{} {
-		return &bytes.Reader{}
-	},
+// dataURLData returns the base64 part of a data URL, without copying it
+func dataURLData(url string) string {
+	if i := strings.Index(url, ";base64,"); i != -1 && strings.HasPrefix(url, "data:") {
+		return url[i+len(";base64,"):]
+	}
+	return url
 }
 
+// GetImageSizeFromBase64 decodes only the header of the image, not the whole base64 data
 func GetImageSizeFromBase64(encoded string) (width int, height int, err error) {
-	decoded, err := base64.StdEncoding.DecodeString(reg.ReplaceAllString(encoded, ""))
+	img, _, err := image.DecodeConfig(base64.NewDecoder(base64.StdEncoding, strings.NewReader(dataURLData(encoded))))
 	if err != nil {
 		return 0, 0, err
 	}
+	return img.Width, img.Height, nil
+}
 
-	reader := readerPool.Get().(*bytes.Reader)
-	defer readerPool.Put(reader)
-	reader.Reset(decoded)
+// GetDataURLSize returns the size of the image after decoding, it's calculated from the length of the base64 data
+func GetDataURLSize(url string) int {
+	data := strings.TrimRight(dataURLData(url), "=")
+	return len(data) * 3 / 4
+}
 
-	img, _, err := image.DecodeConfig(reader)
+// Downscale resizes the image of a data URL to fit in maxDimension x maxDimension, keeping the aspect ratio.
+// JPEG images are encoded as JPEG again, others as PNG to keep transparency. Images which fit already are
+// returned as is, and false.
+func Downscale(url string, maxDimension int) (string, bool, error) {
+	data := dataURLData(url)
+	config, format, err := image.DecodeConfig(base64.NewDecoder(base64.StdEncoding, strings.NewReader(data)))
 	if err != nil {
-		return 0, 0, err
+		return "", false, err
+	}
+	if config.Width <= maxDimension && config.Height <= maxDimension {
+		return url, false, nil
+	}
+	src, _, err := image.Decode(base64.NewDecoder(base64.StdEncoding, strings.NewReader(data)))
+	if err != nil {
+		return "", false, err
 	}
+	width, height := maxDimension, config.Height*maxDimension/config.Width
+	if config.Height > config.Width {
+		width, height = config.Width*maxDimension/config.Height, maxDimension
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
 
-	return img.Width, img.Height, nil
+	var buffer strings.Builder
+	mimeType := "image/png"
+	if format == "jpeg" {
+		mimeType = "image/jpeg"
+	}
+	buffer.WriteString("data:" + mimeType + ";base64,")
+	encoder := base64.NewEncoder(base64.StdEncoding, &buffer)
+	if format == "jpeg" {
+		err = jpeg.Encode(encoder, dst, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(encoder, dst)
+	}
+	if err != nil {
+		return "", false, err
+	}
+	err = encoder.Close()
+	if err != nil {
+		return "", false, err
+	}
+	return buffer.String(), true, nil
 }
 
 func GetImageSize(image string) (width int, height int, err error) {
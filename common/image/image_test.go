@@ -6,7 +6,7 @@ import (
 	"image"
 	_ "image/gif"
 	_ "image/jpeg"
-	_ "image/png"
+	"image/png"
 	"io"
 	"net/http"
 	"strconv"
@@ -175,3 +175,27 @@ func TestGetImageSizeFromBase64(t *testing.T) {
 		})
 	}
 }
+
+func TestDownscale(t *testing.T) {
+	var buffer strings.Builder
+	encoder := base64.NewEncoder(base64.StdEncoding, &buffer)
+	assert.NoError(t, png.Encode(encoder, image.NewRGBA(image.Rect(0, 0, 400, 100))))
+	assert.NoError(t, encoder.Close())
+	url := "data:image/png;base64," + buffer.String()
+
+	assert.InDelta(t, base64.StdEncoding.DecodedLen(buffer.Len()), img.GetDataURLSize(url), 2)
+
+	same, changed, err := img.Downscale(url, 400)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, url, same)
+
+	resized, changed, err := img.Downscale(url, 200)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.True(t, strings.HasPrefix(resized, "data:image/png;base64,"))
+	width, height, err := img.GetImageSizeFromBase64(resized)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, width)
+	assert.Equal(t, 50, height)
+}
@@ -0,0 +1,123 @@
+package imagehost
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+)
+
+// the images are saved in HostedImagePath shared by all the nodes, and removed once their links expire
+
+const sweepInterval = time.Hour
+
+var extensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/webp": ".webp",
+	"image/gif":  ".gif",
+}
+
+var sweepOnce sync.Once
+
+func getDir() string {
+	return config.HostedImagePath
+}
+
+// Configured tells if the images can be hosted, the links must be valid on whichever node serves them
+func Configured() bool {
+	return config.HostedImagePath != "" && config.SignedLinkSecret != ""
+}
+
+// sign signs the name with the expiry, so that the link works for anyone, but only until it expires
+func sign(name string, expiresAt int64) string {
+	return helper.Sign(config.SignedLinkSecret, fmt.Sprintf("image:%s:%d", name, expiresAt))
+}
+
+func Verify(name string, expiresAt int64, signature string) bool {
+	return Configured() && expiresAt >= helper.GetTimestamp() &&
+		helper.VerifySignature(config.SignedLinkSecret, fmt.Sprintf("image:%s:%d", name, expiresAt), signature)
+}
+
+// Path returns the path of the image, or "" if the name isn't one of the saved images
+func Path(name string) string {
+	if name != filepath.Base(name) {
+		return ""
+	}
+	for _, extension := range extensions {
+		if filepath.Ext(name) == extension {
+			return filepath.Join(getDir(), name)
+		}
+	}
+	return ""
+}
+
+// SaveDataURL saves the image of a base64 data URL, and returns the signed link to it
+func SaveDataURL(dataURL string) (string, error) {
+	if !Configured() {
+		return "", errors.New("HOSTED_IMAGE_PATH and SIGNED_LINK_SECRET are not set")
+	}
+	header, data, ok := strings.Cut(strings.TrimPrefix(dataURL, "data:"), ",")
+	mimeType, isBase64 := strings.CutSuffix(header, ";base64")
+	if !ok || !isBase64 {
+		return "", errors.New("not a base64 data URL")
+	}
+	extension := extensions[mimeType]
+	if extension == "" {
+		return "", fmt.Errorf("unsupported image type %s", mimeType)
+	}
+	image, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", err
+	}
+	err = os.MkdirAll(getDir(), 0755)
+	if err != nil {
+		return "", err
+	}
+	name := random.GetUUID() + extension
+	err = os.WriteFile(filepath.Join(getDir(), name), image, 0644)
+	if err != nil {
+		return "", err
+	}
+	sweepOnce.Do(func() {
+		go sweepPeriodically()
+	})
+	expiresAt := helper.GetTimestamp() + int64(config.HostedImageTTL)
+	return fmt.Sprintf("%s/api/image/%s?expires=%d&signature=%s", config.ServerAddress, name, expiresAt, sign(name, expiresAt)), nil
+}
+
+func sweepPeriodically() {
+	for {
+		sweep()
+		time.Sleep(sweepInterval)
+	}
+}
+
+// sweep removes the images whose links have expired, the ones saved before a restart included
+func sweep() {
+	entries, err := os.ReadDir(getDir())
+	if err != nil {
+		logger.SysError("failed to read the hosted images: " + err.Error())
+		return
+	}
+	deadline := time.Now().Add(-time.Duration(config.HostedImageTTL) * time.Second)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || info.ModTime().After(deadline) {
+			continue
+		}
+		err = os.Remove(filepath.Join(getDir(), entry.Name()))
+		if err != nil {
+			logger.SysError("failed to remove the hosted image: " + err.Error())
+		}
+	}
+}
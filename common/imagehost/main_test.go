@@ -0,0 +1,52 @@
+package imagehost
+
+import (
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestSaveDataURL(t *testing.T) {
+	Convey("SaveDataURL", t, func() {
+		config.HostedImagePath, config.SignedLinkSecret = t.TempDir(), "secret"
+		defer func() { config.HostedImagePath, config.SignedLinkSecret = "", "" }()
+
+		Convey("saves the image and signs the link", func() {
+			link, err := SaveDataURL("data:image/png;base64,iVBORw0KGgo=")
+			So(err, ShouldBeNil)
+			parsed, err := url.Parse(link)
+			So(err, ShouldBeNil)
+			name := path.Base(parsed.Path)
+			So(path.Ext(name), ShouldEqual, ".png")
+			expiresAt, _ := strconv.ParseInt(parsed.Query().Get("expires"), 10, 64)
+			So(Verify(name, expiresAt, parsed.Query().Get("signature")), ShouldBeTrue)
+			So(Verify(name, expiresAt+1, parsed.Query().Get("signature")), ShouldBeFalse)
+			So(Verify(name, 1, sign(name, 1)), ShouldBeFalse)
+
+			data, err := os.ReadFile(Path(name))
+			So(err, ShouldBeNil)
+			So(data, ShouldResemble, []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'})
+		})
+
+		Convey("requires the shared path and the secret", func() {
+			config.SignedLinkSecret = ""
+			_, err := SaveDataURL("data:image/png;base64,iVBORw0KGgo=")
+			So(err, ShouldNotBeNil)
+			So(Verify("image.png", 1<<40, sign("image.png", 1<<40)), ShouldBeFalse)
+		})
+
+		Convey("rejects what's not an image", func() {
+			_, err := SaveDataURL("https://example.com/image.png")
+			So(err, ShouldNotBeNil)
+			_, err = SaveDataURL("data:text/html;base64,PGgxPg==")
+			So(err, ShouldNotBeNil)
+			So(Path("../config.go"), ShouldEqual, "")
+			So(Path("image.html"), ShouldEqual, "")
+		})
+	})
+}
@@ -2,6 +2,7 @@ package network
 
 import (
 	"context"
+	"net"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -17,3 +18,15 @@ func TestIsIpInSubnet(t *testing.T) {
 		So(isIpInSubnet(ctx, ip2, subnet), ShouldBeFalse)
 	})
 }
+
+func TestIsPublicIP(t *testing.T) {
+	Convey("IsPublicIP", t, func() {
+		for _, ip := range []string{"8.8.8.8", "125.216.250.89", "2001:4860:4860::8888"} {
+			So(IsPublicIP(net.ParseIP(ip)), ShouldBeTrue)
+		}
+		for _, ip := range []string{"127.0.0.1", "10.0.0.1", "172.16.0.1", "192.168.0.5", "169.254.169.254", "100.64.0.1",
+			"0.0.0.0", "::1", "fe80::1", "fd00::1", "::ffff:127.0.0.1"} {
+			So(IsPublicIP(net.ParseIP(ip)), ShouldBeFalse)
+		}
+	})
+}
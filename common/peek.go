@@ -0,0 +1,117 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+var errInvalidJSON = errors.New("invalid json")
+
+// PeekJSONFields decodes only the given top-level fields of a JSON object into their values,
+// everything else is skipped without being decoded, and the scan stops once every field is found.
+// It works on the whole body in memory, what it saves is the time and the allocations of a full decode
+func PeekJSONFields(data []byte, fields map[string]any) error {
+	i := skipJSONSpace(data, 0)
+	if i >= len(data) || data[i] != '{' {
+		return errInvalidJSON
+	}
+	remaining := len(fields)
+	i++
+	for remaining > 0 {
+		i = skipJSONSpace(data, i)
+		if i >= len(data) {
+			return errInvalidJSON
+		}
+		if data[i] == '}' {
+			return nil
+		}
+		keyEnd, err := skipJSONValue(data, i)
+		if err != nil || data[i] != '"' {
+			return errInvalidJSON
+		}
+		var key string
+		err = json.Unmarshal(data[i:keyEnd], &key)
+		if err != nil {
+			return err
+		}
+		i = skipJSONSpace(data, keyEnd)
+		if i >= len(data) || data[i] != ':' {
+			return errInvalidJSON
+		}
+		i = skipJSONSpace(data, i+1)
+		valueEnd, err := skipJSONValue(data, i)
+		if err != nil {
+			return err
+		}
+		if v, ok := fields[key]; ok {
+			err = json.Unmarshal(data[i:valueEnd], v)
+			if err != nil {
+				return err
+			}
+			remaining--
+		}
+		i = skipJSONSpace(data, valueEnd)
+		if i < len(data) && data[i] == ',' {
+			i++
+		}
+	}
+	return nil
+}
+
+func skipJSONSpace(data []byte, i int) int {
+	for i < len(data) && (data[i] == ' ' || data[i] == '\t' || data[i] == '\n' || data[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+// skipJSONValue returns the index right after the value which starts at i
+func skipJSONValue(data []byte, i int) (int, error) {
+	if i >= len(data) {
+		return 0, errInvalidJSON
+	}
+	switch data[i] {
+	case '"':
+		for i++; i < len(data); i++ {
+			switch data[i] {
+			case '\\':
+				i++
+			case '"':
+				return i + 1, nil
+			}
+		}
+		return 0, errInvalidJSON
+	case '{', '[':
+		depth := 0
+		for i < len(data) {
+			switch data[i] {
+			case '"':
+				end, err := skipJSONValue(data, i)
+				if err != nil {
+					return 0, err
+				}
+				i = end
+				continue
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return i + 1, nil
+				}
+			}
+			i++
+		}
+		return 0, errInvalidJSON
+	default:
+		start := i
+		for i < len(data) && data[i] != ',' && data[i] != '}' && data[i] != ']' &&
+			data[i] != ' ' && data[i] != '\t' && data[i] != '\n' && data[i] != '\r' {
+			i++
+		}
+		if i == start {
+			return 0, errInvalidJSON
+		}
+		return i, nil
+	}
+}
@@ -0,0 +1,31 @@
+package common
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPeekJSONFields(t *testing.T) {
+	Convey("PeekJSONFields", t, func() {
+		data := []byte(`{"messages": [{"role": "user", "content": "a \"quoted\" {brace]"}], "stream": true, "model": "gpt-4o", "max_tokens": 10}`)
+		var model string
+		var stream bool
+		var maxTokens int
+		err := PeekJSONFields(data, map[string]any{"model": &model, "stream": &stream, "max_tokens": &maxTokens})
+		So(err, ShouldBeNil)
+		So(model, ShouldEqual, "gpt-4o")
+		So(stream, ShouldBeTrue)
+		So(maxTokens, ShouldEqual, 10)
+
+		model = ""
+		err = PeekJSONFields([]byte(`{"input": ["x"]}`), map[string]any{"model": &model})
+		So(err, ShouldBeNil)
+		So(model, ShouldEqual, "")
+
+		err = PeekJSONFields([]byte(`{"model": "gpt-4o`), map[string]any{"model": &model})
+		So(err, ShouldNotBeNil)
+		err = PeekJSONFields([]byte(`[]`), map[string]any{"model": &model})
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,28 @@
+package render
+
+import "bytes"
+
+// LineBuffer holds what's written to a stream until the lines are complete, so that the events can be passed
+// through line by line however they are split by the writes
+type LineBuffer struct {
+	bytes.Buffer
+}
+
+// EachLine takes all the complete lines out of the buffer in order, the incomplete one is kept for the rest,
+// it stops at the first error of handle
+func (b *LineBuffer) EachLine(handle func(line []byte) error) error {
+	for {
+		line, err := b.ReadBytes('\n')
+		if err != nil {
+			// an incomplete line, wait for the rest
+			rest := append([]byte{}, line...)
+			b.Reset()
+			b.Write(rest)
+			return nil
+		}
+		err = handle(line)
+		if err != nil {
+			return err
+		}
+	}
+}
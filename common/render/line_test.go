@@ -0,0 +1,36 @@
+package render
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLineBuffer(t *testing.T) {
+	Convey("LineBuffer", t, func() {
+		buffer := LineBuffer{}
+		var lines []string
+		collect := func(line []byte) error {
+			lines = append(lines, string(line))
+			return nil
+		}
+
+		Convey("passes the complete lines however they are split", func() {
+			buffer.WriteString("data: {\"a\"")
+			So(buffer.EachLine(collect), ShouldBeNil)
+			So(lines, ShouldBeEmpty)
+			buffer.WriteString(":1}\n\ndata: [DO")
+			So(buffer.EachLine(collect), ShouldBeNil)
+			So(lines, ShouldResemble, []string{"data: {\"a\":1}\n", "\n"})
+			So(buffer.String(), ShouldEqual, "data: [DO")
+		})
+
+		Convey("stops at the first error", func() {
+			buffer.WriteString("a\nb\n")
+			err := errors.New("closed")
+			So(buffer.EachLine(func(line []byte) error { return err }), ShouldEqual, err)
+			So(buffer.String(), ShouldEqual, "b\n")
+		})
+	})
+}
@@ -0,0 +1,108 @@
+package render
+
+import (
+	"bytes"
+	"math"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const NDJSONContentType = "application/x-ndjson"
+
+// AcceptsNDJSON reports whether the client prefers NDJSON to SSE for the streams, by the q values of the Accept header,
+// for the clients on platforms where EventSource is unavailable
+func AcceptsNDJSON(accept string) bool {
+	ndjsonQuality, sseQuality := -1.0, -1.0
+	for _, item := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(item))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			quality, err = strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case NDJSONContentType, "application/ndjson", "application/jsonl":
+			ndjsonQuality = math.Max(ndjsonQuality, quality)
+		case "text/event-stream":
+			sseQuality = math.Max(sseQuality, quality)
+		}
+	}
+	return ndjsonQuality > 0 && ndjsonQuality >= sseQuality
+}
+
+// NDJSONWriter converts the event stream written to it into one JSON chunk per line, the events are
+// produced as usual, so that every adaptor streams NDJSON. The named events are written without their
+// names, the chunks of them carry their types, and [DONE] is dropped, the end of the response ends the stream.
+// The responses which aren't event streams are written as is.
+type NDJSONWriter struct {
+	gin.ResponseWriter
+	isStream *bool // decided by the content type, once it's set
+	pending  LineBuffer
+}
+
+func NewNDJSONWriter(w gin.ResponseWriter) *NDJSONWriter {
+	return &NDJSONWriter{ResponseWriter: w}
+}
+
+func (w *NDJSONWriter) stream() bool {
+	if w.isStream == nil {
+		contentType := w.Header().Get("Content-Type")
+		if contentType == "" {
+			return false
+		}
+		isStream := strings.HasPrefix(contentType, "text/event-stream")
+		w.isStream = &isStream
+	}
+	if *w.isStream && !w.ResponseWriter.Written() {
+		// the content type is set again by every event rendered, until the header is written
+		w.Header().Set("Content-Type", NDJSONContentType)
+	}
+	return *w.isStream
+}
+
+func (w *NDJSONWriter) Write(data []byte) (int, error) {
+	if !w.stream() {
+		return w.ResponseWriter.Write(data)
+	}
+	w.pending.Write(data)
+	err := w.pending.EachLine(func(line []byte) error {
+		chunk, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+		chunk = bytes.TrimSpace(chunk)
+		if !ok || len(chunk) == 0 || string(chunk) == "[DONE]" {
+			return nil
+		}
+		_, err := w.ResponseWriter.Write(append(chunk, '\n'))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (w *NDJSONWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *NDJSONWriter) WriteHeader(code int) {
+	w.stream()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *NDJSONWriter) WriteHeaderNow() {
+	w.stream()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *NDJSONWriter) Flush() {
+	w.stream()
+	w.ResponseWriter.Flush()
+}
@@ -0,0 +1,43 @@
+package render
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common"
+)
+
+func TestAcceptsNDJSON(t *testing.T) {
+	Convey("AcceptsNDJSON", t, func() {
+		So(AcceptsNDJSON("application/x-ndjson"), ShouldBeTrue)
+		So(AcceptsNDJSON("application/json, application/x-ndjson"), ShouldBeTrue)
+		So(AcceptsNDJSON("text/event-stream;q=0.9, application/x-ndjson"), ShouldBeTrue)
+		So(AcceptsNDJSON("text/event-stream, application/x-ndjson;q=0.5"), ShouldBeFalse)
+		So(AcceptsNDJSON("application/x-ndjson;q=0"), ShouldBeFalse)
+		So(AcceptsNDJSON("*/*"), ShouldBeFalse)
+		So(AcceptsNDJSON(""), ShouldBeFalse)
+	})
+}
+
+func TestNDJSONWriter(t *testing.T) {
+	Convey("NDJSONWriter", t, func() {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Writer = NewNDJSONWriter(c.Writer)
+		common.SetEventStreamHeaders(c)
+		StringData(c, `{"id":"1"}`)
+		_, _ = c.Writer.WriteString("event: message_stop\ndata: {\"type\":")
+		_, _ = c.Writer.WriteString("\"message_stop\"}\n\n: keep-alive\n\n")
+		Done(c)
+		So(recorder.Result().Header.Get("Content-Type"), ShouldEqual, NDJSONContentType)
+		So(recorder.Body.String(), ShouldEqual, "{\"id\":\"1\"}\n{\"type\":\"message_stop\"}\n")
+
+		recorder = httptest.NewRecorder()
+		c, _ = gin.CreateTestContext(recorder)
+		c.Writer = NewNDJSONWriter(c.Writer)
+		c.JSON(400, gin.H{"error": "data: invalid"})
+		So(recorder.Body.String(), ShouldEqual, `{"error":"data: invalid"}`)
+	})
+}
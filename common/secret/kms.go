@@ -0,0 +1,119 @@
+package secret
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/songquanpeng/one-api/common/env"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+const kmsRefPrefix = "kms:"
+
+// KMSStore encrypts secrets with a key of AWS KMS, only the ciphertext is saved in the database
+type KMSStore struct {
+	KeyId       string
+	Region      string
+	Credentials aws.Credentials
+	signer      *v4.Signer
+}
+
+func newKMSStore() *KMSStore {
+	s := &KMSStore{
+		KeyId:  env.String("KMS_KEY_ID", ""),
+		Region: env.String("AWS_REGION", ""),
+		Credentials: aws.Credentials{
+			AccessKeyID:     env.String("AWS_ACCESS_KEY_ID", ""),
+			SecretAccessKey: env.String("AWS_SECRET_ACCESS_KEY", ""),
+			SessionToken:    env.String("AWS_SESSION_TOKEN", ""),
+		},
+		signer: v4.NewSigner(),
+	}
+	if s.KeyId == "" || s.Region == "" || s.Credentials.AccessKeyID == "" || s.Credentials.SecretAccessKey == "" {
+		logger.FatalLog("KMS_KEY_ID, AWS_REGION, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set when SECRET_STORE is kms")
+	}
+	return s
+}
+
+func (s *KMSStore) do(action string, body map[string]string) (map[string]any, error) {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("https://kms.%s.amazonaws.com/", s.Region), bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+	payloadHash := sha256.Sum256(jsonData)
+	err = s.signer.SignHTTP(context.Background(), s.Credentials, req, hex.EncodeToString(payloadHash[:]), "kms", s.Region, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("kms %s returned status code %d: %s", action, resp.StatusCode, string(responseBody))
+	}
+	var result map[string]any
+	err = json.Unmarshal(responseBody, &result)
+	return result, err
+}
+
+func (s *KMSStore) Put(secret string) (string, error) {
+	result, err := s.do("Encrypt", map[string]string{
+		"KeyId":     s.KeyId,
+		"Plaintext": base64.StdEncoding.EncodeToString([]byte(secret)),
+	})
+	if err != nil {
+		return "", err
+	}
+	ciphertext, _ := result["CiphertextBlob"].(string)
+	if ciphertext == "" {
+		return "", fmt.Errorf("kms returned no ciphertext")
+	}
+	return kmsRefPrefix + ciphertext, nil
+}
+
+func (s *KMSStore) Get(ref string) (string, error) {
+	result, err := s.do("Decrypt", map[string]string{
+		"CiphertextBlob": strings.TrimPrefix(ref, kmsRefPrefix),
+	})
+	if err != nil {
+		return "", err
+	}
+	plaintext, _ := result["Plaintext"].(string)
+	secret, err := base64.StdEncoding.DecodeString(plaintext)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+func (s *KMSStore) Owns(value string) bool {
+	return strings.HasPrefix(value, kmsRefPrefix)
+}
+
+// Delete does nothing, the ciphertext is saved in the database and goes away with the channel
+func (s *KMSStore) Delete(ref string) error {
+	return nil
+}
@@ -0,0 +1,127 @@
+package secret
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/env"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// Store keeps channel secrets outside the database, only a reference to the secret is saved in it
+type Store interface {
+	// Put stores the secret and returns the reference to be saved in the database
+	Put(secret string) (ref string, err error)
+	// Get returns the secret of a reference returned by Put
+	Get(ref string) (secret string, err error)
+	// Owns reports whether the value saved in the database is a reference of this store
+	Owns(value string) bool
+	// Delete removes the secret of a reference returned by Put
+	Delete(ref string) error
+}
+
+// DBStore keeps secrets in the database as is, it's the default
+type DBStore struct{}
+
+func (DBStore) Put(secret string) (string, error) {
+	return secret, nil
+}
+
+func (DBStore) Get(ref string) (string, error) {
+	return ref, nil
+}
+
+func (DBStore) Owns(value string) bool {
+	return false
+}
+
+func (DBStore) Delete(ref string) error {
+	return nil
+}
+
+var store Store = DBStore{}
+
+// resolved secrets are cached, references are never reused for another secret
+var resolved = make(map[string]string)
+var resolvedLock sync.RWMutex
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+func Init() {
+	storeType := env.String("SECRET_STORE", "db")
+	switch storeType {
+	case "db":
+		return
+	case "vault":
+		store = newVaultStore()
+	case "kms":
+		store = newKMSStore()
+	default:
+		logger.FatalLog(fmt.Sprintf("unknown SECRET_STORE: %s", storeType))
+	}
+	logger.SysLog("channel secrets are stored in " + storeType)
+}
+
+// Put stores the secret with the configured store, values which are already references are kept as is
+func Put(secret string) (string, error) {
+	if secret == "" || IsReference(secret) {
+		return secret, nil
+	}
+	return store.Put(secret)
+}
+
+// Resolve returns the secret a value saved in the database stands for
+func Resolve(value string) (string, error) {
+	if !IsReference(value) {
+		return value, nil
+	}
+	resolvedLock.RLock()
+	secret, ok := resolved[value]
+	resolvedLock.RUnlock()
+	if ok {
+		return secret, nil
+	}
+	if !store.Owns(value) {
+		return "", fmt.Errorf("secret %s does not belong to the configured secret store", strings.SplitN(value, ":", 2)[0])
+	}
+	secret, err := store.Get(value)
+	if err != nil {
+		return "", err
+	}
+	resolvedLock.Lock()
+	resolved[value] = secret
+	resolvedLock.Unlock()
+	return secret, nil
+}
+
+// Delete removes the secret a value saved in the database stands for, values which aren't references are ignored
+func Delete(value string) error {
+	if !IsReference(value) {
+		return nil
+	}
+	if !store.Owns(value) {
+		return fmt.Errorf("secret %s does not belong to the configured secret store", strings.SplitN(value, ":", 2)[0])
+	}
+	err := store.Delete(value)
+	if err != nil {
+		return err
+	}
+	resolvedLock.Lock()
+	delete(resolved, value)
+	resolvedLock.Unlock()
+	return nil
+}
+
+// IsExternal reports whether secrets are kept outside the database
+func IsExternal() bool {
+	_, ok := store.(DBStore)
+	return !ok
+}
+
+// IsReference reports whether a value saved in the database is a reference instead of the secret itself
+func IsReference(value string) bool {
+	return strings.HasPrefix(value, vaultRefPrefix) || strings.HasPrefix(value, kmsRefPrefix)
+}
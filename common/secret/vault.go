@@ -0,0 +1,113 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common/env"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+)
+
+const vaultRefPrefix = "vault:"
+
+// VaultStore keeps secrets in the KV version 2 secrets engine of HashiCorp Vault
+type VaultStore struct {
+	Address    string
+	Token      string
+	Mount      string
+	PathPrefix string
+}
+
+type vaultSecret struct {
+	Data struct {
+		Data map[string]string `json:"data"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+func newVaultStore() *VaultStore {
+	s := &VaultStore{
+		Address:    strings.TrimSuffix(env.String("VAULT_ADDR", ""), "/"),
+		Token:      env.String("VAULT_TOKEN", ""),
+		Mount:      env.String("VAULT_MOUNT", "secret"),
+		PathPrefix: strings.Trim(env.String("VAULT_PATH_PREFIX", "one-api/channels"), "/"),
+	}
+	if s.Address == "" || s.Token == "" {
+		logger.FatalLog("VAULT_ADDR and VAULT_TOKEN must be set when SECRET_STORE is vault")
+	}
+	return s
+}
+
+// do calls the data endpoint of the secret for the versions and the metadata endpoint for the secret itself
+func (s *VaultStore) do(method string, endpoint string, path string, body any) (*vaultSecret, error) {
+	var reader *bytes.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(jsonData)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, fmt.Sprintf("%s/v1/%s/%s/%s", s.Address, s.Mount, endpoint, path), reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", s.Token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNoContent {
+		return &vaultSecret{}, nil
+	}
+	var result vaultSecret
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return nil, fmt.Errorf("vault returned status code %d: %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault returned status code %d: %s", resp.StatusCode, strings.Join(result.Errors, "; "))
+	}
+	return &result, nil
+}
+
+func (s *VaultStore) Put(secret string) (string, error) {
+	path := fmt.Sprintf("%s/%s", s.PathPrefix, random.GetUUID())
+	_, err := s.do(http.MethodPost, "data", path, map[string]any{
+		"data": map[string]string{"key": secret},
+	})
+	if err != nil {
+		return "", err
+	}
+	return vaultRefPrefix + path, nil
+}
+
+func (s *VaultStore) Get(ref string) (string, error) {
+	result, err := s.do(http.MethodGet, "data", strings.TrimPrefix(ref, vaultRefPrefix), nil)
+	if err != nil {
+		return "", err
+	}
+	secret, ok := result.Data.Data["key"]
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no key", ref)
+	}
+	return secret, nil
+}
+
+func (s *VaultStore) Owns(value string) bool {
+	return strings.HasPrefix(value, vaultRefPrefix)
+}
+
+// Delete removes all the versions of the secret along with its metadata
+func (s *VaultStore) Delete(ref string) error {
+	_, err := s.do(http.MethodDelete, "metadata", strings.TrimPrefix(ref, vaultRefPrefix), nil)
+	return err
+}
@@ -0,0 +1,81 @@
+package secret
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// newTestVault is a KV version 2 engine in memory
+func newTestVault() *httptest.Server {
+	var lock sync.Mutex
+	secrets := make(map[string]string)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if r.Header.Get("X-Vault-Token") != "test-token" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		switch {
+		case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/v1/secret/data/"):
+			var body struct {
+				Data map[string]string `json:"data"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			secrets[strings.TrimPrefix(r.URL.Path, "/v1/secret/data/")] = body.Data["key"]
+			_, _ = w.Write([]byte(`{"data":{"version":1}}`))
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/secret/data/"):
+			key, ok := secrets[strings.TrimPrefix(r.URL.Path, "/v1/secret/data/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"errors":[]}`))
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"data": map[string]string{"key": key}}})
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v1/secret/metadata/"):
+			delete(secrets, strings.TrimPrefix(r.URL.Path, "/v1/secret/metadata/"))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+}
+
+func TestVaultStore(t *testing.T) {
+	server := newTestVault()
+	defer server.Close()
+	original := store
+	store = &VaultStore{Address: server.URL, Token: "test-token", Mount: "secret", PathPrefix: "one-api/channels"}
+	defer func() { store = original }()
+
+	Convey("the secret is stored, resolved and deleted", t, func() {
+		ref, err := Put("sk-test")
+		So(err, ShouldBeNil)
+		So(ref, ShouldStartWith, "vault:one-api/channels/")
+		key, err := Resolve(ref)
+		So(err, ShouldBeNil)
+		So(key, ShouldEqual, "sk-test")
+
+		So(Delete(ref), ShouldBeNil)
+		resolvedLock.RLock()
+		_, cached := resolved[ref]
+		resolvedLock.RUnlock()
+		So(cached, ShouldBeFalse)
+		_, err = Resolve(ref)
+		So(err, ShouldNotBeNil)
+	})
+	Convey("the references of other stores aren't resolved nor deleted", t, func() {
+		_, err := Resolve("kms:ciphertext")
+		So(err, ShouldNotBeNil)
+		So(Delete("kms:ciphertext"), ShouldNotBeNil)
+		So(Delete("sk-plain"), ShouldBeNil)
+	})
+}
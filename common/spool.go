@@ -0,0 +1,111 @@
+package common
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+)
+
+// the values of the fields are small, unlike the files
+const maxMultipartFieldLength = 64 * 1024
+
+var ErrRequestBodySpooled = errors.New("the request body is spooled to a file")
+var ErrRequestBodyTooLarge = errors.New("the request body is too large")
+
+// SpoolRequestBody saves the body to a temporary file rather than the memory, for the uploads like the images to edit,
+// every attempt of the request reads it from the file, which is removed once the request is done.
+// A body larger than maxBytes is rejected with ErrRequestBodyTooLarge, 0 means no limit
+func SpoolRequestBody(c *gin.Context, maxBytes int64) error {
+	if _, ok := c.Get(ctxkey.SpooledRequestBody); ok {
+		return nil
+	}
+	if maxBytes > 0 && c.Request.ContentLength > maxBytes {
+		return ErrRequestBodyTooLarge
+	}
+	file, err := os.CreateTemp("", "one-api-upload-*")
+	if err != nil {
+		return err
+	}
+	ctx := c.Request.Context()
+	go func() {
+		<-ctx.Done()
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}()
+	var body io.Reader = c.Request.Body
+	if maxBytes > 0 {
+		body = io.LimitReader(body, maxBytes+1)
+	}
+	size, err := io.Copy(file, body)
+	_ = c.Request.Body.Close()
+	if err != nil {
+		return err
+	}
+	if maxBytes > 0 && size > maxBytes {
+		return ErrRequestBodyTooLarge
+	}
+	c.Set(ctxkey.SpooledRequestBody, io.NewSectionReader(file, 0, size))
+	c.Request.Body = io.NopCloser(GetSpooledRequestBody(c))
+	return nil
+}
+
+// GetSpooledRequestBody reads the spooled body from the start, it's nil if the body is not spooled.
+// The length of the body is known to the HTTP client by the Size of the reader
+func GetSpooledRequestBody(c *gin.Context) *io.SectionReader {
+	value, ok := c.Get(ctxkey.SpooledRequestBody)
+	if !ok {
+		return nil
+	}
+	body := value.(*io.SectionReader)
+	return io.NewSectionReader(body, 0, body.Size())
+}
+
+// RewindRequestBody resets the body for another attempt of the request
+func RewindRequestBody(c *gin.Context) error {
+	if body := GetSpooledRequestBody(c); body != nil {
+		c.Request.Body = io.NopCloser(body)
+		return nil
+	}
+	requestBody, err := GetRequestBody(c)
+	if err != nil {
+		return err
+	}
+	SetRequestBody(c, requestBody)
+	return nil
+}
+
+// PeekMultipartFields reads the values of the fields of a spooled multipart body, the files are skipped
+func PeekMultipartFields(c *gin.Context) (map[string]string, error) {
+	body := GetSpooledRequestBody(c)
+	if body == nil {
+		return nil, errors.New("the request body is not spooled")
+	}
+	_, params, err := mime.ParseMediaType(c.Request.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	reader := multipart.NewReader(body, params["boundary"])
+	fields := make(map[string]string)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return fields, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FileName() != "" {
+			continue
+		}
+		value, err := io.ReadAll(io.LimitReader(part, maxMultipartFieldLength))
+		if err != nil {
+			return nil, err
+		}
+		fields[part.FormName()] = string(value)
+	}
+}
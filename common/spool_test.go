@@ -0,0 +1,51 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSpoolRequestBody(t *testing.T) {
+	Convey("SpoolRequestBody", t, func() {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		_ = writer.WriteField("model", "dall-e-2")
+		file, _ := writer.CreateFormFile("image", "image.png")
+		_, _ = file.Write(bytes.Repeat([]byte{0x89}, 1024))
+		_ = writer.WriteField("n", "2")
+		_ = writer.Close()
+		size := body.Len()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/images/edits", &body).WithContext(ctx)
+		c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+
+		err := SpoolRequestBody(c, 0)
+		So(err, ShouldBeNil)
+		fields, err := PeekMultipartFields(c)
+		So(err, ShouldBeNil)
+		So(fields, ShouldResemble, map[string]string{"model": "dall-e-2", "n": "2"})
+		So(GetSpooledRequestBody(c).Size(), ShouldEqual, size)
+
+		_, err = GetRequestBody(c)
+		So(err, ShouldEqual, ErrRequestBodySpooled)
+
+		// every attempt reads the whole body
+		for i := 0; i < 2; i++ {
+			So(RewindRequestBody(c), ShouldBeNil)
+			data, err := io.ReadAll(c.Request.Body)
+			So(err, ShouldBeNil)
+			So(len(data), ShouldEqual, size)
+		}
+	})
+}
@@ -0,0 +1,40 @@
+package testdb
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/songquanpeng/one-api/common"
+	"gorm.io/gorm"
+)
+
+// Use points dbs at a new SQLite database migrated by initDB, e.g. model.InitDB, with redis disabled,
+// they are restored when the test finishes. It's only for the tests.
+func Use(t *testing.T, initDB func(envName string) (*gorm.DB, error), dbs ...**gorm.DB) {
+	t.Helper()
+	oldDBs := make([]*gorm.DB, len(dbs))
+	for i, db := range dbs {
+		oldDBs[i] = *db
+	}
+	oldPath, oldRedisEnabled := common.SQLitePath, common.RedisEnabled
+	t.Setenv("SQL_DSN", "")
+	common.SQLitePath = filepath.Join(t.TempDir(), "one-api.db")
+	db, err := initDB("SQL_DSN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range dbs {
+		*target = db
+	}
+	common.RedisEnabled = false
+	t.Cleanup(func() {
+		sqlDB, err := db.DB()
+		if err == nil {
+			_ = sqlDB.Close()
+		}
+		for i, target := range dbs {
+			*target = oldDBs[i]
+		}
+		common.SQLitePath, common.RedisEnabled = oldPath, oldRedisEnabled
+	})
+}
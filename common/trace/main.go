@@ -0,0 +1,65 @@
+package trace
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+)
+
+// Trace records when each phase of a request ended, the duration of a phase is the time since the previous one ended
+type Trace struct {
+	mutex  sync.Mutex
+	start  time.Time
+	last   time.Time
+	phases []Phase
+}
+
+type Phase struct {
+	Name      string  `json:"name"`
+	ChannelId int     `json:"channel_id,omitempty"`
+	End       float64 `json:"end"`      // milliseconds since the request arrived
+	Duration  float64 `json:"duration"` // unit is millisecond
+}
+
+// Start attaches a new trace to the request, requests without one are not traced and Mark does nothing
+func Start(c *gin.Context) *Trace {
+	now := time.Now()
+	t := &Trace{start: now, last: now}
+	c.Set(ctxkey.Trace, t)
+	return t
+}
+
+// Mark ends the current phase of the request
+func Mark(c *gin.Context, name string) {
+	value, ok := c.Get(ctxkey.Trace)
+	if !ok {
+		return
+	}
+	t := value.(*Trace)
+	now := time.Now()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.phases = append(t.phases, Phase{
+		Name:      name,
+		ChannelId: c.GetInt(ctxkey.ChannelId),
+		End:       milliseconds(now.Sub(t.start)),
+		Duration:  milliseconds(now.Sub(t.last)),
+	})
+	t.last = now
+}
+
+func (t *Trace) Elapsed() time.Duration {
+	return time.Since(t.start)
+}
+
+func (t *Trace) Phases() []Phase {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([]Phase(nil), t.phases...)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
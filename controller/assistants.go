@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	relaycontroller "github.com/songquanpeng/one-api/relay/controller"
+)
+
+const assistantRunPollInterval = 30 * time.Second
+
+// the runs which can't be fetched for this long are given up, in seconds, e.g. the channel has been deleted
+const assistantRunTimeout = 24 * 60 * 60
+
+func RelayAssistants(c *gin.Context) {
+	bizErr := relaycontroller.RelayAssistantsHelper(c)
+	if bizErr == nil {
+		return
+	}
+	relaycontroller.ReturnPreConsumedQuota(c)
+	logger.Errorf(c.Request.Context(), "relay assistants error: %s", bizErr.Error.Message)
+	bizErr.Error.Message = helper.MessageWithRequestId(bizErr.Error.Message, c.GetString(helper.RequestIdKey))
+	c.JSON(bizErr.StatusCode, gin.H{
+		"error": bizErr.Error,
+	})
+}
+
+// AutomaticallySettleAssistantRuns polls the channels for the unfinished runs, and bills the finished ones,
+// the runs are settled at once if the client gets them finished
+func AutomaticallySettleAssistantRuns() {
+	for {
+		time.Sleep(assistantRunPollInterval)
+		settleAssistantRuns()
+	}
+}
+
+func settleAssistantRuns() {
+	runs, err := model.GetUnfinishedAssistantRuns()
+	if err != nil {
+		logger.SysError("failed to get unfinished assistant runs: " + err.Error())
+		return
+	}
+	now := helper.GetTimestamp()
+	for _, run := range runs {
+		err = relaycontroller.SettleAssistantRun(context.Background(), run)
+		if err == nil {
+			continue
+		}
+		logger.SysError(fmt.Sprintf("failed to settle run %s of channel #%d: %s", run.RunId, run.ChannelId, err.Error()))
+		if now-run.CreatedAt > assistantRunTimeout {
+			err = relaycontroller.ExpireAssistantRun(context.Background(), run)
+			if err != nil {
+				logger.SysError(fmt.Sprintf("failed to expire run %s: %s", run.RunId, err.Error()))
+			}
+		}
+	}
+}
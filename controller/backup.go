@@ -0,0 +1,36 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// DownloadBackup sends a snapshot of the SQLite database taken while it's in use, it holds all the keys of the channels
+func DownloadBackup(c *gin.Context) {
+	if !common.UsingSQLite {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "仅支持备份 SQLite 数据库，其他数据库请使用其自带的备份工具",
+		})
+		return
+	}
+	path, cleanup, err := model.CreateSQLiteBackup()
+	if err != nil {
+		logger.SysError("failed to back up the database: " + err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	defer cleanup()
+	logger.SysLog(fmt.Sprintf("database backup downloaded by user #%d", c.GetInt(ctxkey.Id)))
+	c.FileAttachment(path, fmt.Sprintf("one-api-%s.db", time.Now().Format("20060102-150405")))
+}
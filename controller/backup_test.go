@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func TestDownloadBackup(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("DownloadBackup sends a snapshot of the SQLite database", t, func() {
+		useTestDB(t)
+		So(model.DB.Create(&model.Channel{Id: 1, Key: "sk-test", Name: "openai"}).Error, ShouldBeNil)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/backup", nil)
+		DownloadBackup(c)
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Header().Get("Content-Disposition"), ShouldStartWith, `attachment; filename="one-api-`)
+		So(w.Body.Len(), ShouldBeGreaterThan, 0)
+		So(w.Body.String()[:16], ShouldEqual, "SQLite format 3\x00")
+	})
+}
@@ -0,0 +1,316 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+const (
+	benchMaxRequests    = 100000
+	benchMaxConcurrency = 256
+	benchModel          = "gpt-3.5-turbo"
+)
+
+// only one benchmark at a time, otherwise they measure each other
+var benchLock sync.Mutex
+
+type benchRequest struct {
+	Requests    int  `json:"requests"`
+	Concurrency int  `json:"concurrency"`
+	Stream      bool `json:"stream"`
+}
+
+type benchResult struct {
+	Requests          int     `json:"requests"`
+	Concurrency       int     `json:"concurrency"`
+	Stream            bool    `json:"stream"`
+	Failed            int     `json:"failed"`
+	Duration          float64 `json:"duration"` // unit is second
+	RPS               float64 `json:"rps"`
+	P50               float64 `json:"p50"` // unit is millisecond
+	P90               float64 `json:"p90"`
+	P99               float64 `json:"p99"`
+	Max               float64 `json:"max"`
+	AllocsPerRequest  uint64  `json:"allocs_per_request"`
+	BytesPerRequest   uint64  `json:"bytes_per_request"`
+	LastErrorMessage  string  `json:"last_error_message,omitempty"`
+	UpstreamLatencyMs float64 `json:"upstream_latency_ms"`
+}
+
+// RunBenchmark relays synthetic requests to a mock upstream inside this process, so that the result is
+// the overhead of the gateway itself: parsing, token counting, request conversion and response handling.
+// Neither quota nor logs are touched. The server keeps serving while the benchmark runs,
+// so allocations are measured process wide and should be read on an idle instance.
+func RunBenchmark(c *gin.Context) {
+	req := benchRequest{Requests: 1000, Concurrency: 16}
+	err := c.ShouldBindJSON(&req)
+	if err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	if req.Requests <= 0 || req.Requests > benchMaxRequests || req.Concurrency <= 0 || req.Concurrency > benchMaxConcurrency {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("请求数须在 1 到 %d 之间，并发数须在 1 到 %d 之间", benchMaxRequests, benchMaxConcurrency),
+		})
+		return
+	}
+	if !benchLock.TryLock() {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "已有压测正在进行",
+		})
+		return
+	}
+	defer benchLock.Unlock()
+	result, err := runBenchmark(req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    result,
+	})
+}
+
+func runBenchmark(req benchRequest) (*benchResult, error) {
+	// the mock upstream listens on the loopback, so that the requests go through the same http client as the real ones
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start the mock upstream: %w", err)
+	}
+	upstream := &http.Server{Handler: http.HandlerFunc(serveBenchUpstream)}
+	go func() {
+		_ = upstream.Serve(listener)
+	}()
+	defer upstream.Close()
+	upstreamURL := "http://" + listener.Addr().String()
+	body, err := json.Marshal(relaymodel.GeneralOpenAIRequest{
+		Model:  benchModel,
+		Stream: req.Stream,
+		Messages: []relaymodel.Message{
+			{Role: "system", Content: "You are a helpful assistant."},
+			{Role: "user", Content: "Write a short poem about the sea, in exactly four lines."},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the first request warms up connections and lazily initialized state such as the tokenizer
+	err = benchRelayOnce(upstreamURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("warm up failed: %w", err)
+	}
+	upstreamLatency := measureBenchUpstream(upstreamURL)
+
+	latencies := make([]time.Duration, req.Requests)
+	jobs := make(chan int)
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	result := &benchResult{
+		Requests:          req.Requests,
+		Concurrency:       req.Concurrency,
+		Stream:            req.Stream,
+		UpstreamLatencyMs: toMilliseconds(upstreamLatency),
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	startTime := time.Now()
+	for i := 0; i < req.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				requestStartTime := time.Now()
+				err := benchRelayOnce(upstreamURL, body)
+				latencies[idx] = time.Since(requestStartTime)
+				if err != nil {
+					mutex.Lock()
+					result.Failed++
+					result.LastErrorMessage = err.Error()
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
+	for i := 0; i < req.Requests; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	elapsed := time.Since(startTime)
+	runtime.ReadMemStats(&after)
+
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+	result.Duration = elapsed.Seconds()
+	result.RPS = float64(req.Requests) / elapsed.Seconds()
+	result.P50 = toMilliseconds(percentile(latencies, 0.50))
+	result.P90 = toMilliseconds(percentile(latencies, 0.90))
+	result.P99 = toMilliseconds(percentile(latencies, 0.99))
+	result.Max = toMilliseconds(latencies[len(latencies)-1])
+	result.AllocsPerRequest = (after.Mallocs - before.Mallocs) / uint64(req.Requests)
+	result.BytesPerRequest = (after.TotalAlloc - before.TotalAlloc) / uint64(req.Requests)
+	return result, nil
+}
+
+// benchRelayOnce goes through the same steps as RelayTextHelper, except billing
+func benchRelayOnce(baseURL string, body []byte) error {
+	request, err := http.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	c, _ := gin.CreateTestContext(&benchResponseWriter{header: make(http.Header)})
+	c.Request = request
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Request.Header.Set("Authorization", "Bearer bench")
+	c.Set(ctxkey.Channel, channeltype.OpenAI)
+	c.Set(ctxkey.BaseURL, baseURL)
+	c.Set(ctxkey.RequestModel, benchModel)
+	meta := meta.GetByContext(c)
+
+	textRequest := &relaymodel.GeneralOpenAIRequest{}
+	err = common.UnmarshalBodyReusable(c, textRequest)
+	if err != nil {
+		return err
+	}
+	meta.IsStream = textRequest.Stream
+	meta.OriginModelName, meta.ActualModelName = textRequest.Model, textRequest.Model
+	meta.PromptTokens = openai.CountTokenMessages(textRequest.Messages, textRequest.Model)
+	adaptor := relay.GetAdaptor(meta.APIType)
+	if adaptor == nil {
+		return fmt.Errorf("invalid api type: %d", meta.APIType)
+	}
+	adaptor.Init(meta)
+	convertedRequest, err := adaptor.ConvertRequest(c, meta.Mode, textRequest)
+	if err != nil {
+		return err
+	}
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		return err
+	}
+	resp, err := adaptor.DoRequest(c, meta, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("mock upstream returned status code %d", resp.StatusCode)
+	}
+	_, respErr := adaptor.DoResponse(c, resp, meta)
+	if respErr != nil {
+		return errors.New(respErr.Message)
+	}
+	return nil
+}
+
+// benchResponseWriter discards the response relayed to the client, the benchmark only needs to know if it failed
+type benchResponseWriter struct {
+	header http.Header
+}
+
+func (w *benchResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *benchResponseWriter) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (w *benchResponseWriter) WriteHeader(statusCode int) {}
+
+// Flush is needed for the streams
+func (w *benchResponseWriter) Flush() {}
+
+// measureBenchUpstream is the median latency of the mock upstream alone, the part of p50 the gateway is not responsible for
+func measureBenchUpstream(baseURL string) time.Duration {
+	const samples = 50
+	latencies := make([]time.Duration, 0, samples)
+	for i := 0; i < samples; i++ {
+		startTime := time.Now()
+		resp, err := http.Post(baseURL+"/v1/chat/completions", "application/json", bytes.NewReader([]byte("{}")))
+		if err != nil {
+			continue
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		latencies = append(latencies, time.Since(startTime))
+	}
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+	return percentile(latencies, 0.50)
+}
+
+func serveBenchUpstream(w http.ResponseWriter, r *http.Request) {
+	var request relaymodel.GeneralOpenAIRequest
+	_ = json.NewDecoder(r.Body).Decode(&request)
+	content := "The sea is wide and deep and blue,\nIt sings a song both old and new,\nIt holds the sky within its hand,\nAnd gently kisses every land."
+	if !request.Stream {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(openai.TextResponse{
+			Id:      "chatcmpl-bench",
+			Object:  "chat.completion",
+			Created: time.Now().Unix(),
+			Model:   benchModel,
+			Choices: []openai.TextResponseChoice{{
+				Message:      relaymodel.Message{Role: "assistant", Content: content},
+				FinishReason: "stop",
+			}},
+			Usage: relaymodel.Usage{PromptTokens: 30, CompletionTokens: 40, TotalTokens: 70},
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, word := range bytes.Fields([]byte(content)) {
+		chunk, _ := json.Marshal(openai.ChatCompletionsStreamResponse{
+			Id:      "chatcmpl-bench",
+			Object:  "chat.completion.chunk",
+			Created: time.Now().Unix(),
+			Model:   benchModel,
+			Choices: []openai.ChatCompletionsStreamResponseChoice{{
+				Delta: relaymodel.Message{Role: "assistant", Content: string(word) + " "},
+			}},
+		})
+		_, _ = fmt.Fprintf(w, "data: %s\n\n", chunk)
+	}
+	_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(float64(len(sorted)-1)*p)]
+}
+
+func toMilliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
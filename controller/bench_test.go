@@ -0,0 +1,31 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestRunBenchmark(t *testing.T) {
+	Convey("runBenchmark relays to the mock upstream on the loopback", t, func() {
+		// the token encoders aren't loaded in the tests
+		oldApproximateTokenEnabled := config.ApproximateTokenEnabled
+		config.ApproximateTokenEnabled = true
+		t.Cleanup(func() {
+			config.ApproximateTokenEnabled = oldApproximateTokenEnabled
+		})
+		if client.HTTPClient == nil {
+			client.HTTPClient = http.DefaultClient
+		}
+		for _, stream := range []bool{false, true} {
+			result, err := runBenchmark(benchRequest{Requests: 20, Concurrency: 4, Stream: stream})
+			So(err, ShouldBeNil)
+			So(result.Failed, ShouldEqual, 0)
+			So(result.LastErrorMessage, ShouldBeEmpty)
+			So(result.P50, ShouldBeGreaterThan, 0)
+		}
+	})
+}
@@ -81,6 +81,17 @@ type APGC2DGPTUsageResponse struct {
 	TotalUsed      float64 `json:"total_used"`
 }
 
+type MoonshotBalanceResponse struct {
+	Code   int    `json:"code"`
+	Error  string `json:"error"`
+	Status bool   `json:"status"`
+	Data   struct {
+		AvailableBalance float64 `json:"available_balance"` // in CNY, vouchers included
+		VoucherBalance   float64 `json:"voucher_balance"`
+		CashBalance      float64 `json:"cash_balance"`
+	} `json:"data"`
+}
+
 // GetAuthHeader get auth header
 func GetAuthHeader(token string) http.Header {
 	h := http.Header{}
@@ -203,6 +214,25 @@ func updateChannelAIGC2DBalance(channel *model.Channel) (float64, error) {
 	return response.TotalAvailable, nil
 }
 
+// https://platform.moonshot.cn/docs/api/misc
+func updateChannelMoonshotBalance(channel *model.Channel) (float64, error) {
+	url := fmt.Sprintf("%s/v1/users/me/balance", channel.GetBaseURL())
+	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
+	if err != nil {
+		return 0, err
+	}
+	response := MoonshotBalanceResponse{}
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return 0, err
+	}
+	if !response.Status || response.Code != 0 {
+		return 0, fmt.Errorf("code: %d, message: %s", response.Code, response.Error)
+	}
+	channel.UpdateBalance(response.Data.AvailableBalance)
+	return response.Data.AvailableBalance, nil
+}
+
 func updateChannelBalance(channel *model.Channel) (float64, error) {
 	baseURL := channeltype.ChannelBaseURLs[channel.Type]
 	if channel.GetBaseURL() == "" {
@@ -227,6 +257,8 @@ func updateChannelBalance(channel *model.Channel) (float64, error) {
 		return updateChannelAPI2GPTBalance(channel)
 	case channeltype.AIGC2D:
 		return updateChannelAIGC2DBalance(channel)
+	case channeltype.Moonshot:
+		return updateChannelMoonshotBalance(channel)
 	default:
 		return 0, errors.New("尚未实现")
 	}
@@ -305,7 +337,7 @@ func updateAllChannelsBalance() error {
 			continue
 		}
 		// TODO: support Azure
-		if channel.Type != channeltype.OpenAI && channel.Type != channeltype.Custom {
+		if channel.Type != channeltype.OpenAI && channel.Type != channeltype.Custom && channel.Type != channeltype.Moonshot {
 			continue
 		}
 		balance, err := updateChannelBalance(channel)
@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+func TestUpdateChannelMoonshotBalance(t *testing.T) {
+	Convey("updateChannelBalance queries the balance of a Moonshot channel", t, func() {
+		useTestDB(t)
+		if client.HTTPClient == nil {
+			client.HTTPClient = http.DefaultClient
+		}
+		var path, authorization string
+		response := `{"code":0,"data":{"available_balance":49.5,"voucher_balance":10,"cash_balance":39.5},"scode":"0x0","status":true}`
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path, authorization = r.URL.Path, r.Header.Get("Authorization")
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(response))
+		}))
+		defer server.Close()
+		baseURL := server.URL
+		channel := &model.Channel{Id: 1, Type: channeltype.Moonshot, Key: "sk-moonshot", Name: "moonshot",
+			Status: model.ChannelStatusEnabled, BaseURL: &baseURL}
+		So(model.DB.Create(channel).Error, ShouldBeNil)
+
+		balance, err := updateChannelBalance(channel)
+		So(err, ShouldBeNil)
+		So(balance, ShouldEqual, 49.5)
+		So(path, ShouldEqual, "/v1/users/me/balance")
+		So(authorization, ShouldEqual, "Bearer sk-moonshot")
+		saved, err := model.GetChannelById(1, true)
+		So(err, ShouldBeNil)
+		So(saved.Balance, ShouldEqual, 49.5)
+
+		response = `{"code":5,"error":"auth failed","status":false}`
+		_, err = updateChannelBalance(channel)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "auth failed")
+	})
+}
@@ -0,0 +1,283 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/message"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+const (
+	keySweepValid   = "valid"
+	keySweepInvalid = "invalid"
+	keySweepUnknown = "unknown" // the upstream failed for another reason, the key may well be fine
+)
+
+type KeySweepKey struct {
+	Index   int    `json:"index"`
+	Key     string `json:"key"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+type KeySweepChannel struct {
+	Id       int           `json:"id"`
+	Name     string        `json:"name"`
+	Keys     []KeySweepKey `json:"keys"`
+	Disabled bool          `json:"disabled"`
+}
+
+type KeySweepReport struct {
+	StartedAt   int64             `json:"started_at"`
+	FinishedAt  int64             `json:"finished_at"`
+	ValidKeys   int               `json:"valid_keys"`
+	InvalidKeys int               `json:"invalid_keys"`
+	UnknownKeys int               `json:"unknown_keys"`
+	Skipped     int               `json:"skipped"`  // the channels of which the keys can't be checked for free
+	Channels    []KeySweepChannel `json:"channels"` // only those with any key not valid
+}
+
+var keySweepLock sync.Mutex
+var keySweepRunning = false
+var lastKeySweepReport *KeySweepReport
+
+// newKeyProbeRequest builds the request of an endpoint which costs nothing, the models list or the like,
+// nil is returned for the channels which have no such endpoint
+func newKeyProbeRequest(channel *model.Channel, cfg model.ChannelConfig, key string) (*http.Request, error) {
+	baseURL := channel.GetBaseURL()
+	switch {
+	case channel.Type == channeltype.Azure:
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/openai/models?api-version=%s", baseURL, cfg.APIVersion), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("api-key", key)
+		return req, nil
+	case channel.Type == channeltype.Anthropic:
+		req, err := http.NewRequest(http.MethodGet, baseURL+"/v1/models", nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("x-api-key", key)
+		req.Header.Set("anthropic-version", "2023-06-01")
+		return req, nil
+	case channel.Type == channeltype.Gemini:
+		req, err := http.NewRequest(http.MethodGet, baseURL+"/v1beta/models", nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("x-goog-api-key", key)
+		return req, nil
+	case channeltype.ToAPIType(channel.Type) == apitype.OpenAI:
+		req, err := http.NewRequest(http.MethodGet, openai.GetFullRequestURL(baseURL, "/v1/models", channel.Type), nil)
+		if err != nil {
+			return nil, err
+		}
+		adaptor.SetupAuthHeader(req, key, cfg)
+		return req, nil
+	}
+	return nil, nil
+}
+
+// probeKey tells whether the key is accepted by upstream, rate limited keys are valid
+func probeKey(req *http.Request) (string, string) {
+	resp, err := client.ImpatientHTTPClient.Do(req)
+	if err != nil {
+		return keySweepUnknown, err.Error()
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusTooManyRequests:
+		return keySweepValid, ""
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return keySweepInvalid, fmt.Sprintf("状态码 %d", resp.StatusCode)
+	case http.StatusBadRequest:
+		// Gemini rejects an invalid key as a bad request
+		if bytes.Contains(body, []byte("API_KEY_INVALID")) {
+			return keySweepInvalid, fmt.Sprintf("状态码 %d", resp.StatusCode)
+		}
+	}
+	return keySweepUnknown, fmt.Sprintf("状态码 %d", resp.StatusCode)
+}
+
+// sweepChannelKeys checks every key of the channel, the invalid ones are marked unhealthy, so that they're no longer
+// selected while the others work. It returns nil if the channel can't be checked
+func sweepChannelKeys(channel *model.Channel) *KeySweepChannel {
+	cfg, err := channel.LoadConfig()
+	if err != nil || cfg.NoAuth {
+		return nil
+	}
+	result := &KeySweepChannel{Id: channel.Id, Name: channel.Name}
+	for i, key := range channel.GetKeys() {
+		req, err := newKeyProbeRequest(channel, cfg, key)
+		if req == nil && err == nil {
+			return nil
+		}
+		item := KeySweepKey{Index: i, Key: monitor.MaskKey(key), Status: keySweepUnknown}
+		if err != nil {
+			item.Message = err.Error()
+		} else {
+			item.Status, item.Message = probeKey(req)
+		}
+		if item.Status == keySweepInvalid {
+			monitor.RecordKeyResult(channel.Id, monitor.HashKey(key), http.StatusUnauthorized, &relaymodel.Error{Message: item.Message}, 0)
+			monitor.MarkKeyDead(channel.Id, monitor.HashKey(key))
+		}
+		result.Keys = append(result.Keys, item)
+		time.Sleep(config.RequestInterval)
+	}
+	return result
+}
+
+func sweepChannelsKeys() (*KeySweepReport, error) {
+	keySweepLock.Lock()
+	if keySweepRunning {
+		keySweepLock.Unlock()
+		return nil, errors.New("密钥检查已在运行中")
+	}
+	keySweepRunning = true
+	keySweepLock.Unlock()
+	defer func() {
+		keySweepLock.Lock()
+		keySweepRunning = false
+		keySweepLock.Unlock()
+	}()
+	channels, err := model.GetAllChannels(0, 0, "all")
+	if err != nil {
+		return nil, err
+	}
+	report := &KeySweepReport{StartedAt: time.Now().Unix(), Channels: []KeySweepChannel{}}
+	for _, channel := range channels {
+		if channel.Status == model.ChannelStatusManuallyDisabled {
+			continue
+		}
+		result := sweepChannelKeys(channel)
+		if result == nil {
+			report.Skipped++
+			continue
+		}
+		invalidKeys, unknownKeys := 0, 0
+		for _, key := range result.Keys {
+			switch key.Status {
+			case keySweepValid:
+				report.ValidKeys++
+			case keySweepInvalid:
+				invalidKeys++
+			default:
+				unknownKeys++
+			}
+		}
+		report.InvalidKeys += invalidKeys
+		report.UnknownKeys += unknownKeys
+		if invalidKeys == len(result.Keys) && invalidKeys > 0 && channel.Status == model.ChannelStatusEnabled && config.KeySweepAutoDisableEnabled {
+			monitor.DisableChannel(channel.Id, channel.Name, "所有密钥均已失效")
+			result.Disabled = true
+		}
+		if invalidKeys > 0 || unknownKeys > 0 {
+			report.Channels = append(report.Channels, *result)
+		}
+	}
+	report.FinishedAt = time.Now().Unix()
+	keySweepLock.Lock()
+	lastKeySweepReport = report
+	keySweepLock.Unlock()
+	return report, nil
+}
+
+// notifyKeySweepReport sends the report to the root user if any key is invalid
+func notifyKeySweepReport(report *KeySweepReport) {
+	if report.InvalidKeys == 0 {
+		return
+	}
+	content := fmt.Sprintf("共检查 %d 个密钥，其中 %d 个有效，%d 个失效，%d 个无法确认。<br/>",
+		report.ValidKeys+report.InvalidKeys+report.UnknownKeys, report.ValidKeys, report.InvalidKeys, report.UnknownKeys)
+	for _, channel := range report.Channels {
+		for _, key := range channel.Keys {
+			if key.Status == keySweepInvalid {
+				content += fmt.Sprintf("渠道「%s」（#%d）第 %d 个密钥 %s 已失效（%s）<br/>", channel.Name, channel.Id, key.Index+1, key.Key, key.Message)
+			}
+		}
+		if channel.Disabled {
+			content += fmt.Sprintf("渠道「%s」（#%d）的所有密钥均已失效，已被禁用<br/>", channel.Name, channel.Id)
+		}
+	}
+	if config.RootUserEmail == "" {
+		config.RootUserEmail = model.GetRootUserEmail()
+	}
+	err := message.Notify(message.ByAll, fmt.Sprintf("发现 %d 个失效的渠道密钥", report.InvalidKeys), "", content)
+	if err != nil {
+		logger.SysError(fmt.Sprintf("failed to send key sweep report: %s", err.Error()))
+	}
+}
+
+// SweepChannelKeys starts checking the keys of every channel, the report is got with GetKeySweepReport once it's done
+func SweepChannelKeys(c *gin.Context) {
+	keySweepLock.Lock()
+	running := keySweepRunning
+	keySweepLock.Unlock()
+	if running {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "密钥检查已在运行中",
+		})
+		return
+	}
+	go func() {
+		report, err := sweepChannelsKeys()
+		if err != nil {
+			logger.SysError("failed to sweep channel keys: " + err.Error())
+			return
+		}
+		notifyKeySweepReport(report)
+	}()
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func GetKeySweepReport(c *gin.Context) {
+	keySweepLock.Lock()
+	report := lastKeySweepReport
+	running := keySweepRunning
+	keySweepLock.Unlock()
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"running": running,
+			"report":  report,
+		},
+	})
+}
+
+func AutomaticallySweepChannelKeys(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Minute)
+		logger.SysLog("checking the keys of all channels")
+		report, err := sweepChannelsKeys()
+		if err != nil {
+			logger.SysError("failed to sweep channel keys: " + err.Error())
+			continue
+		}
+		logger.SysLog(fmt.Sprintf("channel key check finished, %d valid, %d invalid, %d unknown", report.ValidKeys, report.InvalidKeys, report.UnknownKeys))
+		notifyKeySweepReport(report)
+	}
+}
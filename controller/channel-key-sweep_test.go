@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+func TestNewKeyProbeRequest(t *testing.T) {
+	Convey("newKeyProbeRequest uses the free endpoint of the channel", t, func() {
+		baseURL := "https://example.com"
+		newChannel := func(channelType int) *model.Channel {
+			return &model.Channel{Type: channelType, BaseURL: &baseURL}
+		}
+
+		req, err := newKeyProbeRequest(newChannel(channeltype.OpenAI), model.ChannelConfig{}, "sk-openai")
+		So(err, ShouldBeNil)
+		So(req.URL.String(), ShouldEqual, "https://example.com/v1/models")
+		So(req.Header.Get("Authorization"), ShouldEqual, "Bearer sk-openai")
+
+		req, err = newKeyProbeRequest(newChannel(channeltype.Azure), model.ChannelConfig{APIVersion: "2024-02-01"}, "azure-key")
+		So(err, ShouldBeNil)
+		So(req.URL.String(), ShouldEqual, "https://example.com/openai/models?api-version=2024-02-01")
+		So(req.Header.Get("api-key"), ShouldEqual, "azure-key")
+
+		req, err = newKeyProbeRequest(newChannel(channeltype.Anthropic), model.ChannelConfig{}, "sk-ant")
+		So(err, ShouldBeNil)
+		So(req.URL.Path, ShouldEqual, "/v1/models")
+		So(req.Header.Get("x-api-key"), ShouldEqual, "sk-ant")
+		So(req.Header.Get("anthropic-version"), ShouldNotBeEmpty)
+
+		req, err = newKeyProbeRequest(newChannel(channeltype.Gemini), model.ChannelConfig{}, "gemini-key")
+		So(err, ShouldBeNil)
+		So(req.URL.Path, ShouldEqual, "/v1beta/models")
+		So(req.Header.Get("x-goog-api-key"), ShouldEqual, "gemini-key")
+
+		// no endpoint costs nothing
+		req, err = newKeyProbeRequest(newChannel(channeltype.Ali), model.ChannelConfig{}, "ali-key")
+		So(err, ShouldBeNil)
+		So(req, ShouldBeNil)
+	})
+}
+
+func TestProbeKey(t *testing.T) {
+	Convey("probeKey tells the invalid keys from the upstream failures", t, func() {
+		if client.ImpatientHTTPClient == nil {
+			client.ImpatientHTTPClient = http.DefaultClient
+		}
+		status, body := http.StatusOK, ""
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(body))
+		}))
+		defer server.Close()
+		probe := func() string {
+			req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+			result, _ := probeKey(req)
+			return result
+		}
+
+		So(probe(), ShouldEqual, keySweepValid)
+		// a rate limited key works
+		status = http.StatusTooManyRequests
+		So(probe(), ShouldEqual, keySweepValid)
+		status = http.StatusUnauthorized
+		So(probe(), ShouldEqual, keySweepInvalid)
+		status = http.StatusForbidden
+		So(probe(), ShouldEqual, keySweepInvalid)
+		status, body = http.StatusBadRequest, `{"error":{"status":"INVALID_ARGUMENT","details":[{"reason":"API_KEY_INVALID"}]}}`
+		So(probe(), ShouldEqual, keySweepInvalid)
+		status, body = http.StatusBadRequest, `{"error":{"message":"bad request"}}`
+		So(probe(), ShouldEqual, keySweepUnknown)
+		status = http.StatusInternalServerError
+		So(probe(), ShouldEqual, keySweepUnknown)
+	})
+}
+
+func TestSweepChannelsKeys(t *testing.T) {
+	Convey("sweepChannelsKeys checks the keys of every channel", t, func() {
+		useTestDB(t)
+		if client.ImpatientHTTPClient == nil {
+			client.ImpatientHTTPClient = http.DefaultClient
+		}
+		oldAutoDisable := config.KeySweepAutoDisableEnabled
+		config.KeySweepAutoDisableEnabled = true
+		t.Cleanup(func() {
+			config.KeySweepAutoDisableEnabled = oldAutoDisable
+		})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer sk-good-key-1" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`{"object":"list","data":[]}`))
+		}))
+		defer server.Close()
+		baseURL := server.URL
+		// the key stats are kept in memory across the tests
+		for _, channel := range []*model.Channel{
+			{Id: 901, Type: channeltype.OpenAI, Key: "sk-good-key-1\nsk-bad-key-2", Name: "partly", Status: model.ChannelStatusEnabled, BaseURL: &baseURL},
+			{Id: 902, Type: channeltype.OpenAI, Key: "sk-bad-key-3", Name: "invalid", Status: model.ChannelStatusEnabled, BaseURL: &baseURL},
+			{Id: 903, Type: channeltype.Ali, Key: "ali-key", Name: "unchecked", Status: model.ChannelStatusEnabled, BaseURL: &baseURL},
+			{Id: 904, Type: channeltype.OpenAI, Key: "sk-bad-key-4", Name: "disabled", Status: model.ChannelStatusManuallyDisabled, BaseURL: &baseURL},
+		} {
+			So(model.DB.Create(channel).Error, ShouldBeNil)
+		}
+
+		report, err := sweepChannelsKeys()
+		So(err, ShouldBeNil)
+		So(report.ValidKeys, ShouldEqual, 1)
+		So(report.InvalidKeys, ShouldEqual, 2)
+		So(report.UnknownKeys, ShouldEqual, 0)
+		So(report.Skipped, ShouldEqual, 1)
+		So(report.Channels, ShouldHaveLength, 2)
+		results := make(map[int]KeySweepChannel)
+		for _, result := range report.Channels {
+			results[result.Id] = result
+		}
+		So(results[901].Disabled, ShouldBeFalse)
+		So(results[901].Keys, ShouldHaveLength, 2)
+		So(results[901].Keys[1].Status, ShouldEqual, keySweepInvalid)
+		So(results[901].Keys[1].Key, ShouldEqual, monitor.MaskKey("sk-bad-key-2"))
+		So(results[902].Disabled, ShouldBeTrue)
+
+		// the invalid key is no longer selected while the other works
+		stats := monitor.GetKeyStats(901, []string{"sk-good-key-1", "sk-bad-key-2"})
+		So(stats[0].Unauthorized, ShouldEqual, 0)
+		So(stats[1].Unauthorized, ShouldEqual, 1)
+
+		channel, err := model.GetChannelById(901, true)
+		So(err, ShouldBeNil)
+		So(channel.Status, ShouldEqual, model.ChannelStatusEnabled)
+		channel, err = model.GetChannelById(902, true)
+		So(err, ShouldBeNil)
+		So(channel.Status, ShouldEqual, model.ChannelStatusAutoDisabled)
+	})
+}
@@ -0,0 +1,232 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/constant/errortype"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+var preflightHints = map[int]string{
+	errortype.Auth:       "请检查密钥是否正确以及是否有权限",
+	errortype.Quota:      "上游账户余额或额度不足",
+	errortype.Timeout:    "请求上游超时，请检查代理地址（Base URL）与网络",
+	errortype.Network:    "无法连接上游，请检查代理地址（Base URL）与网络",
+	errortype.BadRequest: "请检查模型名称、模型重定向与渠道配置",
+	errortype.Upstream:   "上游服务异常，请稍后再试",
+}
+
+// preflightChannel makes a tiny completion with every key of the channel, so that obviously broken configs
+// are rejected before they take traffic. Models of OpenAI compatible channels are checked against
+// the model list of upstream, and filled from it if none are given.
+func preflightChannel(channel *model.Channel) error {
+	err := syncChannelModels(channel)
+	if err != nil {
+		return err
+	}
+	keys := channel.GetKeys()
+	for i, key := range keys {
+		keyChannel := *channel
+		keyChannel.Key = key
+		statusCode, err, openaiErr := testChannelWithStatusCode(&keyChannel)
+		if err == nil {
+			continue
+		}
+		if openaiErr == nil {
+			openaiErr = &relaymodel.Error{Message: err.Error()}
+		}
+		errorType := monitor.ClassifyError(statusCode, openaiErr)
+		if errorType == errortype.RateLimit {
+			// the key works, upstream is just busy
+			continue
+		}
+		message := err.Error()
+		if hint, ok := preflightHints[errorType]; ok {
+			message = fmt.Sprintf("%s（%s）", hint, message)
+		}
+		if len(keys) > 1 {
+			message = fmt.Sprintf("第 %d 个密钥：%s", i+1, message)
+		}
+		return fmt.Errorf("渠道预检失败：%s", message)
+	}
+	return nil
+}
+
+func syncChannelModels(channel *model.Channel) error {
+	apiType := channeltype.ToAPIType(channel.Type)
+	if (apiType != apitype.OpenAI && apiType != apitype.Ollama) || channel.Type == channeltype.Azure {
+		return nil
+	}
+	upstreamModels, err := fetchUpstreamModels(channel)
+	if err != nil {
+		// plenty of compatible upstreams don't list models, the completion is still checked
+		logger.SysLog(fmt.Sprintf("failed to fetch models from upstream of channel %s: %s", channel.Name, err.Error()))
+		return nil
+	}
+	if channel.Models == "" {
+		channel.Models = strings.Join(upstreamModels, ",")
+		return nil
+	}
+	isAvailable := make(map[string]bool, len(upstreamModels))
+	for _, modelName := range upstreamModels {
+		isAvailable[modelName] = true
+	}
+	modelMapping := channel.GetModelMapping()
+	var missingModels []string
+	for _, modelName := range strings.Split(channel.Models, ",") {
+		actualModelName := modelName
+		if modelMapping[modelName] != "" {
+			actualModelName = modelMapping[modelName]
+		}
+		if !isAvailable[actualModelName] {
+			missingModels = append(missingModels, actualModelName)
+		}
+	}
+	if len(missingModels) != 0 {
+		return fmt.Errorf("渠道预检失败：上游不提供以下模型：%s，请检查模型名称与模型重定向", strings.Join(missingModels, ","))
+	}
+	return nil
+}
+
+// upstreamModel is an item of /v1/models
+type upstreamModel struct {
+	Id string `json:"id"`
+}
+
+// fetchUpstreamModels lists the models served by upstream, from /api/tags for Ollama and /v1/models for the others
+func fetchUpstreamModels(channel *model.Channel) ([]string, error) {
+	cfg, err := channel.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	keys := channel.GetKeys()
+	key := ""
+	if len(keys) != 0 {
+		key = keys[0]
+	} else if !cfg.NoAuth {
+		return nil, fmt.Errorf("key is empty")
+	}
+	url := openai.GetFullRequestURL(channel.GetBaseURL(), "/v1/models", channel.Type)
+	if channel.Type == channeltype.Ollama {
+		url = channel.GetBaseURL() + "/api/tags"
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	adaptor.SetupAuthHeader(req, key, cfg)
+	resp, err := client.ImpatientHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var modelList struct {
+		Data []upstreamModel `json:"data"`
+		// Ollama
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")) {
+		// together.ai returns the list itself
+		err = json.Unmarshal(body, &modelList.Data)
+	} else {
+		err = json.Unmarshal(body, &modelList)
+	}
+	if err != nil {
+		return nil, err
+	}
+	models := make([]string, 0, len(modelList.Data)+len(modelList.Models))
+	for _, item := range modelList.Data {
+		models = append(models, item.Id)
+	}
+	for _, item := range modelList.Models {
+		models = append(models, item.Name)
+	}
+	if len(models) == 0 {
+		return nil, fmt.Errorf("no models returned")
+	}
+	return models, nil
+}
+
+// FetchUpstreamModels lists the models of a channel being edited, so that they don't have to be typed in by hand
+func FetchUpstreamModels(c *gin.Context) {
+	channel := model.Channel{}
+	err := c.ShouldBindJSON(&channel)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if channel.Id != 0 && channel.Key == "" {
+		// the key is left empty when a saved channel is edited without changing it
+		origin, err := model.GetChannelById(channel.Id, true)
+		if err == nil {
+			channel.Key = origin.Key
+		}
+	}
+	models, err := fetchUpstreamModels(&channel)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "获取上游模型列表失败：" + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    models,
+	})
+}
+
+// mergeChannelForPreflight returns what the channel will look like after the update,
+// fields left empty in the update are kept as they are, the same as model.Channel.Update does
+func mergeChannelForPreflight(origin *model.Channel, update *model.Channel) *model.Channel {
+	merged := *origin
+	if update.Type != 0 {
+		merged.Type = update.Type
+	}
+	if update.Key != "" {
+		merged.Key = update.Key
+	}
+	if update.BaseURL != nil && *update.BaseURL != "" {
+		merged.BaseURL = update.BaseURL
+	}
+	if update.Other != nil && *update.Other != "" {
+		merged.Other = update.Other
+	}
+	if update.Models != "" {
+		merged.Models = update.Models
+	}
+	if update.ModelMapping != nil && *update.ModelMapping != "" {
+		merged.ModelMapping = update.ModelMapping
+	}
+	if update.Config != "" {
+		merged.Config = update.Config
+	}
+	return &merged
+}
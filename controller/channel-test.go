@@ -46,6 +46,15 @@ func buildTestRequest() *relaymodel.GeneralOpenAIRequest {
 }
 
 func testChannel(channel *model.Channel) (err error, openaiErr *relaymodel.Error) {
+	_, err, openaiErr = testChannelWithStatusCode(channel)
+	return err, openaiErr
+}
+
+// testChannelWithStatusCode also returns the status code of upstream, which is 0 if upstream wasn't reached
+func testChannelWithStatusCode(channel *model.Channel) (statusCode int, err error, openaiErr *relaymodel.Error) {
+	if err = channel.KeyError(); err != nil {
+		return 0, fmt.Errorf("key of channel can't be resolved: %w", err), nil
+	}
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 	c.Request = &http.Request{
@@ -65,7 +74,7 @@ func testChannel(channel *model.Channel) (err error, openaiErr *relaymodel.Error
 	apiType := channeltype.ToAPIType(channel.Type)
 	adaptor := relay.GetAdaptor(apiType)
 	if adaptor == nil {
-		return fmt.Errorf("invalid api type: %d, adaptor is nil", apiType), nil
+		return 0, fmt.Errorf("invalid api type: %d, adaptor is nil", apiType), nil
 	}
 	adaptor.Init(meta)
 	var modelName string
@@ -88,38 +97,38 @@ func testChannel(channel *model.Channel) (err error, openaiErr *relaymodel.Error
 	meta.OriginModelName, meta.ActualModelName = modelName, modelName
 	convertedRequest, err := adaptor.ConvertRequest(c, relaymode.ChatCompletions, request)
 	if err != nil {
-		return err, nil
+		return 0, err, nil
 	}
 	jsonData, err := json.Marshal(convertedRequest)
 	if err != nil {
-		return err, nil
+		return 0, err, nil
 	}
 	logger.SysLog(string(jsonData))
 	requestBody := bytes.NewBuffer(jsonData)
 	c.Request.Body = io.NopCloser(requestBody)
 	resp, err := adaptor.DoRequest(c, meta, requestBody)
 	if err != nil {
-		return err, nil
+		return 0, err, nil
 	}
 	if resp != nil && resp.StatusCode != http.StatusOK {
 		err := controller.RelayErrorHandler(resp)
-		return fmt.Errorf("status code %d: %s", resp.StatusCode, err.Error.Message), &err.Error
+		return resp.StatusCode, fmt.Errorf("status code %d: %s", resp.StatusCode, err.Error.Message), &err.Error
 	}
 	usage, respErr := adaptor.DoResponse(c, resp, meta)
 	if respErr != nil {
-		return fmt.Errorf("%s", respErr.Error.Message), &respErr.Error
+		return respErr.StatusCode, fmt.Errorf("%s", respErr.Error.Message), &respErr.Error
 	}
 	if usage == nil {
-		return errors.New("usage is nil"), nil
+		return http.StatusOK, errors.New("usage is nil"), nil
 	}
 	result := w.Result()
 	// print result.Body
 	respBody, err := io.ReadAll(result.Body)
 	if err != nil {
-		return err, nil
+		return 0, err, nil
 	}
 	logger.SysLog(fmt.Sprintf("testing channel #%d, response: \n%s", channel.Id, string(respBody)))
-	return nil, nil
+	return http.StatusOK, nil, nil
 }
 
 func TestChannel(c *gin.Context) {
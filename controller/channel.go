@@ -1,10 +1,15 @@
 package controller
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor"
+	"github.com/songquanpeng/one-api/relay/channeltype"
 	"net/http"
 	"strconv"
 	"strings"
@@ -85,7 +90,20 @@ func AddChannel(c *gin.Context) {
 		return
 	}
 	channel.CreatedTime = helper.GetTimestamp()
+	compactServiceAccountKey(&channel)
+	err = validateChannelConfig(&channel)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	keys := strings.Split(channel.Key, "\n")
+	if c.Query("multi_key") == "true" {
+		// keep all keys in one channel, the healthiest key is picked for each request
+		keys = []string{channel.Key}
+	}
 	channels := make([]model.Channel, 0, len(keys))
 	for _, key := range keys {
 		if key == "" {
@@ -95,6 +113,24 @@ func AddChannel(c *gin.Context) {
 		localChannel.Key = key
 		channels = append(channels, localChannel)
 	}
+	if len(channels) == 0 {
+		if cfg, _ := channel.LoadConfig(); cfg.NoAuth {
+			// upstream takes no key
+			channels = append(channels, channel)
+		}
+	}
+	if c.Query("preflight") == "true" {
+		for i := range channels {
+			err = preflightChannel(&channels[i])
+			if err != nil {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+	}
 	err = model.BatchInsertChannels(channels)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -110,6 +146,40 @@ func AddChannel(c *gin.Context) {
 	return
 }
 
+func GetChannelKeyStats(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    monitor.GetKeyStats(channel.Id, channel.GetKeys()),
+	})
+	return
+}
+
+func GetLaneStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    monitor.GetLaneStats(),
+	})
+	return
+}
+
 func DeleteChannel(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	channel := model.Channel{Id: id}
@@ -155,6 +225,35 @@ func UpdateChannel(c *gin.Context) {
 		})
 		return
 	}
+	err = validateChannelConfig(&channel)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if c.Query("preflight") == "true" {
+		originChannel, err := model.GetChannelById(channel.Id, true)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		mergedChannel := mergeChannelForPreflight(originChannel, &channel)
+		err = preflightChannel(mergedChannel)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		channel.Models = mergedChannel.Models
+	}
+	compactServiceAccountKey(&channel)
 	err = channel.Update()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -170,3 +269,31 @@ func UpdateChannel(c *gin.Context) {
 	})
 	return
 }
+
+// compactServiceAccountKey puts the service account key file of a Vertex AI channel on one line,
+// otherwise it would be taken as one key per line
+func compactServiceAccountKey(channel *model.Channel) {
+	if channel.Type != channeltype.VertexAI || channel.Key == "" {
+		return
+	}
+	var buffer bytes.Buffer
+	if json.Compact(&buffer, []byte(channel.Key)) == nil {
+		channel.Key = buffer.String()
+	}
+}
+
+func validateChannelConfig(channel *model.Channel) error {
+	cfg, err := channel.LoadConfig()
+	if err != nil {
+		return nil
+	}
+	err = model.ParseSchedule(cfg.Schedule)
+	if err != nil {
+		return fmt.Errorf("渠道时间段配置错误：%s", err.Error())
+	}
+	err = model.ValidateRetryPolicy(cfg.Retry)
+	if err != nil {
+		return fmt.Errorf("渠道重试配置错误：%s", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// the users with the most violations in the statistics
+const contentViolationTopUsers = 20
+
+// GetContentViolationStat summarizes the violations of the content policy profiles
+func GetContentViolationStat(c *gin.Context) {
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	profile := c.Query("profile")
+	statistics, err := model.GetContentViolationStatistics(startTimestamp, endTimestamp, profile)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	userStatistics, err := model.GetContentViolationUserStatistics(startTimestamp, endTimestamp, profile, contentViolationTopUsers)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	var total int64
+	for _, statistic := range statistics {
+		total += statistic.Count
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"total":      total,
+			"violations": statistics,
+			"top_users":  userStatistics,
+		},
+	})
+}
+
+func DeleteHistoryContentViolations(c *gin.Context) {
+	targetTimestamp, _ := strconv.ParseInt(c.Query("target_timestamp"), 10, 64)
+	if targetTimestamp == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "target timestamp is required",
+		})
+		return
+	}
+	count, err := model.DeleteOldContentViolations(targetTimestamp)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    count,
+	})
+}
@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/model"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+const ephemeralKeyMinTTL = 60
+
+type ephemeralKeyRequest struct {
+	ExpiresIn int64    `json:"expires_in"` // unit is second
+	Quota     int64    `json:"quota"`
+	Models    []string `json:"models"`
+}
+
+type ephemeralKeyResponse struct {
+	Id        int      `json:"id"`
+	Object    string   `json:"object"`
+	Key       string   `json:"key"`
+	ExpiresAt int64    `json:"expires_at"`
+	Quota     int64    `json:"quota"`
+	Models    []string `json:"models,omitempty"`
+}
+
+func writeEphemeralKeyError(c *gin.Context, statusCode int, message string) {
+	c.JSON(statusCode, gin.H{
+		"error": relaymodel.Error{
+			Message: message,
+			Type:    "invalid_request_error",
+			Code:    "invalid_ephemeral_key_request",
+		},
+	})
+}
+
+// CreateEphemeralKey lets a token mint a short-lived key with a tight quota, which is safe to embed in browser clients
+func CreateEphemeralKey(c *gin.Context) {
+	parent, err := model.GetTokenByIds(c.GetInt(ctxkey.TokenId), c.GetInt(ctxkey.Id))
+	if err != nil {
+		writeEphemeralKeyError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if parent.ParentId != 0 {
+		writeEphemeralKeyError(c, http.StatusForbidden, "ephemeral keys can't mint other keys")
+		return
+	}
+	req := ephemeralKeyRequest{}
+	err = c.ShouldBindJSON(&req)
+	if err != nil {
+		writeEphemeralKeyError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.ExpiresIn == 0 {
+		req.ExpiresIn = int64(config.EphemeralKeyDefaultTTL)
+	}
+	if req.ExpiresIn < ephemeralKeyMinTTL || req.ExpiresIn > int64(config.EphemeralKeyMaxTTL) {
+		writeEphemeralKeyError(c, http.StatusBadRequest, fmt.Sprintf("expires_in must be between %d and %d seconds", ephemeralKeyMinTTL, config.EphemeralKeyMaxTTL))
+		return
+	}
+	if req.Quota <= 0 {
+		writeEphemeralKeyError(c, http.StatusBadRequest, "quota must be positive")
+		return
+	}
+	if !parent.UnlimitedQuota && req.Quota > parent.RemainQuota {
+		writeEphemeralKeyError(c, http.StatusBadRequest, fmt.Sprintf("quota exceeds the remaining quota of the token: %d", parent.RemainQuota))
+		return
+	}
+	models := req.Models
+	if parent.Models != nil && *parent.Models != "" {
+		allowedModels := strings.Split(*parent.Models, ",")
+		if len(models) == 0 {
+			models = allowedModels
+		}
+		isAllowed := make(map[string]bool, len(allowedModels))
+		for _, modelName := range allowedModels {
+			isAllowed[modelName] = true
+		}
+		for _, modelName := range models {
+			if !isAllowed[modelName] {
+				writeEphemeralKeyError(c, http.StatusForbidden, fmt.Sprintf("the token is not allowed to use model %s", modelName))
+				return
+			}
+		}
+	}
+	modelList := strings.Join(models, ",")
+	now := helper.GetTimestamp()
+	child := &model.Token{
+		UserId:       parent.UserId,
+		Name:         fmt.Sprintf("%s-ephemeral", parent.Name),
+		Key:          random.GenerateKey(),
+		CreatedTime:  now,
+		AccessedTime: now,
+		ExpiredTime:  now + req.ExpiresIn,
+		RemainQuota:  req.Quota,
+		Models:       &modelList,
+		// the policies of the parent can't be dodged by minting a child
+		Subnet:        parent.Subnet,
+		StreamPolicy:  parent.StreamPolicy,
+		Lane:          parent.Lane,
+		ContentPolicy: parent.ContentPolicy,
+		Honeypot:      parent.Honeypot,
+		WebhookURL:    parent.WebhookURL,
+	}
+	err = model.CreateEphemeralToken(parent, child)
+	if errors.Is(err, model.ErrEphemeralQuotaExceeded) {
+		writeEphemeralKeyError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeEphemeralKeyError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, ephemeralKeyResponse{
+		Id:        child.Id,
+		Object:    "ephemeral_key",
+		Key:       "sk-" + child.Key,
+		ExpiresAt: child.ExpiredTime,
+		Quota:     child.RemainQuota,
+		Models:    models,
+	})
+}
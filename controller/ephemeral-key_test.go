@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func TestCreateEphemeralKeyInheritsPolicies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("an ephemeral key has every policy of the token minting it", t, func() {
+		useTestDB(t)
+		subnet := "10.0.0.0/8"
+		models := "gpt-4o-mini"
+		parent := &model.Token{Id: 1, UserId: 1, Key: "parent-key", Name: "parent", ExpiredTime: -1, RemainQuota: 10000,
+			Models: &models, Subnet: &subnet, StreamPolicy: "force", Lane: "batch", ContentPolicy: "strict",
+			Honeypot: true, WebhookURL: "https://example.com/hook"}
+		So(model.DB.Create(parent).Error, ShouldBeNil)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/ephemeral_keys", strings.NewReader(`{"expires_in":600,"quota":5000}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set(ctxkey.Id, 1)
+		c.Set(ctxkey.TokenId, 1)
+		CreateEphemeralKey(c)
+		So(w.Code, ShouldEqual, http.StatusOK)
+		var response ephemeralKeyResponse
+		So(json.Unmarshal(w.Body.Bytes(), &response), ShouldBeNil)
+
+		child, err := model.GetTokenById(response.Id)
+		So(err, ShouldBeNil)
+		So(child.ParentId, ShouldEqual, parent.Id)
+		So(child.RemainQuota, ShouldEqual, 5000)
+		So(*child.Models, ShouldEqual, models)
+		So(*child.Subnet, ShouldEqual, subnet)
+		So(child.StreamPolicy, ShouldEqual, parent.StreamPolicy)
+		So(child.Lane, ShouldEqual, parent.Lane)
+		So(child.ContentPolicy, ShouldEqual, parent.ContentPolicy)
+		So(child.Honeypot, ShouldBeTrue)
+		So(child.WebhookURL, ShouldEqual, parent.WebhookURL)
+	})
+}
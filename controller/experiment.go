@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// GetExperiments lists the experiments configured in ModelExperiments, with their results in the time range
+func GetExperiments(c *gin.Context) {
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	experiments := make([]gin.H, 0, len(config.ModelExperiments))
+	for modelName, experiment := range config.ModelExperiments {
+		name := experiment.Name
+		if name == "" {
+			name = modelName
+		}
+		statistics, err := model.GetExperimentStatistics(name, startTimestamp, endTimestamp)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		experiments = append(experiments, gin.H{
+			"name":              name,
+			"model":             modelName,
+			"control":           experiment.Control,
+			"treatment":         experiment.Treatment,
+			"treatment_percent": experiment.TreatmentPercent,
+			"statistics":        statistics,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    experiments,
+	})
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	relaycontroller "github.com/songquanpeng/one-api/relay/controller"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"gorm.io/gorm"
+)
+
+const orphanedFileCleanupInterval = time.Hour
+
+func respondFilesError(c *gin.Context, bizErr *relaymodel.ErrorWithStatusCode) {
+	logger.Errorf(c.Request.Context(), "relay files error: %s", bizErr.Error.Message)
+	bizErr.Error.Message = helper.MessageWithRequestId(bizErr.Error.Message, c.GetString(helper.RequestIdKey))
+	c.JSON(bizErr.StatusCode, gin.H{
+		"error": bizErr.Error,
+	})
+}
+
+func RelayFiles(c *gin.Context) {
+	if bizErr := relaycontroller.RelayFilesHelper(c); bizErr != nil {
+		respondFilesError(c, bizErr)
+	}
+}
+
+func ListFiles(c *gin.Context) {
+	if bizErr := relaycontroller.ListFilesHelper(c); bizErr != nil {
+		respondFilesError(c, bizErr)
+	}
+}
+
+// AutomaticallyCleanOrphanedFiles deletes the files of the deleted users from the upstreams,
+// and forgets the files of the deleted channels, which can't be reached any more
+func AutomaticallyCleanOrphanedFiles() {
+	for {
+		time.Sleep(orphanedFileCleanupInterval)
+		cleanOrphanedFiles()
+	}
+}
+
+func cleanOrphanedFiles() {
+	files, err := model.GetOrphanedFiles()
+	if err != nil {
+		logger.SysError("failed to get orphaned files: " + err.Error())
+		return
+	}
+	cleaned := 0
+	for _, file := range files {
+		err = relaycontroller.DeleteUpstreamFile(file)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			// the user is deleted but the channel is still there, it's tried again later
+			logger.SysError(fmt.Sprintf("failed to delete file %s from channel #%d: %s", file.FileId, file.ChannelId, err.Error()))
+			continue
+		}
+		err = model.DeleteFile(file.UserId, file.FileId)
+		if err != nil {
+			logger.SysError(fmt.Sprintf("failed to delete file %s: %s", file.FileId, err.Error()))
+			continue
+		}
+		cleaned++
+	}
+	if cleaned != 0 {
+		logger.SysLog(fmt.Sprintf("%d orphaned files cleaned", cleaned))
+	}
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	relaycontroller "github.com/songquanpeng/one-api/relay/controller"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+const fineTuningJobPollInterval = 5 * time.Minute
+
+// the jobs which can't be fetched for this long are given up, in seconds, e.g. the channel has been deleted
+const fineTuningJobTimeout = 7 * 24 * 60 * 60
+
+func respondFineTuningError(c *gin.Context, bizErr *relaymodel.ErrorWithStatusCode) {
+	logger.Errorf(c.Request.Context(), "relay fine-tuning error: %s", bizErr.Error.Message)
+	bizErr.Error.Message = helper.MessageWithRequestId(bizErr.Error.Message, c.GetString(helper.RequestIdKey))
+	c.JSON(bizErr.StatusCode, gin.H{
+		"error": bizErr.Error,
+	})
+}
+
+func RelayFineTuning(c *gin.Context) {
+	if bizErr := relaycontroller.RelayFineTuningHelper(c); bizErr != nil {
+		relaycontroller.ReturnPreConsumedQuota(c)
+		respondFineTuningError(c, bizErr)
+	}
+}
+
+func ListFineTuningJobs(c *gin.Context) {
+	if bizErr := relaycontroller.ListFineTuningJobsHelper(c); bizErr != nil {
+		respondFineTuningError(c, bizErr)
+	}
+}
+
+// AutomaticallySettleFineTuningJobs polls the channels for the unfinished jobs, and bills the finished ones,
+// the jobs are settled at once if the client gets them finished
+func AutomaticallySettleFineTuningJobs() {
+	for {
+		time.Sleep(fineTuningJobPollInterval)
+		settleFineTuningJobs()
+	}
+}
+
+func settleFineTuningJobs() {
+	jobs, err := model.GetUnfinishedFineTuningJobs()
+	if err != nil {
+		logger.SysError("failed to get unfinished fine-tuning jobs: " + err.Error())
+		return
+	}
+	now := helper.GetTimestamp()
+	for _, job := range jobs {
+		err = relaycontroller.SettleFineTuningJob(context.Background(), job)
+		if err == nil {
+			continue
+		}
+		logger.SysError(fmt.Sprintf("failed to settle fine-tuning job %s of channel #%d: %s", job.JobId, job.ChannelId, err.Error()))
+		if now-job.CreatedAt > fineTuningJobTimeout {
+			err = relaycontroller.ExpireFineTuningJob(context.Background(), job)
+			if err != nil {
+				logger.SysError(fmt.Sprintf("failed to expire fine-tuning job %s: %s", job.JobId, err.Error()))
+			}
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package controller
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// the usage of the last days is fitted with a straight line, which is followed for the coming month,
+// the quota is projected to run out only if that happens within a year
+
+const forecastHorizon = 30
+const forecastMaxDays = 365
+
+type usageTrend struct {
+	intercept float64 // the daily quota on the first day of the history
+	slope     float64 // the change of the daily quota per day
+	days      int
+}
+
+// fitUsageTrend fits the daily quotas by least squares
+func fitUsageTrend(daily []float64) usageTrend {
+	n := float64(len(daily))
+	trend := usageTrend{days: len(daily)}
+	if len(daily) == 0 {
+		return trend
+	}
+	var sumX, sumY, sumXY, sumXX float64
+	for i, y := range daily {
+		x := float64(i)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		trend.intercept = sumY / n
+		return trend
+	}
+	trend.slope = (n*sumXY - sumX*sumY) / denominator
+	trend.intercept = (sumY - trend.slope*sumX) / n
+	return trend
+}
+
+// at is the daily quota projected for the day after the history, a shrinking usage stops at zero
+func (t usageTrend) at(day int) float64 {
+	return math.Max(0, t.intercept+t.slope*float64(t.days+day))
+}
+
+func (t usageTrend) projected(days int) float64 {
+	var total float64
+	for day := 0; day < days; day++ {
+		total += t.at(day)
+	}
+	return total
+}
+
+// exhaustedIn is in how many days the remaining is used up, -1 if it's not within forecastMaxDays
+func (t usageTrend) exhaustedIn(remaining float64) int {
+	for day := 0; day < forecastMaxDays; day++ {
+		remaining -= t.at(day)
+		if remaining < 0 {
+			return day
+		}
+	}
+	return -1
+}
+
+type QuotaForecast struct {
+	Id             int     `json:"id,omitempty"`
+	Name           string  `json:"name"`
+	Group          string  `json:"group,omitempty"`
+	UsedQuota      int64   `json:"used_quota"`      // in the history
+	DailyTrend     float64 `json:"daily_trend"`     // the change of the daily quota per day
+	ProjectedQuota int64   `json:"projected_quota"` // in the coming month
+	RemainQuota    int64   `json:"remain_quota"`
+	// the day the remaining quota is projected to run out, empty if not within a year
+	ExhaustionDate string `json:"exhaustion_date"`
+}
+
+type ChannelForecast struct {
+	Id             int     `json:"id"`
+	Name           string  `json:"name"`
+	UsedQuota      int64   `json:"used_quota"`
+	DailyTrend     float64 `json:"daily_trend"`
+	ProjectedQuota int64   `json:"projected_quota"`
+	ProjectedSpend float64 `json:"projected_spend"` // in USD, priced with the ratios rather than the prices of the upstream
+	Balance        float64 `json:"balance"`         // in USD, as of the last update
+	// the day the balance is projected to run out, empty if not within a year or the balance is unknown
+	BalanceExhaustionDate string `json:"balance_exhaustion_date"`
+}
+
+// dailySeries puts the daily quotas of each id in order, the days without usage are zeros
+func dailySeries(quotas []*model.DailyQuota, start time.Time, days int) map[int][]float64 {
+	series := make(map[int][]float64)
+	for _, quota := range quotas {
+		day, err := time.ParseInLocation("2006-01-02", quota.Day, time.UTC)
+		if err != nil {
+			continue
+		}
+		index := int(day.Sub(start).Hours() / 24)
+		if index < 0 || index >= days {
+			continue
+		}
+		if _, ok := series[quota.Id]; !ok {
+			series[quota.Id] = make([]float64, days)
+		}
+		series[quota.Id][index] += float64(quota.Quota)
+	}
+	return series
+}
+
+func sumQuotas(values []float64) float64 {
+	var total float64
+	for _, value := range values {
+		total += value
+	}
+	return total
+}
+
+func exhaustionDate(today time.Time, trend usageTrend, remaining float64) string {
+	days := trend.exhaustedIn(remaining)
+	if days < 0 {
+		return ""
+	}
+	return today.AddDate(0, 0, days).Format("2006-01-02")
+}
+
+func forecastQuota(trend usageTrend, daily []float64, remaining int64, today time.Time) *QuotaForecast {
+	return &QuotaForecast{
+		UsedQuota:      int64(sumQuotas(daily)),
+		DailyTrend:     trend.slope,
+		ProjectedQuota: int64(math.Ceil(trend.projected(forecastHorizon))),
+		RemainQuota:    remaining,
+		ExhaustionDate: exhaustionDate(today, trend, float64(remaining)),
+	}
+}
+
+// GetUsageForecast projects the usage of the users, groups and channels for the coming month
+// from the consume logs of the last days, 30 by default
+func GetUsageForecast(c *gin.Context) {
+	days, _ := strconv.Atoi(c.Query("days"))
+	if days <= 0 {
+		days = 30
+	}
+	if days > 90 {
+		days = 90
+	}
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	start := today.AddDate(0, 0, -days)
+	// today isn't over, it would look like a drop
+	startTimestamp, endTimestamp := start.Unix(), today.Unix()-1
+
+	userQuotas, err := model.GetDailyQuotaByUser(startTimestamp, endTimestamp)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	channelQuotas, err := model.GetDailyQuotaByChannel(startTimestamp, endTimestamp)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	userSeries := dailySeries(userQuotas, start, days)
+	userIds := make([]int, 0, len(userSeries))
+	for id := range userSeries {
+		userIds = append(userIds, id)
+	}
+	users, err := model.GetUserQuotas(userIds)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	channels, err := model.GetChannelBalances()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	userForecasts := make([]*QuotaForecast, 0, len(users))
+	groupSeries := make(map[string][]float64)
+	groupRemain := make(map[string]int64)
+	for id, daily := range userSeries {
+		user, ok := users[id]
+		if !ok {
+			continue
+		}
+		forecast := forecastQuota(fitUsageTrend(daily), daily, user.Quota, today)
+		forecast.Id = user.Id
+		forecast.Name = user.Username
+		forecast.Group = user.Group
+		userForecasts = append(userForecasts, forecast)
+		if _, ok := groupSeries[user.Group]; !ok {
+			groupSeries[user.Group] = make([]float64, days)
+		}
+		for i, quota := range daily {
+			groupSeries[user.Group][i] += quota
+		}
+		groupRemain[user.Group] += user.Quota
+	}
+	sort.Slice(userForecasts, func(i, j int) bool {
+		return userForecasts[i].ProjectedQuota > userForecasts[j].ProjectedQuota
+	})
+
+	// the quota of a group is the quota of its users with usage, pooled
+	groupForecasts := make([]*QuotaForecast, 0, len(groupSeries))
+	for group, daily := range groupSeries {
+		forecast := forecastQuota(fitUsageTrend(daily), daily, groupRemain[group], today)
+		forecast.Name = group
+		groupForecasts = append(groupForecasts, forecast)
+	}
+	sort.Slice(groupForecasts, func(i, j int) bool {
+		return groupForecasts[i].ProjectedQuota > groupForecasts[j].ProjectedQuota
+	})
+
+	channelSeries := dailySeries(channelQuotas, start, days)
+	channelForecasts := make([]*ChannelForecast, 0, len(channelSeries))
+	for _, channel := range channels {
+		daily, ok := channelSeries[channel.Id]
+		if !ok {
+			continue
+		}
+		trend := fitUsageTrend(daily)
+		forecast := &ChannelForecast{
+			Id:             channel.Id,
+			Name:           channel.Name,
+			UsedQuota:      int64(sumQuotas(daily)),
+			DailyTrend:     trend.slope,
+			ProjectedQuota: int64(math.Ceil(trend.projected(forecastHorizon))),
+			Balance:        channel.Balance,
+		}
+		forecast.ProjectedSpend = float64(forecast.ProjectedQuota) / config.QuotaPerUnit
+		if channel.BalanceUpdatedTime != 0 {
+			forecast.BalanceExhaustionDate = exhaustionDate(today, trend, channel.Balance*config.QuotaPerUnit)
+		}
+		channelForecasts = append(channelForecasts, forecast)
+	}
+	sort.Slice(channelForecasts, func(i, j int) bool {
+		return channelForecasts[i].ProjectedQuota > channelForecasts[j].ProjectedQuota
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"start_timestamp": startTimestamp,
+			"end_timestamp":   endTimestamp,
+			"horizon":         forecastHorizon,
+			"users":           userForecasts,
+			"groups":          groupForecasts,
+			"channels":        channelForecasts,
+		},
+	})
+}
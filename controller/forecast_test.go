@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func TestFitUsageTrend(t *testing.T) {
+	Convey("fitUsageTrend", t, func() {
+		trend := fitUsageTrend([]float64{1, 2, 3, 4})
+		So(trend.slope, ShouldAlmostEqual, 1)
+		So(trend.intercept, ShouldAlmostEqual, 1)
+		// the day after the history
+		So(trend.at(0), ShouldAlmostEqual, 5)
+		So(trend.projected(2), ShouldAlmostEqual, 11)
+
+		trend = fitUsageTrend([]float64{7})
+		So(trend.slope, ShouldEqual, 0)
+		So(trend.at(10), ShouldEqual, 7)
+
+		So(fitUsageTrend(nil).projected(30), ShouldEqual, 0)
+
+		Convey("a shrinking usage stops at zero", func() {
+			trend := fitUsageTrend([]float64{30, 20, 10})
+			So(trend.at(0), ShouldEqual, 0)
+			So(trend.projected(30), ShouldEqual, 0)
+			So(trend.exhaustedIn(1), ShouldEqual, -1)
+		})
+	})
+}
+
+func TestUsageTrendExhaustedIn(t *testing.T) {
+	Convey("exhaustedIn is the first day the remaining is used up", t, func() {
+		trend := fitUsageTrend([]float64{10, 10, 10})
+		So(trend.exhaustedIn(25), ShouldEqual, 2)
+		So(trend.exhaustedIn(5), ShouldEqual, 0)
+		So(trend.exhaustedIn(10*forecastMaxDays), ShouldEqual, -1)
+	})
+}
+
+func TestDailySeries(t *testing.T) {
+	Convey("dailySeries fills the days without usage with zeros", t, func() {
+		start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+		series := dailySeries([]*model.DailyQuota{
+			{Day: "2024-05-01", Id: 1, Quota: 10},
+			{Day: "2024-05-03", Id: 1, Quota: 30},
+			{Day: "2024-05-02", Id: 2, Quota: 5},
+			{Day: "2024-04-30", Id: 1, Quota: 100},
+			{Day: "2024-05-04", Id: 1, Quota: 100},
+			{Day: "not a day", Id: 1, Quota: 100},
+		}, start, 3)
+		So(series, ShouldResemble, map[int][]float64{
+			1: {10, 0, 30},
+			2: {0, 5, 0},
+		})
+	})
+}
+
+func TestGetUsageForecast(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("GetUsageForecast projects the usage of the users, groups and channels", t, func() {
+		useTestDB(t)
+		So(model.DB.Create(&model.User{Id: 1, Username: "user1", AccessToken: "access1", AffCode: "aff1",
+			Group: "default", Quota: 2500}).Error, ShouldBeNil)
+		So(model.DB.Create(&model.User{Id: 2, Username: "user2", AccessToken: "access2", AffCode: "aff2",
+			Group: "default", Quota: 1000000}).Error, ShouldBeNil)
+		So(model.DB.Create(&model.Channel{Id: 1, Key: "k1", Name: "c1", Balance: 1,
+			BalanceUpdatedTime: 1}).Error, ShouldBeNil)
+
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+		for day := 1; day <= 3; day++ {
+			createdAt := today.AddDate(0, 0, -day).Add(time.Hour).Unix()
+			So(model.LOG_DB.Create(&model.Log{UserId: 1, ChannelId: 1, CreatedAt: createdAt, Type: model.LogTypeConsume,
+				Quota: 1000}).Error, ShouldBeNil)
+			So(model.LOG_DB.Create(&model.Log{UserId: 2, ChannelId: 1, CreatedAt: createdAt, Type: model.LogTypeConsume,
+				Quota: 500}).Error, ShouldBeNil)
+		}
+		// today isn't over and is left out
+		So(model.LOG_DB.Create(&model.Log{UserId: 1, ChannelId: 1, CreatedAt: today.Add(time.Hour).Unix(),
+			Type: model.LogTypeConsume, Quota: 100000}).Error, ShouldBeNil)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/forecast?days=3", nil)
+		GetUsageForecast(c)
+
+		var response struct {
+			Success bool `json:"success"`
+			Data    struct {
+				Users    []*QuotaForecast   `json:"users"`
+				Groups   []*QuotaForecast   `json:"groups"`
+				Channels []*ChannelForecast `json:"channels"`
+			} `json:"data"`
+		}
+		So(json.Unmarshal(w.Body.Bytes(), &response), ShouldBeNil)
+		So(response.Success, ShouldBeTrue)
+
+		users := response.Data.Users
+		So(users, ShouldHaveLength, 2)
+		So(users[0].Name, ShouldEqual, "user1")
+		So(users[0].UsedQuota, ShouldEqual, 3000)
+		So(users[0].ProjectedQuota, ShouldEqual, 1000*forecastHorizon)
+		// 1000 a day out of 2500
+		So(users[0].ExhaustionDate, ShouldEqual, today.AddDate(0, 0, 2).Format("2006-01-02"))
+		So(users[1].ExhaustionDate, ShouldBeEmpty)
+
+		So(response.Data.Groups, ShouldHaveLength, 1)
+		So(response.Data.Groups[0].Name, ShouldEqual, "default")
+		So(response.Data.Groups[0].UsedQuota, ShouldEqual, 4500)
+		So(response.Data.Groups[0].RemainQuota, ShouldEqual, 1002500)
+
+		channels := response.Data.Channels
+		So(channels, ShouldHaveLength, 1)
+		So(channels[0].ProjectedQuota, ShouldEqual, 1500*forecastHorizon)
+		So(channels[0].ProjectedSpend, ShouldAlmostEqual, 1500*forecastHorizon/config.QuotaPerUnit)
+		wantDays := int(config.QuotaPerUnit / 1500)
+		So(channels[0].BalanceExhaustionDate, ShouldEqual, today.AddDate(0, 0, wantDays).Format("2006-01-02"))
+	})
+}
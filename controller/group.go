@@ -2,6 +2,7 @@ package controller
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 	"net/http"
 )
@@ -11,6 +12,9 @@ func GetGroups(c *gin.Context) {
 	for groupName := range billingratio.GroupRatio {
 		groupNames = append(groupNames, groupName)
 	}
+	if _, ok := billingratio.GroupRatio[config.SandboxGroup]; !ok {
+		groupNames = append(groupNames, config.SandboxGroup)
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
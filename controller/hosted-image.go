@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/imagehost"
+)
+
+// GetHostedImage serves the images of the chat completions re-hosted, the signed links work without logging in
+func GetHostedImage(c *gin.Context) {
+	name := c.Param("name")
+	expiresAt, _ := strconv.ParseInt(c.Query("expires"), 10, 64)
+	path := imagehost.Path(name)
+	if path == "" || !imagehost.Verify(name, expiresAt, c.Query("signature")) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "图片链接无效或已过期",
+		})
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "图片不存在或已过期",
+		})
+		return
+	}
+	c.File(path)
+}
@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/monitor"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+var streamEventPrefix = []byte("data:")
+
+// inflightWriter counts the stream events sent to the client, for the listing of the requests in flight
+type inflightWriter struct {
+	gin.ResponseWriter
+	handle *monitor.InflightHandle
+}
+
+func (w *inflightWriter) Write(data []byte) (int, error) {
+	w.handle.AddStreamedChunks(bytes.Count(data, streamEventPrefix))
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *inflightWriter) WriteString(s string) (int, error) {
+	w.handle.AddStreamedChunks(bytes.Count([]byte(s), streamEventPrefix))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// startInflightRequest lists the request as in flight, it's relayed with a context the admins can cancel
+func startInflightRequest(c *gin.Context) *monitor.InflightHandle {
+	ctx, handle := monitor.StartInflightRequest(c.Request.Context(), c.GetString(helper.RequestIdKey),
+		c.GetInt(ctxkey.Id), c.GetString(ctxkey.TokenName), c.GetString(ctxkey.OriginalModel), c.GetInt(ctxkey.ChannelId))
+	c.Request = c.Request.WithContext(ctx)
+	c.Writer = &inflightWriter{ResponseWriter: c.Writer, handle: handle}
+	return handle
+}
+
+func terminatedError(c *gin.Context) *model.ErrorWithStatusCode {
+	return &model.ErrorWithStatusCode{
+		Error: model.Error{
+			Message: helper.MessageWithRequestId("The request was terminated by the administrator.", c.GetString(helper.RequestIdKey)),
+			Type:    "one_api_error",
+			Code:    "request_terminated",
+		},
+		StatusCode: http.StatusServiceUnavailable,
+	}
+}
+
+// GetInflightRequests lists the requests being relayed by this node, optionally only those on a channel
+func GetInflightRequests(c *gin.Context) {
+	channelId, _ := strconv.Atoi(c.Query("channel_id"))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    monitor.GetInflightRequests(channelId),
+	})
+}
+
+func KillInflightRequest(c *gin.Context) {
+	if !monitor.KillInflightRequest(c.Param("id")) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "请求不存在或已结束",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// KillChannelInflightRequests terminates all the requests on a channel, e.g. when it's misbehaving during an incident
+func KillChannelInflightRequests(c *gin.Context) {
+	channelId, err := strconv.Atoi(c.Query("channel_id"))
+	if err != nil || channelId == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    monitor.KillChannelInflightRequests(channelId),
+	})
+}
@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/constant/streampolicy"
+)
+
+func TestKillInflightStream(t *testing.T) {
+	Convey("a killed stream is billed with the usage streamed so far even if the response is rejected", t, func() {
+		useTestDB(t)
+		// the token encoders aren't loaded in the tests
+		oldApproximateTokenEnabled, oldValidationEnabled := config.ApproximateTokenEnabled, config.StructuredOutputValidationEnabled
+		config.ApproximateTokenEnabled, config.StructuredOutputValidationEnabled = true, true
+		t.Cleanup(func() {
+			config.ApproximateTokenEnabled, config.StructuredOutputValidationEnabled = oldApproximateTokenEnabled, oldValidationEnabled
+		})
+		if client.HTTPClient == nil {
+			client.HTTPClient = http.DefaultClient
+		}
+		So(model.DB.Create(&model.User{Id: 1, Username: "user1", Quota: 1000000, Status: model.UserStatusEnabled,
+			AccessToken: "access1", AffCode: "aff1", Group: "default"}).Error, ShouldBeNil)
+		So(model.DB.Create(&model.Token{Id: 1, UserId: 1, Key: "key1", Status: model.TokenStatusEnabled,
+			RemainQuota: 1000000, ExpiredTime: -1}).Error, ShouldBeNil)
+		So(model.DB.Create(&model.Channel{Id: 1, Type: channeltype.OpenAI, Key: "sk-test", Name: "openai"}).Error, ShouldBeNil)
+
+		streamed := make(chan struct{})
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = w.Write([]byte("data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"{\\\"answer\\\": \\\"a few words\"}}]}\n\n"))
+			w.(http.Flusher).Flush()
+			close(streamed)
+			<-r.Context().Done()
+		}))
+		defer upstream.Close()
+
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+			strings.NewReader(`{"model":"gpt-4o-mini","max_tokens":4096,"messages":[{"role":"user","content":"hello"}],`+
+				`"response_format":{"type":"json_schema","json_schema":{"name":"answer","schema":{"type":"object","required":["answer"]}}}}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set(helper.RequestIdKey, "request-1")
+		c.Set(ctxkey.Id, 1)
+		c.Set(ctxkey.TokenId, 1)
+		c.Set(ctxkey.Group, "default")
+		c.Set(ctxkey.Channel, channeltype.OpenAI)
+		c.Set(ctxkey.ChannelId, 1)
+		c.Set(ctxkey.BaseURL, upstream.URL)
+		// the stream of upstream is merged into a response, which is validated against the schema
+		c.Set(ctxkey.TokenStreamPolicy, streampolicy.Force)
+		go func() {
+			<-streamed
+			time.Sleep(50 * time.Millisecond)
+			monitor.KillInflightRequest("request-1")
+		}()
+		Relay(c)
+
+		usedQuota := waitChannelUsedQuota(t, 1)
+		var log model.Log
+		So(model.LOG_DB.Where("type = ?", model.LogTypeConsume).First(&log).Error, ShouldBeNil)
+		So(usedQuota, ShouldEqual, log.Quota)
+		So(log.CompletionTokens, ShouldBeGreaterThan, 0)
+		var token model.Token
+		So(model.DB.First(&token, 1).Error, ShouldBeNil)
+		// the pre-consumed quota is settled instead of being returned
+		So(token.RemainQuota, ShouldEqual, 1000000-log.Quota)
+	})
+}
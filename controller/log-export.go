@@ -0,0 +1,306 @@
+package controller
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/model"
+)
+
+const logExportBatchSize = 1000
+
+const (
+	logExportKindLogs  = "logs"
+	logExportKindUsage = "usage"
+)
+
+const (
+	logExportStatusRunning = "running"
+	logExportStatusDone    = "done"
+	logExportStatusFailed  = "failed"
+)
+
+// at most ExportConcurrency exports are generated at the same time on this node
+var logExportSlots = make(chan struct{}, config.ExportConcurrency)
+
+func getLogExportDir() string {
+	if config.ExportPath != "" {
+		return config.ExportPath
+	}
+	return filepath.Join(os.TempDir(), "one-api-exports")
+}
+
+func getLogExportPath(export *model.LogExport) string {
+	return filepath.Join(getLogExportDir(), export.Id+".csv")
+}
+
+// the link is signed with the expiry, so that it works without the session,
+// e.g. for download managers, but only until it expires
+func getLogExportSignedMessage(id string, expiresAt int64) string {
+	return fmt.Sprintf("export:%s:%d", id, expiresAt)
+}
+
+func getLogExportUrl(export *model.LogExport) string {
+	signature := helper.Sign(config.SignedLinkSecret, getLogExportSignedMessage(export.Id, export.ExpiresAt))
+	return fmt.Sprintf("%s/api/log/export/%s/download?expires=%d&signature=%s",
+		config.ServerAddress, export.Id, export.ExpiresAt, signature)
+}
+
+// sweepLogExports removes the exports whose links have expired, whichever node generated them
+func sweepLogExports() {
+	ids, err := model.DeleteExpiredLogExports(helper.GetTimestamp())
+	if err != nil {
+		logger.SysError("failed to delete the expired exports: " + err.Error())
+		return
+	}
+	for _, id := range ids {
+		_ = os.Remove(getLogExportPath(&model.LogExport{Id: id}))
+	}
+}
+
+func getLogFilter(c *gin.Context) model.LogFilter {
+	filter := model.LogFilter{
+		ModelName:      c.Query("model_name"),
+		Username:       c.Query("username"),
+		TokenName:      c.Query("token_name"),
+		ChannelName:    c.Query("channel_name"),
+		ConversationId: c.Query("conversation_id"),
+	}
+	filter.Type, _ = strconv.Atoi(c.Query("type"))
+	filter.StartTimestamp, _ = strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	filter.EndTimestamp, _ = strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	filter.Channel, _ = strconv.Atoi(c.Query("channel"))
+	return filter
+}
+
+func writeLogsCSV(writer *csv.Writer, filter model.LogFilter) (int, error) {
+	rows := 0
+	err := writer.Write([]string{"id", "created_at", "type", "user_id", "username", "token_name", "model_name", "channel", "channel_name",
+		"prompt_tokens", "completion_tokens", "quota", "conversation_id", "content"})
+	if err != nil {
+		return 0, err
+	}
+	err = model.ExportLogs(filter, logExportBatchSize, func(logs []*model.Log) error {
+		for _, log := range logs {
+			err := writer.Write([]string{
+				strconv.Itoa(log.Id),
+				time.Unix(log.CreatedAt, 0).Format("2006-01-02 15:04:05"),
+				strconv.Itoa(log.Type),
+				strconv.Itoa(log.UserId),
+				log.Username,
+				log.TokenName,
+				log.ModelName,
+				strconv.Itoa(log.ChannelId),
+				log.ChannelName,
+				strconv.Itoa(log.PromptTokens),
+				strconv.Itoa(log.CompletionTokens),
+				strconv.Itoa(log.Quota),
+				log.ConversationId,
+				log.Content,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		rows += len(logs)
+		writer.Flush()
+		return writer.Error()
+	})
+	return rows, err
+}
+
+func writeUsageCSV(writer *csv.Writer, filter model.LogFilter) (int, error) {
+	aggregates, err := model.GetUsageAggregates(filter.StartTimestamp, filter.EndTimestamp)
+	if err != nil {
+		return 0, err
+	}
+	err = writer.Write([]string{"user_id", "model_name", "request_count", "prompt_tokens", "completion_tokens", "quota"})
+	if err != nil {
+		return 0, err
+	}
+	for _, aggregate := range aggregates {
+		err = writer.Write([]string{
+			strconv.Itoa(aggregate.UserId),
+			aggregate.ModelName,
+			strconv.Itoa(aggregate.RequestCount),
+			strconv.FormatInt(aggregate.PromptTokens, 10),
+			strconv.FormatInt(aggregate.CompletionTokens, 10),
+			strconv.FormatInt(aggregate.Quota, 10),
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(aggregates), nil
+}
+
+func generateLogExport(export *model.LogExport, filter model.LogFilter) (int, error) {
+	err := os.MkdirAll(getLogExportDir(), 0700)
+	if err != nil {
+		return 0, err
+	}
+	file, err := os.Create(getLogExportPath(export))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	writer := csv.NewWriter(file)
+	var rows int
+	if export.Kind == logExportKindUsage {
+		rows, err = writeUsageCSV(writer, filter)
+	} else {
+		rows, err = writeLogsCSV(writer, filter)
+	}
+	if err != nil {
+		return 0, err
+	}
+	writer.Flush()
+	return rows, writer.Error()
+}
+
+func runLogExport(export *model.LogExport, filter model.LogFilter) {
+	rows, err := generateLogExport(export, filter)
+	export.FinishedAt = helper.GetTimestamp()
+	if err != nil {
+		logger.SysError(fmt.Sprintf("failed to export %s %s: %s", export.Kind, export.Id, err.Error()))
+		_ = os.Remove(getLogExportPath(export))
+		export.Status = logExportStatusFailed
+		export.Message = err.Error()
+	} else {
+		export.Status = logExportStatusDone
+		export.Rows = rows
+	}
+	export.ExpiresAt = export.FinishedAt + int64(config.ExportLinkTTL)
+	err = model.UpdateLogExport(export)
+	if err != nil {
+		logger.SysError(fmt.Sprintf("failed to save the export %s: %s", export.Id, err.Error()))
+	}
+	// the exports left by the restarted nodes are swept by the next exports
+	time.AfterFunc(time.Duration(config.ExportLinkTTL+1)*time.Second, sweepLogExports)
+}
+
+func startLogExport(c *gin.Context, kind string, filter model.LogFilter) {
+	if config.SignedLinkSecret == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "未设置 SIGNED_LINK_SECRET，无法导出",
+		})
+		return
+	}
+	select {
+	case logExportSlots <- struct{}{}:
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "正在生成的导出任务过多，请稍后再试",
+		})
+		return
+	}
+	sweepLogExports()
+	export := &model.LogExport{
+		Id:        random.GetUUID(),
+		UserId:    c.GetInt(ctxkey.Id),
+		Kind:      kind,
+		Status:    logExportStatusRunning,
+		CreatedAt: helper.GetTimestamp(),
+	}
+	err := model.InsertLogExport(export)
+	if err != nil {
+		<-logExportSlots
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	go func() {
+		defer func() { <-logExportSlots }()
+		runLogExport(export, filter)
+	}()
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    export,
+	})
+}
+
+// ExportLogs generates the CSV of the logs, or of the usage by user and model if kind is usage,
+// in the background, the link to download it is returned by GetLogExport once it's done
+func ExportLogs(c *gin.Context) {
+	kind := c.DefaultQuery("kind", logExportKindLogs)
+	if kind != logExportKindLogs && kind != logExportKindUsage {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的导出类型",
+		})
+		return
+	}
+	startLogExport(c, kind, getLogFilter(c))
+}
+
+// ExportUserLogs generates the CSV of the logs of the user like ExportLogs
+func ExportUserLogs(c *gin.Context) {
+	filter := getLogFilter(c)
+	filter.UserId = c.GetInt(ctxkey.Id)
+	filter.Username = ""
+	filter.Channel = 0
+	startLogExport(c, logExportKindLogs, filter)
+}
+
+func GetLogExport(c *gin.Context) {
+	export, err := model.GetLogExportById(c.Param("id"))
+	if err != nil || (export.ExpiresAt > 0 && export.ExpiresAt < helper.GetTimestamp()) ||
+		(export.UserId != c.GetInt(ctxkey.Id) && c.GetInt(ctxkey.Role) < model.RoleAdminUser) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "导出任务不存在或已过期",
+		})
+		return
+	}
+	if export.Status == logExportStatusDone {
+		export.Url = getLogExportUrl(export)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    export,
+	})
+}
+
+// DownloadLogExport serves the exported file to whoever holds the signed link, no session is required
+func DownloadLogExport(c *gin.Context) {
+	id := c.Param("id")
+	expiresAt, _ := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if config.SignedLinkSecret == "" || expiresAt < helper.GetTimestamp() ||
+		!helper.VerifySignature(config.SignedLinkSecret, getLogExportSignedMessage(id, expiresAt), c.Query("signature")) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "下载链接无效或已过期",
+		})
+		return
+	}
+	export, err := model.GetLogExportById(id)
+	path := getLogExportPath(export)
+	if err == nil && export.Status == logExportStatusDone {
+		_, err = os.Stat(path)
+	}
+	if err != nil || export.Status != logExportStatusDone {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "导出文件不存在或已过期",
+		})
+		return
+	}
+	c.FileAttachment(path, fmt.Sprintf("one-api-%s-%s.csv", export.Kind, time.Unix(export.CreatedAt, 0).Format("20060102-150405")))
+}
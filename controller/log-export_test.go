@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/model"
+)
+
+type testResponse struct {
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Data    model.LogExport `json:"data"`
+}
+
+func serveTestRequest(handler gin.HandlerFunc, userId int, method string, target string, params gin.Params) (*httptest.ResponseRecorder, testResponse) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(method, target, nil)
+	c.Params = params
+	c.Set(ctxkey.Id, userId)
+	c.Set(ctxkey.Role, model.RoleCommonUser)
+	handler(c)
+	response := testResponse{}
+	_ = json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder, response
+}
+
+func TestLogExport(t *testing.T) {
+	Convey("log exports", t, func() {
+		useTestDB(t)
+		oldSecret, oldPath, oldSlots := config.SignedLinkSecret, config.ExportPath, logExportSlots
+		config.SignedLinkSecret, config.ExportPath, logExportSlots = "secret", t.TempDir(), make(chan struct{}, 1)
+		t.Cleanup(func() {
+			config.SignedLinkSecret, config.ExportPath, logExportSlots = oldSecret, oldPath, oldSlots
+		})
+		So(model.LOG_DB.Create(&model.Log{UserId: 1, Type: model.LogTypeConsume, ModelName: "gpt-4o", Quota: 10, CreatedAt: helper.GetTimestamp()}).Error, ShouldBeNil)
+
+		Convey("are refused without the signing secret", func() {
+			config.SignedLinkSecret = ""
+			_, response := serveTestRequest(ExportUserLogs, 1, http.MethodPost, "/api/log/self/export", nil)
+			So(response.Success, ShouldBeFalse)
+		})
+
+		Convey("are refused while too many of them are running", func() {
+			logExportSlots <- struct{}{}
+			_, response := serveTestRequest(ExportUserLogs, 1, http.MethodPost, "/api/log/self/export", nil)
+			So(response.Success, ShouldBeFalse)
+		})
+
+		Convey("are saved and downloaded with the signed link", func() {
+			export := &model.LogExport{Id: "export1", UserId: 1, Kind: logExportKindLogs, Status: logExportStatusRunning, CreatedAt: helper.GetTimestamp()}
+			So(model.InsertLogExport(export), ShouldBeNil)
+			runLogExport(export, model.LogFilter{UserId: 1})
+
+			params := gin.Params{{Key: "id", Value: "export1"}}
+			_, response := serveTestRequest(GetLogExport, 2, http.MethodGet, "/api/log/export/export1", params)
+			So(response.Success, ShouldBeFalse)
+			_, response = serveTestRequest(GetLogExport, 1, http.MethodGet, "/api/log/export/export1", params)
+			So(response.Success, ShouldBeTrue)
+			So(response.Data.Status, ShouldEqual, logExportStatusDone)
+			So(response.Data.Rows, ShouldEqual, 1)
+
+			link, err := url.Parse(response.Data.Url)
+			So(err, ShouldBeNil)
+			recorder, _ := serveTestRequest(DownloadLogExport, 0, http.MethodGet, link.RequestURI(), params)
+			So(recorder.Code, ShouldEqual, http.StatusOK)
+			So(strings.HasPrefix(recorder.Body.String(), "id,created_at"), ShouldBeTrue)
+			recorder, _ = serveTestRequest(DownloadLogExport, 0, http.MethodGet, strings.Replace(link.RequestURI(), "signature=", "signature=0", 1), params)
+			So(recorder.Code, ShouldEqual, http.StatusForbidden)
+		})
+	})
+}
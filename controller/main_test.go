@@ -0,0 +1,31 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/testdb"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// useTestDB points the model at a new SQLite database with all the tables migrated, redis is disabled
+func useTestDB(t *testing.T) {
+	testdb.Use(t, model.InitDB, &model.DB, &model.LOG_DB)
+}
+
+// waitChannelUsedQuota returns the used quota of the channel once the request is billed,
+// the used quota of the channel is the last to be updated
+func waitChannelUsedQuota(t *testing.T, id int) int64 {
+	t.Helper()
+	for i := 0; i < 50; i++ {
+		channel := model.Channel{}
+		if err := model.DB.First(&channel, id).Error; err != nil {
+			t.Fatal(err)
+		}
+		if channel.UsedQuota != 0 {
+			return channel.UsedQuota
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return 0
+}
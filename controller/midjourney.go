@@ -0,0 +1,223 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/midjourney"
+	relaycontroller "github.com/songquanpeng/one-api/relay/controller"
+)
+
+const midjourneyPollInterval = 15 * time.Second
+
+// the tasks not finished in time are failed and refunded, the proxy may have lost them
+const midjourneyTaskTimeout = 2 * 60 * 60
+
+// RelayMidjourney submits a task, the errors are in the format of midjourney-proxy
+func RelayMidjourney(c *gin.Context) {
+	bizErr := relaycontroller.RelayMidjourneySubmit(c)
+	if bizErr == nil {
+		return
+	}
+	requestId := c.GetString(helper.RequestIdKey)
+	logger.Errorf(c.Request.Context(), "relay midjourney error: %s", bizErr.Error.Message)
+	c.JSON(bizErr.StatusCode, midjourney.SubmitResponse{
+		Code:        midjourney.ErrorCode(bizErr.StatusCode),
+		Description: helper.MessageWithRequestId(bizErr.Error.Message, requestId),
+	})
+}
+
+func toMidjourneyTask(task *model.MidjourneyTask) *midjourney.Task {
+	return &midjourney.Task{
+		Id:          task.MjId,
+		Action:      task.Action,
+		Prompt:      task.Prompt,
+		PromptEn:    task.PromptEn,
+		Description: task.Description,
+		State:       task.State,
+		SubmitTime:  task.SubmitTime * 1000,
+		StartTime:   task.StartTime * 1000,
+		FinishTime:  task.FinishTime * 1000,
+		ImageUrl:    task.ImageUrl,
+		Status:      task.Status,
+		Progress:    task.Progress,
+		FailReason:  task.FailReason,
+	}
+}
+
+// GetMidjourneyTask is the fetch route of midjourney-proxy, the task is the one saved by polling the proxy
+func GetMidjourneyTask(c *gin.Context) {
+	task, err := model.GetMidjourneyTaskByMjId(c.GetInt(ctxkey.Id), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, midjourney.SubmitResponse{
+			Code:        midjourney.CodeNotFound,
+			Description: "task not found",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, toMidjourneyTask(task))
+}
+
+func ListMidjourneyTasksByCondition(c *gin.Context) {
+	var request midjourney.ListByConditionRequest
+	err := c.ShouldBindJSON(&request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, midjourney.SubmitResponse{
+			Code:        midjourney.CodeValidationError,
+			Description: err.Error(),
+		})
+		return
+	}
+	tasks := make([]*midjourney.Task, 0, len(request.Ids))
+	if len(request.Ids) != 0 {
+		userTasks, err := model.GetMidjourneyTasksByMjIds(c.GetInt(ctxkey.Id), request.Ids)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, midjourney.SubmitResponse{
+				Code:        midjourney.CodeFailure,
+				Description: err.Error(),
+			})
+			return
+		}
+		for _, task := range userTasks {
+			tasks = append(tasks, toMidjourneyTask(task))
+		}
+	}
+	c.JSON(http.StatusOK, tasks)
+}
+
+func GetAllMidjourneyTasks(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	channelId, _ := strconv.Atoi(c.Query("channel"))
+	tasks, err := model.GetAllMidjourneyTasks(userId, channelId, c.Query("status"), p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    tasks,
+	})
+}
+
+func GetUserMidjourneyTasks(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	tasks, err := model.GetUserMidjourneyTasks(c.GetInt(ctxkey.Id), c.Query("status"), p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    tasks,
+	})
+}
+
+// AutomaticallyUpdateMidjourneyTasks polls the proxies for the unfinished tasks, and settles the finished ones
+func AutomaticallyUpdateMidjourneyTasks() {
+	for {
+		time.Sleep(midjourneyPollInterval)
+		updateMidjourneyTasks()
+	}
+}
+
+func updateMidjourneyTasks() {
+	tasks, err := model.GetUnfinishedMidjourneyTasks()
+	if err != nil {
+		logger.SysError("failed to get unfinished midjourney tasks: " + err.Error())
+		return
+	}
+	channelTasks := make(map[int][]*model.MidjourneyTask)
+	for _, task := range tasks {
+		channelTasks[task.ChannelId] = append(channelTasks[task.ChannelId], task)
+	}
+	for channelId, tasks := range channelTasks {
+		updateChannelMidjourneyTasks(channelId, tasks)
+	}
+}
+
+func fetchChannelMidjourneyTasks(channelId int, tasks []*model.MidjourneyTask) (map[string]*midjourney.Task, error) {
+	channel, err := model.GetChannelById(channelId, true)
+	if err != nil {
+		return nil, err
+	}
+	key := ""
+	if keys := channel.GetKeys(); len(keys) != 0 {
+		key = keys[0]
+	}
+	ids := make([]string, 0, len(tasks))
+	for _, task := range tasks {
+		ids = append(ids, task.MjId)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), midjourneyPollInterval)
+	defer cancel()
+	results, err := midjourney.FetchTasks(ctx, channel.GetBaseURL(), key, ids)
+	if err != nil {
+		return nil, err
+	}
+	fetched := make(map[string]*midjourney.Task, len(results))
+	for i := range results {
+		fetched[results[i].Id] = &results[i]
+	}
+	return fetched, nil
+}
+
+func updateChannelMidjourneyTasks(channelId int, tasks []*model.MidjourneyTask) {
+	fetched, fetchErr := fetchChannelMidjourneyTasks(channelId, tasks)
+	if fetchErr != nil {
+		// the tasks are still timed out
+		logger.SysError("failed to fetch midjourney tasks of channel #" + strconv.Itoa(channelId) + ": " + fetchErr.Error())
+	}
+	now := helper.GetTimestamp()
+	for _, task := range tasks {
+		if result, ok := fetched[task.MjId]; ok {
+			task.PromptEn = result.PromptEn
+			task.Description = result.Description
+			if result.Status != "" {
+				task.Status = result.Status
+			}
+			task.Progress = result.Progress
+			task.ImageUrl = result.ImageUrl
+			task.FailReason = result.FailReason
+			task.StartTime = result.StartTime / 1000
+			task.FinishTime = result.FinishTime / 1000
+		} else if fetchErr == nil {
+			logger.SysError("midjourney task " + task.MjId + " is not found on channel #" + strconv.Itoa(channelId))
+		}
+		if !midjourney.IsFinished(task.Status) && now-task.SubmitTime > midjourneyTaskTimeout {
+			task.Status = midjourney.StatusFailure
+			task.FailReason = "任务超时"
+			task.FinishTime = now
+		}
+		updated, err := task.UpdateProgress()
+		if err != nil {
+			logger.SysError("failed to update midjourney task " + task.MjId + ": " + err.Error())
+			continue
+		}
+		if updated && midjourney.IsFinished(task.Status) {
+			relaycontroller.SettleMidjourneyTask(context.Background(), task)
+		}
+	}
+}
@@ -168,10 +168,15 @@ func ListModels(c *gin.Context) {
 	})
 }
 
+// RetrieveModel answers the models known by one-api, the other ones like fine-tuned models are relayed
+// to a channel of the model by the handlers after it
 func RetrieveModel(c *gin.Context) {
 	modelId := c.Param("model")
 	if model, ok := modelsMap[modelId]; ok {
 		c.JSON(200, model)
+		c.Abort()
+	} else if isModelRelayable(c, modelId) {
+		c.Next()
 	} else {
 		Error := relaymodel.Error{
 			Message: fmt.Sprintf("The model '%s' does not exist", modelId),
@@ -182,9 +187,28 @@ func RetrieveModel(c *gin.Context) {
 		c.JSON(200, gin.H{
 			"error": Error,
 		})
+		c.Abort()
 	}
 }
 
+// isModelRelayable checks if there's a channel of the model for the group of the user
+func isModelRelayable(c *gin.Context, modelId string) bool {
+	userGroup, err := model.CacheGetUserGroup(c.GetInt(ctxkey.Id))
+	if err != nil {
+		return false
+	}
+	models, err := model.CacheGetGroupModels(c.Request.Context(), userGroup)
+	if err != nil {
+		return false
+	}
+	for _, modelName := range models {
+		if modelName == modelId {
+			return true
+		}
+	}
+	return false
+}
+
 func GetUserAvailableModels(c *gin.Context) {
 	ctx := c.Request.Context()
 	id := c.GetInt(ctxkey.Id)
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/imagehost"
 	"github.com/songquanpeng/one-api/model"
 	"net/http"
 	"strings"
@@ -83,6 +84,14 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "ChatImageRehostEnabled":
+		if option.Value == "true" && !imagehost.Configured() {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无法启用图片转存，请先设置 HOSTED_IMAGE_PATH（各节点共享的目录）以及 SIGNED_LINK_SECRET！",
+			})
+			return
+		}
 	}
 	err = model.UpdateOption(option.Key, option.Value)
 	if err != nil {
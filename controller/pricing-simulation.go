@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"math"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/model"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+)
+
+// PricingProposal is the ratios to try, the ratios left out are the current ones
+type PricingProposal struct {
+	StartTimestamp  int64              `json:"start_timestamp"`
+	EndTimestamp    int64              `json:"end_timestamp"`
+	ModelRatio      map[string]float64 `json:"model_ratio"`
+	CompletionRatio map[string]float64 `json:"completion_ratio"`
+	GroupRatio      map[string]float64 `json:"group_ratio"`
+}
+
+type PricingSimulationRow struct {
+	ModelName        string `json:"model_name"`
+	Group            string `json:"group"`
+	RequestCount     int    `json:"request_count"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	// BilledQuota is what was actually billed, it may differ from CurrentQuota if the ratios were changed
+	// in the time range, or the requests were billed otherwise, e.g. images or the cost reported by upstream
+	BilledQuota    int64 `json:"billed_quota"`
+	CurrentQuota   int64 `json:"current_quota"`
+	SimulatedQuota int64 `json:"simulated_quota"`
+	Delta          int64 `json:"delta"`
+}
+
+func pricingQuota(promptTokens int64, completionTokens int64, modelRatio float64, completionRatio float64, groupRatio float64) int64 {
+	return int64(math.Ceil((float64(promptTokens) + float64(completionTokens)*completionRatio) * modelRatio * groupRatio))
+}
+
+func proposedRatio(proposal map[string]float64, name string, current float64) float64 {
+	if ratio, ok := proposal[name]; ok {
+		return ratio
+	}
+	return current
+}
+
+// simulatePricing bills the usage with the current ratios and the proposed ones, by model and group
+func simulatePricing(aggregates []*model.UsageAggregate, userGroups map[int]string, proposal *PricingProposal) []*PricingSimulationRow {
+	type rowKey struct {
+		modelName string
+		group     string
+	}
+	rows := make(map[rowKey]*PricingSimulationRow)
+	for _, aggregate := range aggregates {
+		group, ok := userGroups[aggregate.UserId]
+		if !ok {
+			continue
+		}
+		key := rowKey{aggregate.ModelName, group}
+		row, ok := rows[key]
+		if !ok {
+			row = &PricingSimulationRow{ModelName: aggregate.ModelName, Group: group}
+			rows[key] = row
+		}
+		row.RequestCount += aggregate.RequestCount
+		row.PromptTokens += aggregate.PromptTokens
+		row.CompletionTokens += aggregate.CompletionTokens
+		row.BilledQuota += aggregate.Quota
+	}
+	result := make([]*PricingSimulationRow, 0, len(rows))
+	for _, row := range rows {
+		modelRatio := billingratio.GetModelRatio(row.ModelName)
+		completionRatio := billingratio.GetCompletionRatio(row.ModelName)
+		groupRatio := billingratio.GetGroupRatio(row.Group)
+		row.CurrentQuota = pricingQuota(row.PromptTokens, row.CompletionTokens, modelRatio, completionRatio, groupRatio)
+		row.SimulatedQuota = pricingQuota(row.PromptTokens, row.CompletionTokens,
+			proposedRatio(proposal.ModelRatio, row.ModelName, modelRatio),
+			proposedRatio(proposal.CompletionRatio, row.ModelName, completionRatio),
+			proposedRatio(proposal.GroupRatio, row.Group, groupRatio))
+		row.Delta = row.SimulatedQuota - row.CurrentQuota
+		result = append(result, row)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].ModelName != result[j].ModelName {
+			return result[i].ModelName < result[j].ModelName
+		}
+		return result[i].Group < result[j].Group
+	})
+	return result
+}
+
+// SimulatePricing replays the usage of the time range, the last 30 days by default, against the proposed ratios,
+// so that the change of revenue can be seen before the ratios are applied
+func SimulatePricing(c *gin.Context) {
+	proposal := PricingProposal{}
+	err := c.ShouldBindJSON(&proposal)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	if proposal.StartTimestamp == 0 && proposal.EndTimestamp == 0 {
+		proposal.EndTimestamp = helper.GetTimestamp()
+		proposal.StartTimestamp = proposal.EndTimestamp - 30*24*3600
+	}
+	aggregates, err := model.GetUsageAggregates(proposal.StartTimestamp, proposal.EndTimestamp)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	userIds := make([]int, 0, len(aggregates))
+	seen := make(map[int]bool)
+	for _, aggregate := range aggregates {
+		if !seen[aggregate.UserId] {
+			seen[aggregate.UserId] = true
+			userIds = append(userIds, aggregate.UserId)
+		}
+	}
+	userGroups, err := model.GetUserGroups(userIds)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	rows := simulatePricing(aggregates, userGroups, &proposal)
+	var billedQuota, currentQuota, simulatedQuota int64
+	for _, row := range rows {
+		billedQuota += row.BilledQuota
+		currentQuota += row.CurrentQuota
+		simulatedQuota += row.SimulatedQuota
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"start_timestamp": proposal.StartTimestamp,
+			"end_timestamp":   proposal.EndTimestamp,
+			"billed_quota":    billedQuota,
+			"current_quota":   currentQuota,
+			"simulated_quota": simulatedQuota,
+			"delta":           simulatedQuota - currentQuota,
+			"rows":            rows,
+		},
+	})
+}
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/model"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+)
+
+func TestSimulatePricing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("SimulatePricing replays the usage of the time range against the proposed ratios", t, func() {
+		useTestDB(t)
+		So(model.DB.Create(&model.User{Id: 1, Username: "user1", AccessToken: "access1", AffCode: "aff1", Group: "default"}).Error, ShouldBeNil)
+		So(model.DB.Create(&model.User{Id: 2, Username: "user2", AccessToken: "access2", AffCode: "aff2", Group: "vip"}).Error, ShouldBeNil)
+		for _, log := range []*model.Log{
+			{UserId: 1, CreatedAt: 1000, Type: model.LogTypeConsume, ModelName: "gpt-4o", PromptTokens: 100, CompletionTokens: 10, Quota: 50},
+			{UserId: 1, CreatedAt: 1100, Type: model.LogTypeConsume, ModelName: "gpt-4o", PromptTokens: 200, CompletionTokens: 20, Quota: 100},
+			{UserId: 2, CreatedAt: 1200, Type: model.LogTypeConsume, ModelName: "gpt-4o", PromptTokens: 100, CompletionTokens: 0, Quota: 40},
+			// out of the time range, not a consumption or of a deleted user
+			{UserId: 1, CreatedAt: 5000, Type: model.LogTypeConsume, ModelName: "gpt-4o", PromptTokens: 100},
+			{UserId: 1, CreatedAt: 1000, Type: model.LogTypeError, ModelName: "gpt-4o", PromptTokens: 100},
+			{UserId: 3, CreatedAt: 1000, Type: model.LogTypeConsume, ModelName: "gpt-4o", PromptTokens: 100},
+		} {
+			So(model.LOG_DB.Create(log).Error, ShouldBeNil)
+		}
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/pricing/simulate", strings.NewReader(
+			`{"start_timestamp":900,"end_timestamp":2000,"model_ratio":{"gpt-4o":2},"group_ratio":{"vip":0.5}}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+		SimulatePricing(c)
+
+		var response struct {
+			Success bool   `json:"success"`
+			Message string `json:"message"`
+			Data    struct {
+				BilledQuota    int64                   `json:"billed_quota"`
+				CurrentQuota   int64                   `json:"current_quota"`
+				SimulatedQuota int64                   `json:"simulated_quota"`
+				Delta          int64                   `json:"delta"`
+				Rows           []*PricingSimulationRow `json:"rows"`
+			} `json:"data"`
+		}
+		So(json.Unmarshal(w.Body.Bytes(), &response), ShouldBeNil)
+		So(response.Success, ShouldBeTrue)
+		rows := response.Data.Rows
+		So(rows, ShouldHaveLength, 2)
+
+		completionRatio := billingratio.GetCompletionRatio("gpt-4o")
+		So(*rows[0], ShouldResemble, PricingSimulationRow{
+			ModelName:        "gpt-4o",
+			Group:            "default",
+			RequestCount:     2,
+			PromptTokens:     300,
+			CompletionTokens: 30,
+			BilledQuota:      150,
+			CurrentQuota:     pricingQuota(300, 30, billingratio.GetModelRatio("gpt-4o"), completionRatio, billingratio.GetGroupRatio("default")),
+			SimulatedQuota:   pricingQuota(300, 30, 2, completionRatio, billingratio.GetGroupRatio("default")),
+			Delta:            rows[0].SimulatedQuota - rows[0].CurrentQuota,
+		})
+		So(rows[1].Group, ShouldEqual, "vip")
+		So(rows[1].SimulatedQuota, ShouldEqual, 100)
+		So(response.Data.BilledQuota, ShouldEqual, 190)
+		So(response.Data.SimulatedQuota, ShouldEqual, rows[0].SimulatedQuota+rows[1].SimulatedQuota)
+		So(response.Data.Delta, ShouldEqual, response.Data.SimulatedQuota-response.Data.CurrentQuota)
+	})
+}
+
+func TestPricingQuota(t *testing.T) {
+	Convey("pricingQuota rounds up like the billing of the requests", t, func() {
+		So(pricingQuota(10, 5, 0.5, 3, 1), ShouldEqual, 13)
+		So(pricingQuota(10, 0, 1, 3, 0.5), ShouldEqual, 5)
+		So(pricingQuota(0, 0, 1, 1, 1), ShouldEqual, 0)
+	})
+}
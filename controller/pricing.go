@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+)
+
+const (
+	PricingSourceCatalog  = "catalog"
+	PricingSourceOverride = "override"
+)
+
+// ModelPricing is the effective price of a model in USD, before the group ratio
+type ModelPricing struct {
+	Model string `json:"model"`
+	*billingratio.Price
+	ModelRatio      float64 `json:"model_ratio"`
+	CompletionRatio float64 `json:"completion_ratio"`
+	Source          string  `json:"source"`
+}
+
+func GetPricing(c *gin.Context) {
+	group, err := model.CacheGetUserGroup(c.GetInt(ctxkey.Id))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	names := make(map[string]bool, len(billingratio.Catalog))
+	for name := range billingratio.Catalog {
+		names[name] = true
+	}
+	for name := range billingratio.ModelRatio {
+		names[name] = true
+	}
+	prices := make([]*ModelPricing, 0, len(names))
+	for name := range names {
+		price, overridden := billingratio.GetPrice(name)
+		source := PricingSourceCatalog
+		if overridden {
+			source = PricingSourceOverride
+		}
+		prices = append(prices, &ModelPricing{
+			Model:           name,
+			Price:           price,
+			ModelRatio:      billingratio.GetModelRatio(name),
+			CompletionRatio: billingratio.GetCompletionRatio(name),
+			Source:          source,
+		})
+	}
+	sort.Slice(prices, func(i, j int) bool {
+		return prices[i].Model < prices[j].Model
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"version":     billingratio.CatalogVersion,
+			"group":       group,
+			"group_ratio": billingratio.GetGroupRatio(group),
+			"models":      prices,
+		},
+	})
+}
@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor"
+)
+
+const (
+	ModelStatusOperational = "operational"
+	ModelStatusDegraded    = "degraded"
+	ModelStatusOutage      = "outage"
+)
+
+// recent error rates of the channels of a model above these make it degraded or down
+const (
+	degradedErrorRate = 0.1
+	outageErrorRate   = 0.5
+)
+
+// the status is built at most once per publicStatusTTL, the endpoint takes no auth and may be polled by anyone
+const publicStatusTTL = 30 * time.Second
+
+type PublicModelStatus struct {
+	Model       string   `json:"model"`
+	Status      string   `json:"status"`
+	SuccessRate *float64 `json:"success_rate"` // of the last seconds, null if the model had no traffic
+}
+
+type PublicStatus struct {
+	Status    string               `json:"status"`
+	UpdatedAt int64                `json:"updated_at"`
+	Models    []*PublicModelStatus `json:"models"`
+}
+
+var publicStatus *PublicStatus
+var publicStatusLock sync.Mutex
+
+// getModelStatus tells how a model is doing from the health of its channels, manually disabled
+// channels are left out, it returns false if the model has no channel which is not
+func getModelStatus(modelName string, channels []*model.ModelChannelStatus, channelStats map[int]*monitor.RealtimeChannelStat) (*PublicModelStatus, bool) {
+	enabled, autoDisabled := 0, 0
+	var qps, failedQPS float64
+	for _, channel := range channels {
+		switch channel.Status {
+		case model.ChannelStatusEnabled:
+			enabled++
+			if stat, ok := channelStats[channel.ChannelId]; ok {
+				qps += stat.QPS
+				failedQPS += stat.QPS * stat.ErrorRate
+			}
+		case model.ChannelStatusAutoDisabled:
+			autoDisabled++
+		}
+	}
+	if enabled == 0 && autoDisabled == 0 {
+		return nil, false
+	}
+	status := &PublicModelStatus{Model: modelName, Status: ModelStatusOperational}
+	errorRate := 0.0
+	if qps > 0 {
+		errorRate = failedQPS / qps
+		successRate := 1 - errorRate
+		status.SuccessRate = &successRate
+	}
+	switch {
+	case enabled == 0 || errorRate >= outageErrorRate:
+		status.Status = ModelStatusOutage
+	case autoDisabled > 0 || errorRate >= degradedErrorRate:
+		status.Status = ModelStatusDegraded
+	}
+	return status, true
+}
+
+func buildPublicStatus() (*PublicStatus, error) {
+	channelStatuses, err := model.GetGroupModelChannelStatuses(config.PublicStatusGroup)
+	if err != nil {
+		return nil, err
+	}
+	channelStats := make(map[int]*monitor.RealtimeChannelStat)
+	for _, stat := range monitor.GetRealtimeStats().Channels {
+		channelStats[stat.Id] = stat
+	}
+	status := &PublicStatus{
+		Status:    ModelStatusOperational,
+		UpdatedAt: helper.GetTimestamp(),
+		Models:    make([]*PublicModelStatus, 0),
+	}
+	// the statuses are ordered by model
+	for start := 0; start < len(channelStatuses); {
+		end := start
+		for end < len(channelStatuses) && channelStatuses[end].Model == channelStatuses[start].Model {
+			end++
+		}
+		modelStatus, ok := getModelStatus(channelStatuses[start].Model, channelStatuses[start:end], channelStats)
+		if ok {
+			status.Models = append(status.Models, modelStatus)
+			if modelStatus.Status != ModelStatusOperational {
+				status.Status = ModelStatusDegraded
+			}
+		}
+		start = end
+	}
+	return status, nil
+}
+
+// GetPublicStatus reports the availability of each model without anything about the channels behind it,
+// so that operators can show it on their own status pages
+func GetPublicStatus(c *gin.Context) {
+	if !config.PublicStatusEnabled {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "管理员未开启公开状态页",
+		})
+		return
+	}
+	publicStatusLock.Lock()
+	status := publicStatus
+	if status == nil || time.Since(time.Unix(status.UpdatedAt, 0)) >= publicStatusTTL {
+		newStatus, err := buildPublicStatus()
+		if err != nil {
+			logger.SysError("failed to build public status: " + err.Error())
+		} else {
+			publicStatus = newStatus
+			status = newStatus
+		}
+	}
+	publicStatusLock.Unlock()
+	if status == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "获取状态失败",
+		})
+		return
+	}
+	c.Header("Access-Control-Allow-Origin", "*")
+	c.Header("Cache-Control", "public, max-age=30")
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    status,
+	})
+}
@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor"
+)
+
+func TestGetModelStatus(t *testing.T) {
+	Convey("getModelStatus", t, func() {
+		enabled := &model.ModelChannelStatus{Model: "gpt-4o", ChannelId: 1, Status: model.ChannelStatusEnabled}
+		autoDisabled := &model.ModelChannelStatus{Model: "gpt-4o", ChannelId: 2, Status: model.ChannelStatusAutoDisabled}
+		manuallyDisabled := &model.ModelChannelStatus{Model: "gpt-4o", ChannelId: 3, Status: model.ChannelStatusManuallyDisabled}
+		noStats := map[int]*monitor.RealtimeChannelStat{}
+
+		Convey("a model without traffic is operational without a success rate", func() {
+			status, ok := getModelStatus("gpt-4o", []*model.ModelChannelStatus{enabled}, noStats)
+			So(ok, ShouldBeTrue)
+			So(status.Status, ShouldEqual, ModelStatusOperational)
+			So(status.SuccessRate, ShouldBeNil)
+		})
+
+		Convey("the error rate of the channels is weighted by their traffic", func() {
+			second := &model.ModelChannelStatus{Model: "gpt-4o", ChannelId: 4, Status: model.ChannelStatusEnabled}
+			status, _ := getModelStatus("gpt-4o", []*model.ModelChannelStatus{enabled, second}, map[int]*monitor.RealtimeChannelStat{
+				1: {Id: 1, QPS: 3, ErrorRate: 0},
+				4: {Id: 4, QPS: 1, ErrorRate: 0.8},
+			})
+			So(*status.SuccessRate, ShouldAlmostEqual, 0.8)
+			So(status.Status, ShouldEqual, ModelStatusDegraded)
+
+			status, _ = getModelStatus("gpt-4o", []*model.ModelChannelStatus{enabled}, map[int]*monitor.RealtimeChannelStat{
+				1: {Id: 1, QPS: 2, ErrorRate: 0.5},
+			})
+			So(status.Status, ShouldEqual, ModelStatusOutage)
+		})
+
+		Convey("an auto disabled channel makes the model degraded", func() {
+			status, _ := getModelStatus("gpt-4o", []*model.ModelChannelStatus{enabled, autoDisabled}, noStats)
+			So(status.Status, ShouldEqual, ModelStatusDegraded)
+		})
+
+		Convey("a model with only auto disabled channels is down", func() {
+			status, ok := getModelStatus("gpt-4o", []*model.ModelChannelStatus{autoDisabled, manuallyDisabled}, noStats)
+			So(ok, ShouldBeTrue)
+			So(status.Status, ShouldEqual, ModelStatusOutage)
+		})
+
+		Convey("a model with only manually disabled channels isn't reported", func() {
+			_, ok := getModelStatus("gpt-4o", []*model.ModelChannelStatus{manuallyDisabled}, noStats)
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
+
+func TestGetPublicStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("GetPublicStatus", t, func() {
+		useTestDB(t)
+		oldEnabled, oldGroup := config.PublicStatusEnabled, config.PublicStatusGroup
+		config.PublicStatusGroup = "default"
+		publicStatus = nil
+		t.Cleanup(func() {
+			config.PublicStatusEnabled, config.PublicStatusGroup = oldEnabled, oldGroup
+			publicStatus = nil
+		})
+		get := func() *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/status", nil)
+			GetPublicStatus(c)
+			return w
+		}
+
+		Convey("is not found unless enabled", func() {
+			config.PublicStatusEnabled = false
+			So(get().Code, ShouldEqual, http.StatusNotFound)
+		})
+
+		Convey("reports the models of the group without the channels", func() {
+			config.PublicStatusEnabled = true
+			So(model.DB.Create(&model.Channel{Id: 1, Key: "k1", Name: "c1", Status: model.ChannelStatusEnabled}).Error, ShouldBeNil)
+			So(model.DB.Create(&model.Channel{Id: 2, Key: "k2", Name: "c2", Status: model.ChannelStatusAutoDisabled}).Error, ShouldBeNil)
+			So(model.DB.Create(&model.Channel{Id: 3, Key: "k3", Name: "c3", Status: model.ChannelStatusManuallyDisabled}).Error, ShouldBeNil)
+			for _, ability := range []*model.Ability{
+				{Group: "default", Model: "gpt-4o", ChannelId: 1, Enabled: true},
+				{Group: "default", Model: "gpt-4o", ChannelId: 2, Enabled: false},
+				{Group: "default", Model: "claude-3-haiku", ChannelId: 1, Enabled: true},
+				{Group: "default", Model: "retired", ChannelId: 3, Enabled: false},
+				{Group: "vip", Model: "o1", ChannelId: 1, Enabled: true},
+			} {
+				So(model.DB.Create(ability).Error, ShouldBeNil)
+			}
+
+			w := get()
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "*")
+			So(w.Body.String(), ShouldNotContainSubstring, "channel")
+			var response struct {
+				Success bool         `json:"success"`
+				Data    PublicStatus `json:"data"`
+			}
+			So(json.Unmarshal(w.Body.Bytes(), &response), ShouldBeNil)
+			So(response.Success, ShouldBeTrue)
+			So(response.Data.Status, ShouldEqual, ModelStatusDegraded)
+			So(response.Data.Models, ShouldResemble, []*PublicModelStatus{
+				{Model: "claude-3-haiku", Status: ModelStatusOperational},
+				{Model: "gpt-4o", Status: ModelStatusDegraded},
+			})
+		})
+	})
+}
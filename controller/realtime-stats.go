@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/render"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor"
+)
+
+const realtimeStatsInterval = time.Second
+
+// channel statuses are read from the database, so they are refreshed less often than the counters
+const realtimeChannelStatusInterval = 30 * time.Second
+
+type realtimeChannelStat struct {
+	*monitor.RealtimeChannelStat
+	Name   string `json:"name"`
+	Status int    `json:"status"`
+}
+
+type realtimeStats struct {
+	*monitor.RealtimeStats
+	Channels []*realtimeChannelStat `json:"channels"`
+}
+
+// StreamRealtimeStats pushes the live counters of this node every second as server-sent events,
+// the counters are kept in memory, so every node only reports the traffic it served
+func StreamRealtimeStats(c *gin.Context) {
+	common.SetEventStreamHeaders(c)
+	ticker := time.NewTicker(realtimeStatsInterval)
+	defer ticker.Stop()
+	var channels []*model.Channel
+	var channelsFetchedAt time.Time
+	for {
+		if time.Since(channelsFetchedAt) >= realtimeChannelStatusInterval {
+			var err error
+			channels, err = model.GetChannelStatuses()
+			if err != nil {
+				logger.SysError("failed to get channel statuses: " + err.Error())
+			}
+			channelsFetchedAt = time.Now()
+		}
+		err := render.ObjectData(c, buildRealtimeStats(monitor.GetRealtimeStats(), channels))
+		if err != nil {
+			logger.SysError("failed to render realtime stats: " + err.Error())
+			return
+		}
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func buildRealtimeStats(stats *monitor.RealtimeStats, channels []*model.Channel) *realtimeStats {
+	live := make(map[int]*monitor.RealtimeChannelStat, len(stats.Channels))
+	for _, channel := range stats.Channels {
+		live[channel.Id] = channel
+	}
+	result := &realtimeStats{
+		RealtimeStats: stats,
+		Channels:      make([]*realtimeChannelStat, 0, len(channels)),
+	}
+	for _, channel := range channels {
+		stat, ok := live[channel.Id]
+		if !ok {
+			stat = &monitor.RealtimeChannelStat{Id: channel.Id}
+		}
+		result.Channels = append(result.Channels, &realtimeChannelStat{
+			RealtimeChannelStat: stat,
+			Name:                channel.Name,
+			Status:              channel.Status,
+		})
+	}
+	return result
+}
@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+)
+
+const regionLedgerPageSize = 1000
+
+var regionHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+type regionLedgerResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Data    struct {
+		Region  string               `json:"region"`
+		Entries []*model.QuotaLedger `json:"entries"`
+	} `json:"data"`
+}
+
+// GetRegionLedger serves the quota ledger entries of this region to the other regions
+func GetRegionLedger(c *gin.Context) {
+	after, _ := strconv.Atoi(c.Query("after"))
+	ledgers, err := model.GetLocalQuotaLedgersAfter(after, regionLedgerPageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"region":  config.RegionId,
+			"entries": ledgers,
+		},
+	})
+}
+
+// GetRegionStatus shows how far the ledger of each other region has been applied here
+func GetRegionStatus(c *gin.Context) {
+	cursors, err := model.GetRegionCursors()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"region":  config.RegionId,
+			"cursors": cursors,
+		},
+	})
+}
+
+func AutomaticallySyncRegions() {
+	peers := strings.Split(config.RegionPeers, ",")
+	// a peer tells which region it is in its first response
+	peerRegions := make(map[string]string)
+	for {
+		time.Sleep(time.Duration(config.RegionSyncFrequency) * time.Second)
+		for _, peer := range peers {
+			peer = strings.TrimSuffix(strings.TrimSpace(peer), "/")
+			if peer == "" {
+				continue
+			}
+			err := syncRegion(peer, peerRegions)
+			if err != nil {
+				logger.SysError(fmt.Sprintf("failed to sync quota ledger from %s: %s", peer, err.Error()))
+			}
+		}
+	}
+}
+
+// syncRegion pulls and applies the new ledger entries of a peer until there are none left
+func syncRegion(peer string, peerRegions map[string]string) error {
+	after := 0
+	region, ok := peerRegions[peer]
+	if ok {
+		var err error
+		after, err = model.GetRegionRescanStart(region)
+		if err != nil {
+			return err
+		}
+	}
+	for {
+		response, err := fetchRegionLedger(peer, after)
+		if err != nil {
+			return err
+		}
+		if response.Data.Region == "" || response.Data.Region == config.RegionId {
+			return fmt.Errorf("invalid region id %q", response.Data.Region)
+		}
+		if !ok {
+			peerRegions[peer] = response.Data.Region
+			return syncRegion(peer, peerRegions)
+		}
+		entries := response.Data.Entries
+		if len(entries) == 0 {
+			return nil
+		}
+		err = model.ApplyRegionQuotaLedgers(region, entries)
+		if err != nil {
+			return err
+		}
+		after = entries[len(entries)-1].Id
+		if len(entries) < regionLedgerPageSize {
+			return nil
+		}
+	}
+}
+
+func fetchRegionLedger(peer string, after int) (*regionLedgerResponse, error) {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/region/ledger?after=%d", peer, after), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+config.RegionSyncSecret)
+	resp, err := regionHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	var response regionLedgerResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return nil, err
+	}
+	if !response.Success {
+		return nil, fmt.Errorf("%s", response.Message)
+	}
+	return &response, nil
+}
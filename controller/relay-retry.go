@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	dbmodel "github.com/songquanpeng/one-api/model"
+)
+
+type retryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	jitter      float64
+	statusCodes []dbmodel.StatusCodeRange // empty means the built-in rules
+}
+
+// getRetryPolicy returns the retry options of the channel selected in the context, falling back to the global ones
+func getRetryPolicy(c *gin.Context) retryPolicy {
+	policy := retryPolicy{
+		maxAttempts: config.RetryTimes,
+		baseDelay:   time.Duration(config.RetryBaseDelay) * time.Millisecond,
+		maxDelay:    time.Duration(config.RetryMaxDelay) * time.Millisecond,
+		jitter:      config.RetryJitter,
+	}
+	// validated when the option is updated
+	policy.statusCodes, _ = dbmodel.ParseStatusCodes(config.RetryStatusCodes)
+	value, ok := c.Get(ctxkey.Config)
+	if !ok {
+		return policy
+	}
+	channelPolicy := value.(dbmodel.ChannelConfig).Retry
+	if channelPolicy == nil {
+		return policy
+	}
+	if channelPolicy.MaxAttempts > 0 {
+		policy.maxAttempts = channelPolicy.MaxAttempts
+	}
+	if channelPolicy.BaseDelay > 0 {
+		policy.baseDelay = time.Duration(channelPolicy.BaseDelay) * time.Millisecond
+	}
+	if channelPolicy.MaxDelay > 0 {
+		policy.maxDelay = time.Duration(channelPolicy.MaxDelay) * time.Millisecond
+	}
+	if channelPolicy.Jitter > 0 {
+		policy.jitter = channelPolicy.Jitter
+	}
+	if statusCodes, err := dbmodel.ParseStatusCodes(channelPolicy.StatusCodes); err == nil && len(statusCodes) > 0 {
+		policy.statusCodes = statusCodes
+	}
+	return policy
+}
+
+func (p retryPolicy) isRetryable(statusCode int) bool {
+	if len(p.statusCodes) > 0 {
+		return dbmodel.MatchStatusCode(p.statusCodes, statusCode)
+	}
+	if statusCode == http.StatusTooManyRequests {
+		return true
+	}
+	if statusCode/100 == 5 {
+		return true
+	}
+	if statusCode == http.StatusBadRequest {
+		return false
+	}
+	if statusCode/100 == 2 {
+		return false
+	}
+	return true
+}
+
+// delay is the exponential backoff before the retry, attempt starts at 0
+func (p retryPolicy) delay(attempt int) time.Duration {
+	if p.baseDelay <= 0 {
+		return 0
+	}
+	delay := p.baseDelay
+	for i := 0; i < attempt && (p.maxDelay <= 0 || delay < p.maxDelay); i++ {
+		delay *= 2
+	}
+	if p.maxDelay > 0 && delay > p.maxDelay {
+		delay = p.maxDelay
+	}
+	return delay - time.Duration(p.jitter*rand.Float64()*float64(delay))
+}
+
+// waitForRetry returns false if the request is canceled while waiting
+func waitForRetry(ctx context.Context, delay time.Duration) bool {
+	if delay <= 0 {
+		return true
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
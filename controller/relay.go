@@ -1,11 +1,10 @@
 package controller
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"io"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common"
@@ -13,9 +12,14 @@ import (
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/render"
+	"github.com/songquanpeng/one-api/common/trace"
 	"github.com/songquanpeng/one-api/middleware"
 	dbmodel "github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/monitor"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/constant/errortype"
 	"github.com/songquanpeng/one-api/relay/controller"
 	"github.com/songquanpeng/one-api/relay/model"
 	"github.com/songquanpeng/one-api/relay/relaymode"
@@ -28,12 +32,16 @@ func relayHelper(c *gin.Context, relayMode int) *model.ErrorWithStatusCode {
 	switch relayMode {
 	case relaymode.ImagesGenerations:
 		err = controller.RelayImageHelper(c, relayMode)
+	case relaymode.ImagesEdits, relaymode.ImagesVariations:
+		err = controller.RelayImageEditHelper(c)
 	case relaymode.AudioSpeech:
-		fallthrough
-	case relaymode.AudioTranslation:
-		fallthrough
-	case relaymode.AudioTranscription:
 		err = controller.RelayAudioHelper(c, relayMode)
+	case relaymode.AudioTranslation, relaymode.AudioTranscription:
+		err = controller.RelayAudioTranscriptionHelper(c, relayMode)
+	case relaymode.Messages:
+		err = controller.RelayMessagesHelper(c)
+	case relaymode.Rerank:
+		err = controller.RelayRerankHelper(c)
 	default:
 		err = controller.RelayTextHelper(c)
 	}
@@ -45,11 +53,33 @@ func Relay(c *gin.Context) {
 	relayMode := relaymode.GetByPath(c.Request.URL.Path)
 	if config.DebugEnabled {
 		requestBody, _ := common.GetRequestBody(c)
-		logger.Debugf(ctx, "request body: %s", string(requestBody))
+		if body, ok := common.CaptureBody(c.GetString(ctxkey.RequestModel), requestBody); ok {
+			logger.Debugf(ctx, "request body: %s", body)
+		}
+	}
+	if bizErr := validateRelayMode(c, relayMode); bizErr != nil {
+		c.JSON(bizErr.StatusCode, gin.H{
+			"error": bizErr.Error,
+		})
+		return
+	}
+	if render.AcceptsNDJSON(c.Request.Header.Get("Accept")) {
+		c.Writer = render.NewNDJSONWriter(c.Writer)
 	}
+	inflight := startInflightRequest(c)
+	defer inflight.Finish()
 	channelId := c.GetInt(ctxkey.ChannelId)
 	userId := c.GetInt(ctxkey.Id)
+	startTime := time.Now()
+	monitor.RecordRealtimeRequest()
 	bizErr := relayHelper(c, relayMode)
+	trace.Mark(c, "response")
+	if inflight.Killed() {
+		// the upstream request was aborted, it's not a failure of the channel
+		returnTerminated(c, bizErr)
+		return
+	}
+	recordChannelKeyResult(c, bizErr, time.Since(startTime))
 	if bizErr == nil {
 		monitor.Emit(channelId, true)
 		return
@@ -58,10 +88,12 @@ func Relay(c *gin.Context) {
 	channelName := c.GetString(ctxkey.ChannelName)
 	group := c.GetString(ctxkey.Group)
 	originalModel := c.GetString(ctxkey.OriginalModel)
-	go processChannelRelayError(ctx, userId, channelId, channelName, bizErr)
+	tokenName := c.GetString(ctxkey.TokenName)
+	go processChannelRelayError(ctx, userId, channelId, channelName, c.GetString(ctxkey.ChannelKeyHash), originalModel, tokenName, bizErr)
 	requestId := c.GetString(helper.RequestIdKey)
-	retryTimes := config.RetryTimes
-	if !shouldRetry(c, bizErr.StatusCode) {
+	policy := getRetryPolicy(c)
+	retryTimes := policy.maxAttempts
+	if !shouldRetry(c, bizErr.StatusCode, policy) {
 		logger.Errorf(ctx, "relay error happen, status code is %d, won't retry in this case", bizErr.StatusCode)
 		retryTimes = 0
 	}
@@ -75,19 +107,50 @@ func Relay(c *gin.Context) {
 		if channel.Id == lastFailedChannelId {
 			continue
 		}
+		if channel.KeyError() != nil {
+			logger.Errorf(ctx, "key of channel #%d can't be resolved, skip it", channel.Id)
+			continue
+		}
+		if !relay.IsModeSupported(channeltype.ToAPIType(channel.Type), relayMode) {
+			logger.Infof(ctx, "channel #%d doesn't support the operation, skip it", channel.Id)
+			continue
+		}
+		// nothing was sent upstream if the request was rejected by the caps of the channel, no need to back off
+		if bizErr.Code != controller.ChannelRateLimitedCode && !waitForRetry(ctx, policy.delay(retryTimes-i)) {
+			logger.Errorf(ctx, "request canceled while waiting to retry")
+			break
+		}
+		monitor.RecordRetry(lastFailedChannelId)
 		middleware.SetupContextForSelectedChannel(c, channel, originalModel)
-		requestBody, err := common.GetRequestBody(c)
-		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+		if err := middleware.SwitchLane(c); err != nil {
+			logger.Errorf(ctx, "failed to take a slot of channel #%d to retry: %s", channel.Id, err.Error())
+			break
+		}
+		inflight.SetChannel(channel.Id)
+		_ = common.RewindRequestBody(c)
+		startTime = time.Now()
 		bizErr = relayHelper(c, relayMode)
+		trace.Mark(c, "response")
+		if inflight.Killed() {
+			returnTerminated(c, bizErr)
+			return
+		}
+		recordChannelKeyResult(c, bizErr, time.Since(startTime))
 		if bizErr == nil {
 			return
 		}
 		channelId := c.GetInt(ctxkey.ChannelId)
 		lastFailedChannelId = channelId
 		channelName := c.GetString(ctxkey.ChannelName)
-		go processChannelRelayError(ctx, userId, channelId, channelName, bizErr)
+		go processChannelRelayError(ctx, userId, channelId, channelName, c.GetString(ctxkey.ChannelKeyHash), originalModel, tokenName, bizErr)
+		policy = getRetryPolicy(c)
+		if !shouldRetry(c, bizErr.StatusCode, policy) {
+			logger.Errorf(ctx, "relay error happen, status code is %d, won't retry in this case", bizErr.StatusCode)
+			break
+		}
 	}
 	if bizErr != nil {
+		controller.ReturnPreConsumedQuota(c)
 		if bizErr.StatusCode == http.StatusTooManyRequests {
 			bizErr.Error.Message = "当前分组上游负载已饱和，请稍后再试"
 		}
@@ -98,35 +161,104 @@ func Relay(c *gin.Context) {
 	}
 }
 
-func shouldRetry(c *gin.Context, statusCode int) bool {
-	if _, ok := c.Get(ctxkey.SpecificChannelId); ok {
-		return false
+// returnTerminated answers a request killed by an admin, unless it was too late and the response was already sent
+func returnTerminated(c *gin.Context, bizErr *model.ErrorWithStatusCode) {
+	logger.Warnf(c.Request.Context(), "request terminated by the administrator")
+	if bizErr == nil {
+		return
+	}
+	controller.ReturnPreConsumedQuota(c)
+	if c.Writer.Written() {
+		return
 	}
-	if statusCode == http.StatusTooManyRequests {
-		return true
+	bizErr = terminatedError(c)
+	c.JSON(bizErr.StatusCode, gin.H{
+		"error": bizErr.Error,
+	})
+}
+
+// validateRelayMode rejects operations the selected channel can't serve before anything is sent upstream,
+// it's not a failure of the channel, so neither retries nor channel metrics are involved
+func validateRelayMode(c *gin.Context, relayMode int) *model.ErrorWithStatusCode {
+	apiType := channeltype.ToAPIType(c.GetInt(ctxkey.Channel))
+	if relay.IsModeSupported(apiType, relayMode) {
+		return nil
 	}
-	if statusCode/100 == 5 {
-		return true
+	return &model.ErrorWithStatusCode{
+		Error: model.Error{
+			Message: helper.MessageWithRequestId(fmt.Sprintf("The model %s does not support this operation.", c.GetString(ctxkey.OriginalModel)), c.GetString(helper.RequestIdKey)),
+			Type:    "invalid_request_error",
+			Code:    "unsupported_operation",
+		},
+		StatusCode: http.StatusBadRequest,
 	}
-	if statusCode == http.StatusBadRequest {
+}
+
+func shouldRetry(c *gin.Context, statusCode int, policy retryPolicy) bool {
+	if _, ok := c.Get(ctxkey.SpecificChannelId); ok {
 		return false
 	}
-	if statusCode/100 == 2 {
-		return false
+	return policy.isRetryable(statusCode)
+}
+
+func recordChannelKeyResult(c *gin.Context, bizErr *model.ErrorWithStatusCode, latency time.Duration) {
+	if bizErr != nil && bizErr.Code == controller.ChannelRateLimitedCode {
+		return
+	}
+	channelId := c.GetInt(ctxkey.ChannelId)
+	monitor.RecordRealtimeChannelResult(channelId, bizErr == nil || !monitor.IsChannelFailure(bizErr.StatusCode, &bizErr.Error))
+	keyHash := c.GetString(ctxkey.ChannelKeyHash)
+	if bizErr == nil {
+		monitor.RecordKeyResult(channelId, keyHash, http.StatusOK, nil, latency)
+		return
 	}
-	return true
+	monitor.RecordKeyResult(channelId, keyHash, bizErr.StatusCode, &bizErr.Error, latency)
 }
 
-func processChannelRelayError(ctx context.Context, userId int, channelId int, channelName string, err *model.ErrorWithStatusCode) {
-	logger.Errorf(ctx, "relay error (channel id %d, user id: %d): %s", channelId, userId, err.Message)
+// processChannelRelayError records the failure, keyHash is empty unless the channel has several keys, in which case a key
+// rejected by the upstream is no longer selected and the channel is disabled only once none of them is left
+func processChannelRelayError(ctx context.Context, userId int, channelId int, channelName string, keyHash string, modelName string, tokenName string, err *model.ErrorWithStatusCode) {
+	errorType := monitor.ClassifyError(err.StatusCode, &err.Error)
+	logger.Errorf(ctx, "relay error (channel id %d, user id: %d, error type: %s): %s", channelId, userId, errortype.String(errorType), err.Message)
+	dbmodel.RecordErrorLog(ctx, userId, channelId, modelName, tokenName, errorType, fmt.Sprintf("状态码 %d，%s", err.StatusCode, err.Message), channelName)
+	if err.Code == controller.ChannelRateLimitedCode {
+		// nothing was sent upstream, the channel is fine
+		return
+	}
 	// https://platform.openai.com/docs/guides/error-codes/api-errors
 	if monitor.ShouldDisableChannel(&err.Error, err.StatusCode) {
-		monitor.DisableChannel(channelId, channelName, err.Message)
-	} else {
+		if keyHash == "" {
+			monitor.DisableChannel(channelId, channelName, err.Message)
+			return
+		}
+		monitor.MarkKeyDead(channelId, keyHash)
+		channel, getErr := dbmodel.GetChannelById(channelId, true)
+		if getErr != nil {
+			logger.Errorf(ctx, "failed to get channel #%d: %s", channelId, getErr.Error())
+			return
+		}
+		if monitor.AllKeysDead(channelId, channel.GetKeys()) {
+			monitor.DisableChannel(channelId, channelName, "所有密钥均已失效，最后一个错误："+err.Message)
+		}
+	} else if monitor.IsChannelFailure(err.StatusCode, &err.Error) {
 		monitor.Emit(channelId, false)
 	}
 }
 
+// RelayGet relays the GET requests of the SDK helpers, they're neither billed nor retried,
+// the ids they take belong to the upstream account of the channel
+func RelayGet(c *gin.Context) {
+	bizErr := controller.RelayGetHelper(c)
+	if bizErr == nil {
+		return
+	}
+	logger.Errorf(c.Request.Context(), "relay get error: %s", bizErr.Error.Message)
+	bizErr.Error.Message = helper.MessageWithRequestId(bizErr.Error.Message, c.GetString(helper.RequestIdKey))
+	c.JSON(bizErr.StatusCode, gin.H{
+		"error": bizErr.Error,
+	})
+}
+
 func RelayNotImplemented(c *gin.Context) {
 	err := model.Error{
 		Message: "API not implemented",
@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestRelayRetrySkipsUnsupportedChannels(t *testing.T) {
+	Convey("a retry skips the channels not supporting the operation", t, func() {
+		useTestDB(t)
+		oldApproximateTokenEnabled, oldRetryTimes := config.ApproximateTokenEnabled, config.RetryTimes
+		config.ApproximateTokenEnabled, config.RetryTimes = true, 1
+		t.Cleanup(func() {
+			config.ApproximateTokenEnabled, config.RetryTimes = oldApproximateTokenEnabled, oldRetryTimes
+		})
+		if client.HTTPClient == nil {
+			client.HTTPClient = http.DefaultClient
+		}
+		So(model.DB.Create(&model.User{Id: 1, Username: "user1", Quota: 1000000, Status: model.UserStatusEnabled,
+			AccessToken: "access1", AffCode: "aff1", Group: "default"}).Error, ShouldBeNil)
+		So(model.DB.Create(&model.Token{Id: 1, UserId: 1, Key: "key1", Status: model.TokenStatusEnabled,
+			RemainQuota: 1000000, ExpiredTime: -1}).Error, ShouldBeNil)
+
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"error":{"message":"upstream failed","type":"server_error"}}`))
+		}))
+		defer failing.Close()
+		var anthropicHits int32
+		anthropic := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&anthropicHits, 1)
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer anthropic.Close()
+		anthropicURL := anthropic.URL
+		So(model.DB.Create(&model.Channel{Id: 1, Type: channeltype.OpenAI, Key: "sk-test", Name: "openai",
+			Status: model.ChannelStatusEnabled}).Error, ShouldBeNil)
+		So(model.DB.Create(&model.Channel{Id: 2, Type: channeltype.Anthropic, Key: "sk-ant", Name: "anthropic",
+			Status: model.ChannelStatusEnabled, BaseURL: &anthropicURL}).Error, ShouldBeNil)
+		So(model.DB.Create(&model.Ability{Group: "default", Model: "text-embedding-3-small", ChannelId: 2, Enabled: true}).Error, ShouldBeNil)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/embeddings",
+			strings.NewReader(`{"model":"text-embedding-3-small","input":"hello"}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set(helper.RequestIdKey, "request-1")
+		c.Set(ctxkey.Id, 1)
+		c.Set(ctxkey.TokenId, 1)
+		c.Set(ctxkey.Group, "default")
+		c.Set(ctxkey.OriginalModel, "text-embedding-3-small")
+		c.Set(ctxkey.Channel, channeltype.OpenAI)
+		c.Set(ctxkey.ChannelId, 1)
+		c.Set(ctxkey.BaseURL, failing.URL)
+		Relay(c)
+
+		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+		So(atomic.LoadInt32(&anthropicHits), ShouldEqual, 0)
+		// the error of the channel is logged in the background
+		var count int64
+		for i := 0; i < 50 && count == 0; i++ {
+			time.Sleep(20 * time.Millisecond)
+			So(model.LOG_DB.Model(&model.Log{}).Where("type = ?", model.LogTypeError).Count(&count).Error, ShouldBeNil)
+		}
+	})
+}
+
+func TestProcessChannelRelayErrorMultiKey(t *testing.T) {
+	Convey("a key rejected by the upstream doesn't disable a channel of several keys", t, func() {
+		useTestDB(t)
+		oldAutoDisable := config.AutomaticDisableChannelEnabled
+		config.AutomaticDisableChannelEnabled = true
+		t.Cleanup(func() {
+			config.AutomaticDisableChannelEnabled = oldAutoDisable
+		})
+		// the key stats are kept in memory across the tests
+		keys := []string{"sk-multi-key-1", "sk-multi-key-2"}
+		So(model.DB.Create(&model.Channel{Id: 801, Type: channeltype.OpenAI, Key: strings.Join(keys, "\n"), Name: "multi",
+			Status: model.ChannelStatusEnabled}).Error, ShouldBeNil)
+		So(model.DB.Create(&model.Channel{Id: 802, Type: channeltype.OpenAI, Key: "sk-single-key", Name: "single",
+			Status: model.ChannelStatusEnabled}).Error, ShouldBeNil)
+		unauthorized := func() *relaymodel.ErrorWithStatusCode {
+			return &relaymodel.ErrorWithStatusCode{StatusCode: http.StatusUnauthorized,
+				Error: relaymodel.Error{Message: "invalid api key", Type: "authentication_error", Code: "invalid_api_key"}}
+		}
+		status := func(id int) int {
+			channel, err := model.GetChannelById(id, true)
+			So(err, ShouldBeNil)
+			return channel.Status
+		}
+
+		processChannelRelayError(context.Background(), 1, 801, "multi", monitor.HashKey(keys[0]), "gpt-4o", "token", unauthorized())
+		So(status(801), ShouldEqual, model.ChannelStatusEnabled)
+		// the other key is selected from now on
+		So(monitor.SelectKey(801, keys), ShouldEqual, 1)
+
+		processChannelRelayError(context.Background(), 1, 801, "multi", monitor.HashKey(keys[1]), "gpt-4o", "token", unauthorized())
+		So(status(801), ShouldEqual, model.ChannelStatusAutoDisabled)
+
+		processChannelRelayError(context.Background(), 1, 802, "single", "", "gpt-4o", "token", unauthorized())
+		So(status(802), ShouldEqual, model.ChannelStatusAutoDisabled)
+	})
+}
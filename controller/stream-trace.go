@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// ResolveStreamTrace finds the token and the channel of the trace at the end of a stream,
+// the traces of the deleted tokens and channels can't be resolved
+func ResolveStreamTrace(c *gin.Context) {
+	streamTrace, err := model.GetStreamTrace(c.Query("trace"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "未找到该追踪标识对应的令牌与渠道",
+		})
+		return
+	}
+	token, err := model.GetTokenById(streamTrace.TokenId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "该追踪标识对应的令牌已被删除",
+		})
+		return
+	}
+	channel, err := model.GetChannelById(streamTrace.ChannelId, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "该追踪标识对应的渠道已被删除",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"user_id":      token.UserId,
+			"token_id":     token.Id,
+			"token_name":   token.Name,
+			"channel_id":   channel.Id,
+			"channel_name": channel.Name,
+		},
+	})
+}
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common/config"
@@ -9,8 +10,15 @@ import (
 	"github.com/songquanpeng/one-api/common/network"
 	"github.com/songquanpeng/one-api/common/random"
 	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/constant/lane"
+	"github.com/songquanpeng/one-api/relay/constant/streampolicy"
+	"github.com/songquanpeng/one-api/relay/contentpolicy"
+	"gorm.io/gorm"
+	"net"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 )
 
 func GetAllTokens(c *gin.Context) {
@@ -83,6 +91,77 @@ func GetToken(c *gin.Context) {
 	return
 }
 
+// GetTokenUsage breaks the consumption of a token of the caller down by day and model,
+// the last 30 days are returned unless start_timestamp and end_timestamp are given
+func GetTokenUsage(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	token, err := model.GetTokenByIds(id, c.GetInt(ctxkey.Id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// the tokens of other users look the same as the missing ones
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "令牌不存在",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	if endTimestamp == 0 {
+		endTimestamp = helper.GetTimestamp()
+	}
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	if startTimestamp == 0 {
+		startTimestamp = endTimestamp - 30*24*60*60
+	}
+	daily, err := model.SearchTokenLogsByDayAndModel(token, startTimestamp, endTimestamp)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无法获取统计信息",
+		})
+		return
+	}
+	var models []*model.ModelUsage
+	modelIndex := make(map[string]*model.ModelUsage)
+	for _, statistic := range daily {
+		usage, ok := modelIndex[statistic.ModelName]
+		if !ok {
+			usage = &model.ModelUsage{ModelName: statistic.ModelName}
+			modelIndex[statistic.ModelName] = usage
+			models = append(models, usage)
+		}
+		usage.RequestCount += int64(statistic.RequestCount)
+		usage.Quota += int64(statistic.Quota)
+		usage.PromptTokens += int64(statistic.PromptTokens)
+		usage.CompletionTokens += int64(statistic.CompletionTokens)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"token_id":        token.Id,
+			"start_timestamp": startTimestamp,
+			"end_timestamp":   endTimestamp,
+			"daily":           daily,
+			"models":          models,
+		},
+	})
+	return
+}
+
 func GetTokenStatus(c *gin.Context) {
 	tokenId := c.GetInt(ctxkey.TokenId)
 	userId := c.GetInt(ctxkey.Id)
@@ -117,6 +196,26 @@ func validateToken(c *gin.Context, token model.Token) error {
 			return fmt.Errorf("无效的网段：%s", err.Error())
 		}
 	}
+	if !streampolicy.IsValid(token.StreamPolicy) {
+		return fmt.Errorf("无效的流式策略：%s", token.StreamPolicy)
+	}
+	if !lane.IsValid(token.Lane) {
+		return fmt.Errorf("无效的优先级通道：%s", token.Lane)
+	}
+	if _, ok := contentpolicy.GetProfile(token.ContentPolicy); token.ContentPolicy != "" && !ok {
+		return fmt.Errorf("无效的内容策略：%s", token.ContentPolicy)
+	}
+	if token.WebhookURL != "" {
+		u, err := url.Parse(token.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(token.WebhookURL) > 512 {
+			return fmt.Errorf("无效的回调地址：%s", token.WebhookURL)
+		}
+		// the host is checked again when it's resolved, this only rejects the obvious ones early
+		ip := net.ParseIP(u.Hostname())
+		if config.UserContentRequestProxy == "" && (strings.EqualFold(u.Hostname(), "localhost") || (ip != nil && !network.IsPublicIP(ip))) {
+			return fmt.Errorf("回调地址不能是内网地址：%s", token.WebhookURL)
+		}
+	}
 	return nil
 }
 
@@ -150,6 +249,11 @@ func AddToken(c *gin.Context) {
 		UnlimitedQuota: token.UnlimitedQuota,
 		Models:         token.Models,
 		Subnet:         token.Subnet,
+		StreamPolicy:   token.StreamPolicy,
+		Honeypot:       token.Honeypot,
+		Lane:           token.Lane,
+		WebhookURL:     token.WebhookURL,
+		ContentPolicy:  token.ContentPolicy,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -239,6 +343,11 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.UnlimitedQuota = token.UnlimitedQuota
 		cleanToken.Models = token.Models
 		cleanToken.Subnet = token.Subnet
+		cleanToken.StreamPolicy = token.StreamPolicy
+		cleanToken.Honeypot = token.Honeypot
+		cleanToken.Lane = token.Lane
+		cleanToken.WebhookURL = token.WebhookURL
+		cleanToken.ContentPolicy = token.ContentPolicy
 	}
 	err = cleanToken.Update()
 	if err != nil {
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func TestValidateTokenWebhookURL(t *testing.T) {
+	Convey("the webhook url must be a public http url", t, func() {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		for _, webhookURL := range []string{"https://example.com/hook", "http://8.8.8.8:8080/hook"} {
+			So(validateToken(c, model.Token{WebhookURL: webhookURL}), ShouldBeNil)
+		}
+		for _, webhookURL := range []string{"ftp://example.com/hook", "http://localhost:3000/hook", "http://127.0.0.1/hook",
+			"http://169.254.169.254/latest/meta-data", "http://[::1]/hook", "http://10.0.0.1/hook"} {
+			So(validateToken(c, model.Token{WebhookURL: webhookURL}), ShouldNotBeNil)
+		}
+	})
+}
+
+func TestGetTokenUsage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("the usage of a token is only shown to its owner", t, func() {
+		useTestDB(t)
+		So(model.DB.Create(&model.Token{Id: 1, UserId: 1, Key: "key1", Name: "token1", ExpiredTime: -1}).Error, ShouldBeNil)
+		So(model.DB.Create(&model.Token{Id: 2, UserId: 2, Key: "key2", Name: "token2", ExpiredTime: -1}).Error, ShouldBeNil)
+		// 2023-11-14 22:13:20 UTC
+		day1 := int64(1700000000)
+		for _, log := range []*model.Log{
+			{UserId: 1, TokenId: 1, TokenName: "token1", Type: model.LogTypeConsume, ModelName: "gpt-4o", Quota: 100, CreatedAt: day1},
+			{UserId: 1, TokenId: 1, TokenName: "token1", Type: model.LogTypeConsume, ModelName: "gpt-4o", Quota: 200, CreatedAt: day1 + 24*60*60},
+			{UserId: 2, TokenId: 2, TokenName: "token2", Type: model.LogTypeConsume, ModelName: "gpt-4o", Quota: 1000, CreatedAt: day1},
+		} {
+			So(model.LOG_DB.Create(log).Error, ShouldBeNil)
+		}
+		getUsage := func(userId int, tokenId int) (int, map[string]any) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/token/%d/usage?start_timestamp=%d&end_timestamp=%d", tokenId, day1, day1+2*24*60*60), nil)
+			c.Params = gin.Params{{Key: "id", Value: strconv.Itoa(tokenId)}}
+			c.Set(ctxkey.Id, userId)
+			GetTokenUsage(c)
+			var response map[string]any
+			So(json.Unmarshal(w.Body.Bytes(), &response), ShouldBeNil)
+			return w.Code, response
+		}
+
+		code, response := getUsage(1, 1)
+		So(code, ShouldEqual, http.StatusOK)
+		So(response["success"], ShouldBeTrue)
+		data := response["data"].(map[string]any)
+		So(data["daily"], ShouldHaveLength, 2)
+		So(data["models"], ShouldHaveLength, 1)
+		So(data["models"].([]any)[0].(map[string]any)["quota"], ShouldEqual, 300)
+
+		code, response = getUsage(2, 1)
+		So(code, ShouldEqual, http.StatusNotFound)
+		So(response["success"], ShouldBeFalse)
+		So(response, ShouldNotContainKey, "data")
+		code, _ = getUsage(1, 3)
+		So(code, ShouldEqual, http.StatusNotFound)
+	})
+}
@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+type userQuotaTransferRequest struct {
+	FromUserId int    `json:"from_user_id"` // only used by admins
+	ToUserId   int    `json:"to_user_id"`
+	Username   string `json:"username"` // the receiver, used by users who don't know the id
+	Quota      int64  `json:"quota"`
+	Remark     string `json:"remark"`
+}
+
+type tokenQuotaTransferRequest struct {
+	FromTokenId int   `json:"from_token_id"`
+	ToTokenId   int   `json:"to_token_id"`
+	Quota       int64 `json:"quota"`
+}
+
+func writeTransferResult(c *gin.Context, err error) {
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// TransferSelfQuota lets a user give some of the balance to another user, if the admin allows it
+func TransferSelfQuota(c *gin.Context) {
+	if !config.QuotaTransferEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "管理员未开启额度转移",
+		})
+		return
+	}
+	req := userQuotaTransferRequest{}
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	if config.QuotaTransferMaxQuota > 0 && req.Quota > config.QuotaTransferMaxQuota {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("单次转移额度不能超过 %s", common.LogQuota(config.QuotaTransferMaxQuota)),
+		})
+		return
+	}
+	receiver := model.User{Username: req.Username}
+	if req.Username == "" || receiver.FillUserByUsername() != nil || receiver.Id == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "转入用户不存在",
+		})
+		return
+	}
+	err = model.TransferUserQuota(c.GetInt(ctxkey.Id), receiver.Id, req.Quota, req.Remark, config.QuotaTransferDailyMaxQuota)
+	writeTransferResult(c, err)
+}
+
+// AdminTransferQuota moves quota between any two users, without the limits on users
+func AdminTransferQuota(c *gin.Context) {
+	req := userQuotaTransferRequest{}
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	myRole := c.GetInt(ctxkey.Role)
+	for _, userId := range []int{req.FromUserId, req.ToUserId} {
+		user, err := model.GetUserById(userId, false)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "用户不存在",
+			})
+			return
+		}
+		if myRole <= user.Role && myRole != model.RoleRootUser {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无权转移同权限等级或更高权限等级用户的额度",
+			})
+			return
+		}
+	}
+	if req.Remark == "" {
+		req.Remark = fmt.Sprintf("由管理员 %d 转移", c.GetInt(ctxkey.Id))
+	}
+	err = model.TransferUserQuota(req.FromUserId, req.ToUserId, req.Quota, req.Remark, 0)
+	writeTransferResult(c, err)
+}
+
+// TransferTokenQuota moves remain quota between two tokens of the current user
+func TransferTokenQuota(c *gin.Context) {
+	req := tokenQuotaTransferRequest{}
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	err = model.TransferTokenQuota(c.GetInt(ctxkey.Id), req.FromTokenId, req.ToTokenId, req.Quota)
+	writeTransferResult(c, err)
+}
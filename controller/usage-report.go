@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/message"
+	"github.com/songquanpeng/one-api/model"
+)
+
+const usageReportBatchSize = 100
+
+// GetSelfUsageReport previews the report of the last day, or the last week with ?period=weekly
+func GetSelfUsageReport(c *gin.Context) {
+	period := c.DefaultQuery("period", model.UsageReportDaily)
+	if period == "" || !model.IsValidUsageReportFrequency(period) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的报告周期",
+		})
+		return
+	}
+	end := time.Now()
+	start := end.AddDate(0, 0, -1)
+	if period == model.UsageReportWeekly {
+		start = end.AddDate(0, 0, -7)
+	}
+	report, err := model.GetUsageReport(c.GetInt(ctxkey.Id), start.Unix(), end.Unix())
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    report,
+	})
+	return
+}
+
+func UpdateSelfUsageReport(c *gin.Context) {
+	req := struct {
+		Frequency string `json:"frequency"`
+	}{}
+	err := c.ShouldBindJSON(&req)
+	if err != nil || !model.IsValidUsageReportFrequency(req.Frequency) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	err = model.UpdateUserUsageReport(c.GetInt(ctxkey.Id), req.Frequency)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+// AutomaticallySendUsageReports emails daily reports every day at config.UsageReportHour,
+// and weekly reports on Mondays, both cover the days before today
+func AutomaticallySendUsageReports() {
+	if !config.LogConsumeEnabled {
+		logger.SysError("usage reports are enabled but consume logs are disabled, reports will be empty")
+	}
+	for {
+		now := time.Now()
+		next := time.Date(now.Year(), now.Month(), now.Day(), config.UsageReportHour, 0, 0, 0, now.Location())
+		if !next.After(now) {
+			next = next.AddDate(0, 0, 1)
+		}
+		time.Sleep(time.Until(next))
+		today := time.Date(next.Year(), next.Month(), next.Day(), 0, 0, 0, 0, next.Location())
+		sendUsageReports(model.UsageReportDaily, today.AddDate(0, 0, -1), today)
+		if today.Weekday() == time.Monday {
+			sendUsageReports(model.UsageReportWeekly, today.AddDate(0, 0, -7), today)
+		}
+	}
+}
+
+func sendUsageReports(frequency string, start time.Time, end time.Time) {
+	logger.SysLogf("sending %s usage reports", frequency)
+	sent := 0
+	for startIdx := 0; ; startIdx += usageReportBatchSize {
+		users, err := model.GetUsageReportUsers(frequency, startIdx, usageReportBatchSize)
+		if err != nil {
+			logger.SysError("failed to get users for usage reports: " + err.Error())
+			return
+		}
+		for _, user := range users {
+			report, err := model.GetUsageReport(user.Id, start.Unix(), end.Unix())
+			if err != nil {
+				logger.SysError(fmt.Sprintf("failed to generate usage report of user %d: %s", user.Id, err.Error()))
+				continue
+			}
+			subject := fmt.Sprintf("%s 用量报告（%s）", config.SystemName, formatUsageReportPeriod(start, end))
+			err = message.SendEmail(subject, user.Email, renderUsageReport(user, report, start, end))
+			if err != nil {
+				logger.SysError(fmt.Sprintf("failed to send usage report to user %d: %s", user.Id, err.Error()))
+				continue
+			}
+			sent++
+		}
+		if len(users) < usageReportBatchSize {
+			break
+		}
+	}
+	logger.SysLogf("%d %s usage reports sent", sent, frequency)
+}
+
+func formatUsageReportPeriod(start time.Time, end time.Time) string {
+	last := end.AddDate(0, 0, -1)
+	if last.Equal(start) {
+		return start.Format("2006-01-02")
+	}
+	return fmt.Sprintf("%s 至 %s", start.Format("2006-01-02"), last.Format("2006-01-02"))
+}
+
+func renderUsageReport(user *model.User, report *model.UsageReport, start time.Time, end time.Time) string {
+	name := user.DisplayName
+	if name == "" {
+		name = user.Username
+	}
+	var content strings.Builder
+	content.WriteString(fmt.Sprintf("<p>%s，您好，以下是您在 %s 的用量：</p>", html.EscapeString(name), formatUsageReportPeriod(start, end)))
+	content.WriteString("<ul>")
+	content.WriteString(fmt.Sprintf("<li>请求次数：%d</li>", report.RequestCount))
+	content.WriteString(fmt.Sprintf("<li>消耗：%s</li>", common.LogQuota(report.Quota)))
+	content.WriteString(fmt.Sprintf("<li>提示词元：%d，补全词元：%d</li>", report.PromptTokens, report.CompletionTokens))
+	content.WriteString(fmt.Sprintf("<li>失败请求（含重试）：%d</li>", report.ErrorCount))
+	content.WriteString("</ul>")
+	if len(report.TopModels) != 0 {
+		content.WriteString("<p>消耗最多的模型：</p><table border='1' cellpadding='4' style='border-collapse: collapse'>")
+		content.WriteString("<tr><th>模型</th><th>请求次数</th><th>消耗</th><th>提示词元</th><th>补全词元</th></tr>")
+		for _, usage := range report.TopModels {
+			content.WriteString(fmt.Sprintf("<tr><td>%s</td><td>%d</td><td>%s</td><td>%d</td><td>%d</td></tr>",
+				html.EscapeString(usage.ModelName), usage.RequestCount, common.LogQuota(usage.Quota), usage.PromptTokens, usage.CompletionTokens))
+		}
+		content.WriteString("</table>")
+	}
+	content.WriteString(fmt.Sprintf("<p>此邮件由 <a href='%s'>%s</a> 自动发送。</p>", config.ServerAddress, config.SystemName))
+	return content.String()
+}
@@ -10,7 +10,9 @@ import (
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/client"
 	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/credential"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/secret"
 	"github.com/songquanpeng/one-api/controller"
 	"github.com/songquanpeng/one-api/middleware"
 	"github.com/songquanpeng/one-api/model"
@@ -33,6 +35,7 @@ func main() {
 	if config.DebugEnabled {
 		logger.SysLog("running in debug mode")
 	}
+	secret.Init()
 	var err error
 	// Initialize SQL Database
 	model.DB, err = model.InitDB("SQL_DSN")
@@ -59,6 +62,13 @@ func main() {
 		}
 	}()
 
+	if config.IsMasterNode {
+		err = model.MigrateChannelKeys()
+		if err != nil {
+			logger.FatalLog("failed to migrate channel keys: " + err.Error())
+		}
+	}
+
 	// Initialize Redis
 	err = common.InitRedisClient()
 	if err != nil {
@@ -93,11 +103,31 @@ func main() {
 		logger.SysLog("batch update enabled with interval " + strconv.Itoa(config.BatchUpdateInterval) + "s")
 		model.InitBatchUpdater()
 	}
+	if config.IsMasterNode && config.QuotaSnapshotFrequency > 0 {
+		go model.AutomaticallyReconcileQuotas(config.QuotaSnapshotFrequency)
+	}
+	if config.IsMasterNode && config.RegionId != "" && config.RegionPeers != "" {
+		logger.SysLog(fmt.Sprintf("multi-region mode enabled, region id: %s", config.RegionId))
+		go controller.AutomaticallySyncRegions()
+	}
+	if config.IsMasterNode && config.UsageReportEnabled {
+		go controller.AutomaticallySendUsageReports()
+	}
+	if config.IsMasterNode {
+		go controller.AutomaticallyUpdateMidjourneyTasks()
+		go controller.AutomaticallySettleAssistantRuns()
+		go controller.AutomaticallyCleanOrphanedFiles()
+		go controller.AutomaticallySettleFineTuningJobs()
+	}
+	if config.IsMasterNode && config.KeySweepFrequency > 0 {
+		go controller.AutomaticallySweepChannelKeys(config.KeySweepFrequency)
+	}
 	if config.EnableMetric {
 		logger.SysLog("metric enabled, will disable channel if too much request failed")
 	}
 	openai.InitTokenEncoders()
 	client.Init()
+	go credential.AutomaticallyRefreshTokens()
 
 	// Initialize HTTP server
 	server := gin.New()
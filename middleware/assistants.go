@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// getAssistantObjectId returns the id of the assistant or the thread the request is about, if any
+func getAssistantObjectId(c *gin.Context) string {
+	if id := c.Param("id"); id != "" {
+		return id
+	}
+	if c.Request.Method == http.MethodPost && strings.HasPrefix(c.Request.URL.Path, "/v1/threads/runs") {
+		// creating a thread and running it at once, the thread is created in the account of the assistant
+		var assistantId string
+		_ = common.PeekBodyReusable(c, map[string]any{"assistant_id": &assistantId})
+		return assistantId
+	}
+	return ""
+}
+
+// getRunAssistantId returns the assistant a thread is run with, the thread itself is the object of the request
+func getRunAssistantId(c *gin.Context) string {
+	if c.Request.Method != http.MethodPost || !strings.HasSuffix(c.Request.URL.Path, "/runs") || c.Param("id") == "" {
+		return ""
+	}
+	var assistantId string
+	_ = common.PeekBodyReusable(c, map[string]any{"assistant_id": &assistantId})
+	return assistantId
+}
+
+// findAssistantObject returns the object the request is about, nil if there's none, and the id not found if any.
+// The assistant a thread is run with must be of the user and in the same account as the thread.
+func findAssistantObject(c *gin.Context) (*model.AssistantObject, string) {
+	objectId := getAssistantObjectId(c)
+	if objectId == "" {
+		return nil, ""
+	}
+	userId := c.GetInt(ctxkey.Id)
+	object, err := model.GetAssistantObject(userId, objectId)
+	if err != nil {
+		return nil, objectId
+	}
+	if assistantId := getRunAssistantId(c); assistantId != "" {
+		assistant, err := model.GetAssistantObject(userId, assistantId)
+		if err != nil || assistant.Object != model.AssistantObjectAssistant ||
+			assistant.ChannelId != object.ChannelId || assistant.KeyIndex != object.KeyIndex {
+			return nil, assistantId
+		}
+	}
+	return object, ""
+}
+
+// DistributeAssistants sends the requests about an assistant or a thread to the channel and the key it's created with,
+// the accounts of the others don't know about it and the objects of other users are not found,
+// the requests creating new objects are distributed as the GET requests
+func DistributeAssistants() func(c *gin.Context) {
+	distribute := DistributeGet()
+	return func(c *gin.Context) {
+		object, missingId := findAssistantObject(c)
+		if missingId != "" {
+			abortWithMessage(c, http.StatusNotFound, "对象不存在："+missingId)
+			return
+		}
+		if object != nil {
+			c.Set(ctxkey.SpecificChannelId, strconv.Itoa(object.ChannelId))
+			c.Set(ctxkey.SpecificKeyIndex, object.KeyIndex)
+		}
+		distribute(c)
+	}
+}
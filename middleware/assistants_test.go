@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func TestFindAssistantObject(t *testing.T) {
+	Convey("findAssistantObject", t, func() {
+		useTestDB(t)
+		objects := []*model.AssistantObject{
+			{ObjectId: "asst_1", Object: model.AssistantObjectAssistant, UserId: 1, ChannelId: 1, KeyIndex: -1},
+			{ObjectId: "thread_1", Object: model.AssistantObjectThread, UserId: 1, ChannelId: 1, KeyIndex: -1},
+			{ObjectId: "asst_other_key", Object: model.AssistantObjectAssistant, UserId: 1, ChannelId: 1, KeyIndex: 1},
+			{ObjectId: "asst_2", Object: model.AssistantObjectAssistant, UserId: 2, ChannelId: 1, KeyIndex: -1},
+		}
+		for _, object := range objects {
+			So(model.InsertAssistantObject(object), ShouldBeNil)
+		}
+
+		Convey("finds the objects of the user", func() {
+			object, missingId := findAssistantObject(newPostContext(1, "/v1/threads/thread_1/runs", "thread_1", `{"assistant_id":"asst_1"}`))
+			So(missingId, ShouldBeEmpty)
+			So(object.ObjectId, ShouldEqual, "thread_1")
+			object, missingId = findAssistantObject(newPostContext(1, "/v1/threads/runs", "", `{"assistant_id":"asst_1"}`))
+			So(missingId, ShouldBeEmpty)
+			So(object.ObjectId, ShouldEqual, "asst_1")
+			object, missingId = findAssistantObject(newPostContext(1, "/v1/threads", "", `{}`))
+			So(missingId, ShouldBeEmpty)
+			So(object, ShouldBeNil)
+		})
+
+		Convey("doesn't find the objects of other users", func() {
+			_, missingId := findAssistantObject(newPostContext(2, "/v1/threads/thread_1/runs", "thread_1", `{"assistant_id":"asst_2"}`))
+			So(missingId, ShouldEqual, "thread_1")
+			_, missingId = findAssistantObject(newPostContext(2, "/v1/threads/runs", "", `{"assistant_id":"asst_1"}`))
+			So(missingId, ShouldEqual, "asst_1")
+		})
+
+		Convey("runs a thread only with an assistant of the user in the same account", func() {
+			_, missingId := findAssistantObject(newPostContext(1, "/v1/threads/thread_1/runs", "thread_1", `{"assistant_id":"asst_2"}`))
+			So(missingId, ShouldEqual, "asst_2")
+			_, missingId = findAssistantObject(newPostContext(1, "/v1/threads/thread_1/runs", "thread_1", `{"assistant_id":"asst_other_key"}`))
+			So(missingId, ShouldEqual, "asst_other_key")
+		})
+	})
+}
@@ -1,13 +1,19 @@
 package middleware
 
 import (
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/blacklist"
+	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/network"
+	"github.com/songquanpeng/one-api/common/trace"
 	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/constant/lane"
 	"net/http"
 	"strings"
 )
@@ -88,10 +94,30 @@ func RootAuth() func(c *gin.Context) {
 	}
 }
 
+// RegionAuth only lets the other regions of a multi-region deployment in, by the shared secret
+func RegionAuth() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		secret := strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+		if config.RegionId == "" || config.RegionSyncSecret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(config.RegionSyncSecret)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"message": "无权进行此操作，区域同步密钥无效",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
 func TokenAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
 		key := c.Request.Header.Get("Authorization")
+		if key == "" {
+			// the Anthropic SDK sends the key in x-api-key
+			key = c.Request.Header.Get("x-api-key")
+		}
 		key = strings.TrimPrefix(key, "Bearer ")
 		key = strings.TrimPrefix(key, "sk-")
 		parts := strings.Split(key, "-")
@@ -101,6 +127,10 @@ func TokenAuth() func(c *gin.Context) {
 			abortWithMessage(c, http.StatusUnauthorized, err.Error())
 			return
 		}
+		if token.Honeypot {
+			serveHoneypot(c, token)
+			return
+		}
 		if token.Subnet != nil && *token.Subnet != "" {
 			if !network.IsIpInSubnets(ctx, c.ClientIP(), *token.Subnet) {
 				abortWithMessage(c, http.StatusForbidden, fmt.Sprintf("该令牌只能在指定网段使用：%s，当前 ip：%s", *token.Subnet, c.ClientIP()))
@@ -117,10 +147,17 @@ func TokenAuth() func(c *gin.Context) {
 			return
 		}
 		requestModel, err := getRequestModel(c)
+		if errors.Is(err, common.ErrRequestBodyTooLarge) {
+			abortWithMessage(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("上传文件过大，最大为 %d MB", maxUploadBytes(c)/1024/1024))
+			return
+		}
 		if err != nil && shouldCheckModel(c) {
 			abortWithMessage(c, http.StatusBadRequest, err.Error())
 			return
 		}
+		if config.ModelNameNormalizationEnabled && requestModel != "" {
+			requestModel = normalizeRequestModel(c, token.UserId, requestModel)
+		}
 		c.Set(ctxkey.RequestModel, requestModel)
 		if token.Models != nil && *token.Models != "" {
 			c.Set(ctxkey.AvailableModels, *token.Models)
@@ -132,6 +169,24 @@ func TokenAuth() func(c *gin.Context) {
 		c.Set(ctxkey.Id, token.UserId)
 		c.Set(ctxkey.TokenId, token.Id)
 		c.Set(ctxkey.TokenName, token.Name)
+		c.Set(ctxkey.TokenStreamPolicy, token.StreamPolicy)
+		c.Set(ctxkey.TokenLane, lane.Of(token.Lane))
+		c.Set(ctxkey.ContentPolicy, token.ContentPolicy)
+		if config.TokenWebhookEnabled && token.WebhookURL != "" {
+			c.Set(ctxkey.TokenWebhookURL, token.WebhookURL)
+			// the events are signed with the key, the receiver already knows it,
+			// an ephemeral key is minted for the browsers, the receiver knows the key of its parent
+			webhookKey := token.Key
+			if token.ParentId != 0 {
+				parent, err := model.GetTokenById(token.ParentId)
+				if err != nil {
+					abortWithMessage(c, http.StatusUnauthorized, "临时密钥的签发令牌已被删除")
+					return
+				}
+				webhookKey = parent.Key
+			}
+			c.Set(ctxkey.TokenKey, webhookKey)
+		}
 		if len(parts) > 1 {
 			if model.IsAdmin(token.UserId) {
 				c.Set(ctxkey.SpecificChannelId, parts[1])
@@ -140,6 +195,7 @@ func TokenAuth() func(c *gin.Context) {
 				return
 			}
 		}
+		trace.Mark(c, "token_auth")
 		c.Next()
 	}
 }
@@ -157,5 +213,8 @@ func shouldCheckModel(c *gin.Context) bool {
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/audio") {
 		return true
 	}
+	if strings.HasPrefix(c.Request.URL.Path, "/mj/submit/") {
+		return true
+	}
 	return false
 }
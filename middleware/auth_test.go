@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func TestTokenAuthEphemeralWebhookKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("the events of an ephemeral key are signed with the key of its parent", t, func() {
+		useTestDB(t)
+		oldWebhookEnabled := config.TokenWebhookEnabled
+		config.TokenWebhookEnabled = true
+		t.Cleanup(func() {
+			config.TokenWebhookEnabled = oldWebhookEnabled
+		})
+		So(model.DB.Create(&model.User{Id: 1, Username: "user1", AccessToken: "access1", AffCode: "aff1",
+			Status: model.UserStatusEnabled, Quota: 10000}).Error, ShouldBeNil)
+		So(model.DB.Create(&model.Token{Id: 1, UserId: 1, Key: "parentkey", Name: "parent", ExpiredTime: -1, RemainQuota: 1000,
+			WebhookURL: "https://example.com/hook"}).Error, ShouldBeNil)
+		So(model.DB.Create(&model.Token{Id: 2, UserId: 1, Key: "childkey", Name: "parent-ephemeral", ExpiredTime: -1, RemainQuota: 100,
+			WebhookURL: "https://example.com/hook", ParentId: 1}).Error, ShouldBeNil)
+		authenticate := func(key string) *gin.Context {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o-mini"}`))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Request.Header.Set("Authorization", "Bearer sk-"+key)
+			TokenAuth()(c)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			return c
+		}
+
+		So(authenticate("parentkey").GetString(ctxkey.TokenKey), ShouldEqual, "parentkey")
+		c := authenticate("childkey")
+		So(c.GetInt(ctxkey.TokenId), ShouldEqual, 2)
+		So(c.GetString(ctxkey.TokenKey), ShouldEqual, "parentkey")
+	})
+}
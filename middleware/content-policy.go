@@ -0,0 +1,200 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/trace"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/contentpolicy"
+	relaycontroller "github.com/songquanpeng/one-api/relay/controller"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+type moderationResponse struct {
+	Results []struct {
+		CategoryScores map[string]float64 `json:"category_scores"`
+	} `json:"results"`
+}
+
+// ContentPolicy checks the request against the content policy profile of the token, or of the group otherwise,
+// the keywords of the blocklist first, then the category thresholds with the scores of the moderation model.
+// It must be used after Distribute. The request is relayed if the moderation fails, so that an outage
+// of the moderation model doesn't stop the relay.
+func ContentPolicy() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		profileName := c.GetString(ctxkey.ContentPolicy)
+		if profileName == "" {
+			profileName = config.GroupContentPolicy[c.GetString(ctxkey.Group)]
+		}
+		profile, ok := contentpolicy.GetProfile(profileName)
+		if !ok || !isContentPolicyChecked(c) {
+			c.Next()
+			return
+		}
+		violation, err := checkContentPolicy(c, profile)
+		trace.Mark(c, "content_policy")
+		if err != nil {
+			logger.Warnf(c.Request.Context(), "content policy check skipped: %s", err.Error())
+		}
+		if violation == nil {
+			c.Next()
+			return
+		}
+		recordContentViolation(c, profileName, profile.Action, violation)
+		if profile.Action == contentpolicy.ActionBlock {
+			abortWithMessage(c, http.StatusBadRequest, fmt.Sprintf("请求内容违反内容策略「%s」", profileName))
+			return
+		}
+		c.Next()
+	}
+}
+
+// only the requests of which the text is known are checked, the uploads aren't
+func isContentPolicyChecked(c *gin.Context) bool {
+	if !strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") {
+		return false
+	}
+	switch relaymode.GetByPath(c.Request.URL.Path) {
+	case relaymode.ChatCompletions, relaymode.Completions, relaymode.Embeddings, relaymode.ImagesGenerations, relaymode.Messages:
+		return true
+	}
+	return false
+}
+
+func checkContentPolicy(c *gin.Context, profile contentpolicy.Profile) (*contentpolicy.Violation, error) {
+	request := &relaymodel.GeneralOpenAIRequest{}
+	err := common.UnmarshalBodyReusable(c, request)
+	if err != nil {
+		return nil, err
+	}
+	text := getRequestText(request)
+	if text == "" {
+		return nil, nil
+	}
+	if violation, ok := profile.MatchBlocklist(text); ok {
+		return violation, nil
+	}
+	if len(profile.CategoryThresholds) == 0 {
+		return nil, nil
+	}
+	scores, err := moderateText(c, text)
+	if err != nil {
+		return nil, err
+	}
+	violation, _ := profile.CheckScores(scores)
+	return violation, nil
+}
+
+func getRequestText(request *relaymodel.GeneralOpenAIRequest) string {
+	var text strings.Builder
+	for _, message := range request.Messages {
+		text.WriteString(message.StringContent())
+		text.WriteString("\n")
+	}
+	switch prompt := request.Prompt.(type) {
+	case string:
+		text.WriteString(prompt)
+		text.WriteString("\n")
+	case []any:
+		for _, item := range prompt {
+			if str, ok := item.(string); ok {
+				text.WriteString(str)
+				text.WriteString("\n")
+			}
+		}
+	}
+	for _, input := range request.ParseInput() {
+		text.WriteString(input)
+		text.WriteString("\n")
+	}
+	return strings.TrimSpace(text.String())
+}
+
+// moderateText returns the category scores of the text, the moderation isn't billed, it's free at OpenAI
+func moderateText(c *gin.Context, text string) (map[string]float64, error) {
+	modelName := config.ContentModerationModel
+	channel, err := model.CacheGetRandomSatisfiedChannel(c.GetString(ctxkey.Group), modelName, false)
+	if err != nil {
+		return nil, fmt.Errorf("no available channel for model %s: %w", modelName, err)
+	}
+	if err = channel.KeyError(); err != nil {
+		return nil, fmt.Errorf("key of channel #%d can't be resolved: %w", channel.Id, err)
+	}
+	subCtx, w := newInternalRelayContext(c, channel, modelName, "/v1/moderations")
+	meta := meta.GetByContext(subCtx)
+	adaptor := relay.GetAdaptor(meta.APIType)
+	if adaptor == nil {
+		return nil, fmt.Errorf("invalid api type: %d", meta.APIType)
+	}
+	adaptor.Init(meta)
+	request := &relaymodel.GeneralOpenAIRequest{Model: modelName, Input: text}
+	if mappedModelName := meta.ModelMapping[modelName]; mappedModelName != "" {
+		request.Model = mappedModelName
+	}
+	meta.OriginModelName, meta.ActualModelName = modelName, request.Model
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	subCtx.Request.Body = io.NopCloser(bytes.NewBuffer(jsonData))
+	resp, err := adaptor.DoRequest(subCtx, meta, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if resp != nil && resp.StatusCode != http.StatusOK {
+		bizErr := relaycontroller.RelayErrorHandler(resp)
+		return nil, fmt.Errorf("moderation failed with status code %d: %s", resp.StatusCode, bizErr.Error.Message)
+	}
+	_, respErr := adaptor.DoResponse(subCtx, resp, meta)
+	if respErr != nil {
+		return nil, errors.New(respErr.Message)
+	}
+	var response moderationResponse
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Results) == 0 {
+		return nil, errors.New("moderation returned no result")
+	}
+	return response.Results[0].CategoryScores, nil
+}
+
+func recordContentViolation(c *gin.Context, profileName string, action string, violation *contentpolicy.Violation) {
+	ctx := c.Request.Context()
+	logger.Warnf(ctx, "content policy %s violated by user %d (keyword: %q, category: %q, score: %.2f)",
+		profileName, c.GetInt(ctxkey.Id), violation.Keyword, violation.Category, violation.Score)
+	if action == contentpolicy.ActionLog {
+		return
+	}
+	go model.RecordContentViolation(ctx, &model.ContentViolation{
+		RequestId: c.GetString(helper.RequestIdKey),
+		UserId:    c.GetInt(ctxkey.Id),
+		TokenName: c.GetString(ctxkey.TokenName),
+		Group:     c.GetString(ctxkey.Group),
+		ModelName: c.GetString(ctxkey.OriginalModel),
+		Profile:   profileName,
+		Action:    action,
+		Keyword:   violation.Keyword,
+		Category:  violation.Category,
+		Score:     violation.Score,
+	})
+}
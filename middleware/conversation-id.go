@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+// ConversationId takes the optional id of the conversation the request belongs to, so that the logs of
+// a multi-turn session can be found together, ids that aren't valid request ids are ignored
+func ConversationId() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		id := c.GetHeader(helper.ConversationIdKey)
+		if isValidRequestId(id) {
+			c.Set(helper.ConversationIdKey, id)
+			ctx := context.WithValue(c.Request.Context(), helper.ConversationIdKey, id)
+			c.Request = c.Request.WithContext(ctx)
+		}
+		c.Next()
+	}
+}
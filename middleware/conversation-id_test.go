@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+func TestConversationId(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("ConversationId", t, func() {
+		run := func(id string) *gin.Context {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			c.Request.Header.Set(helper.ConversationIdKey, id)
+			ConversationId()(c)
+			return c
+		}
+
+		Convey("keeps a valid id in the context and the request context", func() {
+			c := run("thread_42-a")
+			So(c.GetString(helper.ConversationIdKey), ShouldEqual, "thread_42-a")
+			So(c.Request.Context().Value(helper.ConversationIdKey), ShouldEqual, "thread_42-a")
+		})
+
+		Convey("ignores the ids which aren't valid", func() {
+			for _, id := range []string{"", "a b", "a/b", strings.Repeat("a", 65)} {
+				c := run(id)
+				_, ok := c.Get(helper.ConversationIdKey)
+				So(ok, ShouldBeFalse)
+				So(c.Request.Context().Value(helper.ConversationIdKey), ShouldBeNil)
+			}
+		})
+	})
+}
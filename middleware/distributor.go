@@ -3,9 +3,12 @@ package middleware
 import (
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/trace"
 	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"net/http"
 	"strconv"
@@ -39,9 +42,15 @@ func Distribute() func(c *gin.Context) {
 				return
 			}
 		} else {
-			requestModel = c.GetString(ctxkey.RequestModel)
+			requestModel, channel = routeExperiment(c, userId, c.GetString(ctxkey.RequestModel))
 			var err error
-			channel, err = model.CacheGetRandomSatisfiedChannel(userGroup, requestModel, false)
+			if channel == nil {
+				channel, err = model.CacheGetRandomSatisfiedChannel(userGroup, requestModel, false)
+				if err != nil && userGroup == config.SandboxGroup {
+					// the sandbox works out of the box, with the channels of the default group unless it has its own
+					channel, err = model.CacheGetRandomSatisfiedChannel("default", requestModel, false)
+				}
+			}
 			if err != nil {
 				message := fmt.Sprintf("当前分组 %s 下对于模型 %s 无可用渠道", userGroup, requestModel)
 				if channel != nil {
@@ -52,7 +61,40 @@ func Distribute() func(c *gin.Context) {
 				return
 			}
 		}
+		if channel.KeyError() != nil {
+			abortWithMessage(c, http.StatusInternalServerError, "渠道密钥无法读取，请联系管理员")
+			return
+		}
 		SetupContextForSelectedChannel(c, channel, requestModel)
+		trace.Mark(c, "distribute")
+		c.Next()
+	}
+}
+
+// DistributeGet routes the GET requests without a body, they're routed as the others if the model is given
+// in the path or the query, otherwise to an OpenAI channel of the group, as the ids of the files and the jobs
+// belong to the OpenAI account of the channel, a specific channel can be set by the token to reach the right one
+func DistributeGet() func(c *gin.Context) {
+	distribute := Distribute()
+	return func(c *gin.Context) {
+		_, ok := c.Get(ctxkey.SpecificChannelId)
+		if ok || c.GetString(ctxkey.RequestModel) != "" {
+			distribute(c)
+			return
+		}
+		userGroup, _ := model.CacheGetUserGroup(c.GetInt(ctxkey.Id))
+		c.Set(ctxkey.Group, userGroup)
+		channel, err := model.CacheGetRandomChannelOfType(userGroup, channeltype.OpenAI)
+		if err != nil {
+			abortWithMessage(c, http.StatusServiceUnavailable, fmt.Sprintf("当前分组 %s 下无可用的 OpenAI 渠道", userGroup))
+			return
+		}
+		if channel.KeyError() != nil {
+			abortWithMessage(c, http.StatusInternalServerError, "渠道密钥无法读取，请联系管理员")
+			return
+		}
+		SetupContextForSelectedChannel(c, channel, "")
+		trace.Mark(c, "distribute")
 		c.Next()
 	}
 }
@@ -63,7 +105,20 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	c.Set(ctxkey.ChannelName, channel.Name)
 	c.Set(ctxkey.ModelMapping, channel.GetModelMapping())
 	c.Set(ctxkey.OriginalModel, modelName) // for retry
-	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
+	key := channel.Key
+	keyIndex := -1
+	keyHash := ""
+	if keys := channel.GetKeys(); len(keys) > 1 {
+		keyIndex = monitor.SelectKey(channel.Id, keys)
+		if index, ok := c.Get(ctxkey.SpecificKeyIndex); ok && index.(int) >= 0 && index.(int) < len(keys) {
+			keyIndex = index.(int)
+		}
+		key = keys[keyIndex]
+		keyHash = monitor.HashKey(key)
+	}
+	c.Set(ctxkey.ChannelKeyIndex, keyIndex)
+	c.Set(ctxkey.ChannelKeyHash, keyHash)
+	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", key))
 	c.Set(ctxkey.BaseURL, channel.GetBaseURL())
 	cfg, _ := channel.LoadConfig()
 	// this is for backward compatibility
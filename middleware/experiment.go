@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// routeExperiment sends the request to the variant of the experiment the user is assigned to, it returns the model
+// serving the request and the channel pinned by the variant, nil if any channel of the model will do
+func routeExperiment(c *gin.Context, userId int, requestModel string) (string, *model.Channel) {
+	assignment := common.AssignExperiment(requestModel, userId)
+	if assignment == nil {
+		return requestModel, nil
+	}
+	ctx := c.Request.Context()
+	if assignment.Model != requestModel {
+		err := setRequestModel(c, assignment.Model)
+		if err != nil {
+			logger.Warnf(ctx, "request to %s left out of experiment %s: %s", requestModel, assignment.Experiment, err.Error())
+			return requestModel, nil
+		}
+		c.Set(ctxkey.RequestModel, assignment.Model)
+	}
+	c.Request = c.Request.WithContext(common.WithExperiment(ctx, assignment))
+	logger.Infof(ctx, "experiment %s: %s variant, model %s", assignment.Experiment, assignment.Variant, assignment.Model)
+	if assignment.ChannelId == 0 {
+		return assignment.Model, nil
+	}
+	channel, err := model.GetChannelById(assignment.ChannelId, true)
+	if err != nil || channel.Status != model.ChannelStatusEnabled {
+		logger.SysError(fmt.Sprintf("channel #%d of experiment %s is not available, falling back to any channel of %s", assignment.ChannelId, assignment.Experiment, assignment.Model))
+		return assignment.Model, nil
+	}
+	return assignment.Model, channel
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// DistributeFiles sends the requests about a file to the channel and the key it's uploaded with,
+// the files of other users are not found, the uploads are distributed as the GET requests
+func DistributeFiles() func(c *gin.Context) {
+	distribute := DistributeGet()
+	return func(c *gin.Context) {
+		if fileId := c.Param("id"); fileId != "" {
+			file, err := model.GetFile(c.GetInt(ctxkey.Id), fileId)
+			if err != nil {
+				abortWithMessage(c, http.StatusNotFound, "文件不存在："+fileId)
+				return
+			}
+			c.Set(ctxkey.SpecificChannelId, strconv.Itoa(file.ChannelId))
+			c.Set(ctxkey.SpecificKeyIndex, file.KeyIndex)
+		}
+		distribute(c)
+	}
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// findFineTuningFile returns the training file of a job to create, nil if there's none, and the id not found if any.
+// The validation file must be of the user and in the same account as the training file.
+func findFineTuningFile(c *gin.Context) (*model.File, string) {
+	var trainingFile, validationFile string
+	_ = common.PeekBodyReusable(c, map[string]any{"training_file": &trainingFile, "validation_file": &validationFile})
+	if trainingFile == "" {
+		return nil, ""
+	}
+	userId := c.GetInt(ctxkey.Id)
+	file, err := model.GetFile(userId, trainingFile)
+	if err != nil {
+		return nil, trainingFile
+	}
+	if validationFile != "" {
+		validation, err := model.GetFile(userId, validationFile)
+		if err != nil || validation.ChannelId != file.ChannelId || validation.KeyIndex != file.KeyIndex {
+			return nil, validationFile
+		}
+	}
+	return file, ""
+}
+
+// DistributeFineTuning sends the requests about a fine-tuning job to the channel and the key it's created with,
+// and the creations to the ones the training file is uploaded with, the jobs and the files of other users are not found
+func DistributeFineTuning() func(c *gin.Context) {
+	distribute := DistributeGet()
+	return func(c *gin.Context) {
+		userId := c.GetInt(ctxkey.Id)
+		if jobId := c.Param("id"); jobId != "" {
+			job, err := model.GetFineTuningJob(userId, jobId)
+			if err != nil {
+				abortWithMessage(c, http.StatusNotFound, "微调任务不存在："+jobId)
+				return
+			}
+			c.Set(ctxkey.SpecificChannelId, strconv.Itoa(job.ChannelId))
+			c.Set(ctxkey.SpecificKeyIndex, job.KeyIndex)
+		} else if c.Request.Method == http.MethodPost {
+			file, missingId := findFineTuningFile(c)
+			if missingId != "" {
+				abortWithMessage(c, http.StatusNotFound, "文件不存在："+missingId)
+				return
+			}
+			if file != nil {
+				c.Set(ctxkey.SpecificChannelId, strconv.Itoa(file.ChannelId))
+				c.Set(ctxkey.SpecificKeyIndex, file.KeyIndex)
+			}
+		}
+		distribute(c)
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func TestFindFineTuningFile(t *testing.T) {
+	Convey("findFineTuningFile", t, func() {
+		useTestDB(t)
+		files := []*model.File{
+			{FileId: "file-train", UserId: 1, ChannelId: 1, KeyIndex: -1},
+			{FileId: "file-valid", UserId: 1, ChannelId: 1, KeyIndex: -1},
+			{FileId: "file-other-channel", UserId: 1, ChannelId: 2, KeyIndex: -1},
+			{FileId: "file-other-user", UserId: 2, ChannelId: 1, KeyIndex: -1},
+		}
+		for _, file := range files {
+			So(model.InsertFile(file), ShouldBeNil)
+		}
+		find := func(userId int, body string) (*model.File, string) {
+			return findFineTuningFile(newPostContext(userId, "/v1/fine_tuning/jobs", "", body))
+		}
+
+		file, missingId := find(1, `{"training_file":"file-train","validation_file":"file-valid"}`)
+		So(missingId, ShouldBeEmpty)
+		So(file.FileId, ShouldEqual, "file-train")
+		file, missingId = find(1, `{"model":"gpt-4o-mini"}`)
+		So(missingId, ShouldBeEmpty)
+		So(file, ShouldBeNil)
+
+		_, missingId = find(2, `{"training_file":"file-train"}`)
+		So(missingId, ShouldEqual, "file-train")
+		_, missingId = find(1, `{"training_file":"file-train","validation_file":"file-other-user"}`)
+		So(missingId, ShouldEqual, "file-other-user")
+		_, missingId = find(1, `{"training_file":"file-train","validation_file":"file-other-channel"}`)
+		So(missingId, ShouldEqual, "file-other-channel")
+	})
+}
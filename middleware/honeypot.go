@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/render"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/constant"
+	"github.com/songquanpeng/one-api/relay/constant/finishreason"
+	"github.com/songquanpeng/one-api/relay/constant/role"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+const honeypotMaxBodyLength = 2048
+
+const honeypotReply = "Hello! How can I help you today?"
+
+// serveHoneypot records the use for the alerts to the root user and responds with a plausible mock response,
+// so that whoever is using the leaked key doesn't notice and no upstream quota is spent
+func serveHoneypot(c *gin.Context, token *model.Token) {
+	details := getHoneypotRequestDetails(c)
+	go monitor.RecordHoneypotHit(token.Id, token.Name, token.UserId, c.ClientIP(), details)
+
+	var request relaymodel.GeneralOpenAIRequest
+	_ = common.UnmarshalBodyReusable(c, &request)
+	if request.Model == "" {
+		request.Model = "gpt-3.5-turbo"
+	}
+	switch relaymode.GetByPath(c.Request.URL.Path) {
+	case relaymode.ChatCompletions:
+		serveHoneypotChatCompletion(c, &request)
+	case relaymode.Completions:
+		c.JSON(http.StatusOK, gin.H{
+			"id":      helper.GetResponseID(c),
+			"object":  "text_completion",
+			"created": helper.GetTimestamp(),
+			"model":   request.Model,
+			"choices": []gin.H{{"index": 0, "text": honeypotReply, "finish_reason": finishreason.Stop}},
+			"usage":   honeypotUsage(),
+		})
+	case relaymode.Embeddings:
+		c.JSON(http.StatusOK, openai.EmbeddingResponse{
+			Object: "list",
+			Data:   []openai.EmbeddingResponseItem{{Object: "embedding", Embedding: make([]float64, 1536)}},
+			Model:  request.Model,
+			Usage:  honeypotUsage(),
+		})
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"object": "list",
+			"data":   []any{},
+		})
+	}
+	c.Abort()
+}
+
+func serveHoneypotChatCompletion(c *gin.Context, request *relaymodel.GeneralOpenAIRequest) {
+	message := relaymodel.Message{Role: role.Assistant, Content: honeypotReply}
+	if !request.Stream {
+		c.JSON(http.StatusOK, openai.TextResponse{
+			Id:      helper.GetResponseID(c),
+			Model:   request.Model,
+			Object:  constant.NonStreamObject,
+			Created: helper.GetTimestamp(),
+			Choices: []openai.TextResponseChoice{{Message: message, FinishReason: finishreason.Stop}},
+			Usage:   honeypotUsage(),
+		})
+		return
+	}
+	finishReason := finishreason.Stop
+	common.SetEventStreamHeaders(c)
+	_ = render.ObjectData(c, openai.ChatCompletionsStreamResponse{
+		Id:      helper.GetResponseID(c),
+		Object:  constant.StreamObject,
+		Created: helper.GetTimestamp(),
+		Model:   request.Model,
+		Choices: []openai.ChatCompletionsStreamResponseChoice{{Delta: message, FinishReason: &finishReason}},
+	})
+	render.Done(c)
+}
+
+func honeypotUsage() relaymodel.Usage {
+	return relaymodel.Usage{PromptTokens: 10, CompletionTokens: 9, TotalTokens: 19}
+}
+
+func getHoneypotRequestDetails(c *gin.Context) string {
+	var details strings.Builder
+	details.WriteString(fmt.Sprintf("time: %s\n", helper.GetTimeString()))
+	details.WriteString(fmt.Sprintf("request id: %s\n", c.GetString(helper.RequestIdKey)))
+	details.WriteString(fmt.Sprintf("client ip: %s\n", c.ClientIP()))
+	details.WriteString(fmt.Sprintf("request: %s %s\n", c.Request.Method, c.Request.URL.String()))
+	for key, values := range c.Request.Header {
+		if key == "Authorization" || key == "Api-Key" || key == "X-Api-Key" || key == "Cookie" {
+			continue
+		}
+		details.WriteString(fmt.Sprintf("%s: %s\n", key, strings.Join(values, ", ")))
+	}
+	body, err := common.GetRequestBody(c)
+	if err == nil && len(body) > 0 {
+		if len(body) > honeypotMaxBodyLength {
+			body = body[:honeypotMaxBodyLength]
+		}
+		details.WriteString(fmt.Sprintf("body: %s\n", string(body)))
+	}
+	return details.String()
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/testdb"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// useTestDB points the model at a new SQLite database with all the tables migrated, redis is disabled
+func useTestDB(t *testing.T) {
+	testdb.Use(t, model.InitDB, &model.DB, &model.LOG_DB)
+}
+
+// newPostContext is a JSON POST request of the user, id is the path parameter if any
+func newPostContext(userId int, path string, id string, body string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	if id != "" {
+		c.Params = gin.Params{{Key: "id", Value: id}}
+	}
+	c.Set(ctxkey.Id, userId)
+	return c
+}
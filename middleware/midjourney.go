@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// MidjourneyTaskChannel sends the actions on a task to the channel the task was submitted to,
+// the other proxies don't know about it
+func MidjourneyTaskChannel() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		var taskId string
+		err := common.PeekBodyReusable(c, map[string]any{"taskId": &taskId})
+		if err != nil || taskId == "" {
+			abortWithMessage(c, http.StatusBadRequest, "taskId 不能为空")
+			return
+		}
+		task, err := model.GetMidjourneyTaskByMjId(c.GetInt(ctxkey.Id), taskId)
+		if err != nil {
+			abortWithMessage(c, http.StatusNotFound, "任务不存在")
+			return
+		}
+		c.Set(ctxkey.SpecificChannelId, strconv.Itoa(task.ChannelId))
+		c.Next()
+	}
+}
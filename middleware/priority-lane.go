@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/trace"
+	"github.com/songquanpeng/one-api/monitor"
+)
+
+// PriorityLane holds batch requests back while the channel chosen by Distribute is saturated,
+// so that interactive requests keep a low latency. It must be used after Distribute.
+func PriorityLane() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if config.ChannelSaturationThreshold <= 0 {
+			c.Next()
+			return
+		}
+		err := acquireLane(c)
+		if err != nil {
+			if errors.Is(err, monitor.ErrLaneQueueTimeout) {
+				abortWithMessage(c, http.StatusTooManyRequests, fmt.Sprintf("渠道负载已饱和，批量请求排队超时（%d 秒），请稍后再试", config.BatchQueueTimeout))
+				return
+			}
+			abortWithMessage(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		defer releaseLane(c)
+		trace.Mark(c, "priority_lane")
+		c.Next()
+	}
+}
+
+func acquireLane(c *gin.Context) error {
+	requestLane := c.GetString(ctxkey.TokenLane)
+	timeout := time.Duration(config.BatchQueueTimeout) * time.Second
+	release, err := monitor.AcquireLane(c.Request.Context(), c.GetInt(ctxkey.ChannelId), requestLane, config.ChannelSaturationThreshold, timeout)
+	if err != nil {
+		return err
+	}
+	c.Set(ctxkey.LaneRelease, release)
+	return nil
+}
+
+func releaseLane(c *gin.Context) {
+	if release, ok := c.Get(ctxkey.LaneRelease); ok {
+		release.(func())()
+	}
+}
+
+// SwitchLane moves the slot taken by PriorityLane to the channel selected for a retry, so that the retries of batch
+// requests wait for the channel to be unsaturated too, it does nothing for the requests not holding a slot
+func SwitchLane(c *gin.Context) error {
+	if _, ok := c.Get(ctxkey.LaneRelease); !ok {
+		return nil
+	}
+	releaseLane(c)
+	return acquireLane(c)
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/monitor"
+	"github.com/songquanpeng/one-api/relay/constant/lane"
+)
+
+// isSaturated tells whether a batch request would have to wait for the channel
+func isSaturated(channelId int) bool {
+	release, err := monitor.AcquireLane(context.Background(), channelId, lane.Batch, 1, 10*time.Millisecond)
+	if err != nil {
+		return true
+	}
+	release()
+	return false
+}
+
+func TestSwitchLane(t *testing.T) {
+	Convey("a retry moves the slot of the request to the channel of the retry", t, func() {
+		oldThreshold, oldTimeout := config.ChannelSaturationThreshold, config.BatchQueueTimeout
+		config.ChannelSaturationThreshold, config.BatchQueueTimeout = 1, 1
+		t.Cleanup(func() {
+			config.ChannelSaturationThreshold, config.BatchQueueTimeout = oldThreshold, oldTimeout
+		})
+		var before, afterSwitch [2]bool
+		var switchErr error
+		router := gin.New()
+		router.POST("/v1/chat/completions", func(c *gin.Context) {
+			c.Set(ctxkey.TokenLane, lane.Batch)
+			c.Set(ctxkey.ChannelId, 101)
+		}, PriorityLane(), func(c *gin.Context) {
+			before = [2]bool{isSaturated(101), isSaturated(102)}
+			c.Set(ctxkey.ChannelId, 102)
+			switchErr = SwitchLane(c)
+			afterSwitch = [2]bool{isSaturated(101), isSaturated(102)}
+		})
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+
+		So(switchErr, ShouldBeNil)
+		So(before, ShouldResemble, [2]bool{true, false})
+		So(afterSwitch, ShouldResemble, [2]bool{false, true})
+		// the slot is given back once the request is finished
+		So(isSaturated(102), ShouldBeFalse)
+	})
+}
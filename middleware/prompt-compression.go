@@ -0,0 +1,261 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/trace"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/constant/role"
+	relaycontroller "github.com/songquanpeng/one-api/relay/controller"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// PromptCompressionHeader is set by clients which want their long conversations to be compressed
+const PromptCompressionHeader = "X-Prompt-Compression"
+
+const promptCompressionInstruction = "Summarize the following conversation between a user and an assistant. " +
+	"Keep every fact, decision, name, number and open question, drop greetings and repetition. " +
+	"Reply with the summary only."
+
+// PromptCompression summarizes the old turns of a long conversation with a cheap model before
+// the request is relayed, the summarization is billed to the same token.
+// It must be used after Distribute, and it never fails the request: if anything goes wrong,
+// the original conversation is relayed as is.
+func PromptCompression() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if shouldCompressPrompt(c) {
+			err := compressPrompt(c)
+			if err != nil {
+				logger.Warnf(c.Request.Context(), "prompt compression skipped: %s", err.Error())
+			}
+			trace.Mark(c, "prompt_compression")
+		}
+		c.Next()
+	}
+}
+
+func shouldCompressPrompt(c *gin.Context) bool {
+	if !config.PromptCompressionEnabled {
+		return false
+	}
+	if strings.ToLower(c.Request.Header.Get(PromptCompressionHeader)) != "true" {
+		return false
+	}
+	if relaymode.GetByPath(c.Request.URL.Path) != relaymode.ChatCompletions {
+		return false
+	}
+	return getPromptCompressionThreshold(c.GetString(ctxkey.Group)) > 0
+}
+
+func getPromptCompressionThreshold(group string) int {
+	config.PromptCompressionGroupThresholdLock.RLock()
+	defer config.PromptCompressionGroupThresholdLock.RUnlock()
+	return config.PromptCompressionGroupThreshold[group]
+}
+
+func compressPrompt(c *gin.Context) error {
+	ctx := c.Request.Context()
+	textRequest := &relaymodel.GeneralOpenAIRequest{}
+	err := common.UnmarshalBodyReusable(c, textRequest)
+	if err != nil {
+		return err
+	}
+	threshold := getPromptCompressionThreshold(c.GetString(ctxkey.Group))
+	promptTokens := openai.CountTokenMessages(textRequest.Messages, textRequest.Model)
+	if promptTokens <= threshold {
+		return nil
+	}
+	head, middle, tail := splitMessagesForCompression(textRequest.Messages, config.PromptCompressionKeepMessages)
+	if len(middle) == 0 {
+		return nil
+	}
+	summary, err := summarizeMessages(c, middle)
+	if err != nil {
+		return err
+	}
+	messages := make([]relaymodel.Message, 0, len(head)+len(tail)+1)
+	messages = append(messages, head...)
+	messages = append(messages, relaymodel.Message{
+		Role:    role.System,
+		Content: "Summary of the earlier conversation: " + summary,
+	})
+	messages = append(messages, tail...)
+
+	// only replace messages, so that fields unknown to us are still relayed
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return err
+	}
+	var rawRequest map[string]json.RawMessage
+	err = json.Unmarshal(requestBody, &rawRequest)
+	if err != nil {
+		return err
+	}
+	rawRequest["messages"], err = json.Marshal(messages)
+	if err != nil {
+		return err
+	}
+	requestBody, err = json.Marshal(rawRequest)
+	if err != nil {
+		return err
+	}
+	common.SetRequestBody(c, requestBody)
+	logger.Infof(ctx, "prompt compressed: %d messages summarized, %d prompt tokens before compression", len(middle), promptTokens)
+	return nil
+}
+
+// splitMessagesForCompression keeps the leading system messages and the last keep messages,
+// the rest is what we are going to summarize
+func splitMessagesForCompression(messages []relaymodel.Message, keep int) (head, middle, tail []relaymodel.Message) {
+	start := 0
+	for start < len(messages) && messages[start].Role == role.System {
+		start++
+	}
+	end := len(messages) - keep
+	if end < start {
+		end = start
+	}
+	return messages[:start], messages[start:end], messages[end:]
+}
+
+func summarizeMessages(c *gin.Context, messages []relaymodel.Message) (string, error) {
+	ctx := c.Request.Context()
+	modelName := config.PromptCompressionModel
+	channel, err := model.CacheGetRandomSatisfiedChannel(c.GetString(ctxkey.Group), modelName, false)
+	if err != nil {
+		return "", fmt.Errorf("no available channel for model %s: %w", modelName, err)
+	}
+	if err = channel.KeyError(); err != nil {
+		return "", fmt.Errorf("key of channel #%d can't be resolved: %w", channel.Id, err)
+	}
+	var transcript strings.Builder
+	for _, message := range messages {
+		transcript.WriteString(fmt.Sprintf("%s: %s\n", message.Role, message.StringContent()))
+	}
+	request := &relaymodel.GeneralOpenAIRequest{
+		Model: modelName,
+		Messages: []relaymodel.Message{
+			{Role: role.System, Content: promptCompressionInstruction},
+			{Role: role.User, Content: transcript.String()},
+		},
+	}
+
+	subCtx, w := newInternalRelayContext(c, channel, modelName, "/v1/chat/completions")
+	meta := meta.GetByContext(subCtx)
+	adaptor := relay.GetAdaptor(meta.APIType)
+	if adaptor == nil {
+		return "", fmt.Errorf("invalid api type: %d", meta.APIType)
+	}
+	adaptor.Init(meta)
+	if mappedModelName := meta.ModelMapping[modelName]; mappedModelName != "" {
+		request.Model = mappedModelName
+	}
+	meta.OriginModelName, meta.ActualModelName = modelName, request.Model
+	meta.PromptTokens = openai.CountTokenMessages(request.Messages, request.Model)
+	err = checkPromptCompressionQuota(ctx, meta)
+	if err != nil {
+		return "", err
+	}
+
+	convertedRequest, err := adaptor.ConvertRequest(subCtx, relaymode.ChatCompletions, request)
+	if err != nil {
+		return "", err
+	}
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		return "", err
+	}
+	subCtx.Request.Body = io.NopCloser(bytes.NewBuffer(jsonData))
+	resp, err := adaptor.DoRequest(subCtx, meta, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", err
+	}
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if resp != nil && resp.StatusCode != http.StatusOK {
+		bizErr := relaycontroller.RelayErrorHandler(resp)
+		return "", fmt.Errorf("summarization failed with status code %d: %s", resp.StatusCode, bizErr.Error.Message)
+	}
+	usage, respErr := adaptor.DoResponse(subCtx, resp, meta)
+	if respErr != nil {
+		return "", errors.New(respErr.Message)
+	}
+	var textResponse openai.TextResponse
+	err = json.Unmarshal(w.Body.Bytes(), &textResponse)
+	if err != nil {
+		return "", err
+	}
+	if len(textResponse.Choices) == 0 || textResponse.Choices[0].StringContent() == "" {
+		return "", errors.New("summarization returned empty content")
+	}
+	if usage != nil {
+		go consumePromptCompressionQuota(ctx, meta, usage, channel.Name)
+	}
+	return textResponse.Choices[0].StringContent(), nil
+}
+
+// checkPromptCompressionQuota makes sure the user and the token can afford the summarization, it's estimated
+// the way the relay pre-consumes, but nothing is reserved, the summarization is billed once it's done
+func checkPromptCompressionQuota(ctx context.Context, meta *meta.Meta) error {
+	ratio := billingratio.GetModelRatio(meta.ActualModelName) * billingratio.GetGroupRatio(meta.Group)
+	quota := int64(float64(config.PreConsumedQuota+int64(meta.PromptTokens)) * ratio)
+	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	if err != nil {
+		return err
+	}
+	if userQuota < quota {
+		return errors.New("user quota is not enough for the summarization")
+	}
+	token, err := model.GetTokenById(meta.TokenId)
+	if err != nil {
+		return err
+	}
+	if !token.UnlimitedQuota && token.RemainQuota < quota {
+		return errors.New("token quota is not enough for the summarization")
+	}
+	return nil
+}
+
+func consumePromptCompressionQuota(ctx context.Context, meta *meta.Meta, usage *relaymodel.Usage, channelName string) {
+	modelRatio := billingratio.GetModelRatio(meta.ActualModelName)
+	groupRatio := billingratio.GetGroupRatio(meta.Group)
+	completionRatio := billingratio.GetCompletionRatio(meta.ActualModelName)
+	ratio := modelRatio * groupRatio
+	quota := int64(math.Ceil((float64(usage.PromptTokens) + float64(usage.CompletionTokens)*completionRatio) * ratio))
+	if ratio != 0 && quota <= 0 {
+		quota = 1
+	}
+	err := model.PostConsumeTokenQuota(meta.TokenId, quota)
+	if err != nil {
+		logger.Error(ctx, "error consuming token remain quota: "+err.Error())
+	}
+	err = model.CacheUpdateUserQuota(ctx, meta.UserId)
+	if err != nil {
+		logger.Error(ctx, "error update user quota cache: "+err.Error())
+	}
+	logContent := fmt.Sprintf("提示词压缩，模型倍率 %.2f，分组倍率 %.2f，补全倍率 %.2f", modelRatio, groupRatio, completionRatio)
+	model.RecordConsumeLog(ctx, meta.UserId, meta.ChannelId, usage.PromptTokens, usage.CompletionTokens, meta.ActualModelName, meta.TokenName, meta.TokenId, quota, logContent, channelName)
+	model.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
+	model.UpdateChannelUsedQuota(meta.ChannelId, quota)
+	monitor.RecordSpend(quota)
+}
@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/constant/role"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestSplitMessagesForCompression(t *testing.T) {
+	Convey("splitMessagesForCompression keeps the system messages and the last turns", t, func() {
+		messages := []relaymodel.Message{
+			{Role: role.System, Content: "be brief"},
+			{Role: role.User, Content: "1"},
+			{Role: role.Assistant, Content: "2"},
+			{Role: role.User, Content: "3"},
+			{Role: role.Assistant, Content: "4"},
+		}
+		head, middle, tail := splitMessagesForCompression(messages, 2)
+		So(head, ShouldResemble, messages[:1])
+		So(middle, ShouldResemble, messages[1:3])
+		So(tail, ShouldResemble, messages[3:])
+
+		_, middle, tail = splitMessagesForCompression(messages, 10)
+		So(middle, ShouldBeEmpty)
+		So(tail, ShouldResemble, messages[1:])
+	})
+}
+
+func TestPromptCompression(t *testing.T) {
+	Convey("PromptCompression", t, func() {
+		useTestDB(t)
+		oldEnabled, oldModel, oldKeep, oldApproximate := config.PromptCompressionEnabled, config.PromptCompressionModel,
+			config.PromptCompressionKeepMessages, config.ApproximateTokenEnabled
+		config.PromptCompressionEnabled, config.PromptCompressionModel = true, "gpt-3.5-turbo"
+		config.PromptCompressionKeepMessages = 1
+		// the token encoders aren't loaded in the tests
+		config.ApproximateTokenEnabled = true
+		config.PromptCompressionGroupThresholdLock.Lock()
+		oldThreshold := config.PromptCompressionGroupThreshold
+		config.PromptCompressionGroupThreshold = map[string]int{"default": 1}
+		config.PromptCompressionGroupThresholdLock.Unlock()
+		t.Cleanup(func() {
+			config.PromptCompressionEnabled, config.PromptCompressionModel = oldEnabled, oldModel
+			config.PromptCompressionKeepMessages, config.ApproximateTokenEnabled = oldKeep, oldApproximate
+			config.PromptCompressionGroupThresholdLock.Lock()
+			config.PromptCompressionGroupThreshold = oldThreshold
+			config.PromptCompressionGroupThresholdLock.Unlock()
+		})
+
+		failing := false
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if failing {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				_, _ = w.Write([]byte(`{"error":{"message":"the model is overloaded","type":"server_error"}}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"they said hello"},"finish_reason":"stop"}],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`))
+		}))
+		defer upstream.Close()
+		if client.HTTPClient == nil {
+			client.HTTPClient = http.DefaultClient
+		}
+		baseURL := upstream.URL
+		So((&model.Channel{Id: 1, Type: channeltype.OpenAI, Key: "sk-test", Status: model.ChannelStatusEnabled, Name: "openai",
+			BaseURL: &baseURL, Models: "gpt-3.5-turbo", Group: "default"}).Insert(), ShouldBeNil)
+		So(model.DB.Create(&model.User{Id: 1, Username: "user1", Quota: 1000000, Status: model.UserStatusEnabled,
+			AccessToken: "access1", AffCode: "aff1", Group: "default"}).Error, ShouldBeNil)
+		token := &model.Token{Id: 1, UserId: 1, Key: "key1", Status: model.TokenStatusEnabled, RemainQuota: 1000000, ExpiredTime: -1}
+		So(model.DB.Create(token).Error, ShouldBeNil)
+
+		newContext := func() *gin.Context {
+			c := newPostContext(1, "/v1/chat/completions", "", `{"model":"gpt-4o","temperature":0.5,"messages":[`+
+				`{"role":"user","content":"hello, my name is somebody"},{"role":"assistant","content":"hello"},{"role":"user","content":"what's my name?"}]}`)
+			c.Request.Header.Set(PromptCompressionHeader, "true")
+			c.Set(ctxkey.TokenId, 1)
+			c.Set(ctxkey.Group, "default")
+			return c
+		}
+
+		Convey("replaces the earlier turns with their summary and bills it", func() {
+			c := newContext()
+			PromptCompression()(c)
+			body, err := common.GetRequestBody(c)
+			So(err, ShouldBeNil)
+			var request relaymodel.GeneralOpenAIRequest
+			So(json.Unmarshal(body, &request), ShouldBeNil)
+			So(request.Messages, ShouldHaveLength, 2)
+			So(request.Messages[0].StringContent(), ShouldEqual, "Summary of the earlier conversation: they said hello")
+			So(request.Messages[1].StringContent(), ShouldEqual, "what's my name?")
+			So(request.Temperature, ShouldEqual, 0.5)
+
+			var current model.Token
+			for i := 0; i < 50; i++ {
+				So(model.DB.First(&current, 1).Error, ShouldBeNil)
+				if current.RemainQuota < 1000000 {
+					break
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+			So(current.RemainQuota, ShouldBeLessThan, 1000000)
+		})
+
+		Convey("relays the conversation as is if the token can't afford the summarization", func() {
+			So(model.DB.Model(token).Update("remain_quota", 1).Error, ShouldBeNil)
+			c := newContext()
+			PromptCompression()(c)
+			body, err := common.GetRequestBody(c)
+			So(err, ShouldBeNil)
+			var request relaymodel.GeneralOpenAIRequest
+			So(json.Unmarshal(body, &request), ShouldBeNil)
+			So(request.Messages, ShouldHaveLength, 3)
+		})
+
+		Convey("a failed summarization tells the error of the upstream", func() {
+			failing = true
+			_, err := summarizeMessages(newContext(), []relaymodel.Message{{Role: role.User, Content: "hello"}})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "503")
+			So(err.Error(), ShouldContainSubstring, "the model is overloaded")
+		})
+	})
+}
+
+func TestCheckPromptCompressionQuota(t *testing.T) {
+	Convey("checkPromptCompressionQuota", t, func() {
+		useTestDB(t)
+		So(model.DB.Create(&model.User{Id: 1, Username: "user1", Quota: 1000, Status: model.UserStatusEnabled,
+			AccessToken: "access1", AffCode: "aff1", Group: "default"}).Error, ShouldBeNil)
+		So(model.DB.Create(&model.Token{Id: 1, UserId: 1, Key: "limited", RemainQuota: 10}).Error, ShouldBeNil)
+		So(model.DB.Create(&model.Token{Id: 2, UserId: 1, Key: "unlimited", UnlimitedQuota: true}).Error, ShouldBeNil)
+		oldPreConsumedQuota := config.PreConsumedQuota
+		config.PreConsumedQuota = 0
+		t.Cleanup(func() {
+			config.PreConsumedQuota = oldPreConsumedQuota
+		})
+
+		paid := &meta.Meta{UserId: 1, TokenId: 1, Group: "default", ActualModelName: "gpt-3.5-turbo", PromptTokens: 100}
+		So(checkPromptCompressionQuota(context.Background(), paid), ShouldNotBeNil)
+		paid.TokenId = 2
+		So(checkPromptCompressionQuota(context.Background(), paid), ShouldBeNil)
+		paid.PromptTokens = 1000000
+		So(checkPromptCompressionQuota(context.Background(), paid), ShouldNotBeNil)
+	})
+}
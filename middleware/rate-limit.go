@@ -14,16 +14,13 @@ var timeFormat = "2006-01-02T15:04:05.000Z"
 
 var inMemoryRateLimiter common.InMemoryRateLimiter
 
-func redisRateLimiter(c *gin.Context, maxRequestNum int, duration int64, mark string) {
+// redisRequest records a request of the key, it's not allowed if maxRequestNum requests are made within duration
+func redisRequest(key string, maxRequestNum int, duration int64) (bool, error) {
 	ctx := context.Background()
 	rdb := common.RDB
-	key := "rateLimit:" + mark + c.ClientIP()
 	listLength, err := rdb.LLen(ctx, key).Result()
 	if err != nil {
-		fmt.Println(err.Error())
-		c.Status(http.StatusInternalServerError)
-		c.Abort()
-		return
+		return false, err
 	}
 	if listLength < int64(maxRequestNum) {
 		rdb.LPush(ctx, key, time.Now().Format(timeFormat))
@@ -32,32 +29,40 @@ func redisRateLimiter(c *gin.Context, maxRequestNum int, duration int64, mark st
 		oldTimeStr, _ := rdb.LIndex(ctx, key, -1).Result()
 		oldTime, err := time.Parse(timeFormat, oldTimeStr)
 		if err != nil {
-			fmt.Println(err)
-			c.Status(http.StatusInternalServerError)
-			c.Abort()
-			return
+			return false, err
 		}
 		nowTimeStr := time.Now().Format(timeFormat)
 		nowTime, err := time.Parse(timeFormat, nowTimeStr)
 		if err != nil {
-			fmt.Println(err)
-			c.Status(http.StatusInternalServerError)
-			c.Abort()
-			return
+			return false, err
 		}
 		// time.Since will return negative number!
 		// See: https://stackoverflow.com/questions/50970900/why-is-time-since-returning-negative-durations-on-windows
 		if int64(nowTime.Sub(oldTime).Seconds()) < duration {
 			rdb.Expire(ctx, key, config.RateLimitKeyExpirationDuration)
-			c.Status(http.StatusTooManyRequests)
-			c.Abort()
-			return
+			return false, nil
 		} else {
 			rdb.LPush(ctx, key, time.Now().Format(timeFormat))
 			rdb.LTrim(ctx, key, 0, int64(maxRequestNum-1))
 			rdb.Expire(ctx, key, config.RateLimitKeyExpirationDuration)
 		}
 	}
+	return true, nil
+}
+
+func redisRateLimiter(c *gin.Context, maxRequestNum int, duration int64, mark string) {
+	allowed, err := redisRequest("rateLimit:"+mark+c.ClientIP(), maxRequestNum, duration)
+	if err != nil {
+		fmt.Println(err.Error())
+		c.Status(http.StatusInternalServerError)
+		c.Abort()
+		return
+	}
+	if !allowed {
+		c.Status(http.StatusTooManyRequests)
+		c.Abort()
+		return
+	}
 }
 
 func memoryRateLimiter(c *gin.Context, maxRequestNum int, duration int64, mark string) {
@@ -69,6 +74,15 @@ func memoryRateLimiter(c *gin.Context, maxRequestNum int, duration int64, mark s
 	}
 }
 
+// requestAllowed is the rate limit of an arbitrary key instead of the client ip, shared by the instances if redis is enabled
+func requestAllowed(key string, maxRequestNum int, duration int64) (bool, error) {
+	if common.RedisEnabled {
+		return redisRequest("rateLimit:"+key, maxRequestNum, duration)
+	}
+	inMemoryRateLimiter.Init(config.RateLimitKeyExpirationDuration)
+	return inMemoryRateLimiter.Request(key, maxRequestNum, duration), nil
+}
+
 func rateLimitFactory(maxRequestNum int, duration int64, mark string) func(c *gin.Context) {
 	if common.RedisEnabled {
 		return func(c *gin.Context) {
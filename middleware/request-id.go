@@ -2,13 +2,18 @@ package middleware
 
 import (
 	"context"
+
 	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
 )
 
 func RequestId() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		id := helper.GenRequestID()
+		id := c.GetHeader(helper.RequestIdKey)
+		if !config.AcceptRequestId || !isValidRequestId(id) {
+			id = helper.GenRequestID()
+		}
 		c.Set(helper.RequestIdKey, id)
 		ctx := context.WithValue(c.Request.Context(), helper.RequestIdKey, id)
 		c.Request = c.Request.WithContext(ctx)
@@ -16,3 +21,16 @@ func RequestId() func(c *gin.Context) {
 		c.Next()
 	}
 }
+
+// isValidRequestId only lets through ids of letters, digits, - and _, so that they can't mess up the logs
+func isValidRequestId(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, r := range id {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && r != '-' && r != '_' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// the quota used today by a sandbox user is summed from the logs at most once in this many seconds on each node,
+// the user may go over the daily quota by what's used meanwhile
+const sandboxUsedQuotaCacheSeconds = 30
+
+type sandboxUsedQuota struct {
+	since     int64
+	quota     int64
+	fetchedAt int64
+}
+
+var sandboxUsedQuotas = make(map[int]sandboxUsedQuota)
+var sandboxUsedQuotasLock sync.Mutex
+
+func getSandboxUsedQuota(userId int, since int64) int64 {
+	now := helper.GetTimestamp()
+	sandboxUsedQuotasLock.Lock()
+	usedQuota, ok := sandboxUsedQuotas[userId]
+	sandboxUsedQuotasLock.Unlock()
+	if ok && usedQuota.since == since && now-usedQuota.fetchedAt < sandboxUsedQuotaCacheSeconds {
+		return usedQuota.quota
+	}
+	usedQuota = sandboxUsedQuota{
+		since:     since,
+		quota:     model.SumUserUsedQuotaSince(userId, since),
+		fetchedAt: now,
+	}
+	sandboxUsedQuotasLock.Lock()
+	sandboxUsedQuotas[userId] = usedQuota
+	sandboxUsedQuotasLock.Unlock()
+	return usedQuota.quota
+}
+
+// Sandbox limits the requests of the users in the sandbox group, the group is the one set by the distributor if any
+func Sandbox() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		userId := c.GetInt(ctxkey.Id)
+		group := c.GetString(ctxkey.Group)
+		if group == "" {
+			group, _ = model.CacheGetUserGroup(userId)
+		}
+		if group != config.SandboxGroup {
+			c.Next()
+			return
+		}
+		if config.SandboxRequestRateLimit > 0 {
+			allowed, err := requestAllowed("SB"+strconv.Itoa(userId), config.SandboxRequestRateLimit, 60)
+			if err != nil {
+				// a broken redis shouldn't stop the service
+				logger.SysError("failed to check the sandbox rate limit: " + err.Error())
+			} else if !allowed {
+				abortWithMessage(c, http.StatusTooManyRequests, fmt.Sprintf("试用分组每分钟最多请求 %d 次，请稍后再试", config.SandboxRequestRateLimit))
+				return
+			}
+		}
+		if config.SandboxDailyQuota > 0 {
+			now := time.Now()
+			startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).Unix()
+			if getSandboxUsedQuota(userId, startOfDay) >= config.SandboxDailyQuota {
+				abortWithMessage(c, http.StatusTooManyRequests, "试用分组今日额度已用完，请明天再试")
+				return
+			}
+		}
+		c.Next()
+	}
+}
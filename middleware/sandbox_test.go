@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func TestSandbox(t *testing.T) {
+	Convey("Sandbox", t, func() {
+		useTestDB(t)
+		sandboxUsedQuotas = make(map[int]sandboxUsedQuota)
+		oldRateLimit, oldDailyQuota := config.SandboxRequestRateLimit, config.SandboxDailyQuota
+		config.SandboxRequestRateLimit, config.SandboxDailyQuota = 0, 100
+		t.Cleanup(func() {
+			config.SandboxRequestRateLimit, config.SandboxDailyQuota = oldRateLimit, oldDailyQuota
+		})
+		for id, group := range map[int]string{101: config.SandboxGroup, 102: "default"} {
+			So(model.DB.Create(&model.User{
+				Id:          id,
+				Username:    fmt.Sprintf("user%d", id),
+				Status:      model.UserStatusEnabled,
+				Group:       group,
+				AccessToken: fmt.Sprintf("access%d", id),
+				AffCode:     fmt.Sprintf("aff%d", id),
+			}).Error, ShouldBeNil)
+			So(model.LOG_DB.Create(&model.Log{UserId: id, Type: model.LogTypeConsume, Quota: 100, CreatedAt: helper.GetTimestamp()}).Error, ShouldBeNil)
+		}
+
+		Convey("finds the group of the user without a distributor", func() {
+			c := newPostContext(101, "/v1/files", "", `{}`)
+			Sandbox()(c)
+			So(c.IsAborted(), ShouldBeTrue)
+			So(c.Writer.Status(), ShouldEqual, http.StatusTooManyRequests)
+		})
+
+		Convey("lets the other groups through", func() {
+			c := newPostContext(102, "/v1/files", "", `{}`)
+			Sandbox()(c)
+			So(c.IsAborted(), ShouldBeFalse)
+		})
+
+		Convey("caches the quota used today", func() {
+			since := helper.GetTimestamp() - 60
+			So(getSandboxUsedQuota(102, since), ShouldEqual, 100)
+			So(model.LOG_DB.Create(&model.Log{UserId: 102, Type: model.LogTypeConsume, Quota: 50, CreatedAt: helper.GetTimestamp()}).Error, ShouldBeNil)
+			So(getSandboxUsedQuota(102, since), ShouldEqual, 100)
+			So(getSandboxUsedQuota(102, since-1), ShouldEqual, 150)
+		})
+	})
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"encoding/json"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/trace"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// SlowRequestCapture traces relay requests and saves those slower than the threshold,
+// it should be the first middleware after panic recovery so that the whole request is measured
+func SlowRequestCapture() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if config.SlowRequestThreshold <= 0 {
+			c.Next()
+			return
+		}
+		t := trace.Start(c)
+		c.Next()
+		elapsed := t.Elapsed()
+		if elapsed.Milliseconds() < int64(config.SlowRequestThreshold) {
+			return
+		}
+		phases, _ := json.Marshal(t.Phases())
+		slowRequest := &model.SlowRequest{
+			RequestId:  c.GetString(helper.RequestIdKey),
+			UserId:     c.GetInt(ctxkey.Id),
+			TokenName:  c.GetString(ctxkey.TokenName),
+			ChannelId:  c.GetInt(ctxkey.ChannelId),
+			ModelName:  c.GetString(ctxkey.OriginalModel),
+			Path:       c.Request.URL.Path,
+			StatusCode: c.Writer.Status(),
+			Duration:   elapsed.Milliseconds(),
+			Phases:     string(phases),
+		}
+		if config.SlowRequestBodyCaptureEnabled {
+			requestBody, err := common.GetRequestBody(c)
+			if err == nil {
+				slowRequest.RequestBody = common.TruncateBody(requestBody, config.SlowRequestBodyMaxBytes)
+			}
+		}
+		go model.RecordSlowRequest(c.Request.Context(), slowRequest)
+	}
+}
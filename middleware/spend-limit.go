@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/monitor"
+)
+
+// SpendLimit rejects the requests of the billed relay routes while the deployment is spending faster than
+// GlobalSpendRateLimit
+func SpendLimit() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if monitor.SpendAllowed() {
+			c.Next()
+			return
+		}
+		message := "The service is spending faster than its limit, please try again later."
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": gin.H{
+				"message": helper.MessageWithRequestId(message, c.GetString(helper.RequestIdKey)),
+				"type":    "one_api_error",
+				"code":    "spend_rate_limit_exceeded",
+			},
+		})
+		c.Abort()
+		logger.Error(c.Request.Context(), message)
+	}
+}
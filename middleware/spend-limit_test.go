@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/monitor"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestSpendLimit(t *testing.T) {
+	Convey("SpendLimit", t, func() {
+		useTestDB(t)
+		oldLimit := config.GlobalSpendRateLimit
+		t.Cleanup(func() {
+			config.GlobalSpendRateLimit = oldLimit
+		})
+
+		Convey("lets the requests through without a limit", func() {
+			config.GlobalSpendRateLimit = 0
+			c := newPostContext(1, "/v1/files", "", `{}`)
+			SpendLimit()(c)
+			So(c.IsAborted(), ShouldBeFalse)
+		})
+
+		Convey("rejects the requests once the limit is spent", func() {
+			config.GlobalSpendRateLimit = 1000
+			monitor.RecordSpend(2000)
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(http.MethodPost, "/mj/submit/imagine", nil)
+			SpendLimit()(c)
+			So(c.IsAborted(), ShouldBeTrue)
+			So(recorder.Code, ShouldEqual, http.StatusServiceUnavailable)
+			var response struct {
+				Error model.Error `json:"error"`
+			}
+			So(json.Unmarshal(recorder.Body.Bytes(), &response), ShouldBeNil)
+			So(response.Error.Code, ShouldEqual, "spend_rate_limit_exceeded")
+		})
+	})
+}
@@ -1,11 +1,22 @@
 package middleware
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/midjourney"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/modelname"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"strings"
 )
 
@@ -22,9 +33,23 @@ func abortWithMessage(c *gin.Context, statusCode int, message string) {
 
 func getRequestModel(c *gin.Context) (string, error) {
 	var modelRequest ModelRequest
-	err := common.UnmarshalBodyReusable(c, &modelRequest)
+	if strings.HasPrefix(c.Request.URL.Path, "/mj/submit/") {
+		// the action is billed as the model
+		return getMidjourneyModel(c)
+	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/images/edits") || strings.HasPrefix(c.Request.URL.Path, "/v1/images/variations") {
+		return getMultipartModel(c, 0, "dall-e-2")
+	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/audio/transcriptions") || strings.HasPrefix(c.Request.URL.Path, "/v1/audio/translations") {
+		return getMultipartModel(c, int64(config.AudioMaxUploadBytes), "whisper-1")
+	}
+	if c.Request.Method == http.MethodPost && c.Request.URL.Path == "/v1/files" {
+		// the uploads have no model, they're spooled for the size to be checked against the storage quota
+		return "", common.SpoolRequestBody(c, int64(config.FileMaxUploadBytes))
+	}
+	err := common.PeekBodyReusable(c, map[string]any{"model": &modelRequest.Model})
 	if err != nil {
-		return "", fmt.Errorf("common.UnmarshalBodyReusable failed: %w", err)
+		return "", fmt.Errorf("common.PeekBodyReusable failed: %w", err)
 	}
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/moderations") {
 		if modelRequest.Model == "" {
@@ -41,14 +66,123 @@ func getRequestModel(c *gin.Context) (string, error) {
 			modelRequest.Model = "dall-e-2"
 		}
 	}
-	if strings.HasPrefix(c.Request.URL.Path, "/v1/audio/transcriptions") || strings.HasPrefix(c.Request.URL.Path, "/v1/audio/translations") {
+	if c.Request.Method == http.MethodGet && modelRequest.Model == "" {
+		// the GET requests relayed as they are, e.g. /v1/models/:model
+		modelRequest.Model = c.Param("model")
 		if modelRequest.Model == "" {
-			modelRequest.Model = "whisper-1"
+			modelRequest.Model = c.Query("model")
 		}
 	}
 	return modelRequest.Model, nil
 }
 
+func getMidjourneyModel(c *gin.Context) (string, error) {
+	if strings.HasSuffix(c.Request.URL.Path, "/imagine") {
+		return midjourney.ModelOf(midjourney.ActionImagine), nil
+	}
+	var action string
+	err := common.PeekBodyReusable(c, map[string]any{"action": &action})
+	if err != nil {
+		return "", fmt.Errorf("common.PeekBodyReusable failed: %w", err)
+	}
+	if action == "" {
+		return "", errors.New("action is required")
+	}
+	return midjourney.ModelOf(action), nil
+}
+
+// maxUploadBytes is the limit of the body spooled for the request
+func maxUploadBytes(c *gin.Context) int {
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/files") {
+		return config.FileMaxUploadBytes
+	}
+	return config.AudioMaxUploadBytes
+}
+
+// getMultipartModel spools the uploaded files, e.g. the images to edit or the audio to transcribe,
+// instead of reading them into the memory
+func getMultipartModel(c *gin.Context, maxBytes int64, defaultModel string) (string, error) {
+	err := common.SpoolRequestBody(c, maxBytes)
+	if err != nil {
+		return "", fmt.Errorf("common.SpoolRequestBody failed: %w", err)
+	}
+	fields, err := common.PeekMultipartFields(c)
+	if err != nil {
+		return defaultModel, fmt.Errorf("common.PeekMultipartFields failed: %w", err)
+	}
+	if fields["model"] == "" {
+		return defaultModel, nil
+	}
+	return fields["model"], nil
+}
+
+// normalizeRequestModel fixes casing, typos and unknown date suffixes of the requested model,
+// models which are available for the user's group take precedence over the known ones
+func normalizeRequestModel(c *gin.Context, userId int, modelName string) string {
+	ctx := c.Request.Context()
+	var groupModels []string
+	group, err := model.CacheGetUserGroup(userId)
+	if err == nil {
+		groupModels, _ = model.CacheGetGroupModels(ctx, group)
+	}
+	normalizedModelName := modelname.NormalizeWith(modelName, modelname.NewLookup(groupModels), billingratio.KnownModels())
+	if normalizedModelName == modelName {
+		return modelName
+	}
+	err = setRequestModel(c, normalizedModelName)
+	if err != nil {
+		logger.Warnf(ctx, "failed to normalize model %s: %s", modelName, err.Error())
+		return modelName
+	}
+	logger.Infof(ctx, "model %s normalized to %s", modelName, normalizedModelName)
+	return normalizedModelName
+}
+
+// setRequestModel rewrites the model field of a JSON request body
+func setRequestModel(c *gin.Context, modelName string) error {
+	if !strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") {
+		return errors.New("only JSON request body is supported")
+	}
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return err
+	}
+	var request map[string]json.RawMessage
+	err = json.Unmarshal(requestBody, &request)
+	if err != nil {
+		return err
+	}
+	request["model"], err = json.Marshal(modelName)
+	if err != nil {
+		return err
+	}
+	requestBody, err = json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	common.SetRequestBody(c, requestBody)
+	return nil
+}
+
+// newInternalRelayContext is the context of a request the relay sends on behalf of the user, e.g. to summarize
+// or to moderate the request of the user, the response is recorded instead of sent to the user
+func newInternalRelayContext(c *gin.Context, channel *model.Channel, modelName string, path string) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	subCtx, _ := gin.CreateTestContext(w)
+	subCtx.Request = (&http.Request{
+		Method: http.MethodPost,
+		URL:    &url.URL{Path: path},
+		Header: make(http.Header),
+	}).WithContext(c.Request.Context())
+	subCtx.Request.Header.Set("Content-Type", "application/json")
+	subCtx.Set(ctxkey.Id, c.GetInt(ctxkey.Id))
+	subCtx.Set(ctxkey.TokenId, c.GetInt(ctxkey.TokenId))
+	subCtx.Set(ctxkey.TokenName, c.GetString(ctxkey.TokenName))
+	subCtx.Set(ctxkey.Group, c.GetString(ctxkey.Group))
+	SetupContextForSelectedChannel(subCtx, channel, modelName)
+	return subCtx, w
+}
+
 func isModelInList(modelName string, models string) bool {
 	modelList := strings.Split(models, ",")
 	for _, model := range modelList {
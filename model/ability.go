@@ -2,10 +2,12 @@ package model
 
 import (
 	"context"
+	"errors"
 	"github.com/songquanpeng/one-api/common"
 	"gorm.io/gorm"
 	"sort"
 	"strings"
+	"time"
 )
 
 type Ability struct {
@@ -44,7 +46,77 @@ func GetRandomSatisfiedChannel(group string, model string, ignoreFirstPriority b
 	channel := Channel{}
 	channel.Id = ability.ChannelId
 	err = DB.First(&channel, "id = ?", ability.ChannelId).Error
-	return &channel, err
+	if err != nil {
+		return &channel, err
+	}
+	channel.loadSchedule()
+	if !channel.isScheduledAt(time.Now()) {
+		return getScheduledChannel(group, model, ignoreFirstPriority)
+	}
+	return &channel, nil
+}
+
+// getScheduledChannel is the slow path of GetRandomSatisfiedChannel, it loads every candidate to check their schedules
+func getScheduledChannel(group string, model string, ignoreFirstPriority bool) (*Channel, error) {
+	groupCol := "`group`"
+	trueVal := "1"
+	if common.UsingPostgreSQL {
+		groupCol = `"group"`
+		trueVal = "true"
+	}
+	var channelIds []int
+	err := DB.Model(&Ability{}).Where(groupCol+" = ? and model = ? and enabled = "+trueVal, group, model).Pluck("channel_id", &channelIds).Error
+	if err != nil {
+		return nil, err
+	}
+	var channels []*Channel
+	err = DB.Where("id IN ?", channelIds).Find(&channels).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(channels) == 0 {
+		return nil, errors.New("channel not found")
+	}
+	for _, channel := range channels {
+		channel.loadSchedule()
+	}
+	sort.SliceStable(channels, func(i, j int) bool {
+		return channels[i].GetPriority() > channels[j].GetPriority()
+	})
+	now := time.Now()
+	return pickChannel(filterThrottledChannels(filterScheduledChannels(channels, now), now), ignoreFirstPriority), nil
+}
+
+// GetRandomChannelOfType picks an enabled channel of the type in the group whatever models it has,
+// for the requests without a model, e.g. listing the fine-tuning jobs
+func GetRandomChannelOfType(group string, channelType int) (*Channel, error) {
+	groupCol := "`group`"
+	trueVal := "1"
+	if common.UsingPostgreSQL {
+		groupCol = `"group"`
+		trueVal = "true"
+	}
+	var channelIds []int
+	err := DB.Model(&Ability{}).Where(groupCol+" = ? and enabled = "+trueVal, group).Distinct("channel_id").Pluck("channel_id", &channelIds).Error
+	if err != nil {
+		return nil, err
+	}
+	var channels []*Channel
+	err = DB.Where("id IN ? AND type = ?", channelIds, channelType).Find(&channels).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(channels) == 0 {
+		return nil, errors.New("channel not found")
+	}
+	for _, channel := range channels {
+		channel.loadSchedule()
+	}
+	sort.SliceStable(channels, func(i, j int) bool {
+		return channels[i].GetPriority() > channels[j].GetPriority()
+	})
+	now := time.Now()
+	return pickChannel(filterThrottledChannels(filterScheduledChannels(channels, now), now), false), nil
 }
 
 func (channel *Channel) AddAbilities() error {
@@ -106,3 +178,21 @@ func GetGroupModels(ctx context.Context, group string) ([]string, error) {
 	sort.Strings(models)
 	return models, err
 }
+
+type ModelChannelStatus struct {
+	Model     string `json:"model"`
+	ChannelId int    `json:"channel_id"`
+	Status    int    `json:"status"`
+}
+
+// GetGroupModelChannelStatuses returns the status of every channel serving each model of the group
+func GetGroupModelChannelStatuses(group string) (statuses []*ModelChannelStatus, err error) {
+	groupCol := "`group`"
+	if common.UsingPostgreSQL {
+		groupCol = `"group"`
+	}
+	err = DB.Table("abilities").Select("abilities.model, abilities.channel_id, channels.status").
+		Joins("JOIN channels ON channels.id = abilities.channel_id").
+		Where("abilities."+groupCol+" = ?", group).Order("abilities.model").Scan(&statuses).Error
+	return statuses, err
+}
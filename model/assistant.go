@@ -0,0 +1,109 @@
+package model
+
+import "gorm.io/gorm/clause"
+
+const (
+	AssistantObjectAssistant = "assistant"
+	AssistantObjectThread    = "thread"
+)
+
+// the statuses of the runs after which they don't change any more
+var AssistantRunFinalStatuses = []string{"completed", "failed", "cancelled", "expired", "incomplete"}
+
+// AssistantObject is an assistant or a thread created through the relay, it belongs to the account of the key
+// it's created with, so the later requests about it are routed to the same channel and key
+type AssistantObject struct {
+	Id        int    `json:"id"`
+	ObjectId  string `json:"object_id" gorm:"type:varchar(64);uniqueIndex"` // the id on the upstream, like asst_xxx
+	Object    string `json:"object"`
+	Model     string `json:"model" gorm:"default:''"` // of the assistants, their runs are estimated by it
+	UserId    int    `json:"user_id" gorm:"index"`
+	ChannelId int    `json:"channel_id"`
+	KeyIndex  int    `json:"key_index"` // -1 if the channel has only one key
+	CreatedAt int64  `json:"created_at" gorm:"bigint"`
+}
+
+// AssistantRun is a run of a thread, polled until it's finished, and billed once by the usage of its steps
+type AssistantRun struct {
+	Id               int    `json:"id"`
+	RunId            string `json:"run_id" gorm:"type:varchar(64);uniqueIndex"`
+	ThreadId         string `json:"thread_id"`
+	UserId           int    `json:"user_id" gorm:"index"`
+	TokenId          int    `json:"token_id"`
+	TokenName        string `json:"token_name" gorm:"default:''"`
+	ChannelId        int    `json:"channel_id"`
+	KeyIndex         int    `json:"key_index"`
+	Group            string `json:"group" gorm:"type:varchar(32)"`
+	ModelName        string `json:"model_name"`
+	Status           string `json:"status" gorm:"index"`
+	CreatedAt        int64  `json:"created_at" gorm:"bigint"`
+	FinishTime       int64  `json:"finish_time" gorm:"bigint"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	Quota            int64  `json:"quota" gorm:"bigint;default:0"`
+	PreConsumedQuota int64  `json:"pre_consumed_quota" gorm:"bigint;default:0"` // consumed when the run is created
+}
+
+// InsertAssistantObject saves the object unless it has been saved, e.g. when it's returned again,
+// only the model of a saved assistant is updated
+func InsertAssistantObject(object *AssistantObject) error {
+	return DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "object_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"model"}),
+	}).Create(object).Error
+}
+
+func GetAssistantObject(userId int, objectId string) (*AssistantObject, error) {
+	object := AssistantObject{}
+	err := DB.First(&object, "user_id = ? AND object_id = ?", userId, objectId).Error
+	return &object, err
+}
+
+// GetAssistantObjectIds returns which of the ids are the objects of the user
+func GetAssistantObjectIds(userId int, objectIds []string) (map[string]bool, error) {
+	var ids []string
+	err := DB.Model(&AssistantObject{}).Where("user_id = ? AND object_id IN ?", userId, objectIds).Pluck("object_id", &ids).Error
+	owned := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		owned[id] = true
+	}
+	return owned, err
+}
+
+func DeleteAssistantObject(userId int, objectId string) error {
+	return DB.Where("user_id = ? AND object_id = ?", userId, objectId).Delete(&AssistantObject{}).Error
+}
+
+// InsertAssistantRun saves the run unless it has been saved, the runs are returned by every poll of the client,
+// it returns whether the run is new
+func InsertAssistantRun(run *AssistantRun) (bool, error) {
+	result := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(run)
+	return result.RowsAffected > 0, result.Error
+}
+
+func GetAssistantRunByRunId(runId string) (*AssistantRun, error) {
+	run := AssistantRun{}
+	err := DB.First(&run, "run_id = ?", runId).Error
+	return &run, err
+}
+
+func GetUnfinishedAssistantRuns() (runs []*AssistantRun, err error) {
+	err = DB.Where("status NOT IN ?", AssistantRunFinalStatuses).Find(&runs).Error
+	return runs, err
+}
+
+// Finish saves the final status and the usage of an unfinished run, it returns false if the run has been finished already,
+// so that a run is billed once even if it's settled by more than one request or node
+func (run *AssistantRun) Finish() (bool, error) {
+	result := DB.Model(&AssistantRun{}).
+		Where("id = ? AND status NOT IN ?", run.Id, AssistantRunFinalStatuses).
+		Select("model_name", "status", "finish_time", "prompt_tokens", "completion_tokens", "quota").
+		Updates(run)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (run *AssistantRun) UpdateStatus() error {
+	return DB.Model(&AssistantRun{}).
+		Where("id = ? AND status NOT IN ?", run.Id, AssistantRunFinalStatuses).
+		Update("status", run.Status).Error
+}
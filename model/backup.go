@@ -0,0 +1,37 @@
+package model
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/songquanpeng/one-api/common"
+)
+
+// BackupSQLite writes a consistent snapshot of the SQLite database to a new file at path, while it's in use.
+// Only the main database is included, the logs are left out if they're in a database of their own.
+func BackupSQLite(path string) error {
+	if !common.UsingSQLite {
+		return errors.New("the database is not SQLite")
+	}
+	return DB.Exec("VACUUM INTO ?", path).Error
+}
+
+// CreateSQLiteBackup backs up the SQLite database in a temporary directory,
+// the returned function removes it once it's not needed anymore
+func CreateSQLiteBackup() (string, func(), error) {
+	dir, err := os.MkdirTemp("", "one-api-backup-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() {
+		_ = os.RemoveAll(dir)
+	}
+	path := filepath.Join(dir, "one-api.db")
+	err = BackupSQLite(path)
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return path, cleanup, nil
+}
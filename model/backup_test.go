@@ -0,0 +1,50 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestCreateSQLiteBackup(t *testing.T) {
+	Convey("CreateSQLiteBackup snapshots the database in use", t, func() {
+		useTestDB(t)
+		createTestUser(t, 1, 100)
+		path, cleanup, err := CreateSQLiteBackup()
+		So(err, ShouldBeNil)
+
+		backup, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+		So(err, ShouldBeNil)
+		var user User
+		So(backup.First(&user, 1).Error, ShouldBeNil)
+		So(user.Quota, ShouldEqual, 100)
+		So(closeDB(backup), ShouldBeNil)
+
+		cleanup()
+		_, err = os.Stat(filepath.Dir(path))
+		So(os.IsNotExist(err), ShouldBeTrue)
+	})
+}
+
+func TestSQLiteJournalMode(t *testing.T) {
+	Convey("the journal mode of SQLite can be set", t, func() {
+		oldJournalMode := common.SQLiteJournalMode
+		common.SQLiteJournalMode = "WAL"
+		t.Cleanup(func() {
+			common.SQLiteJournalMode = oldJournalMode
+		})
+		useTestDB(t)
+		var journalMode string
+		So(DB.Raw("PRAGMA journal_mode").Scan(&journalMode).Error, ShouldBeNil)
+		So(journalMode, ShouldEqual, "wal")
+		var synchronous int
+		So(DB.Raw("PRAGMA synchronous").Scan(&synchronous).Error, ShouldBeNil)
+		// NORMAL
+		So(synchronous, ShouldEqual, 1)
+	})
+}
@@ -55,6 +55,19 @@ func CacheGetTokenByKey(key string) (*Token, error) {
 	return &token, err
 }
 
+// CacheUpdateToken reloads the cached token, e.g. after its remain quota is changed other than by a request
+func CacheUpdateToken(key string) error {
+	if !common.RedisEnabled {
+		return nil
+	}
+	err := common.RedisDel(fmt.Sprintf("token:%s", key))
+	if err != nil {
+		return err
+	}
+	_, err = CacheGetTokenByKey(key)
+	return err
+}
+
 func CacheGetUserGroup(id int) (group string, err error) {
 	if !common.RedisEnabled {
 		return GetUserGroup(id)
@@ -175,6 +188,7 @@ func InitChannelCache() {
 	var channels []*Channel
 	DB.Where("status = ?", ChannelStatusEnabled).Find(&channels)
 	for _, channel := range channels {
+		channel.loadSchedule()
 		newChannelId2channel[channel.Id] = channel
 	}
 	var abilities []*Ability
@@ -234,6 +248,43 @@ func CacheGetRandomSatisfiedChannel(group string, model string, ignoreFirstPrior
 	if len(channels) == 0 {
 		return nil, errors.New("channel not found")
 	}
+	now := time.Now()
+	return pickChannel(filterThrottledChannels(filterScheduledChannels(channels, now), now), ignoreFirstPriority), nil
+}
+
+func CacheGetRandomChannelOfType(group string, channelType int) (*Channel, error) {
+	if !config.MemoryCacheEnabled {
+		return GetRandomChannelOfType(group, channelType)
+	}
+	channelSyncLock.RLock()
+	defer channelSyncLock.RUnlock()
+	seen := make(map[int]bool)
+	var channels []*Channel
+	for _, modelChannels := range group2model2channels[group] {
+		for _, channel := range modelChannels {
+			if channel.Type == channelType && !seen[channel.Id] {
+				seen[channel.Id] = true
+				channels = append(channels, channel)
+			}
+		}
+	}
+	if len(channels) == 0 {
+		return nil, errors.New("channel not found")
+	}
+	sort.SliceStable(channels, func(i, j int) bool {
+		if channels[i].GetPriority() != channels[j].GetPriority() {
+			return channels[i].GetPriority() > channels[j].GetPriority()
+		}
+		// the order of the map isn't stable
+		return channels[i].Id < channels[j].Id
+	})
+	now := time.Now()
+	return pickChannel(filterThrottledChannels(filterScheduledChannels(channels, now), now), false), nil
+}
+
+// pickChannel chooses randomly among the channels of the highest priority, or of the lower ones
+// if ignoreFirstPriority, the channels must be sorted by priority
+func pickChannel(channels []*Channel, ignoreFirstPriority bool) *Channel {
 	endIdx := len(channels)
 	// choose by priority
 	firstChannel := channels[0]
@@ -251,5 +302,5 @@ func CacheGetRandomSatisfiedChannel(group string, model string, ignoreFirstPrior
 			idx = random.RandRange(endIdx, len(channels))
 		}
 	}
-	return channels[idx], nil
+	return channels[idx]
 }
@@ -0,0 +1,38 @@
+package model
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestChannelKeyReference(t *testing.T) {
+	useTestDB(t)
+	Convey("a key reference which can't be resolved isn't used as the key", t, func() {
+		// the default store keeps the keys in the database, it can't resolve a reference of vault
+		channel := &Channel{Id: 1, Key: "vault:one-api/channels/missing", Status: ChannelStatusEnabled}
+		So(DB.Create(channel).Error, ShouldBeNil)
+
+		found, err := GetChannelById(1, true)
+		So(err, ShouldBeNil)
+		So(found.Key, ShouldEqual, "")
+		So(found.KeyError(), ShouldNotBeNil)
+
+		keys, err := getStoredKeys(DB.Where("id = ?", 1))
+		So(err, ShouldBeNil)
+		So(keys, ShouldResemble, []string{"vault:one-api/channels/missing"})
+
+		// the channel is deleted even if its key can't be removed from the secret store
+		So((&Channel{Id: 1}).Delete(), ShouldBeNil)
+		_, err = GetChannelById(1, true)
+		So(err, ShouldNotBeNil)
+	})
+	Convey("a key in the database is resolved as is", t, func() {
+		channel := &Channel{Id: 2, Key: "sk-test", Status: ChannelStatusEnabled}
+		So(channel.Insert(), ShouldBeNil)
+		found, err := GetChannelById(2, true)
+		So(err, ShouldBeNil)
+		So(found.Key, ShouldEqual, "sk-test")
+		So(found.KeyError(), ShouldBeNil)
+	})
+}
@@ -0,0 +1,77 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RetryPolicy overrides the retry options for the failures of a channel, zero values use the global options
+type RetryPolicy struct {
+	MaxAttempts int     `json:"max_attempts,omitempty"` // retries after the first attempt, only if it's sent to the channel
+	BaseDelay   int     `json:"base_delay,omitempty"`   // milliseconds
+	MaxDelay    int     `json:"max_delay,omitempty"`    // milliseconds
+	Jitter      float64 `json:"jitter,omitempty"`       // the fraction of the delay taken off at random, 0 to 1
+	StatusCodes string  `json:"status_codes,omitempty"` // e.g. 429,500-599
+}
+
+// StatusCodeRange is an inclusive range of status codes
+type StatusCodeRange struct {
+	From int
+	To   int
+}
+
+// ParseStatusCodes parses a comma separated list of status codes and ranges, e.g. 429,500-599
+func ParseStatusCodes(codes string) ([]StatusCodeRange, error) {
+	var ranges []StatusCodeRange
+	for _, item := range strings.Split(codes, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(item, "-")
+		codeRange := StatusCodeRange{}
+		var err error
+		codeRange.From, err = strconv.Atoi(strings.TrimSpace(from))
+		if err != nil {
+			return nil, fmt.Errorf("invalid status code %q", item)
+		}
+		codeRange.To = codeRange.From
+		if isRange {
+			codeRange.To, err = strconv.Atoi(strings.TrimSpace(to))
+			if err != nil {
+				return nil, fmt.Errorf("invalid status code %q", item)
+			}
+		}
+		if codeRange.From < 100 || codeRange.To > 599 || codeRange.From > codeRange.To {
+			return nil, fmt.Errorf("invalid status code %q", item)
+		}
+		ranges = append(ranges, codeRange)
+	}
+	return ranges, nil
+}
+
+// MatchStatusCode tells if the status code is in the ranges
+func MatchStatusCode(ranges []StatusCodeRange, statusCode int) bool {
+	for _, codeRange := range ranges {
+		if statusCode >= codeRange.From && statusCode <= codeRange.To {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateRetryPolicy checks the retry options of a channel, nil is valid
+func ValidateRetryPolicy(policy *RetryPolicy) error {
+	if policy == nil {
+		return nil
+	}
+	if policy.MaxAttempts < 0 || policy.BaseDelay < 0 || policy.MaxDelay < 0 {
+		return fmt.Errorf("max_attempts, base_delay and max_delay can't be negative")
+	}
+	if policy.Jitter < 0 || policy.Jitter > 1 {
+		return fmt.Errorf("jitter should be between 0 and 1")
+	}
+	_, err := ParseStatusCodes(policy.StatusCodes)
+	return err
+}
@@ -0,0 +1,26 @@
+package model
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseStatusCodes(t *testing.T) {
+	Convey("ParseStatusCodes", t, func() {
+		ranges, err := ParseStatusCodes("429, 500-599,408")
+		So(err, ShouldBeNil)
+		So(ranges, ShouldResemble, []StatusCodeRange{{429, 429}, {500, 599}, {408, 408}})
+		So(MatchStatusCode(ranges, 503), ShouldBeTrue)
+		So(MatchStatusCode(ranges, 400), ShouldBeFalse)
+
+		ranges, err = ParseStatusCodes("")
+		So(err, ShouldBeNil)
+		So(ranges, ShouldBeEmpty)
+
+		_, err = ParseStatusCodes("5xx")
+		So(err, ShouldNotBeNil)
+		_, err = ParseStatusCodes("599-500")
+		So(err, ShouldNotBeNil)
+	})
+}
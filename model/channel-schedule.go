@@ -0,0 +1,126 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// ScheduleWindow is a time of day, on some weekdays, in which a channel takes requests, in the local time zone
+type ScheduleWindow struct {
+	Weekdays []int  `json:"weekdays,omitempty"` // 0 is Sunday, empty means every day
+	Start    string `json:"start"`              // HH:MM, inclusive
+	End      string `json:"end"`                // HH:MM, exclusive, earlier than start for windows across midnight
+	start    int
+	end      int
+}
+
+func parseClock(clock string) (int, error) {
+	var hour, minute int
+	_, err := fmt.Sscanf(clock, "%d:%d", &hour, &minute)
+	if err != nil || hour < 0 || hour > 24 || minute < 0 || minute > 59 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("invalid time %q, should be HH:MM", clock)
+	}
+	return hour*60 + minute, nil
+}
+
+// ParseSchedule checks the windows and prepares them for matching
+func ParseSchedule(windows []ScheduleWindow) error {
+	for i := range windows {
+		var err error
+		windows[i].start, err = parseClock(windows[i].Start)
+		if err != nil {
+			return err
+		}
+		windows[i].end, err = parseClock(windows[i].End)
+		if err != nil {
+			return err
+		}
+		if windows[i].start == windows[i].end {
+			return fmt.Errorf("window %s-%s is empty", windows[i].Start, windows[i].End)
+		}
+		for _, weekday := range windows[i].Weekdays {
+			if weekday < 0 || weekday > 6 {
+				return fmt.Errorf("invalid weekday %d, should be 0 (Sunday) to 6", weekday)
+			}
+		}
+	}
+	return nil
+}
+
+func (w *ScheduleWindow) onWeekday(weekday time.Weekday) bool {
+	if len(w.Weekdays) == 0 {
+		return true
+	}
+	for _, day := range w.Weekdays {
+		if time.Weekday(day) == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// contains tells whether the window covers the time, the part after midnight of a window
+// across midnight belongs to the weekday the window starts on
+func (w *ScheduleWindow) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return w.onWeekday(t.Weekday()) && minute >= w.start && minute < w.end
+	}
+	if minute >= w.start {
+		return w.onWeekday(t.Weekday())
+	}
+	return minute < w.end && w.onWeekday(t.AddDate(0, 0, -1).Weekday())
+}
+
+// loadSchedule must be called before the channel is shared between requests
+func (channel *Channel) loadSchedule() {
+	cfg, err := channel.LoadConfig()
+	if err != nil || len(cfg.Schedule) == 0 {
+		channel.schedule = nil
+		return
+	}
+	err = ParseSchedule(cfg.Schedule)
+	if err != nil {
+		logger.SysError(fmt.Sprintf("invalid schedule of channel #%d: %s", channel.Id, err.Error()))
+		channel.schedule = nil
+		return
+	}
+	channel.schedule = cfg.Schedule
+}
+
+// isScheduledAt is true for channels without a schedule
+func (channel *Channel) isScheduledAt(t time.Time) bool {
+	if len(channel.schedule) == 0 {
+		return true
+	}
+	for i := range channel.schedule {
+		if channel.schedule[i].contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterScheduledChannels leaves out the channels outside of their schedule, keeping the order. If none is in
+// schedule all of them are kept, a request is better served by a channel off schedule than not at all.
+func filterScheduledChannels(channels []*Channel, t time.Time) []*Channel {
+	var scheduled []*Channel
+	for i, channel := range channels {
+		if channel.isScheduledAt(t) {
+			if scheduled != nil {
+				scheduled = append(scheduled, channel)
+			}
+			continue
+		}
+		if scheduled == nil {
+			scheduled = make([]*Channel, i, len(channels))
+			copy(scheduled, channels[:i])
+		}
+	}
+	if len(scheduled) == 0 {
+		return channels
+	}
+	return scheduled
+}
@@ -0,0 +1,39 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSchedule(t *testing.T) {
+	Convey("ScheduleWindow", t, func() {
+		windows := []ScheduleWindow{
+			{Weekdays: []int{1, 2, 3, 4, 5}, Start: "09:00", End: "18:00"},
+			{Weekdays: []int{5}, Start: "22:00", End: "06:00"},
+		}
+		So(ParseSchedule(windows), ShouldBeNil)
+		channel := &Channel{schedule: windows}
+		// 2024-06-07 is a Friday
+		So(channel.isScheduledAt(time.Date(2024, 6, 7, 9, 0, 0, 0, time.Local)), ShouldBeTrue)
+		So(channel.isScheduledAt(time.Date(2024, 6, 7, 18, 0, 0, 0, time.Local)), ShouldBeFalse)
+		So(channel.isScheduledAt(time.Date(2024, 6, 7, 23, 30, 0, 0, time.Local)), ShouldBeTrue)
+		So(channel.isScheduledAt(time.Date(2024, 6, 8, 5, 59, 0, 0, time.Local)), ShouldBeTrue)
+		So(channel.isScheduledAt(time.Date(2024, 6, 8, 10, 0, 0, 0, time.Local)), ShouldBeFalse)
+		So(channel.isScheduledAt(time.Date(2024, 6, 7, 2, 0, 0, 0, time.Local)), ShouldBeFalse)
+
+		So(ParseSchedule([]ScheduleWindow{{Start: "9:00", End: "25:00"}}), ShouldNotBeNil)
+		So(ParseSchedule([]ScheduleWindow{{Weekdays: []int{7}, Start: "09:00", End: "10:00"}}), ShouldNotBeNil)
+	})
+	Convey("filterScheduledChannels", t, func() {
+		night := []ScheduleWindow{{Start: "22:00", End: "08:00"}}
+		So(ParseSchedule(night), ShouldBeNil)
+		always := &Channel{Id: 1}
+		cheap := &Channel{Id: 2, schedule: night}
+		noon := time.Date(2024, 6, 7, 12, 0, 0, 0, time.Local)
+		So(filterScheduledChannels([]*Channel{cheap, always}, noon), ShouldResemble, []*Channel{always})
+		So(filterScheduledChannels([]*Channel{cheap}, noon), ShouldResemble, []*Channel{cheap})
+		So(filterScheduledChannels([]*Channel{cheap, always}, noon.Add(11*time.Hour)), ShouldResemble, []*Channel{cheap, always})
+	})
+}
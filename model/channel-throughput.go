@@ -0,0 +1,105 @@
+package model
+
+import (
+	"sync"
+	"time"
+)
+
+// the requests and tokens of each channel in the last minute, counted by each node on its own, so with several
+// nodes the caps of a channel should be divided by the number of nodes
+type throughputBucket struct {
+	second   int64
+	requests int
+	tokens   int
+}
+
+type throughputWindow struct {
+	buckets [60]throughputBucket
+	// the caps the channel had at its last request, used to skip the channel when picking one
+	rpm int
+	tpm int
+}
+
+var throughputWindows = make(map[int]*throughputWindow)
+var throughputLock sync.Mutex
+
+func (w *throughputWindow) usage(now int64) (requests int, tokens int) {
+	for _, bucket := range w.buckets {
+		if bucket.second > now-60 {
+			requests += bucket.requests
+			tokens += bucket.tokens
+		}
+	}
+	return requests, tokens
+}
+
+func (w *throughputWindow) add(now int64, requests int, tokens int) {
+	bucket := &w.buckets[now%60]
+	if bucket.second != now {
+		*bucket = throughputBucket{second: now}
+	}
+	bucket.requests += requests
+	bucket.tokens += tokens
+}
+
+func (w *throughputWindow) isFull(now int64, tokens int) bool {
+	requests, used := w.usage(now)
+	if w.rpm > 0 && requests+1 > w.rpm {
+		return true
+	}
+	// a request larger than the cap on its own is still let through once the window is empty
+	return w.tpm > 0 && used > 0 && used+tokens > w.tpm
+}
+
+// ReserveChannelThroughput counts a request of the channel with its estimated tokens, it returns false
+// without counting if the request would exceed the requests or tokens per minute of the channel
+func ReserveChannelThroughput(channelId int, rpm int, tpm int, tokens int) bool {
+	if rpm <= 0 && tpm <= 0 {
+		return true
+	}
+	now := time.Now().Unix()
+	throughputLock.Lock()
+	defer throughputLock.Unlock()
+	w, ok := throughputWindows[channelId]
+	if !ok {
+		w = &throughputWindow{}
+		throughputWindows[channelId] = w
+	}
+	w.rpm, w.tpm = rpm, tpm
+	if w.isFull(now, tokens) {
+		return false
+	}
+	w.add(now, 1, tokens)
+	return true
+}
+
+// RecordChannelThroughputTokens corrects the estimated tokens of a request once the usage is known
+func RecordChannelThroughputTokens(channelId int, tokens int) {
+	throughputLock.Lock()
+	defer throughputLock.Unlock()
+	if w, ok := throughputWindows[channelId]; ok {
+		w.add(time.Now().Unix(), 0, tokens)
+	}
+}
+
+// filterThrottledChannels leaves out the channels which have used up their requests per minute or tokens per
+// minute, keeping the order. If all of them have, all are kept, the request is then rejected by the channel picked.
+func filterThrottledChannels(channels []*Channel, t time.Time) []*Channel {
+	now := t.Unix()
+	throughputLock.Lock()
+	defer throughputLock.Unlock()
+	if len(throughputWindows) == 0 {
+		return channels
+	}
+	available := make([]*Channel, 0, len(channels))
+	for _, channel := range channels {
+		if w, ok := throughputWindows[channel.Id]; ok && w.isFull(now, 1) {
+			continue
+		}
+		available = append(available, channel)
+	}
+	if len(available) == 0 {
+		return channels
+	}
+	return available
+}
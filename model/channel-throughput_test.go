@@ -0,0 +1,25 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestChannelThroughput(t *testing.T) {
+	Convey("ReserveChannelThroughput", t, func() {
+		defer delete(throughputWindows, 9001)
+		So(ReserveChannelThroughput(9001, 2, 100, 60), ShouldBeTrue)
+		So(ReserveChannelThroughput(9001, 2, 100, 60), ShouldBeFalse) // tokens per minute
+		So(ReserveChannelThroughput(9001, 2, 100, 30), ShouldBeTrue)
+		So(ReserveChannelThroughput(9001, 2, 100, 1), ShouldBeFalse) // requests per minute
+		So(ReserveChannelThroughput(9001, 0, 0, 1000), ShouldBeTrue)
+
+		throttled := &Channel{Id: 9001}
+		other := &Channel{Id: 9002}
+		So(filterThrottledChannels([]*Channel{throttled, other}, time.Now()), ShouldResemble, []*Channel{other})
+		So(filterThrottledChannels([]*Channel{throttled}, time.Now()), ShouldResemble, []*Channel{throttled})
+		So(filterThrottledChannels([]*Channel{throttled, other}, time.Now().Add(time.Minute)), ShouldResemble, []*Channel{throttled, other})
+	})
+}
@@ -6,7 +6,9 @@ import (
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/secret"
 	"gorm.io/gorm"
+	"strings"
 )
 
 const (
@@ -36,6 +38,8 @@ type Channel struct {
 	ModelMapping       *string `json:"model_mapping" gorm:"type:varchar(1024);default:''"`
 	Priority           *int64  `json:"priority" gorm:"bigint;default:0"`
 	Config             string  `json:"config"`
+	schedule           []ScheduleWindow
+	keyErr             error
 }
 
 type ChannelConfig struct {
@@ -45,7 +49,37 @@ type ChannelConfig struct {
 	UserID     string `json:"user_id,omitempty"`
 	APIVersion string `json:"api_version,omitempty"`
 	LibraryID  string `json:"library_id,omitempty"`
-	Plugin     string `json:"plugin,omitempty"`
+	// DeploymentMapping maps model name to Azure deployment name
+	DeploymentMapping map[string]string `json:"deployment_mapping,omitempty"`
+	Plugin            string            `json:"plugin,omitempty"`
+	// RequestCompression gzips large request bodies, only for upstreams which accept Content-Encoding: gzip
+	RequestCompression bool `json:"request_compression,omitempty"`
+	// upstream response headers copied to the client, a trailing * matches a prefix,
+	// an empty allow list allows every header which is not denied
+	ResponseHeaderAllowList []string `json:"response_header_allow_list,omitempty"`
+	ResponseHeaderDenyList  []string `json:"response_header_deny_list,omitempty"`
+	// NoAuth sends no key to upstream, for self-hosted servers such as Ollama, vLLM or LM Studio
+	NoAuth bool `json:"no_auth,omitempty"`
+	// AuthHeader is the header carrying the key as is, instead of Authorization: Bearer
+	AuthHeader string `json:"auth_header,omitempty"`
+	// Schedule limits the channel to some times of the week, empty means always
+	Schedule []ScheduleWindow `json:"schedule,omitempty"`
+	// RPM and TPM cap the requests and tokens per minute sent to the channel, for upstreams with strict
+	// rate limits such as Groq, 0 means no limit
+	RPM int `json:"rpm,omitempty"`
+	TPM int `json:"tpm,omitempty"`
+	// ImageMaxDimension downscales base64 images whose width or height is larger, to fit the limits of the upstream
+	ImageMaxDimension int `json:"image_max_dimension,omitempty"`
+	// ModelPrefixes maps the start of a model name to the vendor OpenRouter puts before it, e.g. claude- to
+	// anthropic, an empty vendor leaves the model as is. The built-in rules are used if it's empty
+	ModelPrefixes map[string]string `json:"model_prefixes,omitempty"`
+	// Retry overrides the retry options when a request to the channel fails
+	Retry *RetryPolicy `json:"retry,omitempty"`
+	// StripContentFilterResults removes the content filter annotations of Azure from the responses
+	StripContentFilterResults bool `json:"strip_content_filter_results,omitempty"`
+	// EmbeddingBatchSize splits the embeddings requests with more inputs into several upstream requests,
+	// for the batch limits of the upstreams, e.g. 96 of Cohere, 0 means no splitting
+	EmbeddingBatchSize int `json:"embedding_batch_size,omitempty"`
 }
 
 func GetAllChannels(startIdx int, num int, scope string) ([]*Channel, error) {
@@ -80,6 +114,12 @@ func GetChannelById(id int, selectAll bool) (*Channel, error) {
 
 func BatchInsertChannels(channels []Channel) error {
 	var err error
+	for i := range channels {
+		err = channels[i].storeKey()
+		if err != nil {
+			return err
+		}
+	}
 	err = DB.Create(&channels).Error
 	if err != nil {
 		return err
@@ -107,6 +147,18 @@ func (channel *Channel) GetBaseURL() string {
 	return *channel.BaseURL
 }
 
+// GetKeys returns all keys of a multi-key channel, keys are separated by newline
+func (channel *Channel) GetKeys() []string {
+	var keys []string
+	for _, key := range strings.Split(channel.Key, "\n") {
+		key = strings.TrimSpace(key)
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
 func (channel *Channel) GetModelMapping() map[string]string {
 	if channel.ModelMapping == nil || *channel.ModelMapping == "" || *channel.ModelMapping == "{}" {
 		return nil
@@ -120,8 +172,100 @@ func (channel *Channel) GetModelMapping() map[string]string {
 	return modelMapping
 }
 
+// storeKey moves the key to the configured secret store, only the reference is saved in the database
+func (channel *Channel) storeKey() error {
+	ref, err := secret.Put(channel.Key)
+	if err != nil {
+		return fmt.Errorf("failed to store channel key: %w", err)
+	}
+	channel.Key = ref
+	return nil
+}
+
+// GetChannelStatuses is a light query for places which only care about whether channels are enabled
+func GetChannelStatuses() (channels []*Channel, err error) {
+	err = DB.Select("id", "name", "status").Order("id").Find(&channels).Error
+	return channels, err
+}
+
+// GetChannelBalances is a light query for the names and the last known balances of the channels
+func GetChannelBalances() (channels []*Channel, err error) {
+	err = DB.Select("id", "name", "balance", "balance_updated_time").Order("id").Find(&channels).Error
+	return channels, err
+}
+
+// AfterFind resolves the key reference saved in the database, keys in the database are resolved as is
+func (channel *Channel) AfterFind(tx *gorm.DB) error {
+	key, err := secret.Resolve(channel.Key)
+	if err != nil {
+		logger.SysError(fmt.Sprintf("failed to resolve key of channel #%d: %s", channel.Id, err.Error()))
+		// the reference must never be sent upstream as the key
+		channel.Key = ""
+		channel.keyErr = err
+		return nil
+	}
+	channel.Key = key
+	return nil
+}
+
+// KeyError is the error of resolving the key reference, the requests must not be relayed with the channel if it's set
+func (channel *Channel) KeyError() error {
+	return channel.keyErr
+}
+
+// getStoredKeys returns the values saved in the database for the keys of the channels, they're references
+// if the keys are kept in the secret store
+func getStoredKeys(query *gorm.DB) ([]string, error) {
+	var keys []string
+	err := query.Session(&gorm.Session{SkipHooks: true}).Model(&Channel{}).Pluck("key", &keys).Error
+	return keys, err
+}
+
+// deleteStoredKeys removes the keys of deleted channels from the secret store, the channels are already gone,
+// so failures are only logged
+func deleteStoredKeys(keys []string) {
+	for _, key := range keys {
+		err := secret.Delete(key)
+		if err != nil {
+			logger.SysError("failed to delete channel key from the secret store: " + err.Error())
+		}
+	}
+}
+
+// MigrateChannelKeys moves the keys still saved in the database to the configured secret store
+func MigrateChannelKeys() error {
+	if !secret.IsExternal() {
+		return nil
+	}
+	var channels []*Channel
+	// skip hooks, we want the values saved in the database instead of the resolved keys
+	err := DB.Session(&gorm.Session{SkipHooks: true}).Select("id", "key").Find(&channels).Error
+	if err != nil {
+		return err
+	}
+	for _, channel := range channels {
+		if channel.Key == "" || secret.IsReference(channel.Key) {
+			continue
+		}
+		err = channel.storeKey()
+		if err != nil {
+			return err
+		}
+		err = DB.Model(&Channel{}).Where("id = ?", channel.Id).Update("key", channel.Key).Error
+		if err != nil {
+			return err
+		}
+		logger.SysLog(fmt.Sprintf("key of channel #%d moved to the secret store", channel.Id))
+	}
+	return nil
+}
+
 func (channel *Channel) Insert() error {
 	var err error
+	err = channel.storeKey()
+	if err != nil {
+		return err
+	}
 	err = DB.Create(channel).Error
 	if err != nil {
 		return err
@@ -132,10 +276,25 @@ func (channel *Channel) Insert() error {
 
 func (channel *Channel) Update() error {
 	var err error
+	var oldKeys []string
+	if channel.Key != "" {
+		oldKeys, err = getStoredKeys(DB.Where("id = ?", channel.Id))
+		if err != nil {
+			return err
+		}
+	}
+	err = channel.storeKey()
+	if err != nil {
+		return err
+	}
 	err = DB.Model(channel).Updates(channel).Error
 	if err != nil {
 		return err
 	}
+	// the replaced key is removed from the secret store
+	if len(oldKeys) > 0 && oldKeys[0] != channel.Key {
+		deleteStoredKeys(oldKeys)
+	}
 	DB.Model(channel).First(channel, "id = ?", channel.Id)
 	err = channel.UpdateAbilities()
 	return err
@@ -163,10 +322,15 @@ func (channel *Channel) UpdateBalance(balance float64) {
 
 func (channel *Channel) Delete() error {
 	var err error
+	keys, err := getStoredKeys(DB.Where("id = ?", channel.Id))
+	if err != nil {
+		return err
+	}
 	err = DB.Delete(channel).Error
 	if err != nil {
 		return err
 	}
+	deleteStoredKeys(keys)
 	err = channel.DeleteAbilities()
 	return err
 }
@@ -210,11 +374,25 @@ func updateChannelUsedQuota(id int, quota int64) {
 }
 
 func DeleteChannelByStatus(status int64) (int64, error) {
+	keys, err := getStoredKeys(DB.Where("status = ?", status))
+	if err != nil {
+		return 0, err
+	}
 	result := DB.Where("status = ?", status).Delete(&Channel{})
+	if result.Error == nil {
+		deleteStoredKeys(keys)
+	}
 	return result.RowsAffected, result.Error
 }
 
 func DeleteDisabledChannel() (int64, error) {
+	keys, err := getStoredKeys(DB.Where("status = ? or status = ?", ChannelStatusAutoDisabled, ChannelStatusManuallyDisabled))
+	if err != nil {
+		return 0, err
+	}
 	result := DB.Where("status = ? or status = ?", ChannelStatusAutoDisabled, ChannelStatusManuallyDisabled).Delete(&Channel{})
+	if result.Error == nil {
+		deleteStoredKeys(keys)
+	}
 	return result.RowsAffected, result.Error
 }
@@ -0,0 +1,81 @@
+package model
+
+import (
+	"context"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"gorm.io/gorm"
+)
+
+// ContentViolation is a relay request which violated the content policy profile of its token or group
+type ContentViolation struct {
+	Id        int     `json:"id"`
+	CreatedAt int64   `json:"created_at" gorm:"bigint;index"`
+	RequestId string  `json:"request_id" gorm:"index"`
+	UserId    int     `json:"user_id" gorm:"index"`
+	TokenName string  `json:"token_name" gorm:"default:''"`
+	Group     string  `json:"group" gorm:"type:varchar(32);default:''"`
+	ModelName string  `json:"model_name" gorm:"default:''"`
+	Profile   string  `json:"profile" gorm:"index"`
+	Action    string  `json:"action"`
+	Keyword   string  `json:"keyword" gorm:"default:''"`
+	Category  string  `json:"category" gorm:"default:''"`
+	Score     float64 `json:"score" gorm:"default:0"`
+}
+
+func RecordContentViolation(ctx context.Context, violation *ContentViolation) {
+	violation.CreatedAt = helper.GetTimestamp()
+	err := LOG_DB.Create(violation).Error
+	if err != nil {
+		logger.Error(ctx, "failed to record content violation: "+err.Error())
+	}
+}
+
+type ContentViolationStatistic struct {
+	Profile  string `json:"profile"`
+	Action   string `json:"action"`
+	Keyword  string `json:"keyword"`
+	Category string `json:"category"`
+	Count    int64  `json:"count"`
+}
+
+type ContentViolationUserStatistic struct {
+	UserId int   `json:"user_id"`
+	Count  int64 `json:"count"`
+}
+
+func contentViolationQuery(startTimestamp int64, endTimestamp int64, profile string) *gorm.DB {
+	tx := LOG_DB.Model(&ContentViolation{})
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	if profile != "" {
+		tx = tx.Where("profile = ?", profile)
+	}
+	return tx
+}
+
+// GetContentViolationStatistics counts the violations by the keyword or the category violated, the most violated first
+func GetContentViolationStatistics(startTimestamp int64, endTimestamp int64, profile string) (statistics []*ContentViolationStatistic, err error) {
+	err = contentViolationQuery(startTimestamp, endTimestamp, profile).
+		Select("profile, action, keyword, category, count(1) AS count").
+		Group("profile, action, keyword, category").Order("count desc").Scan(&statistics).Error
+	return statistics, err
+}
+
+// GetContentViolationUserStatistics lists the users with the most violations
+func GetContentViolationUserStatistics(startTimestamp int64, endTimestamp int64, profile string, num int) (statistics []*ContentViolationUserStatistic, err error) {
+	err = contentViolationQuery(startTimestamp, endTimestamp, profile).
+		Select("user_id, count(1) AS count").
+		Group("user_id").Order("count desc").Limit(num).Scan(&statistics).Error
+	return statistics, err
+}
+
+func DeleteOldContentViolations(targetTimestamp int64) (int64, error) {
+	result := LOG_DB.Where("created_at < ?", targetTimestamp).Delete(&ContentViolation{})
+	return result.RowsAffected, result.Error
+}
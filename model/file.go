@@ -0,0 +1,126 @@
+package model
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/random"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// the file being uploaded is saved as pending with the size of the upload beforehand, so that it takes the storage
+// quota already, the pending files left by the interrupted uploads are orphaned after pendingFileTimeout seconds
+const PendingFileIdPrefix = "pending-"
+const pendingFileTimeout = 24 * 60 * 60
+
+var ErrFileStorageQuotaExceeded = errors.New("file storage quota exceeded")
+
+// File is a file uploaded through the relay, it belongs to the account of the key it's uploaded with,
+// so the later requests about it are routed to the same channel and key
+type File struct {
+	Id        int    `json:"id"`
+	FileId    string `json:"file_id" gorm:"type:varchar(64);uniqueIndex"` // the id on the upstream, like file-xxx
+	UserId    int    `json:"user_id" gorm:"index"`
+	ChannelId int    `json:"channel_id"`
+	KeyIndex  int    `json:"key_index"` // -1 if the channel has only one key
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose" gorm:"type:varchar(32)"`
+	Bytes     int64  `json:"bytes" gorm:"bigint"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint"`
+}
+
+func InsertFile(file *File) error {
+	return DB.Create(file).Error
+}
+
+func GetFile(userId int, fileId string) (*File, error) {
+	if strings.HasPrefix(fileId, PendingFileIdPrefix) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	file := File{}
+	err := DB.First(&file, "user_id = ? AND file_id = ?", userId, fileId).Error
+	return &file, err
+}
+
+// ReserveFile saves a pending file of the bytes to upload unless the files of the user would take more than
+// storageQuota, the user is locked so that the concurrent uploads are checked one after another
+func ReserveFile(userId int, bytes int64, storageQuota int64) (*File, error) {
+	file := &File{
+		FileId:    PendingFileIdPrefix + random.GetUUID(),
+		UserId:    userId,
+		KeyIndex:  -1,
+		Bytes:     bytes,
+		CreatedAt: helper.GetTimestamp(),
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&User{}, "id = ?", userId).Error
+		if err != nil {
+			return err
+		}
+		if storageQuota > 0 {
+			var usedBytes int64
+			err = tx.Model(&File{}).Select("COALESCE(SUM(bytes), 0)").Where("user_id = ?", userId).Scan(&usedBytes).Error
+			if err != nil {
+				return err
+			}
+			if usedBytes+bytes > storageQuota {
+				return ErrFileStorageQuotaExceeded
+			}
+		}
+		return tx.Create(file).Error
+	})
+	return file, err
+}
+
+// SaveReservedFile replaces the pending file with the file uploaded
+func SaveReservedFile(file *File) error {
+	return DB.Model(file).Select("file_id", "channel_id", "key_index", "filename", "purpose", "bytes", "created_at").Updates(file).Error
+}
+
+func DeleteReservedFile(file *File) error {
+	return DB.Delete(&File{}, file.Id).Error
+}
+
+// GetUserFiles lists the files of the user like the Files API, the newest first unless ascending,
+// after is the file id the page starts after
+func GetUserFiles(userId int, purpose string, after string, limit int, ascending bool) (files []*File, err error) {
+	tx := DB.Where("user_id = ? AND file_id NOT LIKE ?", userId, PendingFileIdPrefix+"%")
+	if purpose != "" {
+		tx = tx.Where("purpose = ?", purpose)
+	}
+	order := "id desc"
+	if ascending {
+		order = "id asc"
+	}
+	if after != "" {
+		file := File{}
+		err = DB.Select("id").First(&file, "user_id = ? AND file_id = ?", userId, after).Error
+		if err != nil {
+			return nil, err
+		}
+		if ascending {
+			tx = tx.Where("id > ?", file.Id)
+		} else {
+			tx = tx.Where("id < ?", file.Id)
+		}
+	}
+	err = tx.Order(order).Limit(limit).Find(&files).Error
+	return files, err
+}
+
+func DeleteFile(userId int, fileId string) error {
+	return DB.Where("user_id = ? AND file_id = ?", userId, fileId).Delete(&File{}).Error
+}
+
+// GetOrphanedFiles returns the files of the deleted users and of the deleted channels, and the pending files left
+func GetOrphanedFiles() (files []*File, err error) {
+	err = DB.Model(&File{}).Select("files.*").
+		Joins("LEFT JOIN users ON users.id = files.user_id").
+		Joins("LEFT JOIN channels ON channels.id = files.channel_id").
+		Where("(users.id IS NULL OR users.status = ? OR channels.id IS NULL) AND NOT (files.file_id LIKE ? AND files.created_at > ?)",
+			UserStatusDeleted, PendingFileIdPrefix+"%", helper.GetTimestamp()-pendingFileTimeout).
+		Find(&files).Error
+	return files, err
+}
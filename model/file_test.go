@@ -0,0 +1,46 @@
+package model
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReserveFile(t *testing.T) {
+	Convey("ReserveFile", t, func() {
+		useTestDB(t)
+		createTestUser(t, 1, 0)
+		So(DB.Create(&Channel{Id: 1, Name: "openai"}).Error, ShouldBeNil)
+		So(InsertFile(&File{FileId: "file-1", UserId: 1, ChannelId: 1, Bytes: 600}), ShouldBeNil)
+
+		Convey("takes the storage quota before the upload", func() {
+			reserved, err := ReserveFile(1, 300, 1000)
+			So(err, ShouldBeNil)
+			_, err = ReserveFile(1, 300, 1000)
+			So(err, ShouldEqual, ErrFileStorageQuotaExceeded)
+
+			reserved.FileId = "file-2"
+			reserved.Bytes = 100
+			So(SaveReservedFile(reserved), ShouldBeNil)
+			_, err = ReserveFile(1, 300, 1000)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("hides the pending files", func() {
+			reserved, err := ReserveFile(1, 300, 0)
+			So(err, ShouldBeNil)
+			_, err = GetFile(1, reserved.FileId)
+			So(err, ShouldNotBeNil)
+			files, err := GetUserFiles(1, "", "", 10, false)
+			So(err, ShouldBeNil)
+			So(files, ShouldHaveLength, 1)
+			orphaned, err := GetOrphanedFiles()
+			So(err, ShouldBeNil)
+			So(orphaned, ShouldBeEmpty)
+
+			So(DeleteReservedFile(reserved), ShouldBeNil)
+			_, err = ReserveFile(1, 400, 1000)
+			So(err, ShouldBeNil)
+		})
+	})
+}
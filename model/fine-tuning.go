@@ -0,0 +1,81 @@
+package model
+
+import "gorm.io/gorm/clause"
+
+// the statuses of the fine-tuning jobs after which they don't change any more
+var FineTuningJobFinalStatuses = []string{"succeeded", "failed", "cancelled"}
+
+// FineTuningJob is a fine-tuning job created through the relay, it belongs to the account of the key it's created with,
+// so the later requests about it are routed to the same channel and key. It's polled until it's finished,
+// and billed once by the tokens trained.
+type FineTuningJob struct {
+	Id            int    `json:"id"`
+	JobId         string `json:"job_id" gorm:"type:varchar(64);uniqueIndex"` // the id on the upstream, like ftjob-xxx
+	UserId        int    `json:"user_id" gorm:"index"`
+	TokenId       int    `json:"token_id"`
+	TokenName     string `json:"token_name" gorm:"default:''"`
+	ChannelId     int    `json:"channel_id"`
+	KeyIndex      int    `json:"key_index"` // -1 if the channel has only one key
+	Group         string `json:"group" gorm:"type:varchar(32)"`
+	ModelName     string `json:"model_name"`
+	Status        string `json:"status" gorm:"index"`
+	CreatedAt     int64  `json:"created_at" gorm:"bigint"`
+	FinishTime    int64  `json:"finish_time" gorm:"bigint"`
+	TrainedTokens int    `json:"trained_tokens"`
+	Quota         int64  `json:"quota" gorm:"bigint;default:0"`
+	// consumed when the job is created
+	PreConsumedQuota int64 `json:"pre_consumed_quota" gorm:"bigint;default:0"`
+	// the job as the upstream returned it last time, the jobs of the user are listed with it
+	Snapshot string `json:"-" gorm:"type:text"`
+}
+
+// InsertFineTuningJob saves the job unless it has been saved, it returns whether the job is new
+func InsertFineTuningJob(job *FineTuningJob) (bool, error) {
+	result := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(job)
+	return result.RowsAffected > 0, result.Error
+}
+
+func GetFineTuningJob(userId int, jobId string) (*FineTuningJob, error) {
+	job := FineTuningJob{}
+	err := DB.First(&job, "user_id = ? AND job_id = ?", userId, jobId).Error
+	return &job, err
+}
+
+// GetUserFineTuningJobs lists the jobs of the user like the fine-tuning API, the newest first,
+// after is the job id the page starts after
+func GetUserFineTuningJobs(userId int, after string, limit int) (jobs []*FineTuningJob, err error) {
+	tx := DB.Where("user_id = ?", userId)
+	if after != "" {
+		job := FineTuningJob{}
+		err = DB.Select("id").First(&job, "user_id = ? AND job_id = ?", userId, after).Error
+		if err != nil {
+			return nil, err
+		}
+		tx = tx.Where("id < ?", job.Id)
+	}
+	err = tx.Order("id desc").Limit(limit).Find(&jobs).Error
+	return jobs, err
+}
+
+func GetUnfinishedFineTuningJobs() (jobs []*FineTuningJob, err error) {
+	err = DB.Where("status NOT IN ?", FineTuningJobFinalStatuses).Find(&jobs).Error
+	return jobs, err
+}
+
+// Finish saves the final status and the tokens trained of an unfinished job, it returns false if the job has been
+// finished already, so that a job is billed once even if it's settled by more than one request or node
+func (job *FineTuningJob) Finish() (bool, error) {
+	result := DB.Model(&FineTuningJob{}).
+		Where("id = ? AND status NOT IN ?", job.Id, FineTuningJobFinalStatuses).
+		Select("model_name", "status", "finish_time", "trained_tokens", "quota", "snapshot").
+		Updates(job)
+	return result.RowsAffected > 0, result.Error
+}
+
+// UpdateStatus saves the status and the snapshot of an unfinished job
+func (job *FineTuningJob) UpdateStatus() error {
+	return DB.Model(&FineTuningJob{}).
+		Where("id = ? AND status NOT IN ?", job.Id, FineTuningJobFinalStatuses).
+		Select("status", "snapshot").
+		Updates(job).Error
+}
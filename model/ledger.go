@@ -0,0 +1,97 @@
+package model
+
+import (
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"gorm.io/gorm"
+)
+
+// QuotaLedger is an append-only record of every change of a user's quota,
+// entries are never updated or deleted
+type QuotaLedger struct {
+	Id        int    `json:"id"`
+	UserId    int    `json:"user_id" gorm:"index"`
+	TokenId   int    `json:"token_id" gorm:"index;default:0"`
+	Type      int    `json:"type" gorm:"index"`
+	Delta     int64  `json:"delta" gorm:"bigint"` // positive means the quota of the user increased
+	Remark    string `json:"remark" gorm:"default:''"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint;index"`
+	// Region is where the change happened if it was replicated from another region, empty for local changes
+	Region   string `json:"region,omitempty" gorm:"index;index:idx_quota_ledgers_origin,priority:1;default:''"`
+	OriginId int    `json:"origin_id,omitempty" gorm:"index:idx_quota_ledgers_origin,priority:2;default:0"` // id of the entry in its region
+	// the ids of users and tokens differ between regions, the entries served to other regions carry
+	// the username and a hash of the token key instead, which are the same everywhere, the key itself never leaves its region
+	Username     string `json:"username,omitempty" gorm:"-"`
+	TokenKeyHash string `json:"token_key_hash,omitempty" gorm:"-"`
+}
+
+// QuotaSnapshot is the balance of a user at the time LedgerId was the latest ledger entry,
+// the balance at any later time should equal the snapshot plus the ledger entries after it
+type QuotaSnapshot struct {
+	Id        int   `json:"id"`
+	UserId    int   `json:"user_id" gorm:"index"`
+	Quota     int64 `json:"quota" gorm:"bigint"`
+	UsedQuota int64 `json:"used_quota" gorm:"bigint"`
+	LedgerId  int   `json:"ledger_id"`
+	CreatedAt int64 `json:"created_at" gorm:"bigint;index"`
+}
+
+const (
+	LedgerTypeUnknown = iota
+	LedgerTypePreConsume
+	LedgerTypePostConsume
+	LedgerTypeRefund
+	LedgerTypeTopUp
+	LedgerTypeAdminAdjustment
+	LedgerTypeTransfer
+)
+
+func newQuotaLedger(userId int, tokenId int, ledgerType int, delta int64, remark string) *QuotaLedger {
+	return &QuotaLedger{
+		UserId:    userId,
+		TokenId:   tokenId,
+		Type:      ledgerType,
+		Delta:     delta,
+		Remark:    remark,
+		CreatedAt: helper.GetTimestamp(),
+	}
+}
+
+func RecordQuotaLedger(userId int, tokenId int, ledgerType int, delta int64, remark string) {
+	if delta == 0 {
+		return
+	}
+	err := DB.Create(newQuotaLedger(userId, tokenId, ledgerType, delta, remark)).Error
+	if err != nil {
+		logger.SysError("failed to record quota ledger: " + err.Error())
+	}
+}
+
+// recordQuotaLedgerWithTx is used when the quota is changed inside a transaction,
+// so that the change and its ledger entry are committed together
+func recordQuotaLedgerWithTx(tx *gorm.DB, userId int, tokenId int, ledgerType int, delta int64, remark string) error {
+	if delta == 0 {
+		return nil
+	}
+	return tx.Create(newQuotaLedger(userId, tokenId, ledgerType, delta, remark)).Error
+}
+
+func GetUserQuotaLedgers(userId int, ledgerType int, startTimestamp int64, endTimestamp int64, startIdx int, num int) (ledgers []*QuotaLedger, err error) {
+	tx := DB.Where("user_id = ?", userId)
+	if ledgerType != LedgerTypeUnknown {
+		tx = tx.Where("type = ?", ledgerType)
+	}
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&ledgers).Error
+	return ledgers, err
+}
+
+func GetUserQuotaSnapshots(userId int, startIdx int, num int) (snapshots []*QuotaSnapshot, err error) {
+	err = DB.Where("user_id = ?", userId).Order("id desc").Limit(num).Offset(startIdx).Find(&snapshots).Error
+	return snapshots, err
+}
@@ -0,0 +1,41 @@
+package model
+
+// LogExport is a CSV of the logs generated in the background, the file is saved in ExportPath,
+// the exports are saved in the database so that any node can serve them
+type LogExport struct {
+	Id         string `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	UserId     int    `json:"-" gorm:"index"`
+	Kind       string `json:"kind" gorm:"type:varchar(16)"`
+	Status     string `json:"status" gorm:"type:varchar(16)"`
+	Rows       int    `json:"rows" gorm:"column:row_count"`
+	Message    string `json:"message,omitempty"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint"`
+	FinishedAt int64  `json:"finished_at,omitempty" gorm:"bigint"`
+	ExpiresAt  int64  `json:"expires_at,omitempty" gorm:"bigint;index"`
+	Url        string `json:"url,omitempty" gorm:"-"`
+}
+
+func InsertLogExport(export *LogExport) error {
+	return DB.Create(export).Error
+}
+
+func UpdateLogExport(export *LogExport) error {
+	return DB.Model(export).Select("status", "row_count", "message", "finished_at", "expires_at").Updates(export).Error
+}
+
+func GetLogExportById(id string) (*LogExport, error) {
+	export := LogExport{}
+	err := DB.Where("id = ?", id).First(&export).Error
+	return &export, err
+}
+
+// DeleteExpiredLogExports deletes the exports whose links have expired, and returns their ids to remove the files
+func DeleteExpiredLogExports(now int64) ([]string, error) {
+	var ids []string
+	err := DB.Model(&LogExport{}).Where("expires_at > 0 AND expires_at < ?", now).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	err = DB.Where("id IN ?", ids).Delete(&LogExport{}).Error
+	return ids, err
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
 	"gorm.io/gorm"
+	"time"
 )
 
 type Log struct {
@@ -18,12 +19,18 @@ type Log struct {
 	Content          string `json:"content"`
 	Username         string `json:"username" gorm:"index:index_username_model_name,priority:2;default:''"`
 	TokenName        string `json:"token_name" gorm:"index;default:''"`
+	TokenId          int    `json:"token_id" gorm:"index;default:0"` // logs recorded before this column was added only have the name
 	ModelName        string `json:"model_name" gorm:"index;index:index_username_model_name,priority:1;default:''"`
 	Quota            int    `json:"quota" gorm:"default:0"`
 	PromptTokens     int    `json:"prompt_tokens" gorm:"default:0"`
 	CompletionTokens int    `json:"completion_tokens" gorm:"default:0"`
 	ChannelId        int    `json:"channel" gorm:"index"`
 	ChannelName      string `json:"channel_name" gorm:"index;default:''"`
+	ErrorType        int    `json:"error_type" gorm:"default:0"` // see relay/constant/errortype, only set for error logs
+	Experiment       string `json:"experiment" gorm:"index;default:''"`
+	Variant          string `json:"variant" gorm:"default:''"`
+	ElapsedTime      int64  `json:"elapsed_time" gorm:"default:0"`           // in milliseconds, only set for requests in experiments
+	ConversationId   string `json:"conversation_id" gorm:"index;default:''"` // supplied by the client with the X-Conversation-Id header
 }
 
 const (
@@ -32,6 +39,7 @@ const (
 	LogTypeConsume
 	LogTypeManage
 	LogTypeSystem
+	LogTypeError
 )
 
 func RecordLog(userId int, logType int, content string) {
@@ -66,8 +74,8 @@ func RecordTopupLog(userId int, content string, quota int) {
 	}
 }
 
-func RecordConsumeLog(ctx context.Context, userId int, channelId int, promptTokens int, completionTokens int, modelName string, tokenName string, quota int64, content string, channelName string) {
-	logger.Info(ctx, fmt.Sprintf("record consume log: userId=%d, channelId=%d, promptTokens=%d, completionTokens=%d, modelName=%s, tokenName=%s, quota=%d, content=%s, channelName=%s", userId, channelId, promptTokens, completionTokens, modelName, tokenName, quota, content, channelName))
+func RecordConsumeLog(ctx context.Context, userId int, channelId int, promptTokens int, completionTokens int, modelName string, tokenName string, tokenId int, quota int64, content string, channelName string) {
+	logger.Info(ctx, fmt.Sprintf("record consume log: userId=%d, channelId=%d, promptTokens=%d, completionTokens=%d, modelName=%s, tokenName=%s, tokenId=%d, quota=%d, content=%s, channelName=%s", userId, channelId, promptTokens, completionTokens, modelName, tokenName, tokenId, quota, content, channelName))
 	if !config.LogConsumeEnabled {
 		return
 	}
@@ -80,18 +88,61 @@ func RecordConsumeLog(ctx context.Context, userId int, channelId int, promptToke
 		PromptTokens:     promptTokens,
 		CompletionTokens: completionTokens,
 		TokenName:        tokenName,
+		TokenId:          tokenId,
 		ModelName:        modelName,
 		Quota:            int(quota),
 		ChannelId:        channelId,
 		ChannelName:      channelName,
 	}
+	tagExperiment(ctx, log)
+	tagConversation(ctx, log)
 	err := LOG_DB.Create(log).Error
 	if err != nil {
 		logger.Error(ctx, "failed to record log: "+err.Error())
 	}
 }
 
-func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, startIdx int, num int, channel int, channelName string) (logs []*Log, err error) {
+// RecordErrorLog records every failed attempt of relaying, retries included
+func RecordErrorLog(ctx context.Context, userId int, channelId int, modelName string, tokenName string, errorType int, content string, channelName string) {
+	if !config.LogConsumeEnabled {
+		return
+	}
+	log := &Log{
+		UserId:      userId,
+		Username:    GetUsernameById(userId),
+		CreatedAt:   helper.GetTimestamp(),
+		Type:        LogTypeError,
+		ErrorType:   errorType,
+		Content:     content,
+		TokenName:   tokenName,
+		ModelName:   modelName,
+		ChannelId:   channelId,
+		ChannelName: channelName,
+	}
+	tagExperiment(ctx, log)
+	tagConversation(ctx, log)
+	err := LOG_DB.Create(log).Error
+	if err != nil {
+		logger.Error(ctx, "failed to record log: "+err.Error())
+	}
+}
+
+func tagExperiment(ctx context.Context, log *Log) {
+	assignment := common.GetExperiment(ctx)
+	if assignment == nil {
+		return
+	}
+	log.Experiment = assignment.Experiment
+	log.Variant = assignment.Variant
+	log.ElapsedTime = time.Since(assignment.StartedAt).Milliseconds()
+}
+
+func tagConversation(ctx context.Context, log *Log) {
+	conversationId, _ := ctx.Value(helper.ConversationIdKey).(string)
+	log.ConversationId = conversationId
+}
+
+func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, startIdx int, num int, channel int, channelName string, conversationId string) (logs []*Log, err error) {
 	var tx *gorm.DB
 	if logType == LogTypeUnknown {
 		tx = LOG_DB
@@ -119,11 +170,14 @@ func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName
 	if channelName != "" {
 		tx = tx.Where("channel_name = ?", channelName)
 	}
+	if conversationId != "" {
+		tx = tx.Where("conversation_id = ?", conversationId)
+	}
 	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&logs).Error
 	return logs, err
 }
 
-func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string, startIdx int, num int, channelName string) (logs []*Log, err error) {
+func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string, startIdx int, num int, channelName string, conversationId string) (logs []*Log, err error) {
 	var tx *gorm.DB
 	if logType == LogTypeUnknown {
 		tx = LOG_DB.Where("user_id = ?", userId)
@@ -145,10 +199,67 @@ func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int
 	if channelName != "" {
 		tx = tx.Where("channel_name = ?", channelName)
 	}
+	if conversationId != "" {
+		tx = tx.Where("conversation_id = ?", conversationId)
+	}
 	err = tx.Order("id desc").Limit(num).Offset(startIdx).Omit("id").Find(&logs).Error
 	return logs, err
 }
 
+// LogFilter is the filter of the logs to export, zero fields match every log
+type LogFilter struct {
+	UserId         int    `json:"-"`
+	Type           int    `json:"type"`
+	StartTimestamp int64  `json:"start_timestamp"`
+	EndTimestamp   int64  `json:"end_timestamp"`
+	ModelName      string `json:"model_name"`
+	Username       string `json:"username"`
+	TokenName      string `json:"token_name"`
+	Channel        int    `json:"channel"`
+	ChannelName    string `json:"channel_name"`
+	ConversationId string `json:"conversation_id"`
+}
+
+// ExportLogs passes the logs matching the filter to fn batch by batch in the order of id,
+// so that all of them are never held in the memory at once
+func ExportLogs(filter LogFilter, batchSize int, fn func(logs []*Log) error) error {
+	tx := LOG_DB.Model(&Log{})
+	if filter.UserId != 0 {
+		tx = tx.Where("user_id = ?", filter.UserId)
+	}
+	if filter.Type != LogTypeUnknown {
+		tx = tx.Where("type = ?", filter.Type)
+	}
+	if filter.ModelName != "" {
+		tx = tx.Where("model_name = ?", filter.ModelName)
+	}
+	if filter.Username != "" {
+		tx = tx.Where("username = ?", filter.Username)
+	}
+	if filter.TokenName != "" {
+		tx = tx.Where("token_name = ?", filter.TokenName)
+	}
+	if filter.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", filter.StartTimestamp)
+	}
+	if filter.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", filter.EndTimestamp)
+	}
+	if filter.Channel != 0 {
+		tx = tx.Where("channel_id = ?", filter.Channel)
+	}
+	if filter.ChannelName != "" {
+		tx = tx.Where("channel_name = ?", filter.ChannelName)
+	}
+	if filter.ConversationId != "" {
+		tx = tx.Where("conversation_id = ?", filter.ConversationId)
+	}
+	var logs []*Log
+	return tx.FindInBatches(&logs, batchSize, func(tx *gorm.DB, batch int) error {
+		return fn(logs)
+	}).Error
+}
+
 func SearchAllLogs(keyword string) (logs []*Log, err error) {
 	err = LOG_DB.Where("type = ? or content LIKE ?", keyword, keyword+"%").Order("id desc").Limit(config.MaxRecentItems).Find(&logs).Error
 	return logs, err
@@ -186,6 +297,13 @@ func SumUsedQuota(logType int, startTimestamp int64, endTimestamp int64, modelNa
 	return quota
 }
 
+// SumUserUsedQuotaSince sums the quota consumed by the user from the timestamp on, only the logged consumption counts
+func SumUserUsedQuotaSince(userId int, startTimestamp int64) (quota int64) {
+	LOG_DB.Table("logs").Select("ifnull(sum(quota),0)").
+		Where("user_id = ? and type = ? and created_at >= ?", userId, LogTypeConsume, startTimestamp).Scan(&quota)
+	return quota
+}
+
 func SumUsedToken(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, channelName string) (token int) {
 	tx := LOG_DB.Table("logs").Select("ifnull(sum(prompt_tokens),0) + ifnull(sum(completion_tokens),0)")
 	if username != "" {
@@ -215,6 +333,30 @@ func DeleteOldLog(targetTimestamp int64) (int64, error) {
 	return result.RowsAffected, result.Error
 }
 
+type ChannelErrorStatistic struct {
+	ChannelId   int    `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	ErrorType   int    `json:"error_type"`
+	Count       int64  `json:"count"`
+}
+
+// GetChannelErrorStatistics counts the failed relays of every channel by the type of error
+func GetChannelErrorStatistics(startTimestamp int64, endTimestamp int64, channel int) (statistics []*ChannelErrorStatistic, err error) {
+	tx := LOG_DB.Model(&Log{}).Where("type = ?", LogTypeError)
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	if channel != 0 {
+		tx = tx.Where("channel_id = ?", channel)
+	}
+	err = tx.Select("channel_id, MAX(channel_name) AS channel_name, error_type, count(1) AS count").
+		Group("channel_id, error_type").Order("channel_id, error_type").Scan(&statistics).Error
+	return statistics, err
+}
+
 type LogStatistic struct {
 	Day              string `gorm:"column:day"`
 	ModelName        string `gorm:"column:model_name"`
@@ -224,16 +366,19 @@ type LogStatistic struct {
 	CompletionTokens int    `gorm:"column:completion_tokens"`
 }
 
-func SearchLogsByDayAndModel(userId, start, end int) (LogStatistics []*LogStatistic, err error) {
-	groupSelect := "DATE_FORMAT(FROM_UNIXTIME(created_at), '%Y-%m-%d') as day"
-
+// dayGroupSelect formats created_at as the day of the log
+func dayGroupSelect() string {
 	if common.UsingPostgreSQL {
-		groupSelect = "TO_CHAR(date_trunc('day', to_timestamp(created_at)), 'YYYY-MM-DD') as day"
+		return "TO_CHAR(date_trunc('day', to_timestamp(created_at)), 'YYYY-MM-DD') as day"
 	}
-
 	if common.UsingSQLite {
-		groupSelect = "strftime('%Y-%m-%d', datetime(created_at, 'unixepoch')) as day"
+		return "strftime('%Y-%m-%d', datetime(created_at, 'unixepoch')) as day"
 	}
+	return "DATE_FORMAT(FROM_UNIXTIME(created_at), '%Y-%m-%d') as day"
+}
+
+func SearchLogsByDayAndModel(userId, start, end int) (LogStatistics []*LogStatistic, err error) {
+	groupSelect := dayGroupSelect()
 
 	err = LOG_DB.Raw(`
 		SELECT `+groupSelect+`,
@@ -251,3 +396,124 @@ func SearchLogsByDayAndModel(userId, start, end int) (LogStatistics []*LogStatis
 
 	return LogStatistics, err
 }
+
+// SearchTokenLogsByDayAndModel is like SearchLogsByDayAndModel but only for the token,
+// old logs without token id are matched by the name of the token
+func SearchTokenLogsByDayAndModel(token *Token, start int64, end int64) (LogStatistics []*LogStatistic, err error) {
+	err = LOG_DB.Raw(`
+		SELECT `+dayGroupSelect()+`,
+		model_name, count(1) as request_count,
+		sum(quota) as quota,
+		sum(prompt_tokens) as prompt_tokens,
+		sum(completion_tokens) as completion_tokens
+		FROM logs
+		WHERE type = ?
+		AND (token_id = ? OR (token_id = 0 AND user_id = ? AND token_name = ?))
+		AND created_at BETWEEN ? AND ?
+		GROUP BY day, model_name
+		ORDER BY day, model_name
+	`, LogTypeConsume, token.Id, token.UserId, token.Name, start, end).Scan(&LogStatistics).Error
+
+	return LogStatistics, err
+}
+
+type ExperimentStatistic struct {
+	Variant          string  `json:"variant"`
+	ModelName        string  `json:"model_name"`
+	RequestCount     int     `json:"request_count"`
+	ErrorCount       int     `json:"error_count"`
+	Quota            int64   `json:"quota"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	AvgElapsedTime   float64 `json:"avg_elapsed_time"`
+}
+
+// GetExperimentStatistics compares the variants of an experiment by cost, usage, latency and failed attempts
+func GetExperimentStatistics(experiment string, startTimestamp int64, endTimestamp int64) (statistics []*ExperimentStatistic, err error) {
+	tx := LOG_DB.Table("logs").Where("experiment = ?", experiment)
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	err = tx.Session(&gorm.Session{}).Where("type = ?", LogTypeConsume).
+		Select("variant, model_name, count(1) AS request_count, sum(quota) AS quota, sum(prompt_tokens) AS prompt_tokens, " +
+			"sum(completion_tokens) AS completion_tokens, avg(elapsed_time) AS avg_elapsed_time").
+		Group("variant, model_name").Order("variant, model_name").Scan(&statistics).Error
+	if err != nil {
+		return nil, err
+	}
+	var errorCounts []struct {
+		Variant   string
+		ModelName string
+		Count     int
+	}
+	err = tx.Session(&gorm.Session{}).Where("type = ?", LogTypeError).
+		Select("variant, model_name, count(1) AS count").Group("variant, model_name").Scan(&errorCounts).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, errorCount := range errorCounts {
+		var statistic *ExperimentStatistic
+		for _, s := range statistics {
+			if s.Variant == errorCount.Variant && s.ModelName == errorCount.ModelName {
+				statistic = s
+				break
+			}
+		}
+		if statistic == nil {
+			statistic = &ExperimentStatistic{Variant: errorCount.Variant, ModelName: errorCount.ModelName}
+			statistics = append(statistics, statistic)
+		}
+		statistic.ErrorCount = errorCount.Count
+	}
+	return statistics, nil
+}
+
+type UsageAggregate struct {
+	UserId           int    `json:"user_id"`
+	ModelName        string `json:"model_name"`
+	RequestCount     int    `json:"request_count"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	Quota            int64  `json:"quota"`
+}
+
+// GetUsageAggregates sums the consume logs in the time range by user and model
+func GetUsageAggregates(startTimestamp int64, endTimestamp int64) (aggregates []*UsageAggregate, err error) {
+	tx := LOG_DB.Table("logs").Where("type = ?", LogTypeConsume)
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	err = tx.Select("user_id, model_name, count(1) AS request_count, sum(prompt_tokens) AS prompt_tokens, " +
+		"sum(completion_tokens) AS completion_tokens, sum(quota) AS quota").
+		Group("user_id, model_name").Scan(&aggregates).Error
+	return aggregates, err
+}
+
+type DailyQuota struct {
+	Day   string `gorm:"column:day"`
+	Id    int    `gorm:"column:id"`
+	Quota int64  `gorm:"column:quota"`
+}
+
+// getDailyQuota sums the consumed quota of the time range by day and by column, either user_id or channel_id
+func getDailyQuota(column string, startTimestamp int64, endTimestamp int64) (quotas []*DailyQuota, err error) {
+	err = LOG_DB.Table("logs").
+		Select(dayGroupSelect()+", "+column+" AS id, sum(quota) AS quota").
+		Where("type = ? AND created_at BETWEEN ? AND ?", LogTypeConsume, startTimestamp, endTimestamp).
+		Group("day, " + column).Scan(&quotas).Error
+	return quotas, err
+}
+
+func GetDailyQuotaByUser(startTimestamp int64, endTimestamp int64) ([]*DailyQuota, error) {
+	return getDailyQuota("user_id", startTimestamp, endTimestamp)
+}
+
+func GetDailyQuotaByChannel(startTimestamp int64, endTimestamp int64) ([]*DailyQuota, error) {
+	return getDailyQuota("channel_id", startTimestamp, endTimestamp)
+}
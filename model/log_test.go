@@ -0,0 +1,66 @@
+package model
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+func TestConversationIdLogs(t *testing.T) {
+	Convey("the logs are tagged with the conversation id and can be filtered by it", t, func() {
+		useTestDB(t)
+		ctx := context.WithValue(context.Background(), helper.ConversationIdKey, "thread-1")
+		RecordConsumeLog(ctx, 1, 1, 10, 20, "gpt-4o", "token", 1, 100, "", "channel")
+		RecordErrorLog(ctx, 1, 1, "gpt-4o", "token", 0, "failed", "channel")
+		RecordConsumeLog(context.Background(), 1, 1, 10, 20, "gpt-4o", "token", 1, 100, "", "channel")
+		RecordConsumeLog(ctx, 2, 1, 10, 20, "gpt-4o", "token", 2, 100, "", "channel")
+
+		logs, err := GetAllLogs(LogTypeUnknown, 0, 0, "", "", "", 0, 10, 0, "", "thread-1")
+		So(err, ShouldBeNil)
+		So(logs, ShouldHaveLength, 3)
+		for _, log := range logs {
+			So(log.ConversationId, ShouldEqual, "thread-1")
+		}
+
+		logs, err = GetUserLogs(1, LogTypeConsume, 0, 0, "", "", 0, 10, "", "thread-1")
+		So(err, ShouldBeNil)
+		So(logs, ShouldHaveLength, 1)
+
+		logs, err = GetAllLogs(LogTypeUnknown, 0, 0, "", "", "", 0, 10, 0, "", "")
+		So(err, ShouldBeNil)
+		So(logs, ShouldHaveLength, 4)
+	})
+}
+
+func TestSearchTokenLogsByDayAndModel(t *testing.T) {
+	Convey("the consume logs of the token are grouped by day and model", t, func() {
+		useTestDB(t)
+		token := &Token{Id: 1, UserId: 1, Name: "token"}
+		// 2023-11-14 22:13:20 UTC
+		day1 := int64(1700000000)
+		day2 := day1 + 24*60*60
+		for _, log := range []*Log{
+			{UserId: 1, TokenId: 1, TokenName: "token", Type: LogTypeConsume, ModelName: "gpt-4o", Quota: 100, PromptTokens: 10, CompletionTokens: 20, CreatedAt: day1},
+			{UserId: 1, TokenId: 1, TokenName: "token", Type: LogTypeConsume, ModelName: "gpt-4o", Quota: 200, PromptTokens: 1, CompletionTokens: 2, CreatedAt: day1 + 60},
+			{UserId: 1, TokenId: 1, TokenName: "token", Type: LogTypeConsume, ModelName: "gpt-4o-mini", Quota: 5, PromptTokens: 3, CompletionTokens: 4, CreatedAt: day1},
+			// recorded before the token id was logged
+			{UserId: 1, TokenName: "token", Type: LogTypeConsume, ModelName: "gpt-4o", Quota: 50, PromptTokens: 5, CompletionTokens: 5, CreatedAt: day2},
+			// not of the token
+			{UserId: 1, TokenId: 1, TokenName: "token", Type: LogTypeError, ModelName: "gpt-4o", CreatedAt: day2},
+			{UserId: 1, TokenId: 2, TokenName: "token", Type: LogTypeConsume, ModelName: "gpt-4o", Quota: 1000, CreatedAt: day2},
+			{UserId: 2, TokenName: "token", Type: LogTypeConsume, ModelName: "gpt-4o", Quota: 1000, CreatedAt: day2},
+			{UserId: 1, TokenId: 1, TokenName: "token", Type: LogTypeConsume, ModelName: "gpt-4o", Quota: 1000, CreatedAt: day2 + 7*24*60*60},
+		} {
+			So(LOG_DB.Create(log).Error, ShouldBeNil)
+		}
+
+		statistics, err := SearchTokenLogsByDayAndModel(token, day1, day2+60)
+		So(err, ShouldBeNil)
+		So(statistics, ShouldHaveLength, 3)
+		So(*statistics[0], ShouldResemble, LogStatistic{Day: "2023-11-14", ModelName: "gpt-4o", RequestCount: 2, Quota: 300, PromptTokens: 11, CompletionTokens: 22})
+		So(*statistics[1], ShouldResemble, LogStatistic{Day: "2023-11-14", ModelName: "gpt-4o-mini", RequestCount: 1, Quota: 5, PromptTokens: 3, CompletionTokens: 4})
+		So(*statistics[2], ShouldResemble, LogStatistic{Day: "2023-11-15", ModelName: "gpt-4o", RequestCount: 1, Quota: 50, PromptTokens: 5, CompletionTokens: 5})
+	})
+}
@@ -12,6 +12,7 @@ import (
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
 	"os"
 	"strings"
 	"time"
@@ -69,24 +70,52 @@ func chooseDB(envName string) (*gorm.DB, error) {
 			return gorm.Open(postgres.New(postgres.Config{
 				DSN:                  dsn,
 				PreferSimpleProtocol: true, // disables implicit prepared statement usage
-			}), &gorm.Config{
-				PrepareStmt: true, // precompile SQL
-			})
+			}), newGormConfig(envName))
 		}
 		// Use MySQL
 		logger.SysLog("using MySQL as database")
 		common.UsingMySQL = true
-		return gorm.Open(mysql.Open(dsn), &gorm.Config{
-			PrepareStmt: true, // precompile SQL
-		})
+		return gorm.Open(mysql.Open(dsn), newGormConfig(envName))
 	}
 	// Use SQLite
 	logger.SysLog("SQL_DSN not set, using SQLite as database")
 	common.UsingSQLite = true
 	config := fmt.Sprintf("?_busy_timeout=%d", common.SQLiteBusyTimeout)
-	return gorm.Open(sqlite.Open(common.SQLitePath+config), &gorm.Config{
+	if common.SQLiteJournalMode != "" {
+		config += "&_journal_mode=" + common.SQLiteJournalMode
+		if strings.EqualFold(common.SQLiteJournalMode, "WAL") {
+			// nothing is lost in WAL mode but the last transactions on a power loss, and the writes are much faster
+			config += "&_synchronous=NORMAL"
+		}
+	}
+	return gorm.Open(sqlite.Open(common.SQLitePath+config), newGormConfig(envName))
+}
+
+func newGormConfig(envName string) *gorm.Config {
+	return &gorm.Config{
 		PrepareStmt: true, // precompile SQL
-	})
+		Logger: gormlogger.New(sqlLogWriter{}, gormlogger.Config{
+			SlowThreshold:             time.Duration(getDBEnvInt(envName, "SQL_SLOW_THRESHOLD", 200)) * time.Millisecond,
+			LogLevel:                  gormlogger.Warn,
+			IgnoreRecordNotFoundError: true,
+		}),
+	}
+}
+
+// sqlLogWriter sends slow queries and errors reported by gorm to our own log file
+type sqlLogWriter struct{}
+
+func (sqlLogWriter) Printf(format string, args ...any) {
+	logger.SysLogf("[SQL] "+format, args...)
+}
+
+// getDBEnvInt lets the database for logs be tuned separately, e.g. LOG_SQL_MAX_OPEN_CONNS,
+// and falls back to the setting shared by both databases
+func getDBEnvInt(envName string, key string, defaultValue int) int {
+	if prefix := strings.TrimSuffix(envName, "SQL_DSN"); prefix != "" && os.Getenv(prefix+key) != "" {
+		return env.Int(prefix+key, defaultValue)
+	}
+	return env.Int(key, defaultValue)
 }
 
 func InitDB(envName string) (db *gorm.DB, err error) {
@@ -99,9 +128,10 @@ func InitDB(envName string) (db *gorm.DB, err error) {
 		if err != nil {
 			return nil, err
 		}
-		sqlDB.SetMaxIdleConns(env.Int("SQL_MAX_IDLE_CONNS", 100))
-		sqlDB.SetMaxOpenConns(env.Int("SQL_MAX_OPEN_CONNS", 1000))
-		sqlDB.SetConnMaxLifetime(time.Second * time.Duration(env.Int("SQL_MAX_LIFETIME", 60)))
+		sqlDB.SetMaxIdleConns(getDBEnvInt(envName, "SQL_MAX_IDLE_CONNS", 100))
+		sqlDB.SetMaxOpenConns(getDBEnvInt(envName, "SQL_MAX_OPEN_CONNS", 1000))
+		sqlDB.SetConnMaxLifetime(time.Second * time.Duration(getDBEnvInt(envName, "SQL_MAX_LIFETIME", 60)))
+		sqlDB.SetConnMaxIdleTime(time.Second * time.Duration(getDBEnvInt(envName, "SQL_MAX_IDLE_TIME", 0)))
 
 		if !config.IsMasterNode {
 			return db, err
@@ -138,6 +168,54 @@ func InitDB(envName string) (db *gorm.DB, err error) {
 		if err != nil {
 			return nil, err
 		}
+		err = db.AutoMigrate(&QuotaLedger{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&QuotaSnapshot{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&SlowRequest{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&ContentViolation{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&RegionCursor{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&MidjourneyTask{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&AssistantObject{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&AssistantRun{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&File{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&FineTuningJob{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&StreamTrace{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&LogExport{})
+		if err != nil {
+			return nil, err
+		}
 		logger.SysLog("database migrated")
 		return db, err
 	} else {
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/songquanpeng/one-api/common/testdb"
+)
+
+// useTestDB points DB and LOG_DB at a new SQLite database with all the tables migrated, redis is disabled
+func useTestDB(t *testing.T) {
+	testdb.Use(t, InitDB, &DB, &LOG_DB)
+}
+
+// createTestUser inserts an enabled user with the unique columns filled in
+func createTestUser(t *testing.T, id int, quota int64) *User {
+	user := &User{
+		Id:          id,
+		Username:    fmt.Sprintf("user%d", id),
+		Quota:       quota,
+		Status:      UserStatusEnabled,
+		Role:        RoleCommonUser,
+		AccessToken: fmt.Sprintf("access%d", id),
+		AffCode:     fmt.Sprintf("aff%d", id),
+		Group:       "default",
+	}
+	err := DB.Create(user).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
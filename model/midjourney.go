@@ -0,0 +1,87 @@
+package model
+
+// the final statuses of the tasks of midjourney-proxy
+const (
+	MidjourneyTaskStatusSuccess = "SUCCESS"
+	MidjourneyTaskStatusFailure = "FAILURE"
+)
+
+// MidjourneyTask is a task submitted to a Midjourney channel, polled until it succeeds or fails,
+// the quota is pre-consumed on submitting and settled once it's finished
+type MidjourneyTask struct {
+	Id          int     `json:"id"`
+	MjId        string  `json:"mj_id" gorm:"index"` // the id of the task on the proxy
+	UserId      int     `json:"user_id" gorm:"index"`
+	TokenId     int     `json:"token_id"`
+	TokenName   string  `json:"token_name" gorm:"default:''"`
+	ChannelId   int     `json:"channel_id" gorm:"index"`
+	Action      string  `json:"action"`
+	Prompt      string  `json:"prompt" gorm:"type:text"`
+	PromptEn    string  `json:"prompt_en" gorm:"type:text"`
+	Description string  `json:"description"`
+	State       string  `json:"state"` // the custom state of the client
+	Status      string  `json:"status" gorm:"index"`
+	Progress    string  `json:"progress"`
+	ImageUrl    string  `json:"image_url" gorm:"type:text"`
+	FailReason  string  `json:"fail_reason"`
+	SubmitTime  int64   `json:"submit_time" gorm:"bigint;index"`
+	StartTime   int64   `json:"start_time" gorm:"bigint"`
+	FinishTime  int64   `json:"finish_time" gorm:"bigint"`
+	Quota       int64   `json:"quota" gorm:"bigint;default:0"`
+	ModelRatio  float64 `json:"model_ratio"`
+	GroupRatio  float64 `json:"group_ratio"`
+}
+
+func (task *MidjourneyTask) Insert() error {
+	return DB.Create(task).Error
+}
+
+// UpdateProgress saves the progress of an unfinished task, it returns false if the task has been finished already,
+// so that a task is settled once even if it's polled by more than one node
+func (task *MidjourneyTask) UpdateProgress() (bool, error) {
+	result := DB.Model(&MidjourneyTask{}).
+		Where("id = ? AND status NOT IN ?", task.Id, []string{MidjourneyTaskStatusSuccess, MidjourneyTaskStatusFailure}).
+		Select("prompt_en", "description", "status", "progress", "image_url", "fail_reason", "start_time", "finish_time").
+		Updates(task)
+	return result.RowsAffected > 0, result.Error
+}
+
+func GetMidjourneyTaskByMjId(userId int, mjId string) (*MidjourneyTask, error) {
+	task := MidjourneyTask{}
+	err := DB.First(&task, "user_id = ? AND mj_id = ?", userId, mjId).Error
+	return &task, err
+}
+
+func GetMidjourneyTasksByMjIds(userId int, mjIds []string) (tasks []*MidjourneyTask, err error) {
+	err = DB.Where("user_id = ? AND mj_id IN ?", userId, mjIds).Order("id desc").Find(&tasks).Error
+	return tasks, err
+}
+
+func GetUnfinishedMidjourneyTasks() (tasks []*MidjourneyTask, err error) {
+	err = DB.Where("status NOT IN ?", []string{MidjourneyTaskStatusSuccess, MidjourneyTaskStatusFailure}).Find(&tasks).Error
+	return tasks, err
+}
+
+func GetAllMidjourneyTasks(userId int, channelId int, status string, startIdx int, num int) (tasks []*MidjourneyTask, err error) {
+	tx := DB
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if channelId != 0 {
+		tx = tx.Where("channel_id = ?", channelId)
+	}
+	if status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&tasks).Error
+	return tasks, err
+}
+
+func GetUserMidjourneyTasks(userId int, status string, startIdx int, num int) (tasks []*MidjourneyTask, err error) {
+	tx := DB.Where("user_id = ?", userId)
+	if status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Omit("channel_id", "model_ratio").Find(&tasks).Error
+	return tasks, err
+}
@@ -1,9 +1,15 @@
 package model
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/contentpolicy"
+	"github.com/songquanpeng/one-api/relay/modelinfo"
+	"gorm.io/gorm/clause"
 	"strconv"
 	"strings"
 	"time"
@@ -32,6 +38,7 @@ func InitOptionMap() {
 	config.OptionMap["TurnstileCheckEnabled"] = strconv.FormatBool(config.TurnstileCheckEnabled)
 	config.OptionMap["RegisterEnabled"] = strconv.FormatBool(config.RegisterEnabled)
 	config.OptionMap["AutomaticDisableChannelEnabled"] = strconv.FormatBool(config.AutomaticDisableChannelEnabled)
+	config.OptionMap["KeySweepAutoDisableEnabled"] = strconv.FormatBool(config.KeySweepAutoDisableEnabled)
 	config.OptionMap["AutomaticEnableChannelEnabled"] = strconv.FormatBool(config.AutomaticEnableChannelEnabled)
 	config.OptionMap["ApproximateTokenEnabled"] = strconv.FormatBool(config.ApproximateTokenEnabled)
 	config.OptionMap["LogConsumeEnabled"] = strconv.FormatBool(config.LogConsumeEnabled)
@@ -65,17 +72,77 @@ func InitOptionMap() {
 	config.OptionMap["QuotaForInviter"] = strconv.FormatInt(config.QuotaForInviter, 10)
 	config.OptionMap["QuotaForInvitee"] = strconv.FormatInt(config.QuotaForInvitee, 10)
 	config.OptionMap["QuotaRemindThreshold"] = strconv.FormatInt(config.QuotaRemindThreshold, 10)
+	config.OptionMap["QuotaTransferEnabled"] = strconv.FormatBool(config.QuotaTransferEnabled)
+	config.OptionMap["PublicStatusEnabled"] = strconv.FormatBool(config.PublicStatusEnabled)
+	config.OptionMap["StreamTraceEnabled"] = strconv.FormatBool(config.StreamTraceEnabled)
+	config.OptionMap["StreamTraceSecret"] = ""
+	config.OptionMap["TokenWebhookEnabled"] = strconv.FormatBool(config.TokenWebhookEnabled)
+	config.OptionMap["QuotaTransferMaxQuota"] = strconv.FormatInt(config.QuotaTransferMaxQuota, 10)
+	config.OptionMap["QuotaTransferDailyMaxQuota"] = strconv.FormatInt(config.QuotaTransferDailyMaxQuota, 10)
 	config.OptionMap["PreConsumedQuota"] = strconv.FormatInt(config.PreConsumedQuota, 10)
+	config.OptionMap["SlowRequestThreshold"] = strconv.Itoa(config.SlowRequestThreshold)
+	config.OptionMap["SlowRequestBodyCaptureEnabled"] = strconv.FormatBool(config.SlowRequestBodyCaptureEnabled)
 	config.OptionMap["ModelRatio"] = billingratio.ModelRatio2JSONString()
 	config.OptionMap["GroupRatio"] = billingratio.GroupRatio2JSONString()
 	config.OptionMap["CompletionRatio"] = billingratio.CompletionRatio2JSONString()
+	config.OptionMap["ChatImagePrice"] = billingratio.ChatImagePrice2JSONString()
 	config.OptionMap["TopUpLink"] = config.TopUpLink
 	config.OptionMap["ChatLink"] = config.ChatLink
 	config.OptionMap["QuotaPerUnit"] = strconv.FormatFloat(config.QuotaPerUnit, 'f', -1, 64)
 	config.OptionMap["RetryTimes"] = strconv.Itoa(config.RetryTimes)
+	config.OptionMap["RetryBaseDelay"] = strconv.Itoa(config.RetryBaseDelay)
+	config.OptionMap["RetryMaxDelay"] = strconv.Itoa(config.RetryMaxDelay)
+	config.OptionMap["RetryJitter"] = strconv.FormatFloat(config.RetryJitter, 'f', -1, 64)
+	config.OptionMap["RetryStatusCodes"] = config.RetryStatusCodes
+	config.OptionMap["GlobalSpendRateLimit"] = strconv.FormatInt(config.GlobalSpendRateLimit, 10)
 	config.OptionMap["Theme"] = config.Theme
+	config.OptionMap["ModelNameNormalizationEnabled"] = strconv.FormatBool(config.ModelNameNormalizationEnabled)
+	config.OptionMap["ContextWindowCheckEnabled"] = strconv.FormatBool(config.ContextWindowCheckEnabled)
+	config.OptionMap["ContextWindow"] = modelinfo.ContextWindow2JSONString()
+	config.OptionMap["ModelCapabilityCheckEnabled"] = strconv.FormatBool(config.ModelCapabilityCheckEnabled)
+	config.OptionMap["StrictResponseValidationEnabled"] = strconv.FormatBool(config.StrictResponseValidationEnabled)
+	config.OptionMap["StructuredOutputValidationEnabled"] = strconv.FormatBool(config.StructuredOutputValidationEnabled)
+	config.OptionMap["ChatImageRehostEnabled"] = strconv.FormatBool(config.ChatImageRehostEnabled)
+	config.OptionMap["ModelCapability"] = modelinfo.ModelCapability2JSONString()
+	config.OptionMap["ModelTokenizer"] = modelinfo.ModelTokenizer2JSONString()
+	config.OptionMap["PromptCompressionEnabled"] = strconv.FormatBool(config.PromptCompressionEnabled)
+	config.OptionMap["PromptCompressionModel"] = config.PromptCompressionModel
+	config.OptionMap["PromptCompressionGroupThreshold"] = "{}"
+	config.OptionMap["GroupStreamPolicy"] = "{}"
+	config.OptionMap["GroupContentPolicy"] = "{}"
+	config.OptionMap["ContentPolicyProfiles"] = contentpolicy.Profiles2JSONString()
+	config.OptionMap["ContentModerationModel"] = config.ContentModerationModel
+	config.OptionMap["UserFileStorageQuota"] = strconv.FormatInt(config.UserFileStorageQuota, 10)
+	config.OptionMap["SandboxRequestRateLimit"] = strconv.Itoa(config.SandboxRequestRateLimit)
+	config.OptionMap["SandboxDailyQuota"] = strconv.FormatInt(config.SandboxDailyQuota, 10)
+	config.OptionMap["SandboxMaxTokens"] = strconv.Itoa(config.SandboxMaxTokens)
+	config.OptionMap["SandboxWatermark"] = config.SandboxWatermark
+	config.OptionMap["ModelCandidateEmulation"] = "{}"
+	config.OptionMap["ModelBodyCapturePolicy"] = "{}"
+	config.OptionMap["ModelExperiments"] = "{}"
 	config.OptionMapRWMutex.Unlock()
 	loadOptionsFromDatabase()
+	initStreamTraceSecret()
+}
+
+// initStreamTraceSecret generates StreamTraceSecret unless it's saved, the instances starting at the same time
+// all take the one saved first
+func initStreamTraceSecret() {
+	if config.StreamTraceSecret != "" {
+		return
+	}
+	err := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&Option{Key: "StreamTraceSecret", Value: random.GetRandomString(32)}).Error
+	if err != nil {
+		logger.SysError("failed to save the stream trace secret: " + err.Error())
+		return
+	}
+	option := Option{}
+	err = DB.Where(&Option{Key: "StreamTraceSecret"}).First(&option).Error
+	if err != nil {
+		logger.SysError("failed to load the stream trace secret: " + err.Error())
+		return
+	}
+	_ = updateOptionMap(option.Key, option.Value)
 }
 
 func loadOptionsFromDatabase() {
@@ -140,6 +207,8 @@ func updateOptionMap(key string, value string) (err error) {
 			config.EmailDomainRestrictionEnabled = boolValue
 		case "AutomaticDisableChannelEnabled":
 			config.AutomaticDisableChannelEnabled = boolValue
+		case "KeySweepAutoDisableEnabled":
+			config.KeySweepAutoDisableEnabled = boolValue
 		case "AutomaticEnableChannelEnabled":
 			config.AutomaticEnableChannelEnabled = boolValue
 		case "ApproximateTokenEnabled":
@@ -150,6 +219,30 @@ func updateOptionMap(key string, value string) (err error) {
 			config.DisplayInCurrencyEnabled = boolValue
 		case "DisplayTokenStatEnabled":
 			config.DisplayTokenStatEnabled = boolValue
+		case "ModelNameNormalizationEnabled":
+			config.ModelNameNormalizationEnabled = boolValue
+		case "ContextWindowCheckEnabled":
+			config.ContextWindowCheckEnabled = boolValue
+		case "ModelCapabilityCheckEnabled":
+			config.ModelCapabilityCheckEnabled = boolValue
+		case "StrictResponseValidationEnabled":
+			config.StrictResponseValidationEnabled = boolValue
+		case "StructuredOutputValidationEnabled":
+			config.StructuredOutputValidationEnabled = boolValue
+		case "ChatImageRehostEnabled":
+			config.ChatImageRehostEnabled = boolValue
+		case "QuotaTransferEnabled":
+			config.QuotaTransferEnabled = boolValue
+		case "PublicStatusEnabled":
+			config.PublicStatusEnabled = boolValue
+		case "StreamTraceEnabled":
+			config.StreamTraceEnabled = boolValue
+		case "TokenWebhookEnabled":
+			config.TokenWebhookEnabled = boolValue
+		case "SlowRequestBodyCaptureEnabled":
+			config.SlowRequestBodyCaptureEnabled = boolValue
+		case "PromptCompressionEnabled":
+			config.PromptCompressionEnabled = boolValue
 		}
 	}
 	switch key {
@@ -204,16 +297,37 @@ func updateOptionMap(key string, value string) (err error) {
 		config.QuotaForInvitee, _ = strconv.ParseInt(value, 10, 64)
 	case "QuotaRemindThreshold":
 		config.QuotaRemindThreshold, _ = strconv.ParseInt(value, 10, 64)
+	case "QuotaTransferMaxQuota":
+		config.QuotaTransferMaxQuota, _ = strconv.ParseInt(value, 10, 64)
+	case "QuotaTransferDailyMaxQuota":
+		config.QuotaTransferDailyMaxQuota, _ = strconv.ParseInt(value, 10, 64)
 	case "PreConsumedQuota":
 		config.PreConsumedQuota, _ = strconv.ParseInt(value, 10, 64)
 	case "RetryTimes":
 		config.RetryTimes, _ = strconv.Atoi(value)
+	case "RetryBaseDelay":
+		config.RetryBaseDelay, _ = strconv.Atoi(value)
+	case "RetryMaxDelay":
+		config.RetryMaxDelay, _ = strconv.Atoi(value)
+	case "RetryJitter":
+		config.RetryJitter, _ = strconv.ParseFloat(value, 64)
+	case "RetryStatusCodes":
+		_, err = ParseStatusCodes(value)
+		if err == nil {
+			config.RetryStatusCodes = value
+		}
+	case "GlobalSpendRateLimit":
+		config.GlobalSpendRateLimit, _ = strconv.ParseInt(value, 10, 64)
+	case "SlowRequestThreshold":
+		config.SlowRequestThreshold, _ = strconv.Atoi(value)
 	case "ModelRatio":
 		err = billingratio.UpdateModelRatioByJSONString(value)
 	case "GroupRatio":
 		err = billingratio.UpdateGroupRatioByJSONString(value)
 	case "CompletionRatio":
 		err = billingratio.UpdateCompletionRatioByJSONString(value)
+	case "ChatImagePrice":
+		err = billingratio.UpdateChatImagePriceByJSONString(value)
 	case "TopUpLink":
 		config.TopUpLink = value
 	case "ChatLink":
@@ -224,6 +338,73 @@ func updateOptionMap(key string, value string) (err error) {
 		config.QuotaPerUnit, _ = strconv.ParseFloat(value, 64)
 	case "Theme":
 		config.Theme = value
+	case "StreamTraceSecret":
+		config.StreamTraceSecret = value
+	case "PromptCompressionModel":
+		config.PromptCompressionModel = value
+	case "PromptCompressionGroupThreshold":
+		threshold := make(map[string]int)
+		err = json.Unmarshal([]byte(value), &threshold)
+		if err == nil {
+			config.PromptCompressionGroupThresholdLock.Lock()
+			config.PromptCompressionGroupThreshold = threshold
+			config.PromptCompressionGroupThresholdLock.Unlock()
+		}
+	case "ContextWindow":
+		err = modelinfo.UpdateContextWindowByJSONString(value)
+	case "ModelCapability":
+		err = modelinfo.UpdateModelCapabilityByJSONString(value)
+	case "ModelTokenizer":
+		err = modelinfo.UpdateModelTokenizerByJSONString(value)
+	case "GroupStreamPolicy":
+		policy := make(map[string]string)
+		err = json.Unmarshal([]byte(value), &policy)
+		if err == nil {
+			config.GroupStreamPolicy = policy
+		}
+	case "GroupContentPolicy":
+		policy := make(map[string]string)
+		err = json.Unmarshal([]byte(value), &policy)
+		if err == nil {
+			config.GroupContentPolicy = policy
+		}
+	case "ContentPolicyProfiles":
+		err = contentpolicy.UpdateProfilesByJSONString(value)
+	case "ContentModerationModel":
+		config.ContentModerationModel = value
+	case "UserFileStorageQuota":
+		config.UserFileStorageQuota, _ = strconv.ParseInt(value, 10, 64)
+	case "SandboxRequestRateLimit":
+		config.SandboxRequestRateLimit, _ = strconv.Atoi(value)
+	case "SandboxDailyQuota":
+		config.SandboxDailyQuota, _ = strconv.ParseInt(value, 10, 64)
+	case "SandboxMaxTokens":
+		config.SandboxMaxTokens, _ = strconv.Atoi(value)
+	case "SandboxWatermark":
+		config.SandboxWatermark = value
+	case "ModelCandidateEmulation":
+		emulation := make(map[string]int)
+		err = json.Unmarshal([]byte(value), &emulation)
+		if err == nil {
+			config.ModelCandidateEmulation = emulation
+		}
+	case "ModelBodyCapturePolicy":
+		policy := make(map[string]config.BodyCapturePolicy)
+		err = json.Unmarshal([]byte(value), &policy)
+		if err == nil {
+			config.ModelBodyCapturePolicy = policy
+		}
+	case "ModelExperiments":
+		experiments := make(map[string]config.ModelExperiment)
+		err = json.Unmarshal([]byte(value), &experiments)
+		if err == nil {
+			for modelName, experiment := range experiments {
+				if experiment.TreatmentPercent < 0 || experiment.TreatmentPercent > 100 {
+					return fmt.Errorf("treatment_percent of experiment on %s should be between 0 and 100", modelName)
+				}
+			}
+			config.ModelExperiments = experiments
+		}
 	}
 	return err
 }
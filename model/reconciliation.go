@@ -0,0 +1,218 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"gorm.io/gorm"
+)
+
+const (
+	QuotaDriftTypeUserQuota        = "user_quota"
+	QuotaDriftTypeUserUsedQuota    = "user_used_quota"
+	QuotaDriftTypeChannelUsedQuota = "channel_used_quota"
+)
+
+// users with ledger entries in this many seconds may have requests in flight, they are checked next time
+const reconciliationIdleSeconds = 10 * 60
+
+const reconciliationBatchSize = 500
+
+type QuotaDrift struct {
+	Type     string `json:"type"`
+	Id       int    `json:"id"`
+	Recorded int64  `json:"recorded"`
+	Expected int64  `json:"expected"`
+	Fixed    bool   `json:"fixed"`
+}
+
+type userLedgerSummary struct {
+	Delta         int64
+	ConsumeDelta  int64
+	LastLedgerId  int
+	LastCreatedAt int64
+}
+
+// ReconcileQuotas compares the quotas of users with their latest snapshot plus the ledger entries after it,
+// and the used quotas of channels with the consume logs, then takes a new snapshot of every user without drift.
+// If fix is true, drifted used quotas are overwritten with the recomputed value,
+// drifted balances are only reported because the ledger could be the wrong side.
+// Fixing is refused while the consume logs are off, the usage they would have recorded is unknown.
+func ReconcileQuotas(fix bool) (drifts []*QuotaDrift, err error) {
+	if fix && !config.LogConsumeEnabled {
+		return nil, errors.New("消费日志未开启，无法修正额度偏差")
+	}
+	userDrifts, err := reconcileUserQuotas(fix)
+	if err != nil {
+		return nil, err
+	}
+	drifts = append(drifts, userDrifts...)
+	if config.LogConsumeEnabled {
+		channelDrifts, err := reconcileChannelUsedQuotas(fix)
+		if err != nil {
+			return nil, err
+		}
+		drifts = append(drifts, channelDrifts...)
+	}
+	for _, drift := range drifts {
+		logger.SysError(fmt.Sprintf("quota drift found: type=%s, id=%d, recorded=%d, expected=%d, fixed=%t", drift.Type, drift.Id, drift.Recorded, drift.Expected, drift.Fixed))
+	}
+	return drifts, nil
+}
+
+func reconcileUserQuotas(fix bool) (drifts []*QuotaDrift, err error) {
+	now := helper.GetTimestamp()
+	var users []*User
+	err = DB.Model(&User{}).Select("id", "quota", "used_quota").FindInBatches(&users, reconciliationBatchSize, func(tx *gorm.DB, batch int) error {
+		snapshots := make([]*QuotaSnapshot, 0, len(users))
+		for _, user := range users {
+			userDrifts, snapshot, err := reconcileUserQuota(user, now, fix)
+			if err != nil {
+				return err
+			}
+			drifts = append(drifts, userDrifts...)
+			if snapshot != nil {
+				snapshots = append(snapshots, snapshot)
+			}
+		}
+		if len(snapshots) == 0 {
+			return nil
+		}
+		return DB.Create(&snapshots).Error
+	}).Error
+	return drifts, err
+}
+
+// reconcileUserQuota returns the drifts of the user and the new snapshot to take, if any
+func reconcileUserQuota(user *User, now int64, fix bool) ([]*QuotaDrift, *QuotaSnapshot, error) {
+	lastSnapshot := QuotaSnapshot{}
+	err := DB.Where("user_id = ?", user.Id).Order("id desc").Limit(1).Find(&lastSnapshot).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	summary := userLedgerSummary{}
+	err = DB.Model(&QuotaLedger{}).Where("user_id = ? AND id > ?", user.Id, lastSnapshot.LedgerId).Select(
+		"COALESCE(SUM(delta), 0) AS delta, "+
+			"COALESCE(SUM(CASE WHEN type IN (?, ?, ?) THEN delta ELSE 0 END), 0) AS consume_delta, "+
+			"COALESCE(MAX(id), 0) AS last_ledger_id, COALESCE(MAX(created_at), 0) AS last_created_at",
+		LedgerTypePreConsume, LedgerTypePostConsume, LedgerTypeRefund,
+	).Scan(&summary).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	if summary.LastCreatedAt > now-reconciliationIdleSeconds {
+		return nil, nil, nil
+	}
+	snapshot := &QuotaSnapshot{
+		UserId:    user.Id,
+		Quota:     user.Quota,
+		UsedQuota: user.UsedQuota,
+		LedgerId:  lastSnapshot.LedgerId,
+		CreatedAt: now,
+	}
+	if summary.LastLedgerId > snapshot.LedgerId {
+		snapshot.LedgerId = summary.LastLedgerId
+	}
+	if lastSnapshot.Id == 0 {
+		// nothing to compare with yet
+		return nil, snapshot, nil
+	}
+	var drifts []*QuotaDrift
+	expectedQuota := lastSnapshot.Quota + summary.Delta
+	if user.Quota != expectedQuota {
+		drifts = append(drifts, &QuotaDrift{
+			Type:     QuotaDriftTypeUserQuota,
+			Id:       user.Id,
+			Recorded: user.Quota,
+			Expected: expectedQuota,
+		})
+	}
+	expectedUsedQuota := lastSnapshot.UsedQuota - summary.ConsumeDelta
+	if user.UsedQuota != expectedUsedQuota {
+		drift := &QuotaDrift{
+			Type:     QuotaDriftTypeUserUsedQuota,
+			Id:       user.Id,
+			Recorded: user.UsedQuota,
+			Expected: expectedUsedQuota,
+		}
+		if fix {
+			err = DB.Model(&User{}).Where("id = ?", user.Id).Update("used_quota", expectedUsedQuota).Error
+			if err != nil {
+				return nil, nil, err
+			}
+			drift.Fixed = true
+			snapshot.UsedQuota = expectedUsedQuota
+		}
+		drifts = append(drifts, drift)
+	}
+	for _, drift := range drifts {
+		if !drift.Fixed {
+			// keep comparing with the old snapshot, so that the drift is reported until someone looks into it
+			return drifts, nil, nil
+		}
+	}
+	return drifts, snapshot, nil
+}
+
+// reconcileChannelUsedQuotas relies on the consume logs. The log is written before the used quota is updated,
+// so only a used quota lower than the logs is fixed, a higher one usually means history logs were deleted
+func reconcileChannelUsedQuotas(fix bool) (drifts []*QuotaDrift, err error) {
+	var consumed []struct {
+		ChannelId int
+		Quota     int64
+	}
+	err = LOG_DB.Model(&Log{}).Where("type = ?", LogTypeConsume).
+		Select("channel_id, COALESCE(SUM(quota), 0) AS quota").Group("channel_id").Scan(&consumed).Error
+	if err != nil {
+		return nil, err
+	}
+	expected := make(map[int]int64, len(consumed))
+	for _, item := range consumed {
+		expected[item.ChannelId] = item.Quota
+	}
+	var channels []*Channel
+	err = DB.Select("id", "used_quota").Find(&channels).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, channel := range channels {
+		if channel.UsedQuota == expected[channel.Id] {
+			continue
+		}
+		drift := &QuotaDrift{
+			Type:     QuotaDriftTypeChannelUsedQuota,
+			Id:       channel.Id,
+			Recorded: channel.UsedQuota,
+			Expected: expected[channel.Id],
+		}
+		if fix && drift.Recorded < drift.Expected {
+			err = DB.Model(&Channel{}).Where("id = ?", channel.Id).Update("used_quota", drift.Expected).Error
+			if err != nil {
+				return nil, err
+			}
+			drift.Fixed = true
+		}
+		drifts = append(drifts, drift)
+	}
+	return drifts, nil
+}
+
+func AutomaticallyReconcileQuotas(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		logger.SysLog("reconciling quotas")
+		fix := config.QuotaReconciliationAutoFix
+		if fix && !config.LogConsumeEnabled {
+			logger.SysError("consume logs are disabled, quota drifts are only reported")
+			fix = false
+		}
+		_, err := ReconcileQuotas(fix)
+		if err != nil {
+			logger.SysError("failed to reconcile quotas: " + err.Error())
+		}
+	}
+}
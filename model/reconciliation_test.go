@@ -0,0 +1,135 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+func TestReconcileQuotas(t *testing.T) {
+	Convey("ReconcileQuotas", t, func() {
+		useTestDB(t)
+		oldLogConsumeEnabled := config.LogConsumeEnabled
+		config.LogConsumeEnabled = true
+		t.Cleanup(func() {
+			config.LogConsumeEnabled = oldLogConsumeEnabled
+		})
+		now := helper.GetTimestamp()
+		old := now - 3600
+		// every user had 1000 and consumed 100 since the snapshot, user 4 just now
+		for id, balance := range map[int][2]int64{
+			1: {900, 100}, // consistent
+			2: {900, 150}, // used quota drifted
+			3: {950, 100}, // quota drifted
+			4: {900, 300}, // drifted but busy
+		} {
+			createTestUser(t, id, balance[0])
+			So(DB.Model(&User{}).Where("id = ?", id).Update("used_quota", balance[1]).Error, ShouldBeNil)
+			So(DB.Create(&QuotaSnapshot{UserId: id, Quota: 1000, CreatedAt: old - 1}).Error, ShouldBeNil)
+			createdAt := old
+			if id == 4 {
+				createdAt = now
+			}
+			So(DB.Create(&QuotaLedger{UserId: id, Type: LedgerTypePostConsume, Delta: -100, CreatedAt: createdAt}).Error, ShouldBeNil)
+		}
+		for id, usage := range map[int][2]int64{
+			1: {100, 100}, // consistent
+			2: {50, 80},   // lower than the logs
+			3: {200, 100}, // higher than the logs
+		} {
+			So(DB.Create(&Channel{Id: id, Name: fmt.Sprintf("channel%d", id), Key: "key", UsedQuota: usage[0]}).Error, ShouldBeNil)
+			So(LOG_DB.Create(&Log{Type: LogTypeConsume, ChannelId: id, Quota: int(usage[1])}).Error, ShouldBeNil)
+		}
+		reconcile := func(fix bool) map[string]*QuotaDrift {
+			drifts, err := ReconcileQuotas(fix)
+			So(err, ShouldBeNil)
+			found := make(map[string]*QuotaDrift, len(drifts))
+			for _, drift := range drifts {
+				found[fmt.Sprintf("%s/%d", drift.Type, drift.Id)] = drift
+			}
+			So(found, ShouldHaveLength, len(drifts))
+			return found
+		}
+		usedQuota := func(id int) int64 {
+			user := User{}
+			So(DB.First(&user, id).Error, ShouldBeNil)
+			return user.UsedQuota
+		}
+		channelUsedQuota := func(id int) int64 {
+			channel := Channel{}
+			So(DB.First(&channel, id).Error, ShouldBeNil)
+			return channel.UsedQuota
+		}
+		snapshots := func(id int) int64 {
+			var count int64
+			So(DB.Model(&QuotaSnapshot{}).Where("user_id = ?", id).Count(&count).Error, ShouldBeNil)
+			return count
+		}
+
+		Convey("the drifts are reported", func() {
+			drifts := reconcile(false)
+			So(drifts, ShouldHaveLength, 4)
+			So(*drifts["user_used_quota/2"], ShouldResemble, QuotaDrift{Type: QuotaDriftTypeUserUsedQuota, Id: 2, Recorded: 150, Expected: 100})
+			So(*drifts["user_quota/3"], ShouldResemble, QuotaDrift{Type: QuotaDriftTypeUserQuota, Id: 3, Recorded: 950, Expected: 900})
+			So(*drifts["channel_used_quota/2"], ShouldResemble, QuotaDrift{Type: QuotaDriftTypeChannelUsedQuota, Id: 2, Recorded: 50, Expected: 80})
+			So(*drifts["channel_used_quota/3"], ShouldResemble, QuotaDrift{Type: QuotaDriftTypeChannelUsedQuota, Id: 3, Recorded: 200, Expected: 100})
+			// only the consistent user moves on to a new snapshot
+			So(snapshots(1), ShouldEqual, 2)
+			So(snapshots(2), ShouldEqual, 1)
+			So(snapshots(3), ShouldEqual, 1)
+			So(usedQuota(2), ShouldEqual, 150)
+			So(channelUsedQuota(2), ShouldEqual, 50)
+		})
+
+		Convey("the busy users are checked next time", func() {
+			drifts := reconcile(false)
+			So(drifts, ShouldNotContainKey, "user_used_quota/4")
+			So(snapshots(4), ShouldEqual, 1)
+		})
+
+		Convey("only the drifted used quotas are fixed", func() {
+			drifts := reconcile(true)
+			So(drifts, ShouldHaveLength, 4)
+			So(drifts["user_used_quota/2"].Fixed, ShouldBeTrue)
+			So(drifts["user_quota/3"].Fixed, ShouldBeFalse)
+			So(drifts["channel_used_quota/2"].Fixed, ShouldBeTrue)
+			So(drifts["channel_used_quota/3"].Fixed, ShouldBeFalse)
+			So(usedQuota(1), ShouldEqual, 100)
+			So(usedQuota(2), ShouldEqual, 100)
+			So(usedQuota(3), ShouldEqual, 100)
+			So(usedQuota(4), ShouldEqual, 300)
+			user := User{}
+			So(DB.First(&user, 3).Error, ShouldBeNil)
+			So(user.Quota, ShouldEqual, 950)
+			So(channelUsedQuota(1), ShouldEqual, 100)
+			So(channelUsedQuota(2), ShouldEqual, 80)
+			So(channelUsedQuota(3), ShouldEqual, 200)
+			So(snapshots(2), ShouldEqual, 2)
+			So(snapshots(3), ShouldEqual, 1)
+
+			// nothing left to fix
+			drifts = reconcile(true)
+			So(drifts, ShouldHaveLength, 2)
+			So(drifts, ShouldContainKey, "user_quota/3")
+			So(drifts, ShouldContainKey, "channel_used_quota/3")
+		})
+
+		Convey("nothing is fixed without the consume logs", func() {
+			config.LogConsumeEnabled = false
+			_, err := ReconcileQuotas(true)
+			So(err, ShouldNotBeNil)
+			So(usedQuota(2), ShouldEqual, 150)
+			So(channelUsedQuota(2), ShouldEqual, 50)
+			So(snapshots(1), ShouldEqual, 1)
+
+			// the channels are only checked against the logs
+			drifts := reconcile(false)
+			So(drifts, ShouldHaveLength, 2)
+			So(drifts, ShouldContainKey, "user_used_quota/2")
+			So(drifts, ShouldContainKey, "user_quota/3")
+		})
+	})
+}
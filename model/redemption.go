@@ -74,6 +74,10 @@ func Redeem(key string, userId int) (quota int64, err error) {
 		if err != nil {
 			return err
 		}
+		err = recordQuotaLedgerWithTx(tx, userId, 0, LedgerTypeTopUp, redemption.Quota, fmt.Sprintf("兑换码 %d", redemption.Id))
+		if err != nil {
+			return err
+		}
 		redemption.RedeemedTime = helper.GetTimestamp()
 		redemption.Status = RedemptionCodeStatusUsed
 		err = tx.Save(redemption).Error
@@ -0,0 +1,232 @@
+package model
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// the entries of the last this many seconds are pulled again on every sync, an entry committed late by a slow
+// transaction has a smaller id than those already pulled, it's applied by the next sync instead of skipped
+const regionLedgerRescanSeconds = 600
+
+// RegionCursor is the id of the latest ledger entry of another region applied to this one
+type RegionCursor struct {
+	Region       string `json:"region" gorm:"primaryKey"`
+	LastOriginId int    `json:"last_origin_id"`
+	UpdatedAt    int64  `json:"updated_at" gorm:"bigint"`
+}
+
+// GetLocalQuotaLedgersAfter returns the entries of this region, never the ones replicated from other regions,
+// so that each change is applied exactly once in every region
+func GetLocalQuotaLedgersAfter(afterId int, num int) (ledgers []*QuotaLedger, err error) {
+	err = DB.Where("region = ? AND id > ?", "", afterId).Order("id").Limit(num).Find(&ledgers).Error
+	if err != nil {
+		return nil, err
+	}
+	return ledgers, fillRegionLedgerKeys(ledgers)
+}
+
+// regionTokenKeyHash identifies a token in every region, it's keyed by the secret shared by the regions
+// so that the hashes are of no use to anyone else
+func regionTokenKeyHash(key string) string {
+	mac := hmac.New(sha256.New, []byte(config.RegionSyncSecret))
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// fillRegionLedgerKeys sets the username and the token key hash of the entries
+func fillRegionLedgerKeys(ledgers []*QuotaLedger) error {
+	var userIds, tokenIds []int
+	for _, ledger := range ledgers {
+		userIds = append(userIds, ledger.UserId)
+		if ledger.TokenId != 0 {
+			tokenIds = append(tokenIds, ledger.TokenId)
+		}
+	}
+	if len(userIds) == 0 {
+		return nil
+	}
+	var users []*User
+	err := DB.Select("id", "username").Where("id IN ?", userIds).Find(&users).Error
+	if err != nil {
+		return err
+	}
+	usernames := make(map[int]string)
+	for _, user := range users {
+		usernames[user.Id] = user.Username
+	}
+	tokenKeys := make(map[int]string)
+	if len(tokenIds) > 0 {
+		var tokens []*Token
+		err = DB.Select("id", "key").Where("id IN ?", tokenIds).Find(&tokens).Error
+		if err != nil {
+			return err
+		}
+		for _, token := range tokens {
+			tokenKeys[token.Id] = regionTokenKeyHash(token.Key)
+		}
+	}
+	for _, ledger := range ledgers {
+		ledger.Username = usernames[ledger.UserId]
+		ledger.TokenKeyHash = tokenKeys[ledger.TokenId]
+	}
+	return nil
+}
+
+func GetRegionCursor(region string) (int, error) {
+	cursor := RegionCursor{}
+	err := DB.Where("region = ?", region).Limit(1).Find(&cursor).Error
+	return cursor.LastOriginId, err
+}
+
+// GetRegionRescanStart returns the id after which the ledger of the region is pulled, it's the latest entry
+// applied here which is older than the rescan window, the entries after it which are applied already are skipped
+func GetRegionRescanStart(region string) (int, error) {
+	var start int
+	err := DB.Model(&QuotaLedger{}).Select("COALESCE(MAX(origin_id),0)").
+		Where("region = ? AND created_at < ?", region, helper.GetTimestamp()-regionLedgerRescanSeconds).Scan(&start).Error
+	return start, err
+}
+
+func GetRegionCursors() (cursors []*RegionCursor, err error) {
+	err = DB.Order("region").Find(&cursors).Error
+	return cursors, err
+}
+
+// ApplyRegionQuotaLedgers applies the quota changes of another region to the local balances. The entries are
+// copied to the local ledger in the same transaction, an entry already copied is skipped, so a change is never applied twice.
+// Changes only add up, their order doesn't matter, so regions converge whenever they have pulled from each other.
+func ApplyRegionQuotaLedgers(region string, ledgers []*QuotaLedger) error {
+	if len(ledgers) == 0 {
+		return nil
+	}
+	userIds := make(map[int]bool)
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		lastOriginId, err := getRegionCursorWithTx(tx, region)
+		if err != nil {
+			return err
+		}
+		for _, ledger := range ledgers {
+			var replicas int64
+			err = tx.Model(&QuotaLedger{}).Where("region = ? AND origin_id = ?", region, ledger.Id).Count(&replicas).Error
+			if err != nil {
+				return err
+			}
+			if replicas > 0 {
+				continue
+			}
+			userId, tokenId, err := resolveRegionLedgerWithTx(tx, ledger)
+			if err != nil {
+				return err
+			}
+			applied := false
+			if userId != 0 && (ledger.TokenId == 0 || tokenId != 0) {
+				applied, err = applyRegionQuotaLedgerWithTx(tx, ledger, userId, tokenId)
+				if err != nil {
+					return err
+				}
+			}
+			if !applied {
+				logger.SysError(fmt.Sprintf("quota ledger %d of region %s refers to user %q or its token not found in this region", ledger.Id, region, ledger.Username))
+			}
+			userIds[userId] = true
+			// the entry is kept even if it couldn't be applied, so that it's not tried again
+			replica := newQuotaLedger(userId, tokenId, ledger.Type, ledger.Delta, ledger.Remark)
+			replica.CreatedAt = ledger.CreatedAt
+			replica.Region = region
+			replica.OriginId = ledger.Id
+			err = tx.Create(replica).Error
+			if err != nil {
+				return err
+			}
+			if ledger.Id > lastOriginId {
+				lastOriginId = ledger.Id
+			}
+		}
+		return tx.Save(&RegionCursor{Region: region, LastOriginId: lastOriginId, UpdatedAt: helper.GetTimestamp()}).Error
+	})
+	if err != nil {
+		return err
+	}
+	if common.RedisEnabled {
+		for userId := range userIds {
+			if userId == 0 {
+				continue
+			}
+			_, err = fetchAndUpdateUserQuota(context.Background(), userId)
+			if err != nil {
+				logger.SysError("error update user quota cache: " + err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+func getRegionCursorWithTx(tx *gorm.DB, region string) (int, error) {
+	cursor := RegionCursor{}
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("region = ?", region).Limit(1).Find(&cursor).Error
+	return cursor.LastOriginId, err
+}
+
+// resolveRegionLedgerWithTx finds the local ids of the user and the token of an entry of another region,
+// the ids are 0 if they don't exist here. The token must belong to the user.
+func resolveRegionLedgerWithTx(tx *gorm.DB, ledger *QuotaLedger) (userId int, tokenId int, err error) {
+	if ledger.Username == "" {
+		return 0, 0, nil
+	}
+	user := User{}
+	err = tx.Select("id").Where("username = ?", ledger.Username).Limit(1).Find(&user).Error
+	if err != nil || user.Id == 0 || ledger.TokenKeyHash == "" {
+		return user.Id, 0, err
+	}
+	var tokens []*Token
+	err = tx.Select("id", "key").Where("user_id = ?", user.Id).Find(&tokens).Error
+	if err != nil {
+		return user.Id, 0, err
+	}
+	for _, token := range tokens {
+		if hmac.Equal([]byte(regionTokenKeyHash(token.Key)), []byte(ledger.TokenKeyHash)) {
+			return user.Id, token.Id, nil
+		}
+	}
+	return user.Id, 0, nil
+}
+
+// applyRegionQuotaLedgerWithTx changes the balances the same way the entry did in its region,
+// it returns false if the user or the token doesn't exist here
+func applyRegionQuotaLedgerWithTx(tx *gorm.DB, ledger *QuotaLedger, userId int, tokenId int) (bool, error) {
+	if ledger.Type == LedgerTypeTransfer && tokenId != 0 {
+		// between two tokens of a user, the balance of the user is not affected
+		result := tx.Model(&Token{}).Where("id = ? AND user_id = ?", tokenId, userId).Update("remain_quota", gorm.Expr("remain_quota + ?", ledger.Delta))
+		return result.RowsAffected > 0, result.Error
+	}
+	isConsume := ledger.Type == LedgerTypePreConsume || ledger.Type == LedgerTypePostConsume || ledger.Type == LedgerTypeRefund
+	userUpdates := map[string]any{
+		"quota": gorm.Expr("quota + ?", ledger.Delta),
+	}
+	if isConsume {
+		userUpdates["used_quota"] = gorm.Expr("used_quota - ?", ledger.Delta)
+	}
+	result := tx.Model(&User{}).Where("id = ?", userId).Updates(userUpdates)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	if !isConsume || tokenId == 0 {
+		return true, nil
+	}
+	err := tx.Model(&Token{}).Where("id = ? AND user_id = ? AND unlimited_quota = ?", tokenId, userId, false).Updates(map[string]any{
+		"remain_quota": gorm.Expr("remain_quota + ?", ledger.Delta),
+		"used_quota":   gorm.Expr("used_quota - ?", ledger.Delta),
+	}).Error
+	return true, err
+}
@@ -0,0 +1,116 @@
+package model
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+func TestApplyRegionQuotaLedgers(t *testing.T) {
+	Convey("ApplyRegionQuotaLedgers", t, func() {
+		useTestDB(t)
+		// user 1 of the other region is user 5 here, user 1 here is someone else
+		createTestUser(t, 1, 1000)
+		createTestUser(t, 5, 1000)
+		So(DB.Create(&Token{Id: 1, UserId: 1, Key: "other", RemainQuota: 1000}).Error, ShouldBeNil)
+		So(DB.Create(&Token{Id: 9, UserId: 5, Key: "shared", RemainQuota: 1000}).Error, ShouldBeNil)
+		balances := func() (int64, int64, int64, int64) {
+			user1, user5 := User{}, User{}
+			token1, token9 := Token{}, Token{}
+			So(DB.First(&user1, 1).Error, ShouldBeNil)
+			So(DB.First(&user5, 5).Error, ShouldBeNil)
+			So(DB.First(&token1, 1).Error, ShouldBeNil)
+			So(DB.First(&token9, 9).Error, ShouldBeNil)
+			return user1.Quota, user5.Quota, token1.RemainQuota, token9.RemainQuota
+		}
+		consume := &QuotaLedger{Id: 3, UserId: 1, TokenId: 1, Type: LedgerTypePostConsume, Delta: -10, Username: "user5", TokenKeyHash: regionTokenKeyHash("shared")}
+
+		Convey("applies the entries by the username and the token key", func() {
+			So(ApplyRegionQuotaLedgers("us", []*QuotaLedger{consume}), ShouldBeNil)
+			user1, user5, token1, token9 := balances()
+			So(user1, ShouldEqual, 1000)
+			So(user5, ShouldEqual, 990)
+			So(token1, ShouldEqual, 1000)
+			So(token9, ShouldEqual, 990)
+
+			replica := QuotaLedger{}
+			So(DB.Where("region = ?", "us").First(&replica).Error, ShouldBeNil)
+			So(replica.UserId, ShouldEqual, 5)
+			So(replica.TokenId, ShouldEqual, 9)
+			So(replica.OriginId, ShouldEqual, 3)
+		})
+
+		Convey("applies each entry once", func() {
+			So(ApplyRegionQuotaLedgers("us", []*QuotaLedger{consume}), ShouldBeNil)
+			So(ApplyRegionQuotaLedgers("us", []*QuotaLedger{consume}), ShouldBeNil)
+			_, user5, _, token9 := balances()
+			So(user5, ShouldEqual, 990)
+			So(token9, ShouldEqual, 990)
+			lastOriginId, err := GetRegionCursor("us")
+			So(err, ShouldBeNil)
+			So(lastOriginId, ShouldEqual, 3)
+		})
+
+		Convey("doesn't touch the tokens of other users", func() {
+			transfer := &QuotaLedger{Id: 4, UserId: 7, TokenId: 1, Type: LedgerTypeTransfer, Delta: 100, Username: "user1", TokenKeyHash: regionTokenKeyHash("shared")}
+			So(ApplyRegionQuotaLedgers("us", []*QuotaLedger{transfer}), ShouldBeNil)
+			user1, user5, token1, token9 := balances()
+			So(user1, ShouldEqual, 1000)
+			So(user5, ShouldEqual, 1000)
+			So(token1, ShouldEqual, 1000)
+			So(token9, ShouldEqual, 1000)
+			lastOriginId, err := GetRegionCursor("us")
+			So(err, ShouldBeNil)
+			So(lastOriginId, ShouldEqual, 4)
+		})
+	})
+}
+
+func TestGetLocalQuotaLedgersAfter(t *testing.T) {
+	Convey("GetLocalQuotaLedgersAfter", t, func() {
+		useTestDB(t)
+		createTestUser(t, 5, 1000)
+		So(DB.Create(&Token{Id: 9, UserId: 5, Key: "shared"}).Error, ShouldBeNil)
+		So(DB.Create(&QuotaLedger{UserId: 5, TokenId: 9, Type: LedgerTypePostConsume, Delta: -10, CreatedAt: 1}).Error, ShouldBeNil)
+		So(DB.Create(&QuotaLedger{UserId: 5, Type: LedgerTypeTopUp, Delta: 10, CreatedAt: 1, Region: "us", OriginId: 1}).Error, ShouldBeNil)
+
+		ledgers, err := GetLocalQuotaLedgersAfter(0, 10)
+		So(err, ShouldBeNil)
+		So(ledgers, ShouldHaveLength, 1)
+		So(ledgers[0].Username, ShouldEqual, "user5")
+		// the key never leaves its region
+		So(ledgers[0].TokenKeyHash, ShouldEqual, regionTokenKeyHash("shared"))
+		So(ledgers[0].TokenKeyHash, ShouldNotContainSubstring, "shared")
+	})
+}
+
+func TestRegionLedgerLateCommit(t *testing.T) {
+	Convey("an entry committed after a later one was pulled is applied by the next sync", t, func() {
+		useTestDB(t)
+		createTestUser(t, 5, 1000)
+		now := helper.GetTimestamp()
+		late := &QuotaLedger{Id: 1, Type: LedgerTypeTopUp, Delta: 10, CreatedAt: now - 20, Username: "user5"}
+		pulled := &QuotaLedger{Id: 2, Type: LedgerTypeTopUp, Delta: 20, CreatedAt: now - 10, Username: "user5"}
+		So(ApplyRegionQuotaLedgers("us", []*QuotaLedger{pulled}), ShouldBeNil)
+
+		// the entries of the rescan window are pulled again
+		start, err := GetRegionRescanStart("us")
+		So(err, ShouldBeNil)
+		So(start, ShouldEqual, 0)
+		So(ApplyRegionQuotaLedgers("us", []*QuotaLedger{late, pulled}), ShouldBeNil)
+		user := User{}
+		So(DB.First(&user, 5).Error, ShouldBeNil)
+		So(user.Quota, ShouldEqual, 1030)
+		lastOriginId, err := GetRegionCursor("us")
+		So(err, ShouldBeNil)
+		So(lastOriginId, ShouldEqual, 2)
+
+		// the entries older than the window are no longer pulled
+		old := &QuotaLedger{Id: 3, Type: LedgerTypeTopUp, Delta: 30, CreatedAt: now - regionLedgerRescanSeconds - 10, Username: "user5"}
+		So(ApplyRegionQuotaLedgers("us", []*QuotaLedger{old}), ShouldBeNil)
+		start, err = GetRegionRescanStart("us")
+		So(err, ShouldBeNil)
+		So(start, ShouldEqual, 3)
+	})
+}
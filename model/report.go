@@ -0,0 +1,77 @@
+package model
+
+const (
+	UsageReportDaily  = "daily"
+	UsageReportWeekly = "weekly"
+)
+
+const usageReportTopModels = 5
+
+type ModelUsage struct {
+	ModelName        string `json:"model_name"`
+	RequestCount     int64  `json:"request_count"`
+	Quota            int64  `json:"quota"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+}
+
+type UsageReport struct {
+	StartTimestamp   int64         `json:"start_timestamp"`
+	EndTimestamp     int64         `json:"end_timestamp"`
+	RequestCount     int64         `json:"request_count"`
+	Quota            int64         `json:"quota"`
+	PromptTokens     int64         `json:"prompt_tokens"`
+	CompletionTokens int64         `json:"completion_tokens"`
+	ErrorCount       int64         `json:"error_count"`
+	TopModels        []*ModelUsage `json:"top_models"`
+}
+
+func IsValidUsageReportFrequency(frequency string) bool {
+	return frequency == "" || frequency == UsageReportDaily || frequency == UsageReportWeekly
+}
+
+// GetUsageReport sums up the consume and error logs of the user in [startTimestamp, endTimestamp)
+func GetUsageReport(userId int, startTimestamp int64, endTimestamp int64) (*UsageReport, error) {
+	report := &UsageReport{
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+	}
+	var usages []*ModelUsage
+	err := LOG_DB.Model(&Log{}).
+		Where("user_id = ? AND type = ? AND created_at >= ? AND created_at < ?", userId, LogTypeConsume, startTimestamp, endTimestamp).
+		Select("model_name, count(1) AS request_count, COALESCE(SUM(quota), 0) AS quota, " +
+			"COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens, COALESCE(SUM(completion_tokens), 0) AS completion_tokens").
+		Group("model_name").Order("quota desc").Scan(&usages).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, usage := range usages {
+		report.RequestCount += usage.RequestCount
+		report.Quota += usage.Quota
+		report.PromptTokens += usage.PromptTokens
+		report.CompletionTokens += usage.CompletionTokens
+	}
+	if len(usages) > usageReportTopModels {
+		usages = usages[:usageReportTopModels]
+	}
+	report.TopModels = usages
+	err = LOG_DB.Model(&Log{}).
+		Where("user_id = ? AND type = ? AND created_at >= ? AND created_at < ?", userId, LogTypeError, startTimestamp, endTimestamp).
+		Count(&report.ErrorCount).Error
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func UpdateUserUsageReport(id int, frequency string) error {
+	return DB.Model(&User{}).Where("id = ?", id).Update("usage_report", frequency).Error
+}
+
+// GetUsageReportUsers returns the enabled users with an email who asked for reports of the frequency
+func GetUsageReportUsers(frequency string, startIdx int, num int) (users []*User, err error) {
+	err = DB.Select("id", "username", "display_name", "email").
+		Where("usage_report = ? AND status = ? AND email != ''", frequency, UserStatusEnabled).
+		Order("id").Limit(num).Offset(startIdx).Find(&users).Error
+	return users, err
+}
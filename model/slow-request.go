@@ -0,0 +1,70 @@
+package model
+
+import (
+	"context"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// SlowRequest is a relay request which took longer than the threshold, saved with the timing of each phase
+type SlowRequest struct {
+	Id          int    `json:"id"`
+	CreatedAt   int64  `json:"created_at" gorm:"bigint;index"`
+	RequestId   string `json:"request_id" gorm:"index"`
+	UserId      int    `json:"user_id" gorm:"index"`
+	TokenName   string `json:"token_name" gorm:"default:''"`
+	ChannelId   int    `json:"channel_id" gorm:"index"`
+	ModelName   string `json:"model_name" gorm:"index;default:''"`
+	Path        string `json:"path"`
+	StatusCode  int    `json:"status_code"`
+	Duration    int64  `json:"duration" gorm:"index"` // unit is millisecond
+	Phases      string `json:"phases" gorm:"type:text"`
+	RequestBody string `json:"request_body,omitempty" gorm:"type:text"`
+}
+
+func RecordSlowRequest(ctx context.Context, slowRequest *SlowRequest) {
+	slowRequest.CreatedAt = helper.GetTimestamp()
+	err := LOG_DB.Create(slowRequest).Error
+	if err != nil {
+		logger.Error(ctx, "failed to record slow request: "+err.Error())
+	}
+}
+
+// GetSlowRequests lists the slow requests without their bodies, the slowest first if sorted by duration
+func GetSlowRequests(startTimestamp int64, endTimestamp int64, modelName string, channel int, minDuration int64, orderByDuration bool, startIdx int, num int) (slowRequests []*SlowRequest, err error) {
+	tx := LOG_DB.Omit("request_body")
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	if modelName != "" {
+		tx = tx.Where("model_name = ?", modelName)
+	}
+	if channel != 0 {
+		tx = tx.Where("channel_id = ?", channel)
+	}
+	if minDuration != 0 {
+		tx = tx.Where("duration >= ?", minDuration)
+	}
+	if orderByDuration {
+		tx = tx.Order("duration desc")
+	} else {
+		tx = tx.Order("id desc")
+	}
+	err = tx.Limit(num).Offset(startIdx).Find(&slowRequests).Error
+	return slowRequests, err
+}
+
+func GetSlowRequestById(id int) (*SlowRequest, error) {
+	slowRequest := SlowRequest{}
+	err := LOG_DB.First(&slowRequest, "id = ?", id).Error
+	return &slowRequest, err
+}
+
+func DeleteOldSlowRequests(targetTimestamp int64) (int64, error) {
+	result := LOG_DB.Where("created_at < ?", targetTimestamp).Delete(&SlowRequest{})
+	return result.RowsAffected, result.Error
+}
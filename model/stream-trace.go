@@ -0,0 +1,42 @@
+package model
+
+import (
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"gorm.io/gorm/clause"
+)
+
+// StreamTrace is the token and the channel of a trace sent at the end of their streams,
+// it's saved the first time each instance sends the trace, so that it can be looked up later
+type StreamTrace struct {
+	Trace     string `json:"trace" gorm:"primaryKey;type:varchar(32)"`
+	TokenId   int    `json:"token_id"`
+	ChannelId int    `json:"channel_id"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint"`
+}
+
+var savedStreamTraces sync.Map
+
+func SaveStreamTrace(trace string, tokenId int, channelId int) error {
+	if _, ok := savedStreamTraces.Load(trace); ok {
+		return nil
+	}
+	err := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&StreamTrace{
+		Trace:     trace,
+		TokenId:   tokenId,
+		ChannelId: channelId,
+		CreatedAt: helper.GetTimestamp(),
+	}).Error
+	if err != nil {
+		return err
+	}
+	savedStreamTraces.Store(trace, true)
+	return nil
+}
+
+func GetStreamTrace(trace string) (*StreamTrace, error) {
+	streamTrace := StreamTrace{}
+	err := DB.Where("trace = ?", trace).First(&streamTrace).Error
+	return &streamTrace, err
+}
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestStreamTrace(t *testing.T) {
+	Convey("StreamTrace", t, func() {
+		useTestDB(t)
+
+		Convey("saves the token and the channel of the trace once", func() {
+			So(SaveStreamTrace("trace1", 1, 2), ShouldBeNil)
+			So(SaveStreamTrace("trace1", 1, 2), ShouldBeNil)
+			streamTrace, err := GetStreamTrace("trace1")
+			So(err, ShouldBeNil)
+			So(streamTrace.TokenId, ShouldEqual, 1)
+			So(streamTrace.ChannelId, ShouldEqual, 2)
+			_, err = GetStreamTrace("trace2")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("keeps the secret saved first", func() {
+			oldSecret, oldOptionMap := config.StreamTraceSecret, config.OptionMap
+			config.OptionMap = make(map[string]string)
+			t.Cleanup(func() {
+				config.StreamTraceSecret, config.OptionMap = oldSecret, oldOptionMap
+			})
+			config.StreamTraceSecret = ""
+			initStreamTraceSecret()
+			secret := config.StreamTraceSecret
+			So(secret, ShouldNotBeEmpty)
+			config.StreamTraceSecret = ""
+			initStreamTraceSecret()
+			So(config.StreamTraceSecret, ShouldEqual, secret)
+		})
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/common/message"
 	"gorm.io/gorm"
+	"sync"
 )
 
 const (
@@ -32,12 +33,18 @@ type Token struct {
 	UsedQuota      int64   `json:"used_quota" gorm:"bigint;default:0"` // used quota
 	Models         *string `json:"models" gorm:"default:''"`           // allowed models
 	Subnet         *string `json:"subnet" gorm:"default:''"`           // allowed subnet
+	StreamPolicy   string  `json:"stream_policy" gorm:"default:''"`
+	Honeypot       bool    `json:"honeypot" gorm:"default:false"`    // any use is alerted and served a mock response
+	ParentId       int     `json:"parent_id" gorm:"index;default:0"` // the token which minted this ephemeral token
+	Lane           string  `json:"lane" gorm:"default:''"`
+	WebhookURL     string  `json:"webhook_url" gorm:"default:''"`    // notified after each request is billed
+	ContentPolicy  string  `json:"content_policy" gorm:"default:''"` // the name of the profile, the one of the group if empty
 }
 
 func GetAllUserTokens(userId int, startIdx int, num int, order string) ([]*Token, error) {
 	var tokens []*Token
 	var err error
-	query := DB.Where("user_id = ?", userId)
+	query := DB.Where("user_id = ? AND parent_id = 0", userId)
 
 	switch order {
 	case "remain_quota":
@@ -53,7 +60,7 @@ func GetAllUserTokens(userId int, startIdx int, num int, order string) ([]*Token
 }
 
 func SearchUserTokens(userId int, keyword string) (tokens []*Token, err error) {
-	err = DB.Where("user_id = ?", userId).Where("name LIKE ?", keyword+"%").Find(&tokens).Error
+	err = DB.Where("user_id = ? AND parent_id = 0", userId).Where("name LIKE ?", keyword+"%").Find(&tokens).Error
 	return tokens, err
 }
 
@@ -69,6 +76,10 @@ func ValidateUserToken(key string) (token *Token, err error) {
 		}
 		return nil, errors.New("令牌验证失败")
 	}
+	if token.Honeypot && token.Status != TokenStatusDisabled {
+		// honeypot tokens never run out, otherwise we would stop seeing who is using them
+		return token, nil
+	}
 	if token.Status == TokenStatusExhausted {
 		return nil, fmt.Errorf("令牌 %s（#%d）额度已用尽", token.Name, token.Id)
 	} else if token.Status == TokenStatusExpired {
@@ -121,6 +132,45 @@ func GetTokenById(id int) (*Token, error) {
 	return &token, err
 }
 
+var ErrEphemeralQuotaExceeded = errors.New("quota exceeds the remaining quota of the token")
+
+// CreateEphemeralToken mints a short-lived child of the parent token, the quota of the child is reserved
+// from the parent, and the quota left in expired children of the parent is given back
+func CreateEphemeralToken(parent *Token, child *Token) error {
+	now := helper.GetTimestamp()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var expiredChildren []*Token
+		err := tx.Where("parent_id = ? AND expired_time < ?", parent.Id, now).Find(&expiredChildren).Error
+		if err != nil {
+			return err
+		}
+		var leftQuota int64
+		for _, expiredChild := range expiredChildren {
+			result := tx.Delete(expiredChild)
+			if result.Error != nil {
+				return result.Error
+			}
+			// a concurrent mint may have given it back already
+			if result.RowsAffected > 0 {
+				leftQuota += expiredChild.RemainQuota
+			}
+		}
+		if !parent.UnlimitedQuota {
+			// the quota is checked in the update, the concurrent mints can't reserve more than the parent has
+			result := tx.Model(&Token{}).Where("id = ? AND remain_quota + ? >= ?", parent.Id, leftQuota, child.RemainQuota).
+				Update("remain_quota", gorm.Expr("remain_quota + ? - ?", leftQuota, child.RemainQuota))
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrEphemeralQuotaExceeded
+			}
+		}
+		child.ParentId = parent.Id
+		return tx.Create(child).Error
+	})
+}
+
 func (token *Token) Insert() error {
 	var err error
 	err = DB.Create(token).Error
@@ -130,7 +180,7 @@ func (token *Token) Insert() error {
 // Update Make sure your token's fields is completed, because this will update non-zero values
 func (token *Token) Update() error {
 	var err error
-	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota", "models", "subnet").Updates(token).Error
+	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota", "models", "subnet", "stream_policy", "honeypot", "lane", "webhook_url", "content_policy").Updates(token).Error
 	return err
 }
 
@@ -242,35 +292,108 @@ func PreConsumeTokenQuota(tokenId int, quota int64) (err error) {
 			}
 		}()
 	}
-	if !token.UnlimitedQuota {
-		err = DecreaseTokenQuota(tokenId, quota)
-		if err != nil {
-			return err
-		}
-	}
-	err = DecreaseUserQuota(token.UserId, quota)
-	return err
+	return changeTokenQuota(token, -quota, LedgerTypePreConsume)
 }
 
 func PostConsumeTokenQuota(tokenId int, quota int64) (err error) {
 	token, err := GetTokenById(tokenId)
-	if quota > 0 {
-		err = DecreaseUserQuota(token.UserId, quota)
-	} else {
-		err = IncreaseUserQuota(token.UserId, -quota)
-	}
 	if err != nil {
 		return err
 	}
-	if !token.UnlimitedQuota {
-		if quota > 0 {
-			err = DecreaseTokenQuota(tokenId, quota)
-		} else {
-			err = IncreaseTokenQuota(tokenId, -quota)
+	if quota > 0 {
+		return changeTokenQuota(token, -quota, LedgerTypePostConsume)
+	}
+	return changeTokenQuota(token, -quota, LedgerTypeRefund)
+}
+
+// tokenQuotaChange is a change of the quota of a token and its user queued by batch updates, with its ledger entry
+type tokenQuotaChange struct {
+	ledger         *QuotaLedger
+	unlimitedQuota bool
+}
+
+var pendingTokenQuotaChanges []tokenQuotaChange
+var pendingTokenQuotaChangesLock sync.Mutex
+
+// changeTokenQuota adds delta to the quota of the user of the token and, unless it's unlimited, to the remain quota
+// of the token, the ledger entry is committed in the same transaction. With batch updates the change is queued with
+// its entry, both are written by the same transaction when the batch is flushed.
+func changeTokenQuota(token *Token, delta int64, ledgerType int) error {
+	if config.BatchUpdateEnabled {
+		pendingTokenQuotaChangesLock.Lock()
+		pendingTokenQuotaChanges = append(pendingTokenQuotaChanges, tokenQuotaChange{
+			ledger:         newQuotaLedger(token.UserId, token.Id, ledgerType, delta, ""),
+			unlimitedQuota: token.UnlimitedQuota,
+		})
+		pendingTokenQuotaChangesLock.Unlock()
+		return nil
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if !token.UnlimitedQuota {
+			err := updateTokenQuotaWithTx(tx, token.Id, delta)
+			if err != nil {
+				return err
+			}
 		}
+		err := tx.Model(&User{}).Where("id = ?", token.UserId).Update("quota", gorm.Expr("quota + ?", delta)).Error
 		if err != nil {
 			return err
 		}
+		return recordQuotaLedgerWithTx(tx, token.UserId, token.Id, ledgerType, delta, "")
+	})
+}
+
+func updateTokenQuotaWithTx(tx *gorm.DB, tokenId int, delta int64) error {
+	return tx.Model(&Token{}).Where("id = ?", tokenId).Updates(
+		map[string]interface{}{
+			"remain_quota":  gorm.Expr("remain_quota + ?", delta),
+			"used_quota":    gorm.Expr("used_quota - ?", delta),
+			"accessed_time": helper.GetTimestamp(),
+		},
+	).Error
+}
+
+// flushTokenQuotaChanges writes the queued changes of the tokens and the users, added up, together with their ledger
+// entries in a single transaction, so that the ledger never disagrees with the balances
+func flushTokenQuotaChanges() {
+	pendingTokenQuotaChangesLock.Lock()
+	changes := pendingTokenQuotaChanges
+	pendingTokenQuotaChanges = nil
+	pendingTokenQuotaChangesLock.Unlock()
+	if len(changes) == 0 {
+		return
+	}
+	tokenDeltas := make(map[int]int64)
+	userDeltas := make(map[int]int64)
+	ledgers := make([]*QuotaLedger, 0, len(changes))
+	for _, change := range changes {
+		if !change.unlimitedQuota {
+			tokenDeltas[change.ledger.TokenId] += change.ledger.Delta
+		}
+		userDeltas[change.ledger.UserId] += change.ledger.Delta
+		if change.ledger.Delta != 0 {
+			ledgers = append(ledgers, change.ledger)
+		}
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		for tokenId, delta := range tokenDeltas {
+			err := updateTokenQuotaWithTx(tx, tokenId, delta)
+			if err != nil {
+				return err
+			}
+		}
+		for userId, delta := range userDeltas {
+			err := tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", delta)).Error
+			if err != nil {
+				return err
+			}
+		}
+		if len(ledgers) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(ledgers, 100).Error
+	})
+	if err != nil {
+		logger.SysError("failed to batch update token quota: " + err.Error())
 	}
-	return nil
 }
@@ -0,0 +1,118 @@
+package model
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+func TestConsumeTokenQuota(t *testing.T) {
+	Convey("PreConsumeTokenQuota and PostConsumeTokenQuota", t, func() {
+		useTestDB(t)
+		createTestUser(t, 1, 1000000)
+		So(DB.Create(&Token{Id: 1, UserId: 1, Key: "limited", RemainQuota: 1000}).Error, ShouldBeNil)
+		So(DB.Create(&Token{Id: 2, UserId: 1, Key: "unlimited", UnlimitedQuota: true}).Error, ShouldBeNil)
+		balances := func(tokenId int) (int64, int64) {
+			user, token := User{}, Token{}
+			So(DB.First(&user, 1).Error, ShouldBeNil)
+			So(DB.First(&token, tokenId).Error, ShouldBeNil)
+			return user.Quota, token.RemainQuota
+		}
+		ledgerSum := func() (sum int64) {
+			var ledgers []QuotaLedger
+			So(DB.Find(&ledgers).Error, ShouldBeNil)
+			for _, ledger := range ledgers {
+				sum += ledger.Delta
+			}
+			return sum
+		}
+
+		Convey("records every change with the balances", func() {
+			So(PreConsumeTokenQuota(1, 100), ShouldBeNil)
+			So(PostConsumeTokenQuota(1, 50), ShouldBeNil)
+			So(PostConsumeTokenQuota(1, -30), ShouldBeNil)
+			userQuota, remainQuota := balances(1)
+			So(userQuota, ShouldEqual, 1000000-120)
+			So(remainQuota, ShouldEqual, 1000-120)
+			So(ledgerSum(), ShouldEqual, -120)
+			So(DB.Where("type = ?", LedgerTypeRefund).First(&QuotaLedger{}).Error, ShouldBeNil)
+		})
+
+		Convey("with batch updates the entries are written with the balances", func() {
+			oldBatchUpdateEnabled := config.BatchUpdateEnabled
+			config.BatchUpdateEnabled = true
+			defer func() {
+				config.BatchUpdateEnabled = oldBatchUpdateEnabled
+			}()
+			So(PreConsumeTokenQuota(1, 100), ShouldBeNil)
+			So(PostConsumeTokenQuota(2, 30), ShouldBeNil)
+			// nothing is written until the batch is flushed
+			userQuota, remainQuota := balances(1)
+			So(userQuota, ShouldEqual, 1000000)
+			So(remainQuota, ShouldEqual, 1000)
+			So(ledgerSum(), ShouldEqual, 0)
+
+			batchUpdate()
+			userQuota, remainQuota = balances(1)
+			So(userQuota, ShouldEqual, 1000000-130)
+			So(remainQuota, ShouldEqual, 1000-100)
+			_, remainQuota = balances(2)
+			So(remainQuota, ShouldEqual, 0)
+			So(ledgerSum(), ShouldEqual, -130)
+			var count int64
+			So(DB.Model(&QuotaLedger{}).Count(&count).Error, ShouldBeNil)
+			So(count, ShouldEqual, 2)
+		})
+
+		Convey("doesn't change the remain quota of unlimited tokens", func() {
+			So(PreConsumeTokenQuota(2, 100), ShouldBeNil)
+			userQuota, remainQuota := balances(2)
+			So(userQuota, ShouldEqual, 1000000-100)
+			So(remainQuota, ShouldEqual, 0)
+			So(ledgerSum(), ShouldEqual, -100)
+		})
+
+		Convey("refuses when the token can't afford it", func() {
+			So(PreConsumeTokenQuota(1, 2000), ShouldNotBeNil)
+			userQuota, remainQuota := balances(1)
+			So(userQuota, ShouldEqual, 1000000)
+			So(remainQuota, ShouldEqual, 1000)
+			So(ledgerSum(), ShouldEqual, 0)
+		})
+	})
+}
+
+func TestCreateEphemeralToken(t *testing.T) {
+	Convey("CreateEphemeralToken", t, func() {
+		useTestDB(t)
+		createTestUser(t, 1, 1000000)
+		parent := &Token{Id: 1, UserId: 1, Key: "parent", RemainQuota: 100}
+		expiredTime := helper.GetTimestamp() + 600
+		So(DB.Create(parent).Error, ShouldBeNil)
+		remainQuota := func() int64 {
+			token := Token{}
+			So(DB.First(&token, parent.Id).Error, ShouldBeNil)
+			return token.RemainQuota
+		}
+
+		Convey("reserves the quota only while the parent has it left", func() {
+			So(CreateEphemeralToken(parent, &Token{UserId: 1, Key: "child1", RemainQuota: 80, ExpiredTime: expiredTime}), ShouldBeNil)
+			// the parent loaded before the first mint still shows the whole quota
+			So(CreateEphemeralToken(parent, &Token{UserId: 1, Key: "child2", RemainQuota: 30, ExpiredTime: expiredTime}), ShouldEqual, ErrEphemeralQuotaExceeded)
+			So(remainQuota(), ShouldEqual, 20)
+			var count int64
+			So(DB.Model(&Token{}).Where("parent_id = ?", parent.Id).Count(&count).Error, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+		})
+
+		Convey("gives back the quota left in the expired children", func() {
+			So(DB.Create(&Token{UserId: 1, Key: "expired", RemainQuota: 50, ExpiredTime: 1, ParentId: parent.Id}).Error, ShouldBeNil)
+			So(CreateEphemeralToken(parent, &Token{UserId: 1, Key: "child3", RemainQuota: 120, ExpiredTime: expiredTime}), ShouldBeNil)
+			So(remainQuota(), ShouldEqual, 30)
+			So(CreateEphemeralToken(parent, &Token{UserId: 1, Key: "child4", RemainQuota: 30, ExpiredTime: expiredTime}), ShouldBeNil)
+			So(remainQuota(), ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,139 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const transferDailyWindowSeconds = 24 * 60 * 60
+
+// TransferUserQuota moves quota from the balance of a user to another one, both sides are recorded in the ledger.
+// The quota sent by the user to other users in 24 hours can't exceed dailyMaxQuota, 0 means no limit
+func TransferUserQuota(fromUserId int, toUserId int, quota int64, remark string, dailyMaxQuota int64) error {
+	if quota <= 0 {
+		return errors.New("转移额度必须大于 0")
+	}
+	if fromUserId == toUserId {
+		return errors.New("不能向自己转移额度")
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		sender := User{}
+		// the transfers of the sender are serialized, so that the concurrent ones can't exceed the daily limit
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "username", "status").Where("id = ?", fromUserId).First(&sender).Error
+		if err != nil {
+			return errors.New("转出用户不存在")
+		}
+		if sender.Status != UserStatusEnabled {
+			return errors.New("转出用户已被封禁")
+		}
+		if dailyMaxQuota > 0 {
+			var transferred int64
+			err = tx.Model(&QuotaLedger{}).Select("COALESCE(SUM(-delta), 0)").
+				Where("user_id = ? AND token_id = 0 AND type = ? AND delta < 0 AND created_at > ?",
+					fromUserId, LedgerTypeTransfer, helper.GetTimestamp()-transferDailyWindowSeconds).Scan(&transferred).Error
+			if err != nil {
+				return err
+			}
+			if transferred+quota > dailyMaxQuota {
+				return fmt.Errorf("24 小时内转出的额度不能超过 %s，已转出 %s", common.LogQuota(dailyMaxQuota), common.LogQuota(transferred))
+			}
+		}
+		receiver := User{}
+		err = tx.Select("id", "username", "status").Where("id = ?", toUserId).First(&receiver).Error
+		if err != nil || receiver.Status != UserStatusEnabled {
+			return errors.New("转入用户不存在或已被封禁")
+		}
+		// the balance is checked by the debit itself, so that concurrent transfers can't spend it twice
+		result := tx.Model(&User{}).Where("id = ? AND quota >= ?", fromUserId, quota).Update("quota", gorm.Expr("quota - ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("额度不足")
+		}
+		err = tx.Model(&User{}).Where("id = ?", toUserId).Update("quota", gorm.Expr("quota + ?", quota)).Error
+		if err != nil {
+			return err
+		}
+		err = recordQuotaLedgerWithTx(tx, fromUserId, 0, LedgerTypeTransfer, -quota, fmt.Sprintf("转给用户 %s %s", receiver.Username, remark))
+		if err != nil {
+			return err
+		}
+		return recordQuotaLedgerWithTx(tx, toUserId, 0, LedgerTypeTransfer, quota, fmt.Sprintf("来自用户 %s %s", sender.Username, remark))
+	})
+	if err != nil {
+		return err
+	}
+	RecordLog(fromUserId, LogTypeManage, fmt.Sprintf("向用户 %d 转移额度 %s", toUserId, common.LogQuota(quota)))
+	RecordLog(toUserId, LogTypeTopup, fmt.Sprintf("收到用户 %d 转移的额度 %s", fromUserId, common.LogQuota(quota)))
+	for _, userId := range []int{fromUserId, toUserId} {
+		err = CacheUpdateUserQuota(context.Background(), userId)
+		if err != nil {
+			logger.SysError("error update user quota cache: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// TransferTokenQuota moves remain quota between two tokens of a user. The balance of the user doesn't change,
+// the two ledger entries cancel each other out and only tell where the quota went
+func TransferTokenQuota(userId int, fromTokenId int, toTokenId int, quota int64) error {
+	if quota <= 0 {
+		return errors.New("转移额度必须大于 0")
+	}
+	if fromTokenId == toTokenId {
+		return errors.New("转出令牌与转入令牌不能相同")
+	}
+	var tokens []*Token
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ? AND id IN ?", userId, []int{fromTokenId, toTokenId}).Find(&tokens).Error
+		if err != nil {
+			return err
+		}
+		if len(tokens) != 2 {
+			return errors.New("令牌不存在")
+		}
+		for _, token := range tokens {
+			if token.UnlimitedQuota {
+				return errors.New("无限额度的令牌不能转移额度")
+			}
+			if token.ParentId != 0 {
+				// the quota of an ephemeral key is bounded by its parent when it's minted
+				return errors.New("临时密钥不能转移额度")
+			}
+		}
+		result := tx.Model(&Token{}).Where("id = ? AND user_id = ? AND remain_quota >= ?", fromTokenId, userId, quota).Update("remain_quota", gorm.Expr("remain_quota - ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("转出令牌的剩余额度不足")
+		}
+		err = tx.Model(&Token{}).Where("id = ? AND user_id = ?", toTokenId, userId).Update("remain_quota", gorm.Expr("remain_quota + ?", quota)).Error
+		if err != nil {
+			return err
+		}
+		err = recordQuotaLedgerWithTx(tx, userId, fromTokenId, LedgerTypeTransfer, -quota, fmt.Sprintf("转给令牌 %d", toTokenId))
+		if err != nil {
+			return err
+		}
+		return recordQuotaLedgerWithTx(tx, userId, toTokenId, LedgerTypeTransfer, quota, fmt.Sprintf("来自令牌 %d", fromTokenId))
+	})
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		err = CacheUpdateToken(token.Key)
+		if err != nil {
+			logger.SysError("error update token cache: " + err.Error())
+		}
+	}
+	return nil
+}
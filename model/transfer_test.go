@@ -0,0 +1,104 @@
+package model
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+func TestTransferUserQuota(t *testing.T) {
+	Convey("TransferUserQuota", t, func() {
+		useTestDB(t)
+		createTestUser(t, 1, 100)
+		createTestUser(t, 2, 0)
+		createTestUser(t, 3, 100)
+		So(DB.Model(&User{}).Where("id = ?", 3).Update("status", UserStatusDisabled).Error, ShouldBeNil)
+		quotaOf := func(id int) int64 {
+			quota, err := GetUserQuota(id)
+			So(err, ShouldBeNil)
+			return quota
+		}
+
+		Convey("moves the quota and records both sides", func() {
+			So(TransferUserQuota(1, 2, 60, "", 0), ShouldBeNil)
+			So(quotaOf(1), ShouldEqual, 40)
+			So(quotaOf(2), ShouldEqual, 60)
+			var ledgers []QuotaLedger
+			So(DB.Order("user_id").Find(&ledgers).Error, ShouldBeNil)
+			So(ledgers, ShouldHaveLength, 2)
+			So(ledgers[0].Delta, ShouldEqual, -60)
+			So(ledgers[1].Delta, ShouldEqual, 60)
+		})
+
+		Convey("can't spend the balance twice", func() {
+			So(TransferUserQuota(1, 2, 60, "", 0), ShouldBeNil)
+			So(TransferUserQuota(1, 2, 60, "", 0), ShouldNotBeNil)
+			So(quotaOf(1), ShouldEqual, 40)
+			So(quotaOf(2), ShouldEqual, 60)
+		})
+
+		Convey("refuses the disabled users", func() {
+			So(TransferUserQuota(3, 2, 10, "", 0), ShouldNotBeNil)
+			So(TransferUserQuota(1, 3, 10, "", 0), ShouldNotBeNil)
+			So(quotaOf(1), ShouldEqual, 100)
+			So(quotaOf(3), ShouldEqual, 100)
+		})
+
+		Convey("refuses invalid amounts", func() {
+			So(TransferUserQuota(1, 2, 0, "", 0), ShouldNotBeNil)
+			So(TransferUserQuota(1, 1, 10, "", 0), ShouldNotBeNil)
+		})
+
+		Convey("refuses to send more than the daily limit", func() {
+			So(TransferUserQuota(1, 2, 30, "", 50), ShouldBeNil)
+			So(TransferUserQuota(1, 2, 30, "", 50), ShouldNotBeNil)
+			So(TransferUserQuota(1, 2, 20, "", 50), ShouldBeNil)
+			So(quotaOf(1), ShouldEqual, 50)
+			// the received quota doesn't count
+			So(TransferUserQuota(2, 1, 50, "", 50), ShouldBeNil)
+			// the transfers older than 24 hours don't count
+			So(DB.Model(&QuotaLedger{}).Where("user_id = ?", 1).
+				Update("created_at", helper.GetTimestamp()-transferDailyWindowSeconds-1).Error, ShouldBeNil)
+			So(TransferUserQuota(1, 2, 50, "", 50), ShouldBeNil)
+			So(quotaOf(1), ShouldEqual, 50)
+			So(quotaOf(2), ShouldEqual, 50)
+		})
+	})
+}
+
+func TestTransferTokenQuota(t *testing.T) {
+	Convey("TransferTokenQuota", t, func() {
+		useTestDB(t)
+		So(DB.Create(&Token{Id: 1, UserId: 1, Key: "a", RemainQuota: 100}).Error, ShouldBeNil)
+		So(DB.Create(&Token{Id: 2, UserId: 1, Key: "b", RemainQuota: 0}).Error, ShouldBeNil)
+		So(DB.Create(&Token{Id: 3, UserId: 2, Key: "c", RemainQuota: 100}).Error, ShouldBeNil)
+		remainOf := func(id int) int64 {
+			token := Token{}
+			So(DB.First(&token, id).Error, ShouldBeNil)
+			return token.RemainQuota
+		}
+
+		Convey("moves the remain quota", func() {
+			So(TransferTokenQuota(1, 1, 2, 70), ShouldBeNil)
+			So(remainOf(1), ShouldEqual, 30)
+			So(remainOf(2), ShouldEqual, 70)
+			So(TransferTokenQuota(1, 1, 2, 70), ShouldNotBeNil)
+			So(remainOf(1), ShouldEqual, 30)
+		})
+
+		Convey("refuses the ephemeral keys", func() {
+			So(DB.Create(&Token{Id: 4, UserId: 1, Key: "d", RemainQuota: 100, ParentId: 1}).Error, ShouldBeNil)
+			So(TransferTokenQuota(1, 4, 2, 10), ShouldNotBeNil)
+			So(TransferTokenQuota(1, 1, 4, 10), ShouldNotBeNil)
+			So(remainOf(1), ShouldEqual, 100)
+			So(remainOf(4), ShouldEqual, 100)
+		})
+
+		Convey("only moves between the tokens of the user", func() {
+			So(TransferTokenQuota(1, 3, 2, 10), ShouldNotBeNil)
+			So(TransferTokenQuota(2, 3, 1, 10), ShouldNotBeNil)
+			So(remainOf(3), ShouldEqual, 100)
+		})
+	})
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/common/random"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"strings"
 )
 
@@ -47,6 +48,7 @@ type User struct {
 	Group            string `json:"group" gorm:"type:varchar(32);default:'default'"`
 	AffCode          string `json:"aff_code" gorm:"type:varchar(32);column:aff_code;uniqueIndex"`
 	InviterId        int    `json:"inviter_id" gorm:"type:int;column:inviter_id;index"`
+	UsageReport      string `json:"usage_report" gorm:"type:varchar(16);default:''"` // how often the usage report is emailed, empty means never
 }
 
 func GetMaxUserId() int {
@@ -129,15 +131,18 @@ func (user *User) Insert(inviterId int) error {
 		return result.Error
 	}
 	if config.QuotaForNewUser > 0 {
+		RecordQuotaLedger(user.Id, 0, LedgerTypeTopUp, config.QuotaForNewUser, "新用户注册赠送")
 		RecordLog(user.Id, LogTypeSystem, fmt.Sprintf("新用户注册赠送 %s", common.LogQuota(config.QuotaForNewUser)))
 	}
 	if inviterId != 0 {
 		if config.QuotaForInvitee > 0 {
 			_ = IncreaseUserQuota(user.Id, config.QuotaForInvitee)
+			RecordQuotaLedger(user.Id, 0, LedgerTypeTopUp, config.QuotaForInvitee, "使用邀请码赠送")
 			RecordLog(user.Id, LogTypeSystem, fmt.Sprintf("使用邀请码赠送 %s", common.LogQuota(config.QuotaForInvitee)))
 		}
 		if config.QuotaForInviter > 0 {
 			_ = IncreaseUserQuota(inviterId, config.QuotaForInviter)
+			RecordQuotaLedger(inviterId, 0, LedgerTypeTopUp, config.QuotaForInviter, "邀请用户赠送")
 			RecordLog(inviterId, LogTypeSystem, fmt.Sprintf("邀请用户赠送 %s", common.LogQuota(config.QuotaForInviter)))
 		}
 	}
@@ -160,7 +165,7 @@ func (user *User) Insert(inviterId int) error {
 	return nil
 }
 
-func (user *User) Update(updatePassword bool) error {
+func (user *User) prepareUpdate(updatePassword bool) error {
 	var err error
 	if updatePassword {
 		user.Password, err = common.Password2Hash(user.Password)
@@ -173,10 +178,47 @@ func (user *User) Update(updatePassword bool) error {
 	} else if user.Status == UserStatusEnabled {
 		blacklist.UnbanUser(user.Id)
 	}
+	return nil
+}
+
+func (user *User) Update(updatePassword bool) error {
+	err := user.prepareUpdate(updatePassword)
+	if err != nil {
+		return err
+	}
 	err = DB.Model(user).Updates(user).Error
 	return err
 }
 
+// UpdateWithLedger updates the user for an admin, the change of the quota is recorded in the ledger by the same
+// transaction. The change is from the quota at the time of the update, which may have been consumed since the admin
+// loaded it. It returns the quota before and after the update.
+func (user *User) UpdateWithLedger(updatePassword bool, remark string) (oldQuota int64, newQuota int64, err error) {
+	err = user.prepareUpdate(updatePassword)
+	if err != nil {
+		return 0, 0, err
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		origin := User{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("quota").Where("id = ?", user.Id).First(&origin).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(user).Updates(user).Error
+		if err != nil {
+			return err
+		}
+		updated := User{}
+		err = tx.Select("quota").Where("id = ?", user.Id).First(&updated).Error
+		if err != nil {
+			return err
+		}
+		oldQuota, newQuota = origin.Quota, updated.Quota
+		return recordQuotaLedgerWithTx(tx, user.Id, 0, LedgerTypeAdminAdjustment, newQuota-oldQuota, remark)
+	})
+	return oldQuota, newQuota, err
+}
+
 func (user *User) Delete() error {
 	if user.Id == 0 {
 		return errors.New("id 为空！")
@@ -355,6 +397,59 @@ func GetUserGroup(id int) (group string, err error) {
 	return group, err
 }
 
+// GetUserGroups returns the groups of the users, users which don't exist any more are left out
+func GetUserGroups(ids []int) (map[int]string, error) {
+	groupCol := "`group`"
+	if common.UsingPostgreSQL {
+		groupCol = `"group"`
+	}
+	groups := make(map[int]string, len(ids))
+	// the number of parameters of a query is limited
+	for start := 0; start < len(ids); start += 500 {
+		end := start + 500
+		if end > len(ids) {
+			end = len(ids)
+		}
+		var users []struct {
+			Id    int
+			Group string
+		}
+		err := DB.Model(&User{}).Where("id IN ?", ids[start:end]).Select("id, " + groupCol).Find(&users).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			groups[user.Id] = user.Group
+		}
+	}
+	return groups, nil
+}
+
+// GetUserQuotas returns the name, group and remaining quota of the users, users which don't exist any more are left out
+func GetUserQuotas(ids []int) (map[int]*User, error) {
+	groupCol := "`group`"
+	if common.UsingPostgreSQL {
+		groupCol = `"group"`
+	}
+	quotas := make(map[int]*User, len(ids))
+	// the number of parameters of a query is limited
+	for start := 0; start < len(ids); start += 500 {
+		end := start + 500
+		if end > len(ids) {
+			end = len(ids)
+		}
+		var users []*User
+		err := DB.Where("id IN ?", ids[start:end]).Select("id, username, quota, " + groupCol).Find(&users).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			quotas[user.Id] = user
+		}
+	}
+	return quotas, nil
+}
+
 func IncreaseUserQuota(id int, quota int64) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
@@ -366,6 +461,23 @@ func IncreaseUserQuota(id int, quota int64) (err error) {
 	return increaseUserQuota(id, quota)
 }
 
+// TopUpUserQuota adds the quota to the user, the ledger entry is committed in the same transaction
+func TopUpUserQuota(id int, quota int64, remark string) error {
+	if quota < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota + ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("用户不存在")
+		}
+		return recordQuotaLedgerWithTx(tx, id, 0, LedgerTypeTopUp, quota, remark)
+	})
+}
+
 func increaseUserQuota(id int, quota int64) (err error) {
 	err = DB.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota + ?", quota)).Error
 	return err
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUpdateWithLedger(t *testing.T) {
+	Convey("the change of the quota by an admin is recorded with it", t, func() {
+		useTestDB(t)
+		createTestUser(t, 1, 1000)
+		// consumed after the admin loaded the user
+		So(DB.Model(&User{}).Where("id = ?", 1).Update("quota", 900).Error, ShouldBeNil)
+
+		user := &User{Id: 1, Username: "user1", Quota: 5000}
+		oldQuota, newQuota, err := user.UpdateWithLedger(false, "管理员 2 修改")
+		So(err, ShouldBeNil)
+		So(oldQuota, ShouldEqual, 900)
+		So(newQuota, ShouldEqual, 5000)
+		ledger := QuotaLedger{}
+		So(DB.Where("user_id = ? AND type = ?", 1, LedgerTypeAdminAdjustment).First(&ledger).Error, ShouldBeNil)
+		So(ledger.Delta, ShouldEqual, 4100)
+
+		// no entry if the quota isn't changed
+		oldQuota, newQuota, err = (&User{Id: 1, DisplayName: "renamed"}).UpdateWithLedger(false, "")
+		So(err, ShouldBeNil)
+		So(oldQuota, ShouldEqual, newQuota)
+		var count int64
+		So(DB.Model(&QuotaLedger{}).Count(&count).Error, ShouldBeNil)
+		So(count, ShouldEqual, 1)
+	})
+}
+
+func TestTopUpUserQuota(t *testing.T) {
+	Convey("TopUpUserQuota records the top up with the quota", t, func() {
+		useTestDB(t)
+		createTestUser(t, 1, 1000)
+		So(TopUpUserQuota(1, 500, "API 充值"), ShouldBeNil)
+		user := User{}
+		So(DB.First(&user, 1).Error, ShouldBeNil)
+		So(user.Quota, ShouldEqual, 1500)
+		ledger := QuotaLedger{}
+		So(DB.Where("user_id = ?", 1).First(&ledger).Error, ShouldBeNil)
+		So(ledger.Type, ShouldEqual, LedgerTypeTopUp)
+		So(ledger.Delta, ShouldEqual, 500)
+		So(ledger.Remark, ShouldEqual, "API 充值")
+
+		So(TopUpUserQuota(2, 500, ""), ShouldNotBeNil)
+		So(TopUpUserQuota(1, -1, ""), ShouldNotBeNil)
+		var count int64
+		So(DB.Model(&QuotaLedger{}).Count(&count).Error, ShouldBeNil)
+		So(count, ShouldEqual, 1)
+	})
+}
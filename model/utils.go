@@ -47,6 +47,7 @@ func addNewRecord(type_ int, id int, value int64) {
 
 func batchUpdate() {
 	logger.SysLog("batch update started")
+	flushTokenQuotaChanges()
 	for i := 0; i < BatchUpdateTypeCount; i++ {
 		batchUpdateLocks[i].Lock()
 		store := batchUpdateStores[i]
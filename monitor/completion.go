@@ -0,0 +1,76 @@
+package monitor
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+// the completion lengths of each model are kept in memory for sizing the pre-consumed quota,
+// every node learns from the requests it relays
+
+const completionSampleSize = 200
+
+// fewer completions than this say little about the model
+const minCompletionSamples = 20
+
+type completionSamples struct {
+	values [completionSampleSize]int
+	count  int
+	next   int
+}
+
+func (s *completionSamples) add(tokens int) {
+	s.values[s.next] = tokens
+	s.next = (s.next + 1) % completionSampleSize
+	if s.count < completionSampleSize {
+		s.count++
+	}
+}
+
+// percentile is the nearest rank of p in (0, 100] among the samples
+func (s *completionSamples) percentile(p float64) int {
+	sorted := make([]int, s.count)
+	copy(sorted, s.values[:s.count])
+	sort.Ints(sorted)
+	rank := int(math.Ceil(p / 100 * float64(s.count)))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > s.count {
+		rank = s.count
+	}
+	return sorted[rank-1]
+}
+
+var completionStats = make(map[string]*completionSamples)
+var completionStatsLock sync.Mutex
+
+// RecordCompletionTokens keeps the completion length of a billed request of the model
+func RecordCompletionTokens(modelName string, tokens int) {
+	completionStatsLock.Lock()
+	defer completionStatsLock.Unlock()
+	samples, ok := completionStats[modelName]
+	if !ok {
+		samples = &completionSamples{}
+		completionStats[modelName] = samples
+	}
+	samples.add(tokens)
+}
+
+// EstimateCompletionTokens returns how long a completion of the model is expected to be at most,
+// false if not enough completions of it were seen
+func EstimateCompletionTokens(modelName string) (int, bool) {
+	if config.PreConsumeCompletionPercentile <= 0 {
+		return 0, false
+	}
+	completionStatsLock.Lock()
+	defer completionStatsLock.Unlock()
+	samples, ok := completionStats[modelName]
+	if !ok || samples.count < minCompletionSamples {
+		return 0, false
+	}
+	return samples.percentile(config.PreConsumeCompletionPercentile), true
+}
@@ -0,0 +1,38 @@
+package monitor
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCompletionSamples(t *testing.T) {
+	Convey("completionSamples", t, func() {
+		samples := completionSamples{}
+		for i := 1; i <= 100; i++ {
+			samples.add(i)
+		}
+		So(samples.percentile(95), ShouldEqual, 95)
+		So(samples.percentile(100), ShouldEqual, 100)
+		So(samples.percentile(50), ShouldEqual, 50)
+
+		Convey("keeps only the recent ones", func() {
+			for i := 0; i < completionSampleSize; i++ {
+				samples.add(10)
+			}
+			So(samples.count, ShouldEqual, completionSampleSize)
+			So(samples.percentile(100), ShouldEqual, 10)
+		})
+	})
+
+	Convey("EstimateCompletionTokens", t, func() {
+		_, ok := EstimateCompletionTokens("test-model")
+		So(ok, ShouldBeFalse)
+		for i := 0; i < minCompletionSamples; i++ {
+			RecordCompletionTokens("test-model", 300)
+		}
+		tokens, ok := EstimateCompletionTokens("test-model")
+		So(ok, ShouldBeTrue)
+		So(tokens, ShouldEqual, 300)
+	})
+}
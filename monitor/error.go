@@ -0,0 +1,74 @@
+package monitor
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/songquanpeng/one-api/relay/constant/errortype"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func containsAny(s string, substrings ...string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(s, substring) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClassifyError tells why a relay failed, from the status code and the error returned by the adaptor
+func ClassifyError(statusCode int, err *model.Error) int {
+	if err == nil {
+		err = &model.Error{}
+	}
+	kind := strings.ToLower(err.Type)
+	code := strings.ToLower(codeString(err.Code))
+	message := strings.ToLower(err.Message)
+	switch {
+	case containsAny(kind+" "+code, "content_filter", "content_policy", "safety") ||
+		containsAny(message, "content management policy", "content_filter", "safety system"):
+		return errortype.ContentFilter
+	case kind == "insufficient_quota" || code == "insufficient_quota" || statusCode == http.StatusPaymentRequired ||
+		containsAny(message, "credit balance", "insufficient balance", "quota exceeded", "exceeded your current quota"):
+		return errortype.Quota
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden ||
+		kind == "authentication_error" || kind == "permission_error" ||
+		code == "invalid_api_key" || code == "account_deactivated":
+		return errortype.Auth
+	case statusCode == http.StatusTooManyRequests || containsAny(kind+" "+code, "rate_limit"):
+		return errortype.RateLimit
+	case statusCode == http.StatusRequestTimeout || statusCode == http.StatusGatewayTimeout ||
+		containsAny(message, "timeout", "deadline exceeded", "timed out"):
+		return errortype.Timeout
+	case code == "do_request_failed" || code == "read_response_body_failed" || statusCode == http.StatusBadGateway ||
+		containsAny(message, "connection refused", "connection reset", "no such host", "unexpected eof", "broken pipe"):
+		return errortype.Network
+	case statusCode/100 == 4:
+		return errortype.BadRequest
+	case statusCode/100 == 5:
+		return errortype.Upstream
+	}
+	return errortype.Unknown
+}
+
+// IsChannelFailure tells whether a failed relay is the fault of the channel: 5xx, 429 and the transport errors.
+// The requests rejected for what the client sent aren't, so that bad requests don't push healthy channels out of rotation.
+func IsChannelFailure(statusCode int, err *model.Error) bool {
+	if statusCode/100 == 5 || statusCode == http.StatusTooManyRequests {
+		return true
+	}
+	if err == nil {
+		return false
+	}
+	code := codeString(err.Code)
+	return code == "do_request_failed" || code == "read_response_body_failed"
+}
+
+// codeString is needed because some upstreams return the code as a number
+func codeString(code any) string {
+	if s, ok := code.(string); ok {
+		return s
+	}
+	return ""
+}
@@ -0,0 +1,34 @@
+package monitor
+
+import (
+	"net/http"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/relay/constant/errortype"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestClassifyError(t *testing.T) {
+	Convey("ClassifyError", t, func() {
+		So(ClassifyError(http.StatusUnauthorized, &model.Error{Code: "invalid_api_key"}), ShouldEqual, errortype.Auth)
+		So(ClassifyError(http.StatusTooManyRequests, &model.Error{Type: "insufficient_quota"}), ShouldEqual, errortype.Quota)
+		So(ClassifyError(http.StatusTooManyRequests, &model.Error{Code: "rate_limit_exceeded"}), ShouldEqual, errortype.RateLimit)
+		So(ClassifyError(http.StatusInternalServerError, &model.Error{Code: "do_request_failed", Message: "context deadline exceeded"}), ShouldEqual, errortype.Timeout)
+		So(ClassifyError(http.StatusInternalServerError, &model.Error{Code: "do_request_failed", Message: "dial tcp: connection refused"}), ShouldEqual, errortype.Network)
+		So(ClassifyError(http.StatusBadRequest, &model.Error{Code: "content_filter"}), ShouldEqual, errortype.ContentFilter)
+		So(ClassifyError(http.StatusBadRequest, &model.Error{Code: 400, Message: "invalid messages"}), ShouldEqual, errortype.BadRequest)
+		So(ClassifyError(http.StatusServiceUnavailable, nil), ShouldEqual, errortype.Upstream)
+		So(ClassifyError(0, nil), ShouldEqual, errortype.Unknown)
+	})
+}
+
+func TestIsChannelFailure(t *testing.T) {
+	Convey("IsChannelFailure", t, func() {
+		So(IsChannelFailure(http.StatusInternalServerError, &model.Error{Type: "server_error"}), ShouldBeTrue)
+		So(IsChannelFailure(http.StatusTooManyRequests, &model.Error{Code: "rate_limit_exceeded"}), ShouldBeTrue)
+		So(IsChannelFailure(http.StatusBadRequest, &model.Error{Code: "do_request_failed"}), ShouldBeTrue)
+		So(IsChannelFailure(http.StatusBadRequest, &model.Error{Type: "invalid_request_error"}), ShouldBeFalse)
+		So(IsChannelFailure(http.StatusNotFound, nil), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,110 @@
+package monitor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// a leaked key could be used thousands of times, don't flood the root user
+const honeypotAlertInterval = 10 * time.Minute
+
+// at most this many source IPs are listed in a summary
+const honeypotSummaryMaxIPs = 10
+
+// honeypotWindow aggregates the uses of a honeypot token since its first use was alerted
+type honeypotWindow struct {
+	tokenName string
+	userId    int
+	hits      map[string]int
+	total     int
+}
+
+var honeypotWindows = make(map[int]*honeypotWindow)
+var honeypotWindowsLock sync.Mutex
+
+// RecordHoneypotHit records a use of a honeypot token, the first use alerts the root user at once,
+// the later uses in honeypotAlertInterval are counted per source IP and sent as one summary at its end
+func RecordHoneypotHit(tokenId int, tokenName string, userId int, ip string, details string) {
+	logger.SysError(fmt.Sprintf("honeypot token #%d (%s) used from %s: %s", tokenId, tokenName, ip, details))
+	if !addHoneypotHit(tokenId, tokenName, userId, ip) {
+		return
+	}
+	time.AfterFunc(honeypotAlertInterval, func() {
+		summarizeHoneypotWindow(tokenId)
+	})
+	model.RecordLog(userId, model.LogTypeSystem, fmt.Sprintf("蜜罐令牌「%s」被使用，来源 IP：%s", tokenName, ip))
+	subject := fmt.Sprintf("蜜罐令牌「%s」（#%d）被使用", tokenName, tokenId)
+	content := fmt.Sprintf("蜜罐令牌「%s」（#%d）被使用，该令牌可能已经泄露。请求详情：\n%s", tokenName, tokenId, details)
+	notifyRootUser(subject, content)
+}
+
+// addHoneypotHit counts the use in the window of the token, it reports whether the use opened the window
+func addHoneypotHit(tokenId int, tokenName string, userId int, ip string) bool {
+	honeypotWindowsLock.Lock()
+	defer honeypotWindowsLock.Unlock()
+	window, ok := honeypotWindows[tokenId]
+	if !ok {
+		window = &honeypotWindow{
+			tokenName: tokenName,
+			userId:    userId,
+			hits:      make(map[string]int),
+		}
+		honeypotWindows[tokenId] = window
+	}
+	window.hits[ip]++
+	window.total++
+	return !ok
+}
+
+// takeHoneypotWindow closes the window of the token, the next use opens a new one
+func takeHoneypotWindow(tokenId int) *honeypotWindow {
+	honeypotWindowsLock.Lock()
+	defer honeypotWindowsLock.Unlock()
+	window := honeypotWindows[tokenId]
+	delete(honeypotWindows, tokenId)
+	return window
+}
+
+func summarizeHoneypotWindow(tokenId int) {
+	window := takeHoneypotWindow(tokenId)
+	// the only use has been alerted already
+	if window == nil || window.total <= 1 {
+		return
+	}
+	sources := window.sources()
+	model.RecordLog(window.userId, model.LogTypeSystem, fmt.Sprintf("蜜罐令牌「%s」在 %d 分钟内被使用了 %d 次，来源 IP：%s",
+		window.tokenName, int(honeypotAlertInterval.Minutes()), window.total, sources))
+	subject := fmt.Sprintf("蜜罐令牌「%s」（#%d）被持续使用", window.tokenName, tokenId)
+	content := fmt.Sprintf("蜜罐令牌「%s」（#%d）在 %d 分钟内被使用了 %d 次，来源 IP：%s",
+		window.tokenName, tokenId, int(honeypotAlertInterval.Minutes()), window.total, sources)
+	notifyRootUser(subject, content)
+}
+
+// sources lists the source IPs by their number of uses, the most frequent first
+func (window *honeypotWindow) sources() string {
+	ips := make([]string, 0, len(window.hits))
+	for ip := range window.hits {
+		ips = append(ips, ip)
+	}
+	sort.Slice(ips, func(i, j int) bool {
+		if window.hits[ips[i]] != window.hits[ips[j]] {
+			return window.hits[ips[i]] > window.hits[ips[j]]
+		}
+		return ips[i] < ips[j]
+	})
+	var parts []string
+	for i, ip := range ips {
+		if i == honeypotSummaryMaxIPs {
+			parts = append(parts, fmt.Sprintf("等 %d 个 IP", len(ips)))
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%s（%d 次）", ip, window.hits[ip]))
+	}
+	return strings.Join(parts, "、")
+}
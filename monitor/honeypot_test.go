@@ -0,0 +1,32 @@
+package monitor
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHoneypotWindow(t *testing.T) {
+	Convey("only the first use of a window is alerted, the others are summarized", t, func() {
+		So(addHoneypotHit(1, "leaked", 1, "1.1.1.1"), ShouldBeTrue)
+		So(addHoneypotHit(1, "leaked", 1, "2.2.2.2"), ShouldBeFalse)
+		So(addHoneypotHit(1, "leaked", 1, "2.2.2.2"), ShouldBeFalse)
+		So(addHoneypotHit(2, "other", 1, "2.2.2.2"), ShouldBeTrue)
+
+		window := takeHoneypotWindow(1)
+		So(window.total, ShouldEqual, 3)
+		So(window.sources(), ShouldEqual, "2.2.2.2（2 次）、1.1.1.1（1 次）")
+		So(takeHoneypotWindow(1), ShouldBeNil)
+		So(addHoneypotHit(1, "leaked", 1, "1.1.1.1"), ShouldBeTrue)
+		takeHoneypotWindow(1)
+		takeHoneypotWindow(2)
+	})
+	Convey("the summary lists a limited number of IPs", t, func() {
+		window := &honeypotWindow{hits: make(map[string]int)}
+		for i := 0; i < honeypotSummaryMaxIPs+5; i++ {
+			window.hits[fmt.Sprintf("10.0.0.%02d", i)] = 1
+		}
+		So(window.sources(), ShouldEndWith, fmt.Sprintf("等 %d 个 IP", honeypotSummaryMaxIPs+5))
+	})
+}
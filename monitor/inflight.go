@@ -0,0 +1,142 @@
+package monitor
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type inflightRequest struct {
+	requestId      string
+	userId         int
+	tokenName      string
+	modelName      string
+	channelId      int64 // changes when the request is retried
+	startedAt      time.Time
+	streamedChunks int64
+	killed         int32
+	cancel         context.CancelFunc
+}
+
+type InflightRequest struct {
+	RequestId      string `json:"request_id"`
+	UserId         int    `json:"user_id"`
+	TokenName      string `json:"token_name"`
+	ModelName      string `json:"model_name"`
+	ChannelId      int    `json:"channel_id"`
+	StartedAt      int64  `json:"started_at"`
+	Duration       int64  `json:"duration"`        // milliseconds
+	StreamedChunks int64  `json:"streamed_chunks"` // the events sent to the client so far, about one token each
+}
+
+var inflightRequests = make(map[string]*inflightRequest)
+var inflightRequestsLock sync.Mutex
+
+// InflightHandle is held by the relay of a request, it's how the progress is reported
+type InflightHandle struct {
+	request *inflightRequest
+}
+
+// StartInflightRequest lists the request as in flight until the returned handle is finished,
+// the returned context is canceled if the request is killed
+func StartInflightRequest(ctx context.Context, requestId string, userId int, tokenName string, modelName string, channelId int) (context.Context, *InflightHandle) {
+	ctx, cancel := context.WithCancel(ctx)
+	request := &inflightRequest{
+		requestId: requestId,
+		userId:    userId,
+		tokenName: tokenName,
+		modelName: modelName,
+		channelId: int64(channelId),
+		startedAt: time.Now(),
+		cancel:    cancel,
+	}
+	inflightRequestsLock.Lock()
+	inflightRequests[requestId] = request
+	inflightRequestsLock.Unlock()
+	return ctx, &InflightHandle{request: request}
+}
+
+func (h *InflightHandle) SetChannel(channelId int) {
+	atomic.StoreInt64(&h.request.channelId, int64(channelId))
+}
+
+func (h *InflightHandle) AddStreamedChunks(chunks int) {
+	atomic.AddInt64(&h.request.streamedChunks, int64(chunks))
+}
+
+// Killed tells if the request was terminated by an admin
+func (h *InflightHandle) Killed() bool {
+	return atomic.LoadInt32(&h.request.killed) == 1
+}
+
+func (h *InflightHandle) Finish() {
+	h.request.cancel()
+	inflightRequestsLock.Lock()
+	// the id may be reused by a client if the ids of the requests are accepted
+	if inflightRequests[h.request.requestId] == h.request {
+		delete(inflightRequests, h.request.requestId)
+	}
+	inflightRequestsLock.Unlock()
+}
+
+// GetInflightRequests lists the requests in flight on this node, the longest running first,
+// channelId 0 means all the channels
+func GetInflightRequests(channelId int) []*InflightRequest {
+	now := time.Now()
+	inflightRequestsLock.Lock()
+	requests := make([]*InflightRequest, 0, len(inflightRequests))
+	for _, request := range inflightRequests {
+		requestChannelId := int(atomic.LoadInt64(&request.channelId))
+		if channelId != 0 && requestChannelId != channelId {
+			continue
+		}
+		requests = append(requests, &InflightRequest{
+			RequestId:      request.requestId,
+			UserId:         request.userId,
+			TokenName:      request.tokenName,
+			ModelName:      request.modelName,
+			ChannelId:      requestChannelId,
+			StartedAt:      request.startedAt.Unix(),
+			Duration:       now.Sub(request.startedAt).Milliseconds(),
+			StreamedChunks: atomic.LoadInt64(&request.streamedChunks),
+		})
+	}
+	inflightRequestsLock.Unlock()
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].Duration > requests[j].Duration
+	})
+	return requests
+}
+
+func kill(request *inflightRequest) {
+	atomic.StoreInt32(&request.killed, 1)
+	request.cancel()
+}
+
+// KillInflightRequest terminates the request, false if it's not in flight on this node
+func KillInflightRequest(requestId string) bool {
+	inflightRequestsLock.Lock()
+	defer inflightRequestsLock.Unlock()
+	request, ok := inflightRequests[requestId]
+	if !ok {
+		return false
+	}
+	kill(request)
+	return true
+}
+
+// KillChannelInflightRequests terminates all the requests on the channel, and returns how many there were
+func KillChannelInflightRequests(channelId int) int {
+	inflightRequestsLock.Lock()
+	defer inflightRequestsLock.Unlock()
+	count := 0
+	for _, request := range inflightRequests {
+		if int(atomic.LoadInt64(&request.channelId)) == channelId {
+			kill(request)
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,46 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestInflightRequests(t *testing.T) {
+	Convey("in-flight requests", t, func() {
+		ctx1, handle1 := StartInflightRequest(context.Background(), "request-1", 1, "token", "gpt-4o", 1)
+		ctx2, handle2 := StartInflightRequest(context.Background(), "request-2", 2, "token", "gpt-4o", 2)
+		defer handle1.Finish()
+		defer handle2.Finish()
+		handle2.AddStreamedChunks(3)
+
+		Convey("are listed by channel", func() {
+			So(GetInflightRequests(0), ShouldHaveLength, 2)
+			requests := GetInflightRequests(2)
+			So(requests, ShouldHaveLength, 1)
+			So(requests[0].RequestId, ShouldEqual, "request-2")
+			So(requests[0].StreamedChunks, ShouldEqual, 3)
+		})
+
+		Convey("follow the channel of the retry", func() {
+			handle1.SetChannel(2)
+			So(KillChannelInflightRequests(2), ShouldEqual, 2)
+			So(handle1.Killed(), ShouldBeTrue)
+			So(ctx1.Err(), ShouldNotBeNil)
+		})
+
+		Convey("are killed by id", func() {
+			So(KillInflightRequest("request-2"), ShouldBeTrue)
+			So(handle2.Killed(), ShouldBeTrue)
+			So(ctx2.Err(), ShouldNotBeNil)
+			So(handle1.Killed(), ShouldBeFalse)
+			So(ctx1.Err(), ShouldBeNil)
+		})
+
+		Convey("are gone once finished", func() {
+			handle1.Finish()
+			So(KillInflightRequest("request-1"), ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,238 @@
+package monitor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+const (
+	keyOutcomeSuccess = iota
+	keyOutcomeUnauthorized
+	keyOutcomeRateLimited
+	keyOutcomeInsufficientQuota
+	keyOutcomeOtherError
+	keyOutcomeClientError
+)
+
+// how much each kind of outcome hurts the health of a key
+var keyOutcomePenalty = map[int]float64{
+	keyOutcomeSuccess:           0,
+	keyOutcomeUnauthorized:      1,
+	keyOutcomeRateLimited:       0.5,
+	keyOutcomeInsufficientQuota: 1,
+	keyOutcomeOtherError:        0.3,
+	keyOutcomeClientError:       0,
+}
+
+// keys whose score is this close to the best one are considered equally healthy,
+// so that the load is still spread between them
+const keyScoreTolerance = 0.05
+
+type keyStat struct {
+	recent            []int
+	requests          int64
+	successes         int64
+	unauthorized      int64
+	rateLimited       int64
+	insufficientQuota int64
+	avgLatency        float64 // in milliseconds, exponential moving average
+	dead              bool    // the upstream rejected the key for good, until it succeeds again
+}
+
+type KeyStat struct {
+	Index             int     `json:"index"`
+	Key               string  `json:"key"`
+	Score             float64 `json:"score"`
+	Requests          int64   `json:"requests"`
+	Successes         int64   `json:"successes"`
+	Unauthorized      int64   `json:"unauthorized"`
+	RateLimited       int64   `json:"rate_limited"`
+	InsufficientQuota int64   `json:"insufficient_quota"`
+	AvgLatency        float64 `json:"avg_latency"`
+}
+
+// keyStats is indexed by the channel and the hash of the key, so that the stats follow the key when the keys of
+// the channel are reordered or removed by the admins
+var keyStats = make(map[int]map[string]*keyStat)
+var keyStatsLock sync.Mutex
+
+// HashKey identifies a key of a channel without keeping the key itself
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (s *keyStat) score() float64 {
+	if s != nil && s.dead {
+		return 0
+	}
+	if s == nil || len(s.recent) == 0 {
+		// never used keys are optimistic, so that they will get a chance
+		return 1
+	}
+	penalty := 0.0
+	for _, outcome := range s.recent {
+		penalty += keyOutcomePenalty[outcome]
+	}
+	score := 1 - penalty/float64(len(s.recent))
+	// slow keys are a little bit less healthy, 30s latency halves the score
+	return score / (1 + s.avgLatency/30000)
+}
+
+func classifyKeyOutcome(statusCode int, err *model.Error) int {
+	if err == nil {
+		return keyOutcomeSuccess
+	}
+	if err.Type == "insufficient_quota" || err.Code == "insufficient_quota" {
+		return keyOutcomeInsufficientQuota
+	}
+	if statusCode == http.StatusUnauthorized || err.Type == "authentication_error" || err.Code == "invalid_api_key" {
+		return keyOutcomeUnauthorized
+	}
+	if statusCode == http.StatusTooManyRequests {
+		return keyOutcomeRateLimited
+	}
+	if !IsChannelFailure(statusCode, err) {
+		// the request was rejected for what the client sent, the key is fine
+		return keyOutcomeClientError
+	}
+	return keyOutcomeOtherError
+}
+
+// getKeyStat must be called with keyStatsLock held
+func getKeyStat(channelId int, keyHash string) *keyStat {
+	if keyStats[channelId] == nil {
+		keyStats[channelId] = make(map[string]*keyStat)
+	}
+	stat := keyStats[channelId][keyHash]
+	if stat == nil {
+		stat = &keyStat{}
+		keyStats[channelId][keyHash] = stat
+	}
+	return stat
+}
+
+// RecordKeyResult records the result of a request made with the key of the channel whose hash is keyHash,
+// err should be nil if the request succeeded
+func RecordKeyResult(channelId int, keyHash string, statusCode int, err *model.Error, latency time.Duration) {
+	if keyHash == "" {
+		return
+	}
+	outcome := classifyKeyOutcome(statusCode, err)
+	keyStatsLock.Lock()
+	defer keyStatsLock.Unlock()
+	stat := getKeyStat(channelId, keyHash)
+	if len(stat.recent) >= config.KeyHealthWindowSize {
+		stat.recent = stat.recent[1:]
+	}
+	stat.recent = append(stat.recent, outcome)
+	stat.requests++
+	switch outcome {
+	case keyOutcomeSuccess:
+		stat.successes++
+		stat.dead = false
+	case keyOutcomeUnauthorized:
+		stat.unauthorized++
+	case keyOutcomeRateLimited:
+		stat.rateLimited++
+	case keyOutcomeInsufficientQuota:
+		stat.insufficientQuota++
+	}
+	milliseconds := float64(latency.Milliseconds())
+	if stat.requests == 1 {
+		stat.avgLatency = milliseconds
+	} else {
+		stat.avgLatency = 0.8*stat.avgLatency + 0.2*milliseconds
+	}
+}
+
+// MarkKeyDead stops selecting the key of the channel, for the failures which would disable a channel of a single key
+func MarkKeyDead(channelId int, keyHash string) {
+	if keyHash == "" {
+		return
+	}
+	keyStatsLock.Lock()
+	defer keyStatsLock.Unlock()
+	getKeyStat(channelId, keyHash).dead = true
+}
+
+// AllKeysDead tells whether every key of the channel has been marked dead
+func AllKeysDead(channelId int, keys []string) bool {
+	if len(keys) == 0 {
+		return false
+	}
+	keyStatsLock.Lock()
+	defer keyStatsLock.Unlock()
+	for _, key := range keys {
+		stat := keyStats[channelId][HashKey(key)]
+		if stat == nil || !stat.dead {
+			return false
+		}
+	}
+	return true
+}
+
+// SelectKey returns the index of the healthiest of the keys of the channel
+func SelectKey(channelId int, keys []string) int {
+	keyCount := len(keys)
+	if keyCount <= 1 {
+		return 0
+	}
+	keyStatsLock.Lock()
+	scores := make([]float64, keyCount)
+	bestScore := -1.0
+	for i, key := range keys {
+		scores[i] = keyStats[channelId][HashKey(key)].score()
+		if scores[i] > bestScore {
+			bestScore = scores[i]
+		}
+	}
+	keyStatsLock.Unlock()
+	candidates := make([]int, 0, keyCount)
+	for i, score := range scores {
+		if score >= bestScore-keyScoreTolerance {
+			candidates = append(candidates, i)
+		}
+	}
+	return candidates[rand.Intn(len(candidates))]
+}
+
+// GetKeyStats returns the health of every key of the channel, keys are masked
+func GetKeyStats(channelId int, keys []string) []KeyStat {
+	keyStatsLock.Lock()
+	defer keyStatsLock.Unlock()
+	stats := make([]KeyStat, 0, len(keys))
+	for i, key := range keys {
+		stat := keyStats[channelId][HashKey(key)]
+		item := KeyStat{
+			Index: i,
+			Key:   MaskKey(key),
+			Score: stat.score(),
+		}
+		if stat != nil {
+			item.Requests = stat.requests
+			item.Successes = stat.successes
+			item.Unauthorized = stat.unauthorized
+			item.RateLimited = stat.rateLimited
+			item.InsufficientQuota = stat.insufficientQuota
+			item.AvgLatency = stat.avgLatency
+		}
+		stats = append(stats, item)
+	}
+	return stats
+}
+
+// MaskKey keeps only the first and the last 4 characters of the key, for showing it to the admins
+func MaskKey(key string) string {
+	if len(key) <= 8 {
+		return "****"
+	}
+	return key[:4] + "****" + key[len(key)-4:]
+}
@@ -0,0 +1,73 @@
+package monitor
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestSelectKey(t *testing.T) {
+	Convey("SelectKey", t, func() {
+		channelId := 1
+		for i := 0; i < 10; i++ {
+			RecordKeyResult(channelId, HashKey("sk-aaaaaaaaaaaa"), http.StatusUnauthorized, &model.Error{Type: "authentication_error"}, time.Second)
+			RecordKeyResult(channelId, HashKey("sk-bbbbbbbbbbbb"), http.StatusOK, nil, time.Second)
+		}
+		So(SelectKey(channelId, []string{"sk-aaaaaaaaaaaa", "sk-bbbbbbbbbbbb"}), ShouldEqual, 1)
+		// a key never used is considered healthy
+		So(SelectKey(channelId, []string{"sk-aaaaaaaaaaaa", "sk-bbbbbbbbbbbb", "sk-cccccccccccc"}), ShouldBeIn, []int{1, 2})
+		stats := GetKeyStats(channelId, []string{"sk-aaaaaaaaaaaa", "sk-bbbbbbbbbbbb"})
+		So(stats[0].Unauthorized, ShouldEqual, 10)
+		So(stats[0].Key, ShouldEqual, "sk-a****aaaa")
+		So(stats[1].Successes, ShouldEqual, 10)
+	})
+}
+
+func TestRecordKeyResultClientError(t *testing.T) {
+	Convey("the requests rejected for what the client sent don't hurt the key", t, func() {
+		channelId := 2
+		for i := 0; i < 10; i++ {
+			RecordKeyResult(channelId, HashKey("sk-aaaaaaaaaaaa"), http.StatusBadRequest, &model.Error{Type: "invalid_request_error"}, time.Second)
+			RecordKeyResult(channelId, HashKey("sk-bbbbbbbbbbbb"), http.StatusInternalServerError, &model.Error{Type: "server_error"}, time.Second)
+		}
+		So(SelectKey(channelId, []string{"sk-aaaaaaaaaaaa", "sk-bbbbbbbbbbbb"}), ShouldEqual, 0)
+	})
+}
+
+func TestKeyStatsFollowTheKey(t *testing.T) {
+	Convey("the stats of a key stay with it when the keys are reordered", t, func() {
+		channelId := 3
+		for i := 0; i < 10; i++ {
+			RecordKeyResult(channelId, HashKey("sk-aaaaaaaaaaaa"), http.StatusUnauthorized, &model.Error{Type: "authentication_error"}, time.Second)
+			RecordKeyResult(channelId, HashKey("sk-bbbbbbbbbbbb"), http.StatusOK, nil, time.Second)
+		}
+		keys := []string{"sk-bbbbbbbbbbbb", "sk-aaaaaaaaaaaa"}
+		So(SelectKey(channelId, keys), ShouldEqual, 0)
+		stats := GetKeyStats(channelId, keys)
+		So(stats[0].Successes, ShouldEqual, 10)
+		So(stats[1].Unauthorized, ShouldEqual, 10)
+		// a removed key leaves its stats behind
+		stats = GetKeyStats(channelId, []string{"sk-cccccccccccc"})
+		So(stats[0].Requests, ShouldEqual, 0)
+	})
+}
+
+func TestMarkKeyDead(t *testing.T) {
+	Convey("a dead key isn't selected until it succeeds again", t, func() {
+		channelId := 4
+		keys := []string{"sk-aaaaaaaaaaaa", "sk-bbbbbbbbbbbb"}
+		MarkKeyDead(channelId, HashKey(keys[0]))
+		So(SelectKey(channelId, keys), ShouldEqual, 1)
+		So(AllKeysDead(channelId, keys), ShouldBeFalse)
+		MarkKeyDead(channelId, HashKey(keys[1]))
+		So(AllKeysDead(channelId, keys), ShouldBeTrue)
+
+		RecordKeyResult(channelId, HashKey(keys[0]), http.StatusOK, nil, time.Second)
+		So(AllKeysDead(channelId, keys), ShouldBeFalse)
+		So(SelectKey(channelId, keys), ShouldEqual, 0)
+		So(AllKeysDead(channelId, nil), ShouldBeFalse)
+	})
+}
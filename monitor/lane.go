@@ -0,0 +1,131 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/relay/constant/lane"
+)
+
+var ErrLaneQueueTimeout = errors.New("timed out waiting for the channel to be unsaturated")
+
+type channelLoad struct {
+	inFlight int
+	released chan struct{} // closed and replaced whenever a request finishes
+}
+
+type laneStat struct {
+	requests   int64
+	queued     int64
+	rejected   int64
+	inFlight   int64
+	avgWait    float64 // in milliseconds, exponential moving average of queued requests
+	avgLatency float64 // in milliseconds, exponential moving average
+}
+
+type LaneStat struct {
+	Lane       string  `json:"lane"`
+	Requests   int64   `json:"requests"`
+	Queued     int64   `json:"queued"`
+	Rejected   int64   `json:"rejected"`
+	InFlight   int64   `json:"in_flight"`
+	AvgWait    float64 `json:"avg_wait"`
+	AvgLatency float64 `json:"avg_latency"`
+}
+
+var channelLoads = make(map[int]*channelLoad)
+var laneStats = map[string]*laneStat{
+	lane.Interactive: {},
+	lane.Batch:       {},
+}
+var laneLock sync.Mutex
+
+func getChannelLoad(channelId int) *channelLoad {
+	load, ok := channelLoads[channelId]
+	if !ok {
+		load = &channelLoad{released: make(chan struct{})}
+		channelLoads[channelId] = load
+	}
+	return load
+}
+
+// AcquireLane takes a slot of the channel for the request, interactive requests always get one,
+// batch requests wait until the channel has less than threshold requests in flight.
+// The returned function must be called once the request is finished.
+func AcquireLane(ctx context.Context, channelId int, requestLane string, threshold int, timeout time.Duration) (func(), error) {
+	start := time.Now()
+	var timer <-chan time.Time
+	laneLock.Lock()
+	stat := laneStats[requestLane]
+	stat.requests++
+	load := getChannelLoad(channelId)
+	for requestLane == lane.Batch && load.inFlight >= threshold {
+		if timer == nil {
+			stat.queued++
+			timer = time.After(timeout)
+		}
+		released := load.released
+		laneLock.Unlock()
+		select {
+		case <-released:
+		case <-timer:
+			laneLock.Lock()
+			stat.rejected++
+			laneLock.Unlock()
+			return nil, ErrLaneQueueTimeout
+		case <-ctx.Done():
+			laneLock.Lock()
+			stat.rejected++
+			laneLock.Unlock()
+			return nil, ctx.Err()
+		}
+		laneLock.Lock()
+	}
+	load.inFlight++
+	stat.inFlight++
+	if timer != nil {
+		stat.avgWait = movingAverage(stat.avgWait, float64(time.Since(start).Milliseconds()))
+	}
+	laneLock.Unlock()
+	acquiredAt := time.Now()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			laneLock.Lock()
+			defer laneLock.Unlock()
+			load.inFlight--
+			close(load.released)
+			load.released = make(chan struct{})
+			stat.inFlight--
+			stat.avgLatency = movingAverage(stat.avgLatency, float64(time.Since(acquiredAt).Milliseconds()))
+		})
+	}, nil
+}
+
+func movingAverage(avg float64, value float64) float64 {
+	if avg == 0 {
+		return value
+	}
+	return avg*0.9 + value*0.1
+}
+
+func GetLaneStats() []LaneStat {
+	laneLock.Lock()
+	defer laneLock.Unlock()
+	stats := make([]LaneStat, 0, len(laneStats))
+	for _, name := range []string{lane.Interactive, lane.Batch} {
+		stat := laneStats[name]
+		stats = append(stats, LaneStat{
+			Lane:       name,
+			Requests:   stat.requests,
+			Queued:     stat.queued,
+			Rejected:   stat.rejected,
+			InFlight:   stat.inFlight,
+			AvgWait:    stat.avgWait,
+			AvgLatency: stat.avgLatency,
+		})
+	}
+	return stats
+}
@@ -0,0 +1,168 @@
+package monitor
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// realtimeWindow is the number of seconds the realtime rates are averaged over
+const realtimeWindow = 10
+
+type realtimeChannelBucket struct {
+	requests int64
+	failures int64
+	retries  int64 // the failures retried on another channel
+}
+
+type realtimeBucket struct {
+	second   int64
+	requests int64
+	tokens   int64
+	retries  int64
+	channels map[int]*realtimeChannelBucket
+}
+
+type RealtimeChannelStat struct {
+	Id        int     `json:"id"`
+	QPS       float64 `json:"qps"`
+	ErrorRate float64 `json:"error_rate"`
+	RetryRate float64 `json:"retry_rate"` // the share of the requests sent to the channel which are retried elsewhere
+	InFlight  int     `json:"in_flight"`  // only tracked when priority lanes are enabled
+}
+
+type RealtimeStats struct {
+	Timestamp        int64                  `json:"timestamp"`
+	QPS              float64                `json:"qps"`
+	ActiveStreams    int64                  `json:"active_streams"`
+	TokensPerSecond  float64                `json:"tokens_per_second"`
+	RetriesPerSecond float64                `json:"retries_per_second"`
+	Channels         []*RealtimeChannelStat `json:"channels"`
+}
+
+var realtimeBuckets [realtimeWindow + 1]realtimeBucket
+var realtimeLock sync.Mutex
+var activeStreams int64
+
+// currentRealtimeBucket must be called with realtimeLock held
+func currentRealtimeBucket() *realtimeBucket {
+	now := time.Now().Unix()
+	bucket := &realtimeBuckets[now%int64(len(realtimeBuckets))]
+	if bucket.second != now {
+		*bucket = realtimeBucket{second: now, channels: make(map[int]*realtimeChannelBucket)}
+	}
+	return bucket
+}
+
+func RecordRealtimeRequest() {
+	realtimeLock.Lock()
+	defer realtimeLock.Unlock()
+	currentRealtimeBucket().requests++
+}
+
+func RecordRealtimeTokens(tokens int) {
+	realtimeLock.Lock()
+	defer realtimeLock.Unlock()
+	currentRealtimeBucket().tokens += int64(tokens)
+}
+
+// RecordRealtimeChannelResult records every attempt of relaying to the channel, including retries
+func RecordRealtimeChannelResult(channelId int, success bool) {
+	realtimeLock.Lock()
+	defer realtimeLock.Unlock()
+	bucket := currentRealtimeBucket()
+	channel, ok := bucket.channels[channelId]
+	if !ok {
+		channel = &realtimeChannelBucket{}
+		bucket.channels[channelId] = channel
+	}
+	channel.requests++
+	if !success {
+		channel.failures++
+	}
+}
+
+// RecordRetry records a request retried on another channel after failing on the channel
+func RecordRetry(channelId int) {
+	realtimeLock.Lock()
+	defer realtimeLock.Unlock()
+	bucket := currentRealtimeBucket()
+	bucket.retries++
+	channel, ok := bucket.channels[channelId]
+	if !ok {
+		channel = &realtimeChannelBucket{}
+		bucket.channels[channelId] = channel
+	}
+	channel.retries++
+}
+
+func StreamStarted() {
+	atomic.AddInt64(&activeStreams, 1)
+}
+
+func StreamFinished() {
+	atomic.AddInt64(&activeStreams, -1)
+}
+
+// GetRealtimeStats averages the last realtimeWindow complete seconds, the current one is still filling up
+func GetRealtimeStats() *RealtimeStats {
+	now := time.Now().Unix()
+	stats := &RealtimeStats{
+		Timestamp:     now,
+		ActiveStreams: atomic.LoadInt64(&activeStreams),
+	}
+	channels := make(map[int]*realtimeChannelBucket)
+	var requests, tokens, retries int64
+	realtimeLock.Lock()
+	for i := range realtimeBuckets {
+		bucket := &realtimeBuckets[i]
+		if bucket.second >= now || bucket.second < now-realtimeWindow {
+			continue
+		}
+		requests += bucket.requests
+		tokens += bucket.tokens
+		retries += bucket.retries
+		for id, channelBucket := range bucket.channels {
+			channel, ok := channels[id]
+			if !ok {
+				channel = &realtimeChannelBucket{}
+				channels[id] = channel
+			}
+			channel.requests += channelBucket.requests
+			channel.failures += channelBucket.failures
+			channel.retries += channelBucket.retries
+		}
+	}
+	realtimeLock.Unlock()
+	stats.QPS = float64(requests) / realtimeWindow
+	stats.TokensPerSecond = float64(tokens) / realtimeWindow
+	stats.RetriesPerSecond = float64(retries) / realtimeWindow
+
+	laneLock.Lock()
+	for id, load := range channelLoads {
+		if _, ok := channels[id]; !ok && load.inFlight > 0 {
+			channels[id] = &realtimeChannelBucket{}
+		}
+	}
+	stats.Channels = make([]*RealtimeChannelStat, 0, len(channels))
+	for id, channel := range channels {
+		stat := &RealtimeChannelStat{
+			Id:  id,
+			QPS: float64(channel.requests) / realtimeWindow,
+		}
+		if channel.requests > 0 {
+			stat.ErrorRate = float64(channel.failures) / float64(channel.requests)
+			stat.RetryRate = float64(channel.retries) / float64(channel.requests)
+		}
+		if load, ok := channelLoads[id]; ok {
+			stat.InFlight = load.inFlight
+		}
+		stats.Channels = append(stats.Channels, stat)
+	}
+	laneLock.Unlock()
+	sort.Slice(stats.Channels, func(i, j int) bool {
+		return stats.Channels[i].Id < stats.Channels[j].Id
+	})
+	return stats
+}
@@ -0,0 +1,135 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// the spending is a token bucket holding up to a minute of GlobalSpendRateLimit, refilled continuously,
+// a request is let through while the bucket isn't empty and its quota is taken off once it's billed,
+// so the bucket can go below zero and the requests wait until it's paid back
+
+const spendBucketKey = "spendRateLimit"
+
+// alerting on every rejected request would flood the root user
+const spendAlertInterval = 10 * time.Minute
+
+type spendBucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// take refills the bucket up to limit as of now, then takes amount off and returns what's left
+func (b *spendBucket) take(limit float64, amount float64, now time.Time) float64 {
+	if b.updatedAt.IsZero() {
+		b.tokens = limit
+	} else if elapsed := now.Sub(b.updatedAt); elapsed > 0 {
+		b.tokens += elapsed.Minutes() * limit
+	}
+	if b.tokens > limit {
+		b.tokens = limit
+	}
+	if now.After(b.updatedAt) {
+		b.updatedAt = now
+	}
+	b.tokens -= amount
+	return b.tokens
+}
+
+var localSpendBucket spendBucket
+var localSpendBucketLock sync.Mutex
+
+var lastSpendAlert time.Time
+var lastSpendAlertLock sync.Mutex
+
+// shared by all the instances of the deployment, same as spendBucket.take
+var spendBucketScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local amount = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "updated_at")
+local tokens = tonumber(bucket[1])
+local updatedAt = tonumber(bucket[2])
+if tokens == nil or updatedAt == nil then
+	tokens = limit
+	updatedAt = now
+end
+if now > updatedAt then
+	tokens = tokens + (now - updatedAt) * limit / 60000
+	updatedAt = now
+end
+if tokens > limit then
+	tokens = limit
+end
+tokens = tokens - amount
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "updated_at", tostring(updatedAt))
+redis.call("PEXPIRE", KEYS[1], 120000)
+return tostring(tokens)
+`)
+
+func takeSpend(amount int64) (float64, error) {
+	limit := float64(config.GlobalSpendRateLimit)
+	if !common.RedisEnabled {
+		localSpendBucketLock.Lock()
+		defer localSpendBucketLock.Unlock()
+		return localSpendBucket.take(limit, float64(amount), time.Now()), nil
+	}
+	result, err := spendBucketScript.Run(context.Background(), common.RDB, []string{spendBucketKey},
+		limit, amount, time.Now().UnixMilli()).Text()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(result, 64)
+}
+
+// SpendAllowed tells if a request can be relayed under GlobalSpendRateLimit, alerting the root user if it can't
+func SpendAllowed() bool {
+	if config.GlobalSpendRateLimit <= 0 {
+		return true
+	}
+	tokens, err := takeSpend(0)
+	if err != nil {
+		// a broken redis shouldn't stop the service
+		logger.SysError("failed to check the spend rate limit: " + err.Error())
+		return true
+	}
+	if tokens > 0 {
+		return true
+	}
+	alertSpendRateLimit()
+	return false
+}
+
+// RecordSpend takes the billed quota of a request off the spend rate limit
+func RecordSpend(quota int64) {
+	if config.GlobalSpendRateLimit <= 0 || quota <= 0 {
+		return
+	}
+	_, err := takeSpend(quota)
+	if err != nil {
+		logger.SysError("failed to record the spend: " + err.Error())
+	}
+}
+
+func alertSpendRateLimit() {
+	lastSpendAlertLock.Lock()
+	if time.Since(lastSpendAlert) < spendAlertInterval {
+		lastSpendAlertLock.Unlock()
+		return
+	}
+	lastSpendAlert = time.Now()
+	lastSpendAlertLock.Unlock()
+	logger.SysError(fmt.Sprintf("global spend rate limit %d quota per minute exceeded, requests are rejected", config.GlobalSpendRateLimit))
+	subject := "全局消费速率超出限制"
+	content := fmt.Sprintf("全局额度消费速率超过了每分钟 %d 的限制，新的请求将被拒绝，直到消费速率回落。"+
+		"请检查是否有令牌泄露或者客户端陷入了循环调用。", config.GlobalSpendRateLimit)
+	notifyRootUser(subject, content)
+}
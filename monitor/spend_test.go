@@ -0,0 +1,29 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSpendBucket(t *testing.T) {
+	Convey("spendBucket", t, func() {
+		now := time.Now()
+		bucket := spendBucket{}
+		Convey("starts full", func() {
+			So(bucket.take(600, 0, now), ShouldEqual, 600)
+		})
+
+		Convey("goes below zero and refills over time", func() {
+			So(bucket.take(600, 900, now), ShouldEqual, -300)
+			So(bucket.take(600, 0, now.Add(30*time.Second)), ShouldEqual, 0)
+			So(bucket.take(600, 0, now.Add(time.Minute)), ShouldEqual, 300)
+		})
+
+		Convey("doesn't refill beyond the limit", func() {
+			So(bucket.take(600, 100, now), ShouldEqual, 500)
+			So(bucket.take(600, 0, now.Add(time.Hour)), ShouldEqual, 600)
+		})
+	})
+}
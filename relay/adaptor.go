@@ -2,20 +2,29 @@ package relay
 
 import (
 	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/ai21"
 	"github.com/songquanpeng/one-api/relay/adaptor/aiproxy"
 	"github.com/songquanpeng/one-api/relay/adaptor/ali"
 	"github.com/songquanpeng/one-api/relay/adaptor/anthropic"
+	"github.com/songquanpeng/one-api/relay/adaptor/assemblyai"
 	"github.com/songquanpeng/one-api/relay/adaptor/aws"
 	"github.com/songquanpeng/one-api/relay/adaptor/baidu"
 	"github.com/songquanpeng/one-api/relay/adaptor/cloudflare"
 	"github.com/songquanpeng/one-api/relay/adaptor/cohere"
 	"github.com/songquanpeng/one-api/relay/adaptor/coze"
+	"github.com/songquanpeng/one-api/relay/adaptor/deepgram"
 	"github.com/songquanpeng/one-api/relay/adaptor/deepl"
+	"github.com/songquanpeng/one-api/relay/adaptor/elevenlabs"
 	"github.com/songquanpeng/one-api/relay/adaptor/gemini"
+	"github.com/songquanpeng/one-api/relay/adaptor/huggingface"
+	"github.com/songquanpeng/one-api/relay/adaptor/midjourney"
 	"github.com/songquanpeng/one-api/relay/adaptor/ollama"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/relay/adaptor/palm"
+	"github.com/songquanpeng/one-api/relay/adaptor/replicate"
+	"github.com/songquanpeng/one-api/relay/adaptor/stability"
 	"github.com/songquanpeng/one-api/relay/adaptor/tencent"
+	"github.com/songquanpeng/one-api/relay/adaptor/vertexai"
 	"github.com/songquanpeng/one-api/relay/adaptor/xunfei"
 	"github.com/songquanpeng/one-api/relay/adaptor/zhipu"
 	"github.com/songquanpeng/one-api/relay/apitype"
@@ -55,6 +64,24 @@ func GetAdaptor(apiType int) adaptor.Adaptor {
 		return &cloudflare.Adaptor{}
 	case apitype.DeepL:
 		return &deepl.Adaptor{}
+	case apitype.VertexAI:
+		return &vertexai.Adaptor{}
+	case apitype.AI21:
+		return &ai21.Adaptor{}
+	case apitype.HuggingFace:
+		return &huggingface.Adaptor{}
+	case apitype.Replicate:
+		return &replicate.Adaptor{}
+	case apitype.StabilityAI:
+		return &stability.Adaptor{}
+	case apitype.Midjourney:
+		return &midjourney.Adaptor{}
+	case apitype.ElevenLabs:
+		return &elevenlabs.Adaptor{}
+	case apitype.Deepgram:
+		return &deepgram.Adaptor{}
+	case apitype.AssemblyAI:
+		return &assemblyai.Adaptor{}
 	}
 	return nil
 }
@@ -0,0 +1,9 @@
+package ai21
+
+// https://docs.ai21.com/reference/jamba-15-api-ref
+
+var ModelList = []string{
+	"jamba-1.5-mini",
+	"jamba-1.5-large",
+	"jamba-instruct",
+}
@@ -0,0 +1,112 @@
+package ai21
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://docs.ai21.com/reference/jamba-15-api-ref
+
+func ConvertRequest(textRequest model.GeneralOpenAIRequest) *Request {
+	request := Request{
+		Model:       textRequest.Model,
+		Tools:       textRequest.Tools,
+		N:           textRequest.N,
+		MaxTokens:   textRequest.MaxTokens,
+		Temperature: textRequest.Temperature,
+		TopP:        textRequest.TopP,
+		Stop:        textRequest.ParseStop(),
+		Stream:      textRequest.Stream,
+	}
+	if textRequest.ResponseFormat != nil && textRequest.ResponseFormat.Type != "" {
+		request.ResponseFormat = &ResponseFormat{Type: textRequest.ResponseFormat.Type}
+	}
+	if len(textRequest.Messages) == 0 {
+		// completions
+		prompt, _ := textRequest.Prompt.(string)
+		request.Messages = []Message{{Role: "user", Content: prompt}}
+		return &request
+	}
+	for _, message := range textRequest.Messages {
+		role := message.Role
+		if role != "system" && role != "assistant" && role != "tool" {
+			role = "user"
+		}
+		request.Messages = append(request.Messages, Message{
+			Role:       role,
+			Content:    message.StringContent(),
+			ToolCalls:  message.ToolCalls,
+			ToolCallId: message.ToolCallId,
+		})
+	}
+	return &request
+}
+
+func responseAI212OpenAI(response *Response) *openai.TextResponse {
+	fullTextResponse := openai.TextResponse{
+		Id:      response.Id,
+		Object:  "chat.completion",
+		Created: helper.GetTimestamp(),
+		Choices: make([]openai.TextResponseChoice, 0, len(response.Choices)),
+	}
+	for _, choice := range response.Choices {
+		fullTextResponse.Choices = append(fullTextResponse.Choices, openai.TextResponseChoice{
+			Index: choice.Index,
+			Message: model.Message{
+				Role:      "assistant",
+				Content:   choice.Message.Content,
+				ToolCalls: choice.Message.ToolCalls,
+			},
+			FinishReason: choice.FinishReason,
+		})
+	}
+	return &fullTextResponse
+}
+
+// ParseResponse implements adaptor.ProviderAdapter.
+func (a *Adaptor) ParseResponse(meta *meta.Meta, body []byte) (*openai.TextResponse, *model.ErrorWithStatusCode) {
+	var ai21Response Response
+	err := json.Unmarshal(body, &ai21Response)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+	}
+	return responseAI212OpenAI(&ai21Response), nil
+}
+
+// ParseStreamChunk implements adaptor.ProviderAdapter.
+func (a *Adaptor) ParseStreamChunk(meta *meta.Meta, data string) (*openai.ChatCompletionsStreamResponse, error) {
+	var ai21Response StreamResponse
+	err := json.Unmarshal([]byte(data), &ai21Response)
+	if err != nil {
+		return nil, err
+	}
+	if len(ai21Response.Choices) == 0 {
+		return nil, nil
+	}
+	response := openai.ChatCompletionsStreamResponse{
+		Id:      ai21Response.Id,
+		Choices: make([]openai.ChatCompletionsStreamResponseChoice, 0, len(ai21Response.Choices)),
+	}
+	for _, choice := range ai21Response.Choices {
+		response.Choices = append(response.Choices, openai.ChatCompletionsStreamResponseChoice{
+			Index:        choice.Index,
+			Delta:        choice.Delta,
+			FinishReason: choice.FinishReason,
+		})
+	}
+	return &response, nil
+}
+
+// ExtractUsage implements adaptor.ProviderAdapter, the usage of a stream comes with the last chunk.
+func (a *Adaptor) ExtractUsage(data []byte) *model.Usage {
+	var ai21Response struct {
+		Usage *model.Usage `json:"usage"`
+	}
+	_ = json.Unmarshal(data, &ai21Response)
+	return ai21Response.Usage
+}
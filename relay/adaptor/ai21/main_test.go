@@ -0,0 +1,60 @@
+package ai21
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestDoResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("DoResponse", t, func() {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		resp := &http.Response{
+			StatusCode: http.StatusOK,
+			Body: io.NopCloser(strings.NewReader("data: {\"id\":\"chat-1\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\"}}]}\n\n" +
+				"data: {\"id\":\"chat-1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hello\"}}]}\n\n" +
+				"data: {\"id\":\"chat-1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"\"},\"finish_reason\":\"stop\"}],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":2,\"total_tokens\":5}}\n\n" +
+				"data: [DONE]\n\n")),
+		}
+		usage, err := (&Adaptor{}).DoResponse(c, resp, &meta.Meta{IsStream: true, PromptTokens: 1, ActualModelName: "jamba-1.5-mini"})
+		So(err, ShouldBeNil)
+		So(usage.TotalTokens, ShouldEqual, 5)
+		body := w.Body.String()
+		So(body, ShouldContainSubstring, `"object":"chat.completion.chunk"`)
+		So(body, ShouldContainSubstring, `"model":"jamba-1.5-mini"`)
+		So(body, ShouldContainSubstring, `"finish_reason":"stop"`)
+		So(strings.HasSuffix(strings.TrimSpace(body), "data: [DONE]"), ShouldBeTrue)
+	})
+}
+
+func TestConvertRequest(t *testing.T) {
+	Convey("ConvertRequest", t, func() {
+		Convey("maps the messages and the stop sequences", func() {
+			request := ConvertRequest(model.GeneralOpenAIRequest{
+				Model: "jamba-1.5-large",
+				Stop:  "###",
+				Messages: []model.Message{
+					{Role: "system", Content: "be brief"},
+					{Role: "developer", Content: "hi"},
+				},
+			})
+			So(request.Messages, ShouldResemble, []Message{{Role: "system", Content: "be brief"}, {Role: "user", Content: "hi"}})
+			So(request.Stop, ShouldResemble, []string{"###"})
+		})
+
+		Convey("sends the prompt of completions as a user message", func() {
+			request := ConvertRequest(model.GeneralOpenAIRequest{Model: "jamba-1.5-mini", Prompt: "hello"})
+			So(request.Messages, ShouldResemble, []Message{{Role: "user", Content: "hello"}})
+		})
+	})
+}
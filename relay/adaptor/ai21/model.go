@@ -0,0 +1,51 @@
+package ai21
+
+import "github.com/songquanpeng/one-api/relay/model"
+
+type Message struct {
+	Role       string       `json:"role"`
+	Content    string       `json:"content"`
+	ToolCalls  []model.Tool `json:"tool_calls,omitempty"`
+	ToolCallId string       `json:"tool_call_id,omitempty"`
+}
+
+type ResponseFormat struct {
+	Type string `json:"type"`
+}
+
+type Request struct {
+	Model          string          `json:"model"`
+	Messages       []Message       `json:"messages"`
+	Tools          []model.Tool    `json:"tools,omitempty"`
+	N              int             `json:"n,omitempty"`
+	MaxTokens      int             `json:"max_tokens,omitempty"`
+	Temperature    float64         `json:"temperature,omitempty"`
+	TopP           float64         `json:"top_p,omitempty"`
+	Stop           []string        `json:"stop,omitempty"`
+	Stream         bool            `json:"stream,omitempty"`
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+}
+
+type ResponseChoice struct {
+	Index        int     `json:"index"`
+	Message      Message `json:"message"`
+	FinishReason string  `json:"finish_reason"`
+}
+
+type Response struct {
+	Id      string           `json:"id"`
+	Choices []ResponseChoice `json:"choices"`
+	Usage   *model.Usage     `json:"usage"`
+}
+
+type StreamResponseChoice struct {
+	Index        int           `json:"index"`
+	Delta        model.Message `json:"delta"`
+	FinishReason *string       `json:"finish_reason"`
+}
+
+type StreamResponse struct {
+	Id      string                 `json:"id"`
+	Choices []StreamResponseChoice `json:"choices"`
+	Usage   *model.Usage           `json:"usage"`
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
 	"github.com/songquanpeng/one-api/relay/relaymode"
@@ -62,11 +63,15 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.G
 		aliEmbeddingRequest := ConvertEmbeddingRequest(*request)
 		return aliEmbeddingRequest, nil
 	default:
-		aliRequest := ConvertRequest(*request)
-		return aliRequest, nil
+		return a.BuildRequest(request)
 	}
 }
 
+// BuildRequest implements adaptor.ProviderAdapter.
+func (a *Adaptor) BuildRequest(request *model.GeneralOpenAIRequest) (any, error) {
+	return ConvertRequest(*request), nil
+}
+
 func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error) {
 	if request == nil {
 		return nil, errors.New("request is nil")
@@ -81,17 +86,13 @@ func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Read
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
-	if meta.IsStream {
-		err, usage = StreamHandler(c, resp)
-	} else {
-		switch meta.Mode {
-		case relaymode.Embeddings:
-			err, usage = EmbeddingHandler(c, resp)
-		case relaymode.ImagesGenerations:
-			err, usage = ImageHandler(c, resp)
-		default:
-			err, usage = Handler(c, resp)
-		}
+	switch meta.Mode {
+	case relaymode.Embeddings:
+		err, usage = EmbeddingHandler(c, resp, meta.ActualModelName)
+	case relaymode.ImagesGenerations:
+		err, usage = ImageHandler(c, resp)
+	default:
+		return openai.DoProviderResponse(a, c, resp, meta)
 	}
 	return
 }
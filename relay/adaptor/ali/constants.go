@@ -2,6 +2,6 @@ package ali
 
 var ModelList = []string{
 	"qwen-turbo", "qwen-plus", "qwen-max", "qwen-max-longcontext",
-	"text-embedding-v1",
+	"text-embedding-v1", "text-embedding-v2", "text-embedding-v3",
 	"ali-stable-diffusion-xl", "ali-stable-diffusion-v1.5", "wanx-v1",
 }
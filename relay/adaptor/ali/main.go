@@ -1,18 +1,15 @@
 package ali
 
 import (
-	"bufio"
 	"encoding/json"
-	"github.com/songquanpeng/one-api/common/render"
-	"io"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/helper"
-	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/adaptor"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
 )
 
@@ -51,6 +48,8 @@ func ConvertRequest(request model.GeneralOpenAIRequest) *ChatRequest {
 			Temperature:       request.Temperature,
 			TopP:              request.TopP,
 			TopK:              request.TopK,
+			PresencePenalty:   request.PresencePenalty,
+			Stop:              request.ParseStop(),
 			ResultFormat:      "message",
 			Tools:             request.Tools,
 		},
@@ -59,7 +58,7 @@ func ConvertRequest(request model.GeneralOpenAIRequest) *ChatRequest {
 
 func ConvertEmbeddingRequest(request model.GeneralOpenAIRequest) *EmbeddingRequest {
 	return &EmbeddingRequest{
-		Model: "text-embedding-v1",
+		Model: request.Model,
 		Input: struct {
 			Texts []string `json:"texts"`
 		}{
@@ -79,7 +78,7 @@ func ConvertImageRequest(request model.ImageRequest) *ImageRequest {
 	return &imageRequest
 }
 
-func EmbeddingHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.Usage) {
+func EmbeddingHandler(c *gin.Context, resp *http.Response, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
 	var aliResponse EmbeddingResponse
 	err := json.NewDecoder(resp.Body).Decode(&aliResponse)
 	if err != nil {
@@ -92,18 +91,10 @@ func EmbeddingHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStat
 	}
 
 	if aliResponse.Code != "" {
-		return &model.ErrorWithStatusCode{
-			Error: model.Error{
-				Message: aliResponse.Message,
-				Type:    aliResponse.Code,
-				Param:   aliResponse.RequestId,
-				Code:    aliResponse.Code,
-			},
-			StatusCode: resp.StatusCode,
-		}, nil
+		return errorWrapper(aliResponse.Error, resp.StatusCode), nil
 	}
 
-	fullTextResponse := embeddingResponseAli2OpenAI(&aliResponse)
+	fullTextResponse := embeddingResponseAli2OpenAI(&aliResponse, modelName)
 	jsonResponse, err := json.Marshal(fullTextResponse)
 	if err != nil {
 		return openai.ErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
@@ -114,11 +105,11 @@ func EmbeddingHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStat
 	return nil, &fullTextResponse.Usage
 }
 
-func embeddingResponseAli2OpenAI(response *EmbeddingResponse) *openai.EmbeddingResponse {
+func embeddingResponseAli2OpenAI(response *EmbeddingResponse, modelName string) *openai.EmbeddingResponse {
 	openAIEmbeddingResponse := openai.EmbeddingResponse{
 		Object: "list",
 		Data:   make([]openai.EmbeddingResponseItem, 0, len(response.Output.Embeddings)),
-		Model:  "text-embedding-v1",
+		Model:  modelName,
 		Usage:  model.Usage{TotalTokens: response.Usage.TotalTokens},
 	}
 
@@ -132,9 +123,10 @@ func embeddingResponseAli2OpenAI(response *EmbeddingResponse) *openai.EmbeddingR
 	return &openAIEmbeddingResponse
 }
 
-func responseAli2OpenAI(response *ChatResponse) *openai.TextResponse {
+func responseAli2OpenAI(response *ChatResponse, modelName string) *openai.TextResponse {
 	fullTextResponse := openai.TextResponse{
 		Id:      response.RequestId,
+		Model:   modelName,
 		Object:  "chat.completion",
 		Created: helper.GetTimestamp(),
 		Choices: response.Output.Choices,
@@ -147,14 +139,15 @@ func responseAli2OpenAI(response *ChatResponse) *openai.TextResponse {
 	return &fullTextResponse
 }
 
-func streamResponseAli2OpenAI(aliResponse *ChatResponse) *openai.ChatCompletionsStreamResponse {
+func streamResponseAli2OpenAI(aliResponse *ChatResponse, modelName string) *openai.ChatCompletionsStreamResponse {
 	if len(aliResponse.Output.Choices) == 0 {
 		return nil
 	}
 	aliChoice := aliResponse.Output.Choices[0]
 	var choice openai.ChatCompletionsStreamResponseChoice
 	choice.Delta = aliChoice.Message
-	if aliChoice.FinishReason != "null" {
+	// the finish reason of the chunks before the last one is the string "null"
+	if aliChoice.FinishReason != "null" && aliChoice.FinishReason != "" {
 		finishReason := aliChoice.FinishReason
 		choice.FinishReason = &finishReason
 	}
@@ -162,106 +155,63 @@ func streamResponseAli2OpenAI(aliResponse *ChatResponse) *openai.ChatCompletions
 		Id:      aliResponse.RequestId,
 		Object:  "chat.completion.chunk",
 		Created: helper.GetTimestamp(),
-		Model:   "qwen",
+		Model:   modelName,
 		Choices: []openai.ChatCompletionsStreamResponseChoice{choice},
 	}
 	return &response
 }
 
-func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.Usage) {
-	var usage model.Usage
-	scanner := bufio.NewScanner(resp.Body)
-	scanner.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
-		if atEOF && len(data) == 0 {
-			return 0, nil, nil
-		}
-		if i := strings.Index(string(data), "\n"); i >= 0 {
-			return i + 1, data[0:i], nil
-		}
-		if atEOF {
-			return len(data), data, nil
-		}
-		return 0, nil, nil
-	})
-
-	common.SetEventStreamHeaders(c)
-
-	for scanner.Scan() {
-		data := scanner.Text()
-		if len(data) < 5 || data[:5] != "data:" {
-			continue
-		}
-		data = data[5:]
-
-		var aliResponse ChatResponse
-		err := json.Unmarshal([]byte(data), &aliResponse)
-		if err != nil {
-			logger.SysError("error unmarshalling stream response: " + err.Error())
-			continue
-		}
-		if aliResponse.Usage.OutputTokens != 0 {
-			usage.PromptTokens = aliResponse.Usage.InputTokens
-			usage.CompletionTokens = aliResponse.Usage.OutputTokens
-			usage.TotalTokens = aliResponse.Usage.InputTokens + aliResponse.Usage.OutputTokens
-		}
-		response := streamResponseAli2OpenAI(&aliResponse)
-		if response == nil {
-			continue
-		}
-		err = render.ObjectData(c, response)
-		if err != nil {
-			logger.SysError(err.Error())
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		logger.SysError("error reading stream: " + err.Error())
-	}
-
-	render.Done(c)
-
-	err := resp.Body.Close()
-	if err != nil {
-		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+func errorWrapper(aliError Error, statusCode int) *model.ErrorWithStatusCode {
+	return &model.ErrorWithStatusCode{
+		Error: model.Error{
+			Message: aliError.Message,
+			Type:    aliError.Code,
+			Param:   aliError.RequestId,
+			Code:    aliError.Code,
+		},
+		StatusCode: statusCode,
 	}
-	return nil, &usage
 }
 
-func Handler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.Usage) {
-	ctx := c.Request.Context()
+// ParseResponse implements adaptor.ProviderAdapter.
+func (a *Adaptor) ParseResponse(meta *meta.Meta, body []byte) (*openai.TextResponse, *model.ErrorWithStatusCode) {
 	var aliResponse ChatResponse
-	responseBody, err := io.ReadAll(resp.Body)
+	err := json.Unmarshal(body, &aliResponse)
 	if err != nil {
-		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+		return nil, openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
 	}
-	err = resp.Body.Close()
-	if err != nil {
-		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	if aliResponse.Code != "" {
+		return nil, errorWrapper(aliResponse.Error, http.StatusInternalServerError)
 	}
-	logger.Debugf(ctx, "response body: %s\n", responseBody)
-	err = json.Unmarshal(responseBody, &aliResponse)
+	return responseAli2OpenAI(&aliResponse, meta.ActualModelName), nil
+}
+
+// ParseStreamChunk implements adaptor.ProviderAdapter, it turns the events of DashScope into chunks of OpenAI. With
+// incremental_output, each event only carries the new part of the answer.
+func (a *Adaptor) ParseStreamChunk(meta *meta.Meta, data string) (*openai.ChatCompletionsStreamResponse, error) {
+	var aliResponse ChatResponse
+	err := json.Unmarshal([]byte(data), &aliResponse)
 	if err != nil {
-		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+		return nil, err
 	}
 	if aliResponse.Code != "" {
-		return &model.ErrorWithStatusCode{
-			Error: model.Error{
-				Message: aliResponse.Message,
-				Type:    aliResponse.Code,
-				Param:   aliResponse.RequestId,
-				Code:    aliResponse.Code,
-			},
-			StatusCode: resp.StatusCode,
-		}, nil
+		// an event:error, e.g. the content is blocked or the quota of the account runs out
+		return nil, &adaptor.StreamError{Err: errorWrapper(aliResponse.Error, http.StatusBadRequest)}
 	}
-	fullTextResponse := responseAli2OpenAI(&aliResponse)
-	fullTextResponse.Model = "qwen"
-	jsonResponse, err := json.Marshal(fullTextResponse)
-	if err != nil {
-		return openai.ErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	return streamResponseAli2OpenAI(&aliResponse, meta.ActualModelName), nil
+}
+
+// ExtractUsage implements adaptor.ProviderAdapter, the usage of the whole request comes with every event of a stream
+// and is taken from the last one.
+func (a *Adaptor) ExtractUsage(data []byte) *model.Usage {
+	var aliResponse ChatResponse
+	_ = json.Unmarshal(data, &aliResponse)
+	if aliResponse.Usage.OutputTokens == 0 {
+		return nil
+	}
+	return &model.Usage{
+		PromptTokens:     aliResponse.Usage.InputTokens,
+		CompletionTokens: aliResponse.Usage.OutputTokens,
+		TotalTokens:      aliResponse.Usage.InputTokens + aliResponse.Usage.OutputTokens,
 	}
-	c.Writer.Header().Set("Content-Type", "application/json")
-	c.Writer.WriteHeader(resp.StatusCode)
-	_, err = c.Writer.Write(jsonResponse)
-	return nil, &fullTextResponse.Usage
 }
@@ -0,0 +1,113 @@
+package ali
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+func TestConvertRequest(t *testing.T) {
+	Convey("ConvertRequest", t, func() {
+		request := ConvertRequest(model.GeneralOpenAIRequest{
+			Model:           "qwen-max-internet",
+			Stream:          true,
+			PresencePenalty: 0.5,
+			Stop:            "\n\n",
+			Messages:        []model.Message{{Role: "User", Content: "hi"}},
+		})
+		So(request.Model, ShouldEqual, "qwen-max")
+		So(request.Input.Messages, ShouldResemble, []Message{{Role: "user", Content: "hi"}})
+		So(request.Parameters.EnableSearch, ShouldBeTrue)
+		So(request.Parameters.IncrementalOutput, ShouldBeTrue)
+		So(request.Parameters.PresencePenalty, ShouldEqual, 0.5)
+		So(request.Parameters.Stop, ShouldResemble, []string{"\n\n"})
+	})
+}
+
+func TestDoResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("DoResponse", t, func() {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		streamMeta := &meta.Meta{IsStream: true, PromptTokens: 1, ActualModelName: "qwen-max"}
+
+		Convey("relays the stream with the usage of the last event", func() {
+			resp := &http.Response{
+				StatusCode: http.StatusOK,
+				Body: io.NopCloser(strings.NewReader("id:1\nevent:result\n:HTTP_STATUS/200\n" +
+					"data:{\"output\":{\"choices\":[{\"message\":{\"role\":\"assistant\",\"content\":\"Hel\"},\"finish_reason\":\"null\"}]},\"usage\":{\"input_tokens\":3,\"output_tokens\":1},\"request_id\":\"r-1\"}\n\n" +
+					"id:2\nevent:result\n:HTTP_STATUS/200\n" +
+					"data:{\"output\":{\"choices\":[{\"message\":{\"role\":\"assistant\",\"content\":\"lo\"},\"finish_reason\":\"stop\"}]},\"usage\":{\"input_tokens\":3,\"output_tokens\":2},\"request_id\":\"r-1\"}\n\n")),
+			}
+			usage, err := (&Adaptor{}).DoResponse(c, resp, streamMeta)
+			So(err, ShouldBeNil)
+			So(*usage, ShouldResemble, model.Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5})
+			body := w.Body.String()
+			So(strings.Count(body, `"model":"qwen-max"`), ShouldEqual, 2)
+			So(strings.Count(body, `"finish_reason":"stop"`), ShouldEqual, 1)
+			So(strings.HasSuffix(strings.TrimSpace(body), "data: [DONE]"), ShouldBeTrue)
+		})
+
+		Convey("counts the tokens of the answer without the usage", func() {
+			config.ApproximateTokenEnabled = true
+			defer func() { config.ApproximateTokenEnabled = false }()
+			resp := &http.Response{
+				StatusCode: http.StatusOK,
+				Body: io.NopCloser(strings.NewReader(
+					"data:{\"output\":{\"choices\":[{\"message\":{\"role\":\"assistant\",\"content\":\"Hello there\"},\"finish_reason\":\"stop\"}]},\"request_id\":\"r-1\"}\n\n")),
+			}
+			usage, err := (&Adaptor{}).DoResponse(c, resp, streamMeta)
+			So(err, ShouldBeNil)
+			So(usage.PromptTokens, ShouldEqual, 1)
+			So(usage.CompletionTokens, ShouldBeGreaterThan, 0)
+		})
+
+		Convey("relays the error event sent before the answer as the error of the request", func() {
+			resp := &http.Response{
+				StatusCode: http.StatusOK,
+				Body: io.NopCloser(strings.NewReader("id:1\nevent:error\n:HTTP_STATUS/400\n" +
+					"data:{\"code\":\"DataInspectionFailed\",\"message\":\"Input data may contain inappropriate content.\",\"request_id\":\"r-1\"}\n\n")),
+			}
+			_, err := (&Adaptor{}).DoResponse(c, resp, streamMeta)
+			So(err, ShouldNotBeNil)
+			So(err.StatusCode, ShouldEqual, http.StatusBadRequest)
+			So(err.Code, ShouldEqual, "DataInspectionFailed")
+			So(err.Message, ShouldEqual, "Input data may contain inappropriate content.")
+			So(w.Body.Len(), ShouldEqual, 0)
+		})
+
+		Convey("names the model of the request in the response", func() {
+			resp := &http.Response{
+				StatusCode: http.StatusOK,
+				Body: io.NopCloser(strings.NewReader(
+					`{"output":{"choices":[{"message":{"role":"assistant","content":"Hello"},"finish_reason":"stop"}]},"usage":{"input_tokens":3,"output_tokens":1},"request_id":"r-1"}`)),
+			}
+			usage, err := (&Adaptor{}).DoResponse(c, resp, &meta.Meta{PromptTokens: 1, ActualModelName: "qwen-max"})
+			So(err, ShouldBeNil)
+			So(*usage, ShouldResemble, model.Usage{PromptTokens: 3, CompletionTokens: 1, TotalTokens: 4})
+			So(w.Body.String(), ShouldContainSubstring, `"model":"qwen-max"`)
+		})
+
+		Convey("names the model of the request in the embeddings", func() {
+			resp := &http.Response{
+				StatusCode: http.StatusOK,
+				Body: io.NopCloser(strings.NewReader(
+					`{"output":{"embeddings":[{"text_index":0,"embedding":[0.1,0.2]}]},"usage":{"total_tokens":2},"request_id":"r-1"}`)),
+			}
+			usage, err := (&Adaptor{}).DoResponse(c, resp, &meta.Meta{Mode: relaymode.Embeddings, ActualModelName: "text-embedding-v3"})
+			So(err, ShouldBeNil)
+			So(usage.TotalTokens, ShouldEqual, 2)
+			So(w.Body.String(), ShouldContainSubstring, `"model":"text-embedding-v3"`)
+		})
+	})
+}
@@ -23,6 +23,8 @@ type Parameters struct {
 	IncrementalOutput bool         `json:"incremental_output,omitempty"`
 	MaxTokens         int          `json:"max_tokens,omitempty"`
 	Temperature       float64      `json:"temperature,omitempty"`
+	PresencePenalty   float64      `json:"presence_penalty,omitempty"`
+	Stop              []string     `json:"stop,omitempty"`
 	ResultFormat      string       `json:"result_format,omitempty"`
 	Tools             []model.Tool `json:"tools,omitempty"`
 }
@@ -30,7 +30,11 @@ func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *me
 		anthropicVersion = "2023-06-01"
 	}
 	req.Header.Set("anthropic-version", anthropicVersion)
-	req.Header.Set("anthropic-beta", "messages-2023-12-15")
+	anthropicBeta := c.Request.Header.Get("anthropic-beta")
+	if anthropicBeta == "" {
+		anthropicBeta = "messages-2023-12-15"
+	}
+	req.Header.Set("anthropic-beta", anthropicBeta)
 	return nil
 }
 
@@ -36,7 +36,42 @@ func stopReasonClaude2OpenAI(reason *string) string {
 	}
 }
 
+// convertLegacyFunctions turns the legacy functions and function_call into tools and tool_choice,
+// which Claude has the counterparts of
+func convertLegacyFunctions(textRequest *model.GeneralOpenAIRequest) {
+	if len(textRequest.Tools) != 0 || textRequest.Functions == nil {
+		return
+	}
+	jsonFunctions, err := json.Marshal(textRequest.Functions)
+	if err != nil {
+		return
+	}
+	var functions []model.Function
+	if json.Unmarshal(jsonFunctions, &functions) != nil {
+		return
+	}
+	for _, function := range functions {
+		textRequest.Tools = append(textRequest.Tools, model.Tool{
+			Type:     "function",
+			Function: function,
+		})
+	}
+	if textRequest.ToolChoice != nil {
+		return
+	}
+	switch functionCall := textRequest.FunctionCall.(type) {
+	case string:
+		textRequest.ToolChoice = functionCall
+	case map[string]any:
+		textRequest.ToolChoice = map[string]any{
+			"type":     "function",
+			"function": functionCall,
+		}
+	}
+}
+
 func ConvertRequest(textRequest model.GeneralOpenAIRequest) *Request {
+	convertLegacyFunctions(&textRequest)
 	claudeTools := make([]Tool, 0, len(textRequest.Tools))
 
 	for _, tool := range textRequest.Tools {
@@ -75,6 +110,9 @@ func ConvertRequest(textRequest model.GeneralOpenAIRequest) *Request {
 		} else if toolChoiceType, ok := textRequest.ToolChoice.(string); ok {
 			if toolChoiceType == "any" {
 				claudeToolChoice.Type = toolChoiceType
+			} else if toolChoiceType == "required" {
+				// the same as any of Claude
+				claudeToolChoice.Type = "any"
 			}
 		}
 		claudeRequest.ToolChoice = claudeToolChoice
@@ -0,0 +1,51 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestConvertRequestTools(t *testing.T) {
+	Convey("ConvertRequest", t, func() {
+		convert := func(body string) (*Request, string) {
+			var textRequest model.GeneralOpenAIRequest
+			So(json.Unmarshal([]byte(body), &textRequest), ShouldBeNil)
+			claudeRequest := ConvertRequest(textRequest)
+			toolChoice, _ := json.Marshal(claudeRequest.ToolChoice)
+			return claudeRequest, string(toolChoice)
+		}
+
+		Convey("the legacy functions are converted into tools", func() {
+			claudeRequest, toolChoice := convert(`{"model":"claude-3-haiku-20240307","messages":[{"role":"user","content":"hi"}],
+				"functions":[{"name":"get_weather","description":"the weather","parameters":{"type":"object","properties":{"city":{"type":"string"}},"required":["city"]}}],
+				"function_call":{"name":"get_weather"}}`)
+			So(claudeRequest.Tools, ShouldHaveLength, 1)
+			So(claudeRequest.Tools[0].Name, ShouldEqual, "get_weather")
+			So(claudeRequest.Tools[0].Description, ShouldEqual, "the weather")
+			So(claudeRequest.Tools[0].InputSchema.Type, ShouldEqual, "object")
+			So(toolChoice, ShouldEqual, `{"type":"tool","name":"get_weather"}`)
+
+			_, toolChoice = convert(`{"model":"claude-3-haiku-20240307","messages":[{"role":"user","content":"hi"}],
+				"functions":[{"name":"get_weather","parameters":{"type":"object","properties":{}}}]}`)
+			So(toolChoice, ShouldEqual, `{"type":"auto"}`)
+		})
+
+		Convey("the tools are preferred over the legacy functions", func() {
+			claudeRequest, _ := convert(`{"model":"claude-3-haiku-20240307","messages":[{"role":"user","content":"hi"}],
+				"tools":[{"type":"function","function":{"name":"get_time","parameters":{"type":"object","properties":{}}}}],
+				"functions":[{"name":"get_weather","parameters":{"type":"object","properties":{}}}]}`)
+			So(claudeRequest.Tools, ShouldHaveLength, 1)
+			So(claudeRequest.Tools[0].Name, ShouldEqual, "get_time")
+		})
+
+		Convey("a required tool choice is any of Claude", func() {
+			_, toolChoice := convert(`{"model":"claude-3-haiku-20240307","messages":[{"role":"user","content":"hi"}],
+				"tools":[{"type":"function","function":{"name":"get_time","parameters":{"type":"object","properties":{}}}}],
+				"tool_choice":"required"}`)
+			So(toolChoice, ShouldEqual, `{"type":"any"}`)
+		})
+	})
+}
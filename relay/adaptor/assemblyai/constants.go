@@ -0,0 +1,17 @@
+package assemblyai
+
+import "time"
+
+// https://www.assemblyai.com/docs/speech-to-text/pre-recorded-audio/select-the-speech-model
+var ModelList = []string{
+	"universal",
+	"slam-1",
+}
+
+const (
+	StatusCompleted = "completed"
+	StatusError     = "error"
+)
+
+// the transcription is asynchronous, it's polled until it's completed
+var pollInterval = 3 * time.Second
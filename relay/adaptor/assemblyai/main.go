@@ -0,0 +1,126 @@
+package assemblyai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func ConvertTranscriptionRequest(request *openai.TranscriptionRequest, uploadUrl string) *TranscriptRequest {
+	transcriptRequest := &TranscriptRequest{
+		AudioUrl:     uploadUrl,
+		SpeechModel:  request.Model,
+		LanguageCode: request.Language,
+	}
+	if request.Language == "" {
+		transcriptRequest.LanguageDetection = true
+	}
+	return transcriptRequest
+}
+
+// ResponseTranscript2OpenAI converts a completed transcript, the sentences are the segments
+func ResponseTranscript2OpenAI(transcript *Transcript, sentences []Sentence) *openai.WhisperVerboseJSONResponse {
+	transcription := &openai.WhisperVerboseJSONResponse{
+		Task:     "transcribe",
+		Language: transcript.LanguageCode,
+		Duration: transcript.AudioDuration,
+		Text:     transcript.Text,
+	}
+	for i, sentence := range sentences {
+		transcription.Segments = append(transcription.Segments, openai.Segment{
+			Id:    i,
+			Start: float64(sentence.Start) / 1000,
+			End:   float64(sentence.End) / 1000,
+			Text:  sentence.Text,
+		})
+	}
+	return transcription
+}
+
+func errorHandler(resp *http.Response) *model.ErrorWithStatusCode {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	var errorResponse ErrorResponse
+	_ = json.Unmarshal(responseBody, &errorResponse)
+	message := errorResponse.Error
+	if message == "" {
+		message = fmt.Sprintf("bad response status code %d", resp.StatusCode)
+	}
+	return openai.ErrorWrapper(errors.New(message), "assemblyai_error", resp.StatusCode)
+}
+
+func doRequest(ctx context.Context, method string, url string, key string, contentType string, body []byte, response any) *model.ErrorWithStatusCode {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return openai.ErrorWrapper(err, "new_request_failed", http.StatusInternalServerError)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Authorization", key)
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errorHandler(resp)
+	}
+	err = json.NewDecoder(resp.Body).Decode(response)
+	if err != nil {
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+	}
+	return nil
+}
+
+// Transcribe uploads the audio, submits the transcript and polls it until it's completed,
+// the sentences are only fetched if the segments are needed
+func Transcribe(ctx context.Context, baseURL string, key string, request *openai.TranscriptionRequest, withSegments bool) (*openai.WhisperVerboseJSONResponse, *model.ErrorWithStatusCode) {
+	var uploadResponse UploadResponse
+	bizErr := doRequest(ctx, http.MethodPost, baseURL+"/v2/upload", key, "application/octet-stream", request.File, &uploadResponse)
+	if bizErr != nil {
+		return nil, bizErr
+	}
+	jsonStr, err := json.Marshal(ConvertTranscriptionRequest(request, uploadResponse.UploadUrl))
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "marshal_transcript_request_failed", http.StatusInternalServerError)
+	}
+	var transcript Transcript
+	bizErr = doRequest(ctx, http.MethodPost, baseURL+"/v2/transcript", key, "application/json", jsonStr, &transcript)
+	if bizErr != nil {
+		return nil, bizErr
+	}
+	for transcript.Status != StatusCompleted {
+		if transcript.Status == StatusError {
+			return nil, openai.ErrorWrapper(errors.New(transcript.Error), "assemblyai_error", http.StatusBadRequest)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, openai.ErrorWrapper(ctx.Err(), "transcript_timeout", http.StatusGatewayTimeout)
+		case <-time.After(pollInterval):
+		}
+		bizErr = doRequest(ctx, http.MethodGet, baseURL+"/v2/transcript/"+transcript.Id, key, "", nil, &transcript)
+		if bizErr != nil {
+			return nil, bizErr
+		}
+	}
+	var sentences SentencesResponse
+	if withSegments {
+		bizErr = doRequest(ctx, http.MethodGet, baseURL+"/v2/transcript/"+transcript.Id+"/sentences", key, "", nil, &sentences)
+		if bizErr != nil {
+			return nil, bizErr
+		}
+	}
+	return ResponseTranscript2OpenAI(&transcript, sentences.Sentences), nil
+}
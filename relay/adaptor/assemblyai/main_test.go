@@ -0,0 +1,83 @@
+package assemblyai
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+)
+
+func TestConvertTranscriptionRequest(t *testing.T) {
+	Convey("ConvertTranscriptionRequest", t, func() {
+		request := ConvertTranscriptionRequest(&openai.TranscriptionRequest{Model: "universal", Language: "en"}, "https://cdn/audio")
+		So(request.AudioUrl, ShouldEqual, "https://cdn/audio")
+		So(request.SpeechModel, ShouldEqual, "universal")
+		So(request.LanguageCode, ShouldEqual, "en")
+		So(request.LanguageDetection, ShouldBeFalse)
+
+		request = ConvertTranscriptionRequest(&openai.TranscriptionRequest{Model: "slam-1"}, "https://cdn/audio")
+		So(request.LanguageDetection, ShouldBeTrue)
+	})
+}
+
+func TestTranscribe(t *testing.T) {
+	client.Init()
+	pollInterval = time.Millisecond
+	Convey("Transcribe", t, func() {
+		polls := 0
+		var uploaded string
+		var submitted TranscriptRequest
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "key" {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = w.Write([]byte(`{"error": "Invalid API key"}`))
+				return
+			}
+			switch r.URL.Path {
+			case "/v2/upload":
+				body, _ := io.ReadAll(r.Body)
+				uploaded = string(body)
+				_, _ = w.Write([]byte(`{"upload_url": "https://cdn/audio"}`))
+			case "/v2/transcript":
+				_ = json.NewDecoder(r.Body).Decode(&submitted)
+				_, _ = w.Write([]byte(`{"id": "t1", "status": "queued"}`))
+			case "/v2/transcript/t1":
+				polls++
+				if polls < 2 {
+					_, _ = w.Write([]byte(`{"id": "t1", "status": "processing"}`))
+					return
+				}
+				_, _ = w.Write([]byte(`{"id": "t1", "status": "completed", "text": "Hello there.", "language_code": "en", "audio_duration": 2}`))
+			case "/v2/transcript/t1/sentences":
+				_, _ = w.Write([]byte(`{"sentences": [{"text": "Hello there.", "start": 100, "end": 1200}]}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+
+		request := &openai.TranscriptionRequest{Model: "universal", File: []byte("audio")}
+		transcription, bizErr := Transcribe(t.Context(), server.URL, "key", request, true)
+		So(bizErr, ShouldBeNil)
+		So(uploaded, ShouldEqual, "audio")
+		So(submitted.AudioUrl, ShouldEqual, "https://cdn/audio")
+		So(polls, ShouldEqual, 2)
+		So(transcription.Text, ShouldEqual, "Hello there.")
+		So(transcription.Duration, ShouldEqual, 2)
+		So(transcription.Segments, ShouldHaveLength, 1)
+		So(transcription.Segments[0].Start, ShouldEqual, 0.1)
+
+		Convey("returns the error of the upstream", func() {
+			_, bizErr := Transcribe(t.Context(), server.URL, "wrong", request, false)
+			So(bizErr, ShouldNotBeNil)
+			So(bizErr.StatusCode, ShouldEqual, http.StatusUnauthorized)
+			So(bizErr.Error.Message, ShouldEqual, "Invalid API key")
+		})
+	})
+}
@@ -0,0 +1,35 @@
+package assemblyai
+
+type UploadResponse struct {
+	UploadUrl string `json:"upload_url"`
+}
+
+type TranscriptRequest struct {
+	AudioUrl          string `json:"audio_url"`
+	SpeechModel       string `json:"speech_model,omitempty"`
+	LanguageCode      string `json:"language_code,omitempty"`
+	LanguageDetection bool   `json:"language_detection,omitempty"`
+}
+
+type Transcript struct {
+	Id            string  `json:"id"`
+	Status        string  `json:"status"`
+	Text          string  `json:"text"`
+	LanguageCode  string  `json:"language_code"`
+	AudioDuration float64 `json:"audio_duration"` // in seconds
+	Error         string  `json:"error,omitempty"`
+}
+
+type Sentence struct {
+	Text  string `json:"text"`
+	Start int64  `json:"start"` // in milliseconds
+	End   int64  `json:"end"`
+}
+
+type SentencesResponse struct {
+	Sentences []Sentence `json:"sentences"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
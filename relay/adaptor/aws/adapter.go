@@ -44,8 +44,13 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.G
 		return nil, errors.New("request is nil")
 	}
 
-	claudeReq := anthropic.ConvertRequest(*request)
 	c.Set(ctxkey.RequestModel, request.Model)
+	if isTitanModel(request.Model) {
+		titanReq := convertTitanRequest(*request)
+		c.Set(ctxkey.ConvertedRequest, titanReq)
+		return titanReq, nil
+	}
+	claudeReq := anthropic.ConvertRequest(*request)
 	c.Set(ctxkey.ConvertedRequest, claudeReq)
 	return claudeReq, nil
 }
@@ -62,6 +67,14 @@ func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Read
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	if isTitanModel(meta.ActualModelName) {
+		if meta.IsStream {
+			err, usage = TitanStreamHandler(c, a.awsClient)
+		} else {
+			err, usage = TitanHandler(c, a.awsClient, meta.ActualModelName)
+		}
+		return
+	}
 	if meta.IsStream {
 		err, usage = StreamHandler(c, a.awsClient)
 	} else {
@@ -41,6 +41,9 @@ var awsModelIDMap = map[string]string{
 	"claude-3-5-sonnet-20240620": "anthropic.claude-3-5-sonnet-20240620-v1:0",
 	"claude-3-opus-20240229":     "anthropic.claude-3-opus-20240229-v1:0",
 	"claude-3-haiku-20240307":    "anthropic.claude-3-haiku-20240307-v1:0",
+	"titan-text-express":         "amazon.titan-text-express-v1",
+	"titan-text-lite":            "amazon.titan-text-lite-v1",
+	"titan-text-premier":         "amazon.titan-text-premier-v1:0",
 }
 
 func awsModelID(requestModel string) (string, error) {
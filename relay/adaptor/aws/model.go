@@ -18,3 +18,36 @@ type Request struct {
 	Tools            []anthropic.Tool    `json:"tools,omitempty"`
 	ToolChoice       any                 `json:"tool_choice,omitempty"`
 }
+
+// TitanRequest is the request to AWS Titan text models
+//
+// https://docs.aws.amazon.com/bedrock/latest/userguide/model-parameters-titan-text.html
+type TitanRequest struct {
+	InputText            string                    `json:"inputText"`
+	TextGenerationConfig TitanTextGenerationConfig `json:"textGenerationConfig"`
+}
+
+type TitanTextGenerationConfig struct {
+	MaxTokenCount int     `json:"maxTokenCount,omitempty"`
+	Temperature   float64 `json:"temperature,omitempty"`
+	TopP          float64 `json:"topP,omitempty"`
+}
+
+type TitanResponse struct {
+	InputTextTokenCount int                   `json:"inputTextTokenCount"`
+	Results             []TitanResponseResult `json:"results"`
+}
+
+type TitanResponseResult struct {
+	TokenCount       int     `json:"tokenCount"`
+	OutputText       string  `json:"outputText"`
+	CompletionReason *string `json:"completionReason"`
+}
+
+type TitanStreamResponse struct {
+	OutputText                string  `json:"outputText"`
+	Index                     int     `json:"index"`
+	TotalOutputTextTokenCount int     `json:"totalOutputTextTokenCount"`
+	CompletionReason          *string `json:"completionReason"`
+	InputTextTokenCount       int     `json:"inputTextTokenCount"`
+}
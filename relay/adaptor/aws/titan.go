@@ -0,0 +1,212 @@
+package aws
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/constant"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+func isTitanModel(modelName string) bool {
+	return strings.HasPrefix(modelName, "titan-")
+}
+
+// Titan models only take a single prompt, the conversation is flattened with the role labels Titan is tuned on
+func convertTitanRequest(request relaymodel.GeneralOpenAIRequest) *TitanRequest {
+	var prompt strings.Builder
+	for _, message := range request.Messages {
+		content := message.StringContent()
+		switch message.Role {
+		case "system":
+			prompt.WriteString(content + "\n\n")
+		case "assistant":
+			prompt.WriteString("Bot: " + content + "\n")
+		default:
+			prompt.WriteString("User: " + content + "\n")
+		}
+	}
+	prompt.WriteString("Bot:")
+	titanRequest := &TitanRequest{
+		InputText: prompt.String(),
+		TextGenerationConfig: TitanTextGenerationConfig{
+			MaxTokenCount: request.MaxTokens,
+			Temperature:   request.Temperature,
+			TopP:          request.TopP,
+		},
+	}
+	return titanRequest
+}
+
+func completionReasonTitan2OpenAI(reason *string) string {
+	if reason == nil {
+		return ""
+	}
+	switch *reason {
+	case "FINISH":
+		return constant.StopFinishReason
+	case "LENGTH":
+		return "length"
+	case "CONTENT_FILTERED":
+		return "content_filter"
+	default:
+		return strings.ToLower(*reason)
+	}
+}
+
+func getTitanRequestBody(c *gin.Context) ([]byte, error) {
+	titanReq, ok := c.Get(ctxkey.ConvertedRequest)
+	if !ok {
+		return nil, errors.New("request not found")
+	}
+	return json.Marshal(titanReq.(*TitanRequest))
+}
+
+func TitanHandler(c *gin.Context, awsCli *bedrockruntime.Client, modelName string) (*relaymodel.ErrorWithStatusCode, *relaymodel.Usage) {
+	awsModelId, err := awsModelID(c.GetString(ctxkey.RequestModel))
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "awsModelID")), nil
+	}
+	awsReq := &bedrockruntime.InvokeModelInput{
+		ModelId:     aws.String(awsModelId),
+		Accept:      aws.String("application/json"),
+		ContentType: aws.String("application/json"),
+	}
+	awsReq.Body, err = getTitanRequestBody(c)
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "marshal request")), nil
+	}
+
+	awsResp, err := awsCli.InvokeModel(c.Request.Context(), awsReq)
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "InvokeModel")), nil
+	}
+	titanResponse := new(TitanResponse)
+	err = json.Unmarshal(awsResp.Body, titanResponse)
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "unmarshal response")), nil
+	}
+
+	usage := relaymodel.Usage{
+		PromptTokens: titanResponse.InputTextTokenCount,
+	}
+	openaiResp := openai.TextResponse{
+		Id:      fmt.Sprintf("chatcmpl-%s", random.GetUUID()),
+		Model:   modelName,
+		Object:  constant.NonStreamObject,
+		Created: helper.GetTimestamp(),
+	}
+	for i, result := range titanResponse.Results {
+		usage.CompletionTokens += result.TokenCount
+		openaiResp.Choices = append(openaiResp.Choices, openai.TextResponseChoice{
+			Index: i,
+			Message: relaymodel.Message{
+				Role:    "assistant",
+				Content: strings.TrimSpace(result.OutputText),
+			},
+			FinishReason: completionReasonTitan2OpenAI(result.CompletionReason),
+		})
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	openaiResp.Usage = usage
+
+	c.JSON(http.StatusOK, openaiResp)
+	return nil, &usage
+}
+
+func TitanStreamHandler(c *gin.Context, awsCli *bedrockruntime.Client) (*relaymodel.ErrorWithStatusCode, *relaymodel.Usage) {
+	createdTime := helper.GetTimestamp()
+	awsModelId, err := awsModelID(c.GetString(ctxkey.RequestModel))
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "awsModelID")), nil
+	}
+	awsReq := &bedrockruntime.InvokeModelWithResponseStreamInput{
+		ModelId:     aws.String(awsModelId),
+		Accept:      aws.String("application/json"),
+		ContentType: aws.String("application/json"),
+	}
+	awsReq.Body, err = getTitanRequestBody(c)
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "marshal request")), nil
+	}
+
+	awsResp, err := awsCli.InvokeModelWithResponseStream(c.Request.Context(), awsReq)
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "InvokeModelWithResponseStream")), nil
+	}
+	stream := awsResp.GetStream()
+	defer stream.Close()
+
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	var usage relaymodel.Usage
+	id := fmt.Sprintf("chatcmpl-%s", random.GetUUID())
+
+	c.Stream(func(w io.Writer) bool {
+		event, ok := <-stream.Events()
+		if !ok {
+			c.Render(-1, common.CustomEvent{Data: "data: [DONE]"})
+			return false
+		}
+
+		switch v := event.(type) {
+		case *types.ResponseStreamMemberChunk:
+			titanResp := new(TitanStreamResponse)
+			err := json.NewDecoder(bytes.NewReader(v.Value.Bytes)).Decode(titanResp)
+			if err != nil {
+				logger.SysError("error unmarshalling stream response: " + err.Error())
+				return false
+			}
+			if titanResp.InputTextTokenCount > 0 {
+				usage.PromptTokens = titanResp.InputTextTokenCount
+			}
+			// the count is cumulative
+			if titanResp.TotalOutputTextTokenCount > usage.CompletionTokens {
+				usage.CompletionTokens = titanResp.TotalOutputTextTokenCount
+			}
+			var choice openai.ChatCompletionsStreamResponseChoice
+			choice.Delta.Role = "assistant"
+			choice.Delta.Content = titanResp.OutputText
+			if finishReason := completionReasonTitan2OpenAI(titanResp.CompletionReason); finishReason != "" {
+				choice.FinishReason = &finishReason
+			}
+			response := openai.ChatCompletionsStreamResponse{
+				Id:      id,
+				Object:  constant.StreamObject,
+				Created: createdTime,
+				Model:   c.GetString(ctxkey.OriginalModel),
+				Choices: []openai.ChatCompletionsStreamResponseChoice{choice},
+			}
+			jsonStr, err := json.Marshal(response)
+			if err != nil {
+				logger.SysError("error marshalling stream response: " + err.Error())
+				return true
+			}
+			c.Render(-1, common.CustomEvent{Data: "data: " + string(jsonStr)})
+			return true
+		case *types.UnknownUnionMember:
+			logger.SysError("unknown tag: " + v.Tag)
+			return false
+		default:
+			logger.SysError("union is nil or unknown type")
+			return false
+		}
+	})
+
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return nil, &usage
+}
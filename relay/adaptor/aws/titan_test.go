@@ -0,0 +1,168 @@
+package aws
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func newTestClient(url string) *bedrockruntime.Client {
+	return bedrockruntime.New(bedrockruntime.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(url),
+		Credentials:  aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider("ak", "sk", "")),
+	})
+}
+
+// streamRecorder is a recorder c.Stream can write to
+type streamRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (r *streamRecorder) CloseNotify() <-chan bool {
+	return make(chan bool)
+}
+
+func newTitanContext(stream bool) (*gin.Context, *streamRecorder) {
+	w := &streamRecorder{httptest.NewRecorder()}
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	c.Set(ctxkey.OriginalModel, "titan-text-express")
+	_, _ = (&Adaptor{}).ConvertRequest(c, 0, &model.GeneralOpenAIRequest{
+		Model:    "titan-text-express",
+		Stream:   stream,
+		Messages: []model.Message{{Role: "user", Content: "Hi"}},
+	})
+	return c, w
+}
+
+func encodeChunk(payload string) []byte {
+	part, _ := json.Marshal(map[string][]byte{"bytes": []byte(payload)})
+	var buffer bytes.Buffer
+	_ = eventstream.NewEncoder().Encode(&buffer, eventstream.Message{
+		Headers: eventstream.Headers{
+			{Name: ":message-type", Value: eventstream.StringValue("event")},
+			{Name: ":event-type", Value: eventstream.StringValue("chunk")},
+			{Name: ":content-type", Value: eventstream.StringValue("application/json")},
+		},
+		Payload: part,
+	})
+	return buffer.Bytes()
+}
+
+func TestConvertTitanRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("convertTitanRequest", t, func() {
+		request := convertTitanRequest(model.GeneralOpenAIRequest{
+			Model:       "titan-text-express",
+			MaxTokens:   100,
+			Temperature: 0.5,
+			Messages: []model.Message{
+				{Role: "system", Content: "Be brief."},
+				{Role: "user", Content: "Hi"},
+				{Role: "assistant", Content: "Hello"},
+				{Role: "user", Content: "Bye"},
+			},
+		})
+		So(request.InputText, ShouldEqual, "Be brief.\n\nUser: Hi\nBot: Hello\nUser: Bye\nBot:")
+		So(request.TextGenerationConfig, ShouldResemble, TitanTextGenerationConfig{MaxTokenCount: 100, Temperature: 0.5})
+	})
+
+	Convey("ConvertRequest keeps the claude models", t, func() {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		converted, err := (&Adaptor{}).ConvertRequest(c, 0, &model.GeneralOpenAIRequest{
+			Model:    "claude-3-haiku-20240307",
+			Messages: []model.Message{{Role: "user", Content: "Hi"}},
+		})
+		So(err, ShouldBeNil)
+		_, ok := converted.(*TitanRequest)
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestCompletionReasonTitan2OpenAI(t *testing.T) {
+	Convey("completionReasonTitan2OpenAI", t, func() {
+		reasons := map[string]string{
+			"FINISH":                      "stop",
+			"LENGTH":                      "length",
+			"CONTENT_FILTERED":            "content_filter",
+			"RAG_QUERY_WHEN_RAG_DISABLED": "rag_query_when_rag_disabled",
+		}
+		for reason, expected := range reasons {
+			So(completionReasonTitan2OpenAI(aws.String(reason)), ShouldEqual, expected)
+		}
+		So(completionReasonTitan2OpenAI(nil), ShouldEqual, "")
+	})
+}
+
+func TestTitanHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("TitanHandler", t, func() {
+		var path string
+		var body TitanRequest
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"inputTextTokenCount":3,"results":[{"tokenCount":2,"outputText":" Hello","completionReason":"FINISH"}]}`))
+		}))
+		defer server.Close()
+
+		c, w := newTitanContext(false)
+		usage, err := (&Adaptor{awsClient: newTestClient(server.URL)}).DoResponse(c, nil, &meta.Meta{ActualModelName: "titan-text-express"})
+		So(err, ShouldBeNil)
+		So(*usage, ShouldResemble, model.Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5})
+		So(path, ShouldEqual, "/model/amazon.titan-text-express-v1/invoke")
+		So(body.InputText, ShouldEqual, "User: Hi\nBot:")
+
+		var response struct {
+			Choices []struct {
+				Message      model.Message `json:"message"`
+				FinishReason string        `json:"finish_reason"`
+			} `json:"choices"`
+		}
+		So(json.Unmarshal(w.Body.Bytes(), &response), ShouldBeNil)
+		So(response.Choices, ShouldHaveLength, 1)
+		So(response.Choices[0].Message.Content, ShouldEqual, "Hello")
+		So(response.Choices[0].FinishReason, ShouldEqual, "stop")
+	})
+}
+
+func TestTitanStreamHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("TitanStreamHandler", t, func() {
+		var path string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+			_, _ = w.Write(encodeChunk(`{"outputText":"Hel","index":0,"totalOutputTextTokenCount":1,"inputTextTokenCount":3}`))
+			_, _ = w.Write(encodeChunk(`{"outputText":"lo","index":0,"totalOutputTextTokenCount":2,"completionReason":"FINISH"}`))
+		}))
+		defer server.Close()
+
+		c, w := newTitanContext(true)
+		usage, err := (&Adaptor{awsClient: newTestClient(server.URL)}).DoResponse(c, nil, &meta.Meta{IsStream: true, ActualModelName: "titan-text-express"})
+		So(err, ShouldBeNil)
+		So(*usage, ShouldResemble, model.Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5})
+		So(path, ShouldEqual, "/model/amazon.titan-text-express-v1/invoke-with-response-stream")
+
+		body := w.Body.String()
+		So(body, ShouldContainSubstring, `"content":"Hel"`)
+		So(body, ShouldContainSubstring, `"content":"lo"`)
+		So(strings.Count(body, `"finish_reason":"stop"`), ShouldEqual, 1)
+		So(strings.HasSuffix(strings.TrimSpace(body), "data: [DONE]"), ShouldBeTrue)
+	})
+}
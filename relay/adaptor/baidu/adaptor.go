@@ -11,6 +11,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/relay/model"
 )
 
@@ -90,8 +91,8 @@ func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 }
 
 func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *meta.Meta) error {
+	// the access token is in the url, the api key and secret key must not be sent along
 	adaptor.SetupCommonRequestHeader(c, req, meta)
-	req.Header.Set("Authorization", "Bearer "+meta.APIKey)
 	return nil
 }
 
@@ -104,11 +105,15 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.G
 		baiduEmbeddingRequest := ConvertEmbeddingRequest(*request)
 		return baiduEmbeddingRequest, nil
 	default:
-		baiduRequest := ConvertRequest(*request)
-		return baiduRequest, nil
+		return a.BuildRequest(request)
 	}
 }
 
+// BuildRequest implements adaptor.ProviderAdapter.
+func (a *Adaptor) BuildRequest(request *model.GeneralOpenAIRequest) (any, error) {
+	return ConvertRequest(*request), nil
+}
+
 func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error) {
 	if request == nil {
 		return nil, errors.New("request is nil")
@@ -121,17 +126,11 @@ func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Read
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
-	if meta.IsStream {
-		err, usage = StreamHandler(c, resp)
-	} else {
-		switch meta.Mode {
-		case relaymode.Embeddings:
-			err, usage = EmbeddingHandler(c, resp)
-		default:
-			err, usage = Handler(c, resp)
-		}
+	if meta.Mode == relaymode.Embeddings {
+		err, usage = EmbeddingHandler(c, resp)
+		return
 	}
-	return
+	return openai.DoProviderResponse(a, c, resp, meta)
 }
 
 func (a *Adaptor) GetModelList() []string {
@@ -1,23 +1,21 @@
 package baidu
 
 import (
-	"bufio"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/songquanpeng/one-api/common/render"
 	"io"
 	"net/http"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/client"
-	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/credential"
+	"github.com/songquanpeng/one-api/relay/adaptor"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/relay/constant"
+	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
 )
 
@@ -40,6 +38,7 @@ type ChatRequest struct {
 	PenaltyScore    float64   `json:"penalty_score,omitempty"`
 	Stream          bool      `json:"stream,omitempty"`
 	System          string    `json:"system,omitempty"`
+	Stop            []string  `json:"stop,omitempty"`
 	DisableSearch   bool      `json:"disable_search,omitempty"`
 	EnableCitation  bool      `json:"enable_citation,omitempty"`
 	MaxOutputTokens int       `json:"max_output_tokens,omitempty"`
@@ -51,44 +50,78 @@ type Error struct {
 	ErrorMsg  string `json:"error_msg"`
 }
 
-var baiduTokenStore sync.Map
-
 func ConvertRequest(request model.GeneralOpenAIRequest) *ChatRequest {
+	system, messages := convertMessages(request.Messages)
 	baiduRequest := ChatRequest{
-		Messages:        make([]Message, 0, len(request.Messages)),
+		Messages:        messages,
 		Temperature:     request.Temperature,
 		TopP:            request.TopP,
 		PenaltyScore:    request.FrequencyPenalty,
 		Stream:          request.Stream,
+		System:          system,
+		Stop:            request.ParseStop(),
 		DisableSearch:   false,
 		EnableCitation:  false,
 		MaxOutputTokens: request.MaxTokens,
 		UserId:          request.User,
 	}
-	for _, message := range request.Messages {
+	return &baiduRequest
+}
+
+// convertMessages puts the system messages into the system field, ERNIE only accepts messages alternating between
+// user and assistant and starting with user, so messages of the same role in a row are merged into one
+func convertMessages(messages []model.Message) (string, []Message) {
+	var systems []string
+	baiduMessages := make([]Message, 0, len(messages))
+	for _, message := range messages {
+		content := message.StringContent()
 		if message.Role == "system" {
-			baiduRequest.System = message.StringContent()
-		} else {
-			baiduRequest.Messages = append(baiduRequest.Messages, Message{
-				Role:    message.Role,
-				Content: message.StringContent(),
-			})
+			systems = append(systems, content)
+			continue
 		}
+		role := "user"
+		if message.Role == "assistant" {
+			role = "assistant"
+		}
+		if len(baiduMessages) == 0 && role == "assistant" {
+			// there is no question to answer yet, ERNIE rejects the request otherwise
+			continue
+		}
+		if last := len(baiduMessages) - 1; last >= 0 && baiduMessages[last].Role == role {
+			baiduMessages[last].Content += "\n" + content
+			continue
+		}
+		baiduMessages = append(baiduMessages, Message{
+			Role:    role,
+			Content: content,
+		})
+	}
+	return strings.Join(systems, "\n"), baiduMessages
+}
+
+// https://cloud.baidu.com/doc/WENXINWORKSHOP/s/clntwmv7t
+func convertFinishReason(finishReason string) string {
+	switch finishReason {
+	case "length", "content_filter", "function_call":
+		return finishReason
+	default:
+		// normal and stop
+		return constant.StopFinishReason
 	}
-	return &baiduRequest
 }
 
-func responseBaidu2OpenAI(response *ChatResponse) *openai.TextResponse {
+func responseBaidu2OpenAI(response *ChatResponse, modelName string) *openai.TextResponse {
 	choice := openai.TextResponseChoice{
 		Index: 0,
 		Message: model.Message{
 			Role:    "assistant",
 			Content: response.Result,
 		},
-		FinishReason: "stop",
+		FinishReason: convertFinishReason(response.FinishReason),
 	}
 	fullTextResponse := openai.TextResponse{
 		Id:      response.Id,
+		Model:   modelName,
 		Object:  "chat.completion",
 		Created: response.Created,
 		Choices: []openai.TextResponseChoice{choice},
@@ -97,22 +130,35 @@ func responseBaidu2OpenAI(response *ChatResponse) *openai.TextResponse {
 	return &fullTextResponse
 }
 
-func streamResponseBaidu2OpenAI(baiduResponse *ChatStreamResponse) *openai.ChatCompletionsStreamResponse {
+func streamResponseBaidu2OpenAI(baiduResponse *ChatStreamResponse, modelName string) *openai.ChatCompletionsStreamResponse {
 	var choice openai.ChatCompletionsStreamResponseChoice
 	choice.Delta.Content = baiduResponse.Result
 	if baiduResponse.IsEnd {
-		choice.FinishReason = &constant.StopFinishReason
+		finishReason := convertFinishReason(baiduResponse.FinishReason)
+		choice.FinishReason = &finishReason
 	}
 	response := openai.ChatCompletionsStreamResponse{
 		Id:      baiduResponse.Id,
 		Object:  "chat.completion.chunk",
 		Created: baiduResponse.Created,
-		Model:   "ernie-bot",
+		Model:   modelName,
 		Choices: []openai.ChatCompletionsStreamResponseChoice{choice},
 	}
 	return &response
 }
 
+func errorWrapper(baiduError Error, statusCode int) *model.ErrorWithStatusCode {
+	return &model.ErrorWithStatusCode{
+		Error: model.Error{
+			Message: baiduError.ErrorMsg,
+			Type:    "baidu_error",
+			Param:   "",
+			Code:    baiduError.ErrorCode,
+		},
+		StatusCode: statusCode,
+	}
+}
+
 func ConvertEmbeddingRequest(request model.GeneralOpenAIRequest) *EmbeddingRequest {
 	return &EmbeddingRequest{
 		Input: request.ParseInput(),
@@ -136,86 +182,41 @@ func embeddingResponseBaidu2OpenAI(response *EmbeddingResponse) *openai.Embeddin
 	return &openAIEmbeddingResponse
 }
 
-func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.Usage) {
-	var usage model.Usage
-	scanner := bufio.NewScanner(resp.Body)
-	scanner.Split(bufio.ScanLines)
-
-	common.SetEventStreamHeaders(c)
-
-	for scanner.Scan() {
-		data := scanner.Text()
-		if len(data) < 6 {
-			continue
-		}
-		data = data[6:]
-
-		var baiduResponse ChatStreamResponse
-		err := json.Unmarshal([]byte(data), &baiduResponse)
-		if err != nil {
-			logger.SysError("error unmarshalling stream response: " + err.Error())
-			continue
-		}
-		if baiduResponse.Usage.TotalTokens != 0 {
-			usage.TotalTokens = baiduResponse.Usage.TotalTokens
-			usage.PromptTokens = baiduResponse.Usage.PromptTokens
-			usage.CompletionTokens = baiduResponse.Usage.TotalTokens - baiduResponse.Usage.PromptTokens
-		}
-		response := streamResponseBaidu2OpenAI(&baiduResponse)
-		err = render.ObjectData(c, response)
-		if err != nil {
-			logger.SysError(err.Error())
-		}
+// ParseResponse implements adaptor.ProviderAdapter.
+func (a *Adaptor) ParseResponse(meta *meta.Meta, body []byte) (*openai.TextResponse, *model.ErrorWithStatusCode) {
+	var baiduResponse ChatResponse
+	err := json.Unmarshal(body, &baiduResponse)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
 	}
-
-	if err := scanner.Err(); err != nil {
-		logger.SysError("error reading stream: " + err.Error())
+	if baiduResponse.ErrorMsg != "" {
+		return nil, errorWrapper(baiduResponse.Error, http.StatusInternalServerError)
 	}
+	return responseBaidu2OpenAI(&baiduResponse, meta.ActualModelName), nil
+}
 
-	render.Done(c)
-
-	err := resp.Body.Close()
+// ParseStreamChunk implements adaptor.ProviderAdapter, errors such as an invalid access token come as plain json
+// instead of an event.
+func (a *Adaptor) ParseStreamChunk(meta *meta.Meta, data string) (*openai.ChatCompletionsStreamResponse, error) {
+	var baiduResponse ChatStreamResponse
+	err := json.Unmarshal([]byte(data), &baiduResponse)
 	if err != nil {
-		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+		return nil, err
+	}
+	if baiduResponse.ErrorCode != 0 {
+		return nil, &adaptor.StreamError{Err: errorWrapper(baiduResponse.Error, http.StatusBadRequest)}
 	}
-	return nil, &usage
+	return streamResponseBaidu2OpenAI(&baiduResponse, meta.ActualModelName), nil
 }
 
-func Handler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.Usage) {
+// ExtractUsage implements adaptor.ProviderAdapter, the usage of a stream comes with the last event.
+func (a *Adaptor) ExtractUsage(data []byte) *model.Usage {
 	var baiduResponse ChatResponse
-	responseBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
-	}
-	err = resp.Body.Close()
-	if err != nil {
-		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
-	}
-	err = json.Unmarshal(responseBody, &baiduResponse)
-	if err != nil {
-		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
-	}
-	if baiduResponse.ErrorMsg != "" {
-		return &model.ErrorWithStatusCode{
-			Error: model.Error{
-				Message: baiduResponse.ErrorMsg,
-				Type:    "baidu_error",
-				Param:   "",
-				Code:    baiduResponse.ErrorCode,
-			},
-			StatusCode: resp.StatusCode,
-		}, nil
-	}
-	fullTextResponse := responseBaidu2OpenAI(&baiduResponse)
-	fullTextResponse.Model = "ernie-bot"
-	jsonResponse, err := json.Marshal(fullTextResponse)
-	if err != nil {
-		return openai.ErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	_ = json.Unmarshal(data, &baiduResponse)
+	if baiduResponse.Usage.TotalTokens == 0 {
+		return nil
 	}
-	c.Writer.Header().Set("Content-Type", "application/json")
-	c.Writer.WriteHeader(resp.StatusCode)
-	_, err = c.Writer.Write(jsonResponse)
-	return nil, &fullTextResponse.Usage
+	return &baiduResponse.Usage
 }
 
 func EmbeddingHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.Usage) {
@@ -233,15 +234,7 @@ func EmbeddingHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStat
 		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
 	}
 	if baiduResponse.ErrorMsg != "" {
-		return &model.ErrorWithStatusCode{
-			Error: model.Error{
-				Message: baiduResponse.ErrorMsg,
-				Type:    "baidu_error",
-				Param:   "",
-				Code:    baiduResponse.ErrorCode,
-			},
-			StatusCode: resp.StatusCode,
-		}, nil
+		return errorWrapper(baiduResponse.Error, resp.StatusCode), nil
 	}
 	fullTextResponse := embeddingResponseBaidu2OpenAI(&baiduResponse)
 	jsonResponse, err := json.Marshal(fullTextResponse)
@@ -254,30 +247,16 @@ func EmbeddingHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStat
 	return nil, &fullTextResponse.Usage
 }
 
+func init() {
+	credential.Register("baidu", getBaiduAccessToken)
+}
+
+// GetAccessToken returns a cached access token, it's renewed in the background before it expires
 func GetAccessToken(apiKey string) (string, error) {
-	if val, ok := baiduTokenStore.Load(apiKey); ok {
-		var accessToken AccessToken
-		if accessToken, ok = val.(AccessToken); ok {
-			// soon this will expire
-			if time.Now().Add(time.Hour).After(accessToken.ExpiresAt) {
-				go func() {
-					_, _ = getBaiduAccessTokenHelper(apiKey)
-				}()
-			}
-			return accessToken.AccessToken, nil
-		}
-	}
-	accessToken, err := getBaiduAccessTokenHelper(apiKey)
-	if err != nil {
-		return "", err
-	}
-	if accessToken == nil {
-		return "", errors.New("GetAccessToken return a nil token")
-	}
-	return (*accessToken).AccessToken, nil
+	return credential.Get("baidu", apiKey)
 }
 
-func getBaiduAccessTokenHelper(apiKey string) (*AccessToken, error) {
+func getBaiduAccessToken(apiKey string) (*credential.Token, error) {
 	parts := strings.Split(apiKey, "|")
 	if len(parts) != 2 {
 		return nil, errors.New("invalid baidu apikey")
@@ -304,9 +283,10 @@ func getBaiduAccessTokenHelper(apiKey string) (*AccessToken, error) {
 		return nil, errors.New(accessToken.Error + ": " + accessToken.ErrorDescription)
 	}
 	if accessToken.AccessToken == "" {
-		return nil, errors.New("getBaiduAccessTokenHelper get empty access token")
+		return nil, errors.New("getBaiduAccessToken get empty access token")
 	}
-	accessToken.ExpiresAt = time.Now().Add(time.Duration(accessToken.ExpiresIn) * time.Second)
-	baiduTokenStore.Store(apiKey, accessToken)
-	return &accessToken, nil
+	return &credential.Token{
+		AccessToken: accessToken.AccessToken,
+		ExpiresAt:   time.Now().Add(time.Duration(accessToken.ExpiresIn) * time.Second),
+	}, nil
 }
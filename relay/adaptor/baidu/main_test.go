@@ -0,0 +1,70 @@
+package baidu
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestConvertMessages(t *testing.T) {
+	Convey("convertMessages", t, func() {
+		system, messages := convertMessages([]model.Message{
+			{Role: "system", Content: "be brief"},
+			{Role: "assistant", Content: "hello"},
+			{Role: "user", Content: "hi"},
+			{Role: "user", Content: "how are you"},
+			{Role: "assistant", Content: "fine"},
+			{Role: "tool", Content: "42"},
+			{Role: "system", Content: "be nice"},
+		})
+		So(system, ShouldEqual, "be brief\nbe nice")
+		So(messages, ShouldResemble, []Message{
+			{Role: "user", Content: "hi\nhow are you"},
+			{Role: "assistant", Content: "fine"},
+			{Role: "user", Content: "42"},
+		})
+	})
+}
+
+func TestDoResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("DoResponse", t, func() {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		streamMeta := &meta.Meta{IsStream: true, PromptTokens: 1, ActualModelName: "ERNIE-4.0-8K"}
+
+		Convey("relays the stream", func() {
+			resp := &http.Response{
+				StatusCode: http.StatusOK,
+				Body: io.NopCloser(strings.NewReader("data: {\"id\":\"as-1\",\"result\":\"Hel\"}\n\n" +
+					"data: {\"id\":\"as-1\",\"result\":\"lo\",\"is_end\":true,\"usage\":{\"prompt_tokens\":3,\"total_tokens\":5}}\n\n")),
+			}
+			usage, err := (&Adaptor{}).DoResponse(c, resp, streamMeta)
+			So(err, ShouldBeNil)
+			So(*usage, ShouldResemble, model.Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5})
+			body := w.Body.String()
+			So(body, ShouldContainSubstring, `"finish_reason":"stop"`)
+			So(strings.HasSuffix(strings.TrimSpace(body), "data: [DONE]"), ShouldBeTrue)
+		})
+
+		Convey("relays the error sent instead of the stream as the error of the request", func() {
+			resp := &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(`{"error_code":110,"error_msg":"Access token invalid or no longer valid"}`)),
+			}
+			_, err := (&Adaptor{}).DoResponse(c, resp, streamMeta)
+			So(err, ShouldNotBeNil)
+			So(err.StatusCode, ShouldEqual, http.StatusBadRequest)
+			So(err.Message, ShouldEqual, "Access token invalid or no longer valid")
+			So(w.Body.Len(), ShouldEqual, 0)
+		})
+	})
+}
@@ -2,7 +2,6 @@ package baidu
 
 import (
 	"github.com/songquanpeng/one-api/relay/model"
-	"time"
 )
 
 type ChatResponse struct {
@@ -12,6 +11,7 @@ type ChatResponse struct {
 	Result           string      `json:"result"`
 	IsTruncated      bool        `json:"is_truncated"`
 	NeedClearHistory bool        `json:"need_clear_history"`
+	FinishReason     string      `json:"finish_reason"`
 	Usage            model.Usage `json:"usage"`
 	Error
 }
@@ -42,9 +42,8 @@ type EmbeddingResponse struct {
 }
 
 type AccessToken struct {
-	AccessToken      string    `json:"access_token"`
-	Error            string    `json:"error,omitempty"`
-	ErrorDescription string    `json:"error_description,omitempty"`
-	ExpiresIn        int64     `json:"expires_in,omitempty"`
-	ExpiresAt        time.Time `json:"-"`
+	AccessToken      string `json:"access_token"`
+	Error            string `json:"error,omitempty"`
+	ErrorDescription string `json:"error_description,omitempty"`
+	ExpiresIn        int64  `json:"expires_in,omitempty"`
 }
@@ -0,0 +1,11 @@
+package cerebras
+
+// https://inference-docs.cerebras.ai/models/overview
+
+var ModelList = []string{
+	"llama3.1-8b",
+	"llama-3.3-70b",
+	"llama-4-scout-17b-16e-instruct",
+	"qwen-3-32b",
+	"gpt-oss-120b",
+}
@@ -0,0 +1,13 @@
+package cerebras
+
+import (
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// ConvertRequest drops the parameters rejected by Cerebras, they would fail the request with 400 rather than be ignored
+// https://inference-docs.cerebras.ai/resources/openai
+func ConvertRequest(request *model.GeneralOpenAIRequest) *model.GeneralOpenAIRequest {
+	request.FrequencyPenalty = 0
+	request.PresencePenalty = 0
+	return request
+}
@@ -8,12 +8,14 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
 )
 
 type Adaptor struct {
-	meta *meta.Meta
+	meta     *meta.Meta
+	sentRole bool
 }
 
 // ConvertImageRequest implements adaptor.Adaptor.
@@ -21,13 +23,14 @@ func (*Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error) {
 	return nil, errors.New("not implemented")
 }
 
-// ConvertImageRequest implements adaptor.Adaptor.
-
 func (a *Adaptor) Init(meta *meta.Meta) {
 	a.meta = meta
 }
 
 func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
+	if meta.Config.UserID == "" {
+		return "", errors.New("account id of cloudflare is empty")
+	}
 	return fmt.Sprintf("%s/client/v4/accounts/%s/ai/run/%s", meta.BaseURL, meta.Config.UserID, meta.ActualModelName), nil
 }
 
@@ -41,6 +44,11 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.G
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
+	return a.BuildRequest(request)
+}
+
+// BuildRequest implements adaptor.ProviderAdapter.
+func (a *Adaptor) BuildRequest(request *model.GeneralOpenAIRequest) (any, error) {
 	return ConvertRequest(*request), nil
 }
 
@@ -49,12 +57,7 @@ func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Read
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
-	if meta.IsStream {
-		err, usage = StreamHandler(c, resp, meta.PromptTokens, meta.ActualModelName)
-	} else {
-		err, usage = Handler(c, resp, meta.PromptTokens, meta.ActualModelName)
-	}
-	return
+	return openai.DoProviderResponse(a, c, resp, meta)
 }
 
 func (a *Adaptor) GetModelList() []string {
@@ -17,6 +17,10 @@ var ModelList = []string{
 	"@hf/thebloke/llama-2-13b-chat-awq",
 	"@cf/meta-llama/llama-2-7b-chat-hf-lora",
 	"@cf/meta/llama-3-8b-instruct",
+	"@cf/meta/llama-3.1-8b-instruct",
+	"@cf/meta/llama-3.1-70b-instruct",
+	"@cf/meta/llama-3.2-3b-instruct",
+	"@cf/meta/llama-3.3-70b-instruct-fp8-fast",
 	"@hf/thebloke/llamaguard-7b-awq",
 	"@hf/thebloke/mistral-7b-instruct-v0.1-awq",
 	"@hf/mistralai/mistral-7b-instruct-v0.2",
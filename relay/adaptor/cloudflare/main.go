@@ -1,34 +1,43 @@
 package cloudflare
 
 import (
-	"bufio"
 	"encoding/json"
-	"github.com/songquanpeng/one-api/common/render"
-	"io"
 	"net/http"
 	"strings"
 
-	"github.com/gin-gonic/gin"
-	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/helper"
-	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
 )
 
 func ConvertRequest(textRequest model.GeneralOpenAIRequest) *Request {
-	var promptBuilder strings.Builder
-	for _, message := range textRequest.Messages {
-		promptBuilder.WriteString(message.StringContent())
-		promptBuilder.WriteString("\n") // 添加换行符来分隔每个消息
+	request := Request{
+		MaxTokens:        textRequest.MaxTokens,
+		Stream:           textRequest.Stream,
+		Temperature:      textRequest.Temperature,
+		TopP:             textRequest.TopP,
+		TopK:             textRequest.TopK,
+		Seed:             textRequest.Seed,
+		FrequencyPenalty: textRequest.FrequencyPenalty,
+		PresencePenalty:  textRequest.PresencePenalty,
 	}
-
-	return &Request{
-		MaxTokens:   textRequest.MaxTokens,
-		Prompt:      promptBuilder.String(),
-		Stream:      textRequest.Stream,
-		Temperature: textRequest.Temperature,
+	if len(textRequest.Messages) == 0 {
+		// completions
+		request.Prompt, _ = textRequest.Prompt.(string)
+		return &request
+	}
+	for _, message := range textRequest.Messages {
+		role := message.Role
+		if role != "system" && role != "assistant" {
+			role = "user"
+		}
+		request.Messages = append(request.Messages, Message{
+			Role:    role,
+			Content: message.StringContent(),
+		})
 	}
+	return &request
 }
 
 func ResponseCloudflare2OpenAI(cloudflareResponse *Response) *openai.TextResponse {
@@ -60,85 +69,79 @@ func StreamResponseCloudflare2OpenAI(cloudflareResponse *StreamResponse) *openai
 	return &openaiResponse
 }
 
-func StreamHandler(c *gin.Context, resp *http.Response, promptTokens int, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
-	scanner := bufio.NewScanner(resp.Body)
-	scanner.Split(bufio.ScanLines)
-
-	common.SetEventStreamHeaders(c)
-	id := helper.GetResponseID(c)
-	responseModel := c.GetString("original_model")
-	var responseText string
-
-	for scanner.Scan() {
-		data := scanner.Text()
-		if len(data) < len("data: ") {
-			continue
-		}
-		data = strings.TrimPrefix(data, "data: ")
-		data = strings.TrimSuffix(data, "\r")
-
-		var cloudflareResponse StreamResponse
-		err := json.Unmarshal([]byte(data), &cloudflareResponse)
-		if err != nil {
-			logger.SysError("error unmarshalling stream response: " + err.Error())
-			continue
-		}
-
-		response := StreamResponseCloudflare2OpenAI(&cloudflareResponse)
-		if response == nil {
-			continue
-		}
-
-		responseText += cloudflareResponse.Response
-		response.Id = id
-		response.Model = responseModel
-
-		err = render.ObjectData(c, response)
-		if err != nil {
-			logger.SysError(err.Error())
+func errorWrapper(cloudflareErrors []Error, statusCode int) *model.ErrorWithStatusCode {
+	if statusCode == http.StatusOK {
+		statusCode = http.StatusInternalServerError
+	}
+	messages := make([]string, 0, len(cloudflareErrors))
+	var code any
+	for _, err := range cloudflareErrors {
+		messages = append(messages, err.Message)
+		if code == nil {
+			code = err.Code
 		}
 	}
-
-	if err := scanner.Err(); err != nil {
-		logger.SysError("error reading stream: " + err.Error())
+	if len(messages) == 0 {
+		messages = append(messages, "unknown error")
 	}
+	return &model.ErrorWithStatusCode{
+		Error: model.Error{
+			Message: strings.Join(messages, "; "),
+			Type:    "cloudflare_error",
+			Code:    code,
+		},
+		StatusCode: statusCode,
+	}
+}
 
-	render.Done(c)
-
-	err := resp.Body.Close()
+// ParseResponse implements adaptor.ProviderAdapter.
+func (a *Adaptor) ParseResponse(meta *meta.Meta, body []byte) (*openai.TextResponse, *model.ErrorWithStatusCode) {
+	var cloudflareResponse Response
+	err := json.Unmarshal(body, &cloudflareResponse)
 	if err != nil {
-		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+		return nil, openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
 	}
-
-	usage := openai.ResponseText2Usage(responseText, responseModel, promptTokens)
-	return nil, usage
+	if !cloudflareResponse.Success {
+		return nil, errorWrapper(cloudflareResponse.Errors, http.StatusOK)
+	}
+	return ResponseCloudflare2OpenAI(&cloudflareResponse), nil
 }
 
-func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
-	responseBody, err := io.ReadAll(resp.Body)
+// ParseStreamChunk implements adaptor.ProviderAdapter, the finish reason is sent with the usage of the last event,
+// as cloudflare sends none.
+func (a *Adaptor) ParseStreamChunk(meta *meta.Meta, data string) (*openai.ChatCompletionsStreamResponse, error) {
+	var cloudflareResponse StreamResponse
+	err := json.Unmarshal([]byte(data), &cloudflareResponse)
 	if err != nil {
-		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+		return nil, err
 	}
-	err = resp.Body.Close()
-	if err != nil {
-		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	if cloudflareResponse.Usage != nil {
+		finishReason := "stop"
+		return &openai.ChatCompletionsStreamResponse{
+			Choices: []openai.ChatCompletionsStreamResponseChoice{{FinishReason: &finishReason}},
+		}, nil
 	}
-	var cloudflareResponse Response
-	err = json.Unmarshal(responseBody, &cloudflareResponse)
-	if err != nil {
-		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
-	}
-	fullTextResponse := ResponseCloudflare2OpenAI(&cloudflareResponse)
-	fullTextResponse.Model = modelName
-	usage := openai.ResponseText2Usage(cloudflareResponse.Result.Response, modelName, promptTokens)
-	fullTextResponse.Usage = *usage
-	fullTextResponse.Id = helper.GetResponseID(c)
-	jsonResponse, err := json.Marshal(fullTextResponse)
-	if err != nil {
-		return openai.ErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	if cloudflareResponse.Response == "" {
+		return nil, nil
+	}
+	response := StreamResponseCloudflare2OpenAI(&cloudflareResponse)
+	if a.sentRole {
+		// the role is only in the first delta, as OpenAI does
+		response.Choices[0].Delta.Role = ""
+	}
+	a.sentRole = true
+	return response, nil
+}
+
+// ExtractUsage implements adaptor.ProviderAdapter, the usage of a stream comes with the last event.
+func (a *Adaptor) ExtractUsage(data []byte) *model.Usage {
+	var cloudflareResponse struct {
+		Result *Result      `json:"result"`
+		Usage  *model.Usage `json:"usage"`
+	}
+	_ = json.Unmarshal(data, &cloudflareResponse)
+	if cloudflareResponse.Result != nil {
+		return cloudflareResponse.Result.Usage
 	}
-	c.Writer.Header().Set("Content-Type", "application/json")
-	c.Writer.WriteHeader(resp.StatusCode)
-	_, err = c.Writer.Write(jsonResponse)
-	return nil, usage
+	return cloudflareResponse.Usage
 }
@@ -0,0 +1,48 @@
+package cloudflare
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestDoResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("DoResponse", t, func() {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		resp := &http.Response{
+			StatusCode: http.StatusOK,
+			Body: io.NopCloser(strings.NewReader("data: {\"response\":\"Hel\"}\n\n" +
+				"data: {\"response\":\"lo\"}\n\n" +
+				"data: {\"response\":\"\",\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":2,\"total_tokens\":5}}\n\n" +
+				"data: [DONE]\n\n")),
+		}
+		usage, err := (&Adaptor{}).DoResponse(c, resp, &meta.Meta{IsStream: true, PromptTokens: 1, ActualModelName: "@cf/meta/llama-3-8b-instruct"})
+		So(err, ShouldBeNil)
+		So(usage.TotalTokens, ShouldEqual, 5)
+		body := w.Body.String()
+		So(strings.Count(body, `"role":"assistant"`), ShouldEqual, 1)
+		So(body, ShouldContainSubstring, `"finish_reason":"stop"`)
+		So(strings.HasSuffix(strings.TrimSpace(body), "data: [DONE]"), ShouldBeTrue)
+	})
+}
+
+func TestConvertRequest(t *testing.T) {
+	Convey("ConvertRequest", t, func() {
+		request := ConvertRequest(model.GeneralOpenAIRequest{Messages: []model.Message{
+			{Role: "system", Content: "be brief"},
+			{Role: "tool", Content: "42"},
+		}})
+		So(request.Messages, ShouldResemble, []Message{{Role: "system", Content: "be brief"}, {Role: "user", Content: "42"}})
+		So(request.Prompt, ShouldBeEmpty)
+	})
+}
@@ -1,25 +1,48 @@
 package cloudflare
 
+import "github.com/songquanpeng/one-api/relay/model"
+
+// https://developers.cloudflare.com/workers-ai/models/
+
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
 type Request struct {
-	Lora        string  `json:"lora,omitempty"`
-	MaxTokens   int     `json:"max_tokens,omitempty"`
-	Prompt      string  `json:"prompt,omitempty"`
-	Raw         bool    `json:"raw,omitempty"`
-	Stream      bool    `json:"stream,omitempty"`
-	Temperature float64 `json:"temperature,omitempty"`
+	Messages         []Message `json:"messages,omitempty"`
+	Lora             string    `json:"lora,omitempty"`
+	MaxTokens        int       `json:"max_tokens,omitempty"`
+	Prompt           string    `json:"prompt,omitempty"`
+	Raw              bool      `json:"raw,omitempty"`
+	Stream           bool      `json:"stream,omitempty"`
+	Temperature      float64   `json:"temperature,omitempty"`
+	TopP             float64   `json:"top_p,omitempty"`
+	TopK             int       `json:"top_k,omitempty"`
+	Seed             float64   `json:"seed,omitempty"`
+	FrequencyPenalty float64   `json:"frequency_penalty,omitempty"`
+	PresencePenalty  float64   `json:"presence_penalty,omitempty"`
 }
 
 type Result struct {
-	Response string `json:"response"`
+	Response string       `json:"response"`
+	Usage    *model.Usage `json:"usage,omitempty"`
+}
+
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
 }
 
 type Response struct {
-	Result   Result   `json:"result"`
-	Success  bool     `json:"success"`
-	Errors   []string `json:"errors"`
-	Messages []string `json:"messages"`
+	Result   Result  `json:"result"`
+	Success  bool    `json:"success"`
+	Errors   []Error `json:"errors"`
+	Messages []any   `json:"messages"`
 }
 
+// StreamResponse is an event of the stream, the last one before [DONE] has the usage
 type StreamResponse struct {
-	Response string `json:"response"`
+	Response string       `json:"response"`
+	Usage    *model.Usage `json:"usage,omitempty"`
 }
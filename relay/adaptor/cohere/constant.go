@@ -6,6 +6,14 @@ var ModelList = []string{
 	"command-r", "command-r-plus",
 }
 
+var RerankModelList = []string{
+	"rerank-english-v3.0", "rerank-multilingual-v3.0",
+	"rerank-english-v2.0", "rerank-multilingual-v2.0",
+}
+
+// RerankDocumentsPerSearch is the number of documents billed as one search unit
+const RerankDocumentsPerSearch = 100
+
 func init() {
 	num := len(ModelList)
 	for i := 0; i < num; i++ {
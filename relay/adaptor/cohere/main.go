@@ -1,19 +1,16 @@
 package cohere
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
-	"github.com/songquanpeng/one-api/common/render"
 	"io"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/helper"
-	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
 )
 
@@ -131,98 +128,80 @@ func ResponseCohere2OpenAI(cohereResponse *Response) *openai.TextResponse {
 	return &fullTextResponse
 }
 
-func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.Usage) {
-	createdTime := helper.GetTimestamp()
-	scanner := bufio.NewScanner(resp.Body)
-	scanner.Split(bufio.ScanLines)
-
-	common.SetEventStreamHeaders(c)
-	var usage model.Usage
-
-	for scanner.Scan() {
-		data := scanner.Text()
-		data = strings.TrimSuffix(data, "\r")
-
-		var cohereResponse StreamResponse
-		err := json.Unmarshal([]byte(data), &cohereResponse)
-		if err != nil {
-			logger.SysError("error unmarshalling stream response: " + err.Error())
-			continue
-		}
-
-		response, meta := StreamResponseCohere2OpenAI(&cohereResponse)
-		if meta != nil {
-			usage.PromptTokens += meta.Meta.Tokens.InputTokens
-			usage.CompletionTokens += meta.Meta.Tokens.OutputTokens
-			continue
-		}
-		if response == nil {
-			continue
-		}
-
-		response.Id = fmt.Sprintf("chatcmpl-%d", createdTime)
-		response.Model = c.GetString("original_model")
-		response.Created = createdTime
-
-		err = render.ObjectData(c, response)
-		if err != nil {
-			logger.SysError(err.Error())
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		logger.SysError("error reading stream: " + err.Error())
+// RerankHandler writes the response of upstream as is, and returns the search units billed by upstream
+func RerankHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, int) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), 0
 	}
-
-	render.Done(c)
-
-	err := resp.Body.Close()
+	err = resp.Body.Close()
 	if err != nil {
-		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), 0
 	}
-
-	return nil, &usage
-}
-
-func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
-	responseBody, err := io.ReadAll(resp.Body)
+	var rerankResponse RerankResponse
+	err = json.Unmarshal(responseBody, &rerankResponse)
 	if err != nil {
-		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), 0
 	}
-	err = resp.Body.Close()
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(responseBody)
 	if err != nil {
-		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+		return openai.ErrorWrapper(err, "write_response_body_failed", http.StatusInternalServerError), 0
 	}
+	return nil, rerankResponse.Meta.BilledUnits.SearchUnits
+}
+
+// ParseResponse implements adaptor.ProviderAdapter.
+func (a *Adaptor) ParseResponse(meta *meta.Meta, body []byte) (*openai.TextResponse, *model.ErrorWithStatusCode) {
 	var cohereResponse Response
-	err = json.Unmarshal(responseBody, &cohereResponse)
+	err := json.Unmarshal(body, &cohereResponse)
 	if err != nil {
-		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+		return nil, openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
 	}
 	if cohereResponse.ResponseID == "" {
-		return &model.ErrorWithStatusCode{
+		return nil, &model.ErrorWithStatusCode{
 			Error: model.Error{
 				Message: cohereResponse.Message,
 				Type:    cohereResponse.Message,
 				Param:   "",
-				Code:    resp.StatusCode,
+				Code:    http.StatusInternalServerError,
 			},
-			StatusCode: resp.StatusCode,
-		}, nil
-	}
-	fullTextResponse := ResponseCohere2OpenAI(&cohereResponse)
-	fullTextResponse.Model = modelName
-	usage := model.Usage{
-		PromptTokens:     cohereResponse.Meta.Tokens.InputTokens,
-		CompletionTokens: cohereResponse.Meta.Tokens.OutputTokens,
-		TotalTokens:      cohereResponse.Meta.Tokens.InputTokens + cohereResponse.Meta.Tokens.OutputTokens,
-	}
-	fullTextResponse.Usage = usage
-	jsonResponse, err := json.Marshal(fullTextResponse)
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	return ResponseCohere2OpenAI(&cohereResponse), nil
+}
+
+// ParseStreamChunk implements adaptor.ProviderAdapter.
+func (a *Adaptor) ParseStreamChunk(meta *meta.Meta, data string) (*openai.ChatCompletionsStreamResponse, error) {
+	var cohereResponse StreamResponse
+	err := json.Unmarshal([]byte(data), &cohereResponse)
 	if err != nil {
-		return openai.ErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+		return nil, err
+	}
+	response, _ := StreamResponseCohere2OpenAI(&cohereResponse)
+	return response, nil
+}
+
+// ExtractUsage implements adaptor.ProviderAdapter, the usage of a stream comes with the stream-end event.
+func (a *Adaptor) ExtractUsage(data []byte) *model.Usage {
+	var cohereResponse struct {
+		Response *Response `json:"response"`
+		Meta     *Meta     `json:"meta"`
+	}
+	_ = json.Unmarshal(data, &cohereResponse)
+	cohereMeta := cohereResponse.Meta
+	if cohereResponse.Response != nil {
+		cohereMeta = &cohereResponse.Response.Meta
+	}
+	if cohereMeta == nil {
+		return nil
+	}
+	tokens := cohereMeta.Tokens
+	return &model.Usage{
+		PromptTokens:     tokens.InputTokens,
+		CompletionTokens: tokens.OutputTokens,
+		TotalTokens:      tokens.InputTokens + tokens.OutputTokens,
 	}
-	c.Writer.Header().Set("Content-Type", "application/json")
-	c.Writer.WriteHeader(resp.StatusCode)
-	_, err = c.Writer.Write(jsonResponse)
-	return nil, &usage
 }
@@ -139,9 +139,30 @@ type APIVersion struct {
 type BilledUnits struct {
 	InputTokens  int `json:"input_tokens"`
 	OutputTokens int `json:"output_tokens"`
+	SearchUnits  int `json:"search_units,omitempty"`
 }
 
 type Usage struct {
 	InputTokens  int `json:"input_tokens"`
 	OutputTokens int `json:"output_tokens"`
 }
+
+// RerankRequest is the request of https://docs.cohere.com/reference/rerank, which is relayed as is
+type RerankRequest struct {
+	Model     string `json:"model"`
+	Query     string `json:"query"`
+	Documents []any  `json:"documents"`
+	TopN      int    `json:"top_n,omitempty"`
+}
+
+type RerankResponse struct {
+	Id      string         `json:"id"`
+	Results []RerankResult `json:"results"`
+	Meta    Meta           `json:"meta"`
+}
+
+type RerankResult struct {
+	Index          int     `json:"index"`
+	RelevanceScore float64 `json:"relevance_score"`
+	Document       any     `json:"document,omitempty"`
+}
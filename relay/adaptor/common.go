@@ -1,43 +1,108 @@
 package adaptor
 
 import (
+	"bytes"
+	"compress/gzip"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/render"
+	"github.com/songquanpeng/one-api/common/trace"
+	"github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"io"
 	"net/http"
+	"strings"
 )
 
 func SetupCommonRequestHeader(c *gin.Context, req *http.Request, meta *meta.Meta) {
 	req.Header.Set("Content-Type", c.Request.Header.Get("Content-Type"))
 	req.Header.Set("Accept", c.Request.Header.Get("Accept"))
-	if meta.IsStream && c.Request.Header.Get("Accept") == "" {
+	if meta.IsStream && (c.Request.Header.Get("Accept") == "" || render.AcceptsNDJSON(c.Request.Header.Get("Accept"))) {
+		// the event stream of the upstream is converted to NDJSON for the client
 		req.Header.Set("Accept", "text/event-stream")
 	}
 }
 
+// SetupAuthHeader sets the key the way the channel is configured, self-hosted servers often take no key at all,
+// or take it in a header of their own
+func SetupAuthHeader(req *http.Request, apiKey string, cfg model.ChannelConfig) {
+	if cfg.NoAuth {
+		return
+	}
+	if cfg.AuthHeader != "" {
+		req.Header.Set(cfg.AuthHeader, apiKey)
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+}
+
 func DoRequestHelper(a Adaptor, c *gin.Context, meta *meta.Meta, requestBody io.Reader) (*http.Response, error) {
+	trace.Mark(c, "request_conversion")
 	fullRequestURL, err := a.GetRequestURL(meta)
 	if err != nil {
 		return nil, fmt.Errorf("get request url failed: %w", err)
 	}
-	req, err := http.NewRequest(c.Request.Method, fullRequestURL, requestBody)
+	isCompressed := false
+	if meta.Config.RequestCompression && requestBody != nil && strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") {
+		requestBody, isCompressed, err = compressRequestBody(requestBody)
+		if err != nil {
+			return nil, fmt.Errorf("compress request body failed: %w", err)
+		}
+	}
+	// bound to the client request, so that it's aborted if the client request is terminated
+	req, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, fullRequestURL, requestBody)
 	if err != nil {
 		return nil, fmt.Errorf("new request failed: %w", err)
 	}
+	if sized, ok := requestBody.(interface{ Size() int64 }); ok && !isCompressed {
+		// e.g. the spooled uploads, the length is only known to the readers of memory otherwise
+		req.ContentLength = sized.Size()
+	}
 	err = a.SetupRequestHeader(c, req, meta)
 	if err != nil {
 		return nil, fmt.Errorf("setup request header failed: %w", err)
 	}
+	if isCompressed {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	// the header setup may include fetching an upstream access token
+	trace.Mark(c, "request_setup")
 	resp, err := DoRequest(c, req)
+	trace.Mark(c, "upstream_response_headers")
 	if err != nil {
 		return nil, fmt.Errorf("do request failed: %w", err)
 	}
 	return resp, nil
 }
 
+// compressRequestBody gzips the body if it is large enough to be worth it, otherwise the body is returned unchanged
+func compressRequestBody(requestBody io.Reader) (io.Reader, bool, error) {
+	body, err := io.ReadAll(requestBody)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(body) < config.RequestCompressionMinBytes {
+		return bytes.NewReader(body), false, nil
+	}
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	_, err = writer.Write(body)
+	if err != nil {
+		return nil, false, err
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, false, err
+	}
+	return &buf, true, nil
+}
+
 func DoRequest(c *gin.Context, req *http.Request) (*http.Response, error) {
 	resp, err := client.HTTPClient.Do(req)
 	if err != nil {
@@ -50,3 +115,43 @@ func DoRequest(c *gin.Context, req *http.Request) (*http.Response, error) {
 	_ = c.Request.Body.Close()
 	return resp, nil
 }
+
+// SetupResponseHeader copies the headers of the upstream response to the client,
+// following the response header policy of the selected channel
+func SetupResponseHeader(c *gin.Context, resp *http.Response) {
+	var cfg model.ChannelConfig
+	if value, ok := c.Get(ctxkey.Config); ok {
+		cfg = value.(model.ChannelConfig)
+	}
+	for k, v := range resp.Header {
+		if k == helper.RequestIdKey {
+			// the id of this request is kept, an upstream one-api has its own
+			if v[0] != c.GetString(helper.RequestIdKey) {
+				logger.Infof(c.Request.Context(), "request id of upstream: %s", v[0])
+			}
+			continue
+		}
+		if len(cfg.ResponseHeaderAllowList) != 0 && !matchHeader(cfg.ResponseHeaderAllowList, k) {
+			continue
+		}
+		if matchHeader(cfg.ResponseHeaderDenyList, k) {
+			continue
+		}
+		c.Writer.Header().Set(k, v[0])
+	}
+}
+
+func matchHeader(patterns []string, key string) bool {
+	key = strings.ToLower(key)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == pattern {
+			return true
+		}
+	}
+	return false
+}
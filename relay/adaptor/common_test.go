@@ -0,0 +1,191 @@
+package adaptor
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestMatchHeader(t *testing.T) {
+	Convey("matchHeader", t, func() {
+		cases := []struct {
+			patterns []string
+			key      string
+			matched  bool
+		}{
+			{[]string{"Openai-Model"}, "Openai-Model", true},
+			{[]string{"Openai-Model"}, "Openai-Organization", false},
+			{[]string{"X-Ratelimit-*"}, "X-Ratelimit-Remaining-Requests", true},
+			{[]string{"X-Ratelimit-*"}, "X-Request-Id", false},
+			{[]string{"*"}, "Anything", true},
+			{[]string{" openai-model "}, "Openai-Model", true},
+			{[]string{"x-ratelimit-*"}, "X-RateLimit-Limit", true},
+			{[]string{"OPENAI-MODEL"}, "openai-model", true},
+			{nil, "Openai-Model", false},
+		}
+		for _, c := range cases {
+			So(matchHeader(c.patterns, c.key), ShouldEqual, c.matched)
+		}
+	})
+}
+
+func TestSetupResponseHeader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("SetupResponseHeader follows the response header policy of the channel", t, func() {
+		upstreamHeader := http.Header{
+			"Content-Type":                   {"application/json"},
+			"Openai-Model":                   {"gpt-4o"},
+			"Openai-Organization":            {"org-secret"},
+			"X-Ratelimit-Remaining-Requests": {"99"},
+			"X-Ratelimit-Limit-Tokens":       {"10000"},
+			helper.RequestIdKey:              {"upstream-request-id"},
+		}
+		cases := []struct {
+			name     string
+			cfg      *model.ChannelConfig
+			expected []string
+		}{
+			{"every header is copied without a config", nil,
+				[]string{"Content-Type", "Openai-Model", "Openai-Organization", "X-Ratelimit-Remaining-Requests", "X-Ratelimit-Limit-Tokens"}},
+			{"every header is copied with empty lists", &model.ChannelConfig{},
+				[]string{"Content-Type", "Openai-Model", "Openai-Organization", "X-Ratelimit-Remaining-Requests", "X-Ratelimit-Limit-Tokens"}},
+			{"exact allow", &model.ChannelConfig{ResponseHeaderAllowList: []string{"Content-Type", "Openai-Model"}},
+				[]string{"Content-Type", "Openai-Model"}},
+			{"prefix allow", &model.ChannelConfig{ResponseHeaderAllowList: []string{"content-type", "x-ratelimit-*"}},
+				[]string{"Content-Type", "X-Ratelimit-Remaining-Requests", "X-Ratelimit-Limit-Tokens"}},
+			{"exact deny", &model.ChannelConfig{ResponseHeaderDenyList: []string{"OPENAI-ORGANIZATION"}},
+				[]string{"Content-Type", "Openai-Model", "X-Ratelimit-Remaining-Requests", "X-Ratelimit-Limit-Tokens"}},
+			{"deny over allow", &model.ChannelConfig{ResponseHeaderAllowList: []string{"Content-Type", "X-Ratelimit-*"},
+				ResponseHeaderDenyList: []string{"X-Ratelimit-Limit-*"}},
+				[]string{"Content-Type", "X-Ratelimit-Remaining-Requests"}},
+		}
+		for _, tc := range cases {
+			Convey(tc.name, func() {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+				c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+				c.Set(helper.RequestIdKey, "local-request-id")
+				if tc.cfg != nil {
+					c.Set(ctxkey.Config, *tc.cfg)
+				}
+				SetupResponseHeader(c, &http.Response{Header: upstreamHeader})
+				header := c.Writer.Header()
+				copied := make([]string, 0, len(header))
+				for key := range header {
+					copied = append(copied, key)
+				}
+				So(copied, ShouldHaveLength, len(tc.expected))
+				for _, key := range tc.expected {
+					So(header.Get(key), ShouldEqual, upstreamHeader.Get(key))
+				}
+				// the request id of the upstream is never copied
+				So(header.Get(helper.RequestIdKey), ShouldBeEmpty)
+			})
+		}
+	})
+}
+
+// testAdaptor sends the requests to url as they are
+type testAdaptor struct {
+	url string
+}
+
+func (a *testAdaptor) Init(meta *meta.Meta) {}
+
+func (a *testAdaptor) GetRequestURL(meta *meta.Meta) (string, error) {
+	return a.url, nil
+}
+
+func (a *testAdaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *meta.Meta) error {
+	SetupCommonRequestHeader(c, req, meta)
+	return nil
+}
+
+func (a *testAdaptor) ConvertRequest(c *gin.Context, relayMode int, request *relaymodel.GeneralOpenAIRequest) (any, error) {
+	return request, nil
+}
+
+func (a *testAdaptor) ConvertImageRequest(request *relaymodel.ImageRequest) (any, error) {
+	return request, nil
+}
+
+func (a *testAdaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Reader) (*http.Response, error) {
+	return DoRequestHelper(a, c, meta, requestBody)
+}
+
+func (a *testAdaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (*relaymodel.Usage, *relaymodel.ErrorWithStatusCode) {
+	return nil, nil
+}
+
+func (a *testAdaptor) GetModelList() []string {
+	return nil
+}
+
+func (a *testAdaptor) GetChannelName() string {
+	return "test"
+}
+
+func TestDoRequestHelperCompression(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("the large JSON bodies are gzipped for the channels accepting it", t, func() {
+		if client.HTTPClient == nil {
+			client.HTTPClient = http.DefaultClient
+		}
+		oldMinBytes := config.RequestCompressionMinBytes
+		config.RequestCompressionMinBytes = 1024
+		t.Cleanup(func() {
+			config.RequestCompressionMinBytes = oldMinBytes
+		})
+		var contentEncoding string
+		var received []byte
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			contentEncoding = r.Header.Get("Content-Encoding")
+			body := io.Reader(r.Body)
+			if contentEncoding == "gzip" {
+				reader, err := gzip.NewReader(r.Body)
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				body = reader
+			}
+			received, _ = io.ReadAll(body)
+		}))
+		defer upstream.Close()
+		send := func(compression bool, contentType string, body string) {
+			contentEncoding, received = "", nil
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+			c.Request.Header.Set("Content-Type", contentType)
+			meta := &meta.Meta{Config: model.ChannelConfig{RequestCompression: compression}}
+			resp, err := (&testAdaptor{url: upstream.URL}).DoRequest(c, meta, strings.NewReader(body))
+			So(err, ShouldBeNil)
+			So(resp.StatusCode, ShouldEqual, http.StatusOK)
+			_ = resp.Body.Close()
+			So(string(received), ShouldEqual, body)
+		}
+		large := `{"model":"gpt-4o","input":"` + strings.Repeat("a", 2048) + `"}`
+
+		send(true, "application/json", large)
+		So(contentEncoding, ShouldEqual, "gzip")
+		send(true, "application/json", `{"model":"gpt-4o"}`)
+		So(contentEncoding, ShouldBeEmpty)
+		send(false, "application/json", large)
+		So(contentEncoding, ShouldBeEmpty)
+		send(true, "multipart/form-data; boundary=x", large)
+		So(contentEncoding, ShouldBeEmpty)
+	})
+}
@@ -35,6 +35,11 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.G
 		return nil, errors.New("request is nil")
 	}
 	request.User = a.meta.Config.UserID
+	return a.BuildRequest(request)
+}
+
+// BuildRequest implements adaptor.ProviderAdapter.
+func (a *Adaptor) BuildRequest(request *model.GeneralOpenAIRequest) (any, error) {
 	return ConvertRequest(*request), nil
 }
 
@@ -50,20 +55,7 @@ func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Read
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
-	var responseText *string
-	if meta.IsStream {
-		err, responseText = StreamHandler(c, resp)
-	} else {
-		err, responseText = Handler(c, resp, meta.PromptTokens, meta.ActualModelName)
-	}
-	if responseText != nil {
-		usage = openai.ResponseText2Usage(*responseText, meta.ActualModelName, meta.PromptTokens)
-	} else {
-		usage = &model.Usage{}
-	}
-	usage.PromptTokens = meta.PromptTokens
-	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
-	return
+	return openai.DoProviderResponse(a, c, resp, meta)
 }
 
 func (a *Adaptor) GetModelList() []string {
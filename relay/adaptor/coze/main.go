@@ -1,21 +1,15 @@
 package coze
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
-	"github.com/songquanpeng/one-api/common/render"
-	"io"
 	"net/http"
 	"strings"
 
-	"github.com/gin-gonic/gin"
-	"github.com/songquanpeng/one-api/common"
-	"github.com/songquanpeng/one-api/common/conv"
 	"github.com/songquanpeng/one-api/common/helper"
-	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/relay/adaptor/coze/constant/messagetype"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
 )
 
@@ -107,96 +101,37 @@ func ResponseCoze2OpenAI(cozeResponse *Response) *openai.TextResponse {
 	return &fullTextResponse
 }
 
-func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *string) {
-	var responseText string
-	createdTime := helper.GetTimestamp()
-	scanner := bufio.NewScanner(resp.Body)
-	scanner.Split(bufio.ScanLines)
-
-	common.SetEventStreamHeaders(c)
-	var modelName string
-
-	for scanner.Scan() {
-		data := scanner.Text()
-		if len(data) < 5 || !strings.HasPrefix(data, "data:") {
-			continue
-		}
-		data = strings.TrimPrefix(data, "data:")
-		data = strings.TrimSuffix(data, "\r")
-
-		var cozeResponse StreamResponse
-		err := json.Unmarshal([]byte(data), &cozeResponse)
-		if err != nil {
-			logger.SysError("error unmarshalling stream response: " + err.Error())
-			continue
-		}
-
-		response, _ := StreamResponseCoze2OpenAI(&cozeResponse)
-		if response == nil {
-			continue
-		}
-
-		for _, choice := range response.Choices {
-			responseText += conv.AsString(choice.Delta.Content)
-		}
-		response.Model = modelName
-		response.Created = createdTime
-
-		err = render.ObjectData(c, response)
-		if err != nil {
-			logger.SysError(err.Error())
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		logger.SysError("error reading stream: " + err.Error())
-	}
-
-	render.Done(c)
-
-	err := resp.Body.Close()
-	if err != nil {
-		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
-	}
-
-	return nil, &responseText
-}
-
-func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName string) (*model.ErrorWithStatusCode, *string) {
-	responseBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
-	}
-	err = resp.Body.Close()
-	if err != nil {
-		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
-	}
+// ParseResponse implements adaptor.ProviderAdapter.
+func (a *Adaptor) ParseResponse(meta *meta.Meta, body []byte) (*openai.TextResponse, *model.ErrorWithStatusCode) {
 	var cozeResponse Response
-	err = json.Unmarshal(responseBody, &cozeResponse)
+	err := json.Unmarshal(body, &cozeResponse)
 	if err != nil {
-		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+		return nil, openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
 	}
 	if cozeResponse.Code != 0 {
-		return &model.ErrorWithStatusCode{
+		return nil, &model.ErrorWithStatusCode{
 			Error: model.Error{
 				Message: cozeResponse.Msg,
 				Code:    cozeResponse.Code,
 			},
-			StatusCode: resp.StatusCode,
-		}, nil
+			StatusCode: http.StatusInternalServerError,
+		}
 	}
-	fullTextResponse := ResponseCoze2OpenAI(&cozeResponse)
-	fullTextResponse.Model = modelName
-	jsonResponse, err := json.Marshal(fullTextResponse)
+	return ResponseCoze2OpenAI(&cozeResponse), nil
+}
+
+// ParseStreamChunk implements adaptor.ProviderAdapter, only the messages of the answer are sent to the client.
+func (a *Adaptor) ParseStreamChunk(meta *meta.Meta, data string) (*openai.ChatCompletionsStreamResponse, error) {
+	var cozeResponse StreamResponse
+	err := json.Unmarshal([]byte(data), &cozeResponse)
 	if err != nil {
-		return openai.ErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+		return nil, err
 	}
-	c.Writer.Header().Set("Content-Type", "application/json")
-	c.Writer.WriteHeader(resp.StatusCode)
-	_, err = c.Writer.Write(jsonResponse)
-	var responseText string
-	if len(fullTextResponse.Choices) > 0 {
-		responseText = fullTextResponse.Choices[0].Message.StringContent()
-	}
-	return nil, &responseText
+	response, _ := StreamResponseCoze2OpenAI(&cozeResponse)
+	return response, nil
+}
+
+// ExtractUsage implements adaptor.ProviderAdapter, coze sends no usage, the tokens are counted from the answer.
+func (a *Adaptor) ExtractUsage(data []byte) *model.Usage {
+	return nil
 }
@@ -0,0 +1,7 @@
+package deepgram
+
+// https://developers.deepgram.com/docs/models-languages-overview
+var ModelList = []string{
+	"nova-3",
+	"nova-2",
+}
@@ -0,0 +1,99 @@
+package deepgram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// GetListenPath returns the path of a pre-recorded transcription, the language is detected if it's not given
+func GetListenPath(request *openai.TranscriptionRequest) string {
+	query := url.Values{}
+	query.Set("model", request.Model)
+	query.Set("smart_format", "true")
+	query.Set("utterances", "true")
+	if request.Language != "" {
+		query.Set("language", request.Language)
+	} else {
+		query.Set("detect_language", "true")
+	}
+	return "/v1/listen?" + query.Encode()
+}
+
+// ResponseListen2OpenAI converts the transcription of the first channel, the utterances are the segments
+func ResponseListen2OpenAI(response *ListenResponse) *openai.WhisperVerboseJSONResponse {
+	transcription := &openai.WhisperVerboseJSONResponse{
+		Task:     "transcribe",
+		Duration: response.Metadata.Duration,
+	}
+	if len(response.Results.Channels) != 0 {
+		channel := response.Results.Channels[0]
+		transcription.Language = channel.DetectedLanguage
+		if len(channel.Alternatives) != 0 {
+			transcription.Text = channel.Alternatives[0].Transcript
+		}
+	}
+	for i, utterance := range response.Results.Utterances {
+		transcription.Segments = append(transcription.Segments, openai.Segment{
+			Id:    i,
+			Start: utterance.Start,
+			End:   utterance.End,
+			Text:  utterance.Transcript,
+		})
+	}
+	return transcription
+}
+
+func errorHandler(resp *http.Response) *model.ErrorWithStatusCode {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	var errorResponse ErrorResponse
+	_ = json.Unmarshal(responseBody, &errorResponse)
+	message := errorResponse.ErrMsg
+	if message == "" {
+		message = errorResponse.Message
+	}
+	if message == "" {
+		message = fmt.Sprintf("bad response status code %d", resp.StatusCode)
+	}
+	return openai.ErrorWrapper(errors.New(message), "deepgram_error", resp.StatusCode)
+}
+
+// Transcribe sends the audio as the body, the transcription is returned at once
+func Transcribe(ctx context.Context, baseURL string, key string, request *openai.TranscriptionRequest) (*openai.WhisperVerboseJSONResponse, *model.ErrorWithStatusCode) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+GetListenPath(request), bytes.NewReader(request.File))
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "new_request_failed", http.StatusInternalServerError)
+	}
+	contentType := request.FileContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Token "+key)
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errorHandler(resp)
+	}
+	var listenResponse ListenResponse
+	err = json.NewDecoder(resp.Body).Decode(&listenResponse)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+	}
+	return ResponseListen2OpenAI(&listenResponse), nil
+}
@@ -0,0 +1,45 @@
+package deepgram
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+)
+
+func TestGetListenPath(t *testing.T) {
+	Convey("GetListenPath", t, func() {
+		So(GetListenPath(&openai.TranscriptionRequest{Model: "nova-3", Language: "en"}), ShouldEqual,
+			"/v1/listen?language=en&model=nova-3&smart_format=true&utterances=true")
+		So(GetListenPath(&openai.TranscriptionRequest{Model: "nova-2"}), ShouldEqual,
+			"/v1/listen?detect_language=true&model=nova-2&smart_format=true&utterances=true")
+	})
+}
+
+func TestResponseListen2OpenAI(t *testing.T) {
+	Convey("ResponseListen2OpenAI", t, func() {
+		var response ListenResponse
+		err := json.Unmarshal([]byte(`{
+			"metadata": {"request_id": "1", "duration": 3.5},
+			"results": {
+				"channels": [{"detected_language": "en", "alternatives": [{"transcript": "Hello there. How are you?", "confidence": 0.99}]}],
+				"utterances": [{"start": 0.1, "end": 1.2, "transcript": "Hello there."}, {"start": 1.5, "end": 3.4, "transcript": "How are you?"}]
+			}
+		}`), &response)
+		So(err, ShouldBeNil)
+		transcription := ResponseListen2OpenAI(&response)
+		So(transcription.Text, ShouldEqual, "Hello there. How are you?")
+		So(transcription.Language, ShouldEqual, "en")
+		So(transcription.Duration, ShouldEqual, 3.5)
+		So(transcription.Segments, ShouldHaveLength, 2)
+		So(transcription.Segments[1].Id, ShouldEqual, 1)
+		So(transcription.Segments[1].Start, ShouldEqual, 1.5)
+		So(transcription.Segments[1].Text, ShouldEqual, "How are you?")
+
+		Convey("without any channel", func() {
+			transcription := ResponseListen2OpenAI(&ListenResponse{})
+			So(transcription.Text, ShouldBeEmpty)
+		})
+	})
+}
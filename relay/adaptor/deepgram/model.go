@@ -0,0 +1,38 @@
+package deepgram
+
+type Alternative struct {
+	Transcript string  `json:"transcript"`
+	Confidence float64 `json:"confidence"`
+}
+
+type Channel struct {
+	DetectedLanguage string        `json:"detected_language,omitempty"`
+	Alternatives     []Alternative `json:"alternatives"`
+}
+
+type Utterance struct {
+	Start      float64 `json:"start"`
+	End        float64 `json:"end"`
+	Transcript string  `json:"transcript"`
+}
+
+type Metadata struct {
+	RequestId string  `json:"request_id"`
+	Duration  float64 `json:"duration"`
+}
+
+type ListenResponse struct {
+	Metadata Metadata `json:"metadata"`
+	Results  struct {
+		Channels   []Channel   `json:"channels"`
+		Utterances []Utterance `json:"utterances"`
+	} `json:"results"`
+}
+
+// ErrorResponse is either of the two formats of the errors
+type ErrorResponse struct {
+	ErrCode  string `json:"err_code,omitempty"`
+	ErrMsg   string `json:"err_msg,omitempty"`
+	Category string `json:"category,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
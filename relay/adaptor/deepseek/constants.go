@@ -3,4 +3,5 @@ package deepseek
 var ModelList = []string{
 	"deepseek-chat",
 	"deepseek-coder",
+	"deepseek-reasoner",
 }
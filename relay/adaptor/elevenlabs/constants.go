@@ -0,0 +1,27 @@
+package elevenlabs
+
+// https://elevenlabs.io/docs/models
+var ModelList = []string{
+	"eleven_multilingual_v2",
+	"eleven_v3",
+	"eleven_turbo_v2_5",
+	"eleven_flash_v2_5",
+}
+
+// the voices of OpenAI are mapped to premade voices, any other voice is taken as the id of an ElevenLabs voice
+var voiceIds = map[string]string{
+	"alloy":   "21m00Tcm4TlvDq8ikWAM", // Rachel
+	"echo":    "pNInz6obpgDQGcFmaJgB", // Adam
+	"fable":   "ErXwobaYiN019PkySvjV", // Antoni
+	"onyx":    "VR6AewLTigWG4xSOukaG", // Arnold
+	"nova":    "EXAVITQu4vr4xnjDxMKL", // Bella
+	"shimmer": "MF3mGyEYCl7XYWbV9V6O", // Elli
+}
+
+// the response formats of OpenAI with an equivalent output format, mp3 by default
+var outputFormats = map[string]string{
+	"":     "mp3_44100_128",
+	"mp3":  "mp3_44100_128",
+	"opus": "opus_48000_128",
+	"pcm":  "pcm_24000", // 24kHz 16-bit, as the one of OpenAI
+}
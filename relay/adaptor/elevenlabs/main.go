@@ -0,0 +1,35 @@
+package elevenlabs
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+)
+
+// ConvertTTSRequest returns the request with its path, the voice and the output format are in the path
+func ConvertTTSRequest(request openai.TextToSpeechRequest) (*TTSRequest, string, error) {
+	if request.Voice == "" {
+		return nil, "", errors.New("voice is required")
+	}
+	outputFormat, ok := outputFormats[request.ResponseFormat]
+	if !ok {
+		return nil, "", fmt.Errorf("unsupported response_format: %s", request.ResponseFormat)
+	}
+	voiceId := request.Voice
+	if id, ok := voiceIds[request.Voice]; ok {
+		voiceId = id
+	}
+	ttsRequest := &TTSRequest{
+		Text:    request.Input,
+		ModelId: request.Model,
+	}
+	if request.Speed != 0 {
+		// ElevenLabs takes a narrower range than OpenAI
+		ttsRequest.VoiceSettings = &VoiceSettings{Speed: math.Min(math.Max(request.Speed, 0.7), 1.2)}
+	}
+	path := fmt.Sprintf("/v1/text-to-speech/%s?output_format=%s", url.PathEscape(voiceId), outputFormat)
+	return ttsRequest, path, nil
+}
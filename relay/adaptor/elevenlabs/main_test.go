@@ -0,0 +1,45 @@
+package elevenlabs
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+)
+
+func TestConvertTTSRequest(t *testing.T) {
+	Convey("ConvertTTSRequest", t, func() {
+		Convey("maps the voices and formats of OpenAI", func() {
+			request, path, err := ConvertTTSRequest(openai.TextToSpeechRequest{
+				Model: "eleven_multilingual_v2",
+				Input: "Hello",
+				Voice: "alloy",
+				Speed: 2,
+			})
+			So(err, ShouldBeNil)
+			So(path, ShouldEqual, "/v1/text-to-speech/21m00Tcm4TlvDq8ikWAM?output_format=mp3_44100_128")
+			So(request.Text, ShouldEqual, "Hello")
+			So(request.ModelId, ShouldEqual, "eleven_multilingual_v2")
+			So(request.VoiceSettings.Speed, ShouldEqual, 1.2)
+		})
+
+		Convey("takes other voices as ids", func() {
+			request, path, err := ConvertTTSRequest(openai.TextToSpeechRequest{
+				Model:          "eleven_flash_v2_5",
+				Input:          "Hello",
+				Voice:          "my-voice",
+				ResponseFormat: "pcm",
+			})
+			So(err, ShouldBeNil)
+			So(path, ShouldEqual, "/v1/text-to-speech/my-voice?output_format=pcm_24000")
+			So(request.VoiceSettings, ShouldBeNil)
+		})
+
+		Convey("rejects the formats without an equivalent", func() {
+			_, _, err := ConvertTTSRequest(openai.TextToSpeechRequest{Input: "Hello", Voice: "alloy", ResponseFormat: "flac"})
+			So(err, ShouldNotBeNil)
+			_, _, err = ConvertTTSRequest(openai.TextToSpeechRequest{Input: "Hello"})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
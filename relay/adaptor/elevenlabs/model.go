@@ -0,0 +1,11 @@
+package elevenlabs
+
+type VoiceSettings struct {
+	Speed float64 `json:"speed,omitempty"`
+}
+
+type TTSRequest struct {
+	Text          string         `json:"text"`
+	ModelId       string         `json:"model_id"`
+	VoiceSettings *VoiceSettings `json:"voice_settings,omitempty"`
+}
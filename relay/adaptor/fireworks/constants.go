@@ -0,0 +1,13 @@
+package fireworks
+
+// https://fireworks.ai/models
+
+var ModelList = []string{
+	"accounts/fireworks/models/llama-v3p1-8b-instruct",
+	"accounts/fireworks/models/llama-v3p1-70b-instruct",
+	"accounts/fireworks/models/llama-v3p1-405b-instruct",
+	"accounts/fireworks/models/llama-v3p3-70b-instruct",
+	"accounts/fireworks/models/mixtral-8x22b-instruct",
+	"accounts/fireworks/models/qwen2p5-72b-instruct",
+	"accounts/fireworks/models/deepseek-v3",
+}
@@ -17,10 +17,11 @@ import (
 )
 
 type Adaptor struct {
+	meta *meta.Meta
 }
 
 func (a *Adaptor) Init(meta *meta.Meta) {
-
+	a.meta = meta
 }
 
 func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
@@ -54,11 +55,22 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.G
 		geminiEmbeddingRequest := ConvertEmbeddingRequest(*request)
 		return geminiEmbeddingRequest, nil
 	default:
-		geminiRequest := ConvertRequest(*request)
-		return geminiRequest, nil
+		return ConvertCachedRequest(c, *request, func(cache *CachedContent) (*CachedContent, error) {
+			return a.createCachedContent(c, cache)
+		}), nil
 	}
 }
 
+func (a *Adaptor) createCachedContent(c *gin.Context, cache *CachedContent) (*CachedContent, error) {
+	version := helper.AssignOrDefault(a.meta.Config.APIVersion, config.GeminiVersion)
+	cache.Model = "models/" + a.meta.ActualModelName
+	url := fmt.Sprintf("%s/%s/cachedContents", a.meta.BaseURL, version)
+	return CreateCachedContent(c.Request.Context(), url, func(req *http.Request) error {
+		req.Header.Set("x-goog-api-key", a.meta.APIKey)
+		return nil
+	}, cache)
+}
+
 func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error) {
 	if request == nil {
 		return nil, errors.New("request is nil")
@@ -73,8 +85,10 @@ func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Read
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
 	if meta.IsStream {
 		var responseText string
-		err, responseText = StreamHandler(c, resp)
-		usage = openai.ResponseText2Usage(responseText, meta.ActualModelName, meta.PromptTokens)
+		err, responseText, usage = StreamHandler(c, resp)
+		if usage == nil {
+			usage = openai.ResponseText2Usage(responseText, meta.ActualModelName, meta.PromptTokens)
+		}
 	} else {
 		switch meta.Mode {
 		case relaymode.Embeddings:
@@ -83,6 +97,7 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Met
 			err, usage = Handler(c, resp, meta.PromptTokens, meta.ActualModelName)
 		}
 	}
+	SetCacheStorage(c, usage)
 	return
 }
 
@@ -0,0 +1,109 @@
+package gemini
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://ai.google.dev/gemini-api/docs/caching
+
+// CachedContentHeader returns the name of the cache created for the request, the following requests reference it
+// with cached_content instead of sending the system messages again
+const CachedContentHeader = "X-Cached-Content"
+
+// ConvertCachedRequest converts the request with the context caching: a request with cached_content references
+// the cache, and the leading system messages of a request with cache_ttl are cached by create first.
+// The request is sent uncached if the cache can't be created, e.g. the messages are shorter than the minimum of the model
+func ConvertCachedRequest(c *gin.Context, request model.GeneralOpenAIRequest, create func(cache *CachedContent) (*CachedContent, error)) *ChatRequest {
+	if request.CachedContent != "" {
+		return referenceCachedContent(ConvertRequest(request), request.CachedContent)
+	}
+	systemMessages := 0
+	for systemMessages < len(request.Messages) && request.Messages[systemMessages].Role == "system" {
+		systemMessages++
+	}
+	if request.CacheTTL <= 0 || systemMessages == 0 || systemMessages == len(request.Messages) {
+		return ConvertRequest(request)
+	}
+	cacheRequest := request
+	cacheRequest.Messages = request.Messages[:systemMessages]
+	cacheContents := ConvertRequest(cacheRequest)
+	cache, err := create(&CachedContent{
+		Contents: cacheContents.Contents,
+		Tools:    cacheContents.Tools,
+		TTL:      fmt.Sprintf("%ds", request.CacheTTL),
+	})
+	if err != nil {
+		logger.Warnf(c.Request.Context(), "create cached content failed: %s", err.Error())
+		return ConvertRequest(request)
+	}
+	c.Header(CachedContentHeader, cache.Name)
+	if cache.UsageMetadata != nil {
+		c.Set(ctxkey.CacheStorage, &model.CacheStorage{
+			Tokens: cache.UsageMetadata.TotalTokenCount,
+			Hours:  float64(request.CacheTTL) / 3600,
+		})
+	}
+	request.Messages = request.Messages[systemMessages:]
+	return referenceCachedContent(ConvertRequest(request), cache.Name)
+}
+
+// the tools are cached with the contents, a request with both is rejected
+func referenceCachedContent(geminiRequest *ChatRequest, name string) *ChatRequest {
+	geminiRequest.CachedContent = name
+	geminiRequest.Tools = nil
+	return geminiRequest
+}
+
+// CreateCachedContent creates the cache at the endpoint of Gemini or Vertex AI
+func CreateCachedContent(ctx context.Context, url string, setupAuth func(req *http.Request) error, cache *CachedContent) (*CachedContent, error) {
+	jsonData, err := json.Marshal(cache)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	err = setupAuth(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var created CachedContent
+	err = json.NewDecoder(resp.Body).Decode(&created)
+	if err != nil {
+		return nil, err
+	}
+	if created.Error != nil {
+		return nil, fmt.Errorf("%s: %s", created.Error.Status, created.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK || created.Name == "" {
+		return nil, fmt.Errorf("bad response status code %d", resp.StatusCode)
+	}
+	return &created, nil
+}
+
+// SetCacheStorage bills the cache created for the request with the usage
+func SetCacheStorage(c *gin.Context, usage *model.Usage) {
+	if usage == nil {
+		return
+	}
+	if storage, ok := c.Get(ctxkey.CacheStorage); ok {
+		usage.CacheStorage = storage.(*model.CacheStorage)
+	}
+}
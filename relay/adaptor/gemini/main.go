@@ -28,6 +28,31 @@ const (
 	VisionMaxImageNum = 16
 )
 
+// the keywords of JSON Schema which the OpenAPI schema of Gemini rejects
+var unsupportedSchemaKeywords = []string{"$schema", "$id", "additionalProperties", "strict", "title", "default"}
+
+// cleanResponseSchema drops the unsupported keywords from the schema and its subschemas, the schema is copied
+func cleanResponseSchema(schema any) any {
+	switch schema := schema.(type) {
+	case map[string]any:
+		cleaned := make(map[string]any, len(schema))
+		for key, value := range schema {
+			cleaned[key] = cleanResponseSchema(value)
+		}
+		for _, keyword := range unsupportedSchemaKeywords {
+			delete(cleaned, keyword)
+		}
+		return cleaned
+	case []any:
+		cleaned := make([]any, 0, len(schema))
+		for _, item := range schema {
+			cleaned = append(cleaned, cleanResponseSchema(item))
+		}
+		return cleaned
+	}
+	return schema
+}
+
 // Setting safety to the lowest possible values since Gemini is already powerless enough
 func ConvertRequest(textRequest model.GeneralOpenAIRequest) *ChatRequest {
 	geminiRequest := ChatRequest{
@@ -56,6 +81,17 @@ func ConvertRequest(textRequest model.GeneralOpenAIRequest) *ChatRequest {
 			MaxOutputTokens: textRequest.MaxTokens,
 		},
 	}
+	if textRequest.ResponseFormat != nil && (textRequest.ResponseFormat.Type == "json_object" || textRequest.ResponseFormat.Type == "json_schema") {
+		geminiRequest.GenerationConfig.ResponseMimeType = "application/json"
+		if textRequest.ResponseFormat.JsonSchema != nil && len(textRequest.ResponseFormat.JsonSchema.Schema) != 0 {
+			geminiRequest.GenerationConfig.ResponseSchema = cleanResponseSchema(textRequest.ResponseFormat.JsonSchema.Schema)
+		}
+	}
+	for _, modality := range textRequest.Modalities {
+		if modality == "image" {
+			geminiRequest.GenerationConfig.ResponseModalities = []string{"TEXT", "IMAGE"}
+		}
+	}
 	if textRequest.Tools != nil {
 		functions := make([]model.Function, 0, len(textRequest.Tools))
 		for _, tool := range textRequest.Tools {
@@ -161,18 +197,56 @@ func ConvertEmbeddingRequest(request model.GeneralOpenAIRequest) *BatchEmbedding
 type ChatResponse struct {
 	Candidates     []ChatCandidate    `json:"candidates"`
 	PromptFeedback ChatPromptFeedback `json:"promptFeedback"`
+	UsageMetadata  *UsageMetadata     `json:"usageMetadata,omitempty"`
+}
+
+// toUsage converts the usage, the prompt tokens include the ones of the cached content
+func (u *UsageMetadata) toUsage() *model.Usage {
+	usage := model.Usage{
+		PromptTokens:     u.PromptTokenCount,
+		CompletionTokens: u.CandidatesTokenCount,
+		TotalTokens:      u.PromptTokenCount + u.CandidatesTokenCount,
+	}
+	if u.CachedContentTokenCount != 0 {
+		usage.PromptTokensDetails = &model.PromptTokensDetails{CachedTokens: u.CachedContentTokenCount}
+	}
+	return &usage
 }
 
 func (g *ChatResponse) GetResponseText() string {
 	if g == nil {
 		return ""
 	}
-	if len(g.Candidates) > 0 && len(g.Candidates[0].Content.Parts) > 0 {
-		return g.Candidates[0].Content.Parts[0].Text
+	if len(g.Candidates) > 0 {
+		return getPartsText(g.Candidates[0].Content.Parts)
 	}
 	return ""
 }
 
+// getPartsText joins the text of the parts, the models generating images send the text and the images in parts of their own
+func getPartsText(parts []Part) string {
+	text := ""
+	for _, part := range parts {
+		text += part.Text
+	}
+	return text
+}
+
+// getPartsImages converts the images of the parts to image_url parts with data URLs, like OpenRouter
+func getPartsImages(parts []Part) []model.MessageContent {
+	var images []model.MessageContent
+	for _, part := range parts {
+		if part.InlineData == nil || !strings.HasPrefix(part.InlineData.MimeType, "image/") {
+			continue
+		}
+		images = append(images, model.MessageContent{
+			Type:     model.ContentTypeImageURL,
+			ImageURL: &model.ImageURL{Url: fmt.Sprintf("data:%s;base64,%s", part.InlineData.MimeType, part.InlineData.Data)},
+		})
+	}
+	return images
+}
+
 type ChatCandidate struct {
 	Content       ChatContent        `json:"content"`
 	FinishReason  string             `json:"finishReason"`
@@ -213,6 +287,19 @@ func getToolCalls(candidate *ChatCandidate) []model.Tool {
 	return toolCalls
 }
 
+func finishReasonGemini2OpenAI(reason string) string {
+	switch reason {
+	case "", "STOP":
+		return constant.StopFinishReason
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII":
+		return "content_filter"
+	default:
+		return strings.ToLower(reason)
+	}
+}
+
 func responseGeminiChat2OpenAI(response *ChatResponse) *openai.TextResponse {
 	fullTextResponse := openai.TextResponse{
 		Id:      fmt.Sprintf("chatcmpl-%s", random.GetUUID()),
@@ -226,17 +313,17 @@ func responseGeminiChat2OpenAI(response *ChatResponse) *openai.TextResponse {
 			Message: model.Message{
 				Role: "assistant",
 			},
-			FinishReason: constant.StopFinishReason,
+			FinishReason: finishReasonGemini2OpenAI(candidate.FinishReason),
 		}
 		if len(candidate.Content.Parts) > 0 {
 			if candidate.Content.Parts[0].FunctionCall != nil {
 				choice.Message.ToolCalls = getToolCalls(&candidate)
 			} else {
-				choice.Message.Content = candidate.Content.Parts[0].Text
+				choice.Message.Content = getPartsText(candidate.Content.Parts)
+				choice.Message.Images = getPartsImages(candidate.Content.Parts)
 			}
 		} else {
 			choice.Message.Content = ""
-			choice.FinishReason = candidate.FinishReason
 		}
 		fullTextResponse.Choices = append(fullTextResponse.Choices, choice)
 	}
@@ -246,7 +333,13 @@ func responseGeminiChat2OpenAI(response *ChatResponse) *openai.TextResponse {
 func streamResponseGeminiChat2OpenAI(geminiResponse *ChatResponse) *openai.ChatCompletionsStreamResponse {
 	var choice openai.ChatCompletionsStreamResponseChoice
 	choice.Delta.Content = geminiResponse.GetResponseText()
-	//choice.FinishReason = &constant.StopFinishReason
+	if len(geminiResponse.Candidates) > 0 {
+		choice.Delta.Images = getPartsImages(geminiResponse.Candidates[0].Content.Parts)
+	}
+	if len(geminiResponse.Candidates) > 0 && geminiResponse.Candidates[0].FinishReason != "" {
+		finishReason := finishReasonGemini2OpenAI(geminiResponse.Candidates[0].FinishReason)
+		choice.FinishReason = &finishReason
+	}
 	var response openai.ChatCompletionsStreamResponse
 	response.Id = fmt.Sprintf("chatcmpl-%s", random.GetUUID())
 	response.Created = helper.GetTimestamp()
@@ -273,10 +366,13 @@ func embeddingResponseGemini2OpenAI(response *EmbeddingResponse) *openai.Embeddi
 	return &openAIEmbeddingResponse
 }
 
-func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, string) {
+// StreamHandler relays the stream, the usage is nil if the upstream sends none
+func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, string, *model.Usage) {
 	responseText := ""
+	var usage *model.Usage
 	scanner := bufio.NewScanner(resp.Body)
 	scanner.Split(bufio.ScanLines)
+	scanner.Buffer(make([]byte, 64*1024), openai.MaxStreamEventBytes)
 
 	common.SetEventStreamHeaders(c)
 
@@ -296,12 +392,15 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 			continue
 		}
 
+		if geminiResponse.UsageMetadata != nil {
+			usage = geminiResponse.UsageMetadata.toUsage()
+		}
 		response := streamResponseGeminiChat2OpenAI(&geminiResponse)
 		if response == nil {
 			continue
 		}
 
-		responseText += response.Choices[0].Delta.StringContent()
+		responseText += response.Choices[0].Delta.StringContent() + response.Choices[0].Delta.ToolCallsText()
 
 		err = render.ObjectData(c, response)
 		if err != nil {
@@ -317,10 +416,10 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 
 	err := resp.Body.Close()
 	if err != nil {
-		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), ""
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), "", nil
 	}
 
-	return nil, responseText
+	return nil, responseText, usage
 }
 
 func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
@@ -350,12 +449,19 @@ func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName st
 	}
 	fullTextResponse := responseGeminiChat2OpenAI(&geminiResponse)
 	fullTextResponse.Model = modelName
-	completionTokens := openai.CountTokenText(geminiResponse.GetResponseText(), modelName)
+	responseText := geminiResponse.GetResponseText()
+	for _, choice := range fullTextResponse.Choices {
+		responseText += choice.ToolCallsText()
+	}
+	completionTokens := openai.CountTokenText(responseText, modelName)
 	usage := model.Usage{
 		PromptTokens:     promptTokens,
 		CompletionTokens: completionTokens,
 		TotalTokens:      promptTokens + completionTokens,
 	}
+	if geminiResponse.UsageMetadata != nil && geminiResponse.UsageMetadata.PromptTokenCount != 0 {
+		usage = *geminiResponse.UsageMetadata.toUsage()
+	}
 	fullTextResponse.Usage = usage
 	jsonResponse, err := json.Marshal(fullTextResponse)
 	if err != nil {
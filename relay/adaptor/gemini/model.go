@@ -5,6 +5,25 @@ type ChatRequest struct {
 	SafetySettings   []ChatSafetySettings `json:"safety_settings,omitempty"`
 	GenerationConfig ChatGenerationConfig `json:"generation_config,omitempty"`
 	Tools            []ChatTools          `json:"tools,omitempty"`
+	CachedContent    string               `json:"cachedContent,omitempty"`
+}
+
+// CachedContent is a context cache, https://ai.google.dev/api/caching
+type CachedContent struct {
+	Name          string         `json:"name,omitempty"`
+	Model         string         `json:"model,omitempty"`
+	Contents      []ChatContent  `json:"contents,omitempty"`
+	Tools         []ChatTools    `json:"tools,omitempty"`
+	TTL           string         `json:"ttl,omitempty"`
+	UsageMetadata *UsageMetadata `json:"usageMetadata,omitempty"`
+	Error         *Error         `json:"error,omitempty"`
+}
+
+type UsageMetadata struct {
+	PromptTokenCount        int `json:"promptTokenCount"`
+	CandidatesTokenCount    int `json:"candidatesTokenCount"`
+	CachedContentTokenCount int `json:"cachedContentTokenCount"`
+	TotalTokenCount         int `json:"totalTokenCount"`
 }
 
 type EmbeddingRequest struct {
@@ -65,10 +84,15 @@ type ChatTools struct {
 }
 
 type ChatGenerationConfig struct {
-	Temperature     float64  `json:"temperature,omitempty"`
-	TopP            float64  `json:"topP,omitempty"`
-	TopK            float64  `json:"topK,omitempty"`
-	MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
-	CandidateCount  int      `json:"candidateCount,omitempty"`
-	StopSequences   []string `json:"stopSequences,omitempty"`
+	Temperature      float64  `json:"temperature,omitempty"`
+	TopP             float64  `json:"topP,omitempty"`
+	TopK             float64  `json:"topK,omitempty"`
+	MaxOutputTokens  int      `json:"maxOutputTokens,omitempty"`
+	CandidateCount   int      `json:"candidateCount,omitempty"`
+	StopSequences    []string `json:"stopSequences,omitempty"`
+	ResponseMimeType string   `json:"responseMimeType,omitempty"`
+	ResponseSchema   any      `json:"responseSchema,omitempty"`
+
+	// ["TEXT", "IMAGE"] for the models generating images
+	ResponseModalities []string `json:"responseModalities,omitempty"`
 }
@@ -9,4 +9,7 @@ var ModelList = []string{
 	"mixtral-8x7b-32768",
 	"llama3-8b-8192",
 	"llama3-70b-8192",
+	"llama-3.1-8b-instant",
+	"llama-3.3-70b-versatile",
+	"gemma2-9b-it",
 }
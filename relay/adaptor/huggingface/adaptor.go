@@ -0,0 +1,100 @@
+package huggingface
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// the serverless inference api serves many models, an inference endpoint or a TGI server only the one it's deployed with
+const serverlessBaseURL = "https://api-inference.huggingface.co"
+
+type Adaptor struct {
+}
+
+func (a *Adaptor) Init(meta *meta.Meta) {
+
+}
+
+func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
+	baseURL := meta.BaseURL
+	if strings.HasPrefix(baseURL, serverlessBaseURL) {
+		baseURL = fmt.Sprintf("%s/models/%s", baseURL, meta.ActualModelName)
+	}
+	switch meta.Mode {
+	case relaymode.ChatCompletions:
+		return fmt.Sprintf("%s/v1/chat/completions", baseURL), nil
+	case relaymode.Completions:
+		if meta.IsStream {
+			return fmt.Sprintf("%s/generate_stream", baseURL), nil
+		}
+		return fmt.Sprintf("%s/generate", baseURL), nil
+	}
+	return "", fmt.Errorf("unsupported relay mode %d for huggingface", meta.Mode)
+}
+
+func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *meta.Meta) error {
+	adaptor.SetupCommonRequestHeader(c, req, meta)
+	adaptor.SetupAuthHeader(req, meta.APIKey, meta.Config)
+	return nil
+}
+
+func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.GeneralOpenAIRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	if relayMode == relaymode.Completions {
+		return ConvertCompletionsRequest(*request), nil
+	}
+	return request, nil
+}
+
+func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Reader) (*http.Response, error) {
+	resp, err := adaptor.DoRequestHelper(a, c, meta, requestBody)
+	if err == nil && resp.StatusCode != http.StatusOK {
+		rewriteError(resp)
+	}
+	return resp, err
+}
+
+func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	if meta.Mode == relaymode.Completions {
+		if meta.IsStream {
+			err, usage = CompletionsStreamHandler(c, resp, meta.PromptTokens, meta.ActualModelName)
+		} else {
+			err, usage = CompletionsHandler(c, resp, meta.PromptTokens, meta.ActualModelName)
+		}
+		return
+	}
+	if meta.IsStream {
+		var responseText string
+		err, responseText, usage = openai.StreamHandler(c, resp, meta.Mode)
+		if usage == nil || usage.TotalTokens == 0 {
+			usage = openai.ResponseText2Usage(responseText, meta.ActualModelName, meta.PromptTokens)
+		}
+	} else {
+		err, usage = openai.Handler(c, resp, meta.PromptTokens, meta.ActualModelName)
+	}
+	return
+}
+
+func (a *Adaptor) GetModelList() []string {
+	return ModelList
+}
+
+func (a *Adaptor) GetChannelName() string {
+	return "huggingface"
+}
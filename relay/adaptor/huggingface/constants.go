@@ -0,0 +1,12 @@
+package huggingface
+
+// the models of the serverless inference api, an inference endpoint serves the one it's deployed with
+
+var ModelList = []string{
+	"meta-llama/Meta-Llama-3.1-8B-Instruct",
+	"meta-llama/Meta-Llama-3.1-70B-Instruct",
+	"mistralai/Mistral-7B-Instruct-v0.3",
+	"mistralai/Mixtral-8x7B-Instruct-v0.1",
+	"Qwen/Qwen2.5-72B-Instruct",
+	"HuggingFaceH4/zephyr-7b-beta",
+}
@@ -0,0 +1,187 @@
+package huggingface
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/render"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/constant/finishreason"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// the chat completions are sent to the messages api of TGI, which applies the chat template of the model,
+// only the completions are translated to the generate api
+
+func ConvertCompletionsRequest(request model.GeneralOpenAIRequest) *GenerateRequest {
+	prompt, _ := request.Prompt.(string)
+	generateRequest := GenerateRequest{
+		Inputs: prompt,
+		Parameters: Parameters{
+			MaxNewTokens:     request.MaxTokens,
+			Temperature:      request.Temperature,
+			TopK:             request.TopK,
+			Seed:             request.Seed,
+			Stop:             request.ParseStop(),
+			FrequencyPenalty: request.FrequencyPenalty,
+			Details:          true,
+		},
+	}
+	// TGI only takes top_p in (0, 1)
+	if request.TopP < 1 {
+		generateRequest.Parameters.TopP = request.TopP
+	}
+	return &generateRequest
+}
+
+func toFinishReason(reason string) string {
+	switch reason {
+	case "length":
+		return "length"
+	default:
+		// eos_token and stop_sequence
+		return finishreason.Stop
+	}
+}
+
+// rewriteError turns the error of TGI into the one of OpenAI, so that it's understood by the error handler of the relay
+func rewriteError(resp *http.Response) {
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		resp.Body = io.NopCloser(bytes.NewReader(nil))
+		return
+	}
+	var tgiError Error
+	if json.Unmarshal(body, &tgiError) == nil && tgiError.Error != "" {
+		openaiError := struct {
+			Error model.Error `json:"error"`
+		}{model.Error{Message: tgiError.Error, Type: tgiError.ErrorType}}
+		if rewritten, err := json.Marshal(openaiError); err == nil {
+			body = rewritten
+			resp.Header.Del("Content-Length")
+		}
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+}
+
+func CompletionsStreamHandler(c *gin.Context, resp *http.Response, promptTokens int, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Split(bufio.ScanLines)
+
+	common.SetEventStreamHeaders(c)
+	id := helper.GetResponseID(c)
+	created := helper.GetTimestamp()
+	var responseText string
+	completionTokens := 0
+
+	for scanner.Scan() {
+		data := scanner.Text()
+		if !strings.HasPrefix(data, "data:") {
+			continue
+		}
+		data = strings.TrimSpace(strings.TrimPrefix(data, "data:"))
+
+		var tgiResponse StreamResponse
+		err := json.Unmarshal([]byte(data), &tgiResponse)
+		if err != nil {
+			logger.SysError("error unmarshalling stream response: " + err.Error())
+			continue
+		}
+		if tgiResponse.Error != "" {
+			// the stream has started, an error can only be told to the client in the stream
+			logger.SysError(fmt.Sprintf("error of the stream of huggingface: %s (%s)", tgiResponse.Error, tgiResponse.ErrorType))
+			break
+		}
+		var choice CompletionsChoice
+		if !tgiResponse.Token.Special {
+			choice.Text = tgiResponse.Token.Text
+			responseText += tgiResponse.Token.Text
+		}
+		if tgiResponse.Details != nil {
+			// only the last token has the details
+			finishReason := toFinishReason(tgiResponse.Details.FinishReason)
+			choice.FinishReason = &finishReason
+			completionTokens = tgiResponse.Details.GeneratedTokens
+		}
+		err = render.ObjectData(c, CompletionsResponse{
+			Id:      id,
+			Object:  "text_completion",
+			Created: created,
+			Model:   modelName,
+			Choices: []CompletionsChoice{choice},
+		})
+		if err != nil {
+			logger.SysError(err.Error())
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		logger.SysError("error reading stream: " + err.Error())
+	}
+	render.Done(c)
+
+	err := resp.Body.Close()
+	if err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	if completionTokens == 0 {
+		return nil, openai.ResponseText2Usage(responseText, modelName, promptTokens)
+	}
+	return nil, &model.Usage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		TotalTokens:      promptTokens + completionTokens,
+	}
+}
+
+func CompletionsHandler(c *gin.Context, resp *http.Response, promptTokens int, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	// the generate api returns a list if the inputs are a list, which are never sent
+	var tgiResponse GenerateResponse
+	err = json.Unmarshal(responseBody, &tgiResponse)
+	if err != nil {
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	finishReason := finishreason.Stop
+	usage := openai.ResponseText2Usage(tgiResponse.GeneratedText, modelName, promptTokens)
+	if tgiResponse.Details != nil {
+		finishReason = toFinishReason(tgiResponse.Details.FinishReason)
+		if tgiResponse.Details.GeneratedTokens > 0 {
+			usage.CompletionTokens = tgiResponse.Details.GeneratedTokens
+			usage.TotalTokens = promptTokens + usage.CompletionTokens
+		}
+	}
+	jsonResponse, err := json.Marshal(CompletionsResponse{
+		Id:      helper.GetResponseID(c),
+		Object:  "text_completion",
+		Created: helper.GetTimestamp(),
+		Model:   modelName,
+		Choices: []CompletionsChoice{{Text: tgiResponse.GeneratedText, FinishReason: &finishReason}},
+		Usage:   usage,
+	})
+	if err != nil {
+		return openai.ErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(jsonResponse)
+	return nil, usage
+}
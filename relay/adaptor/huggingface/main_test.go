@@ -0,0 +1,48 @@
+package huggingface
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestCompletionsStreamHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("CompletionsStreamHandler", t, func() {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/completions", nil)
+		resp := &http.Response{
+			StatusCode: http.StatusOK,
+			Body: io.NopCloser(strings.NewReader("data:{\"token\":{\"id\":1,\"text\":\"Hel\",\"special\":false},\"generated_text\":null,\"details\":null}\n\n" +
+				"data:{\"token\":{\"id\":2,\"text\":\"lo\",\"special\":false},\"generated_text\":null,\"details\":null}\n\n" +
+				"data:{\"token\":{\"id\":3,\"text\":\"</s>\",\"special\":true},\"generated_text\":\"Hello\",\"details\":{\"finish_reason\":\"eos_token\",\"generated_tokens\":3}}\n\n")),
+		}
+		err, usage := CompletionsStreamHandler(c, resp, 2, "HuggingFaceH4/zephyr-7b-beta")
+		So(err, ShouldBeNil)
+		So(usage.CompletionTokens, ShouldEqual, 3)
+		So(usage.TotalTokens, ShouldEqual, 5)
+		body := w.Body.String()
+		So(body, ShouldContainSubstring, `"text":"Hel"`)
+		So(body, ShouldNotContainSubstring, `</s>`)
+		So(body, ShouldContainSubstring, `"finish_reason":"stop"`)
+		So(strings.HasSuffix(strings.TrimSpace(body), "data: [DONE]"), ShouldBeTrue)
+	})
+}
+
+func TestConvertCompletionsRequest(t *testing.T) {
+	Convey("ConvertCompletionsRequest", t, func() {
+		request := ConvertCompletionsRequest(model.GeneralOpenAIRequest{Prompt: "hi", MaxTokens: 16, TopP: 1, Stop: []any{"\n"}})
+		So(request.Inputs, ShouldEqual, "hi")
+		So(request.Parameters.MaxNewTokens, ShouldEqual, 16)
+		So(request.Parameters.TopP, ShouldEqual, 0)
+		So(request.Parameters.Stop, ShouldResemble, []string{"\n"})
+		So(request.Parameters.Details, ShouldBeTrue)
+	})
+}
@@ -0,0 +1,69 @@
+package huggingface
+
+import "github.com/songquanpeng/one-api/relay/model"
+
+// https://huggingface.github.io/text-generation-inference/
+
+type Parameters struct {
+	MaxNewTokens     int      `json:"max_new_tokens,omitempty"`
+	Temperature      float64  `json:"temperature,omitempty"`
+	TopP             float64  `json:"top_p,omitempty"`
+	TopK             int      `json:"top_k,omitempty"`
+	Seed             float64  `json:"seed,omitempty"`
+	Stop             []string `json:"stop,omitempty"`
+	FrequencyPenalty float64  `json:"frequency_penalty,omitempty"`
+	Details          bool     `json:"details"`
+	ReturnFullText   bool     `json:"return_full_text"`
+}
+
+type GenerateRequest struct {
+	Inputs     string     `json:"inputs"`
+	Parameters Parameters `json:"parameters"`
+}
+
+type Details struct {
+	FinishReason    string `json:"finish_reason"`
+	GeneratedTokens int    `json:"generated_tokens"`
+}
+
+type GenerateResponse struct {
+	GeneratedText string   `json:"generated_text"`
+	Details       *Details `json:"details"`
+}
+
+type Token struct {
+	Id      int     `json:"id"`
+	Text    string  `json:"text"`
+	Logprob float64 `json:"logprob"`
+	Special bool    `json:"special"`
+}
+
+type StreamResponse struct {
+	Token         Token    `json:"token"`
+	GeneratedText *string  `json:"generated_text"`
+	Details       *Details `json:"details"`
+	Error         string   `json:"error"`
+	ErrorType     string   `json:"error_type"`
+}
+
+type Error struct {
+	Error     string `json:"error"`
+	ErrorType string `json:"error_type"`
+}
+
+type CompletionsChoice struct {
+	Index        int     `json:"index"`
+	Text         string  `json:"text"`
+	FinishReason *string `json:"finish_reason"`
+	Logprobs     any     `json:"logprobs"`
+}
+
+// CompletionsResponse is the response of the completions of OpenAI, also used for the chunks of the stream
+type CompletionsResponse struct {
+	Id      string              `json:"id"`
+	Object  string              `json:"object"`
+	Created int64               `json:"created"`
+	Model   string              `json:"model"`
+	Choices []CompletionsChoice `json:"choices"`
+	Usage   *model.Usage        `json:"usage,omitempty"`
+}
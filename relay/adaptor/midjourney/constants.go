@@ -0,0 +1,45 @@
+package midjourney
+
+import "strings"
+
+// the actions of midjourney-proxy, https://github.com/novicezk/midjourney-proxy
+const (
+	ActionImagine   = "IMAGINE"
+	ActionUpscale   = "UPSCALE"
+	ActionVariation = "VARIATION"
+	ActionReroll    = "REROLL"
+)
+
+const (
+	StatusNotStart   = "NOT_START"
+	StatusSubmitted  = "SUBMITTED"
+	StatusInProgress = "IN_PROGRESS"
+	StatusFailure    = "FAILURE"
+	StatusSuccess    = "SUCCESS"
+)
+
+// the codes of the submit responses
+const (
+	CodeSuccess         = 1
+	CodeNotFound        = 3
+	CodeValidationError = 4
+	CodeFailure         = 9
+	CodeExisted         = 21
+	CodeInQueue         = 22
+)
+
+// each action is billed per image as a model
+var ModelList = []string{
+	"mj_imagine",
+	"mj_upscale",
+	"mj_variation",
+	"mj_reroll",
+}
+
+func ModelOf(action string) string {
+	return "mj_" + strings.ToLower(action)
+}
+
+func IsFinished(status string) bool {
+	return status == StatusSuccess || status == StatusFailure
+}
@@ -0,0 +1,63 @@
+package midjourney
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/songquanpeng/one-api/common/client"
+)
+
+// ConvertSubmitRequest drops the notify hook of the client, the proxy would call any url it's given,
+// the tasks are polled instead
+func ConvertSubmitRequest(requestBody []byte) ([]byte, error) {
+	var request map[string]any
+	err := json.Unmarshal(requestBody, &request)
+	if err != nil {
+		return nil, err
+	}
+	delete(request, "notifyHook")
+	return json.Marshal(request)
+}
+
+// ErrorCode is the code of the submit response for a failed request of the status
+func ErrorCode(statusCode int) int {
+	switch {
+	case statusCode == http.StatusNotFound:
+		return CodeNotFound
+	case statusCode >= 400 && statusCode < 500:
+		return CodeValidationError
+	default:
+		return CodeFailure
+	}
+}
+
+// FetchTasks gets the tasks of the ids from the proxy at once
+func FetchTasks(ctx context.Context, baseURL string, key string, ids []string) ([]Task, error) {
+	jsonStr, err := json.Marshal(ListByConditionRequest{Ids: ids})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/mj/task/list-by-condition", bytes.NewReader(jsonStr))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("mj-api-secret", key)
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad response status code %d", resp.StatusCode)
+	}
+	var tasks []Task
+	err = json.NewDecoder(resp.Body).Decode(&tasks)
+	if err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
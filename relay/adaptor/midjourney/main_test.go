@@ -0,0 +1,41 @@
+package midjourney
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConvertSubmitRequest(t *testing.T) {
+	Convey("ConvertSubmitRequest", t, func() {
+		requestBody, err := ConvertSubmitRequest([]byte(`{"prompt":"a cat","base64Array":[],"notifyHook":"http://localhost/hook","state":"1"}`))
+		So(err, ShouldBeNil)
+		var request map[string]any
+		So(json.Unmarshal(requestBody, &request), ShouldBeNil)
+		So(request, ShouldNotContainKey, "notifyHook")
+		So(request["prompt"], ShouldEqual, "a cat")
+		So(request, ShouldContainKey, "base64Array")
+
+		_, err = ConvertSubmitRequest([]byte(`not json`))
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestModelOf(t *testing.T) {
+	Convey("ModelOf", t, func() {
+		So(ModelOf(ActionImagine), ShouldEqual, "mj_imagine")
+		So(ModelOf(ActionUpscale), ShouldEqual, "mj_upscale")
+		So(ModelList, ShouldContain, ModelOf(ActionVariation))
+		So(ModelList, ShouldContain, ModelOf(ActionReroll))
+	})
+}
+
+func TestErrorCode(t *testing.T) {
+	Convey("ErrorCode", t, func() {
+		So(ErrorCode(http.StatusNotFound), ShouldEqual, CodeNotFound)
+		So(ErrorCode(http.StatusForbidden), ShouldEqual, CodeValidationError)
+		So(ErrorCode(http.StatusInternalServerError), ShouldEqual, CodeFailure)
+	})
+}
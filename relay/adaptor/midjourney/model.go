@@ -0,0 +1,37 @@
+package midjourney
+
+// SubmitRequest has the fields read by one-api, the request is relayed with the others as well
+type SubmitRequest struct {
+	Prompt string `json:"prompt,omitempty"`
+	TaskId string `json:"taskId,omitempty"`
+	Action string `json:"action,omitempty"`
+	Index  int    `json:"index,omitempty"`
+	State  string `json:"state,omitempty"`
+}
+
+type SubmitResponse struct {
+	Code        int            `json:"code"`
+	Description string         `json:"description"`
+	Result      string         `json:"result,omitempty"` // the id of the task
+	Properties  map[string]any `json:"properties,omitempty"`
+}
+
+type Task struct {
+	Id          string `json:"id"`
+	Action      string `json:"action"`
+	Prompt      string `json:"prompt"`
+	PromptEn    string `json:"promptEn"`
+	Description string `json:"description"`
+	State       string `json:"state"`
+	SubmitTime  int64  `json:"submitTime"` // in milliseconds
+	StartTime   int64  `json:"startTime"`
+	FinishTime  int64  `json:"finishTime"`
+	ImageUrl    string `json:"imageUrl"`
+	Status      string `json:"status"`
+	Progress    string `json:"progress"`
+	FailReason  string `json:"failReason"`
+}
+
+type ListByConditionRequest struct {
+	Ids []string `json:"ids"`
+}
@@ -4,4 +4,7 @@ var ModelList = []string{
 	"moonshot-v1-8k",
 	"moonshot-v1-32k",
 	"moonshot-v1-128k",
+	"moonshot-v1-8k-vision-preview",
+	"moonshot-v1-32k-vision-preview",
+	"moonshot-v1-128k-vision-preview",
 }
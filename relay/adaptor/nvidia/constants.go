@@ -0,0 +1,15 @@
+package nvidia
+
+// https://build.nvidia.com/models, a self-hosted NIM serves the models it's deployed with under the same names
+
+var ModelList = []string{
+	"nvidia/llama-3.1-nemotron-70b-instruct",
+	"nvidia/llama-3.1-nemotron-nano-8b-v1",
+	"nvidia/llama-3.3-nemotron-super-49b-v1",
+	"nvidia/llama-3.1-nemotron-ultra-253b-v1",
+	"nvidia/nemotron-4-340b-instruct",
+	"meta/llama-3.1-8b-instruct",
+	"meta/llama-3.1-70b-instruct",
+	"meta/llama-3.1-405b-instruct",
+	"meta/llama-3.3-70b-instruct",
+}
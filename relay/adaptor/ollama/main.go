@@ -1,12 +1,8 @@
 package ollama
 
 import (
-	"bufio"
-	"context"
 	"encoding/json"
 	"fmt"
-	"github.com/songquanpeng/one-api/common/render"
-	"io"
 	"net/http"
 	"strings"
 
@@ -14,11 +10,11 @@ import (
 	"github.com/songquanpeng/one-api/common/random"
 
 	"github.com/gin-gonic/gin"
-	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/image"
-	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/adaptor"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/relay/constant"
+	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
 )
 
@@ -56,6 +52,18 @@ func ConvertRequest(request model.GeneralOpenAIRequest) *ChatRequest {
 	return &ollamaRequest
 }
 
+func errorWrapper(message string, statusCode int) *model.ErrorWithStatusCode {
+	return &model.ErrorWithStatusCode{
+		Error: model.Error{
+			Message: message,
+			Type:    "ollama_error",
+			Param:   "",
+			Code:    "ollama_error",
+		},
+		StatusCode: statusCode,
+	}
+}
+
 func responseOllama2OpenAI(response *ChatResponse) *openai.TextResponse {
 	choice := openai.TextResponseChoice{
 		Index: 0,
@@ -89,8 +97,8 @@ func streamResponseOllama2OpenAI(ollamaResponse *ChatResponse) *openai.ChatCompl
 	if ollamaResponse.Done {
 		choice.FinishReason = &constant.StopFinishReason
 	}
+	// the id is the same for all the chunks, it's set by openai.DoProviderResponse
 	response := openai.ChatCompletionsStreamResponse{
-		Id:      fmt.Sprintf("chatcmpl-%s", random.GetUUID()),
 		Object:  "chat.completion.chunk",
 		Created: helper.GetTimestamp(),
 		Model:   ollamaResponse.Model,
@@ -99,62 +107,6 @@ func streamResponseOllama2OpenAI(ollamaResponse *ChatResponse) *openai.ChatCompl
 	return &response
 }
 
-func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.Usage) {
-	var usage model.Usage
-	scanner := bufio.NewScanner(resp.Body)
-	scanner.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
-		if atEOF && len(data) == 0 {
-			return 0, nil, nil
-		}
-		if i := strings.Index(string(data), "}\n"); i >= 0 {
-			return i + 2, data[0 : i+1], nil
-		}
-		if atEOF {
-			return len(data), data, nil
-		}
-		return 0, nil, nil
-	})
-
-	common.SetEventStreamHeaders(c)
-
-	for scanner.Scan() {
-		data := strings.TrimPrefix(scanner.Text(), "}")
-		data = data + "}"
-
-		var ollamaResponse ChatResponse
-		err := json.Unmarshal([]byte(data), &ollamaResponse)
-		if err != nil {
-			logger.SysError("error unmarshalling stream response: " + err.Error())
-			continue
-		}
-
-		if ollamaResponse.EvalCount != 0 {
-			usage.PromptTokens = ollamaResponse.PromptEvalCount
-			usage.CompletionTokens = ollamaResponse.EvalCount
-			usage.TotalTokens = ollamaResponse.PromptEvalCount + ollamaResponse.EvalCount
-		}
-
-		response := streamResponseOllama2OpenAI(&ollamaResponse)
-		err = render.ObjectData(c, response)
-		if err != nil {
-			logger.SysError(err.Error())
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		logger.SysError("error reading stream: " + err.Error())
-	}
-
-	render.Done(c)
-
-	err := resp.Body.Close()
-	if err != nil {
-		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
-	}
-
-	return nil, &usage
-}
-
 func ConvertEmbeddingRequest(request model.GeneralOpenAIRequest) *EmbeddingRequest {
 	return &EmbeddingRequest{
 		Model:  request.Model,
@@ -175,15 +127,7 @@ func EmbeddingHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStat
 	}
 
 	if ollamaResponse.Error != "" {
-		return &model.ErrorWithStatusCode{
-			Error: model.Error{
-				Message: ollamaResponse.Error,
-				Type:    "ollama_error",
-				Param:   "",
-				Code:    "ollama_error",
-			},
-			StatusCode: resp.StatusCode,
-		}, nil
+		return errorWrapper(ollamaResponse.Error, resp.StatusCode), nil
 	}
 
 	fullTextResponse := embeddingResponseOllama2OpenAI(&ollamaResponse)
@@ -213,40 +157,42 @@ func embeddingResponseOllama2OpenAI(response *EmbeddingResponse) *openai.Embeddi
 	return &openAIEmbeddingResponse
 }
 
-func Handler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.Usage) {
-	ctx := context.TODO()
+// ParseResponse implements adaptor.ProviderAdapter.
+func (a *Adaptor) ParseResponse(meta *meta.Meta, body []byte) (*openai.TextResponse, *model.ErrorWithStatusCode) {
 	var ollamaResponse ChatResponse
-	responseBody, err := io.ReadAll(resp.Body)
+	err := json.Unmarshal(body, &ollamaResponse)
 	if err != nil {
-		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+		return nil, openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
 	}
-	logger.Debugf(ctx, "ollama response: %s", string(responseBody))
-	err = resp.Body.Close()
-	if err != nil {
-		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	if ollamaResponse.Error != "" {
+		return nil, errorWrapper(ollamaResponse.Error, http.StatusInternalServerError)
 	}
-	err = json.Unmarshal(responseBody, &ollamaResponse)
+	return responseOllama2OpenAI(&ollamaResponse), nil
+}
+
+// ParseStreamChunk implements adaptor.ProviderAdapter, the stream of ollama is a JSON object per line.
+func (a *Adaptor) ParseStreamChunk(meta *meta.Meta, data string) (*openai.ChatCompletionsStreamResponse, error) {
+	var ollamaResponse ChatResponse
+	err := json.Unmarshal([]byte(data), &ollamaResponse)
 	if err != nil {
-		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+		return nil, err
 	}
 	if ollamaResponse.Error != "" {
-		return &model.ErrorWithStatusCode{
-			Error: model.Error{
-				Message: ollamaResponse.Error,
-				Type:    "ollama_error",
-				Param:   "",
-				Code:    "ollama_error",
-			},
-			StatusCode: resp.StatusCode,
-		}, nil
-	}
-	fullTextResponse := responseOllama2OpenAI(&ollamaResponse)
-	jsonResponse, err := json.Marshal(fullTextResponse)
-	if err != nil {
-		return openai.ErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+		return nil, &adaptor.StreamError{Err: errorWrapper(ollamaResponse.Error, http.StatusInternalServerError)}
+	}
+	return streamResponseOllama2OpenAI(&ollamaResponse), nil
+}
+
+// ExtractUsage implements adaptor.ProviderAdapter, the usage of a stream comes with the last line.
+func (a *Adaptor) ExtractUsage(data []byte) *model.Usage {
+	var ollamaResponse ChatResponse
+	_ = json.Unmarshal(data, &ollamaResponse)
+	if ollamaResponse.EvalCount == 0 {
+		return nil
+	}
+	return &model.Usage{
+		PromptTokens:     ollamaResponse.PromptEvalCount,
+		CompletionTokens: ollamaResponse.EvalCount,
+		TotalTokens:      ollamaResponse.PromptEvalCount + ollamaResponse.EvalCount,
 	}
-	c.Writer.Header().Set("Content-Type", "application/json")
-	c.Writer.WriteHeader(resp.StatusCode)
-	_, err = c.Writer.Write(jsonResponse)
-	return nil, &fullTextResponse.Usage
 }
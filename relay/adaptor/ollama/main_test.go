@@ -0,0 +1,36 @@
+package ollama
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestDoResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("DoResponse", t, func() {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		resp := &http.Response{
+			StatusCode: http.StatusOK,
+			Body: io.NopCloser(strings.NewReader("{\"model\":\"llama3\",\"message\":{\"role\":\"assistant\",\"content\":\"Hel\"}}\n" +
+				"{\"model\":\"llama3\",\"message\":{\"role\":\"assistant\",\"content\":\"lo\"}}\n" +
+				"{\"model\":\"llama3\",\"message\":{\"role\":\"assistant\",\"content\":\"\"},\"done\":true,\"prompt_eval_count\":3,\"eval_count\":2}\n")),
+		}
+		usage, err := (&Adaptor{}).DoResponse(c, resp, &meta.Meta{IsStream: true, PromptTokens: 1, ActualModelName: "llama3"})
+		So(err, ShouldBeNil)
+		So(*usage, ShouldResemble, model.Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5})
+		body := w.Body.String()
+		So(strings.Count(body, `"id":"chatcmpl-"`), ShouldEqual, 3)
+		So(body, ShouldContainSubstring, `"finish_reason":"stop"`)
+		So(strings.HasSuffix(strings.TrimSpace(body), "data: [DONE]"), ShouldBeTrue)
+	})
+}
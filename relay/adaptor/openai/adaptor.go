@@ -4,9 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/cerebras"
 	"github.com/songquanpeng/one-api/relay/adaptor/doubao"
 	"github.com/songquanpeng/one-api/relay/adaptor/minimax"
+	"github.com/songquanpeng/one-api/relay/adaptor/perplexity"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
@@ -30,7 +33,11 @@ func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 		if meta.Mode == relaymode.ImagesGenerations {
 			// https://learn.microsoft.com/en-us/azure/ai-services/openai/dall-e-quickstart?tabs=dalle3%2Ccommand-line&pivots=rest-api
 			// https://{resource_name}.openai.azure.com/openai/deployments/dall-e-3/images/generations?api-version=2024-03-01-preview
-			fullRequestURL := fmt.Sprintf("%s/openai/deployments/%s/images/generations?api-version=%s", meta.BaseURL, meta.ActualModelName, meta.Config.APIVersion)
+			deployment := meta.ActualModelName
+			if mapped, ok := meta.Config.DeploymentMapping[meta.ActualModelName]; ok {
+				deployment = mapped
+			}
+			fullRequestURL := fmt.Sprintf("%s/openai/deployments/%s/images/generations?api-version=%s", meta.BaseURL, deployment, meta.Config.APIVersion)
 			return fullRequestURL, nil
 		}
 
@@ -38,8 +45,11 @@ func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 		requestURL := strings.Split(meta.RequestURLPath, "?")[0]
 		requestURL = fmt.Sprintf("%s?api-version=%s", requestURL, meta.Config.APIVersion)
 		task := strings.TrimPrefix(requestURL, "/v1/")
-		model_ := meta.ActualModelName
-		model_ = strings.Replace(model_, ".", "", -1)
+		model_, ok := meta.Config.DeploymentMapping[meta.ActualModelName]
+		if !ok {
+			// deployment names can't contain dots, the default name of a deployment is the model name without them
+			model_ = strings.Replace(meta.ActualModelName, ".", "", -1)
+		}
 		//https://github.com/songquanpeng/one-api/issues/1191
 		// {your endpoint}/openai/deployments/{your azure_model}/chat/completions?api-version={api_version}
 		requestURL = fmt.Sprintf("/openai/deployments/%s/%s", model_, task)
@@ -48,6 +58,8 @@ func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 		return minimax.GetRequestURL(meta)
 	case channeltype.Doubao:
 		return doubao.GetRequestURL(meta)
+	case channeltype.Perplexity:
+		return perplexity.GetRequestURL(meta)
 	default:
 		return GetFullRequestURL(meta.BaseURL, meta.RequestURLPath, meta.ChannelType), nil
 	}
@@ -56,13 +68,26 @@ func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *meta.Meta) error {
 	adaptor.SetupCommonRequestHeader(c, req, meta)
 	if meta.ChannelType == channeltype.Azure {
-		req.Header.Set("api-key", meta.APIKey)
-		return nil
+		return SetupAzureAuthHeader(req, meta.APIKey)
+	}
+	adaptor.SetupAuthHeader(req, meta.APIKey, meta.Config)
+	if meta.ChannelType == channeltype.OneAPI {
+		// the upstream one-api reuses it if ACCEPT_REQUEST_ID is set
+		req.Header.Set(helper.RequestIdKey, c.GetString(helper.RequestIdKey))
+		if conversationId := c.GetString(helper.ConversationIdKey); conversationId != "" {
+			req.Header.Set(helper.ConversationIdKey, conversationId)
+		}
 	}
-	req.Header.Set("Authorization", "Bearer "+meta.APIKey)
 	if meta.ChannelType == channeltype.OpenRouter {
-		req.Header.Set("HTTP-Referer", "https://github.com/songquanpeng/one-api")
-		req.Header.Set("X-Title", "One API")
+		// the app shown on the rankings of OpenRouter, the one of the client if it sends them
+		referer, title := c.Request.Header.Get("HTTP-Referer"), c.Request.Header.Get("X-Title")
+		if referer == "" {
+			referer, title = "https://github.com/songquanpeng/one-api", "One API"
+		}
+		req.Header.Set("HTTP-Referer", referer)
+		if title != "" {
+			req.Header.Set("X-Title", title)
+		}
 	}
 	return nil
 }
@@ -71,6 +96,9 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.G
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
+	if a.ChannelType == channeltype.Cerebras {
+		return cerebras.ConvertRequest(request), nil
+	}
 	return request, nil
 }
 
@@ -86,6 +114,10 @@ func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Read
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	if meta.ChannelType == channeltype.OpenRouter {
+		restoreWriter := stripOpenRouterModelPrefix(c, meta)
+		defer restoreWriter()
+	}
 	if meta.IsStream {
 		var responseText string
 		err, responseText, usage = StreamHandler(c, resp, meta.Mode)
@@ -98,7 +130,7 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Met
 		}
 	} else {
 		switch meta.Mode {
-		case relaymode.ImagesGenerations:
+		case relaymode.ImagesGenerations, relaymode.ImagesEdits, relaymode.ImagesVariations:
 			err, _ = ImageHandler(c, resp)
 		default:
 			err, usage = Handler(c, resp, meta.PromptTokens, meta.ActualModelName)
@@ -0,0 +1,55 @@
+package openai
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+func TestSetupRequestHeaderConversationId(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("the conversation id is passed to an upstream one-api only", t, func() {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		c.Set(helper.ConversationIdKey, "thread-1")
+		for channelType, expected := range map[int]string{channeltype.OneAPI: "thread-1", channeltype.OpenAI: ""} {
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			So((&Adaptor{}).SetupRequestHeader(c, req, &meta.Meta{ChannelType: channelType, APIKey: "sk-test"}), ShouldBeNil)
+			So(req.Header.Get(helper.ConversationIdKey), ShouldEqual, expected)
+		}
+	})
+}
+
+func TestGetRequestURLAzureDeployment(t *testing.T) {
+	Convey("the Azure deployments are named by the deployment mapping of the channel", t, func() {
+		getRequestURL := func(mode int, path string, modelName string) string {
+			requestURL, err := (&Adaptor{}).GetRequestURL(&meta.Meta{
+				ChannelType:     channeltype.Azure,
+				Mode:            mode,
+				BaseURL:         "https://example.openai.azure.com",
+				RequestURLPath:  path,
+				ActualModelName: modelName,
+				Config: model.ChannelConfig{APIVersion: "2024-02-01",
+					DeploymentMapping: map[string]string{"gpt-4o": "prod-gpt4o", "dall-e-3": "prod-dalle"}},
+			})
+			So(err, ShouldBeNil)
+			return requestURL
+		}
+
+		So(getRequestURL(relaymode.ChatCompletions, "/v1/chat/completions", "gpt-4o"), ShouldEqual,
+			"https://example.openai.azure.com/openai/deployments/prod-gpt4o/chat/completions?api-version=2024-02-01")
+		So(getRequestURL(relaymode.ImagesGenerations, "/v1/images/generations", "dall-e-3"), ShouldEqual,
+			"https://example.openai.azure.com/openai/deployments/prod-dalle/images/generations?api-version=2024-02-01")
+		// the unmapped models are deployed under their names without the dots
+		So(getRequestURL(relaymode.ChatCompletions, "/v1/chat/completions?foo=bar", "gpt-3.5-turbo"), ShouldEqual,
+			"https://example.openai.azure.com/openai/deployments/gpt-35-turbo/chat/completions?api-version=2024-02-01")
+	})
+}
@@ -0,0 +1,96 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/songquanpeng/one-api/common/client"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://platform.openai.com/docs/api-reference/assistants
+
+const AssistantsBetaHeader = "assistants=v2"
+
+// AssistantObject has the fields shared by the objects of the Assistants API which the relay keeps track of
+type AssistantObject struct {
+	Id       string            `json:"id"`
+	Object   string            `json:"object"`
+	Deleted  bool              `json:"deleted,omitempty"`
+	ThreadId string            `json:"thread_id,omitempty"`
+	Status   string            `json:"status,omitempty"`
+	Model    string            `json:"model,omitempty"`
+	Usage    *relaymodel.Usage `json:"usage,omitempty"`
+}
+
+type AssistantObjectList struct {
+	Object  string            `json:"object"`
+	Data    []json.RawMessage `json:"data"`
+	FirstId string            `json:"first_id,omitempty"`
+	LastId  string            `json:"last_id,omitempty"`
+	HasMore bool              `json:"has_more"`
+}
+
+func getAssistantsAPI(ctx context.Context, baseURL string, key string, cfg dbmodel.ChannelConfig, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	adaptor.SetupAuthHeader(req, key, cfg)
+	req.Header.Set("OpenAI-Beta", AssistantsBetaHeader)
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bad response status code %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// GetAssistantRun gets the run from the channel to learn whether it's finished
+func GetAssistantRun(ctx context.Context, baseURL string, key string, cfg dbmodel.ChannelConfig, threadId string, runId string) (*AssistantObject, error) {
+	run := AssistantObject{}
+	err := getAssistantsAPI(ctx, baseURL, key, cfg, fmt.Sprintf("/v1/threads/%s/runs/%s", url.PathEscape(threadId), url.PathEscape(runId)), &run)
+	return &run, err
+}
+
+// GetAssistantRunStepsUsage sums the usage of every step of the run, page by page
+func GetAssistantRunStepsUsage(ctx context.Context, baseURL string, key string, cfg dbmodel.ChannelConfig, threadId string, runId string) (*relaymodel.Usage, error) {
+	usage := relaymodel.Usage{}
+	after := ""
+	for {
+		path := fmt.Sprintf("/v1/threads/%s/runs/%s/steps?limit=100&order=asc", url.PathEscape(threadId), url.PathEscape(runId))
+		if after != "" {
+			path += "&after=" + url.QueryEscape(after)
+		}
+		list := AssistantObjectList{}
+		err := getAssistantsAPI(ctx, baseURL, key, cfg, path, &list)
+		if err != nil {
+			return nil, err
+		}
+		for _, data := range list.Data {
+			step := AssistantObject{}
+			err = json.Unmarshal(data, &step)
+			if err != nil {
+				return nil, err
+			}
+			if step.Usage != nil {
+				usage.PromptTokens += step.Usage.PromptTokens
+				usage.CompletionTokens += step.Usage.CompletionTokens
+			}
+		}
+		if !list.HasMore || list.LastId == "" {
+			break
+		}
+		after = list.LastId
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return &usage, nil
+}
@@ -0,0 +1,164 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/credential"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+// https://learn.microsoft.com/en-us/azure/ai-services/openai/how-to/managed-identity
+
+type azureADTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error,omitempty"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+func init() {
+	credential.Register("azure_ad", getAzureADAccessToken)
+}
+
+// isAzureADKey tells whether the key of an Azure channel is a service principal in the format of
+// tenant_id|client_id|client_secret instead of an api key
+func isAzureADKey(apiKey string) bool {
+	return strings.Count(apiKey, "|") == 2
+}
+
+// SetupAzureAuthHeader sets either the api key, or a Microsoft Entra ID access token of the service principal
+func SetupAzureAuthHeader(req *http.Request, apiKey string) error {
+	if !isAzureADKey(apiKey) {
+		req.Header.Set("api-key", apiKey)
+		return nil
+	}
+	accessToken, err := credential.Get("azure_ad", apiKey)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	return nil
+}
+
+func getAzureADAccessToken(apiKey string) (*credential.Token, error) {
+	parts := strings.Split(apiKey, "|")
+	if len(parts) != 3 {
+		return nil, errors.New("invalid azure ad key, should be tenant_id|client_id|client_secret")
+	}
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {parts[1]},
+		"client_secret": {parts[2]},
+		"scope":         {"https://cognitiveservices.azure.com/.default"},
+	}
+	req, err := http.NewRequest("POST", "https://login.microsoftonline.com/"+url.PathEscape(parts[0])+"/oauth2/v2.0/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	res, err := client.ImpatientHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var tokenResponse azureADTokenResponse
+	err = json.NewDecoder(res.Body).Decode(&tokenResponse)
+	if err != nil {
+		return nil, err
+	}
+	if tokenResponse.Error != "" {
+		return nil, errors.New(tokenResponse.Error + ": " + tokenResponse.ErrorDescription)
+	}
+	if tokenResponse.AccessToken == "" {
+		return nil, errors.New("getAzureADAccessToken get empty access token")
+	}
+	return &credential.Token{
+		AccessToken: tokenResponse.AccessToken,
+		ExpiresAt:   time.Now().Add(time.Duration(tokenResponse.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// azure annotates the choices with the results of its content filters, and sends chunks with no choices
+// carrying only the results of the prompt
+// https://learn.microsoft.com/en-us/azure/ai-services/openai/concepts/content-filter
+
+func isAzureFiltered(results any) bool {
+	categories, ok := results.(map[string]any)
+	if !ok {
+		return false
+	}
+	for _, value := range categories {
+		if category, ok := value.(map[string]any); ok && category["filtered"] == true {
+			return true
+		}
+	}
+	return false
+}
+
+// rewriteAzureContentFilter gives content_filter as the finish reason of the choices stopped by the filters
+// without one, and removes the annotations if strip is set. It returns false if nothing is changed.
+func rewriteAzureContentFilter(data []byte, strip bool) ([]byte, bool) {
+	if !bytes.Contains(data, []byte("filter_results")) {
+		return data, false
+	}
+	var response map[string]any
+	if json.Unmarshal(data, &response) != nil {
+		return data, false
+	}
+	changed := false
+	if _, ok := response["prompt_filter_results"]; ok && strip {
+		delete(response, "prompt_filter_results")
+		changed = true
+	}
+	choices, _ := response["choices"].([]any)
+	for _, value := range choices {
+		choice, ok := value.(map[string]any)
+		if !ok {
+			continue
+		}
+		results, ok := choice["content_filter_results"]
+		if !ok {
+			continue
+		}
+		if finishReason, _ := choice["finish_reason"].(string); finishReason == "" && isAzureFiltered(results) {
+			choice["finish_reason"] = "content_filter"
+			changed = true
+		}
+		if strip {
+			delete(choice, "content_filter_results")
+			delete(choice, "content_filter_offsets")
+			changed = true
+		}
+	}
+	if !changed {
+		return data, false
+	}
+	rewritten, err := json.Marshal(response)
+	if err != nil {
+		return data, false
+	}
+	return rewritten, true
+}
+
+// azureContentFilter tells whether the response of the channel has to go through rewriteAzureContentFilter
+func azureContentFilter(c *gin.Context) (isAzure bool, strip bool) {
+	if c.GetInt(ctxkey.Channel) != channeltype.Azure {
+		return false, false
+	}
+	if value, ok := c.Get(ctxkey.Config); ok {
+		strip = value.(dbmodel.ChannelConfig).StripContentFilterResults
+	}
+	return true, strip
+}
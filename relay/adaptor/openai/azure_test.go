@@ -0,0 +1,33 @@
+package openai
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRewriteAzureContentFilter(t *testing.T) {
+	Convey("rewriteAzureContentFilter", t, func() {
+		filtered := `{"id":"1","choices":[{"index":0,"delta":{},"finish_reason":null,"content_filter_results":{"hate":{"filtered":true,"severity":"high"},"violence":{"filtered":false,"severity":"safe"}}}]}`
+
+		Convey("gives the finish reason of a filtered choice", func() {
+			data, ok := rewriteAzureContentFilter([]byte(filtered), false)
+			So(ok, ShouldBeTrue)
+			So(string(data), ShouldContainSubstring, `"finish_reason":"content_filter"`)
+			So(string(data), ShouldContainSubstring, `"content_filter_results"`)
+		})
+
+		Convey("strips the annotations", func() {
+			data, ok := rewriteAzureContentFilter([]byte(`{"id":"1","prompt_filter_results":[],"choices":[{"index":0,"delta":{"content":"hi"},"finish_reason":null,"content_filter_results":{"hate":{"filtered":false}}}]}`), true)
+			So(ok, ShouldBeTrue)
+			So(string(data), ShouldEqual, `{"choices":[{"delta":{"content":"hi"},"finish_reason":null,"index":0}],"id":"1"}`)
+		})
+
+		Convey("leaves the data without annotations as is", func() {
+			data := `{"id":"1","choices":[{"index":0,"delta":{"content":"hi"},"finish_reason":null}]}`
+			rewritten, ok := rewriteAzureContentFilter([]byte(data), true)
+			So(ok, ShouldBeFalse)
+			So(string(rewritten), ShouldEqual, data)
+		})
+	})
+}
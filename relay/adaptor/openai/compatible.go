@@ -3,15 +3,21 @@ package openai
 import (
 	"github.com/songquanpeng/one-api/relay/adaptor/ai360"
 	"github.com/songquanpeng/one-api/relay/adaptor/baichuan"
+	"github.com/songquanpeng/one-api/relay/adaptor/cerebras"
 	"github.com/songquanpeng/one-api/relay/adaptor/deepseek"
 	"github.com/songquanpeng/one-api/relay/adaptor/doubao"
+	"github.com/songquanpeng/one-api/relay/adaptor/fireworks"
 	"github.com/songquanpeng/one-api/relay/adaptor/groq"
 	"github.com/songquanpeng/one-api/relay/adaptor/lingyiwanwu"
 	"github.com/songquanpeng/one-api/relay/adaptor/minimax"
 	"github.com/songquanpeng/one-api/relay/adaptor/mistral"
 	"github.com/songquanpeng/one-api/relay/adaptor/moonshot"
+	"github.com/songquanpeng/one-api/relay/adaptor/nvidia"
+	"github.com/songquanpeng/one-api/relay/adaptor/perplexity"
+	"github.com/songquanpeng/one-api/relay/adaptor/sambanova"
 	"github.com/songquanpeng/one-api/relay/adaptor/stepfun"
 	"github.com/songquanpeng/one-api/relay/adaptor/togetherai"
+	"github.com/songquanpeng/one-api/relay/adaptor/xai"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 )
 
@@ -28,6 +34,13 @@ var CompatibleChannels = []int{
 	channeltype.StepFun,
 	channeltype.DeepSeek,
 	channeltype.TogetherAI,
+	channeltype.Fireworks,
+	channeltype.OneAPI,
+	channeltype.XAI,
+	channeltype.Perplexity,
+	channeltype.NVIDIA,
+	channeltype.Cerebras,
+	channeltype.SambaNova,
 }
 
 func GetCompatibleChannelMeta(channelType int) (string, []string) {
@@ -56,6 +69,20 @@ func GetCompatibleChannelMeta(channelType int) (string, []string) {
 		return "together.ai", togetherai.ModelList
 	case channeltype.Doubao:
 		return "doubao", doubao.ModelList
+	case channeltype.Fireworks:
+		return "fireworks", fireworks.ModelList
+	case channeltype.OneAPI:
+		return "one-api", ModelList
+	case channeltype.XAI:
+		return "xai", xai.ModelList
+	case channeltype.Perplexity:
+		return "perplexity", perplexity.ModelList
+	case channeltype.NVIDIA:
+		return "nvidia", nvidia.ModelList
+	case channeltype.Cerebras:
+		return "cerebras", cerebras.ModelList
+	case channeltype.SambaNova:
+		return "sambanova", sambanova.ModelList
 	default:
 		return "openai", ModelList
 	}
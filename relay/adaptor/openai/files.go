@@ -0,0 +1,63 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/songquanpeng/one-api/common/client"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+)
+
+// https://platform.openai.com/docs/api-reference/files
+
+type FileObject struct {
+	Id        string `json:"id"`
+	Object    string `json:"object"`
+	Bytes     int64  `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose"`
+	Status    string `json:"status,omitempty"`
+	Deleted   bool   `json:"deleted,omitempty"`
+}
+
+type FileObjectList struct {
+	Object  string        `json:"object"`
+	Data    []*FileObject `json:"data"`
+	FirstId string        `json:"first_id,omitempty"`
+	LastId  string        `json:"last_id,omitempty"`
+	HasMore bool          `json:"has_more"`
+}
+
+// DeleteFile deletes the file from the account of the key, a file which is not found is deleted already
+func DeleteFile(ctx context.Context, baseURL string, key string, cfg dbmodel.ChannelConfig, fileId string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, baseURL+"/v1/files/"+url.PathEscape(fileId), nil)
+	if err != nil {
+		return err
+	}
+	adaptor.SetupAuthHeader(req, key, cfg)
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bad response status code %d", resp.StatusCode)
+	}
+	file := FileObject{}
+	err = json.NewDecoder(resp.Body).Decode(&file)
+	if err != nil {
+		return err
+	}
+	if !file.Deleted {
+		return fmt.Errorf("file %s is not deleted", fileId)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/songquanpeng/one-api/common/client"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+)
+
+// https://platform.openai.com/docs/api-reference/fine-tuning
+
+// FineTuningJob has the fields of a fine-tuning job which the relay keeps track of,
+// trained_tokens is null until the job succeeds
+type FineTuningJob struct {
+	Id            string `json:"id"`
+	Object        string `json:"object"`
+	Model         string `json:"model"`
+	Status        string `json:"status"`
+	TrainedTokens *int   `json:"trained_tokens"`
+}
+
+type FineTuningJobList struct {
+	Object  string            `json:"object"`
+	Data    []json.RawMessage `json:"data"`
+	HasMore bool              `json:"has_more"`
+}
+
+// GetFineTuningJob gets the job from the account of the key, along with the body as it's returned
+func GetFineTuningJob(ctx context.Context, baseURL string, key string, cfg dbmodel.ChannelConfig, jobId string) (*FineTuningJob, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/v1/fine_tuning/jobs/"+url.PathEscape(jobId), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	adaptor.SetupAuthHeader(req, key, cfg)
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("bad response status code %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	job := FineTuningJob{}
+	err = json.Unmarshal(body, &job)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &job, body, nil
+}
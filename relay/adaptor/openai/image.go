@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/relay/adaptor"
 	"github.com/songquanpeng/one-api/relay/model"
 	"io"
 	"net/http"
@@ -27,9 +28,7 @@ func ImageHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCo
 
 	resp.Body = io.NopCloser(bytes.NewBuffer(responseBody))
 
-	for k, v := range resp.Header {
-		c.Writer.Header().Set(k, v[0])
-	}
+	adaptor.SetupResponseHeader(c, resp)
 	c.Writer.WriteHeader(resp.StatusCode)
 
 	_, err = io.Copy(c.Writer, resp.Body)
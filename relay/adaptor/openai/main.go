@@ -12,7 +12,9 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/conv"
+	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/adaptor"
 	"github.com/songquanpeng/one-api/relay/model"
 	"github.com/songquanpeng/one-api/relay/relaymode"
 )
@@ -23,11 +25,16 @@ const (
 	dataPrefixLength = len(dataPrefix)
 )
 
+// MaxStreamEventBytes is the size of the longest line of a stream, the images generated are sent in single events
+const MaxStreamEventBytes = 32 * 1024 * 1024
+
 func StreamHandler(c *gin.Context, resp *http.Response, relayMode int) (*model.ErrorWithStatusCode, string, *model.Usage) {
 	responseText := ""
 	scanner := bufio.NewScanner(resp.Body)
 	scanner.Split(bufio.ScanLines)
+	scanner.Buffer(make([]byte, 64*1024), MaxStreamEventBytes)
 	var usage *model.Usage
+	isAzure, stripContentFilter := azureContentFilter(c)
 
 	common.SetEventStreamHeaders(c)
 
@@ -52,16 +59,21 @@ func StreamHandler(c *gin.Context, resp *http.Response, relayMode int) (*model.E
 				render.StringData(c, data) // if error happened, pass the data to client
 				continue                   // just ignore the error
 			}
-			if len(streamResponse.Choices) == 0 {
+			if streamResponse.Usage != nil {
+				usage = streamResponse.Usage
+			}
+			if len(streamResponse.Choices) == 0 && (streamResponse.Usage == nil || c.GetBool(ctxkey.HideUsageChunk)) {
 				// but for empty choice, we should not pass it to client, this is for azure
 				continue // just ignore empty choice
 			}
+			if isAzure {
+				if rewritten, ok := rewriteAzureContentFilter([]byte(data[dataPrefixLength:]), stripContentFilter); ok {
+					data = dataPrefix + string(rewritten)
+				}
+			}
 			render.StringData(c, data)
 			for _, choice := range streamResponse.Choices {
-				responseText += conv.AsString(choice.Delta.Content)
-			}
-			if streamResponse.Usage != nil {
-				usage = streamResponse.Usage
+				responseText += choice.Delta.ReasoningContent + conv.AsString(choice.Delta.Content) + choice.Delta.ToolCallsText()
 			}
 		case relaymode.Completions:
 			render.StringData(c, data)
@@ -111,6 +123,12 @@ func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName st
 			StatusCode: resp.StatusCode,
 		}, nil
 	}
+	if isAzure, strip := azureContentFilter(c); isAzure {
+		if rewritten, ok := rewriteAzureContentFilter(responseBody, strip); ok {
+			responseBody = rewritten
+			resp.Header.Del("Content-Length")
+		}
+	}
 	// Reset response body
 	resp.Body = io.NopCloser(bytes.NewBuffer(responseBody))
 
@@ -118,9 +136,7 @@ func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName st
 	// And then we will have to send an error response, but in this case, the header has already been set.
 	// So the HTTPClient will be confused by the response.
 	// For example, Postman will report error, and we cannot check the response at all.
-	for k, v := range resp.Header {
-		c.Writer.Header().Set(k, v[0])
-	}
+	adaptor.SetupResponseHeader(c, resp)
 	c.Writer.WriteHeader(resp.StatusCode)
 	_, err = io.Copy(c.Writer, resp.Body)
 	if err != nil {
@@ -134,7 +150,7 @@ func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName st
 	if textResponse.Usage.TotalTokens == 0 || (textResponse.Usage.PromptTokens == 0 && textResponse.Usage.CompletionTokens == 0) {
 		completionTokens := 0
 		for _, choice := range textResponse.Choices {
-			completionTokens += CountTokenText(choice.Message.StringContent(), modelName)
+			completionTokens += CountTokenText(choice.Message.ReasoningContent+choice.Message.StringContent()+choice.Message.ToolCallsText(), modelName)
 		}
 		textResponse.Usage = model.Usage{
 			PromptTokens:     promptTokens,
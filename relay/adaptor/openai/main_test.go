@@ -0,0 +1,59 @@
+package openai
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+func TestToolCallsCompletionTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("the tool calls are counted as completion tokens when the usage is missing", t, func() {
+		// the token encoders aren't loaded in the tests
+		oldApproximateTokenEnabled := config.ApproximateTokenEnabled
+		config.ApproximateTokenEnabled = true
+		t.Cleanup(func() {
+			config.ApproximateTokenEnabled = oldApproximateTokenEnabled
+		})
+		toolCallsTokens := CountTokenText(`get_weather{"city":"Paris"}`, "gpt-4o")
+		So(toolCallsTokens, ShouldBeGreaterThan, 0)
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+		Convey("by Handler", func() {
+			resp := &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{},
+				Body: io.NopCloser(strings.NewReader(`{"id":"chatcmpl-1","object":"chat.completion","choices":[{"index":0,` +
+					`"message":{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function",` +
+					`"function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},"finish_reason":"tool_calls"}]}`)),
+			}
+			err, usage := Handler(c, resp, 5, "gpt-4o")
+			So(err, ShouldBeNil)
+			So(usage.PromptTokens, ShouldEqual, 5)
+			So(usage.CompletionTokens, ShouldEqual, toolCallsTokens)
+		})
+
+		Convey("by StreamHandler", func() {
+			resp := &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{},
+				Body: io.NopCloser(strings.NewReader("data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\"," +
+					"\"tool_calls\":[{\"index\":0,\"id\":\"call_1\",\"type\":\"function\",\"function\":{\"name\":\"get_weather\",\"arguments\":\"\"}}]}}]}\n\n" +
+					"data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"{\\\"city\\\":\\\"Paris\\\"}\"}}]}," +
+					"\"finish_reason\":\"tool_calls\"}]}\n\n" +
+					"data: [DONE]\n\n")),
+			}
+			err, responseText, _ := StreamHandler(c, resp, relaymode.ChatCompletions)
+			So(err, ShouldBeNil)
+			So(responseText, ShouldEqual, `get_weather{"city":"Paris"}`)
+		})
+	})
+}
@@ -63,6 +63,15 @@ type Segment struct {
 	NoSpeechProb     float64 `json:"no_speech_prob"`
 }
 
+// TranscriptionRequest is the multipart form of /v1/audio/transcriptions, for the upstreams taking another format
+type TranscriptionRequest struct {
+	Model           string
+	Language        string
+	Prompt          string
+	File            []byte
+	FileContentType string
+}
+
 type TextToSpeechRequest struct {
 	Model          string  `json:"model" binding:"required"`
 	Input          string  `json:"input" binding:"required"`
@@ -82,20 +91,11 @@ type SlimTextResponse struct {
 	Error       model.Error `json:"error"`
 }
 
-type TextResponseChoice struct {
-	Index         int `json:"index"`
-	model.Message `json:"message"`
-	FinishReason  string `json:"finish_reason"`
-}
+type TextResponseChoice = model.TextResponseChoice
 
-type TextResponse struct {
-	Id          string               `json:"id"`
-	Model       string               `json:"model,omitempty"`
-	Object      string               `json:"object"`
-	Created     int64                `json:"created"`
-	Choices     []TextResponseChoice `json:"choices"`
-	model.Usage `json:"usage"`
-}
+type PerplexityExtension = model.PerplexityExtension
+
+type TextResponse = model.TextResponse
 
 type EmbeddingResponseItem struct {
 	Object    string    `json:"object"`
@@ -122,20 +122,9 @@ type ImageResponse struct {
 	//model.Usage `json:"usage"`
 }
 
-type ChatCompletionsStreamResponseChoice struct {
-	Index        int           `json:"index"`
-	Delta        model.Message `json:"delta"`
-	FinishReason *string       `json:"finish_reason,omitempty"`
-}
+type ChatCompletionsStreamResponseChoice = model.ChatCompletionsStreamResponseChoice
 
-type ChatCompletionsStreamResponse struct {
-	Id      string                                `json:"id"`
-	Object  string                                `json:"object"`
-	Created int64                                 `json:"created"`
-	Model   string                                `json:"model"`
-	Choices []ChatCompletionsStreamResponseChoice `json:"choices"`
-	Usage   *model.Usage                          `json:"usage,omitempty"`
-}
+type ChatCompletionsStreamResponse = model.ChatCompletionsStreamResponse
 
 type CompletionsStreamResponse struct {
 	Choices []struct {
@@ -0,0 +1,98 @@
+package openai
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// https://openrouter.ai/models
+var openRouterModelPrefixes = map[string]string{
+	"gpt-":       "openai",
+	"o1-":        "openai",
+	"chatgpt-":   "openai",
+	"claude-":    "anthropic",
+	"gemini-":    "google",
+	"gemma-":     "google",
+	"llama-":     "meta-llama",
+	"mistral-":   "mistralai",
+	"mixtral-":   "mistralai",
+	"codestral-": "mistralai",
+	"deepseek-":  "deepseek",
+	"qwen":       "qwen",
+	"command-":   "cohere",
+}
+
+// OpenRouterModelName prepends the vendor to a model name without one, by the longest matching prefix
+func OpenRouterModelName(name string, prefixes map[string]string) string {
+	if strings.Contains(name, "/") {
+		return name
+	}
+	if len(prefixes) == 0 {
+		prefixes = openRouterModelPrefixes
+	}
+	bestPrefix := ""
+	for prefix := range prefixes {
+		if len(prefix) > len(bestPrefix) && strings.HasPrefix(name, prefix) {
+			bestPrefix = prefix
+		}
+	}
+	vendor := prefixes[bestPrefix]
+	if bestPrefix == "" || vendor == "" {
+		return name
+	}
+	return vendor + "/" + name
+}
+
+// ConvertOpenRouterRequest prefixes the model and asks for the cost, which is then billed instead of the ratios
+func ConvertOpenRouterRequest(request *model.GeneralOpenAIRequest, meta *meta.Meta) {
+	request.Model = OpenRouterModelName(request.Model, meta.Config.ModelPrefixes)
+	if meta.Mode == relaymode.ChatCompletions || meta.Mode == relaymode.Completions {
+		request.Usage = &model.UsageOptions{Include: true}
+	}
+}
+
+// modelNameWriter strips the vendor prefix from the model of the responses, so the client gets the name it asked for
+type modelNameWriter struct {
+	gin.ResponseWriter
+	prefixed []byte
+	origin   []byte
+}
+
+func (w *modelNameWriter) WriteHeader(code int) {
+	// the length of the body changes
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *modelNameWriter) Write(data []byte) (int, error) {
+	_, err := w.ResponseWriter.Write(bytes.ReplaceAll(data, w.prefixed, w.origin))
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (w *modelNameWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func stripOpenRouterModelPrefix(c *gin.Context, meta *meta.Meta) func() {
+	prefixed := OpenRouterModelName(meta.ActualModelName, meta.Config.ModelPrefixes)
+	if prefixed == meta.ActualModelName {
+		return func() {}
+	}
+	writer := &modelNameWriter{
+		ResponseWriter: c.Writer,
+		prefixed:       []byte(`"model":"` + prefixed + `"`),
+		origin:         []byte(`"model":"` + meta.ActualModelName + `"`),
+	}
+	c.Writer = writer
+	return func() {
+		c.Writer = writer.ResponseWriter
+	}
+}
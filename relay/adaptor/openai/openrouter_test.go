@@ -0,0 +1,28 @@
+package openai
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOpenRouterModelName(t *testing.T) {
+	Convey("OpenRouterModelName", t, func() {
+		Convey("uses the built-in rules", func() {
+			So(OpenRouterModelName("claude-3-opus", nil), ShouldEqual, "anthropic/claude-3-opus")
+			So(OpenRouterModelName("gpt-4o", nil), ShouldEqual, "openai/gpt-4o")
+			So(OpenRouterModelName("some-model", nil), ShouldEqual, "some-model")
+		})
+
+		Convey("keeps a model with a vendor", func() {
+			So(OpenRouterModelName("anthropic/claude-3-opus", nil), ShouldEqual, "anthropic/claude-3-opus")
+		})
+
+		Convey("uses the longest configured prefix", func() {
+			prefixes := map[string]string{"llama-": "meta-llama", "llama-3.1-sonar-": "perplexity", "gpt-": ""}
+			So(OpenRouterModelName("llama-3.1-sonar-large-128k-online", prefixes), ShouldEqual, "perplexity/llama-3.1-sonar-large-128k-online")
+			So(OpenRouterModelName("llama-3-70b-instruct", prefixes), ShouldEqual, "meta-llama/llama-3-70b-instruct")
+			So(OpenRouterModelName("gpt-4o", prefixes), ShouldEqual, "gpt-4o")
+		})
+	})
+}
@@ -0,0 +1,182 @@
+package openai
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/conv"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/render"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// DoProviderResponse relays the response of an upstream with the adaptor.ProviderAdapter, the usage is counted
+// from the text if the upstream sends none
+func DoProviderResponse(a adaptor.ProviderAdapter, c *gin.Context, resp *http.Response, meta *meta.Meta) (*model.Usage, *model.ErrorWithStatusCode) {
+	if meta.IsStream {
+		return providerStreamHandler(a, c, resp, meta)
+	}
+	return providerHandler(a, c, resp, meta)
+}
+
+func providerHandler(a adaptor.ProviderAdapter, c *gin.Context, resp *http.Response, meta *meta.Meta) (*model.Usage, *model.ErrorWithStatusCode) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return nil, ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError)
+	}
+	fullTextResponse, bizErr := a.ParseResponse(meta, responseBody)
+	if bizErr != nil {
+		return nil, bizErr
+	}
+	if fullTextResponse.Id == "" {
+		fullTextResponse.Id = helper.GetResponseID(c)
+	}
+	if fullTextResponse.Object == "" {
+		fullTextResponse.Object = "chat.completion"
+	}
+	if fullTextResponse.Created == 0 {
+		fullTextResponse.Created = helper.GetTimestamp()
+	}
+	fullTextResponse.Model = meta.ActualModelName
+	var responseText string
+	for _, choice := range fullTextResponse.Choices {
+		responseText += choice.ReasoningContent + choice.StringContent() + choice.ToolCallsText()
+	}
+	usage := completeUsage(a.ExtractUsage(responseBody), responseText, meta)
+	fullTextResponse.Usage = *usage
+	jsonResponse, err := json.Marshal(fullTextResponse)
+	if err != nil {
+		return nil, ErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError)
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, _ = c.Writer.Write(jsonResponse)
+	return usage, nil
+}
+
+func providerStreamHandler(a adaptor.ProviderAdapter, c *gin.Context, resp *http.Response, meta *meta.Meta) (*model.Usage, *model.ErrorWithStatusCode) {
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Split(bufio.ScanLines)
+	scanner.Buffer(make([]byte, 64*1024), MaxStreamEventBytes)
+
+	id := helper.GetResponseID(c)
+	created := helper.GetTimestamp()
+	var responseText string
+	var usage *model.Usage
+	// the headers are sent with the first chunk, so that an error event before it is relayed as an error
+	started := false
+
+	for scanner.Scan() {
+		data := strings.TrimSpace(scanner.Text())
+		// the names of the events are in the data of the providers sending them
+		if data == "" || strings.HasPrefix(data, ":") || strings.HasPrefix(data, "event:") ||
+			strings.HasPrefix(data, "id:") || strings.HasPrefix(data, "retry:") {
+			continue
+		}
+		data = strings.TrimSpace(strings.TrimPrefix(data, "data:"))
+		if data == done {
+			break
+		}
+		if chunkUsage := a.ExtractUsage([]byte(data)); chunkUsage != nil {
+			usage = mergeUsage(usage, chunkUsage)
+		}
+		response, err := a.ParseStreamChunk(meta, data)
+		var streamErr *adaptor.StreamError
+		if errors.As(err, &streamErr) {
+			if !started {
+				_ = resp.Body.Close()
+				return nil, streamErr.Err
+			}
+			logger.SysError("error event of the stream: " + streamErr.Error())
+			break
+		}
+		if err != nil {
+			logger.SysError("error parsing stream response: " + err.Error())
+			continue
+		}
+		if response == nil {
+			continue
+		}
+		if !started {
+			common.SetEventStreamHeaders(c)
+			started = true
+		}
+		if response.Id == "" {
+			response.Id = id
+		}
+		response.Object = "chat.completion.chunk"
+		if response.Created == 0 {
+			response.Created = created
+		}
+		response.Model = meta.ActualModelName
+		for _, choice := range response.Choices {
+			responseText += choice.Delta.ReasoningContent + conv.AsString(choice.Delta.Content) + choice.Delta.ToolCallsText()
+		}
+		err = render.ObjectData(c, response)
+		if err != nil {
+			logger.SysError(err.Error())
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		logger.SysError("error reading stream: " + err.Error())
+	}
+	if !started {
+		common.SetEventStreamHeaders(c)
+	}
+	render.Done(c)
+
+	err := resp.Body.Close()
+	if err != nil {
+		return nil, ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError)
+	}
+	return completeUsage(usage, responseText, meta), nil
+}
+
+// mergeUsage adds the tokens of a stream event to the usage, the providers sending the prompt tokens
+// at the start of the stream and the completion tokens at the end are covered too
+func mergeUsage(usage *model.Usage, chunkUsage *model.Usage) *model.Usage {
+	if usage == nil {
+		usage = &model.Usage{}
+	}
+	if chunkUsage.PromptTokens != 0 {
+		usage.PromptTokens = chunkUsage.PromptTokens
+	}
+	if chunkUsage.CompletionTokens != 0 {
+		usage.CompletionTokens = chunkUsage.CompletionTokens
+	}
+	if chunkUsage.TotalTokens != 0 {
+		usage.TotalTokens = chunkUsage.TotalTokens
+	}
+	return usage
+}
+
+// completeUsage counts the tokens of the text if the upstream sends no usage, and fills in the totals
+func completeUsage(usage *model.Usage, responseText string, meta *meta.Meta) *model.Usage {
+	if usage == nil || (usage.PromptTokens == 0 && usage.CompletionTokens == 0 && usage.TotalTokens == 0) {
+		return ResponseText2Usage(responseText, meta.ActualModelName, meta.PromptTokens)
+	}
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens = meta.PromptTokens
+	}
+	if usage.CompletionTokens == 0 && usage.TotalTokens > usage.PromptTokens {
+		usage.CompletionTokens = usage.TotalTokens - usage.PromptTokens
+	}
+	if usage.TotalTokens == 0 || usage.TotalTokens < usage.PromptTokens+usage.CompletionTokens {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	return usage
+}
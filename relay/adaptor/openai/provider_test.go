@@ -0,0 +1,44 @@
+package openai
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestProviderUsage(t *testing.T) {
+	Convey("mergeUsage", t, func() {
+		Convey("keeps the prompt tokens of the start of the stream", func() {
+			usage := mergeUsage(nil, &model.Usage{PromptTokens: 10})
+			usage = mergeUsage(usage, &model.Usage{CompletionTokens: 5})
+			So(*usage, ShouldResemble, model.Usage{PromptTokens: 10, CompletionTokens: 5})
+		})
+
+		Convey("takes the latest counts", func() {
+			usage := mergeUsage(nil, &model.Usage{PromptTokens: 10, CompletionTokens: 1})
+			usage = mergeUsage(usage, &model.Usage{PromptTokens: 10, CompletionTokens: 7, TotalTokens: 17})
+			So(*usage, ShouldResemble, model.Usage{PromptTokens: 10, CompletionTokens: 7, TotalTokens: 17})
+		})
+	})
+
+	Convey("completeUsage", t, func() {
+		meta := &meta.Meta{PromptTokens: 8, ActualModelName: "gpt-3.5-turbo"}
+
+		Convey("fills in the total", func() {
+			usage := completeUsage(&model.Usage{PromptTokens: 10, CompletionTokens: 5}, "", meta)
+			So(usage.TotalTokens, ShouldEqual, 15)
+		})
+
+		Convey("uses the prompt tokens counted locally if the upstream sends only the completion tokens", func() {
+			usage := completeUsage(&model.Usage{CompletionTokens: 5}, "", meta)
+			So(*usage, ShouldResemble, model.Usage{PromptTokens: 8, CompletionTokens: 5, TotalTokens: 13})
+		})
+
+		Convey("derives the completion tokens from the total", func() {
+			usage := completeUsage(&model.Usage{TotalTokens: 20}, "", meta)
+			So(*usage, ShouldResemble, model.Usage{PromptTokens: 8, CompletionTokens: 12, TotalTokens: 20})
+		})
+	})
+}
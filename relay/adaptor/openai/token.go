@@ -1,6 +1,7 @@
 package openai
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/pkoukk/tiktoken-go"
@@ -9,6 +10,8 @@ import (
 	"github.com/songquanpeng/one-api/common/logger"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/modelinfo"
+	"github.com/songquanpeng/one-api/relay/tokenizer"
 	"math"
 	"strings"
 )
@@ -63,15 +66,34 @@ func getTokenEncoder(model string) *tiktoken.Tiktoken {
 	return defaultTokenEncoder
 }
 
-func getTokenNum(tokenEncoder *tiktoken.Tiktoken, text string) int {
+type tiktokenTokenizer struct{}
+
+func (tiktokenTokenizer) CountTokens(text string, model string) int {
+	return len(getTokenEncoder(model).Encode(text, nil, nil))
+}
+
+func init() {
+	tokenizer.Register(tokenizer.Tiktoken, tiktokenTokenizer{})
+}
+
+// getTokenizer picks the tokenizer of the model family from the model registry
+func getTokenizer(model string) tokenizer.Tokenizer {
+	t := tokenizer.Get(modelinfo.GetTokenizer(model))
+	if t == nil {
+		return tiktokenTokenizer{}
+	}
+	return t
+}
+
+func getTokenNum(t tokenizer.Tokenizer, model string, text string) int {
 	if config.ApproximateTokenEnabled {
 		return int(float64(len(text)) * 0.38)
 	}
-	return len(tokenEncoder.Encode(text, nil, nil))
+	return t.CountTokens(text, model)
 }
 
 func CountTokenMessages(messages []model.Message, model string) int {
-	tokenEncoder := getTokenEncoder(model)
+	t := getTokenizer(model)
 	// Reference:
 	// https://github.com/openai/openai-cookbook/blob/main/examples/How_to_count_tokens_with_tiktoken.ipynb
 	// https://github.com/pkoukk/tiktoken-go/issues/6
@@ -91,107 +113,205 @@ func CountTokenMessages(messages []model.Message, model string) int {
 		tokenNum += tokensPerMessage
 		switch v := message.Content.(type) {
 		case string:
-			tokenNum += getTokenNum(tokenEncoder, v)
+			tokenNum += getTokenNum(t, model, v)
 		case []any:
 			for _, it := range v {
-				m := it.(map[string]any)
+				m, ok := it.(map[string]any)
+				if !ok {
+					continue
+				}
 				switch m["type"] {
 				case "text":
-					tokenNum += getTokenNum(tokenEncoder, m["text"].(string))
+					if text, ok := m["text"].(string); ok {
+						tokenNum += getTokenNum(t, model, text)
+					}
 				case "image_url":
-					imageUrl, ok := m["image_url"].(map[string]any)
-					if ok {
-						url := imageUrl["url"].(string)
-						detail := ""
-						if imageUrl["detail"] != nil {
-							detail = imageUrl["detail"].(string)
-						}
-						imageTokens, err := countImageTokens(url, detail)
-						if err != nil {
-							logger.SysError("error counting image tokens: " + err.Error())
-						} else {
-							tokenNum += imageTokens
-						}
+					url, detail, ok := getImageURL(m["image_url"])
+					if !ok {
+						continue
 					}
+					imageTokens, err := countImageTokens(url, detail, model)
+					if err != nil {
+						logger.SysError("error counting image tokens: " + err.Error())
+						imageTokens = countImageTokensBySize(fallbackImageSize, fallbackImageSize, detail, model)
+					}
+					tokenNum += imageTokens
 				}
 			}
 		}
-		tokenNum += getTokenNum(tokenEncoder, message.Role)
+		if len(message.ToolCalls) != 0 {
+			// the calls of the previous turns are sent back as the prompt
+			tokenNum += getTokenNum(t, model, message.ToolCallsText()) + len(message.ToolCalls)*toolCallOverhead
+		}
+		tokenNum += getTokenNum(t, model, message.Role)
 		if message.Name != nil {
 			tokenNum += tokensPerName
-			tokenNum += getTokenNum(tokenEncoder, *message.Name)
+			tokenNum += getTokenNum(t, model, *message.Name)
 		}
 	}
 	tokenNum += 3 // Every reply is primed with <|start|>assistant<|message|>
 	return tokenNum
 }
 
+// getImageURL reads the url and the detail of an image part, the url is a string itself in some clients' requests
+func getImageURL(imageURL any) (string, string, bool) {
+	switch v := imageURL.(type) {
+	case string:
+		return v, "", v != ""
+	case map[string]any:
+		url, _ := v["url"].(string)
+		detail, _ := v["detail"].(string)
+		return url, detail, url != ""
+	}
+	return "", "", false
+}
+
+// fallbackImageSize is the width and height assumed for the images whose size can't be read, e.g. an unreachable url
+const fallbackImageSize = 1024
+
+// imageTileCost is the cost of the models which see the images as 512px tiles,
+// a low detail image costs the base tokens only
+type imageTileCost struct {
+	base int
+	tile int
+}
+
+// imagePatchMultipliers are for the models which see the images as 32px patches, at most 1536 of them,
+// the detail doesn't apply to them
+var imagePatchMultipliers = []struct {
+	prefix     string
+	multiplier float64
+}{
+	{"gpt-4.1-mini", 1.62},
+	{"gpt-4.1-nano", 2.46},
+	{"o4-mini", 1.72},
+}
+
+// the prefixes are matched in order, the longer one first
+var imageTileCosts = []struct {
+	prefix string
+	cost   imageTileCost
+}{
+	{"gpt-4o-mini", imageTileCost{base: 2833, tile: 5667}},
+	{"o1", imageTileCost{base: 75, tile: 150}},
+	{"o3", imageTileCost{base: 75, tile: 150}},
+}
+
+var defaultImageTileCost = imageTileCost{base: 85, tile: 170}
+
 const (
-	lowDetailCost         = 85
-	highDetailCostPerTile = 170
-	additionalCost        = 85
+	imagePatchSize  = 32
+	maxImagePatches = 1536
 )
 
-// https://platform.openai.com/docs/guides/vision/calculating-costs
+// https://platform.openai.com/docs/guides/images-vision#calculating-costs
 // https://github.com/openai/openai-cookbook/blob/05e3f9be4c7a2ae7ecf029a7c32065b024730ebe/examples/How_to_count_tokens_with_tiktoken.ipynb
-func countImageTokens(url string, detail string) (_ int, err error) {
-	var fetchSize = true
-	var width, height int
-	// Reference: https://platform.openai.com/docs/guides/vision/low-or-high-fidelity-image-understanding
-	// detail == "auto" is undocumented on how it works, it just said the model will use the auto setting which will look at the image input size and decide if it should use the low or high setting.
-	// According to the official guide, "low" disable the high-res model,
-	// and only receive low-res 512px x 512px version of the image, indicating
-	// that image is treated as low-res when size is smaller than 512px x 512px,
-	// then we can assume that image size larger than 512px x 512px is treated
-	// as high-res. Then we have the following logic:
-	// if detail == "" || detail == "auto" {
-	// 	width, height, err = image.GetImageSize(url)
-	// 	if err != nil {
-	// 		return 0, err
-	// 	}
-	// 	fetchSize = false
-	// 	// not sure if this is correct
-	// 	if width > 512 || height > 512 {
-	// 		detail = "high"
-	// 	} else {
-	// 		detail = "low"
-	// 	}
-	// }
-
-	// However, in my test, it seems to be always the same as "high".
+func countImageTokens(url string, detail string, model string) (int, error) {
+	// detail == "auto" is undocumented on how it works, in my test it seems to be always the same as "high".
 	// The following image, which is 125x50, is still treated as high-res, taken
 	// 255 tokens in the response of non-stream chat completion api.
 	// https://upload.wikimedia.org/wikipedia/commons/1/10/18_Infantry_Division_Messina.jpg
-	if detail == "" || detail == "auto" {
-		// assume by test, not sure if this is correct
-		detail = "high"
-	}
-	switch detail {
-	case "low":
-		return lowDetailCost, nil
-	case "high":
-		if fetchSize {
-			width, height, err = image.GetImageSize(url)
-			if err != nil {
-				return 0, err
-			}
+	if detail != "" && detail != "auto" && detail != "low" && detail != "high" {
+		return 0, errors.New("invalid detail option")
+	}
+	if detail == "low" && getImagePatchMultiplier(model) == 0 {
+		// the size isn't needed
+		return countImageTokensBySize(0, 0, detail, model), nil
+	}
+	width, height, err := image.GetImageSize(url)
+	if err != nil {
+		return 0, err
+	}
+	return countImageTokensBySize(width, height, detail, model), nil
+}
+
+func getImagePatchMultiplier(model string) float64 {
+	for _, item := range imagePatchMultipliers {
+		if strings.HasPrefix(model, item.prefix) {
+			return item.multiplier
 		}
-		if width > 2048 || height > 2048 { // max(width, height) > 2048
-			ratio := float64(2048) / math.Max(float64(width), float64(height))
-			width = int(float64(width) * ratio)
-			height = int(float64(height) * ratio)
+	}
+	return 0
+}
+
+func getImageTileCost(model string) imageTileCost {
+	for _, item := range imageTileCosts {
+		if strings.HasPrefix(model, item.prefix) {
+			return item.cost
 		}
-		if width > 768 && height > 768 { // min(width, height) > 768
-			ratio := float64(768) / math.Min(float64(width), float64(height))
-			width = int(float64(width) * ratio)
-			height = int(float64(height) * ratio)
+	}
+	return defaultImageTileCost
+}
+
+func countImageTokensBySize(width int, height int, detail string, model string) int {
+	if multiplier := getImagePatchMultiplier(model); multiplier != 0 {
+		return int(math.Ceil(float64(countImagePatches(width, height)) * multiplier))
+	}
+	cost := getImageTileCost(model)
+	if detail == "low" {
+		return cost.base
+	}
+	if width > 2048 || height > 2048 { // max(width, height) > 2048
+		ratio := float64(2048) / math.Max(float64(width), float64(height))
+		width = int(float64(width) * ratio)
+		height = int(float64(height) * ratio)
+	}
+	if width > 768 && height > 768 { // min(width, height) > 768
+		ratio := float64(768) / math.Min(float64(width), float64(height))
+		width = int(float64(width) * ratio)
+		height = int(float64(height) * ratio)
+	}
+	numSquares := int(math.Ceil(float64(width)/512) * math.Ceil(float64(height)/512))
+	return numSquares*cost.tile + cost.base
+}
+
+// countImagePatches scales the image down to fit in the patches if there are too many, with whole patches along the width or the height
+func countImagePatches(width int, height int) int {
+	w, h := float64(width), float64(height)
+	patches := math.Ceil(w/imagePatchSize) * math.Ceil(h/imagePatchSize)
+	if patches <= maxImagePatches {
+		return int(patches)
+	}
+	ratio := math.Sqrt(imagePatchSize * imagePatchSize * maxImagePatches / (w * h))
+	ratio *= math.Min(math.Floor(w*ratio/imagePatchSize)/(w*ratio/imagePatchSize), math.Floor(h*ratio/imagePatchSize)/(h*ratio/imagePatchSize))
+	patches = math.Ceil(w*ratio/imagePatchSize) * math.Ceil(h*ratio/imagePatchSize)
+	return int(math.Min(patches, maxImagePatches))
+}
+
+// the tokens of the format wrapping the definitions and the calls of the tools, estimated by tests
+const (
+	toolsOverhead    = 9
+	toolOverhead     = 7
+	toolCallOverhead = 3
+)
+
+// CountTokenTools counts the definitions of the tools, or of the legacy functions, which are a part of the prompt
+// although they're not in the messages, and the tool forced by the tool choice
+func CountTokenTools(tools []model.Tool, functions any, toolChoice any, modelName string) int {
+	t := getTokenizer(modelName)
+	definitions := make([]any, 0, len(tools))
+	for _, tool := range tools {
+		definitions = append(definitions, tool.Function)
+	}
+	if items, ok := functions.([]any); ok {
+		definitions = append(definitions, items...)
+	}
+	if len(definitions) == 0 {
+		return 0
+	}
+	tokenNum := toolsOverhead
+	for _, definition := range definitions {
+		jsonDefinition, err := json.Marshal(definition)
+		if err != nil {
+			continue
 		}
-		numSquares := int(math.Ceil(float64(width)/512) * math.Ceil(float64(height)/512))
-		result := numSquares*highDetailCostPerTile + additionalCost
-		return result, nil
-	default:
-		return 0, errors.New("invalid detail option")
+		tokenNum += getTokenNum(t, modelName, string(jsonDefinition)) + toolOverhead
+	}
+	if choice, ok := toolChoice.(map[string]any); ok {
+		jsonChoice, _ := json.Marshal(choice)
+		tokenNum += getTokenNum(t, modelName, string(jsonChoice))
 	}
+	return tokenNum
 }
 
 func CountTokenInput(input any, model string) int {
@@ -209,8 +329,7 @@ func CountTokenInput(input any, model string) int {
 }
 
 func CountTokenText(text string, model string) int {
-	tokenEncoder := getTokenEncoder(model)
-	return getTokenNum(tokenEncoder, text)
+	return getTokenNum(getTokenizer(model), model, text)
 }
 
 func CountToken(text string) int {
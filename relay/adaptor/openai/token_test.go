@@ -0,0 +1,99 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/png"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func pngDataURL(width int, height int) string {
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height)))
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestCountImageTokens(t *testing.T) {
+	Convey("countImageTokens", t, func() {
+		url := pngDataURL(1024, 1024)
+		tokens, err := countImageTokens(url, "high", "gpt-4o")
+		So(err, ShouldBeNil)
+		So(tokens, ShouldEqual, 765)
+		tokens, _ = countImageTokens(url, "low", "gpt-4o")
+		So(tokens, ShouldEqual, 85)
+		tokens, _ = countImageTokens(url, "", "gpt-4o-mini")
+		So(tokens, ShouldEqual, 2833+4*5667)
+		// 1024 patches
+		tokens, _ = countImageTokens(url, "low", "gpt-4.1-mini")
+		So(tokens, ShouldEqual, 1659)
+		_, err = countImageTokens(url, "medium", "gpt-4o")
+		So(err, ShouldNotBeNil)
+
+		// scaled down to 1536 patches at most
+		So(countImagePatches(1800, 2400), ShouldEqual, 1452)
+		So(countImagePatches(10, 10), ShouldEqual, 1)
+	})
+
+	Convey("getImageURL", t, func() {
+		url, detail, ok := getImageURL(map[string]any{"url": "https://example.com/a.png", "detail": "low"})
+		So(ok, ShouldBeTrue)
+		So(url, ShouldEqual, "https://example.com/a.png")
+		So(detail, ShouldEqual, "low")
+		url, _, ok = getImageURL("https://example.com/a.png")
+		So(ok, ShouldBeTrue)
+		So(url, ShouldEqual, "https://example.com/a.png")
+		_, _, ok = getImageURL(map[string]any{"detail": "low"})
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestCountTokenTools(t *testing.T) {
+	Convey("CountTokenTools", t, func() {
+		// the token encoders aren't loaded in the tests
+		oldApproximateTokenEnabled := config.ApproximateTokenEnabled
+		config.ApproximateTokenEnabled = true
+		t.Cleanup(func() {
+			config.ApproximateTokenEnabled = oldApproximateTokenEnabled
+		})
+		var request model.GeneralOpenAIRequest
+		So(json.Unmarshal([]byte(`{"tools":[{"type":"function","function":{"name":"get_weather","parameters":{"type":"object","properties":{"city":{"type":"string"}}}}}],
+			"functions":[{"name":"get_time","parameters":{"type":"object","properties":{}}}],
+			"tool_choice":{"type":"function","function":{"name":"get_weather"}}}`), &request), ShouldBeNil)
+		definition := func(v any) int {
+			jsonDefinition, _ := json.Marshal(v)
+			return getTokenNum(tiktokenTokenizer{}, "gpt-4o", string(jsonDefinition))
+		}
+
+		So(CountTokenTools(nil, nil, nil, "gpt-4o"), ShouldEqual, 0)
+		// the tool choice alone isn't counted
+		So(CountTokenTools(nil, nil, request.ToolChoice, "gpt-4o"), ShouldEqual, 0)
+		tools := toolsOverhead + definition(request.Tools[0].Function) + toolOverhead
+		So(CountTokenTools(request.Tools, nil, nil, "gpt-4o"), ShouldEqual, tools)
+		functions := definition(request.Functions.([]any)[0]) + toolOverhead
+		So(CountTokenTools(request.Tools, request.Functions, nil, "gpt-4o"), ShouldEqual, tools+functions)
+		So(CountTokenTools(request.Tools, request.Functions, request.ToolChoice, "gpt-4o"), ShouldEqual,
+			tools+functions+definition(request.ToolChoice))
+		// a tool choice as a string forces no tool in particular
+		So(CountTokenTools(request.Tools, nil, "required", "gpt-4o"), ShouldEqual, tools)
+	})
+
+	Convey("CountTokenMessages counts the tool calls sent back", t, func() {
+		oldApproximateTokenEnabled := config.ApproximateTokenEnabled
+		config.ApproximateTokenEnabled = true
+		t.Cleanup(func() {
+			config.ApproximateTokenEnabled = oldApproximateTokenEnabled
+		})
+		var messages []model.Message
+		So(json.Unmarshal([]byte(`[{"role":"user","content":"weather?"},{"role":"assistant","content":"",
+			"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]}]`), &messages), ShouldBeNil)
+		withoutCalls := []model.Message{messages[0], {Role: "assistant", Content: ""}}
+		So(CountTokenMessages(messages, "gpt-4o")-CountTokenMessages(withoutCalls, "gpt-4o"), ShouldEqual,
+			getTokenNum(tiktokenTokenizer{}, "gpt-4o", messages[1].ToolCallsText())+toolCallOverhead)
+	})
+}
@@ -0,0 +1,12 @@
+package perplexity
+
+// https://docs.perplexity.ai/guides/model-cards
+
+var ModelList = []string{
+	"sonar",
+	"sonar-pro",
+	"sonar-reasoning",
+	"sonar-reasoning-pro",
+	"sonar-deep-research",
+	"r1-1776",
+}
@@ -0,0 +1,19 @@
+package perplexity
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+func TestGetRequestURL(t *testing.T) {
+	Convey("GetRequestURL", t, func() {
+		url, err := GetRequestURL(&meta.Meta{Mode: relaymode.ChatCompletions, BaseURL: "https://api.perplexity.ai"})
+		So(err, ShouldBeNil)
+		So(url, ShouldEqual, "https://api.perplexity.ai/chat/completions")
+		_, err = GetRequestURL(&meta.Meta{Mode: relaymode.Embeddings, BaseURL: "https://api.perplexity.ai"})
+		So(err, ShouldNotBeNil)
+	})
+}
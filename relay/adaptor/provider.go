@@ -0,0 +1,31 @@
+package adaptor
+
+import (
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// ProviderAdapter is the part of an adaptor that differs between the providers of chat completions,
+// the reading of the stream, the rendering to the client and the counting of the tokens are done by
+// openai.DoProviderResponse, so that an adaptor implementing it only converts the formats.
+type ProviderAdapter interface {
+	// BuildRequest converts the request to the body of the upstream
+	BuildRequest(request *model.GeneralOpenAIRequest) (any, error)
+	// ParseResponse converts the body of a non-stream response, the error is the one returned by the upstream
+	ParseResponse(meta *meta.Meta, body []byte) (*model.TextResponse, *model.ErrorWithStatusCode)
+	// ParseStreamChunk converts the data of a stream event, the events with nothing for the client are nil,
+	// an error event of the upstream is returned as a *StreamError
+	ParseStreamChunk(meta *meta.Meta, data string) (*model.ChatCompletionsStreamResponse, error)
+	// ExtractUsage gets the usage of a response body or a stream event, nil if the upstream sends none in it
+	ExtractUsage(data []byte) *model.Usage
+}
+
+// StreamError is an error event in the stream of an upstream, it's relayed as the error of the request if
+// nothing has been sent to the client yet, otherwise the stream ends there
+type StreamError struct {
+	Err *model.ErrorWithStatusCode
+}
+
+func (e *StreamError) Error() string {
+	return e.Err.Message
+}
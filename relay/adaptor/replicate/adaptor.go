@@ -0,0 +1,83 @@
+package replicate
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+type Adaptor struct {
+}
+
+func (a *Adaptor) Init(meta *meta.Meta) {
+
+}
+
+func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
+	name, version := splitModel(meta.ActualModelName)
+	if version != "" {
+		// the version is in the request body
+		return fmt.Sprintf("%s/v1/predictions", meta.BaseURL), nil
+	}
+	return fmt.Sprintf("%s/v1/models/%s/predictions", meta.BaseURL, name), nil
+}
+
+func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *meta.Meta) error {
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+meta.APIKey)
+	if !meta.IsStream {
+		// the prediction is returned once it's done if it takes less than a minute, saving the polling
+		req.Header.Set("Prefer", "wait")
+	}
+	return nil
+}
+
+func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.GeneralOpenAIRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	return ConvertRequest(*request), nil
+}
+
+func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	return ConvertImageRequest(*request), nil
+}
+
+func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Reader) (*http.Response, error) {
+	resp, err := adaptor.DoRequestHelper(a, c, meta, requestBody)
+	if err != nil {
+		return nil, err
+	}
+	return resolvePrediction(c.Request.Context(), resp, meta.APIKey, meta.IsStream)
+}
+
+func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	switch {
+	case meta.Mode == relaymode.ImagesGenerations:
+		err, usage = ImageHandler(c, resp)
+	case meta.IsStream:
+		err, usage = StreamHandler(c, resp, meta.PromptTokens, meta.ActualModelName)
+	default:
+		err, usage = Handler(c, resp, meta.PromptTokens, meta.ActualModelName)
+	}
+	return
+}
+
+func (a *Adaptor) GetModelList() []string {
+	return ModelList
+}
+
+func (a *Adaptor) GetChannelName() string {
+	return "replicate"
+}
@@ -0,0 +1,17 @@
+package replicate
+
+// https://replicate.com/collections/official, other models can be used as owner/name:version
+
+var ModelList = []string{
+	// language models
+	"meta/meta-llama-3-8b-instruct",
+	"meta/meta-llama-3-70b-instruct",
+	"meta/meta-llama-3.1-405b-instruct",
+	"mistralai/mixtral-8x7b-instruct-v0.1",
+	// image models
+	"black-forest-labs/flux-schnell",
+	"black-forest-labs/flux-dev",
+	"black-forest-labs/flux-pro",
+	"black-forest-labs/flux-1.1-pro",
+	"stability-ai/stable-diffusion-3.5-large",
+}
@@ -0,0 +1,145 @@
+package replicate
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/image"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// the aspect ratios taken by the flux models, the size of OpenAI is mapped to the closest one
+var aspectRatios = []string{"1:1", "16:9", "21:9", "3:2", "2:3", "4:5", "5:4", "3:4", "4:3", "9:16", "9:21"}
+
+func parseRatio(ratio string) float64 {
+	width, height, _ := strings.Cut(ratio, ":")
+	w, _ := strconv.ParseFloat(width, 64)
+	h, _ := strconv.ParseFloat(height, 64)
+	if w <= 0 || h <= 0 {
+		return 0
+	}
+	return w / h
+}
+
+func toAspectRatio(size string) string {
+	width, height, ok := strings.Cut(size, "x")
+	if !ok {
+		return ""
+	}
+	ratio := parseRatio(width + ":" + height)
+	if ratio == 0 {
+		return ""
+	}
+	closest := ""
+	minDiff := math.MaxFloat64
+	for _, aspectRatio := range aspectRatios {
+		// compared in log scale, so that 2:1 is as far from 1:1 as 1:2 is
+		diff := math.Abs(math.Log(parseRatio(aspectRatio) / ratio))
+		if diff < minDiff {
+			closest, minDiff = aspectRatio, diff
+		}
+	}
+	return closest
+}
+
+func ConvertImageRequest(request model.ImageRequest) *PredictionRequest {
+	input := ImageInput{
+		Prompt:       request.Prompt,
+		AspectRatio:  toAspectRatio(request.Size),
+		OutputFormat: "png",
+	}
+	// not taken by all the models
+	if request.N > 1 {
+		input.NumOutputs = request.N
+	}
+	_, version := splitModel(request.Model)
+	return &PredictionRequest{
+		Version: version,
+		Input:   input,
+	}
+}
+
+// outputURLs is the output of an image model, a single url or a list of them
+func outputURLs(output json.RawMessage) []string {
+	var urls []string
+	if json.Unmarshal(output, &urls) == nil {
+		return urls
+	}
+	var url string
+	if json.Unmarshal(output, &url) == nil && url != "" {
+		return []string{url}
+	}
+	return nil
+}
+
+// imageErrorHandler reads the error of a failed image request, the relay of images doesn't check the status code
+func imageErrorHandler(resp *http.Response) *model.ErrorWithStatusCode {
+	var errorResponse struct {
+		Error  *model.Error `json:"error"`
+		Detail string       `json:"detail"`
+	}
+	err := json.NewDecoder(resp.Body).Decode(&errorResponse)
+	_ = resp.Body.Close()
+	errWithStatusCode := &model.ErrorWithStatusCode{
+		Error: model.Error{
+			Message: fmt.Sprintf("bad response status code %d", resp.StatusCode),
+			Type:    "replicate_error",
+		},
+		StatusCode: resp.StatusCode,
+	}
+	if err != nil {
+		return errWithStatusCode
+	}
+	if errorResponse.Error != nil {
+		errWithStatusCode.Error = *errorResponse.Error
+	} else if errorResponse.Detail != "" {
+		errWithStatusCode.Error.Message = errorResponse.Detail
+	}
+	return errWithStatusCode
+}
+
+func ImageHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.Usage) {
+	if resp.StatusCode != http.StatusOK {
+		return imageErrorHandler(resp), nil
+	}
+	responseFormat := c.GetString("response_format")
+	prediction, errWithStatusCode := readPrediction(resp)
+	if errWithStatusCode != nil {
+		return errWithStatusCode, nil
+	}
+	urls := outputURLs(prediction.Output)
+	if len(urls) == 0 {
+		return openai.ErrorWrapper(fmt.Errorf("no image in the output of prediction %s", prediction.Id), "empty_response", http.StatusInternalServerError), nil
+	}
+	imageResponse := openai.ImageResponse{
+		Created: helper.GetTimestamp(),
+	}
+	for _, url := range urls {
+		data := openai.ImageData{Url: url}
+		if responseFormat == "b64_json" {
+			_, b64Json, err := image.GetImageFromUrl(url)
+			if err != nil {
+				logger.SysError("error getting image data: " + err.Error())
+				continue
+			}
+			data = openai.ImageData{B64Json: b64Json}
+		}
+		imageResponse.Data = append(imageResponse.Data, data)
+	}
+	jsonResponse, err := json.Marshal(imageResponse)
+	if err != nil {
+		return openai.ErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(jsonResponse)
+	return nil, nil
+}
@@ -0,0 +1,229 @@
+package replicate
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/render"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/constant/finishreason"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// splitModel tells the model and its version apart, a model named owner/name:version is run by its version
+func splitModel(modelName string) (string, string) {
+	name, version, _ := strings.Cut(modelName, ":")
+	return name, version
+}
+
+// messagesToPrompt puts the conversation into the single prompt the language models take,
+// the system messages go to the system prompt
+func messagesToPrompt(messages []model.Message) (string, string) {
+	var systemPrompt []string
+	var turns []model.Message
+	for _, message := range messages {
+		if message.Role == "system" {
+			systemPrompt = append(systemPrompt, message.StringContent())
+			continue
+		}
+		turns = append(turns, message)
+	}
+	if len(turns) == 1 {
+		// the chat template of the model is applied to the prompt
+		return strings.Join(systemPrompt, "\n"), turns[0].StringContent()
+	}
+	var prompt strings.Builder
+	for _, message := range turns {
+		role := message.Role
+		if role != "assistant" {
+			role = "user"
+		}
+		prompt.WriteString(fmt.Sprintf("%s: %s\n", role, message.StringContent()))
+	}
+	prompt.WriteString("assistant:")
+	return strings.Join(systemPrompt, "\n"), prompt.String()
+}
+
+func ConvertRequest(textRequest model.GeneralOpenAIRequest) *PredictionRequest {
+	input := ChatInput{
+		MaxTokens:        textRequest.MaxTokens,
+		Temperature:      textRequest.Temperature,
+		TopP:             textRequest.TopP,
+		TopK:             textRequest.TopK,
+		PresencePenalty:  textRequest.PresencePenalty,
+		FrequencyPenalty: textRequest.FrequencyPenalty,
+		StopSequences:    strings.Join(textRequest.ParseStop(), ","),
+		Seed:             textRequest.Seed,
+	}
+	if len(textRequest.Messages) == 0 {
+		// completions
+		input.Prompt, _ = textRequest.Prompt.(string)
+	} else {
+		input.SystemPrompt, input.Prompt = messagesToPrompt(textRequest.Messages)
+	}
+	_, version := splitModel(textRequest.Model)
+	return &PredictionRequest{
+		Version: version,
+		Input:   input,
+		Stream:  textRequest.Stream,
+	}
+}
+
+// outputText joins the output of a language model, it's a list of tokens for most of them
+func outputText(output json.RawMessage) string {
+	var tokens []string
+	if json.Unmarshal(output, &tokens) == nil {
+		return strings.Join(tokens, "")
+	}
+	var text string
+	_ = json.Unmarshal(output, &text)
+	return text
+}
+
+func StreamHandler(c *gin.Context, resp *http.Response, promptTokens int, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Split(bufio.ScanLines)
+
+	common.SetEventStreamHeaders(c)
+	id := helper.GetResponseID(c)
+	responseModel := c.GetString(ctxkey.OriginalModel)
+	created := helper.GetTimestamp()
+	var responseText string
+	isFirst := true
+
+	// https://replicate.com/docs/topics/predictions/streaming, the data of an event may span lines
+	var event string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" {
+			if value, ok := strings.CutPrefix(line, "event:"); ok {
+				event = strings.TrimSpace(value)
+			} else if value, ok := strings.CutPrefix(line, "data:"); ok {
+				// only a single space is part of the syntax, the rest are in the token
+				data = append(data, strings.TrimPrefix(value, " "))
+			}
+			continue
+		}
+		text := strings.Join(data, "\n")
+		currentEvent := event
+		event, data = "", nil
+		if currentEvent == "done" {
+			break
+		}
+		if currentEvent == "error" {
+			logger.SysError("replicate prediction failed while streaming: " + text)
+			break
+		}
+		if currentEvent != "output" || text == "" {
+			continue
+		}
+
+		var choice openai.ChatCompletionsStreamResponseChoice
+		choice.Delta.Content = text
+		if isFirst {
+			// the role is only in the first delta, as OpenAI does
+			choice.Delta.Role = "assistant"
+		}
+		isFirst = false
+		responseText += text
+		err := render.ObjectData(c, openai.ChatCompletionsStreamResponse{
+			Id:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   responseModel,
+			Choices: []openai.ChatCompletionsStreamResponseChoice{choice},
+		})
+		if err != nil {
+			logger.SysError(err.Error())
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		logger.SysError("error reading stream: " + err.Error())
+	}
+
+	finishReason := finishreason.Stop
+	err := render.ObjectData(c, openai.ChatCompletionsStreamResponse{
+		Id:      id,
+		Object:  "chat.completion.chunk",
+		Created: created,
+		Model:   responseModel,
+		Choices: []openai.ChatCompletionsStreamResponseChoice{{FinishReason: &finishReason}},
+	})
+	if err != nil {
+		logger.SysError(err.Error())
+	}
+	render.Done(c)
+
+	err = resp.Body.Close()
+	if err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	return nil, openai.ResponseText2Usage(responseText, responseModel, promptTokens)
+}
+
+func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
+	prediction, errWithStatusCode := readPrediction(resp)
+	if errWithStatusCode != nil {
+		return errWithStatusCode, nil
+	}
+	text := outputText(prediction.Output)
+	usage := &model.Usage{
+		PromptTokens:     prediction.Metrics.InputTokenCount,
+		CompletionTokens: prediction.Metrics.OutputTokenCount,
+		TotalTokens:      prediction.Metrics.InputTokenCount + prediction.Metrics.OutputTokenCount,
+	}
+	if usage.TotalTokens == 0 {
+		usage = openai.ResponseText2Usage(text, modelName, promptTokens)
+	}
+	fullTextResponse := openai.TextResponse{
+		Id:      helper.GetResponseID(c),
+		Model:   modelName,
+		Object:  "chat.completion",
+		Created: helper.GetTimestamp(),
+		Choices: []openai.TextResponseChoice{{
+			Index: 0,
+			Message: model.Message{
+				Role:    "assistant",
+				Content: text,
+			},
+			FinishReason: finishreason.Stop,
+		}},
+		Usage: *usage,
+	}
+	jsonResponse, err := json.Marshal(fullTextResponse)
+	if err != nil {
+		return openai.ErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(jsonResponse)
+	return nil, usage
+}
+
+func readPrediction(resp *http.Response) (*Prediction, *model.ErrorWithStatusCode) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError)
+	}
+	var prediction Prediction
+	err = json.Unmarshal(responseBody, &prediction)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+	}
+	return &prediction, nil
+}
@@ -0,0 +1,105 @@
+package replicate
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestConvertRequest(t *testing.T) {
+	Convey("ConvertRequest", t, func() {
+		Convey("takes a single message as the prompt", func() {
+			request := ConvertRequest(model.GeneralOpenAIRequest{
+				Model: "meta/meta-llama-3-8b-instruct",
+				Messages: []model.Message{
+					{Role: "system", Content: "Be brief."},
+					{Role: "user", Content: "Hi"},
+				},
+				Stop: []any{"\n\n", "User:"},
+			})
+			input := request.Input.(ChatInput)
+			So(request.Version, ShouldBeEmpty)
+			So(input.SystemPrompt, ShouldEqual, "Be brief.")
+			So(input.Prompt, ShouldEqual, "Hi")
+			So(input.StopSequences, ShouldEqual, "\n\n,User:")
+		})
+
+		Convey("puts a conversation into the prompt", func() {
+			request := ConvertRequest(model.GeneralOpenAIRequest{
+				Model: "owner/model:1234",
+				Messages: []model.Message{
+					{Role: "user", Content: "Hi"},
+					{Role: "assistant", Content: "Hello"},
+					{Role: "user", Content: "How are you?"},
+				},
+			})
+			So(request.Version, ShouldEqual, "1234")
+			So(request.Input.(ChatInput).Prompt, ShouldEqual, "user: Hi\nassistant: Hello\nuser: How are you?\nassistant:")
+		})
+	})
+}
+
+func TestToAspectRatio(t *testing.T) {
+	Convey("toAspectRatio", t, func() {
+		So(toAspectRatio("1024x1024"), ShouldEqual, "1:1")
+		So(toAspectRatio("1792x1024"), ShouldEqual, "16:9")
+		So(toAspectRatio("1024x1792"), ShouldEqual, "9:16")
+		So(toAspectRatio("1024x768"), ShouldEqual, "4:3")
+		So(toAspectRatio("512"), ShouldBeEmpty)
+	})
+}
+
+func TestOutput(t *testing.T) {
+	Convey("output", t, func() {
+		So(outputText([]byte(`["Hel","lo"]`)), ShouldEqual, "Hello")
+		So(outputText([]byte(`"Hello"`)), ShouldEqual, "Hello")
+		So(outputURLs([]byte(`"https://replicate.delivery/a.png"`)), ShouldResemble, []string{"https://replicate.delivery/a.png"})
+		So(outputURLs([]byte(`["https://replicate.delivery/a.png","https://replicate.delivery/b.png"]`)), ShouldHaveLength, 2)
+	})
+}
+
+func TestStreamHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// the tokenizers aren't loaded in the tests
+	config.ApproximateTokenEnabled = true
+	defer func() { config.ApproximateTokenEnabled = false }()
+	Convey("StreamHandler", t, func() {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		resp := &http.Response{
+			StatusCode: http.StatusOK,
+			Body: io.NopCloser(strings.NewReader("event: output\nid: 1\ndata: Hel\n\n" +
+				"event: output\nid: 2\ndata:  lo\ndata: there\n\n" +
+				"event: done\ndata: {}\n\n")),
+		}
+		err, usage := StreamHandler(c, resp, 2, "meta/meta-llama-3-8b-instruct")
+		So(err, ShouldBeNil)
+		So(usage.PromptTokens, ShouldEqual, 2)
+		body := w.Body.String()
+		So(body, ShouldContainSubstring, `"content":"Hel"`)
+		So(body, ShouldContainSubstring, `"content":" lo\nthere"`)
+		So(body, ShouldContainSubstring, `"finish_reason":"stop"`)
+		So(strings.HasSuffix(strings.TrimSpace(body), "data: [DONE]"), ShouldBeTrue)
+	})
+
+	Convey("outputEvents", t, func() {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		resp := &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(string(outputEvents("Hello\nthere")))),
+		}
+		err, _ := StreamHandler(c, resp, 2, "meta/meta-llama-3-8b-instruct")
+		So(err, ShouldBeNil)
+		So(w.Body.String(), ShouldContainSubstring, `"content":"Hello\nthere"`)
+	})
+}
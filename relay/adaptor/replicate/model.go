@@ -0,0 +1,55 @@
+package replicate
+
+import "encoding/json"
+
+// ChatInput is the input of the language models, they take a single prompt instead of messages
+type ChatInput struct {
+	Prompt           string  `json:"prompt"`
+	SystemPrompt     string  `json:"system_prompt,omitempty"`
+	MaxTokens        int     `json:"max_tokens,omitempty"`
+	Temperature      float64 `json:"temperature,omitempty"`
+	TopP             float64 `json:"top_p,omitempty"`
+	TopK             int     `json:"top_k,omitempty"`
+	PresencePenalty  float64 `json:"presence_penalty,omitempty"`
+	FrequencyPenalty float64 `json:"frequency_penalty,omitempty"`
+	StopSequences    string  `json:"stop_sequences,omitempty"` // comma separated
+	Seed             float64 `json:"seed,omitempty"`
+}
+
+type ImageInput struct {
+	Prompt       string `json:"prompt"`
+	AspectRatio  string `json:"aspect_ratio,omitempty"`
+	NumOutputs   int    `json:"num_outputs,omitempty"`
+	OutputFormat string `json:"output_format,omitempty"`
+}
+
+type PredictionRequest struct {
+	// only for the models not run by their name, see GetRequestURL
+	Version string `json:"version,omitempty"`
+	Input   any    `json:"input"`
+	Stream  bool   `json:"stream,omitempty"`
+}
+
+type PredictionURLs struct {
+	Get    string `json:"get"`
+	Cancel string `json:"cancel"`
+	Stream string `json:"stream"`
+}
+
+type Metrics struct {
+	InputTokenCount  int     `json:"input_token_count"`
+	OutputTokenCount int     `json:"output_token_count"`
+	PredictTime      float64 `json:"predict_time"`
+}
+
+// Prediction is what's returned when a prediction is created, and each time it's polled
+type Prediction struct {
+	Id     string          `json:"id"`
+	Model  string          `json:"model"`
+	Status string          `json:"status"`
+	Output json.RawMessage `json:"output"` // a string or a list of strings, depending on the model
+	Error  any             `json:"error"`
+	Urls   PredictionURLs  `json:"urls"`
+	// not always reported
+	Metrics Metrics `json:"metrics"`
+}
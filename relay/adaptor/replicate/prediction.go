@@ -0,0 +1,163 @@
+package replicate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// the predictions of replicate are asynchronous: they're created, then polled until they're done,
+// or their output is read from the stream url. It's all done before the response is handled,
+// so that the response looks like the one of a synchronous api to the rest of the relay.
+
+const pollInterval = time.Second
+
+// a prediction may queue for a long time while the model boots, the client may give up before that
+const predictionTimeout = 10 * time.Minute
+
+func isTerminal(status string) bool {
+	return status == "succeeded" || status == "failed" || status == "canceled"
+}
+
+func newResponse(statusCode int, contentType string, body []byte) *http.Response {
+	header := make(http.Header)
+	header.Set("Content-Type", contentType)
+	return &http.Response{
+		StatusCode: statusCode,
+		Header:     header,
+		Body:       io.NopCloser(bytes.NewReader(body)),
+	}
+}
+
+// errorResponse is the failure of a prediction in the error format of OpenAI, understood by the error handler of the relay
+func errorResponse(prediction *Prediction) *http.Response {
+	message := fmt.Sprintf("prediction %s", prediction.Status)
+	if prediction.Error != nil {
+		message = fmt.Sprint(prediction.Error)
+	}
+	body, _ := json.Marshal(struct {
+		Error model.Error `json:"error"`
+	}{model.Error{Message: message, Type: "replicate_error", Code: "prediction_" + prediction.Status}})
+	return newResponse(http.StatusInternalServerError, "application/json", body)
+}
+
+func requestPrediction(ctx context.Context, method string, url string, apiKey string, accept string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Accept", accept)
+	return client.HTTPClient.Do(req)
+}
+
+func getPrediction(ctx context.Context, url string, apiKey string) (*Prediction, error) {
+	resp, err := requestPrediction(ctx, http.MethodGet, url, apiKey, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get prediction failed with status code %d", resp.StatusCode)
+	}
+	var prediction Prediction
+	err = json.NewDecoder(resp.Body).Decode(&prediction)
+	if err != nil {
+		return nil, err
+	}
+	return &prediction, nil
+}
+
+// cancelPrediction stops a prediction nobody waits for anymore, so that it's not paid for
+func cancelPrediction(prediction *Prediction, apiKey string) {
+	if prediction.Urls.Cancel == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resp, err := requestPrediction(ctx, http.MethodPost, prediction.Urls.Cancel, apiKey, "application/json")
+	if err != nil {
+		logger.SysError(fmt.Sprintf("failed to cancel replicate prediction %s: %s", prediction.Id, err.Error()))
+		return
+	}
+	_ = resp.Body.Close()
+}
+
+// waitPrediction polls the prediction until it's done, the prediction is canceled if ctx is done first
+func waitPrediction(ctx context.Context, prediction *Prediction, apiKey string) (*Prediction, error) {
+	ctx, cancel := context.WithTimeout(ctx, predictionTimeout)
+	defer cancel()
+	for !isTerminal(prediction.Status) {
+		select {
+		case <-ctx.Done():
+			cancelPrediction(prediction, apiKey)
+			return nil, fmt.Errorf("replicate prediction %s not done: %w", prediction.Id, ctx.Err())
+		case <-time.After(pollInterval):
+		}
+		polled, err := getPrediction(ctx, prediction.Urls.Get, apiKey)
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			return nil, err
+		}
+		prediction = polled
+	}
+	return prediction, nil
+}
+
+// outputEvents is the output in the format of the stream of replicate
+func outputEvents(text string) []byte {
+	var events bytes.Buffer
+	events.WriteString("event: output\n")
+	for _, line := range strings.Split(text, "\n") {
+		events.WriteString("data: " + line + "\n")
+	}
+	events.WriteString("\nevent: done\ndata: {}\n\n")
+	return events.Bytes()
+}
+
+// resolvePrediction turns the response creating a prediction into the one of a synchronous api:
+// the final prediction, or the stream of its output
+func resolvePrediction(ctx context.Context, resp *http.Response, apiKey string, isStream bool) (*http.Response, error) {
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return resp, nil
+	}
+	var prediction Prediction
+	err := json.NewDecoder(resp.Body).Decode(&prediction)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal prediction failed: %w", err)
+	}
+	if prediction.Status == "failed" || prediction.Status == "canceled" {
+		return errorResponse(&prediction), nil
+	}
+	if isStream && prediction.Urls.Stream != "" {
+		return requestPrediction(ctx, http.MethodGet, prediction.Urls.Stream, apiKey, "text/event-stream")
+	}
+	final, err := waitPrediction(ctx, &prediction, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	if final.Status != "succeeded" {
+		return errorResponse(final), nil
+	}
+	if isStream {
+		// the model can't stream, its whole output is sent as a single event
+		return newResponse(http.StatusOK, "text/event-stream", outputEvents(outputText(final.Output))), nil
+	}
+	body, err := json.Marshal(final)
+	if err != nil {
+		return nil, err
+	}
+	return newResponse(http.StatusOK, "application/json", body), nil
+}
@@ -0,0 +1,12 @@
+package sambanova
+
+// https://docs.sambanova.ai/cloud/docs/get-started/supported-models, the model ids are case sensitive
+
+var ModelList = []string{
+	"Meta-Llama-3.1-8B-Instruct",
+	"Meta-Llama-3.3-70B-Instruct",
+	"Llama-4-Maverick-17B-128E-Instruct",
+	"DeepSeek-R1",
+	"DeepSeek-V3-0324",
+	"QwQ-32B",
+}
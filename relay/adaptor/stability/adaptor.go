@@ -0,0 +1,82 @@
+package stability
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+type Adaptor struct {
+	contentType string
+}
+
+func (a *Adaptor) Init(meta *meta.Meta) {
+
+}
+
+func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
+	if meta.Mode != relaymode.ImagesGenerations {
+		return "", errors.New("only image generations are supported by stability ai")
+	}
+	if isV1Model(meta.ActualModelName) {
+		return fmt.Sprintf("%s/v1/generation/%s/text-to-image", meta.BaseURL, meta.ActualModelName), nil
+	}
+	switch meta.ActualModelName {
+	case "stable-image-ultra":
+		return fmt.Sprintf("%s/v2beta/stable-image/generate/ultra", meta.BaseURL), nil
+	case "stable-image-core":
+		return fmt.Sprintf("%s/v2beta/stable-image/generate/core", meta.BaseURL), nil
+	default:
+		return fmt.Sprintf("%s/v2beta/stable-image/generate/sd3", meta.BaseURL), nil
+	}
+}
+
+func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *meta.Meta) error {
+	req.Header.Set("Content-Type", a.contentType)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+meta.APIKey)
+	return nil
+}
+
+func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.GeneralOpenAIRequest) (any, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	return ConvertImageRequest(*request), nil
+}
+
+func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Reader) (*http.Response, error) {
+	a.contentType = "application/json"
+	if !isV1Model(meta.ActualModelName) {
+		var err error
+		requestBody, a.contentType, err = encodeV2Request(requestBody)
+		if err != nil {
+			return nil, fmt.Errorf("encode request failed: %w", err)
+		}
+	}
+	return adaptor.DoRequestHelper(a, c, meta, requestBody)
+}
+
+func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	err, usage = ImageHandler(c, resp, meta.ActualModelName)
+	return
+}
+
+func (a *Adaptor) GetModelList() []string {
+	return ModelList
+}
+
+func (a *Adaptor) GetChannelName() string {
+	return "stability"
+}
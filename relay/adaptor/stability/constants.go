@@ -0,0 +1,30 @@
+package stability
+
+// https://platform.stability.ai/docs/api-reference
+
+// the engines of the v1 api, they take the size and the number of images
+var v1ModelList = []string{
+	"stable-diffusion-xl-1024-v1-0",
+	"stable-diffusion-v1-6",
+}
+
+// the models of the v2beta stable image api, one image per request, sized by the aspect ratio
+var v2ModelList = []string{
+	"stable-image-ultra",
+	"stable-image-core",
+	"sd3.5-large",
+	"sd3.5-large-turbo",
+	"sd3.5-medium",
+}
+
+var ModelList = append(append([]string{}, v1ModelList...), v2ModelList...)
+
+// the sizes taken by the v1 engines
+var v1Sizes = [][2]int{
+	{1024, 1024}, {1152, 896}, {896, 1152}, {1216, 832}, {832, 1216},
+	{1344, 768}, {768, 1344}, {1536, 640}, {640, 1536},
+}
+
+var v2AspectRatios = [][2]int{
+	{1, 1}, {16, 9}, {9, 16}, {21, 9}, {9, 21}, {3, 2}, {2, 3}, {5, 4}, {4, 5},
+}
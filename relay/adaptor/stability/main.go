@@ -0,0 +1,187 @@
+package stability
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func isV1Model(modelName string) bool {
+	for _, name := range v1ModelList {
+		if name == modelName {
+			return true
+		}
+	}
+	return false
+}
+
+func parseSize(size string) (int, int, bool) {
+	width, height, ok := strings.Cut(size, "x")
+	if !ok {
+		return 0, 0, false
+	}
+	w, err := strconv.Atoi(width)
+	if err != nil || w <= 0 {
+		return 0, 0, false
+	}
+	h, err := strconv.Atoi(height)
+	if err != nil || h <= 0 {
+		return 0, 0, false
+	}
+	return w, h, true
+}
+
+// closestShape is the candidate with the aspect ratio closest to the size, in log scale
+// so that 2:1 is as far from 1:1 as 1:2 is, the first candidate if the size is invalid
+func closestShape(size string, candidates [][2]int) [2]int {
+	w, h, ok := parseSize(size)
+	if !ok {
+		return candidates[0]
+	}
+	ratio := float64(w) / float64(h)
+	closest := candidates[0]
+	minDiff := math.MaxFloat64
+	for _, candidate := range candidates {
+		diff := math.Abs(math.Log(float64(candidate[0]) / float64(candidate[1]) / ratio))
+		if diff < minDiff {
+			closest, minDiff = candidate, diff
+		}
+	}
+	return closest
+}
+
+func ConvertImageRequest(request model.ImageRequest) any {
+	if isV1Model(request.Model) {
+		size := closestShape(request.Size, v1Sizes)
+		return &V1Request{
+			TextPrompts: []TextPrompt{{Text: request.Prompt}},
+			Width:       size[0],
+			Height:      size[1],
+			Samples:     request.N,
+		}
+	}
+	aspectRatio := closestShape(request.Size, v2AspectRatios)
+	v2Request := V2Request{
+		Prompt:       request.Prompt,
+		AspectRatio:  fmt.Sprintf("%d:%d", aspectRatio[0], aspectRatio[1]),
+		OutputFormat: "png",
+	}
+	if strings.HasPrefix(request.Model, "sd3") {
+		v2Request.Model = request.Model
+	}
+	return &v2Request
+}
+
+// encodeV2Request turns the converted request into the multipart form taken by the v2beta api,
+// returning the content type with its boundary
+func encodeV2Request(requestBody io.Reader) (io.Reader, string, error) {
+	var request V2Request
+	err := json.NewDecoder(requestBody).Decode(&request)
+	if err != nil {
+		return nil, "", err
+	}
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	fields := [][2]string{
+		{"prompt", request.Prompt},
+		{"aspect_ratio", request.AspectRatio},
+		{"output_format", request.OutputFormat},
+		{"model", request.Model},
+	}
+	for _, field := range fields {
+		if field[1] == "" {
+			continue
+		}
+		err = writer.WriteField(field[0], field[1])
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, "", err
+	}
+	return &body, writer.FormDataContentType(), nil
+}
+
+func errorHandler(resp *http.Response, responseBody []byte) *model.ErrorWithStatusCode {
+	errWithStatusCode := &model.ErrorWithStatusCode{
+		Error: model.Error{
+			Message: fmt.Sprintf("bad response status code %d", resp.StatusCode),
+			Type:    "stability_error",
+		},
+		StatusCode: resp.StatusCode,
+	}
+	var stabilityError Error
+	if json.Unmarshal(responseBody, &stabilityError) != nil {
+		return errWithStatusCode
+	}
+	errWithStatusCode.Error.Code = stabilityError.Name
+	if stabilityError.Message != "" {
+		errWithStatusCode.Error.Message = stabilityError.Message
+	} else if len(stabilityError.Errors) > 0 {
+		errWithStatusCode.Error.Message = strings.Join(stabilityError.Errors, "; ")
+	}
+	return errWithStatusCode
+}
+
+// ImageHandler returns the images as base64, or as data urls as only the images themselves are returned by Stability AI
+func ImageHandler(c *gin.Context, resp *http.Response, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errorHandler(resp, responseBody), nil
+	}
+	var images []string
+	if isV1Model(modelName) {
+		var v1Response V1Response
+		err = json.Unmarshal(responseBody, &v1Response)
+		for _, artifact := range v1Response.Artifacts {
+			images = append(images, artifact.Base64)
+		}
+	} else {
+		var v2Response V2Response
+		err = json.Unmarshal(responseBody, &v2Response)
+		images = append(images, v2Response.Image)
+	}
+	if err != nil {
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	responseFormat := c.GetString("response_format")
+	imageResponse := openai.ImageResponse{
+		Created: helper.GetTimestamp(),
+	}
+	for _, image := range images {
+		if responseFormat == "b64_json" {
+			imageResponse.Data = append(imageResponse.Data, openai.ImageData{B64Json: image})
+		} else {
+			imageResponse.Data = append(imageResponse.Data, openai.ImageData{Url: "data:image/png;base64," + image})
+		}
+	}
+	jsonResponse, err := json.Marshal(imageResponse)
+	if err != nil {
+		return openai.ErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(jsonResponse)
+	return nil, nil
+}
@@ -0,0 +1,107 @@
+package stability
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestConvertImageRequest(t *testing.T) {
+	Convey("ConvertImageRequest", t, func() {
+		Convey("takes the closest size and the number of images for the v1 engines", func() {
+			request := ConvertImageRequest(model.ImageRequest{
+				Model:  "stable-diffusion-xl-1024-v1-0",
+				Prompt: "a cat",
+				Size:   "1792x1024",
+				N:      2,
+			}).(*V1Request)
+			So(request.TextPrompts, ShouldResemble, []TextPrompt{{Text: "a cat"}})
+			So(request.Width, ShouldEqual, 1344)
+			So(request.Height, ShouldEqual, 768)
+			So(request.Samples, ShouldEqual, 2)
+		})
+
+		Convey("takes the closest aspect ratio for the v2 models", func() {
+			request := ConvertImageRequest(model.ImageRequest{
+				Model:  "stable-image-core",
+				Prompt: "a cat",
+				Size:   "1024x1792",
+			}).(*V2Request)
+			So(request.AspectRatio, ShouldEqual, "9:16")
+			So(request.Model, ShouldBeEmpty)
+
+			request = ConvertImageRequest(model.ImageRequest{
+				Model:  "sd3.5-large",
+				Prompt: "a cat",
+			}).(*V2Request)
+			So(request.AspectRatio, ShouldEqual, "1:1")
+			So(request.Model, ShouldEqual, "sd3.5-large")
+		})
+	})
+}
+
+func TestEncodeV2Request(t *testing.T) {
+	Convey("encodeV2Request", t, func() {
+		jsonStr, _ := json.Marshal(V2Request{Prompt: "a cat", AspectRatio: "1:1", OutputFormat: "png"})
+		body, contentType, err := encodeV2Request(bytes.NewReader(jsonStr))
+		So(err, ShouldBeNil)
+		_, params, err := mime.ParseMediaType(contentType)
+		So(err, ShouldBeNil)
+		form, err := multipart.NewReader(body, params["boundary"]).ReadForm(1 << 20)
+		So(err, ShouldBeNil)
+		So(form.Value["prompt"], ShouldResemble, []string{"a cat"})
+		So(form.Value["aspect_ratio"], ShouldResemble, []string{"1:1"})
+		So(form.Value, ShouldNotContainKey, "model")
+	})
+}
+
+func newResponse(statusCode int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: statusCode,
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestImageHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("ImageHandler", t, func() {
+		Convey("returns the artifacts as base64", func() {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set("response_format", "b64_json")
+			errWithStatusCode, _ := ImageHandler(c, newResponse(http.StatusOK, `{"artifacts":[{"base64":"YQ==","seed":1,"finishReason":"SUCCESS"},{"base64":"Yg==","seed":2,"finishReason":"SUCCESS"}]}`), "stable-diffusion-v1-6")
+			So(errWithStatusCode, ShouldBeNil)
+			So(w.Body.String(), ShouldContainSubstring, `"b64_json":"YQ=="`)
+			So(w.Body.String(), ShouldContainSubstring, `"b64_json":"Yg=="`)
+		})
+
+		Convey("returns a data url by default", func() {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			errWithStatusCode, _ := ImageHandler(c, newResponse(http.StatusOK, `{"image":"YQ==","finish_reason":"SUCCESS","seed":1}`), "stable-image-ultra")
+			So(errWithStatusCode, ShouldBeNil)
+			So(w.Body.String(), ShouldContainSubstring, `"url":"data:image/png;base64,YQ=="`)
+		})
+
+		Convey("reads the errors of both apis", func() {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			errWithStatusCode, _ := ImageHandler(c, newResponse(http.StatusBadRequest, `{"id":"1","name":"invalid_prompts","message":"prompt is too long"}`), "stable-diffusion-v1-6")
+			So(errWithStatusCode.StatusCode, ShouldEqual, http.StatusBadRequest)
+			So(errWithStatusCode.Error.Message, ShouldEqual, "prompt is too long")
+
+			errWithStatusCode, _ = ImageHandler(c, newResponse(http.StatusForbidden, `{"id":"2","name":"content_moderation","errors":["flagged"]}`), "stable-image-core")
+			So(errWithStatusCode.Error.Code, ShouldEqual, "content_moderation")
+			So(errWithStatusCode.Error.Message, ShouldEqual, "flagged")
+		})
+	})
+}
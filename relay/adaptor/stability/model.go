@@ -0,0 +1,45 @@
+package stability
+
+type TextPrompt struct {
+	Text   string  `json:"text"`
+	Weight float64 `json:"weight,omitempty"`
+}
+
+// V1Request is the text to image request of the v1 api
+type V1Request struct {
+	TextPrompts []TextPrompt `json:"text_prompts"`
+	Width       int          `json:"width,omitempty"`
+	Height      int          `json:"height,omitempty"`
+	Samples     int          `json:"samples,omitempty"`
+}
+
+type Artifact struct {
+	Base64       string `json:"base64"`
+	Seed         int64  `json:"seed"`
+	FinishReason string `json:"finishReason"`
+}
+
+type V1Response struct {
+	Artifacts []Artifact `json:"artifacts"`
+}
+
+// V2Request is sent as a multipart form, see Adaptor.DoRequest
+type V2Request struct {
+	Prompt       string `json:"prompt"`
+	AspectRatio  string `json:"aspect_ratio,omitempty"`
+	OutputFormat string `json:"output_format,omitempty"`
+	Model        string `json:"model,omitempty"` // only for the sd3 endpoint
+}
+
+type V2Response struct {
+	Image        string `json:"image"`
+	FinishReason string `json:"finish_reason"`
+	Seed         int64  `json:"seed"`
+}
+
+type Error struct {
+	Id      string   `json:"id"`
+	Name    string   `json:"name"`
+	Message string   `json:"message"` // v1
+	Errors  []string `json:"errors"`  // v2beta
+}
@@ -58,6 +58,11 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.G
 	return tencentRequest, nil
 }
 
+// BuildRequest implements adaptor.ProviderAdapter.
+func (a *Adaptor) BuildRequest(request *model.GeneralOpenAIRequest) (any, error) {
+	return ConvertRequest(*request), nil
+}
+
 func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error) {
 	if request == nil {
 		return nil, errors.New("request is nil")
@@ -70,14 +75,13 @@ func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Read
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
-	if meta.IsStream {
-		var responseText string
-		err, responseText = StreamHandler(c, resp)
-		usage = openai.ResponseText2Usage(responseText, meta.ActualModelName, meta.PromptTokens)
-	} else {
-		err, usage = Handler(c, resp)
+	if meta.IsStream && !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		// the request is rejected with a json response, such as a signature failure
+		nonStreamMeta := *meta
+		nonStreamMeta.IsStream = false
+		return openai.DoProviderResponse(a, c, resp, &nonStreamMeta)
 	}
-	return
+	return openai.DoProviderResponse(a, c, resp, meta)
 }
 
 func (a *Adaptor) GetModelList() []string {
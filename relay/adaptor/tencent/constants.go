@@ -5,4 +5,9 @@ var ModelList = []string{
 	"hunyuan-standard",
 	"hunyuan-standard-256K",
 	"hunyuan-pro",
+	"hunyuan-turbo",
+	"hunyuan-large",
+	"hunyuan-code",
+	"hunyuan-role",
+	"hunyuan-functioncall",
 }
@@ -1,51 +1,91 @@
 package tencent
 
 import (
-	"bufio"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/songquanpeng/one-api/common/render"
-	"io"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/gin-gonic/gin"
-	"github.com/songquanpeng/one-api/common"
-	"github.com/songquanpeng/one-api/common/conv"
 	"github.com/songquanpeng/one-api/common/helper"
-	"github.com/songquanpeng/one-api/common/logger"
-	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/relay/adaptor"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/relay/constant"
+	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
 )
 
-func ConvertRequest(request model.GeneralOpenAIRequest) *ChatRequest {
-	messages := make([]*Message, 0, len(request.Messages))
-	for i := 0; i < len(request.Messages); i++ {
-		message := request.Messages[i]
-		messages = append(messages, &Message{
-			Content: message.StringContent(),
-			Role:    message.Role,
+// convertMessages puts all the system messages at the beginning in one message, and merges consecutive
+// messages of the same role, Hunyuan only accepts user and assistant messages one after another
+func convertMessages(messages []model.Message) []*Message {
+	var systems []string
+	tencentMessages := make([]*Message, 0, len(messages))
+	for _, message := range messages {
+		content := message.StringContent()
+		if message.Role == "system" {
+			systems = append(systems, content)
+			continue
+		}
+		role := "user"
+		if message.Role == "assistant" {
+			role = "assistant"
+		}
+		if len(tencentMessages) == 0 && role == "assistant" {
+			// the messages must start with a question
+			continue
+		}
+		if last := len(tencentMessages) - 1; last >= 0 && tencentMessages[last].Role == role {
+			tencentMessages[last].Content += "\n" + content
+			continue
+		}
+		tencentMessages = append(tencentMessages, &Message{
+			Role:    role,
+			Content: content,
 		})
 	}
-	return &ChatRequest{
-		Model:       &request.Model,
-		Stream:      &request.Stream,
-		Messages:    messages,
-		TopP:        &request.TopP,
-		Temperature: &request.Temperature,
+	if len(systems) > 0 {
+		tencentMessages = append([]*Message{{Role: "system", Content: strings.Join(systems, "\n")}}, tencentMessages...)
+	}
+	return tencentMessages
+}
+
+func ConvertRequest(request model.GeneralOpenAIRequest) *ChatRequest {
+	tencentRequest := ChatRequest{
+		Model:    &request.Model,
+		Stream:   &request.Stream,
+		Messages: convertMessages(request.Messages),
+	}
+	// the recommended values of the model are used if not set
+	if request.TopP != 0 {
+		tencentRequest.TopP = &request.TopP
+	}
+	if request.Temperature != 0 {
+		tencentRequest.Temperature = &request.Temperature
+	}
+	return &tencentRequest
+}
+
+// https://cloud.tencent.com/document/api/1729/105701
+func convertFinishReason(finishReason string) string {
+	switch finishReason {
+	case "sensitive":
+		return "content_filter"
+	case "tool_calls", "length":
+		return finishReason
+	default:
+		return constant.StopFinishReason
 	}
 }
 
-func responseTencent2OpenAI(response *ChatResponse) *openai.TextResponse {
+func responseTencent2OpenAI(response *ChatResponse, modelName string) *openai.TextResponse {
 	fullTextResponse := openai.TextResponse{
+		Id:      fmt.Sprintf("chatcmpl-%s", response.Id),
+		Model:   modelName,
 		Object:  "chat.completion",
 		Created: helper.GetTimestamp(),
 		Usage: model.Usage{
@@ -61,115 +101,102 @@ func responseTencent2OpenAI(response *ChatResponse) *openai.TextResponse {
 				Role:    "assistant",
 				Content: response.Choices[0].Messages.Content,
 			},
-			FinishReason: response.Choices[0].FinishReason,
+			FinishReason: convertFinishReason(response.Choices[0].FinishReason),
 		}
 		fullTextResponse.Choices = append(fullTextResponse.Choices, choice)
 	}
 	return &fullTextResponse
 }
 
-func streamResponseTencent2OpenAI(TencentResponse *ChatResponse) *openai.ChatCompletionsStreamResponse {
+func streamResponseTencent2OpenAI(TencentResponse *ChatResponse, modelName string) *openai.ChatCompletionsStreamResponse {
 	response := openai.ChatCompletionsStreamResponse{
-		Id:      fmt.Sprintf("chatcmpl-%s", random.GetUUID()),
+		Id:      fmt.Sprintf("chatcmpl-%s", TencentResponse.Id),
 		Object:  "chat.completion.chunk",
 		Created: helper.GetTimestamp(),
-		Model:   "tencent-hunyuan",
+		Model:   modelName,
 	}
 	if len(TencentResponse.Choices) > 0 {
 		var choice openai.ChatCompletionsStreamResponseChoice
 		choice.Delta.Content = TencentResponse.Choices[0].Delta.Content
-		if TencentResponse.Choices[0].FinishReason == "stop" {
-			choice.FinishReason = &constant.StopFinishReason
+		if TencentResponse.Choices[0].FinishReason != "" {
+			finishReason := convertFinishReason(TencentResponse.Choices[0].FinishReason)
+			choice.FinishReason = &finishReason
 		}
 		response.Choices = append(response.Choices, choice)
 	}
 	return &response
 }
 
-func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, string) {
-	var responseText string
-	scanner := bufio.NewScanner(resp.Body)
-	scanner.Split(bufio.ScanLines)
-
-	common.SetEventStreamHeaders(c)
-
-	for scanner.Scan() {
-		data := scanner.Text()
-		if len(data) < 5 || !strings.HasPrefix(data, "data:") {
-			continue
-		}
-		data = strings.TrimPrefix(data, "data:")
-
-		var tencentResponse ChatResponse
-		err := json.Unmarshal([]byte(data), &tencentResponse)
-		if err != nil {
-			logger.SysError("error unmarshalling stream response: " + err.Error())
-			continue
-		}
-
-		response := streamResponseTencent2OpenAI(&tencentResponse)
-		if len(response.Choices) != 0 {
-			responseText += conv.AsString(response.Choices[0].Delta.Content)
-		}
-
-		err = render.ObjectData(c, response)
-		if err != nil {
-			logger.SysError(err.Error())
+func errorWrapper(tencentError *Error, statusCode int) *model.ErrorWithStatusCode {
+	if statusCode == http.StatusOK {
+		// errors are returned with 200
+		statusCode = http.StatusInternalServerError
+		if strings.HasPrefix(tencentError.Code, "AuthFailure") {
+			statusCode = http.StatusUnauthorized
 		}
 	}
-
-	if err := scanner.Err(); err != nil {
-		logger.SysError("error reading stream: " + err.Error())
-	}
-
-	render.Done(c)
-
-	err := resp.Body.Close()
-	if err != nil {
-		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), ""
+	return &model.ErrorWithStatusCode{
+		Error: model.Error{
+			Message: tencentError.Message,
+			Type:    "tencent_error",
+			Code:    tencentError.Code,
+		},
+		StatusCode: statusCode,
 	}
-
-	return nil, responseText
 }
 
-func Handler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.Usage) {
-	var TencentResponse ChatResponse
+// ParseResponse implements adaptor.ProviderAdapter.
+func (a *Adaptor) ParseResponse(meta *meta.Meta, body []byte) (*openai.TextResponse, *model.ErrorWithStatusCode) {
 	var responseP ChatResponseP
-	responseBody, err := io.ReadAll(resp.Body)
+	err := json.Unmarshal(body, &responseP)
 	if err != nil {
-		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+		return nil, openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
 	}
-	err = resp.Body.Close()
-	if err != nil {
-		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	if responseP.Response.Error.Code != "" {
+		return nil, errorWrapper(&responseP.Response.Error, http.StatusOK)
 	}
-	err = json.Unmarshal(responseBody, &responseP)
+	return responseTencent2OpenAI(&responseP.Response, meta.ActualModelName), nil
+}
+
+// ParseStreamChunk implements adaptor.ProviderAdapter.
+func (a *Adaptor) ParseStreamChunk(meta *meta.Meta, data string) (*openai.ChatCompletionsStreamResponse, error) {
+	var tencentResponse ChatResponse
+	err := json.Unmarshal([]byte(data), &tencentResponse)
 	if err != nil {
-		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+		return nil, err
 	}
-	TencentResponse = responseP.Response
-	if TencentResponse.Error.Code != 0 {
-		return &model.ErrorWithStatusCode{
+	if tencentResponse.ErrorMsg != nil && tencentResponse.ErrorMsg.Code != 0 {
+		return nil, &adaptor.StreamError{Err: &model.ErrorWithStatusCode{
 			Error: model.Error{
-				Message: TencentResponse.Error.Message,
-				Code:    TencentResponse.Error.Code,
+				Message: tencentResponse.ErrorMsg.Msg,
+				Type:    "tencent_error",
+				Code:    tencentResponse.ErrorMsg.Code,
 			},
-			StatusCode: resp.StatusCode,
-		}, nil
+			StatusCode: http.StatusInternalServerError,
+		}}
 	}
-	fullTextResponse := responseTencent2OpenAI(&TencentResponse)
-	fullTextResponse.Model = "hunyuan"
-	jsonResponse, err := json.Marshal(fullTextResponse)
-	if err != nil {
-		return openai.ErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	return streamResponseTencent2OpenAI(&tencentResponse, meta.ActualModelName), nil
+}
+
+// ExtractUsage implements adaptor.ProviderAdapter, each chunk of a stream carries the usage so far.
+func (a *Adaptor) ExtractUsage(data []byte) *model.Usage {
+	var tencentResponse struct {
+		ChatResponse
+		Response *ChatResponse `json:"Response,omitempty"`
 	}
-	c.Writer.Header().Set("Content-Type", "application/json")
-	c.Writer.WriteHeader(resp.StatusCode)
-	_, err = c.Writer.Write(jsonResponse)
-	if err != nil {
-		return openai.ErrorWrapper(err, "write_response_body_failed", http.StatusInternalServerError), nil
+	_ = json.Unmarshal(data, &tencentResponse)
+	usage := tencentResponse.Usage
+	if tencentResponse.Response != nil {
+		usage = tencentResponse.Response.Usage
+	}
+	if usage.TotalTokens == 0 {
+		return nil
+	}
+	return &model.Usage{
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
 	}
-	return nil, &fullTextResponse.Usage
 }
 
 func ParseConfig(config string) (appId int64, secretId string, secretKey string, err error) {
@@ -0,0 +1,71 @@
+package tencent
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestConvertMessages(t *testing.T) {
+	Convey("convertMessages", t, func() {
+		messages := convertMessages([]model.Message{
+			{Role: "assistant", Content: "hello"},
+			{Role: "system", Content: "be brief"},
+			{Role: "user", Content: "hi"},
+			{Role: "user", Content: "how are you"},
+			{Role: "assistant", Content: "fine"},
+			{Role: "tool", Content: "42"},
+			{Role: "system", Content: "be nice"},
+		})
+		So(messages, ShouldResemble, []*Message{
+			{Role: "system", Content: "be brief\nbe nice"},
+			{Role: "user", Content: "hi\nhow are you"},
+			{Role: "assistant", Content: "fine"},
+			{Role: "user", Content: "42"},
+		})
+	})
+}
+
+func TestDoResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("DoResponse", t, func() {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		streamMeta := &meta.Meta{IsStream: true, PromptTokens: 1, ActualModelName: "hunyuan-lite"}
+
+		Convey("ends the stream at an error event", func() {
+			resp := &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+				Body: io.NopCloser(strings.NewReader("data: {\"Id\":\"1\",\"Choices\":[{\"Delta\":{\"Content\":\"Hi\"}}],\"Usage\":{\"PromptTokens\":3,\"CompletionTokens\":1,\"TotalTokens\":4}}\n\n" +
+					"data: {\"ErrorMsg\":{\"Code\":2001,\"Msg\":\"inner error\"}}\n\n" +
+					"data: {\"Id\":\"1\",\"Choices\":[{\"Delta\":{\"Content\":\" there\"}}]}\n\n")),
+			}
+			usage, err := (&Adaptor{}).DoResponse(c, resp, streamMeta)
+			So(err, ShouldBeNil)
+			So(usage.TotalTokens, ShouldEqual, 4)
+			body := w.Body.String()
+			So(body, ShouldContainSubstring, `"content":"Hi"`)
+			So(body, ShouldNotContainSubstring, "there")
+		})
+
+		Convey("relays the json rejection of a stream as an error", func() {
+			resp := &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(`{"Response":{"Error":{"Code":"AuthFailure.SignatureFailure","Message":"bad signature"}}}`)),
+			}
+			_, err := (&Adaptor{}).DoResponse(c, resp, streamMeta)
+			So(err, ShouldNotBeNil)
+			So(err.StatusCode, ShouldEqual, http.StatusUnauthorized)
+		})
+	})
+}
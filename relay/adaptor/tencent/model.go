@@ -44,10 +44,15 @@ type ChatRequest struct {
 }
 
 type Error struct {
-	Code    int    `json:"Code"`
+	Code    string `json:"Code"`
 	Message string `json:"Message"`
 }
 
+type StreamError struct {
+	Code int    `json:"Code"`
+	Msg  string `json:"Msg"`
+}
+
 type Usage struct {
 	PromptTokens     int `json:"PromptTokens"`
 	CompletionTokens int `json:"CompletionTokens"`
@@ -66,8 +71,10 @@ type ChatResponse struct {
 	Id      string            `json:"Id,omitempty"`      // 会话 id
 	Usage   Usage             `json:"Usage,omitempty"`   // token 数量
 	Error   Error             `json:"Error,omitempty"`   // 错误信息 注意：此字段可能返回 null，表示取不到有效值
-	Note    string            `json:"Note,omitempty"`    // 注释
-	ReqID   string            `json:"Req_id,omitempty"`  // 唯一请求 Id，每次请求都会返回。用于反馈接口入参
+	// 流式调用中途出错时返回
+	ErrorMsg *StreamError `json:"ErrorMsg,omitempty"`
+	Note     string       `json:"Note,omitempty"`   // 注释
+	ReqID    string       `json:"Req_id,omitempty"` // 唯一请求 Id，每次请求都会返回。用于反馈接口入参
 }
 
 type ChatResponseP struct {
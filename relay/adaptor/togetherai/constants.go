@@ -4,7 +4,14 @@ package togetherai
 
 var ModelList = []string{
 	"meta-llama/Llama-3-70b-chat-hf",
+	"meta-llama/Meta-Llama-3.1-8B-Instruct-Turbo",
+	"meta-llama/Meta-Llama-3.1-70B-Instruct-Turbo",
+	"meta-llama/Meta-Llama-3.1-405B-Instruct-Turbo",
+	"meta-llama/Llama-3.3-70B-Instruct-Turbo",
 	"deepseek-ai/deepseek-coder-33b-instruct",
+	"deepseek-ai/DeepSeek-V3",
 	"mistralai/Mixtral-8x22B-Instruct-v0.1",
+	"mistralai/Mixtral-8x7B-Instruct-v0.1",
 	"Qwen/Qwen1.5-72B-Chat",
+	"Qwen/Qwen2.5-72B-Instruct-Turbo",
 }
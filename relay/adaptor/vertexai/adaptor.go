@@ -0,0 +1,137 @@
+package vertexai
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/gemini"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+const defaultRegion = "us-central1"
+
+type Adaptor struct {
+	meta *meta.Meta
+}
+
+func (a *Adaptor) Init(meta *meta.Meta) {
+	a.meta = meta
+}
+
+func getBaseURL(meta *meta.Meta, region string) string {
+	if meta.BaseURL != "" {
+		return meta.BaseURL
+	}
+	if region == "global" {
+		return "https://aiplatform.googleapis.com"
+	}
+	return fmt.Sprintf("https://%s-aiplatform.googleapis.com", region)
+}
+
+// GetRequestURL builds the regional endpoint, the project is the one of the service account.
+// https://cloud.google.com/vertex-ai/generative-ai/docs/model-reference/inference
+func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
+	serviceAccount, err := ParseServiceAccount(meta.APIKey)
+	if err != nil {
+		return "", err
+	}
+	region := helper.AssignOrDefault(meta.Config.Region, defaultRegion)
+	baseURL := getBaseURL(meta, region)
+	action := "generateContent"
+	if meta.Mode == relaymode.Embeddings {
+		action = "predict"
+	} else if meta.IsStream {
+		action = "streamGenerateContent?alt=sse"
+	}
+	return fmt.Sprintf("%s/v1/projects/%s/locations/%s/publishers/google/models/%s:%s",
+		baseURL, serviceAccount.ProjectId, region, meta.ActualModelName, action), nil
+}
+
+func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *meta.Meta) error {
+	adaptor.SetupCommonRequestHeader(c, req, meta)
+	accessToken, err := GetAccessToken(meta.APIKey)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	return nil
+}
+
+func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.GeneralOpenAIRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	switch relayMode {
+	case relaymode.Embeddings:
+		return ConvertEmbeddingRequest(*request), nil
+	default:
+		return gemini.ConvertCachedRequest(c, *request, func(cache *gemini.CachedContent) (*gemini.CachedContent, error) {
+			return a.createCachedContent(c, cache)
+		}), nil
+	}
+}
+
+// https://cloud.google.com/vertex-ai/generative-ai/docs/context-cache/context-cache-create
+func (a *Adaptor) createCachedContent(c *gin.Context, cache *gemini.CachedContent) (*gemini.CachedContent, error) {
+	serviceAccount, err := ParseServiceAccount(a.meta.APIKey)
+	if err != nil {
+		return nil, err
+	}
+	region := helper.AssignOrDefault(a.meta.Config.Region, defaultRegion)
+	cache.Model = fmt.Sprintf("projects/%s/locations/%s/publishers/google/models/%s", serviceAccount.ProjectId, region, a.meta.ActualModelName)
+	url := fmt.Sprintf("%s/v1/projects/%s/locations/%s/cachedContents", getBaseURL(a.meta, region), serviceAccount.ProjectId, region)
+	return gemini.CreateCachedContent(c.Request.Context(), url, func(req *http.Request) error {
+		accessToken, err := GetAccessToken(a.meta.APIKey)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		return nil
+	}, cache)
+}
+
+func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	return request, nil
+}
+
+func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Reader) (*http.Response, error) {
+	return adaptor.DoRequestHelper(a, c, meta, requestBody)
+}
+
+func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	if meta.IsStream {
+		var responseText string
+		err, responseText, usage = gemini.StreamHandler(c, resp)
+		if usage == nil {
+			usage = openai.ResponseText2Usage(responseText, meta.ActualModelName, meta.PromptTokens)
+		}
+	} else {
+		switch meta.Mode {
+		case relaymode.Embeddings:
+			err, usage = EmbeddingHandler(c, resp, meta.ActualModelName)
+		default:
+			err, usage = gemini.Handler(c, resp, meta.PromptTokens, meta.ActualModelName)
+		}
+	}
+	gemini.SetCacheStorage(c, usage)
+	return
+}
+
+func (a *Adaptor) GetModelList() []string {
+	return ModelList
+}
+
+func (a *Adaptor) GetChannelName() string {
+	return "vertex ai"
+}
@@ -0,0 +1,9 @@
+package vertexai
+
+// https://cloud.google.com/vertex-ai/generative-ai/docs/learn/model-versioning
+
+var ModelList = []string{
+	"gemini-1.0-pro-001", "gemini-1.0-pro-vision-001",
+	"gemini-1.5-pro", "gemini-1.5-pro-001", "gemini-1.5-flash", "gemini-1.5-flash-001",
+	"text-embedding-004", "text-multilingual-embedding-002",
+}
@@ -0,0 +1,86 @@
+package vertexai
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://cloud.google.com/vertex-ai/generative-ai/docs/model-reference/text-embeddings-api
+
+func ConvertEmbeddingRequest(request model.GeneralOpenAIRequest) *EmbeddingRequest {
+	inputs := request.ParseInput()
+	instances := make([]EmbeddingInstance, len(inputs))
+	for i, input := range inputs {
+		instances[i] = EmbeddingInstance{
+			Content: input,
+		}
+	}
+	embeddingRequest := EmbeddingRequest{
+		Instances: instances,
+	}
+	if request.Dimensions > 0 {
+		embeddingRequest.Parameters = &EmbeddingParameters{
+			OutputDimensionality: request.Dimensions,
+		}
+	}
+	return &embeddingRequest
+}
+
+func embeddingResponseVertexAI2OpenAI(response *EmbeddingResponse, modelName string) *openai.EmbeddingResponse {
+	openAIEmbeddingResponse := openai.EmbeddingResponse{
+		Object: "list",
+		Data:   make([]openai.EmbeddingResponseItem, 0, len(response.Predictions)),
+		Model:  modelName,
+	}
+	for i, prediction := range response.Predictions {
+		openAIEmbeddingResponse.Data = append(openAIEmbeddingResponse.Data, openai.EmbeddingResponseItem{
+			Object:    `embedding`,
+			Index:     i,
+			Embedding: prediction.Embeddings.Values,
+		})
+		openAIEmbeddingResponse.Usage.PromptTokens += prediction.Embeddings.Statistics.TokenCount
+	}
+	openAIEmbeddingResponse.Usage.TotalTokens = openAIEmbeddingResponse.Usage.PromptTokens
+	return &openAIEmbeddingResponse
+}
+
+func EmbeddingHandler(c *gin.Context, resp *http.Response, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
+	var vertexAIEmbeddingResponse EmbeddingResponse
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = json.Unmarshal(responseBody, &vertexAIEmbeddingResponse)
+	if err != nil {
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if vertexAIEmbeddingResponse.Error != nil {
+		return &model.ErrorWithStatusCode{
+			Error: model.Error{
+				Message: vertexAIEmbeddingResponse.Error.Message,
+				Type:    "vertex_ai_error",
+				Param:   "",
+				Code:    vertexAIEmbeddingResponse.Error.Code,
+			},
+			StatusCode: resp.StatusCode,
+		}, nil
+	}
+	fullTextResponse := embeddingResponseVertexAI2OpenAI(&vertexAIEmbeddingResponse, modelName)
+	jsonResponse, err := json.Marshal(fullTextResponse)
+	if err != nil {
+		return openai.ErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(jsonResponse)
+	return nil, &fullTextResponse.Usage
+}
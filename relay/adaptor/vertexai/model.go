@@ -0,0 +1,50 @@
+package vertexai
+
+import "github.com/songquanpeng/one-api/relay/adaptor/gemini"
+
+type ServiceAccount struct {
+	Type         string `json:"type"`
+	ProjectId    string `json:"project_id"`
+	PrivateKeyId string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	TokenURI     string `json:"token_uri"`
+}
+
+type TokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error,omitempty"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+type EmbeddingInstance struct {
+	Content  string `json:"content"`
+	TaskType string `json:"task_type,omitempty"`
+}
+
+type EmbeddingParameters struct {
+	OutputDimensionality int `json:"outputDimensionality,omitempty"`
+}
+
+type EmbeddingRequest struct {
+	Instances  []EmbeddingInstance  `json:"instances"`
+	Parameters *EmbeddingParameters `json:"parameters,omitempty"`
+}
+
+type EmbeddingStatistics struct {
+	TokenCount int  `json:"token_count"`
+	Truncated  bool `json:"truncated"`
+}
+
+type EmbeddingPrediction struct {
+	Embeddings struct {
+		Values     []float64           `json:"values"`
+		Statistics EmbeddingStatistics `json:"statistics"`
+	} `json:"embeddings"`
+}
+
+type EmbeddingResponse struct {
+	Predictions []EmbeddingPrediction `json:"predictions"`
+	Error       *gemini.Error         `json:"error,omitempty"`
+}
@@ -0,0 +1,102 @@
+package vertexai
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/credential"
+)
+
+// https://developers.google.com/identity/protocols/oauth2/service-account#httprest
+
+const (
+	defaultTokenURI = "https://oauth2.googleapis.com/token"
+	scope           = "https://www.googleapis.com/auth/cloud-platform"
+)
+
+func init() {
+	credential.Register("gcp", getAccessToken)
+}
+
+// ParseServiceAccount parses the key of a channel, which is the JSON key file of a service account
+func ParseServiceAccount(key string) (*ServiceAccount, error) {
+	var serviceAccount ServiceAccount
+	err := json.Unmarshal([]byte(key), &serviceAccount)
+	if err != nil {
+		return nil, errors.New("invalid service account key, should be the JSON key file of a service account")
+	}
+	if serviceAccount.ClientEmail == "" || serviceAccount.PrivateKey == "" || serviceAccount.ProjectId == "" {
+		return nil, errors.New("service account key is missing client_email, private_key or project_id")
+	}
+	return &serviceAccount, nil
+}
+
+// GetAccessToken returns a cached OAuth access token of the service account, it's renewed in the background before it expires
+func GetAccessToken(key string) (string, error) {
+	return credential.Get("gcp", key)
+}
+
+func getAccessToken(key string) (*credential.Token, error) {
+	serviceAccount, err := ParseServiceAccount(key)
+	if err != nil {
+		return nil, err
+	}
+	tokenURI := serviceAccount.TokenURI
+	if tokenURI == "" {
+		tokenURI = defaultTokenURI
+	}
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(serviceAccount.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	assertion := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   serviceAccount.ClientEmail,
+		"scope": scope,
+		"aud":   tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	assertion.Header["kid"] = serviceAccount.PrivateKeyId
+	signedAssertion, err := assertion.SignedString(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {signedAssertion},
+	}
+	req, err := http.NewRequest("POST", tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	res, err := client.ImpatientHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var tokenResponse TokenResponse
+	err = json.NewDecoder(res.Body).Decode(&tokenResponse)
+	if err != nil {
+		return nil, err
+	}
+	if tokenResponse.Error != "" {
+		return nil, errors.New(tokenResponse.Error + ": " + tokenResponse.ErrorDescription)
+	}
+	if tokenResponse.AccessToken == "" {
+		return nil, errors.New("getAccessToken get empty access token")
+	}
+	return &credential.Token{
+		AccessToken: tokenResponse.AccessToken,
+		ExpiresAt:   now.Add(time.Duration(tokenResponse.ExpiresIn) * time.Second),
+	}, nil
+}
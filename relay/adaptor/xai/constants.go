@@ -0,0 +1,12 @@
+package xai
+
+// https://docs.x.ai/docs/models
+
+var ModelList = []string{
+	"grok-3-mini",
+	"grok-3",
+	"grok-2-1212",
+	"grok-2-vision-1212",
+	"grok-beta",
+	"grok-vision-beta",
+}
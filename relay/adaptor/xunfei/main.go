@@ -1,6 +1,7 @@
 package xunfei
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
@@ -16,6 +17,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/conv"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/common/random"
@@ -40,7 +42,7 @@ func requestOpenAI2Xunfei(request model.GeneralOpenAIRequest, xunfeiAppId string
 	xunfeiRequest.Header.AppId = xunfeiAppId
 	xunfeiRequest.Parameter.Chat.Domain = domain
 	xunfeiRequest.Parameter.Chat.Temperature = request.Temperature
-	xunfeiRequest.Parameter.Chat.TopK = request.N
+	xunfeiRequest.Parameter.Chat.TopK = request.TopK
 	xunfeiRequest.Parameter.Chat.MaxTokens = request.MaxTokens
 	xunfeiRequest.Payload.Message.Text = messages
 
@@ -75,7 +77,14 @@ func getToolCalls(response *ChatResponse) []model.Tool {
 	return toolCalls
 }
 
-func responseXunfei2OpenAI(response *ChatResponse) *openai.TextResponse {
+func getFinishReason(response *ChatResponse) string {
+	if len(response.Payload.Choices.Text) != 0 && response.Payload.Choices.Text[0].FunctionCall != nil {
+		return "tool_calls"
+	}
+	return constant.StopFinishReason
+}
+
+func responseXunfei2OpenAI(response *ChatResponse, modelName string) *openai.TextResponse {
 	if len(response.Payload.Choices.Text) == 0 {
 		response.Payload.Choices.Text = []ChatResponseTextItem{
 			{
@@ -90,10 +99,11 @@ func responseXunfei2OpenAI(response *ChatResponse) *openai.TextResponse {
 			Content:   response.Payload.Choices.Text[0].Content,
 			ToolCalls: getToolCalls(response),
 		},
-		FinishReason: constant.StopFinishReason,
+		FinishReason: getFinishReason(response),
 	}
 	fullTextResponse := openai.TextResponse{
 		Id:      fmt.Sprintf("chatcmpl-%s", random.GetUUID()),
+		Model:   modelName,
 		Object:  "chat.completion",
 		Created: helper.GetTimestamp(),
 		Choices: []openai.TextResponseChoice{choice},
@@ -102,7 +112,7 @@ func responseXunfei2OpenAI(response *ChatResponse) *openai.TextResponse {
 	return &fullTextResponse
 }
 
-func streamResponseXunfei2OpenAI(xunfeiResponse *ChatResponse) *openai.ChatCompletionsStreamResponse {
+func streamResponseXunfei2OpenAI(xunfeiResponse *ChatResponse, modelName string) *openai.ChatCompletionsStreamResponse {
 	if len(xunfeiResponse.Payload.Choices.Text) == 0 {
 		xunfeiResponse.Payload.Choices.Text = []ChatResponseTextItem{
 			{
@@ -114,13 +124,14 @@ func streamResponseXunfei2OpenAI(xunfeiResponse *ChatResponse) *openai.ChatCompl
 	choice.Delta.Content = xunfeiResponse.Payload.Choices.Text[0].Content
 	choice.Delta.ToolCalls = getToolCalls(xunfeiResponse)
 	if xunfeiResponse.Payload.Choices.Status == 2 {
-		choice.FinishReason = &constant.StopFinishReason
+		finishReason := getFinishReason(xunfeiResponse)
+		choice.FinishReason = &finishReason
 	}
 	response := openai.ChatCompletionsStreamResponse{
 		Id:      fmt.Sprintf("chatcmpl-%s", random.GetUUID()),
 		Object:  "chat.completion.chunk",
 		Created: helper.GetTimestamp(),
-		Model:   "SparkDesk",
+		Model:   modelName,
 		Choices: []openai.ChatCompletionsStreamResponseChoice{choice},
 	}
 	return &response
@@ -154,19 +165,25 @@ func buildXunfeiAuthUrl(hostUrl string, apiKey, apiSecret string) string {
 
 func StreamHandler(c *gin.Context, meta *meta.Meta, textRequest model.GeneralOpenAIRequest, appId string, apiSecret string, apiKey string) (*model.ErrorWithStatusCode, *model.Usage) {
 	domain, authUrl := getXunfeiAuthUrl(meta.Config.APIVersion, apiKey, apiSecret)
-	dataChan, stopChan, err := xunfeiMakeRequest(textRequest, domain, authUrl, appId)
+	dataChan, stopChan, err := xunfeiMakeRequest(c.Request.Context(), textRequest, domain, authUrl, appId)
 	if err != nil {
 		return openai.ErrorWrapper(err, "xunfei_request_failed", http.StatusInternalServerError), nil
 	}
+	// the first message has been checked for errors already
 	common.SetEventStreamHeaders(c)
 	var usage model.Usage
+	var responseText string
 	c.Stream(func(w io.Writer) bool {
 		select {
 		case xunfeiResponse := <-dataChan:
-			usage.PromptTokens += xunfeiResponse.Payload.Usage.Text.PromptTokens
-			usage.CompletionTokens += xunfeiResponse.Payload.Usage.Text.CompletionTokens
-			usage.TotalTokens += xunfeiResponse.Payload.Usage.Text.TotalTokens
-			response := streamResponseXunfei2OpenAI(&xunfeiResponse)
+			// usage is only sent with the last message
+			if xunfeiResponse.Payload.Usage.Text.TotalTokens != 0 {
+				usage = xunfeiResponse.Payload.Usage.Text
+			}
+			response := streamResponseXunfei2OpenAI(&xunfeiResponse, textRequest.Model)
+			if len(response.Choices) != 0 {
+				responseText += conv.AsString(response.Choices[0].Delta.Content)
+			}
 			jsonResponse, err := json.Marshal(response)
 			if err != nil {
 				logger.SysError("error marshalling stream response: " + err.Error())
@@ -179,29 +196,36 @@ func StreamHandler(c *gin.Context, meta *meta.Meta, textRequest model.GeneralOpe
 			return false
 		}
 	})
+	if usage.TotalTokens == 0 {
+		return nil, openai.ResponseText2Usage(responseText, textRequest.Model, meta.PromptTokens)
+	}
 	return nil, &usage
 }
 
 func Handler(c *gin.Context, meta *meta.Meta, textRequest model.GeneralOpenAIRequest, appId string, apiSecret string, apiKey string) (*model.ErrorWithStatusCode, *model.Usage) {
 	domain, authUrl := getXunfeiAuthUrl(meta.Config.APIVersion, apiKey, apiSecret)
-	dataChan, stopChan, err := xunfeiMakeRequest(textRequest, domain, authUrl, appId)
+	dataChan, stopChan, err := xunfeiMakeRequest(c.Request.Context(), textRequest, domain, authUrl, appId)
 	if err != nil {
 		return openai.ErrorWrapper(err, "xunfei_request_failed", http.StatusInternalServerError), nil
 	}
 	var usage model.Usage
 	var content string
 	var xunfeiResponse ChatResponse
+	var functionCall *model.Function
 	stop := false
 	for !stop {
 		select {
 		case xunfeiResponse = <-dataChan:
+			if xunfeiResponse.Payload.Usage.Text.TotalTokens != 0 {
+				usage = xunfeiResponse.Payload.Usage.Text
+			}
 			if len(xunfeiResponse.Payload.Choices.Text) == 0 {
 				continue
 			}
 			content += xunfeiResponse.Payload.Choices.Text[0].Content
-			usage.PromptTokens += xunfeiResponse.Payload.Usage.Text.PromptTokens
-			usage.CompletionTokens += xunfeiResponse.Payload.Usage.Text.CompletionTokens
-			usage.TotalTokens += xunfeiResponse.Payload.Usage.Text.TotalTokens
+			if xunfeiResponse.Payload.Choices.Text[0].FunctionCall != nil {
+				functionCall = xunfeiResponse.Payload.Choices.Text[0].FunctionCall
+			}
 		case stop = <-stopChan:
 		}
 	}
@@ -209,8 +233,13 @@ func Handler(c *gin.Context, meta *meta.Meta, textRequest model.GeneralOpenAIReq
 		return openai.ErrorWrapper(errors.New("xunfei empty response detected"), "xunfei_empty_response_detected", http.StatusInternalServerError), nil
 	}
 	xunfeiResponse.Payload.Choices.Text[0].Content = content
+	xunfeiResponse.Payload.Choices.Text[0].FunctionCall = functionCall
+	if usage.TotalTokens == 0 {
+		usage = *openai.ResponseText2Usage(content, textRequest.Model, meta.PromptTokens)
+	}
+	xunfeiResponse.Payload.Usage.Text = usage
 
-	response := responseXunfei2OpenAI(&xunfeiResponse)
+	response := responseXunfei2OpenAI(&xunfeiResponse, textRequest.Model)
 	jsonResponse, err := json.Marshal(response)
 	if err != nil {
 		return openai.ErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
@@ -220,52 +249,84 @@ func Handler(c *gin.Context, meta *meta.Meta, textRequest model.GeneralOpenAIReq
 	return nil, &usage
 }
 
-func xunfeiMakeRequest(textRequest model.GeneralOpenAIRequest, domain, authUrl, appId string) (chan ChatResponse, chan bool, error) {
+func parseXunfeiResponse(msg []byte) (*ChatResponse, error) {
+	var response ChatResponse
+	err := json.Unmarshal(msg, &response)
+	if err != nil {
+		return nil, err
+	}
+	if response.Header.Code != 0 {
+		return nil, fmt.Errorf("%s (code %d, sid %s)", response.Header.Message, response.Header.Code, response.Header.Sid)
+	}
+	return &response, nil
+}
+
+// xunfeiMakeRequest returns an error if the first message is an error, later errors end the response early.
+// The connection is closed once the last message is read, or the client has gone away.
+func xunfeiMakeRequest(ctx context.Context, textRequest model.GeneralOpenAIRequest, domain, authUrl, appId string) (chan ChatResponse, chan bool, error) {
 	d := websocket.Dialer{
 		HandshakeTimeout: 5 * time.Second,
 	}
 	conn, resp, err := d.Dial(authUrl, nil)
-	if err != nil || resp.StatusCode != 101 {
+	if err != nil {
+		if resp != nil {
+			// the reason of a failed handshake, such as an invalid signature, is in the body
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			_ = resp.Body.Close()
+			return nil, nil, fmt.Errorf("%s: %s", err.Error(), strings.TrimSpace(string(body)))
+		}
 		return nil, nil, err
 	}
 	data := requestOpenAI2Xunfei(textRequest, appId, domain)
 	err = conn.WriteJSON(data)
 	if err != nil {
+		_ = conn.Close()
 		return nil, nil, err
 	}
 	_, msg, err := conn.ReadMessage()
 	if err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+	response, err := parseXunfeiResponse(msg)
+	if err != nil {
+		_ = conn.Close()
 		return nil, nil, err
 	}
 
 	dataChan := make(chan ChatResponse)
 	stopChan := make(chan bool)
 	go func() {
+		defer func() {
+			err := conn.Close()
+			if err != nil {
+				logger.SysError("error closing websocket connection: " + err.Error())
+			}
+		}()
 		for {
-			if msg == nil {
-				_, msg, err = conn.ReadMessage()
-				if err != nil {
-					logger.SysError("error reading stream response: " + err.Error())
-					break
-				}
+			select {
+			case dataChan <- *response:
+			case <-ctx.Done():
+				return
 			}
-			var response ChatResponse
-			err = json.Unmarshal(msg, &response)
+			if response.Payload.Choices.Status == 2 {
+				break
+			}
+			_, msg, err := conn.ReadMessage()
 			if err != nil {
-				logger.SysError("error unmarshalling stream response: " + err.Error())
+				logger.SysError("error reading stream response: " + err.Error())
 				break
 			}
-			msg = nil
-			dataChan <- response
-			if response.Payload.Choices.Status == 2 {
-				err := conn.Close()
-				if err != nil {
-					logger.SysError("error closing websocket connection: " + err.Error())
-				}
+			response, err = parseXunfeiResponse(msg)
+			if err != nil {
+				logger.SysError("error in xunfei stream response: " + err.Error())
 				break
 			}
 		}
-		stopChan <- true
+		select {
+		case stopChan <- true:
+		case <-ctx.Done():
+		}
 	}()
 
 	return dataChan, stopChan, nil
@@ -283,7 +344,7 @@ func parseAPIVersionByModelName(modelName string) string {
 func apiVersion2domain(apiVersion string) string {
 	switch apiVersion {
 	case "v1.1":
-		return "general"
+		return "lite"
 	case "v2.1":
 		return "generalv2"
 	case "v3.1":
@@ -0,0 +1,67 @@
+package xunfei
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func newSparkServer(messages []string) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _, err = conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		for _, message := range messages {
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(message))
+		}
+	}))
+}
+
+func TestXunfeiMakeRequest(t *testing.T) {
+	request := model.GeneralOpenAIRequest{Messages: []model.Message{{Role: "user", Content: "hi"}}}
+	Convey("xunfeiMakeRequest", t, func() {
+		Convey("reads until the last message", func() {
+			server := newSparkServer([]string{
+				`{"header":{"code":0},"payload":{"choices":{"status":0,"text":[{"content":"Hel"}]}}}`,
+				`{"header":{"code":0},"payload":{"choices":{"status":2,"text":[{"content":"lo"}]},"usage":{"text":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}}}`,
+			})
+			defer server.Close()
+			dataChan, stopChan, err := xunfeiMakeRequest(context.Background(), request, "lite", "ws"+strings.TrimPrefix(server.URL, "http"), "app")
+			So(err, ShouldBeNil)
+			var content string
+			var usage model.Usage
+			stop := false
+			for !stop {
+				select {
+				case response := <-dataChan:
+					content += response.Payload.Choices.Text[0].Content
+					usage = response.Payload.Usage.Text
+				case stop = <-stopChan:
+				}
+			}
+			So(content, ShouldEqual, "Hello")
+			So(usage.TotalTokens, ShouldEqual, 5)
+		})
+
+		Convey("returns the error of the first message", func() {
+			server := newSparkServer([]string{`{"header":{"code":10013,"message":"invalid app id","sid":"abc"}}`})
+			defer server.Close()
+			_, _, err := xunfeiMakeRequest(context.Background(), request, "lite", "ws"+strings.TrimPrefix(server.URL, "http"), "app")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "invalid app id")
+		})
+	})
+}
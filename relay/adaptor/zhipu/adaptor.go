@@ -51,7 +51,10 @@ func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 
 func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *meta.Meta) error {
 	adaptor.SetupCommonRequestHeader(c, req, meta)
-	token := GetToken(meta.APIKey)
+	token, err := GetToken(meta.APIKey)
+	if err != nil {
+		return err
+	}
 	req.Header.Set("Authorization", token)
 	return nil
 }
@@ -65,13 +68,17 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.G
 		baiduEmbeddingRequest, err := ConvertEmbeddingRequest(*request)
 		return baiduEmbeddingRequest, err
 	default:
-		// TopP (0.0, 1.0)
-		request.TopP = math.Min(0.99, request.TopP)
-		request.TopP = math.Max(0.01, request.TopP)
+		// TopP (0.0, 1.0), left out if not given, so upstream uses its default
+		if request.TopP != 0 {
+			request.TopP = math.Min(0.99, request.TopP)
+			request.TopP = math.Max(0.01, request.TopP)
+		}
 
 		// Temperature (0.0, 1.0)
-		request.Temperature = math.Min(0.99, request.Temperature)
-		request.Temperature = math.Max(0.01, request.Temperature)
+		if request.Temperature != 0 {
+			request.Temperature = math.Min(0.99, request.Temperature)
+			request.Temperature = math.Max(0.01, request.Temperature)
+		}
 		a.SetVersionByModeName(request.Model)
 		if a.APIVersion == "v4" {
 			return request, nil
@@ -98,7 +105,11 @@ func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Read
 
 func (a *Adaptor) DoResponseV4(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
 	if meta.IsStream {
-		err, _, usage = openai.StreamHandler(c, resp, meta.Mode)
+		var responseText string
+		err, responseText, usage = openai.StreamHandler(c, resp, meta.Mode)
+		if usage == nil || usage.TotalTokens == 0 {
+			usage = openai.ResponseText2Usage(responseText, meta.ActualModelName, meta.PromptTokens)
+		}
 	} else {
 		err, usage = openai.Handler(c, resp, meta.PromptTokens, meta.ActualModelName)
 	}
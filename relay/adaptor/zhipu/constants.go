@@ -3,5 +3,7 @@ package zhipu
 var ModelList = []string{
 	"chatglm_turbo", "chatglm_pro", "chatglm_std", "chatglm_lite",
 	"glm-4", "glm-4v", "glm-3-turbo", "embedding-2",
+	"glm-4-plus", "glm-4-0520", "glm-4-air", "glm-4-airx", "glm-4-long", "glm-4-flash", "glm-4v-plus",
+	"embedding-3",
 	"cogview-3",
 }
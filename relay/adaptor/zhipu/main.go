@@ -3,6 +3,7 @@ package zhipu
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"github.com/songquanpeng/one-api/common/render"
 	"io"
 	"net/http"
@@ -28,19 +29,22 @@ import (
 var zhipuTokens sync.Map
 var expSeconds int64 = 24 * 3600
 
-func GetToken(apikey string) string {
+// a cached token this close to expiring is not used anymore, it might expire before upstream checks it
+const tokenRenewMargin = 5 * time.Minute
+
+// GetToken signs a JWT with the secret of the api key in the format of id.secret, upstream never sees the secret
+func GetToken(apikey string) (string, error) {
 	data, ok := zhipuTokens.Load(apikey)
 	if ok {
 		tokenData := data.(tokenData)
-		if time.Now().Before(tokenData.ExpiryTime) {
-			return tokenData.Token
+		if time.Now().Add(tokenRenewMargin).Before(tokenData.ExpiryTime) {
+			return tokenData.Token, nil
 		}
 	}
 
 	split := strings.Split(apikey, ".")
 	if len(split) != 2 {
-		logger.SysError("invalid zhipu key: " + apikey)
-		return ""
+		return "", errors.New("invalid zhipu key, should be id.secret")
 	}
 
 	id := split[0]
@@ -64,7 +68,7 @@ func GetToken(apikey string) string {
 
 	tokenString, err := token.SignedString([]byte(secret))
 	if err != nil {
-		return ""
+		return "", err
 	}
 
 	zhipuTokens.Store(apikey, tokenData{
@@ -72,7 +76,7 @@ func GetToken(apikey string) string {
 		ExpiryTime: expiryTime,
 	})
 
-	return tokenString
+	return tokenString, nil
 }
 
 func ConvertRequest(request model.GeneralOpenAIRequest) *Request {
@@ -3,6 +3,7 @@ package relay
 import (
 	. "github.com/smartystreets/goconvey/convey"
 	"github.com/songquanpeng/one-api/relay/apitype"
+	"github.com/songquanpeng/one-api/relay/relaymode"
 	"testing"
 )
 
@@ -14,3 +15,17 @@ func TestGetAdaptor(t *testing.T) {
 		}
 	})
 }
+
+func TestIsModeSupported(t *testing.T) {
+	Convey("is mode supported", t, func() {
+		So(IsModeSupported(apitype.Anthropic, relaymode.ChatCompletions), ShouldBeTrue)
+		So(IsModeSupported(apitype.Anthropic, relaymode.Embeddings), ShouldBeFalse)
+		So(IsModeSupported(apitype.Gemini, relaymode.Embeddings), ShouldBeTrue)
+		So(IsModeSupported(apitype.Gemini, relaymode.Moderations), ShouldBeFalse)
+		So(IsModeSupported(apitype.OpenAI, relaymode.AudioSpeech), ShouldBeTrue)
+		So(IsModeSupported(apitype.Anthropic, relaymode.Messages), ShouldBeTrue)
+		So(IsModeSupported(apitype.OpenAI, relaymode.Messages), ShouldBeFalse)
+		So(IsModeSupported(apitype.Cohere, relaymode.Rerank), ShouldBeTrue)
+		So(IsModeSupported(apitype.VertexAI, relaymode.Embeddings), ShouldBeTrue)
+	})
+}
@@ -17,6 +17,15 @@ const (
 	Cohere
 	Cloudflare
 	DeepL
+	VertexAI
+	AI21
+	HuggingFace
+	Replicate
+	StabilityAI
+	Midjourney
+	ElevenLabs
+	Deepgram
+	AssemblyAI
 
 	Dummy // this one is only for count, do not add any channel after this
 )
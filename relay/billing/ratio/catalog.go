@@ -0,0 +1,199 @@
+package ratio
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// catalog.json is the list price of the models shipped with one-api, the default ratios are derived from it,
+// and the ModelRatio and CompletionRatio options are the overrides of the admin
+//
+//go:embed catalog.json
+var catalogJSON []byte
+
+const (
+	CurrencyUSD = "USD"
+	CurrencyCNY = "CNY"
+)
+
+// Price is the list price of a model, the tokens are priced per 1M tokens, the speech per 1K characters,
+// the transcriptions per minute of the audio, and the images and the requests (rerank, midjourney) per call;
+// the context caches are stored per 1M tokens per hour, and the fine-tuning is trained per 1M tokens
+type Price struct {
+	Input        float64 `json:"input,omitempty"`
+	Output       float64 `json:"output,omitempty"`
+	CachedInput  float64 `json:"cached_input,omitempty"`
+	CacheStorage float64 `json:"cache_storage,omitempty"`
+	Image        float64 `json:"image,omitempty"`
+	Audio        float64 `json:"audio,omitempty"`
+	AudioMinute  float64 `json:"audio_minute,omitempty"`
+	Request      float64 `json:"request,omitempty"`
+	Training     float64 `json:"training,omitempty"`
+	Currency     string  `json:"currency,omitempty"`
+}
+
+type catalogProvider struct {
+	Name     string            `json:"name"`
+	URL      string            `json:"url,omitempty"`
+	Note     string            `json:"note,omitempty"`
+	Currency string            `json:"currency,omitempty"`
+	Models   map[string]*Price `json:"models"`
+}
+
+type catalog struct {
+	Version   string            `json:"version"`
+	Providers []catalogProvider `json:"providers"`
+}
+
+var CatalogVersion string
+
+// Catalog is the list price of each model, the currency of the provider is filled in
+var Catalog map[string]*Price
+
+func parseCatalog(data []byte) (string, map[string]*Price, error) {
+	var c catalog
+	err := json.Unmarshal(data, &c)
+	if err != nil {
+		return "", nil, err
+	}
+	prices := make(map[string]*Price)
+	for _, provider := range c.Providers {
+		for name, price := range provider.Models {
+			if _, ok := prices[name]; ok {
+				return "", nil, fmt.Errorf("model %s is priced twice", name)
+			}
+			if price.Currency == "" {
+				price.Currency = provider.Currency
+			}
+			if price.Currency == "" {
+				price.Currency = CurrencyUSD
+			}
+			if price.Currency != CurrencyUSD && price.Currency != CurrencyCNY {
+				return "", nil, fmt.Errorf("unknown currency %s of model %s", price.Currency, name)
+			}
+			prices[name] = price
+		}
+	}
+	return c.Version, prices, nil
+}
+
+func currencyUnit(currency string) float64 {
+	if currency == CurrencyCNY {
+		return RMB
+	}
+	return USD
+}
+
+// roundRatio drops the error of the floating point arithmetic, so that 2.4 / 0.8 is billed as 3,
+// while the repeating decimals like 2 / 1.5 are kept
+func roundRatio(ratio float64) float64 {
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(ratio, 'g', 15, 64), 64)
+	if len(strconv.FormatFloat(rounded, 'g', -1, 64)) > 12 {
+		return ratio
+	}
+	return rounded
+}
+
+// ratios converts the list price to the model ratio and the completion ratio,
+// an image, a request, 1K characters or a second of the audio is billed as 1K tokens
+func (price *Price) ratios() (modelRatio float64, completionRatio float64) {
+	unit := currencyUnit(price.Currency)
+	switch {
+	case price.Image != 0:
+		return price.Image * unit, 1
+	case price.Audio != 0:
+		return price.Audio * unit, 1
+	case price.Request != 0:
+		return price.Request * unit, 1
+	case price.AudioMinute != 0:
+		return price.AudioMinute * unit / 60, 1
+	}
+	completionRatio = 1
+	if price.Input != 0 && price.Output != 0 {
+		completionRatio = roundRatio(price.Output / price.Input)
+	}
+	return roundRatio(price.Input / 1000 * unit), completionRatio
+}
+
+func init() {
+	var err error
+	CatalogVersion, Catalog, err = parseCatalog(catalogJSON)
+	if err != nil {
+		panic("invalid pricing catalog: " + err.Error())
+	}
+	DefaultModelRatio = make(map[string]float64, len(Catalog))
+	DefaultCompletionRatio = make(map[string]float64, len(Catalog))
+	for name, price := range Catalog {
+		DefaultModelRatio[name], DefaultCompletionRatio[name] = price.ratios()
+	}
+	ModelRatio = make(map[string]float64, len(DefaultModelRatio))
+	for name, ratio := range DefaultModelRatio {
+		ModelRatio[name] = ratio
+	}
+	updateKnownModels()
+}
+
+// GetPrice resolves the effective price of a model in USD, the ratios overridden by the admin are
+// converted back to prices; overridden is false if the price is the one of the catalog
+func GetPrice(name string) (price *Price, overridden bool) {
+	modelRatio := GetModelRatio(name)
+	completionRatio := GetCompletionRatio(name)
+	listed, ok := Catalog[name]
+	overridden = !ok
+	if ok {
+		listedModelRatio, listedCompletionRatio := listed.ratios()
+		overridden = modelRatio != listedModelRatio || completionRatio != listedCompletionRatio
+	}
+	price = &Price{Currency: CurrencyUSD}
+	switch {
+	case ok && listed.Image != 0:
+		price.Image = modelRatio / USD
+	case ok && listed.Audio != 0:
+		price.Audio = modelRatio / USD
+	case ok && listed.Request != 0:
+		price.Request = modelRatio / USD
+	case ok && listed.AudioMinute != 0:
+		price.AudioMinute = modelRatio * 60 / USD
+	default:
+		price.Input = modelRatio * 1000 / USD
+		price.Output = price.Input * completionRatio
+		if ok && listed.Input != 0 {
+			// the discount of the cache follows the overridden input price
+			price.CachedInput = listed.CachedInput * price.Input / listed.Input
+			price.CacheStorage = listed.CacheStorage * currencyUnit(listed.Currency) / USD
+			price.Training = listed.Training * currencyUnit(listed.Currency) / USD
+		}
+	}
+	return price, overridden
+}
+
+// GetCachedInputRatio is the ratio of the cached input price to the input price of a model,
+// 1 if the catalog has no discount for it
+func GetCachedInputRatio(name string) float64 {
+	price, ok := Catalog[name]
+	if !ok || price.Input == 0 || price.CachedInput == 0 {
+		return 1
+	}
+	return roundRatio(price.CachedInput / price.Input)
+}
+
+// GetCacheStorageRatio is the ratio of storing a token of a context cache for an hour, 0 if the catalog has no price for it
+func GetCacheStorageRatio(name string) float64 {
+	price, ok := Catalog[name]
+	if !ok {
+		return 0
+	}
+	return price.CacheStorage / 1000 * currencyUnit(price.Currency)
+}
+
+// GetTrainingRatio is the ratio of a token trained by a fine-tuning job, the ratio of the input of the model
+// is taken if the catalog has no training price for it, so that no training is free
+func GetTrainingRatio(name string) float64 {
+	price, ok := Catalog[name]
+	if !ok || price.Training == 0 {
+		return GetModelRatio(name)
+	}
+	return roundRatio(price.Training / 1000 * currencyUnit(price.Currency))
+}
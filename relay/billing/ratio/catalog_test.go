@@ -0,0 +1,60 @@
+package ratio
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCatalog(t *testing.T) {
+	Convey("parseCatalog", t, func() {
+		So(CatalogVersion, ShouldNotBeEmpty)
+		So(Catalog, ShouldContainKey, "gpt-4o")
+		So(Catalog["glm-4"].Currency, ShouldEqual, CurrencyCNY)
+
+		_, _, err := parseCatalog([]byte(`{"providers":[{"name":"a","models":{"m":{"input":1}}},{"name":"b","models":{"m":{"input":2}}}]}`))
+		So(err, ShouldNotBeNil)
+		_, _, err = parseCatalog([]byte(`{"providers":[{"name":"a","currency":"EUR","models":{"m":{"input":1}}}]}`))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("the default ratios are derived from the prices", t, func() {
+		So(GetModelRatio("gpt-4o"), ShouldEqual, 2.5)
+		So(GetCompletionRatio("gpt-4o"), ShouldEqual, 3)
+		So(GetCompletionRatio("claude-instant-1.2"), ShouldEqual, 3)
+		So(GetModelRatio("dall-e-3"), ShouldEqual, 20)
+		So(GetModelRatio("glm-4"), ShouldEqual, 0.1*RMB)
+	})
+
+	Convey("GetPrice", t, func() {
+		price, overridden := GetPrice("gpt-4o")
+		So(overridden, ShouldBeFalse)
+		So(price.Input, ShouldEqual, 5)
+		So(price.Output, ShouldEqual, 15)
+
+		ModelRatio["gpt-4o"] = 1.25
+		defer func() { ModelRatio["gpt-4o"] = DefaultModelRatio["gpt-4o"] }()
+		price, overridden = GetPrice("gpt-4o")
+		So(overridden, ShouldBeTrue)
+		So(price.Input, ShouldEqual, 2.5)
+
+		price, overridden = GetPrice("claude-3-5-sonnet-20240620")
+		So(overridden, ShouldBeFalse)
+		So(price.CachedInput, ShouldAlmostEqual, 0.3)
+
+		price, _ = GetPrice("mj_upscale")
+		So(price.Request, ShouldEqual, 0.05)
+	})
+	Convey("the context caches", t, func() {
+		So(GetCachedInputRatio("gemini-1.5-flash"), ShouldEqual, 0.25)
+		So(GetCachedInputRatio("gpt-4o"), ShouldEqual, 1)
+		// $1 per 1M tokens per hour
+		So(GetCacheStorageRatio("gemini-1.5-flash")*1000000, ShouldAlmostEqual, USD*1000)
+		So(GetCacheStorageRatio("gpt-4o"), ShouldEqual, 0)
+	})
+	Convey("the fine-tuning", t, func() {
+		// $8 per 1M tokens trained
+		So(GetTrainingRatio("gpt-3.5-turbo-0125"), ShouldEqual, 4)
+		So(GetTrainingRatio("gpt-4o"), ShouldEqual, GetModelRatio("gpt-4o"))
+	})
+}
@@ -2,6 +2,7 @@ package ratio
 
 import (
 	"encoding/json"
+	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
 )
 
@@ -9,6 +10,7 @@ var GroupRatio = map[string]float64{
 	"default": 1,
 	"vip":     1,
 	"svip":    1,
+	"sandbox": 1,
 }
 
 func GroupRatio2JSONString() string {
@@ -27,6 +29,10 @@ func UpdateGroupRatioByJSONString(jsonStr string) error {
 func GetGroupRatio(name string) float64 {
 	ratio, ok := GroupRatio[name]
 	if !ok {
+		// the sandbox group is built in, it's there even if the saved group ratio doesn't have it
+		if name == config.SandboxGroup {
+			return 1
+		}
 		logger.SysError("group ratio not found: " + name)
 		return 1
 	}
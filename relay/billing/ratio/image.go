@@ -1,5 +1,11 @@
 package ratio
 
+import (
+	"encoding/json"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
 var ImageSizeRatios = map[string]map[string]float64{
 	"dall-e-2": {
 		"256x256":   1,
@@ -39,6 +45,26 @@ var ImageGenerationAmounts = map[string][2]int{
 	"ali-stable-diffusion-v1.5": {1, 4}, // Ali
 	"wanx-v1":                   {1, 4}, // Ali
 	"cogview-3":                 {1, 1},
+	// Replicate
+	"black-forest-labs/flux-schnell":          {1, 4},
+	"black-forest-labs/flux-dev":              {1, 4},
+	"black-forest-labs/flux-pro":              {1, 1},
+	"black-forest-labs/flux-1.1-pro":          {1, 1},
+	"stability-ai/stable-diffusion-3.5-large": {1, 1},
+	// Stability AI, only the v1 engines take the number of images
+	"stable-diffusion-xl-1024-v1-0": {1, 10},
+	"stable-diffusion-v1-6":         {1, 10},
+	"stable-image-ultra":            {1, 1},
+	"stable-image-core":             {1, 1},
+	"sd3.5-large":                   {1, 1},
+	"sd3.5-large-turbo":             {1, 1},
+	"sd3.5-medium":                  {1, 1},
+}
+
+// ImageQualities are the qualities the model takes, "hd" of dall-e-3 costs more, see getImageCostRatio
+var ImageQualities = map[string][]string{
+	"dall-e-2": {"standard"},
+	"dall-e-3": {"standard", "hd"},
 }
 
 var ImagePromptLengthLimitations = map[string]int{
@@ -48,9 +74,41 @@ var ImagePromptLengthLimitations = map[string]int{
 	"ali-stable-diffusion-v1.5": 4000,
 	"wanx-v1":                   4000,
 	"cogview-3":                 833,
+	// Stability AI
+	"stable-diffusion-xl-1024-v1-0": 2000,
+	"stable-diffusion-v1-6":         2000,
+	"stable-image-ultra":            10000,
+	"stable-image-core":             10000,
+	"sd3.5-large":                   10000,
+	"sd3.5-large-turbo":             10000,
+	"sd3.5-medium":                  10000,
 }
 
 var ImageOriginModelName = map[string]string{
 	"ali-stable-diffusion-xl":   "stable-diffusion-xl",
 	"ali-stable-diffusion-v1.5": "stable-diffusion-v1.5",
 }
+
+// ChatImagePrice is the price in USD of an image generated in a chat completion, billed on top of the tokens,
+// the models counting the images in the completion tokens, like Gemini, are not listed
+var ChatImagePrice = map[string]float64{
+	"gpt-image-1":      0.042,
+	"gpt-image-1-mini": 0.011,
+}
+
+func ChatImagePrice2JSONString() string {
+	jsonBytes, err := json.Marshal(ChatImagePrice)
+	if err != nil {
+		logger.SysError("error marshalling chat image price: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateChatImagePriceByJSONString(jsonStr string) error {
+	ChatImagePrice = make(map[string]float64)
+	return json.Unmarshal([]byte(jsonStr), &ChatImagePrice)
+}
+
+func GetChatImagePrice(name string) float64 {
+	return ChatImagePrice[name]
+}
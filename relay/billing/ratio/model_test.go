@@ -0,0 +1,21 @@
+package ratio
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/relay/modelname"
+)
+
+func TestKnownModels(t *testing.T) {
+	oldModelRatio := ModelRatio2JSONString()
+	t.Cleanup(func() {
+		_ = UpdateModelRatioByJSONString(oldModelRatio)
+	})
+	Convey("the lookup of the known models is rebuilt when the ratios are loaded", t, func() {
+		So(modelname.NormalizeWith("GPT-4o", KnownModels()), ShouldEqual, "gpt-4o")
+		So(UpdateModelRatioByJSONString(`{"my-model":1}`), ShouldBeNil)
+		So(modelname.NormalizeWith("My_Model", KnownModels()), ShouldEqual, "my-model")
+		So(modelname.NormalizeWith("GPT-4o", KnownModels()), ShouldEqual, "GPT-4o")
+	})
+}
@@ -42,5 +42,21 @@ const (
 	DeepL
 	TogetherAI
 	Doubao
+	VertexAI
+	Fireworks
+	OneAPI
+	XAI
+	AI21
+	Perplexity
+	HuggingFace
+	Replicate
+	NVIDIA
+	StabilityAI
+	Midjourney
+	ElevenLabs
+	Deepgram
+	AssemblyAI
+	Cerebras
+	SambaNova
 	Dummy
 )
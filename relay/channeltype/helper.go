@@ -35,6 +35,24 @@ func ToAPIType(channelType int) int {
 		apiType = apitype.Cloudflare
 	case DeepL:
 		apiType = apitype.DeepL
+	case VertexAI:
+		apiType = apitype.VertexAI
+	case AI21:
+		apiType = apitype.AI21
+	case HuggingFace:
+		apiType = apitype.HuggingFace
+	case Replicate:
+		apiType = apitype.Replicate
+	case StabilityAI:
+		apiType = apitype.StabilityAI
+	case Midjourney:
+		apiType = apitype.Midjourney
+	case ElevenLabs:
+		apiType = apitype.ElevenLabs
+	case Deepgram:
+		apiType = apitype.Deepgram
+	case AssemblyAI:
+		apiType = apitype.AssemblyAI
 	}
 
 	return apiType
@@ -42,6 +42,22 @@ var ChannelBaseURLs = []string{
 	"https://api-free.deepl.com",                // 38
 	"https://api.together.xyz",                  // 39
 	"https://ark.cn-beijing.volces.com",         // 40
+	"",                                          // 41, depends on the region
+	"https://api.fireworks.ai/inference",        // 42
+	"",                                          // 43, another one-api
+	"https://api.x.ai",                          // 44
+	"https://api.ai21.com",                      // 45
+	"https://api.perplexity.ai",                 // 46
+	"https://api-inference.huggingface.co",      // 47
+	"https://api.replicate.com",                 // 48
+	"https://integrate.api.nvidia.com",          // 49
+	"https://api.stability.ai",                  // 50
+	"",                                          // 51
+	"https://api.elevenlabs.io",                 // 52
+	"https://api.deepgram.com",                  // 53
+	"https://api.assemblyai.com",                // 54
+	"https://api.cerebras.ai",                   // 55
+	"https://api.sambanova.ai",                  // 56
 }
 
 func init() {
@@ -0,0 +1,33 @@
+package errortype
+
+// the values are stored in logs, only append new types
+const (
+	Unknown = iota
+	Auth
+	Quota
+	RateLimit
+	Timeout
+	Network
+	BadRequest
+	ContentFilter
+	Upstream // upstream failed on its own side, e.g. 5xx
+)
+
+var names = map[int]string{
+	Unknown:       "unknown",
+	Auth:          "auth",
+	Quota:         "quota",
+	RateLimit:     "rate_limit",
+	Timeout:       "timeout",
+	Network:       "network",
+	BadRequest:    "bad_request",
+	ContentFilter: "content_filter",
+	Upstream:      "upstream",
+}
+
+func String(errorType int) string {
+	if name, ok := names[errorType]; ok {
+		return name
+	}
+	return names[Unknown]
+}
@@ -0,0 +1,18 @@
+package lane
+
+const (
+	Interactive = "interactive" // never waits for a saturated channel
+	Batch       = "batch"       // waits until the channel has spare capacity
+)
+
+func IsValid(lane string) bool {
+	return lane == "" || lane == Interactive || lane == Batch
+}
+
+// Of returns the lane of a token, tokens are interactive unless marked otherwise
+func Of(tokenLane string) string {
+	if tokenLane == Batch {
+		return Batch
+	}
+	return Interactive
+}
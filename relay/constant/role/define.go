@@ -1,5 +1,7 @@
 package role
 
 const (
+	System    = "system"
+	User      = "user"
 	Assistant = "assistant"
 )
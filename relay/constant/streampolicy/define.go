@@ -0,0 +1,11 @@
+package streampolicy
+
+const (
+	Default = ""
+	Disable = "disable" // always relay with stream=false, for clients behind buffering proxies
+	Force   = "force"   // relay long generations with stream=true, so that upstream won't time out
+)
+
+func IsValid(policy string) bool {
+	return policy == Default || policy == Disable || policy == Force
+}
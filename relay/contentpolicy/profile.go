@@ -0,0 +1,103 @@
+package contentpolicy
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	ActionBlock = "block" // the request is rejected and the violation recorded
+	ActionFlag  = "flag"  // the request is relayed and the violation recorded
+	ActionLog   = "log"   // the request is relayed and the violation only written to the system log
+)
+
+// Profile is a named content policy, assigned to groups or tokens
+type Profile struct {
+	Blocklist []string `json:"blocklist,omitempty"`
+	// CategoryThresholds maps a category of the moderation model to the score above which the request violates the profile
+	CategoryThresholds map[string]float64 `json:"category_thresholds,omitempty"`
+	Action             string             `json:"action"`
+}
+
+// Violation is what a request violates first, either a keyword of the blocklist or a category of the moderation
+type Violation struct {
+	Keyword  string
+	Category string
+	Score    float64
+}
+
+// Profiles maps the name of a profile to the profile
+var Profiles = map[string]Profile{}
+
+func Profiles2JSONString() string {
+	jsonBytes, err := json.Marshal(Profiles)
+	if err != nil {
+		return "{}"
+	}
+	return string(jsonBytes)
+}
+
+func UpdateProfilesByJSONString(jsonStr string) error {
+	profiles := make(map[string]Profile)
+	err := json.Unmarshal([]byte(jsonStr), &profiles)
+	if err != nil {
+		return err
+	}
+	for name, profile := range profiles {
+		if profile.Action != ActionBlock && profile.Action != ActionFlag && profile.Action != ActionLog {
+			return fmt.Errorf("action of content policy %s should be one of block, flag and log", name)
+		}
+		for category, threshold := range profile.CategoryThresholds {
+			if threshold < 0 || threshold > 1 {
+				return fmt.Errorf("threshold of %s of content policy %s should be between 0 and 1", category, name)
+			}
+		}
+	}
+	Profiles = profiles
+	return nil
+}
+
+// GetProfile returns false if there is no such profile, the name is the one of the token, or of the group otherwise
+func GetProfile(name string) (Profile, bool) {
+	if name == "" {
+		return Profile{}, false
+	}
+	profile, ok := Profiles[name]
+	return profile, ok
+}
+
+// MatchBlocklist returns the first keyword of the blocklist found in the text, case-insensitively
+func (p Profile) MatchBlocklist(text string) (*Violation, bool) {
+	text = strings.ToLower(text)
+	for _, keyword := range p.Blocklist {
+		if keyword != "" && strings.Contains(text, strings.ToLower(keyword)) {
+			return &Violation{Keyword: keyword}, true
+		}
+	}
+	return nil, false
+}
+
+// CheckScores returns the category exceeding its threshold the most, the scores are those of the moderation model
+func (p Profile) CheckScores(scores map[string]float64) (*Violation, bool) {
+	categories := make([]string, 0, len(p.CategoryThresholds))
+	for category := range p.CategoryThresholds {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	var violation *Violation
+	maxExcess := 0.0
+	for _, category := range categories {
+		score, ok := scores[category]
+		if !ok {
+			continue
+		}
+		excess := score - p.CategoryThresholds[category]
+		if excess > 0 && (violation == nil || excess > maxExcess) {
+			violation = &Violation{Category: category, Score: score}
+			maxExcess = excess
+		}
+	}
+	return violation, violation != nil
+}
@@ -0,0 +1,37 @@
+package contentpolicy
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestProfile(t *testing.T) {
+	Convey("MatchBlocklist", t, func() {
+		profile := Profile{Blocklist: []string{"", "Forbidden Word", "crack"}, Action: ActionBlock}
+		violation, ok := profile.MatchBlocklist("how to use the forbidden word?")
+		So(ok, ShouldBeTrue)
+		So(violation.Keyword, ShouldEqual, "Forbidden Word")
+		_, ok = profile.MatchBlocklist("hello")
+		So(ok, ShouldBeFalse)
+	})
+	Convey("CheckScores", t, func() {
+		profile := Profile{CategoryThresholds: map[string]float64{"violence": 0.5, "harassment": 0.2}, Action: ActionFlag}
+		violation, ok := profile.CheckScores(map[string]float64{"violence": 0.6, "harassment": 0.9, "self-harm": 1})
+		So(ok, ShouldBeTrue)
+		So(violation.Category, ShouldEqual, "harassment")
+		So(violation.Score, ShouldEqual, 0.9)
+		_, ok = profile.CheckScores(map[string]float64{"violence": 0.5, "harassment": 0.1})
+		So(ok, ShouldBeFalse)
+	})
+	Convey("UpdateProfilesByJSONString", t, func() {
+		So(UpdateProfilesByJSONString(`{"strict": {"blocklist": ["a"], "action": "block"}}`), ShouldBeNil)
+		profile, ok := GetProfile("strict")
+		So(ok, ShouldBeTrue)
+		So(profile.Blocklist, ShouldResemble, []string{"a"})
+		So(UpdateProfilesByJSONString(`{"strict": {"action": "ban"}}`), ShouldNotBeNil)
+		So(UpdateProfilesByJSONString(`{"strict": {"category_thresholds": {"violence": 2}, "action": "log"}}`), ShouldNotBeNil)
+		_, ok = GetProfile("strict")
+		So(ok, ShouldBeTrue)
+	})
+}
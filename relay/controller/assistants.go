@@ -0,0 +1,413 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+const assistantRunFetchTimeout = 30 * time.Second
+
+func isAssistantRunFinished(status string) bool {
+	for _, finalStatus := range model.AssistantRunFinalStatuses {
+		if status == finalStatus {
+			return true
+		}
+	}
+	return false
+}
+
+func isAssistantRunCreation(c *gin.Context) bool {
+	return c.Request.Method == http.MethodPost && strings.HasSuffix(c.Request.URL.Path, "/runs")
+}
+
+// mapRequestBodyModel maps the model in the body, of an assistant, a run or a fine-tuning job, the other requests have no model
+func mapRequestBodyModel(requestBody []byte, meta *meta.Meta) ([]byte, error) {
+	var request map[string]any
+	if json.Unmarshal(requestBody, &request) != nil {
+		// let the upstream report the invalid body
+		return requestBody, nil
+	}
+	modelName, ok := request["model"].(string)
+	if !ok || modelName == "" {
+		return requestBody, nil
+	}
+	mappedModelName, isMapped := getMappedModelName(modelName, meta.ModelMapping)
+	if !isMapped {
+		return requestBody, nil
+	}
+	request["model"] = mappedModelName
+	return json.Marshal(request)
+}
+
+// RelayAssistantsHelper relays the requests of the Assistants API to the OpenAI compatible channels as they are.
+// The assistants and the threads created are remembered, so that the later requests are sent to the same account,
+// and the runs are billed by the usage of their steps once they're finished, see SettleAssistantRun.
+func RelayAssistantsHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	if meta.APIType != apitype.OpenAI || meta.ChannelType == channeltype.Azure {
+		return openai.ErrorWrapper(errors.New("API not implemented by the channel"), "api_not_implemented", http.StatusNotImplemented)
+	}
+	var requestBody io.Reader
+	if c.Request.Method == http.MethodPost {
+		body, err := common.GetRequestBody(c)
+		if err != nil {
+			return openai.ErrorWrapper(err, "read_request_body_failed", http.StatusBadRequest)
+		}
+		if isAssistantRunCreation(c) {
+			// the runs are billed after they're finished, an estimate is pre-consumed and settled then
+			_, bizErr := getOrPreConsumeFixedQuota(c, getAssistantRunPreConsumedQuota(body, meta), meta)
+			if bizErr != nil {
+				return bizErr
+			}
+		}
+		body, err = mapRequestBodyModel(body, meta)
+		if err != nil {
+			return openai.ErrorWrapper(err, "marshal_request_body_failed", http.StatusInternalServerError)
+		}
+		requestBody = bytes.NewReader(body)
+	}
+	fullRequestURL := openai.GetFullRequestURL(meta.BaseURL, meta.RequestURLPath, meta.ChannelType)
+	req, err := http.NewRequestWithContext(ctx, c.Request.Method, fullRequestURL, requestBody)
+	if err != nil {
+		return openai.ErrorWrapper(err, "new_request_failed", http.StatusInternalServerError)
+	}
+	a := &openai.Adaptor{}
+	a.Init(meta)
+	err = a.SetupRequestHeader(c, req, meta)
+	if err != nil {
+		return openai.ErrorWrapper(err, "setup_request_header_failed", http.StatusInternalServerError)
+	}
+	if requestBody == nil {
+		req.Header.Del("Content-Type")
+	}
+	beta := c.Request.Header.Get("OpenAI-Beta")
+	if beta == "" {
+		beta = openai.AssistantsBetaHeader
+	}
+	req.Header.Set("OpenAI-Beta", beta)
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return RelayErrorHandler(resp)
+	}
+	adaptor.SetupResponseHeader(c, resp)
+	// the quota pre-consumed is kept by the run once it's saved, it's returned if no run is found in the response
+	defer ReturnPreConsumedQuota(c)
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return streamAssistantEvents(c, meta, resp)
+	}
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	responseBody = trackAssistantResponse(c, meta, responseBody)
+	c.Writer.Header().Del("Content-Length")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(responseBody)
+	if err != nil {
+		return openai.ErrorWrapper(err, "write_response_body_failed", http.StatusInternalServerError)
+	}
+	return nil
+}
+
+// getAssistantRunPreConsumedQuota estimates a run like a chat completion of the model of the run or its assistant,
+// limited by the token limits of the run if any
+func getAssistantRunPreConsumedQuota(requestBody []byte, meta *meta.Meta) int64 {
+	var request struct {
+		AssistantId         string `json:"assistant_id"`
+		Model               string `json:"model"`
+		MaxPromptTokens     int    `json:"max_prompt_tokens"`
+		MaxCompletionTokens int    `json:"max_completion_tokens"`
+	}
+	_ = json.Unmarshal(requestBody, &request)
+	modelName := request.Model
+	if modelName == "" && request.AssistantId != "" {
+		// the assistant is checked by the middleware already
+		assistant, err := model.GetAssistantObject(meta.UserId, request.AssistantId)
+		if err == nil {
+			modelName = assistant.Model
+		}
+	}
+	ratio := billingratio.GetModelRatio(modelName) * billingratio.GetGroupRatio(meta.Group)
+	textRequest := &relaymodel.GeneralOpenAIRequest{
+		Model:     modelName,
+		MaxTokens: request.MaxCompletionTokens,
+	}
+	return getPreConsumedQuota(textRequest, request.MaxPromptTokens, ratio)
+}
+
+// streamAssistantEvents relays the events of a run as they're received, the objects in them are tracked as well
+func streamAssistantEvents(c *gin.Context, meta *meta.Meta, resp *http.Response) *relaymodel.ErrorWithStatusCode {
+	c.Writer.WriteHeader(resp.StatusCode)
+	scanner := bufio.NewScanner(resp.Body)
+	// the events carry the whole messages
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if payload, ok := strings.CutPrefix(line, "data:"); ok {
+			payload = strings.TrimSpace(payload)
+			object := openai.AssistantObject{}
+			if payload != "[DONE]" && json.Unmarshal([]byte(payload), &object) == nil {
+				trackAssistantObject(c, meta, &object)
+			}
+		}
+		_, err := c.Writer.Write([]byte(line + "\n"))
+		if err != nil {
+			return openai.ErrorWrapper(err, "write_response_body_failed", http.StatusInternalServerError)
+		}
+		if line == "" {
+			c.Writer.Flush()
+		}
+	}
+	c.Writer.Flush()
+	if err := scanner.Err(); err != nil {
+		logger.Errorf(c.Request.Context(), "error reading assistant events: %s", err.Error())
+	}
+	return nil
+}
+
+// trackAssistantResponse tracks the objects in the response, the list of the assistants is filtered to those of the user,
+// as it's the list of the whole account otherwise
+func trackAssistantResponse(c *gin.Context, meta *meta.Meta, responseBody []byte) []byte {
+	object := openai.AssistantObject{}
+	if json.Unmarshal(responseBody, &object) != nil {
+		return responseBody
+	}
+	if object.Object != "list" {
+		trackAssistantObject(c, meta, &object)
+		return responseBody
+	}
+	list := openai.AssistantObjectList{}
+	if json.Unmarshal(responseBody, &list) != nil {
+		return responseBody
+	}
+	items := make([]*openai.AssistantObject, 0, len(list.Data))
+	ids := make([]string, 0, len(list.Data))
+	for _, data := range list.Data {
+		item := openai.AssistantObject{}
+		_ = json.Unmarshal(data, &item)
+		trackAssistantObject(c, meta, &item)
+		items = append(items, &item)
+		ids = append(ids, item.Id)
+	}
+	if c.Request.URL.Path != "/v1/assistants" {
+		// the others are listed within a thread or an assistant of the user
+		return responseBody
+	}
+	owned, err := model.GetAssistantObjectIds(meta.UserId, ids)
+	if err != nil {
+		logger.Errorf(c.Request.Context(), "failed to get the assistants of user %d: %s", meta.UserId, err.Error())
+	}
+	data := make([]json.RawMessage, 0, len(list.Data))
+	for i, item := range items {
+		if owned[item.Id] {
+			data = append(data, list.Data[i])
+		}
+	}
+	list.Data = data
+	filteredBody, err := json.Marshal(list)
+	if err != nil {
+		return responseBody
+	}
+	return filteredBody
+}
+
+func saveAssistantObject(c *gin.Context, meta *meta.Meta, objectId string, object string, modelName string) {
+	err := model.InsertAssistantObject(&model.AssistantObject{
+		ObjectId:  objectId,
+		Object:    object,
+		Model:     modelName,
+		UserId:    meta.UserId,
+		ChannelId: meta.ChannelId,
+		KeyIndex:  c.GetInt(ctxkey.ChannelKeyIndex),
+		CreatedAt: helper.GetTimestamp(),
+	})
+	if err != nil {
+		logger.Errorf(c.Request.Context(), "failed to save %s %s: %s", object, objectId, err.Error())
+	}
+}
+
+func trackAssistantObject(c *gin.Context, meta *meta.Meta, object *openai.AssistantObject) {
+	switch object.Object {
+	case model.AssistantObjectAssistant, model.AssistantObjectThread:
+		if c.Request.Method == http.MethodPost && object.Id != "" {
+			saveAssistantObject(c, meta, object.Id, object.Object, object.Model)
+		}
+	case "assistant.deleted", "thread.deleted":
+		if object.Deleted {
+			err := model.DeleteAssistantObject(meta.UserId, object.Id)
+			if err != nil {
+				logger.Errorf(c.Request.Context(), "failed to delete %s: %s", object.Id, err.Error())
+			}
+		}
+	case "thread.run":
+		trackAssistantRun(c, meta, object)
+	}
+}
+
+func trackAssistantRun(c *gin.Context, meta *meta.Meta, object *openai.AssistantObject) {
+	ctx := c.Request.Context()
+	if object.Id == "" || object.ThreadId == "" {
+		return
+	}
+	if c.Request.Method == http.MethodPost && strings.HasPrefix(c.Request.URL.Path, "/v1/threads/runs") {
+		// the thread is created along with the run
+		saveAssistantObject(c, meta, object.ThreadId, model.AssistantObjectThread, "")
+	}
+	preConsumedQuota := int64(0)
+	if isAssistantRunCreation(c) {
+		preConsumedQuota = c.GetInt64(ctxkey.PreConsumedQuota)
+	}
+	inserted, err := model.InsertAssistantRun(&model.AssistantRun{
+		RunId:            object.Id,
+		ThreadId:         object.ThreadId,
+		UserId:           meta.UserId,
+		TokenId:          meta.TokenId,
+		TokenName:        meta.TokenName,
+		ChannelId:        meta.ChannelId,
+		KeyIndex:         c.GetInt(ctxkey.ChannelKeyIndex),
+		Group:            meta.Group,
+		ModelName:        object.Model,
+		Status:           object.Status,
+		CreatedAt:        helper.GetTimestamp(),
+		PreConsumedQuota: preConsumedQuota,
+	})
+	if err != nil {
+		logger.Errorf(ctx, "failed to save run %s: %s", object.Id, err.Error())
+		return
+	}
+	if inserted && preConsumedQuota != 0 {
+		// it's settled with the run
+		c.Set(ctxkey.PreConsumedQuota, int64(0))
+	}
+	if !isAssistantRunFinished(object.Status) {
+		return
+	}
+	run, err := model.GetAssistantRunByRunId(object.Id)
+	if err != nil || isAssistantRunFinished(run.Status) {
+		return
+	}
+	go func() {
+		err := SettleAssistantRun(ctx, run)
+		if err != nil {
+			// it's settled by the polling later
+			logger.Errorf(ctx, "failed to settle run %s: %s", run.RunId, err.Error())
+		}
+	}()
+}
+
+// SettleAssistantRun bills a finished run by the usage of its steps, the run is only updated if it's not finished yet
+func SettleAssistantRun(ctx context.Context, run *model.AssistantRun) error {
+	channel, err := model.GetChannelById(run.ChannelId, true)
+	if err != nil {
+		return err
+	}
+	key := getChannelKey(channel, run.KeyIndex)
+	cfg, _ := channel.LoadConfig()
+	fetchCtx, cancel := context.WithTimeout(context.Background(), assistantRunFetchTimeout)
+	defer cancel()
+	remoteRun, err := openai.GetAssistantRun(fetchCtx, channel.GetBaseURL(), key, cfg, run.ThreadId, run.RunId)
+	if err != nil {
+		return err
+	}
+	if !isAssistantRunFinished(remoteRun.Status) {
+		run.Status = remoteRun.Status
+		return run.UpdateStatus()
+	}
+	usage, err := openai.GetAssistantRunStepsUsage(fetchCtx, channel.GetBaseURL(), key, cfg, run.ThreadId, run.RunId)
+	if err != nil {
+		if remoteRun.Usage == nil {
+			return err
+		}
+		// the usage of the run is the sum of its steps too
+		usage = remoteRun.Usage
+	}
+	if remoteRun.Model != "" {
+		run.ModelName = remoteRun.Model
+	}
+	modelRatio := billingratio.GetModelRatio(run.ModelName)
+	groupRatio := billingratio.GetGroupRatio(run.Group)
+	completionRatio := billingratio.GetCompletionRatio(run.ModelName)
+	ratio := modelRatio * groupRatio
+	quota := int64(math.Ceil((float64(usage.PromptTokens) + float64(usage.CompletionTokens)*completionRatio) * ratio))
+	if ratio != 0 && quota <= 0 && usage.PromptTokens+usage.CompletionTokens > 0 {
+		quota = 1
+	}
+	run.Status = remoteRun.Status
+	run.FinishTime = helper.GetTimestamp()
+	run.PromptTokens = usage.PromptTokens
+	run.CompletionTokens = usage.CompletionTokens
+	run.Quota = quota
+	finished, err := run.Finish()
+	if err != nil || !finished {
+		return err
+	}
+	settleAssistantRunQuota(ctx, run)
+	if quota == 0 {
+		return nil
+	}
+	logContent := fmt.Sprintf("模型倍率 %.2f，分组倍率 %.2f，补全倍率 %.2f，运行 %s", modelRatio, groupRatio, completionRatio, run.RunId)
+	model.RecordConsumeLog(ctx, run.UserId, run.ChannelId, usage.PromptTokens, usage.CompletionTokens, run.ModelName, run.TokenName, run.TokenId, quota, logContent, channel.Name)
+	model.UpdateUserUsedQuotaAndRequestCount(run.UserId, quota)
+	model.UpdateChannelUsedQuota(run.ChannelId, quota)
+	monitor.RecordSpend(quota)
+	return nil
+}
+
+// settleAssistantRunQuota consumes the difference between the quota of a finished run and what was pre-consumed
+func settleAssistantRunQuota(ctx context.Context, run *model.AssistantRun) {
+	quotaDelta := run.Quota - run.PreConsumedQuota
+	if quotaDelta == 0 {
+		return
+	}
+	err := model.PostConsumeTokenQuota(run.TokenId, quotaDelta)
+	if err != nil {
+		logger.Error(ctx, "error consuming token remain quota: "+err.Error())
+	}
+	err = model.CacheUpdateUserQuota(ctx, run.UserId)
+	if err != nil {
+		logger.Error(ctx, "error update user quota cache: "+err.Error())
+	}
+}
+
+// ExpireAssistantRun gives up a run which can't be fetched, the quota pre-consumed is returned
+func ExpireAssistantRun(ctx context.Context, run *model.AssistantRun) error {
+	run.Status = "expired"
+	run.FinishTime = helper.GetTimestamp()
+	run.Quota = 0
+	finished, err := run.Finish()
+	if err != nil || !finished {
+		return err
+	}
+	settleAssistantRunQuota(ctx, run)
+	return nil
+}
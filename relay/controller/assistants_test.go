@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/model"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+)
+
+func TestGetAssistantRunPreConsumedQuota(t *testing.T) {
+	Convey("getAssistantRunPreConsumedQuota", t, func() {
+		useTestDB(t)
+		So(model.InsertAssistantObject(&model.AssistantObject{ObjectId: "asst_1", Object: model.AssistantObjectAssistant, Model: "gpt-4", UserId: 1}), ShouldBeNil)
+		meta := &meta.Meta{UserId: 1, Group: "default"}
+
+		withModel := getAssistantRunPreConsumedQuota([]byte(`{"model":"gpt-4","max_prompt_tokens":1000,"max_completion_tokens":200}`), meta)
+		So(withModel, ShouldBeGreaterThan, 0)
+		// the model of the assistant is used if the run doesn't override it
+		So(getAssistantRunPreConsumedQuota([]byte(`{"assistant_id":"asst_1","max_prompt_tokens":1000,"max_completion_tokens":200}`), meta), ShouldEqual, withModel)
+		So(getAssistantRunPreConsumedQuota([]byte(`{"model":"gpt-4","max_prompt_tokens":2000,"max_completion_tokens":200}`), meta), ShouldBeGreaterThan, withModel)
+	})
+}
+
+func TestSettleAssistantRun(t *testing.T) {
+	Convey("SettleAssistantRun", t, func() {
+		useTestDB(t)
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Path {
+			case "/v1/threads/thread_1/runs/run_1":
+				_, _ = w.Write([]byte(`{"id":"run_1","object":"thread.run","thread_id":"thread_1","status":"completed","model":"gpt-4o-mini"}`))
+			case "/v1/threads/thread_1/runs/run_1/steps":
+				_, _ = w.Write([]byte(`{"object":"list","data":[{"id":"step_1","usage":{"prompt_tokens":1000,"completion_tokens":100}},{"id":"step_2","usage":{"prompt_tokens":2000,"completion_tokens":300}}],"has_more":false}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer upstream.Close()
+		baseURL := upstream.URL
+		So(model.DB.Create(&model.Channel{Id: 1, Type: channeltype.OpenAI, Key: "sk-test", BaseURL: &baseURL, Name: "openai"}).Error, ShouldBeNil)
+		token := createTestToken(t, 1, 1000000, 1000000)
+		So(model.PreConsumeTokenQuota(token.Id, 500), ShouldBeNil)
+		run := &model.AssistantRun{RunId: "run_1", ThreadId: "thread_1", UserId: 1, TokenId: token.Id, ChannelId: 1, KeyIndex: -1,
+			Group: "default", Status: "queued", PreConsumedQuota: 500}
+		inserted, err := model.InsertAssistantRun(run)
+		So(err, ShouldBeNil)
+		So(inserted, ShouldBeTrue)
+
+		Convey("bills the usage of the steps once, with the quota pre-consumed", func() {
+			So(SettleAssistantRun(context.Background(), run), ShouldBeNil)
+			ratio := billingratio.GetModelRatio("gpt-4o-mini")
+			quota := int64(math.Ceil((3000 + 400*billingratio.GetCompletionRatio("gpt-4o-mini")) * ratio))
+			userQuota, remainQuota := getTestBalances(t, token)
+			So(userQuota, ShouldEqual, 1000000-quota)
+			So(remainQuota, ShouldEqual, 1000000-quota)
+
+			settled, err := model.GetAssistantRunByRunId("run_1")
+			So(err, ShouldBeNil)
+			So(settled.Status, ShouldEqual, "completed")
+			So(settled.Quota, ShouldEqual, quota)
+			So(settled.PromptTokens, ShouldEqual, 3000)
+			So(SettleAssistantRun(context.Background(), settled), ShouldBeNil)
+			userQuota, _ = getTestBalances(t, token)
+			So(userQuota, ShouldEqual, 1000000-quota)
+		})
+
+		Convey("returns the quota pre-consumed of the expired runs", func() {
+			So(ExpireAssistantRun(context.Background(), run), ShouldBeNil)
+			userQuota, remainQuota := getTestBalances(t, token)
+			So(userQuota, ShouldEqual, 1000000)
+			So(remainQuota, ShouldEqual, 1000000)
+			So(ExpireAssistantRun(context.Background(), run), ShouldBeNil)
+			userQuota, _ = getTestBalances(t, token)
+			So(userQuota, ShouldEqual, 1000000)
+		})
+	})
+}
@@ -0,0 +1,301 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/audio"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/assemblyai"
+	"github.com/songquanpeng/one-api/relay/adaptor/deepgram"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// https://platform.openai.com/docs/api-reference/audio/createTranscription
+// https://platform.openai.com/docs/api-reference/audio/createTranslation
+
+// estimatedAudioBytesPerSecond is the size of a second of 128 kbps audio, the duration of the files which can't be probed is estimated with it
+const estimatedAudioBytesPerSecond = 16000
+
+// transcriptionContentTypes are the response formats of OpenAI rendered for the upstreams of another format
+var transcriptionContentTypes = map[string]string{
+	"json":         "application/json",
+	"verbose_json": "application/json",
+	"text":         "text/plain; charset=utf-8",
+	"srt":          "application/x-subrip",
+	"vtt":          "text/vtt",
+}
+
+// openMultipartFile returns the file part of the spooled body, which is read as a stream
+func openMultipartFile(c *gin.Context, name string) (*multipart.Part, error) {
+	_, params, err := mime.ParseMediaType(c.Request.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	reader := multipart.NewReader(common.GetSpooledRequestBody(c), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s is required", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == name && part.FileName() != "" {
+			return part, nil
+		}
+	}
+}
+
+// getAudioDuration probes the duration of the uploaded audio in seconds, it's estimated by the size of the upload if the format is unknown
+func getAudioDuration(c *gin.Context) (float64, error) {
+	part, err := openMultipartFile(c, "file")
+	if err != nil {
+		return 0, err
+	}
+	duration, err := audio.GetDuration(part)
+	if err != nil {
+		logger.Warnf(c.Request.Context(), "probe audio duration failed, estimated by the size: %s", err.Error())
+		return float64(common.GetSpooledRequestBody(c).Size()) / estimatedAudioBytesPerSecond, nil
+	}
+	return duration, nil
+}
+
+func getAudioQuota(duration float64, ratio float64) int64 {
+	return int64(math.Ceil(duration) * ratio * 1000)
+}
+
+func getAudioLogContent(modelRatio float64, groupRatio float64, duration float64) string {
+	return fmt.Sprintf("模型倍率 %.2f，分组倍率 %.2f，音频时长 %.0f 秒", modelRatio, groupRatio, math.Ceil(duration))
+}
+
+func transcribe(c *gin.Context, fields map[string]string, channelType int, baseURL string, apiKey string, audioModel string, responseFormat string) (*openai.WhisperVerboseJSONResponse, *relaymodel.ErrorWithStatusCode) {
+	part, err := openMultipartFile(c, "file")
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "invalid_transcription_request", http.StatusBadRequest)
+	}
+	file, err := io.ReadAll(part)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "read_audio_file_failed", http.StatusBadRequest)
+	}
+	request := &openai.TranscriptionRequest{
+		Model:           audioModel,
+		Language:        fields["language"],
+		Prompt:          fields["prompt"],
+		File:            file,
+		FileContentType: part.Header.Get("Content-Type"),
+	}
+	if channelType == channeltype.AssemblyAI {
+		withSegments := responseFormat == "verbose_json" || responseFormat == "srt" || responseFormat == "vtt"
+		return assemblyai.Transcribe(c.Request.Context(), baseURL, apiKey, request, withSegments)
+	}
+	return deepgram.Transcribe(c.Request.Context(), baseURL, apiKey, request)
+}
+
+func formatSubtitleTime(seconds float64, separator string) string {
+	milliseconds := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", milliseconds/3600000, milliseconds/60000%60, milliseconds/1000%60, separator, milliseconds%1000)
+}
+
+// renderTranscription renders the transcription as whisper would in the response format,
+// the subtitles of a transcription without segments are a single cue of the whole audio
+func renderTranscription(transcription *openai.WhisperVerboseJSONResponse, responseFormat string) []byte {
+	switch responseFormat {
+	case "verbose_json":
+		jsonStr, _ := json.Marshal(transcription)
+		return jsonStr
+	case "text":
+		return []byte(transcription.Text + "\n")
+	case "srt", "vtt":
+		segments := transcription.Segments
+		if len(segments) == 0 {
+			segments = []openai.Segment{{End: transcription.Duration, Text: transcription.Text}}
+		}
+		var builder strings.Builder
+		separator := ","
+		if responseFormat == "vtt" {
+			builder.WriteString("WEBVTT\n\n")
+			separator = "."
+		}
+		for i, segment := range segments {
+			if responseFormat == "srt" {
+				builder.WriteString(fmt.Sprintf("%d\n", i+1))
+			}
+			builder.WriteString(fmt.Sprintf("%s --> %s\n%s\n\n", formatSubtitleTime(segment.Start, separator), formatSubtitleTime(segment.End, separator), strings.TrimSpace(segment.Text)))
+		}
+		return []byte(builder.String())
+	default:
+		jsonStr, _ := json.Marshal(openai.WhisperJSONResponse{Text: transcription.Text})
+		return jsonStr
+	}
+}
+
+// RelayAudioTranscriptionHelper relays the transcriptions and translations with the upload streamed from the spooled body,
+// they're billed by the second of the audio, the duration reported by the upstream is preferred over the probed one
+func RelayAudioTranscriptionHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	if common.GetSpooledRequestBody(c) == nil {
+		return openai.ErrorWrapper(errors.New("multipart/form-data request is required"), "invalid_transcription_request", http.StatusBadRequest)
+	}
+	fields, err := common.PeekMultipartFields(c)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_transcription_request", http.StatusBadRequest)
+	}
+	responseFormat := fields["response_format"]
+	if responseFormat == "" {
+		responseFormat = "json"
+	}
+
+	// billed with the ratio of the requested model
+	audioModel := meta.OriginModelName
+	modelRatio := billingratio.GetModelRatio(audioModel)
+	groupRatio := billingratio.GetGroupRatio(meta.Group)
+	ratio := modelRatio * groupRatio
+	duration, err := getAudioDuration(c)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_transcription_request", http.StatusBadRequest)
+	}
+	quota := getAudioQuota(duration, ratio)
+	preConsumedQuota, bizErr := getOrPreConsumeFixedQuota(c, quota, meta)
+	if bizErr != nil {
+		logger.Warnf(ctx, "preConsumeQuota failed: %+v", *bizErr)
+		return bizErr
+	}
+
+	// map model name
+	upstreamModel, _ := getMappedModelName(audioModel, meta.ModelMapping)
+	meta.ActualModelName = upstreamModel
+
+	if meta.ChannelType == channeltype.Deepgram || meta.ChannelType == channeltype.AssemblyAI {
+		if _, ok := transcriptionContentTypes[responseFormat]; !ok {
+			return openai.ErrorWrapper(fmt.Errorf("unsupported response_format: %s", responseFormat), "invalid_transcription_request", http.StatusBadRequest)
+		}
+		transcription, bizErr := transcribe(c, fields, meta.ChannelType, meta.BaseURL, meta.APIKey, upstreamModel, responseFormat)
+		if bizErr != nil {
+			return bizErr
+		}
+		if transcription.Duration > 0 {
+			duration = transcription.Duration
+			quota = getAudioQuota(duration, ratio)
+		}
+		go postConsumeAudioQuota(ctx, meta, audioModel, quota, preConsumedQuota, getAudioLogContent(modelRatio, groupRatio, duration), c.GetString(ctxkey.ChannelName))
+		c.Data(http.StatusOK, transcriptionContentTypes[responseFormat], renderTranscription(transcription, responseFormat))
+		return nil
+	}
+
+	var requestBody io.Reader
+	if upstreamModel != audioModel {
+		requestBody, err = rewriteMultipartModel(c, upstreamModel)
+		if err != nil {
+			return openai.ErrorWrapper(err, "rewrite_transcription_request_failed", http.StatusInternalServerError)
+		}
+	} else {
+		requestBody = common.GetSpooledRequestBody(c)
+	}
+
+	fullRequestURL := openai.GetFullRequestURL(meta.BaseURL, meta.RequestURLPath, meta.ChannelType)
+	if meta.ChannelType == channeltype.Azure {
+		deployment := upstreamModel
+		if mapped, ok := meta.Config.DeploymentMapping[upstreamModel]; ok {
+			deployment = mapped
+		}
+		task := "transcriptions"
+		if relayMode == relaymode.AudioTranslation {
+			task = "translations"
+		}
+		// https://learn.microsoft.com/en-us/azure/ai-services/openai/whisper-quickstart?tabs=command-line#rest-api
+		fullRequestURL = fmt.Sprintf("%s/openai/deployments/%s/audio/%s?api-version=%s", meta.BaseURL, deployment, task, meta.Config.APIVersion)
+	}
+	req, err := http.NewRequestWithContext(ctx, c.Request.Method, fullRequestURL, requestBody)
+	if err != nil {
+		return openai.ErrorWrapper(err, "new_request_failed", http.StatusInternalServerError)
+	}
+	if upstreamModel == audioModel {
+		req.ContentLength = common.GetSpooledRequestBody(c).Size()
+	}
+	if meta.ChannelType == channeltype.Azure {
+		err = openai.SetupAzureAuthHeader(req, meta.APIKey)
+		if err != nil {
+			return openai.ErrorWrapper(err, "get_access_token_failed", http.StatusInternalServerError)
+		}
+	} else {
+		adaptor.SetupAuthHeader(req, meta.APIKey, meta.Config)
+	}
+	req.Header.Set("Content-Type", c.Request.Header.Get("Content-Type"))
+	req.Header.Set("Accept", c.Request.Header.Get("Accept"))
+
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return RelayErrorHandler(resp)
+	}
+	defer resp.Body.Close()
+
+	var responseBody []byte
+	if responseFormat == "verbose_json" {
+		responseBody, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+		}
+		var transcription openai.WhisperVerboseJSONResponse
+		if json.Unmarshal(responseBody, &transcription) == nil && transcription.Duration > 0 {
+			duration = transcription.Duration
+			quota = getAudioQuota(duration, ratio)
+		}
+	}
+	go postConsumeAudioQuota(ctx, meta, audioModel, quota, preConsumedQuota, getAudioLogContent(modelRatio, groupRatio, duration), c.GetString(ctxkey.ChannelName))
+
+	adaptor.SetupResponseHeader(c, resp)
+	c.Writer.WriteHeader(resp.StatusCode)
+	if responseBody != nil {
+		_, err = c.Writer.Write(responseBody)
+	} else {
+		_, err = io.Copy(c.Writer, resp.Body)
+	}
+	if err != nil {
+		logger.Errorf(ctx, "copy response body failed: %s", err.Error())
+	}
+	return nil
+}
+
+// postConsumeAudioQuota settles the quota of the speeches, transcriptions and translations, the log content tells what's billed
+func postConsumeAudioQuota(ctx context.Context, meta *meta.Meta, modelName string, quota int64, preConsumedQuota int64, logContent string, channelName string) {
+	err := model.PostConsumeTokenQuota(meta.TokenId, quota-preConsumedQuota)
+	if err != nil {
+		logger.SysError("error consuming token remain quota: " + err.Error())
+	}
+	err = model.CacheUpdateUserQuota(ctx, meta.UserId)
+	if err != nil {
+		logger.SysError("error update user quota cache: " + err.Error())
+	}
+	if quota != 0 {
+		model.RecordConsumeLog(ctx, meta.UserId, meta.ChannelId, 0, 0, modelName, meta.TokenName, meta.TokenId, quota, logContent, channelName)
+		model.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
+		model.UpdateChannelUsedQuota(meta.ChannelId, quota)
+		monitor.RecordSpend(quota)
+	}
+	notifyCompletion(ctx, meta, modelName, 0, 0, quota)
+}
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+func TestRelayAudioHelper(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("RelayAudioHelper", t, func() {
+		useTestDB(t)
+		var hits int32
+		var upstreamModel string
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits, 1)
+			var request struct {
+				Model string `json:"model"`
+			}
+			body, _ := io.ReadAll(r.Body)
+			_ = json.Unmarshal(body, &request)
+			upstreamModel = request.Model
+			w.Header().Set("Content-Type", "audio/mpeg")
+			_, _ = w.Write([]byte("chunk1"))
+			w.(http.Flusher).Flush()
+			_, _ = w.Write([]byte("chunk2"))
+		}))
+		defer upstream.Close()
+		So(model.DB.Create(&model.Channel{Id: 1, Type: channeltype.OpenAI, Key: "sk-test", Name: "openai"}).Error, ShouldBeNil)
+		newContext := func(token *model.Token, body string, modelMapping map[string]string) (*gin.Context, *httptest.ResponseRecorder) {
+			c, w := newRelayTestContext(t, "/v1/audio/speech", body, token, upstream.URL)
+			c.Set(ctxkey.RequestModel, "tts-1")
+			if modelMapping != nil {
+				c.Set(ctxkey.ModelMapping, modelMapping)
+			}
+			return c, w
+		}
+		// the characters are counted rather than the bytes
+		input := "你好，世界"
+		quota := int64(5 * billingratio.GetModelRatio("tts-1") * billingratio.GetGroupRatio("default"))
+
+		Convey("streams the audio and bills the characters with the voice logged", func() {
+			token := createTestToken(t, 1, 1000000, 1000000)
+			c, w := newContext(token, `{"model":"tts-1","input":"`+input+`","voice":"alloy"}`, nil)
+			So(RelayAudioHelper(c, relaymode.AudioSpeech), ShouldBeNil)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Header().Get("Content-Type"), ShouldEqual, "audio/mpeg")
+			So(w.Body.String(), ShouldEqual, "chunk1chunk2")
+			So(upstreamModel, ShouldEqual, "tts-1")
+
+			So(waitChannelUsedQuota(t, 1), ShouldEqual, quota)
+			userQuota, remainQuota := getTestBalances(t, token)
+			So(userQuota, ShouldEqual, 1000000-quota)
+			So(remainQuota, ShouldEqual, 1000000-quota)
+			var log model.Log
+			So(model.LOG_DB.Where("type = ?", model.LogTypeConsume).First(&log).Error, ShouldBeNil)
+			So(log.ModelName, ShouldEqual, "tts-1")
+			So(log.Quota, ShouldEqual, quota)
+			So(log.Content, ShouldContainSubstring, "5 字符")
+			So(log.Content, ShouldContainSubstring, "音色 alloy")
+		})
+
+		Convey("sends the mapped model to the upstream", func() {
+			token := createTestToken(t, 2, 1000000, 1000000)
+			c, _ := newContext(token, `{"model":"tts-1","input":"hello","voice":"alloy"}`, map[string]string{"tts-1": "tts-1-hd"})
+			So(RelayAudioHelper(c, relaymode.AudioSpeech), ShouldBeNil)
+			So(upstreamModel, ShouldEqual, "tts-1-hd")
+		})
+
+		Convey("rejects the input over 4096 characters", func() {
+			token := createTestToken(t, 3, 1000000, 1000000)
+			c, _ := newContext(token, `{"model":"tts-1","input":"`+strings.Repeat("你", 4097)+`","voice":"alloy"}`, nil)
+			err := RelayAudioHelper(c, relaymode.AudioSpeech)
+			So(err, ShouldNotBeNil)
+			So(err.Code, ShouldEqual, "text_too_long")
+			So(atomic.LoadInt32(&hits), ShouldEqual, 0)
+		})
+	})
+}
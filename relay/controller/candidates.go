@@ -0,0 +1,231 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// applyCandidateEmulation returns how many parallel requests to send for a chat request with n > 1 to a model
+// configured in ModelCandidateEmulation, 1 means no emulation. The emulated requests are sent without n and
+// without streaming, and the merged response is sent as a stream if the client asked for one.
+func applyCandidateEmulation(textRequest *relaymodel.GeneralOpenAIRequest, meta *meta.Meta, streamConversion *int) (int, *relaymodel.ErrorWithStatusCode) {
+	if meta.Mode != relaymode.ChatCompletions || textRequest.N <= 1 {
+		return 1, nil
+	}
+	maxCandidates, ok := config.ModelCandidateEmulation[textRequest.Model]
+	if !ok || maxCandidates <= 1 {
+		return 1, nil
+	}
+	if textRequest.N > maxCandidates {
+		return 0, &relaymodel.ErrorWithStatusCode{
+			Error: relaymodel.Error{
+				Message: fmt.Sprintf("n should be at most %d for the model %s.", maxCandidates, meta.OriginModelName),
+				Type:    "invalid_request_error",
+				Param:   "n",
+				Code:    "invalid_value",
+			},
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	isClientStream := textRequest.Stream
+	switch *streamConversion {
+	case streamConversionToStream:
+		isClientStream = true
+	case streamConversionToNonStream:
+		isClientStream = false
+	}
+	*streamConversion = streamConversionNone
+	if isClientStream {
+		*streamConversion = streamConversionToStream
+	}
+	candidates := textRequest.N
+	textRequest.N = 0
+	textRequest.Stream = false
+	meta.IsStream = false
+	return candidates, nil
+}
+
+// candidateWriter keeps the response of one emulated candidate, with headers of its own
+// as the candidates are relayed concurrently
+type candidateWriter struct {
+	*bufferedResponseWriter
+	header http.Header
+}
+
+func (w *candidateWriter) Header() http.Header {
+	return w.header
+}
+
+type candidateResult struct {
+	body  []byte
+	usage *relaymodel.Usage
+	err   *relaymodel.ErrorWithStatusCode
+}
+
+// candidate is one of the emulated requests, each has its own adaptor, context and meta
+type candidate struct {
+	c       *gin.Context
+	writer  *candidateWriter
+	meta    *meta.Meta
+	adaptor adaptor.Adaptor
+	body    []byte
+}
+
+func newCandidate(c *gin.Context, meta *meta.Meta, textRequest *relaymodel.GeneralOpenAIRequest, requestBody []byte) (*candidate, error) {
+	candidateMeta := *meta
+	cand := &candidate{
+		c:       c.Copy(),
+		writer:  &candidateWriter{bufferedResponseWriter: newBufferedResponseWriter(c.Writer), header: make(http.Header)},
+		meta:    &candidateMeta,
+		adaptor: relay.GetAdaptor(meta.APIType),
+		body:    requestBody,
+	}
+	cand.c.Writer = cand.writer
+	cand.adaptor.Init(cand.meta)
+	if meta.APIType != apitype.OpenAI {
+		// some adaptors keep what they need to send the request while converting it
+		candidateRequest := *textRequest
+		convertedRequest, err := cand.adaptor.ConvertRequest(cand.c, meta.Mode, &candidateRequest)
+		if err != nil {
+			return nil, err
+		}
+		cand.body, err = json.Marshal(convertedRequest)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return cand, nil
+}
+
+func (cand *candidate) relay() candidateResult {
+	resp, err := cand.adaptor.DoRequest(cand.c, cand.meta, bytes.NewReader(cand.body))
+	if err != nil {
+		return candidateResult{err: openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)}
+	}
+	if isErrorHappened(cand.meta, resp) {
+		return candidateResult{err: RelayErrorHandler(resp)}
+	}
+	usage, respErr := cand.adaptor.DoResponse(cand.c, resp, cand.meta)
+	if respErr != nil {
+		return candidateResult{err: respErr}
+	}
+	return candidateResult{body: cand.writer.body.Bytes(), usage: usage}
+}
+
+// mergeCandidates puts the choices of the responses together, indexed in order
+func mergeCandidates(bodies [][]byte) (*openai.TextResponse, error) {
+	var merged *openai.TextResponse
+	for _, body := range bodies {
+		var response openai.TextResponse
+		err := json.Unmarshal(body, &response)
+		if err != nil {
+			return nil, err
+		}
+		if merged == nil {
+			merged = &openai.TextResponse{
+				Id:      response.Id,
+				Model:   response.Model,
+				Object:  response.Object,
+				Created: response.Created,
+
+				PerplexityExtension: response.PerplexityExtension,
+			}
+		}
+		for _, choice := range response.Choices {
+			choice.Index = len(merged.Choices)
+			merged.Choices = append(merged.Choices, choice)
+		}
+	}
+	if merged == nil {
+		return nil, fmt.Errorf("no candidate")
+	}
+	return merged, nil
+}
+
+// relayCandidates sends the request as many times as candidates in parallel and writes the merged response,
+// the request fails if any of them fails, and the returned usage is the sum of them all
+func relayCandidates(c *gin.Context, meta *meta.Meta, textRequest *relaymodel.GeneralOpenAIRequest, requestBody io.Reader, candidates int, streamConversion int) (*relaymodel.Usage, *relaymodel.ErrorWithStatusCode) {
+	ctx := c.Request.Context()
+	body, err := io.ReadAll(requestBody)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "read_request_body_failed", http.StatusInternalServerError)
+	}
+	// the requests are converted one after another, only sending them is concurrent
+	pending := make([]*candidate, 0, candidates)
+	for i := 0; i < candidates; i++ {
+		cand, err := newCandidate(c, meta, textRequest, body)
+		if err != nil {
+			return nil, openai.ErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
+		}
+		pending = append(pending, cand)
+	}
+	results := make([]candidateResult, candidates)
+	var wg sync.WaitGroup
+	for i, cand := range pending {
+		wg.Add(1)
+		go func(i int, cand *candidate) {
+			defer wg.Done()
+			results[i] = cand.relay()
+		}(i, cand)
+	}
+	wg.Wait()
+
+	usage := &relaymodel.Usage{}
+	bodies := make([][]byte, 0, candidates)
+	for i, result := range results {
+		if result.err != nil {
+			logger.Errorf(ctx, "candidate %d of %d failed: %s", i+1, candidates, result.err.Message)
+			return nil, result.err
+		}
+		if result.usage != nil {
+			usage.PromptTokens += result.usage.PromptTokens
+			usage.CompletionTokens += result.usage.CompletionTokens
+			usage.TotalTokens += result.usage.TotalTokens
+			usage.Cost += result.usage.Cost
+		}
+		bodies = append(bodies, result.body)
+	}
+	response, err := mergeCandidates(bodies)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "merge_candidates_failed", http.StatusInternalServerError)
+	}
+	response.Usage = *usage
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError)
+	}
+
+	restoreWriter := captureFinishReason(c, meta)
+	finishValidation := validateConvertedResponse(c, meta)
+	if streamConversion == streamConversionToStream {
+		err = writeResponseAsStream(c, jsonResponse)
+	} else {
+		c.Writer.Header().Set("Content-Type", "application/json")
+		c.Writer.WriteHeader(http.StatusOK)
+		_, err = c.Writer.Write(jsonResponse)
+	}
+	respErr := finishValidation()
+	restoreWriter()
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "write_response_failed", http.StatusInternalServerError)
+	}
+	if respErr != nil {
+		return nil, respErr
+	}
+	return usage, nil
+}
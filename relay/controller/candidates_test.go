@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+func TestApplyCandidateEmulation(t *testing.T) {
+	Convey("applyCandidateEmulation", t, func() {
+		oldEmulation := config.ModelCandidateEmulation
+		config.ModelCandidateEmulation = map[string]int{"deepseek-chat": 4}
+		t.Cleanup(func() {
+			config.ModelCandidateEmulation = oldEmulation
+		})
+		chatMeta := func() *meta.Meta {
+			return &meta.Meta{Mode: relaymode.ChatCompletions, OriginModelName: "deepseek-chat", IsStream: true}
+		}
+
+		Convey("only models configured are emulated", func() {
+			streamConversion := streamConversionNone
+			candidates, err := applyCandidateEmulation(&relaymodel.GeneralOpenAIRequest{Model: "gpt-4o", N: 3}, chatMeta(), &streamConversion)
+			So(err, ShouldBeNil)
+			So(candidates, ShouldEqual, 1)
+			candidates, _ = applyCandidateEmulation(&relaymodel.GeneralOpenAIRequest{Model: "deepseek-chat", N: 1}, chatMeta(), &streamConversion)
+			So(candidates, ShouldEqual, 1)
+		})
+
+		Convey("the requests are sent without n and without streaming", func() {
+			request := &relaymodel.GeneralOpenAIRequest{Model: "deepseek-chat", N: 3, Stream: true}
+			requestMeta := chatMeta()
+			streamConversion := streamConversionNone
+			candidates, err := applyCandidateEmulation(request, requestMeta, &streamConversion)
+			So(err, ShouldBeNil)
+			So(candidates, ShouldEqual, 3)
+			So(request.N, ShouldEqual, 0)
+			So(request.Stream, ShouldBeFalse)
+			So(requestMeta.IsStream, ShouldBeFalse)
+			So(streamConversion, ShouldEqual, streamConversionToStream)
+		})
+
+		Convey("a stream converted for the client is sent as it was asked", func() {
+			request := &relaymodel.GeneralOpenAIRequest{Model: "deepseek-chat", N: 2}
+			streamConversion := streamConversionToNonStream
+			_, err := applyCandidateEmulation(request, chatMeta(), &streamConversion)
+			So(err, ShouldBeNil)
+			So(streamConversion, ShouldEqual, streamConversionNone)
+		})
+
+		Convey("n above the limit of the model is rejected", func() {
+			streamConversion := streamConversionNone
+			_, err := applyCandidateEmulation(&relaymodel.GeneralOpenAIRequest{Model: "deepseek-chat", N: 5}, chatMeta(), &streamConversion)
+			So(err, ShouldNotBeNil)
+			So(err.StatusCode, ShouldEqual, http.StatusBadRequest)
+			So(err.Param, ShouldEqual, "n")
+		})
+	})
+}
+
+func TestMergeCandidates(t *testing.T) {
+	Convey("mergeCandidates indexes the choices in order", t, func() {
+		merged, err := mergeCandidates([][]byte{
+			[]byte(`{"id":"chatcmpl-1","model":"m","choices":[{"index":0,"message":{"role":"assistant","content":"a"}}]}`),
+			[]byte(`{"id":"chatcmpl-2","model":"m","choices":[{"index":0,"message":{"role":"assistant","content":"b"}}]}`),
+		})
+		So(err, ShouldBeNil)
+		So(merged.Id, ShouldEqual, "chatcmpl-1")
+		So(merged.Choices, ShouldHaveLength, 2)
+		So(merged.Choices[1].Index, ShouldEqual, 1)
+		So(merged.Choices[1].Content, ShouldEqual, "b")
+
+		_, err = mergeCandidates(nil)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestRelayTextHelperCandidateEmulation(t *testing.T) {
+	Convey("n is emulated with parallel requests billed together", t, func() {
+		useTestDB(t)
+		// the token encoders aren't loaded in the tests
+		oldApproximateTokenEnabled, oldEmulation := config.ApproximateTokenEnabled, config.ModelCandidateEmulation
+		config.ApproximateTokenEnabled = true
+		config.ModelCandidateEmulation = map[string]int{"deepseek-chat": 4}
+		t.Cleanup(func() {
+			config.ApproximateTokenEnabled, config.ModelCandidateEmulation = oldApproximateTokenEnabled, oldEmulation
+		})
+		token := createTestToken(t, 1, 1000000, 1000000)
+		So(model.DB.Create(&model.Channel{Id: 1, Type: channeltype.DeepSeek, Key: "sk-test", Name: "deepseek"}).Error, ShouldBeNil)
+		var hits int32
+		var unconverted int32
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hit := atomic.AddInt32(&hits, 1)
+			body, _ := io.ReadAll(r.Body)
+			if strings.Contains(string(body), `"n":`) || strings.Contains(string(body), `"stream":true`) {
+				atomic.AddInt32(&unconverted, 1)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(fmt.Sprintf(`{"id":"chatcmpl-%d","object":"chat.completion","created":1700000000,"model":"deepseek-chat",
+				"choices":[{"index":0,"message":{"role":"assistant","content":"answer"},"finish_reason":"stop"}],
+				"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`, hit)))
+		}))
+		defer upstream.Close()
+
+		c, w := newRelayTestContext(t, "/v1/chat/completions", `{"model":"deepseek-chat","n":3,"messages":[{"role":"user","content":"hello"}]}`, token, upstream.URL)
+		c.Set(ctxkey.Channel, channeltype.DeepSeek)
+
+		So(RelayTextHelper(c), ShouldBeNil)
+		So(atomic.LoadInt32(&hits), ShouldEqual, 3)
+		So(atomic.LoadInt32(&unconverted), ShouldEqual, 0)
+		var response openai.TextResponse
+		So(json.Unmarshal(w.Body.Bytes(), &response), ShouldBeNil)
+		So(response.Choices, ShouldHaveLength, 3)
+		for i, choice := range response.Choices {
+			So(choice.Index, ShouldEqual, i)
+		}
+		So(response.Usage, ShouldResemble, relaymodel.Usage{PromptTokens: 30, CompletionTokens: 15, TotalTokens: 45})
+
+		So(waitChannelUsedQuota(t, 1), ShouldBeGreaterThan, 0)
+	})
+}
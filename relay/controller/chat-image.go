@@ -0,0 +1,191 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/imagehost"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/render"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// chatImageWriter counts the images generated in a chat completion, in the images of the messages like OpenRouter
+// or in the image_url parts of the content, and re-hosts the base64 ones if ChatImageRehostEnabled.
+// The events of a stream are passed through line by line, a non-stream response is held back until it's complete.
+type chatImageWriter struct {
+	gin.ResponseWriter
+	c        *gin.Context
+	isStream bool
+	pending  render.LineBuffer
+	status   int
+	images   int
+}
+
+func (w *chatImageWriter) Write(data []byte) (int, error) {
+	w.pending.Write(data)
+	if !w.isStream {
+		return len(data), nil
+	}
+	err := w.pending.EachLine(func(line []byte) error {
+		_, err := w.ResponseWriter.Write(w.processEvent(line))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (w *chatImageWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// processEvent returns the line with the images of the event re-hosted, the lines without images are kept as is
+func (w *chatImageWriter) processEvent(line []byte) []byte {
+	if !bytes.Contains(line, []byte(`"image_url"`)) {
+		return line
+	}
+	payload, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+	if !ok {
+		return line
+	}
+	processed, ok := w.processImages(bytes.TrimSpace(payload), "delta")
+	if !ok {
+		return line
+	}
+	return []byte("data: " + string(processed) + "\n")
+}
+
+// processImages counts the images in the choices, and returns the body with them re-hosted if any is
+func (w *chatImageWriter) processImages(body []byte, field string) ([]byte, bool) {
+	var response map[string]any
+	if json.Unmarshal(body, &response) != nil {
+		return nil, false
+	}
+	choices, _ := response["choices"].([]any)
+	isModified := false
+	for _, choice := range choices {
+		choice, _ := choice.(map[string]any)
+		message, _ := choice[field].(map[string]any)
+		images, _ := message["images"].([]any)
+		parts, _ := message["content"].([]any)
+		for _, part := range append(images, parts...) {
+			part, _ := part.(map[string]any)
+			if part["type"] != "image_url" {
+				continue
+			}
+			w.images++
+			if w.rehostImage(part) {
+				isModified = true
+			}
+		}
+	}
+	if !isModified {
+		return nil, false
+	}
+	processed, err := json.Marshal(response)
+	if err != nil {
+		return nil, false
+	}
+	return processed, true
+}
+
+// rehostImage replaces the data URL of the image_url part with a link to the image saved
+func (w *chatImageWriter) rehostImage(part map[string]any) bool {
+	if !config.ChatImageRehostEnabled || !imagehost.Configured() {
+		return false
+	}
+	imageURL, _ := part["image_url"].(map[string]any)
+	dataURL, _ := imageURL["url"].(string)
+	if !strings.HasPrefix(dataURL, "data:") {
+		return false
+	}
+	link, err := imagehost.SaveDataURL(dataURL)
+	if err != nil {
+		// the image is still relayed as is
+		logger.Errorf(w.c.Request.Context(), "failed to re-host the image: %s", err.Error())
+		return false
+	}
+	imageURL["url"] = link
+	return true
+}
+
+func (w *chatImageWriter) WriteHeader(code int) {
+	if w.isStream {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if code > 0 {
+		w.status = code
+	}
+}
+
+func (w *chatImageWriter) WriteHeaderNow() {
+	if w.isStream {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *chatImageWriter) Written() bool {
+	if w.isStream {
+		return w.ResponseWriter.Written()
+	}
+	return false
+}
+
+func (w *chatImageWriter) Status() int {
+	if w.isStream {
+		return w.ResponseWriter.Status()
+	}
+	return w.status
+}
+
+// finish writes the held back response, it must be called after the writer of the context is restored
+func (w *chatImageWriter) finish() {
+	if w.isStream {
+		if w.pending.Len() > 0 {
+			_, _ = w.ResponseWriter.Write(w.processEvent(w.pending.Bytes()))
+		}
+		return
+	}
+	if w.pending.Len() == 0 {
+		return
+	}
+	body := w.pending.Bytes()
+	if w.status == http.StatusOK && bytes.Contains(body, []byte(`"image_url"`)) {
+		if processed, ok := w.processImages(body, "message"); ok {
+			body = processed
+			w.Header().Del("Content-Length")
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	_, _ = w.ResponseWriter.Write(body)
+}
+
+// relayChatImages sets up the counting of the images generated in the chat completions. It must be called before
+// the other writers are set up, so that it sees the response the client gets, the returned function restores the
+// writer of the context, writes the response and returns the number of the images.
+func relayChatImages(c *gin.Context, meta *meta.Meta, streamConversion int) func() int {
+	if meta.Mode != relaymode.ChatCompletions {
+		return func() int { return 0 }
+	}
+	writer := &chatImageWriter{
+		ResponseWriter: c.Writer,
+		c:              c,
+		// the stream of the upstream is converted for the client, or the other way around
+		isStream: meta.IsStream != (streamConversion != streamConversionNone),
+		status:   http.StatusOK,
+	}
+	c.Writer = writer
+	return func() int {
+		c.Writer = writer.ResponseWriter
+		writer.finish()
+		return writer.images
+	}
+}
@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// embeddingBatchItem keeps the embedding as is, it's a base64 string if the client asked for one
+type embeddingBatchItem struct {
+	Object    string          `json:"object"`
+	Index     int             `json:"index"`
+	Embedding json.RawMessage `json:"embedding"`
+}
+
+type embeddingBatchResponse struct {
+	Object string               `json:"object"`
+	Data   []embeddingBatchItem `json:"data"`
+	Model  string               `json:"model"`
+	Usage  relaymodel.Usage     `json:"usage"`
+}
+
+// splitEmbeddingInput splits the inputs of an embeddings request into batches of at most batchSize,
+// a single input, either a string or an array of tokens, is never split
+func splitEmbeddingInput(input any, batchSize int) [][]any {
+	items, ok := input.([]any)
+	if !ok || batchSize <= 0 || len(items) <= batchSize {
+		return nil
+	}
+	if _, isToken := items[0].(float64); isToken {
+		return nil
+	}
+	var batches [][]any
+	for start := 0; start < len(items); start += batchSize {
+		end := start + batchSize
+		if end > len(items) {
+			end = len(items)
+		}
+		batches = append(batches, items[start:end])
+	}
+	return batches
+}
+
+// getEmbeddingBatches returns the batches of the request if it's to be split by the channel's EmbeddingBatchSize
+func getEmbeddingBatches(textRequest *relaymodel.GeneralOpenAIRequest, meta *meta.Meta) [][]any {
+	if meta.Mode != relaymode.Embeddings {
+		return nil
+	}
+	return splitEmbeddingInput(textRequest.Input, meta.Config.EmbeddingBatchSize)
+}
+
+// mergeEmbeddingBatches puts the embeddings of the batches together, indexed in the order of the inputs
+func mergeEmbeddingBatches(bodies [][]byte, batches [][]any) (*embeddingBatchResponse, error) {
+	merged := &embeddingBatchResponse{Object: "list"}
+	offset := 0
+	for i, body := range bodies {
+		var response embeddingBatchResponse
+		err := json.Unmarshal(body, &response)
+		if err != nil {
+			return nil, err
+		}
+		merged.Model = response.Model
+		for _, item := range response.Data {
+			item.Index += offset
+			merged.Data = append(merged.Data, item)
+		}
+		offset += len(batches[i])
+	}
+	return merged, nil
+}
+
+// relayEmbeddingBatches sends a request per batch in parallel and writes the merged response. The request fails as a whole
+// if any of the batches fails, so that it's retried on another channel, a client never gets some of the embeddings only.
+// The returned usage is the sum of them all
+func relayEmbeddingBatches(c *gin.Context, meta *meta.Meta, textRequest *relaymodel.GeneralOpenAIRequest, batches [][]any) (*relaymodel.Usage, *relaymodel.ErrorWithStatusCode) {
+	ctx := c.Request.Context()
+	// the requests are converted one after another, only sending them is concurrent
+	pending := make([]*candidate, 0, len(batches))
+	for _, batch := range batches {
+		batchRequest := *textRequest
+		batchRequest.Input = batch
+		body, err := json.Marshal(batchRequest)
+		if err != nil {
+			return nil, openai.ErrorWrapper(err, "json_marshal_failed", http.StatusInternalServerError)
+		}
+		cand, err := newCandidate(c, meta, &batchRequest, body)
+		if err != nil {
+			return nil, openai.ErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
+		}
+		pending = append(pending, cand)
+	}
+	results := make([]candidateResult, len(batches))
+	var wg sync.WaitGroup
+	for i, cand := range pending {
+		wg.Add(1)
+		go func(i int, cand *candidate) {
+			defer wg.Done()
+			results[i] = cand.relay()
+		}(i, cand)
+	}
+	wg.Wait()
+
+	usage := &relaymodel.Usage{}
+	bodies := make([][]byte, 0, len(batches))
+	for i, result := range results {
+		if result.err != nil {
+			logger.Errorf(ctx, "embedding batch %d of %d failed: %s", i+1, len(batches), result.err.Message)
+			return nil, result.err
+		}
+		if result.usage != nil {
+			usage.PromptTokens += result.usage.PromptTokens
+			usage.TotalTokens += result.usage.TotalTokens
+			usage.Cost += result.usage.Cost
+		}
+		bodies = append(bodies, result.body)
+	}
+	response, err := mergeEmbeddingBatches(bodies, batches)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "merge_embedding_batches_failed", http.StatusInternalServerError)
+	}
+	response.Usage = *usage
+	c.JSON(http.StatusOK, response)
+	return usage, nil
+}
@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+func TestSplitEmbeddingInput(t *testing.T) {
+	Convey("splitEmbeddingInput", t, func() {
+		batches := splitEmbeddingInput([]any{"a", "b", "c", "d", "e"}, 2)
+		So(batches, ShouldResemble, [][]any{{"a", "b"}, {"c", "d"}, {"e"}})
+
+		// within the batch size, a single input or no batch size
+		So(splitEmbeddingInput([]any{"a", "b"}, 2), ShouldBeNil)
+		So(splitEmbeddingInput("a", 1), ShouldBeNil)
+		So(splitEmbeddingInput([]any{"a", "b", "c"}, 0), ShouldBeNil)
+		// an array of tokens is a single input
+		So(splitEmbeddingInput([]any{float64(1), float64(2), float64(3)}, 2), ShouldBeNil)
+	})
+}
+
+func TestGetEmbeddingBatches(t *testing.T) {
+	Convey("only the embeddings requests are split", t, func() {
+		request := &relaymodel.GeneralOpenAIRequest{Input: []any{"a", "b", "c"}}
+		embeddingMeta := &meta.Meta{Mode: relaymode.Embeddings, Config: model.ChannelConfig{EmbeddingBatchSize: 2}}
+		So(getEmbeddingBatches(request, embeddingMeta), ShouldHaveLength, 2)
+		embeddingMeta.Mode = relaymode.ChatCompletions
+		So(getEmbeddingBatches(request, embeddingMeta), ShouldBeNil)
+	})
+}
+
+func TestMergeEmbeddingBatches(t *testing.T) {
+	Convey("mergeEmbeddingBatches indexes the embeddings in the order of the inputs", t, func() {
+		merged, err := mergeEmbeddingBatches([][]byte{
+			[]byte(`{"object":"list","model":"m","data":[{"object":"embedding","index":0,"embedding":[0.1]},{"object":"embedding","index":1,"embedding":[0.2]}]}`),
+			[]byte(`{"object":"list","model":"m","data":[{"object":"embedding","index":0,"embedding":"AAAA"}]}`),
+		}, [][]any{{"a", "b"}, {"c"}})
+		So(err, ShouldBeNil)
+		So(merged.Object, ShouldEqual, "list")
+		So(merged.Model, ShouldEqual, "m")
+		So(merged.Data, ShouldHaveLength, 3)
+		So(merged.Data[2].Index, ShouldEqual, 2)
+		// a base64 embedding is kept as is
+		So(string(merged.Data[2].Embedding), ShouldEqual, `"AAAA"`)
+
+		_, err = mergeEmbeddingBatches([][]byte{[]byte("not json")}, [][]any{{"a"}})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestRelayTextHelperEmbeddingBatches(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("the embeddings over the batch size of the channel are split", t, func() {
+		useTestDB(t)
+		// the token encoders aren't loaded in the tests
+		oldApproximateTokenEnabled := config.ApproximateTokenEnabled
+		config.ApproximateTokenEnabled = true
+		t.Cleanup(func() {
+			config.ApproximateTokenEnabled = oldApproximateTokenEnabled
+		})
+		So(model.DB.Create(&model.Channel{Id: 1, Type: channeltype.OpenAI, Key: "sk-test", Name: "openai"}).Error, ShouldBeNil)
+		var hits int32
+		var failing int32
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits, 1)
+			var request struct {
+				Input []string `json:"input"`
+			}
+			body, _ := io.ReadAll(r.Body)
+			_ = json.Unmarshal(body, &request)
+			w.Header().Set("Content-Type", "application/json")
+			if atomic.LoadInt32(&failing) == 1 && request.Input[0] == "c" {
+				w.WriteHeader(http.StatusInternalServerError)
+				_, _ = w.Write([]byte(`{"error":{"message":"upstream failed","type":"server_error"}}`))
+				return
+			}
+			// the embedding tells which input it's for
+			var data []string
+			for i, input := range request.Input {
+				data = append(data, fmt.Sprintf(`{"object":"embedding","index":%d,"embedding":"%s"}`, i, input))
+			}
+			_, _ = fmt.Fprintf(w, `{"object":"list","model":"text-embedding-3-small","data":[%s],"usage":{"prompt_tokens":%d,"total_tokens":%d}}`,
+				strings.Join(data, ","), len(request.Input), len(request.Input))
+		}))
+		defer upstream.Close()
+		newContext := func(token *model.Token) (*gin.Context, *httptest.ResponseRecorder) {
+			c, w := newRelayTestContext(t, "/v1/embeddings", `{"model":"text-embedding-3-small","input":["a","b","c","d","e"]}`, token, upstream.URL)
+			c.Set(ctxkey.Config, model.ChannelConfig{EmbeddingBatchSize: 2})
+			return c, w
+		}
+
+		Convey("the batches are merged in order with the usage summed", func() {
+			token := createTestToken(t, 1, 1000000, 1000000)
+			c, w := newContext(token)
+			So(RelayTextHelper(c), ShouldBeNil)
+			So(atomic.LoadInt32(&hits), ShouldEqual, 3)
+			var response embeddingBatchResponse
+			So(json.Unmarshal(w.Body.Bytes(), &response), ShouldBeNil)
+			So(response.Data, ShouldHaveLength, 5)
+			for i, input := range []string{"a", "b", "c", "d", "e"} {
+				So(response.Data[i].Index, ShouldEqual, i)
+				So(string(response.Data[i].Embedding), ShouldEqual, `"`+input+`"`)
+			}
+			So(response.Usage.PromptTokens, ShouldEqual, 5)
+			So(response.Usage.TotalTokens, ShouldEqual, 5)
+
+			So(waitChannelUsedQuota(t, 1), ShouldBeGreaterThan, 0)
+		})
+
+		Convey("a failed batch fails the whole request", func() {
+			atomic.StoreInt32(&failing, 1)
+			token := createTestToken(t, 2, 1000000, 1000000)
+			c, w := newContext(token)
+			err := RelayTextHelper(c)
+			So(err, ShouldNotBeNil)
+			So(err.StatusCode, ShouldEqual, http.StatusInternalServerError)
+			So(err.Message, ShouldEqual, "upstream failed")
+			So(w.Body.Len(), ShouldEqual, 0)
+		})
+	})
+}
@@ -3,6 +3,7 @@ package controller
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/relay/model"
@@ -17,6 +18,7 @@ type GeneralErrorResponse struct {
 	Msg      string      `json:"msg"`
 	Err      string      `json:"err"`
 	ErrorMsg string      `json:"error_msg"`
+	Detail   any         `json:"detail"` // e.g. AI21, a string or a list of validation errors
 	Header   struct {
 		Message string `json:"message"`
 	} `json:"header"`
@@ -43,6 +45,22 @@ func (e GeneralErrorResponse) ToMessage() string {
 	if e.ErrorMsg != "" {
 		return e.ErrorMsg
 	}
+	if detail, ok := e.Detail.(string); ok && detail != "" {
+		return detail
+	}
+	if detail, ok := e.Detail.(map[string]any); ok {
+		// e.g. ElevenLabs
+		if message, ok := detail["message"].(string); ok {
+			return message
+		}
+	}
+	if details, ok := e.Detail.([]any); ok && len(details) > 0 {
+		if detail, ok := details[0].(map[string]any); ok {
+			if message, ok := detail["msg"].(string); ok {
+				return message
+			}
+		}
+	}
 	if e.Header.Message != "" {
 		return e.Header.Message
 	}
@@ -77,7 +95,7 @@ func RelayErrorHandler(resp *http.Response) (ErrorWithStatusCode *model.ErrorWit
 		return
 	}
 	if config.DebugEnabled {
-		logger.SysLog(fmt.Sprintf("error happened, status code: %d, response: \n%s", resp.StatusCode, string(responseBody)))
+		logger.SysLog(fmt.Sprintf("error happened, status code: %d, response: \n%s", resp.StatusCode, common.TruncateBody(responseBody, config.BodyCaptureMaxBytes)))
 	}
 	err = resp.Body.Close()
 	if err != nil {
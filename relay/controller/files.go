@@ -0,0 +1,228 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+const fileDeleteTimeout = 30 * time.Second
+
+// the most files listed at once, same as OpenAI
+const maxFileListLimit = 10000
+
+// getChannelKey returns the key of the channel at the index, the first one if it's out of range
+func getChannelKey(channel *model.Channel, keyIndex int) string {
+	keys := channel.GetKeys()
+	if keyIndex >= 0 && keyIndex < len(keys) {
+		return keys[keyIndex]
+	}
+	if len(keys) != 0 {
+		return keys[0]
+	}
+	return ""
+}
+
+func toFileObject(file *model.File) *openai.FileObject {
+	return &openai.FileObject{
+		Id:        file.FileId,
+		Object:    "file",
+		Bytes:     file.Bytes,
+		CreatedAt: file.CreatedAt,
+		Filename:  file.Filename,
+		Purpose:   file.Purpose,
+		Status:    "processed",
+	}
+}
+
+// ListFilesHelper lists the files uploaded by the user from the database, as the list of the upstream is the
+// list of the whole account, and the files of the user can be in different channels
+func ListFilesHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > maxFileListLimit {
+		limit = maxFileListLimit
+	}
+	// one more is fetched to know if there are more
+	files, err := model.GetUserFiles(c.GetInt(ctxkey.Id), c.Query("purpose"), c.Query("after"), limit+1, c.Query("order") == "asc")
+	if err != nil {
+		return openai.ErrorWrapper(err, "list_files_failed", http.StatusInternalServerError)
+	}
+	list := openai.FileObjectList{Object: "list", Data: make([]*openai.FileObject, 0, len(files))}
+	if len(files) > limit {
+		files = files[:limit]
+		list.HasMore = true
+	}
+	for _, file := range files {
+		list.Data = append(list.Data, toFileObject(file))
+	}
+	if len(list.Data) != 0 {
+		list.FirstId = list.Data[0].Id
+		list.LastId = list.Data[len(list.Data)-1].Id
+	}
+	c.JSON(http.StatusOK, list)
+	return nil
+}
+
+// RelayFilesHelper relays the uploads and the deletions of files to the OpenAI compatible channels as they are,
+// the files uploaded are remembered so that the later requests are sent to the same account, and they take the
+// storage quota of the user until they're deleted. The files are retrieved by RelayGetHelper.
+func RelayFilesHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	if meta.APIType != apitype.OpenAI || meta.ChannelType == channeltype.Azure {
+		return openai.ErrorWrapper(errors.New("API not implemented by the channel"), "api_not_implemented", http.StatusNotImplemented)
+	}
+	var requestBody io.Reader
+	var contentLength int64
+	var reservedFile *model.File
+	if c.Request.Method == http.MethodPost {
+		body := common.GetSpooledRequestBody(c)
+		if body == nil {
+			return openai.ErrorWrapper(errors.New("multipart/form-data request is required"), "invalid_file_request", http.StatusBadRequest)
+		}
+		// the multipart body is a bit larger than the file, it's reserved as is for the file is not known yet
+		var err error
+		reservedFile, err = model.ReserveFile(meta.UserId, body.Size(), config.UserFileStorageQuota)
+		if errors.Is(err, model.ErrFileStorageQuotaExceeded) {
+			return openai.ErrorWrapper(fmt.Errorf("file storage quota of %d bytes exceeded", config.UserFileStorageQuota), "file_storage_quota_exceeded", http.StatusForbidden)
+		}
+		if err != nil {
+			return openai.ErrorWrapper(err, "reserve_file_failed", http.StatusInternalServerError)
+		}
+		defer func() {
+			if strings.HasPrefix(reservedFile.FileId, model.PendingFileIdPrefix) {
+				deleteReservedFile(ctx, reservedFile)
+			}
+		}()
+		requestBody = body
+		contentLength = body.Size()
+	}
+	fullRequestURL := openai.GetFullRequestURL(meta.BaseURL, meta.RequestURLPath, meta.ChannelType)
+	req, err := http.NewRequestWithContext(ctx, c.Request.Method, fullRequestURL, requestBody)
+	if err != nil {
+		return openai.ErrorWrapper(err, "new_request_failed", http.StatusInternalServerError)
+	}
+	req.ContentLength = contentLength
+	a := &openai.Adaptor{}
+	a.Init(meta)
+	err = a.SetupRequestHeader(c, req, meta)
+	if err != nil {
+		return openai.ErrorWrapper(err, "setup_request_header_failed", http.StatusInternalServerError)
+	}
+	if requestBody == nil {
+		req.Header.Del("Content-Type")
+	}
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound && c.Request.Method == http.MethodDelete {
+		// deleted from the account by others, it takes no storage any more
+		deleteFileRecord(ctx, meta.UserId, c.Param("id"))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return RelayErrorHandler(resp)
+	}
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	file := openai.FileObject{}
+	err = json.Unmarshal(responseBody, &file)
+	if err != nil {
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+	}
+	if c.Request.Method == http.MethodPost {
+		bizErr := saveFile(c, meta, reservedFile, &file)
+		if bizErr != nil {
+			return bizErr
+		}
+	} else if file.Deleted {
+		deleteFileRecord(ctx, meta.UserId, c.Param("id"))
+	}
+	adaptor.SetupResponseHeader(c, resp)
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(responseBody)
+	if err != nil {
+		return openai.ErrorWrapper(err, "write_response_body_failed", http.StatusInternalServerError)
+	}
+	return nil
+}
+
+// saveFile saves the file uploaded in place of the pending file reserved, it's deleted from the upstream if it can't
+// be saved, as nobody can reach it otherwise
+func saveFile(c *gin.Context, meta *meta.Meta, record *model.File, file *openai.FileObject) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	if file.Id == "" {
+		return openai.ErrorWrapper(errors.New("file id is missing in the response"), "invalid_file_response", http.StatusInternalServerError)
+	}
+	pendingFileId := record.FileId
+	record.FileId = file.Id
+	record.ChannelId = meta.ChannelId
+	record.KeyIndex = c.GetInt(ctxkey.ChannelKeyIndex)
+	record.Filename = file.Filename
+	record.Purpose = file.Purpose
+	record.Bytes = file.Bytes
+	record.CreatedAt = file.CreatedAt
+	if record.CreatedAt == 0 {
+		record.CreatedAt = helper.GetTimestamp()
+	}
+	err := model.SaveReservedFile(record)
+	if err == nil {
+		return nil
+	}
+	logger.Errorf(ctx, "failed to save file %s: %s", file.Id, err.Error())
+	if deleteErr := DeleteUpstreamFile(record); deleteErr != nil {
+		logger.Errorf(ctx, "failed to delete file %s from channel #%d: %s", file.Id, meta.ChannelId, deleteErr.Error())
+	}
+	record.FileId = pendingFileId
+	return openai.ErrorWrapper(err, "save_file_failed", http.StatusInternalServerError)
+}
+
+func deleteReservedFile(ctx context.Context, file *model.File) {
+	err := model.DeleteReservedFile(file)
+	if err != nil {
+		logger.Errorf(ctx, "failed to delete pending file %s: %s", file.FileId, err.Error())
+	}
+}
+
+func deleteFileRecord(ctx context.Context, userId int, fileId string) {
+	err := model.DeleteFile(userId, fileId)
+	if err != nil {
+		logger.Errorf(ctx, "failed to delete file %s: %s", fileId, err.Error())
+	}
+}
+
+// DeleteUpstreamFile deletes the file from the account it's uploaded to
+func DeleteUpstreamFile(file *model.File) error {
+	channel, err := model.GetChannelById(file.ChannelId, true)
+	if err != nil {
+		return err
+	}
+	cfg, _ := channel.LoadConfig()
+	deleteCtx, cancel := context.WithTimeout(context.Background(), fileDeleteTimeout)
+	defer cancel()
+	return openai.DeleteFile(deleteCtx, channel.GetBaseURL(), getChannelKey(channel, file.KeyIndex), cfg, file.FileId)
+}
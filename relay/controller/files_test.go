@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+func newUploadContext(t *testing.T, baseURL string) *gin.Context {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	_ = writer.WriteField("purpose", "fine-tune")
+	part, _ := writer.CreateFormFile("file", "train.jsonl")
+	_, _ = part.Write([]byte(`{"messages":[]}`))
+	_ = writer.Close()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/files", body)
+	c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+	c.Set(ctxkey.Id, 1)
+	c.Set(ctxkey.Channel, channeltype.OpenAI)
+	c.Set(ctxkey.ChannelId, 1)
+	c.Set(ctxkey.ChannelKeyIndex, -1)
+	c.Set(ctxkey.BaseURL, baseURL)
+	if err := common.SpoolRequestBody(c, 0); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestRelayFilesHelper(t *testing.T) {
+	Convey("RelayFilesHelper", t, func() {
+		useTestDB(t)
+		createTestToken(t, 1, 0, 0)
+		status := http.StatusOK
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			if status == http.StatusOK {
+				_, _ = w.Write([]byte(`{"id":"file-1","object":"file","bytes":15,"created_at":1,"filename":"train.jsonl","purpose":"fine-tune"}`))
+			} else {
+				_, _ = w.Write([]byte(`{"error":{"message":"upstream failed","type":"server_error"}}`))
+			}
+		}))
+		defer upstream.Close()
+		oldStorageQuota := config.UserFileStorageQuota
+		t.Cleanup(func() {
+			config.UserFileStorageQuota = oldStorageQuota
+		})
+
+		Convey("saves the file uploaded in place of the reservation", func() {
+			So(RelayFilesHelper(newUploadContext(t, upstream.URL)), ShouldBeNil)
+			file, err := model.GetFile(1, "file-1")
+			So(err, ShouldBeNil)
+			So(file.Bytes, ShouldEqual, 15)
+			files, err := model.GetUserFiles(1, "", "", 10, false)
+			So(err, ShouldBeNil)
+			So(files, ShouldHaveLength, 1)
+		})
+
+		Convey("removes the reservation if the upload fails", func() {
+			status = http.StatusInternalServerError
+			So(RelayFilesHelper(newUploadContext(t, upstream.URL)), ShouldNotBeNil)
+			var count int64
+			So(model.DB.Model(&model.File{}).Count(&count).Error, ShouldBeNil)
+			So(count, ShouldEqual, 0)
+		})
+
+		Convey("refuses the uploads over the storage quota", func() {
+			config.UserFileStorageQuota = 100
+			bizErr := RelayFilesHelper(newUploadContext(t, upstream.URL))
+			So(bizErr, ShouldNotBeNil)
+			So(bizErr.StatusCode, ShouldEqual, http.StatusForbidden)
+		})
+	})
+}
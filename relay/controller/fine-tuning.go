@@ -0,0 +1,317 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+const fineTuningJobFetchTimeout = 30 * time.Second
+
+// the most jobs listed at once, same as OpenAI
+const maxFineTuningJobListLimit = 100
+
+const defaultFineTuningJobListLimit = 20
+
+// the epochs of the jobs with n_epochs auto are estimated as 3, and the training files as 4 bytes a token
+const (
+	defaultFineTuningEpochs     = 3
+	fineTuningFileBytesPerToken = 4
+)
+
+func isFineTuningJobFinished(status string) bool {
+	for _, finalStatus := range model.FineTuningJobFinalStatuses {
+		if status == finalStatus {
+			return true
+		}
+	}
+	return false
+}
+
+// ListFineTuningJobsHelper lists the jobs created by the user from the database, as the list of the upstream is the
+// list of the whole account, and the jobs of the user can be in different channels
+func ListFineTuningJobsHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = defaultFineTuningJobListLimit
+	}
+	if limit > maxFineTuningJobListLimit {
+		limit = maxFineTuningJobListLimit
+	}
+	// one more is fetched to know if there are more
+	jobs, err := model.GetUserFineTuningJobs(c.GetInt(ctxkey.Id), c.Query("after"), limit+1)
+	if err != nil {
+		return openai.ErrorWrapper(err, "list_fine_tuning_jobs_failed", http.StatusInternalServerError)
+	}
+	list := openai.FineTuningJobList{Object: "list", Data: make([]json.RawMessage, 0, len(jobs))}
+	if len(jobs) > limit {
+		jobs = jobs[:limit]
+		list.HasMore = true
+	}
+	for _, job := range jobs {
+		if json.Valid([]byte(job.Snapshot)) {
+			list.Data = append(list.Data, json.RawMessage(job.Snapshot))
+		}
+	}
+	c.JSON(http.StatusOK, list)
+	return nil
+}
+
+// RelayFineTuningHelper relays the creations, the retrievals and the cancellations of the fine-tuning jobs to the
+// OpenAI compatible channels as they are. The jobs created are remembered, so that the later requests are sent to
+// the same account, and they're billed by the tokens trained once they're finished, see SettleFineTuningJob.
+func RelayFineTuningHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	if meta.APIType != apitype.OpenAI || meta.ChannelType == channeltype.Azure {
+		return openai.ErrorWrapper(errors.New("API not implemented by the channel"), "api_not_implemented", http.StatusNotImplemented)
+	}
+	isCreation := c.Request.Method == http.MethodPost && c.Param("id") == ""
+	var requestBody io.Reader
+	if c.Request.Method == http.MethodPost {
+		body, err := common.GetRequestBody(c)
+		if err != nil {
+			return openai.ErrorWrapper(err, "read_request_body_failed", http.StatusBadRequest)
+		}
+		if isCreation {
+			// the jobs are billed after they're finished, an estimate is pre-consumed and settled then
+			_, bizErr := getOrPreConsumeFixedQuota(c, getFineTuningJobPreConsumedQuota(body, meta), meta)
+			if bizErr != nil {
+				return bizErr
+			}
+		}
+		body, err = mapRequestBodyModel(body, meta)
+		if err != nil {
+			return openai.ErrorWrapper(err, "marshal_request_body_failed", http.StatusInternalServerError)
+		}
+		requestBody = bytes.NewReader(body)
+	}
+	fullRequestURL := openai.GetFullRequestURL(meta.BaseURL, meta.RequestURLPath, meta.ChannelType)
+	req, err := http.NewRequestWithContext(ctx, c.Request.Method, fullRequestURL, requestBody)
+	if err != nil {
+		return openai.ErrorWrapper(err, "new_request_failed", http.StatusInternalServerError)
+	}
+	a := &openai.Adaptor{}
+	a.Init(meta)
+	err = a.SetupRequestHeader(c, req, meta)
+	if err != nil {
+		return openai.ErrorWrapper(err, "setup_request_header_failed", http.StatusInternalServerError)
+	}
+	if requestBody == nil {
+		req.Header.Del("Content-Type")
+	}
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return RelayErrorHandler(resp)
+	}
+	// the quota pre-consumed is kept by the job once it's saved, it's returned if no job is created
+	defer ReturnPreConsumedQuota(c)
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	job := openai.FineTuningJob{}
+	if json.Unmarshal(responseBody, &job) == nil {
+		trackFineTuningJob(c, meta, &job, responseBody, isCreation)
+	}
+	adaptor.SetupResponseHeader(c, resp)
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(responseBody)
+	if err != nil {
+		return openai.ErrorWrapper(err, "write_response_body_failed", http.StatusInternalServerError)
+	}
+	return nil
+}
+
+// getFineTuningJobPreConsumedQuota estimates the tokens trained by the size of the training file and the epochs
+func getFineTuningJobPreConsumedQuota(requestBody []byte, meta *meta.Meta) int64 {
+	var request struct {
+		Model           string `json:"model"`
+		TrainingFile    string `json:"training_file"`
+		Hyperparameters struct {
+			NEpochs any `json:"n_epochs"`
+		} `json:"hyperparameters"`
+	}
+	_ = json.Unmarshal(requestBody, &request)
+	file, err := model.GetFile(meta.UserId, request.TrainingFile)
+	if err != nil {
+		// the upstream reports the missing file
+		return 0
+	}
+	epochs := float64(defaultFineTuningEpochs)
+	if nEpochs, ok := request.Hyperparameters.NEpochs.(float64); ok && nEpochs > 0 {
+		epochs = nEpochs
+	}
+	ratio := billingratio.GetTrainingRatio(request.Model) * billingratio.GetGroupRatio(meta.Group)
+	return int64(math.Ceil(float64(file.Bytes) / fineTuningFileBytesPerToken * epochs * ratio))
+}
+
+// trackFineTuningJob saves the job created, and keeps the status of the job up to date with the responses,
+// the job is settled at once if it's finished
+func trackFineTuningJob(c *gin.Context, meta *meta.Meta, job *openai.FineTuningJob, body []byte, isCreation bool) {
+	ctx := c.Request.Context()
+	if job.Object != "fine_tuning.job" || job.Id == "" {
+		return
+	}
+	if isCreation {
+		preConsumedQuota := c.GetInt64(ctxkey.PreConsumedQuota)
+		inserted, err := model.InsertFineTuningJob(&model.FineTuningJob{
+			JobId:            job.Id,
+			UserId:           meta.UserId,
+			TokenId:          meta.TokenId,
+			TokenName:        meta.TokenName,
+			ChannelId:        meta.ChannelId,
+			KeyIndex:         c.GetInt(ctxkey.ChannelKeyIndex),
+			Group:            meta.Group,
+			ModelName:        job.Model,
+			Status:           job.Status,
+			CreatedAt:        helper.GetTimestamp(),
+			Snapshot:         string(body),
+			PreConsumedQuota: preConsumedQuota,
+		})
+		if err != nil {
+			logger.Errorf(ctx, "failed to save fine-tuning job %s: %s", job.Id, err.Error())
+			return
+		}
+		if inserted && preConsumedQuota != 0 {
+			// it's settled with the job
+			c.Set(ctxkey.PreConsumedQuota, int64(0))
+		}
+	}
+	record, err := model.GetFineTuningJob(meta.UserId, job.Id)
+	if err != nil || isFineTuningJobFinished(record.Status) {
+		return
+	}
+	if !isFineTuningJobFinished(job.Status) {
+		record.Status = job.Status
+		record.Snapshot = string(body)
+		err = record.UpdateStatus()
+		if err != nil {
+			logger.Errorf(ctx, "failed to update fine-tuning job %s: %s", job.Id, err.Error())
+		}
+		return
+	}
+	channelName := c.GetString(ctxkey.ChannelName)
+	go func() {
+		err := finishFineTuningJob(ctx, record, job, body, channelName)
+		if err != nil {
+			// it's settled by the polling later
+			logger.Errorf(ctx, "failed to settle fine-tuning job %s: %s", record.JobId, err.Error())
+		}
+	}()
+}
+
+// SettleFineTuningJob bills a finished job by the tokens trained, the job is only updated if it's not finished yet
+func SettleFineTuningJob(ctx context.Context, job *model.FineTuningJob) error {
+	channel, err := model.GetChannelById(job.ChannelId, true)
+	if err != nil {
+		return err
+	}
+	cfg, _ := channel.LoadConfig()
+	fetchCtx, cancel := context.WithTimeout(context.Background(), fineTuningJobFetchTimeout)
+	defer cancel()
+	remoteJob, body, err := openai.GetFineTuningJob(fetchCtx, channel.GetBaseURL(), getChannelKey(channel, job.KeyIndex), cfg, job.JobId)
+	if err != nil {
+		return err
+	}
+	if !isFineTuningJobFinished(remoteJob.Status) {
+		job.Status = remoteJob.Status
+		job.Snapshot = string(body)
+		return job.UpdateStatus()
+	}
+	return finishFineTuningJob(ctx, job, remoteJob, body, channel.Name)
+}
+
+// finishFineTuningJob bills the tokens trained of the job, the failed and the cancelled jobs are billed
+// as well if the upstream reports the tokens trained
+func finishFineTuningJob(ctx context.Context, job *model.FineTuningJob, remoteJob *openai.FineTuningJob, body []byte, channelName string) error {
+	if remoteJob.Model != "" {
+		job.ModelName = remoteJob.Model
+	}
+	trainedTokens := 0
+	if remoteJob.TrainedTokens != nil {
+		trainedTokens = *remoteJob.TrainedTokens
+	}
+	trainingRatio := billingratio.GetTrainingRatio(job.ModelName)
+	groupRatio := billingratio.GetGroupRatio(job.Group)
+	ratio := trainingRatio * groupRatio
+	quota := int64(math.Ceil(float64(trainedTokens) * ratio))
+	if ratio != 0 && quota <= 0 && trainedTokens > 0 {
+		quota = 1
+	}
+	job.Status = remoteJob.Status
+	job.FinishTime = helper.GetTimestamp()
+	job.TrainedTokens = trainedTokens
+	job.Quota = quota
+	job.Snapshot = string(body)
+	finished, err := job.Finish()
+	if err != nil || !finished {
+		return err
+	}
+	settleFineTuningJobQuota(ctx, job)
+	if quota == 0 {
+		return nil
+	}
+	logContent := fmt.Sprintf("训练倍率 %.2f，分组倍率 %.2f，训练 %d tokens，微调任务 %s", trainingRatio, groupRatio, trainedTokens, job.JobId)
+	model.RecordConsumeLog(ctx, job.UserId, job.ChannelId, trainedTokens, 0, job.ModelName, job.TokenName, job.TokenId, quota, logContent, channelName)
+	model.UpdateUserUsedQuotaAndRequestCount(job.UserId, quota)
+	model.UpdateChannelUsedQuota(job.ChannelId, quota)
+	monitor.RecordSpend(quota)
+	return nil
+}
+
+// settleFineTuningJobQuota consumes the difference between the quota of a finished job and what was pre-consumed
+func settleFineTuningJobQuota(ctx context.Context, job *model.FineTuningJob) {
+	quotaDelta := job.Quota - job.PreConsumedQuota
+	if quotaDelta == 0 {
+		return
+	}
+	err := model.PostConsumeTokenQuota(job.TokenId, quotaDelta)
+	if err != nil {
+		logger.Error(ctx, "error consuming token remain quota: "+err.Error())
+	}
+	err = model.CacheUpdateUserQuota(ctx, job.UserId)
+	if err != nil {
+		logger.Error(ctx, "error update user quota cache: "+err.Error())
+	}
+}
+
+// ExpireFineTuningJob gives up a job which can't be fetched, the quota pre-consumed is returned
+func ExpireFineTuningJob(ctx context.Context, job *model.FineTuningJob) error {
+	job.Status = "failed"
+	job.FinishTime = helper.GetTimestamp()
+	job.Quota = 0
+	finished, err := job.Finish()
+	if err != nil || !finished {
+		return err
+	}
+	settleFineTuningJobQuota(ctx, job)
+	return nil
+}
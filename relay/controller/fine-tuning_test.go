@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/model"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+)
+
+func TestGetFineTuningJobPreConsumedQuota(t *testing.T) {
+	Convey("getFineTuningJobPreConsumedQuota", t, func() {
+		useTestDB(t)
+		So(model.InsertFile(&model.File{FileId: "file-train", UserId: 1, Bytes: 4000}), ShouldBeNil)
+		userMeta := &meta.Meta{UserId: 1, Group: "default"}
+		ratio := billingratio.GetTrainingRatio("davinci-002")
+
+		// 1000 tokens of the file, 3 epochs by default
+		So(getFineTuningJobPreConsumedQuota([]byte(`{"model":"davinci-002","training_file":"file-train"}`), userMeta), ShouldEqual, int64(math.Ceil(3000*ratio)))
+		So(getFineTuningJobPreConsumedQuota([]byte(`{"model":"davinci-002","training_file":"file-train","hyperparameters":{"n_epochs":5}}`), userMeta), ShouldEqual, int64(math.Ceil(5000*ratio)))
+		So(getFineTuningJobPreConsumedQuota([]byte(`{"model":"davinci-002","training_file":"file-train","hyperparameters":{"n_epochs":"auto"}}`), userMeta), ShouldEqual, int64(math.Ceil(3000*ratio)))
+		// the files of other users are not estimated
+		So(getFineTuningJobPreConsumedQuota([]byte(`{"model":"davinci-002","training_file":"file-train"}`), &meta.Meta{UserId: 2}), ShouldEqual, 0)
+	})
+}
+
+func TestSettleFineTuningJob(t *testing.T) {
+	Convey("SettleFineTuningJob", t, func() {
+		useTestDB(t)
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/v1/fine_tuning/jobs/ftjob-1" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"id":"ftjob-1","object":"fine_tuning.job","model":"davinci-002","status":"succeeded","trained_tokens":10000}`))
+		}))
+		defer upstream.Close()
+		baseURL := upstream.URL
+		So(model.DB.Create(&model.Channel{Id: 1, Type: channeltype.OpenAI, Key: "sk-test", BaseURL: &baseURL, Name: "openai"}).Error, ShouldBeNil)
+		token := createTestToken(t, 1, 1000000, 1000000)
+		So(model.PreConsumeTokenQuota(token.Id, 3000), ShouldBeNil)
+		job := &model.FineTuningJob{JobId: "ftjob-1", UserId: 1, TokenId: token.Id, ChannelId: 1, KeyIndex: -1, Group: "default",
+			Status: "running", PreConsumedQuota: 3000}
+		inserted, err := model.InsertFineTuningJob(job)
+		So(err, ShouldBeNil)
+		So(inserted, ShouldBeTrue)
+
+		Convey("bills the tokens trained once, with the quota pre-consumed", func() {
+			So(SettleFineTuningJob(context.Background(), job), ShouldBeNil)
+			quota := int64(math.Ceil(10000 * billingratio.GetTrainingRatio("davinci-002")))
+			userQuota, remainQuota := getTestBalances(t, token)
+			So(userQuota, ShouldEqual, 1000000-quota)
+			So(remainQuota, ShouldEqual, 1000000-quota)
+
+			settled, err := model.GetFineTuningJob(1, "ftjob-1")
+			So(err, ShouldBeNil)
+			So(settled.Status, ShouldEqual, "succeeded")
+			So(settled.Quota, ShouldEqual, quota)
+			So(SettleFineTuningJob(context.Background(), settled), ShouldBeNil)
+			userQuota, _ = getTestBalances(t, token)
+			So(userQuota, ShouldEqual, 1000000-quota)
+		})
+
+		Convey("returns the quota pre-consumed of the expired jobs", func() {
+			So(ExpireFineTuningJob(context.Background(), job), ShouldBeNil)
+			userQuota, remainQuota := getTestBalances(t, token)
+			So(userQuota, ShouldEqual, 1000000)
+			So(remainQuota, ShouldEqual, 1000000)
+		})
+	})
+}
@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// RelayGetHelper relays a GET request without a body to the channel as it is, e.g. the retrieval of a fine-tuned model,
+// nothing is billed but the request is logged
+func RelayGetHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	// the others take the paths of their own
+	if meta.APIType != apitype.OpenAI || meta.ChannelType == channeltype.Azure {
+		return openai.ErrorWrapper(errors.New("API not implemented by the channel"), "api_not_implemented", http.StatusNotImplemented)
+	}
+	requestURLPath := meta.RequestURLPath
+	if modelName := c.Param("model"); modelName != "" && meta.ModelMapping[modelName] != "" {
+		// only /v1/models/:model takes the model in the path
+		requestURLPath = "/v1/models/" + url.PathEscape(meta.ModelMapping[modelName])
+	}
+	fullRequestURL := openai.GetFullRequestURL(meta.BaseURL, requestURLPath, meta.ChannelType)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fullRequestURL, nil)
+	if err != nil {
+		return openai.ErrorWrapper(err, "new_request_failed", http.StatusInternalServerError)
+	}
+	a := &openai.Adaptor{}
+	a.Init(meta)
+	err = a.SetupRequestHeader(c, req, meta)
+	if err != nil {
+		return openai.ErrorWrapper(err, "setup_request_header_failed", http.StatusInternalServerError)
+	}
+	req.Header.Del("Content-Type")
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return RelayErrorHandler(resp)
+	}
+	adaptor.SetupResponseHeader(c, resp)
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = io.Copy(c.Writer, resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "copy_response_body_failed", http.StatusInternalServerError)
+	}
+	logContent := fmt.Sprintf("GET %s，不计费", c.Request.URL.Path)
+	model.RecordConsumeLog(ctx, meta.UserId, meta.ChannelId, 0, 0, meta.OriginModelName, meta.TokenName, meta.TokenId, 0, logContent, c.GetString(ctxkey.ChannelName))
+	return nil
+}
@@ -7,14 +7,18 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/billing"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/controller/validator"
 	"github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/modelinfo"
 	"github.com/songquanpeng/one-api/relay/relaymode"
 	"math"
 	"net/http"
@@ -43,7 +47,13 @@ func getAndValidateTextRequest(c *gin.Context, relayMode int) (*relaymodel.Gener
 func getPromptTokens(textRequest *relaymodel.GeneralOpenAIRequest, relayMode int) int {
 	switch relayMode {
 	case relaymode.ChatCompletions:
-		return openai.CountTokenMessages(textRequest.Messages, textRequest.Model)
+		tokenNum := openai.CountTokenMessages(textRequest.Messages, textRequest.Model)
+		// the legacy function_call forces a function the same way as tool_choice
+		toolChoice := textRequest.ToolChoice
+		if toolChoice == nil {
+			toolChoice = textRequest.FunctionCall
+		}
+		return tokenNum + openai.CountTokenTools(textRequest.Tools, textRequest.Functions, toolChoice, textRequest.Model)
 	case relaymode.Completions:
 		return openai.CountTokenInput(textRequest.Prompt, textRequest.Model)
 	case relaymode.Moderations:
@@ -52,7 +62,132 @@ func getPromptTokens(textRequest *relaymodel.GeneralOpenAIRequest, relayMode int
 	return 0
 }
 
+// validateContextWindow rejects requests which can't fit into the context window of the model,
+// so that we don't pay a round trip to upstream for an error we already know about
+func validateContextWindow(textRequest *relaymodel.GeneralOpenAIRequest, promptTokens int, meta *meta.Meta) *relaymodel.ErrorWithStatusCode {
+	if !config.ContextWindowCheckEnabled {
+		return nil
+	}
+	if meta.Mode != relaymode.ChatCompletions && meta.Mode != relaymode.Completions {
+		return nil
+	}
+	contextWindow := modelinfo.GetContextWindow(textRequest.Model)
+	if contextWindow == 0 || promptTokens+textRequest.MaxTokens <= contextWindow {
+		return nil
+	}
+	message := fmt.Sprintf("This model's maximum context length is %d tokens. However, your messages resulted in %d tokens. Please reduce the length of the messages.", contextWindow, promptTokens)
+	if textRequest.MaxTokens != 0 {
+		message = fmt.Sprintf("This model's maximum context length is %d tokens. However, you requested %d tokens (%d in the messages, %d in the completion). Please reduce the length of the messages or completion.",
+			contextWindow, promptTokens+textRequest.MaxTokens, promptTokens, textRequest.MaxTokens)
+	}
+	param := "messages"
+	if meta.Mode == relaymode.Completions {
+		param = "prompt"
+	}
+	return &relaymodel.ErrorWithStatusCode{
+		Error: relaymodel.Error{
+			Message: message,
+			Type:    "invalid_request_error",
+			Param:   param,
+			Code:    "context_length_exceeded",
+		},
+		StatusCode: http.StatusBadRequest,
+	}
+}
+
+// validateModelCapabilities rejects requests using features the model doesn't support,
+// upstreams tend to ignore such fields silently instead of returning an error
+func validateModelCapabilities(textRequest *relaymodel.GeneralOpenAIRequest, hasImage bool, meta *meta.Meta) *relaymodel.ErrorWithStatusCode {
+	if !config.ModelCapabilityCheckEnabled || meta.Mode != relaymode.ChatCompletions {
+		return nil
+	}
+	capability, ok := modelinfo.GetCapability(textRequest.Model)
+	if !ok {
+		return nil
+	}
+	var feature, param string
+	switch {
+	case (len(textRequest.Tools) > 0 || textRequest.Functions != nil) && !capability.Tools:
+		feature, param = "tools", "tools"
+		if len(textRequest.Tools) == 0 {
+			feature, param = "function calling", "functions"
+		}
+	case hasImage && !capability.Vision:
+		feature, param = "image inputs", "messages"
+	case textRequest.ResponseFormat != nil && textRequest.ResponseFormat.Type == "json_object" && !capability.JSONMode:
+		feature, param = "'response_format' of type 'json_object'", "response_format"
+	case textRequest.ResponseFormat != nil && textRequest.ResponseFormat.Type == "json_schema" && !capability.JSONSchema:
+		feature, param = "'response_format' of type 'json_schema'", "response_format"
+	default:
+		return nil
+	}
+	return &relaymodel.ErrorWithStatusCode{
+		Error: relaymodel.Error{
+			Message: fmt.Sprintf("The model %s does not support %s.", meta.OriginModelName, feature),
+			Type:    "invalid_request_error",
+			Param:   param,
+			Code:    "unsupported_capability",
+		},
+		StatusCode: http.StatusBadRequest,
+	}
+}
+
+func hasImageContent(messages []relaymodel.Message) bool {
+	for _, message := range messages {
+		if _, ok := message.Content.(string); ok {
+			continue
+		}
+		for _, content := range message.ParseContent() {
+			if content.Type == relaymodel.ContentTypeImageURL {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stripReasoningContent removes the reasoning of the previous turns, which clients may send back as it was
+// received, but deepseek rejects. It returns true if any is removed.
+func stripReasoningContent(messages []relaymodel.Message) bool {
+	stripped := false
+	for i := range messages {
+		if messages[i].ReasoningContent != "" {
+			messages[i].ReasoningContent = ""
+			stripped = true
+		}
+	}
+	return stripped
+}
+
+// ChannelRateLimitedCode is the error of a request rejected by the caps of the channel, not by upstream
+const ChannelRateLimitedCode = "channel_rate_limited"
+
+// reserveChannelThroughput rejects the request with 429 if the channel has used up its requests or tokens
+// per minute, the request is then retried on another channel
+func reserveChannelThroughput(meta *meta.Meta, promptTokens int) *relaymodel.ErrorWithStatusCode {
+	if model.ReserveChannelThroughput(meta.ChannelId, meta.Config.RPM, meta.Config.TPM, promptTokens) {
+		return nil
+	}
+	return &relaymodel.ErrorWithStatusCode{
+		Error: relaymodel.Error{
+			Message: "The channel has reached its requests or tokens per minute limit.",
+			Type:    "one_api_error",
+			Code:    ChannelRateLimitedCode,
+		},
+		StatusCode: http.StatusTooManyRequests,
+	}
+}
+
+// getPreConsumedQuota reserves the prompt and the completion usually seen for the model, never more than max_tokens,
+// the static PreConsumedQuota is only a fallback for the models without enough completions seen
 func getPreConsumedQuota(textRequest *relaymodel.GeneralOpenAIRequest, promptTokens int, ratio float64) int64 {
+	if completionTokens, ok := monitor.EstimateCompletionTokens(textRequest.Model); ok {
+		if textRequest.MaxTokens != 0 && completionTokens > textRequest.MaxTokens {
+			completionTokens = textRequest.MaxTokens
+		}
+		completionRatio := billingratio.GetCompletionRatio(textRequest.Model)
+		return int64(math.Ceil((float64(promptTokens) + float64(completionTokens)*completionRatio) * ratio))
+	}
 	preConsumedTokens := config.PreConsumedQuota + int64(promptTokens)
 	if textRequest.MaxTokens != 0 {
 		preConsumedTokens += int64(textRequest.MaxTokens)
@@ -60,9 +195,8 @@ func getPreConsumedQuota(textRequest *relaymodel.GeneralOpenAIRequest, promptTok
 	return int64(float64(preConsumedTokens) * ratio)
 }
 
-func preConsumeQuota(ctx context.Context, textRequest *relaymodel.GeneralOpenAIRequest, promptTokens int, ratio float64, meta *meta.Meta) (int64, *relaymodel.ErrorWithStatusCode) {
-	preConsumedQuota := getPreConsumedQuota(textRequest, promptTokens, ratio)
-
+// preConsumeQuota reserves the quota from the user and the token, nothing is reserved for the users with plenty of quota
+func preConsumeQuota(ctx context.Context, preConsumedQuota int64, meta *meta.Meta) (int64, *relaymodel.ErrorWithStatusCode) {
 	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
 	if err != nil {
 		return preConsumedQuota, openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
@@ -89,6 +223,35 @@ func preConsumeQuota(ctx context.Context, textRequest *relaymodel.GeneralOpenAIR
 	return preConsumedQuota, nil
 }
 
+// getOrPreConsumeQuota pre-consumes only once per request: a retry on another channel reuses what the first attempt
+// pre-consumed, postConsumeQuota settles the difference with the ratio of the channel which served the request
+func getOrPreConsumeQuota(c *gin.Context, textRequest *relaymodel.GeneralOpenAIRequest, promptTokens int, ratio float64, meta *meta.Meta) (int64, *relaymodel.ErrorWithStatusCode) {
+	return getOrPreConsumeFixedQuota(c, getPreConsumedQuota(textRequest, promptTokens, ratio), meta)
+}
+
+// getOrPreConsumeFixedQuota is getOrPreConsumeQuota for the requests whose price is known beforehand, e.g. the images
+func getOrPreConsumeFixedQuota(c *gin.Context, quota int64, meta *meta.Meta) (int64, *relaymodel.ErrorWithStatusCode) {
+	if preConsumedQuota, ok := c.Get(ctxkey.PreConsumedQuota); ok {
+		return preConsumedQuota.(int64), nil
+	}
+	preConsumedQuota, bizErr := preConsumeQuota(c.Request.Context(), quota, meta)
+	if bizErr != nil {
+		return preConsumedQuota, bizErr
+	}
+	c.Set(ctxkey.PreConsumedQuota, preConsumedQuota)
+	return preConsumedQuota, nil
+}
+
+// ReturnPreConsumedQuota must be called once every attempt of the request failed
+func ReturnPreConsumedQuota(c *gin.Context) {
+	quota, ok := c.Get(ctxkey.PreConsumedQuota)
+	if !ok {
+		return
+	}
+	c.Set(ctxkey.PreConsumedQuota, int64(0))
+	billing.ReturnPreConsumedQuota(c.Request.Context(), quota.(int64), c.GetInt(ctxkey.TokenId))
+}
+
 func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.Meta, textRequest *relaymodel.GeneralOpenAIRequest, ratio float64, preConsumedQuota int64, modelRatio float64, groupRatio float64, channelName string) {
 	if usage == nil {
 		logger.Error(ctx, "usage is nil, which is unexpected")
@@ -98,7 +261,29 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 	completionRatio := billingratio.GetCompletionRatio(textRequest.Model)
 	promptTokens := usage.PromptTokens
 	completionTokens := usage.CompletionTokens
-	quota = int64(math.Ceil((float64(promptTokens) + float64(completionTokens)*completionRatio) * ratio))
+	monitor.RecordRealtimeTokens(promptTokens + completionTokens)
+	if meta.Config.TPM > 0 {
+		// the prompt tokens estimated are counted already
+		model.RecordChannelThroughputTokens(meta.ChannelId, promptTokens+completionTokens-meta.PromptTokens)
+	}
+	// the cached prompt tokens are billed with the discount of the cache
+	cachedTokens := usage.CachedTokens()
+	cachedInputRatio := billingratio.GetCachedInputRatio(textRequest.Model)
+	quota = int64(math.Ceil((float64(promptTokens-cachedTokens) + float64(cachedTokens)*cachedInputRatio + float64(completionTokens)*completionRatio) * ratio))
+	var storageQuota int64
+	if usage.CacheStorage != nil {
+		storageRatio := billingratio.GetCacheStorageRatio(textRequest.Model)
+		storageQuota = int64(math.Ceil(float64(usage.CacheStorage.Tokens) * usage.CacheStorage.Hours * storageRatio * groupRatio))
+		quota += storageQuota
+	}
+	if usage.OutputImages > 0 {
+		imagePrice := billingratio.GetChatImagePrice(textRequest.Model)
+		quota += int64(math.Ceil(float64(usage.OutputImages) * imagePrice * config.QuotaPerUnit * groupRatio))
+	}
+	if usage.Cost > 0 {
+		// the upstream knows the price better than the ratios, e.g. OpenRouter routing to several providers
+		quota = int64(math.Ceil(usage.Cost * config.QuotaPerUnit * groupRatio))
+	}
 	if ratio != 0 && quota <= 0 {
 		quota = 1
 	}
@@ -108,6 +293,9 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 		// we cannot just return, because we may have to return the pre-consumed quota
 		quota = 0
 	}
+	if totalTokens > 0 {
+		monitor.RecordCompletionTokens(textRequest.Model, completionTokens)
+	}
 	quotaDelta := quota - preConsumedQuota
 	err := model.PostConsumeTokenQuota(meta.TokenId, quotaDelta)
 	if err != nil {
@@ -118,9 +306,20 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 		logger.Error(ctx, "error update user quota cache: "+err.Error())
 	}
 	logContent := fmt.Sprintf("模型倍率 %.2f，分组倍率 %.2f，补全倍率 %.2f", modelRatio, groupRatio, completionRatio)
-	model.RecordConsumeLog(ctx, meta.UserId, meta.ChannelId, promptTokens, completionTokens, textRequest.Model, meta.TokenName, quota, logContent, channelName)
+	if cachedTokens > 0 {
+		logContent += fmt.Sprintf("，缓存命中 %d tokens", cachedTokens)
+	}
+	if storageQuota > 0 {
+		logContent += fmt.Sprintf("，上下文缓存 %d tokens 存储 %.2f 小时", usage.CacheStorage.Tokens, usage.CacheStorage.Hours)
+	}
+	if usage.OutputImages > 0 {
+		logContent += fmt.Sprintf("，生成图片 %d 张", usage.OutputImages)
+	}
+	model.RecordConsumeLog(ctx, meta.UserId, meta.ChannelId, promptTokens, completionTokens, textRequest.Model, meta.TokenName, meta.TokenId, quota, logContent, channelName)
 	model.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
 	model.UpdateChannelUsedQuota(meta.ChannelId, quota)
+	monitor.RecordSpend(quota)
+	notifyCompletion(ctx, meta, textRequest.Model, promptTokens, completionTokens, quota)
 }
 
 func getMappedModelName(modelName string, mapping map[string]string) (string, bool) {
@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+func TestGetPromptTokensTools(t *testing.T) {
+	Convey("the tool definitions are a part of the prompt", t, func() {
+		// the token encoders aren't loaded in the tests
+		oldApproximateTokenEnabled := config.ApproximateTokenEnabled
+		config.ApproximateTokenEnabled = true
+		t.Cleanup(func() {
+			config.ApproximateTokenEnabled = oldApproximateTokenEnabled
+		})
+		var textRequest relaymodel.GeneralOpenAIRequest
+		So(json.Unmarshal([]byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"weather?"}],
+			"functions":[{"name":"get_weather","parameters":{"type":"object","properties":{"city":{"type":"string"}}}}],
+			"function_call":{"name":"get_weather"}}`), &textRequest), ShouldBeNil)
+		messages := openai.CountTokenMessages(textRequest.Messages, "gpt-4o")
+
+		// the legacy function_call is counted as the tool choice
+		So(getPromptTokens(&textRequest, relaymode.ChatCompletions), ShouldEqual,
+			messages+openai.CountTokenTools(nil, textRequest.Functions, textRequest.FunctionCall, "gpt-4o"))
+		So(getPromptTokens(&textRequest, relaymode.ChatCompletions), ShouldBeGreaterThan,
+			messages+openai.CountTokenTools(nil, textRequest.Functions, nil, "gpt-4o"))
+
+		textRequest.Functions, textRequest.FunctionCall = nil, nil
+		So(getPromptTokens(&textRequest, relaymode.ChatCompletions), ShouldEqual, messages)
+	})
+}
+
+func TestRelayTextHelperRetryBilling(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("a request retried on another channel is billed once", t, func() {
+		useTestDB(t)
+		// the token encoders aren't loaded in the tests
+		oldApproximateTokenEnabled := config.ApproximateTokenEnabled
+		config.ApproximateTokenEnabled = true
+		t.Cleanup(func() {
+			config.ApproximateTokenEnabled = oldApproximateTokenEnabled
+		})
+		// little enough quota for the request to be pre-consumed
+		token := createTestToken(t, 1, 10000, 10000)
+		So(model.DB.Create(&model.Channel{Id: 1, Type: channeltype.OpenAI, Key: "sk-failing", Name: "failing"}).Error, ShouldBeNil)
+		So(model.DB.Create(&model.Channel{Id: 2, Type: channeltype.OpenAI, Key: "sk-working", Name: "working"}).Error, ShouldBeNil)
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"error":{"message":"upstream failed","type":"server_error"}}`))
+		}))
+		defer failing.Close()
+		var upstreamModel string
+		working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var request struct {
+				Model string `json:"model"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&request)
+			upstreamModel = request.Model
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","created":1700000000,"model":"gpt-4",
+				"choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}],
+				"usage":{"prompt_tokens":10,"completion_tokens":20,"total_tokens":30}}`))
+		}))
+		defer working.Close()
+
+		c, _ := newRelayTestContext(t, "/v1/chat/completions", `{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":"hi"}]}`, token, failing.URL)
+		useChannel := func(id int, baseURL string, mapping map[string]string) {
+			c.Set(ctxkey.ChannelId, id)
+			c.Set(ctxkey.BaseURL, baseURL)
+			c.Set(ctxkey.ModelMapping, mapping)
+			So(common.RewindRequestBody(c), ShouldBeNil)
+		}
+		waitBalances := func(quota int64) {
+			userQuota, remainQuota := getTestBalances(t, token)
+			for i := 0; i < 50 && (userQuota != quota || remainQuota != quota); i++ {
+				time.Sleep(20 * time.Millisecond)
+				userQuota, remainQuota = getTestBalances(t, token)
+			}
+			So(userQuota, ShouldEqual, quota)
+			So(remainQuota, ShouldEqual, quota)
+		}
+
+		useChannel(1, failing.URL, nil)
+		So(RelayTextHelper(c), ShouldNotBeNil)
+		preConsumedQuota := c.GetInt64(ctxkey.PreConsumedQuota)
+		So(preConsumedQuota, ShouldBeGreaterThan, 0)
+		waitBalances(10000 - preConsumedQuota)
+
+		Convey("the retry settles the quota with the ratio of its channel", func() {
+			// the retry maps the model to a pricier one
+			useChannel(2, working.URL, map[string]string{"gpt-3.5-turbo": "gpt-4"})
+			So(RelayTextHelper(c), ShouldBeNil)
+			So(upstreamModel, ShouldEqual, "gpt-4")
+			// nothing more is pre-consumed for the retry
+			So(c.GetInt64(ctxkey.PreConsumedQuota), ShouldEqual, preConsumedQuota)
+
+			quota := int64(math.Ceil((10 + 20*billingratio.GetCompletionRatio("gpt-4")) * billingratio.GetModelRatio("gpt-4")))
+			So(waitChannelUsedQuota(t, 2), ShouldEqual, quota)
+			failed := model.Channel{}
+			So(model.DB.First(&failed, 1).Error, ShouldBeNil)
+			So(failed.UsedQuota, ShouldEqual, 0)
+			waitBalances(10000 - quota)
+			var logs int64
+			So(model.LOG_DB.Model(&model.Log{}).Where("type = ?", model.LogTypeConsume).Count(&logs).Error, ShouldBeNil)
+			So(logs, ShouldEqual, 1)
+			var preConsumed int64
+			So(model.DB.Model(&model.QuotaLedger{}).Where("type = ?", model.LedgerTypePreConsume).Count(&preConsumed).Error, ShouldBeNil)
+			So(preConsumed, ShouldEqual, 1)
+		})
+
+		Convey("the quota is returned once if every attempt failed", func() {
+			useChannel(2, failing.URL, map[string]string{"gpt-3.5-turbo": "gpt-4"})
+			So(RelayTextHelper(c), ShouldNotBeNil)
+			So(c.GetInt64(ctxkey.PreConsumedQuota), ShouldEqual, preConsumedQuota)
+			ReturnPreConsumedQuota(c)
+			ReturnPreConsumedQuota(c)
+			waitBalances(10000)
+			time.Sleep(100 * time.Millisecond)
+			waitBalances(10000)
+		})
+	})
+}
@@ -0,0 +1,192 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// https://platform.openai.com/docs/api-reference/images/createEdit
+// https://platform.openai.com/docs/api-reference/images/createVariation
+
+// getImageEditRequest reads the fields of the multipart request, the images are left in the spooled body
+func getImageEditRequest(c *gin.Context) (*relaymodel.ImageRequest, error) {
+	fields, err := common.PeekMultipartFields(c)
+	if err != nil {
+		return nil, err
+	}
+	imageRequest := &relaymodel.ImageRequest{
+		Model:  fields["model"],
+		Prompt: fields["prompt"],
+		Size:   fields["size"],
+		N:      1,
+	}
+	if fields["n"] != "" {
+		imageRequest.N, err = strconv.Atoi(fields["n"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of n: %s", fields["n"])
+		}
+	}
+	if imageRequest.Size == "" {
+		imageRequest.Size = "1024x1024"
+	}
+	if imageRequest.Model == "" {
+		imageRequest.Model = "dall-e-2"
+	}
+	return imageRequest, nil
+}
+
+func validateImageEditRequest(imageRequest *relaymodel.ImageRequest, relayMode int) *relaymodel.ErrorWithStatusCode {
+	if relayMode == relaymode.ImagesEdits {
+		if imageRequest.Prompt == "" {
+			return openai.ErrorWrapper(errors.New("prompt is required"), "prompt_missing", http.StatusBadRequest)
+		}
+		if !isValidImagePromptLength(imageRequest.Model, len(imageRequest.Prompt)) {
+			return openai.ErrorWrapper(errors.New("prompt is too long"), "prompt_too_long", http.StatusBadRequest)
+		}
+	}
+	if !isValidImageSize(imageRequest.Model, imageRequest.Size) {
+		return openai.ErrorWrapper(errors.New("size not supported for this image model"), "size_not_supported", http.StatusBadRequest)
+	}
+	if imageRequest.N < 1 || !isWithinRange(imageRequest.Model, imageRequest.N) {
+		return openai.ErrorWrapper(errors.New("invalid value of n"), "n_not_within_range", http.StatusBadRequest)
+	}
+	return nil
+}
+
+// rewriteMultipartModel streams the spooled body with the model field replaced, the boundary is kept,
+// so that the Content-Type of the client request still applies
+func rewriteMultipartModel(c *gin.Context, modelName string) (io.Reader, error) {
+	_, params, err := mime.ParseMediaType(c.Request.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	reader := multipart.NewReader(common.GetSpooledRequestBody(c), params["boundary"])
+	pipeReader, pipeWriter := io.Pipe()
+	writer := multipart.NewWriter(pipeWriter)
+	err = writer.SetBoundary(params["boundary"])
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		pipeWriter.CloseWithError(copyMultipartParts(reader, writer, modelName))
+	}()
+	return pipeReader, nil
+}
+
+func copyMultipartParts(reader *multipart.Reader, writer *multipart.Writer, modelName string) error {
+	hasModel := false
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			if !hasModel {
+				// the model was defaulted
+				err = writer.WriteField("model", modelName)
+				if err != nil {
+					return err
+				}
+			}
+			return writer.Close()
+		}
+		if err != nil {
+			return err
+		}
+		partWriter, err := writer.CreatePart(part.Header)
+		if err != nil {
+			return err
+		}
+		if part.FormName() == "model" && part.FileName() == "" {
+			hasModel = true
+			_, err = io.WriteString(partWriter, modelName)
+		} else {
+			_, err = io.Copy(partWriter, part)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// RelayImageEditHelper relays the edits and variations of images, they're billed per generated image like the generations
+func RelayImageEditHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	if common.GetSpooledRequestBody(c) == nil {
+		return openai.ErrorWrapper(errors.New("multipart/form-data request is required"), "invalid_image_request", http.StatusBadRequest)
+	}
+	imageRequest, err := getImageEditRequest(c)
+	if err != nil {
+		logger.Errorf(ctx, "getImageEditRequest failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "invalid_image_request", http.StatusBadRequest)
+	}
+
+	// map model name
+	meta.OriginModelName = imageRequest.Model
+	imageRequest.Model, _ = getMappedModelName(imageRequest.Model, meta.ModelMapping)
+	meta.ActualModelName = imageRequest.Model
+
+	bizErr := validateImageEditRequest(imageRequest, meta.Mode)
+	if bizErr != nil {
+		return bizErr
+	}
+	imageModel := imageRequest.Model
+	upstreamModel, _ := getMappedModelName(imageRequest.Model, billingratio.ImageOriginModelName)
+
+	var requestBody io.Reader
+	if upstreamModel != meta.OriginModelName {
+		requestBody, err = rewriteMultipartModel(c, upstreamModel)
+		if err != nil {
+			return openai.ErrorWrapper(err, "rewrite_image_request_failed", http.StatusInternalServerError)
+		}
+	} else {
+		requestBody = common.GetSpooledRequestBody(c)
+	}
+
+	adaptor := relay.GetAdaptor(meta.APIType)
+	if adaptor == nil {
+		return openai.ErrorWrapper(fmt.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptor.Init(meta)
+
+	modelRatio := billingratio.GetModelRatio(imageModel)
+	groupRatio := billingratio.GetGroupRatio(meta.Group)
+	ratio := modelRatio * groupRatio
+	quota := int64(ratio*getImageSizeRatio(imageModel, imageRequest.Size)*1000) * int64(imageRequest.N)
+	preConsumedQuota, bizErr := getOrPreConsumeFixedQuota(c, quota, meta)
+	if bizErr != nil {
+		logger.Warnf(ctx, "preConsumeQuota failed: %+v", *bizErr)
+		return bizErr
+	}
+
+	resp, err := adaptor.DoRequest(c, meta, requestBody)
+	if err != nil {
+		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if isErrorHappened(meta, resp) {
+		return RelayErrorHandler(resp)
+	}
+
+	_, respErr := adaptor.DoResponse(c, resp, meta)
+	if respErr != nil {
+		logger.Errorf(ctx, "respErr is not nil: %+v", respErr)
+		return respErr
+	}
+	go postConsumeImageQuota(ctx, meta, imageModel, quota, preConsumedQuota, modelRatio, groupRatio, c.GetString(ctxkey.ChannelName))
+	return nil
+}
@@ -11,8 +11,10 @@ import (
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor"
 	"github.com/songquanpeng/one-api/relay"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/meta"
@@ -52,6 +54,19 @@ func isValidImagePromptLength(model string, promptLength int) bool {
 	return !ok || promptLength <= maxPromptLength
 }
 
+func isValidImageQuality(model string, quality string) bool {
+	qualities, ok := billingratio.ImageQualities[model]
+	if !ok || quality == "" {
+		return true
+	}
+	for _, q := range qualities {
+		if q == quality {
+			return true
+		}
+	}
+	return false
+}
+
 func isWithinRange(element string, value int) bool {
 	amounts, ok := billingratio.ImageGenerationAmounts[element]
 	return !ok || (value >= amounts[0] && value <= amounts[1])
@@ -79,8 +94,12 @@ func validateImageRequest(imageRequest *relaymodel.ImageRequest, meta *meta.Meta
 		return openai.ErrorWrapper(errors.New("prompt is too long"), "prompt_too_long", http.StatusBadRequest)
 	}
 
+	if !isValidImageQuality(imageRequest.Model, imageRequest.Quality) {
+		return openai.ErrorWrapper(errors.New("quality not supported for this image model"), "quality_not_supported", http.StatusBadRequest)
+	}
+
 	// Number of generated images validation
-	if !isWithinRange(imageRequest.Model, imageRequest.N) {
+	if imageRequest.N < 1 || !isWithinRange(imageRequest.Model, imageRequest.N) {
 		return openai.ErrorWrapper(errors.New("invalid value of n"), "n_not_within_range", http.StatusBadRequest)
 	}
 	return nil
@@ -155,6 +174,10 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	case channeltype.Baidu:
 		fallthrough
 	case channeltype.Zhipu:
+		fallthrough
+	case channeltype.Replicate:
+		fallthrough
+	case channeltype.StabilityAI:
 		finalRequest, err := adaptor.ConvertImageRequest(imageRequest)
 		if err != nil {
 			return openai.ErrorWrapper(err, "convert_image_request_failed", http.StatusInternalServerError)
@@ -169,12 +192,12 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	modelRatio := billingratio.GetModelRatio(imageModel)
 	groupRatio := billingratio.GetGroupRatio(meta.Group)
 	ratio := modelRatio * groupRatio
-	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
-
+	// every image is billed, so that n images of a size cost n times of one
 	quota := int64(ratio*imageCostRatio*1000) * int64(imageRequest.N)
-
-	if userQuota-quota < 0 {
-		return openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+	preConsumedQuota, bizErr := getOrPreConsumeFixedQuota(c, quota, meta)
+	if bizErr != nil {
+		logger.Warnf(ctx, "preConsumeQuota failed: %+v", *bizErr)
+		return bizErr
 	}
 
 	// do request
@@ -183,30 +206,10 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
 		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
 	}
-
-	defer func(ctx context.Context) {
-		if resp != nil && resp.StatusCode != http.StatusOK {
-			return
-		}
-
-		err := model.PostConsumeTokenQuota(meta.TokenId, quota)
-		if err != nil {
-			logger.SysError("error consuming token remain quota: " + err.Error())
-		}
-		err = model.CacheUpdateUserQuota(ctx, meta.UserId)
-		if err != nil {
-			logger.SysError("error update user quota cache: " + err.Error())
-		}
-		if quota != 0 {
-			tokenName := c.GetString(ctxkey.TokenName)
-			logContent := fmt.Sprintf("模型倍率 %.2f，分组倍率 %.2f", modelRatio, groupRatio)
-			channelName := c.GetString(ctxkey.ChannelName)
-			model.RecordConsumeLog(ctx, meta.UserId, meta.ChannelId, 0, 0, imageRequest.Model, tokenName, quota, logContent, channelName)
-			model.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
-			channelId := c.GetInt(ctxkey.ChannelId)
-			model.UpdateChannelUsedQuota(channelId, quota)
-		}
-	}(c.Request.Context())
+	if meta.APIType == apitype.OpenAI && isErrorHappened(meta, resp) {
+		// the response of OpenAI and Azure would be copied to the client as is
+		return RelayErrorHandler(resp)
+	}
 
 	// do response
 	_, respErr := adaptor.DoResponse(c, resp, meta)
@@ -214,6 +217,29 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		logger.Errorf(ctx, "respErr is not nil: %+v", respErr)
 		return respErr
 	}
-
+	if resp != nil && resp.StatusCode != http.StatusOK {
+		ReturnPreConsumedQuota(c)
+		return nil
+	}
+	go postConsumeImageQuota(ctx, meta, imageRequest.Model, quota, preConsumedQuota, modelRatio, groupRatio, c.GetString(ctxkey.ChannelName))
 	return nil
 }
+
+func postConsumeImageQuota(ctx context.Context, meta *meta.Meta, modelName string, quota int64, preConsumedQuota int64, modelRatio float64, groupRatio float64, channelName string) {
+	err := model.PostConsumeTokenQuota(meta.TokenId, quota-preConsumedQuota)
+	if err != nil {
+		logger.SysError("error consuming token remain quota: " + err.Error())
+	}
+	err = model.CacheUpdateUserQuota(ctx, meta.UserId)
+	if err != nil {
+		logger.SysError("error update user quota cache: " + err.Error())
+	}
+	if quota != 0 {
+		logContent := fmt.Sprintf("模型倍率 %.2f，分组倍率 %.2f", modelRatio, groupRatio)
+		model.RecordConsumeLog(ctx, meta.UserId, meta.ChannelId, 0, 0, modelName, meta.TokenName, meta.TokenId, quota, logContent, channelName)
+		model.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
+		model.UpdateChannelUsedQuota(meta.ChannelId, quota)
+		monitor.RecordSpend(quota)
+	}
+	notifyCompletion(ctx, meta, modelName, 0, 0, quota)
+}
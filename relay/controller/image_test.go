@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+func TestValidateImageRequest(t *testing.T) {
+	Convey("validateImageRequest", t, func() {
+		imageMeta := &meta.Meta{ChannelType: channeltype.OpenAI}
+		So(validateImageRequest(&relaymodel.ImageRequest{Model: "dall-e-3", Prompt: "a cat", Size: "1024x1024", N: 1, Quality: "hd"}, imageMeta), ShouldBeNil)
+		So(validateImageRequest(&relaymodel.ImageRequest{Model: "dall-e-2", Prompt: "a cat", Size: "1024x1024", N: 1}, imageMeta), ShouldBeNil)
+
+		err := validateImageRequest(&relaymodel.ImageRequest{Model: "dall-e-2", Prompt: "a cat", Size: "1024x1024", N: 1, Quality: "hd"}, imageMeta)
+		So(err, ShouldNotBeNil)
+		So(err.Code, ShouldEqual, "quality_not_supported")
+
+		err = validateImageRequest(&relaymodel.ImageRequest{Model: "dall-e-2", Prompt: "a cat", Size: "1024x1024", N: -1}, imageMeta)
+		So(err, ShouldNotBeNil)
+		So(err.Code, ShouldEqual, "n_not_within_range")
+	})
+}
+
+func TestRelayImageHelper(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("RelayImageHelper", t, func() {
+		useTestDB(t)
+		var hits int32
+		status := http.StatusOK
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits, 1)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			if status != http.StatusOK {
+				_, _ = w.Write([]byte(`{"error":{"message":"upstream failed","type":"server_error"}}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"created":1700000000,"data":[{"url":"https://example.com/1.png"},{"url":"https://example.com/2.png"}]}`))
+		}))
+		defer upstream.Close()
+		So(model.DB.Create(&model.Channel{Id: 1, Type: channeltype.OpenAI, Key: "sk-test", Name: "openai"}).Error, ShouldBeNil)
+		imageCostRatio, err := getImageCostRatio(&relaymodel.ImageRequest{Model: "dall-e-2", Size: "1024x1024"})
+		So(err, ShouldBeNil)
+		// every image is billed
+		quota := int64(billingratio.GetModelRatio("dall-e-2")*billingratio.GetGroupRatio("default")*imageCostRatio*1000) * 2
+		newContext := func(token *model.Token, body string) (*gin.Context, *httptest.ResponseRecorder) {
+			return newRelayTestContext(t, "/v1/images/generations", body, token, upstream.URL)
+		}
+
+		Convey("bills every image generated", func() {
+			token := createTestToken(t, 1, 1000000, 1000000)
+			c, w := newContext(token, `{"model":"dall-e-2","prompt":"a cat","n":2}`)
+			So(RelayImageHelper(c, relaymode.ImagesGenerations), ShouldBeNil)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(waitChannelUsedQuota(t, 1), ShouldEqual, quota)
+			userQuota, remainQuota := getTestBalances(t, token)
+			So(userQuota, ShouldEqual, 1000000-quota)
+			So(remainQuota, ShouldEqual, 1000000-quota)
+		})
+
+		Convey("rejects the request the user can't afford before it's sent", func() {
+			token := createTestToken(t, 2, quota-1, quota-1)
+			c, _ := newContext(token, `{"model":"dall-e-2","prompt":"a cat","n":2}`)
+			err := RelayImageHelper(c, relaymode.ImagesGenerations)
+			So(err, ShouldNotBeNil)
+			So(err.Code, ShouldEqual, "insufficient_user_quota")
+			So(atomic.LoadInt32(&hits), ShouldEqual, 0)
+		})
+
+		Convey("keeps the pre-consumed quota for the retries when upstream fails", func() {
+			token := createTestToken(t, 3, quota*2, quota*2)
+			status = http.StatusInternalServerError
+			c, w := newContext(token, `{"model":"dall-e-2","prompt":"a cat","n":2}`)
+			err := RelayImageHelper(c, relaymode.ImagesGenerations)
+			So(err, ShouldNotBeNil)
+			So(err.StatusCode, ShouldEqual, http.StatusInternalServerError)
+			So(err.Message, ShouldEqual, "upstream failed")
+			// the error isn't copied to the client, so that the request can be retried
+			So(w.Body.Len(), ShouldEqual, 0)
+			So(c.GetInt64(ctxkey.PreConsumedQuota), ShouldEqual, quota)
+
+			// the quota is returned in the background
+			ReturnPreConsumedQuota(c)
+			userQuota, remainQuota := getTestBalances(t, token)
+			for i := 0; i < 50 && userQuota != quota*2; i++ {
+				time.Sleep(20 * time.Millisecond)
+				userQuota, remainQuota = getTestBalances(t, token)
+			}
+			So(userQuota, ShouldEqual, quota*2)
+			So(remainQuota, ShouldEqual, quota*2)
+		})
+	})
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/testdb"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+// useTestDB points the model at a new SQLite database with all the tables migrated, redis is disabled
+func useTestDB(t *testing.T) {
+	testdb.Use(t, model.InitDB, &model.DB, &model.LOG_DB)
+	if client.HTTPClient == nil {
+		client.HTTPClient = http.DefaultClient
+	}
+}
+
+// createTestToken inserts an enabled user with the quota and a token of it with the remain quota
+func createTestToken(t *testing.T, userId int, quota int64, remainQuota int64) *model.Token {
+	user := &model.User{
+		Id:          userId,
+		Username:    fmt.Sprintf("user%d", userId),
+		Quota:       quota,
+		Status:      model.UserStatusEnabled,
+		AccessToken: fmt.Sprintf("access%d", userId),
+		AffCode:     fmt.Sprintf("aff%d", userId),
+		Group:       "default",
+	}
+	token := &model.Token{
+		UserId:      userId,
+		Key:         fmt.Sprintf("key%d", userId),
+		Status:      model.TokenStatusEnabled,
+		RemainQuota: remainQuota,
+		ExpiredTime: -1,
+	}
+	if err := model.DB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := model.DB.Create(token).Error; err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// getTestBalances returns the quota of the user and the remain quota of the token
+func getTestBalances(t *testing.T, token *model.Token) (int64, int64) {
+	user := model.User{}
+	if err := model.DB.First(&user, token.UserId).Error; err != nil {
+		t.Fatal(err)
+	}
+	current := model.Token{}
+	if err := model.DB.First(&current, token.Id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user.Quota, current.RemainQuota
+}
+
+// newRelayTestContext is a JSON request of the token, distributed to the OpenAI channel #1 served at baseURL
+func newRelayTestContext(t *testing.T, path string, body string, token *model.Token, baseURL string) (*gin.Context, *httptest.ResponseRecorder) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set(ctxkey.Id, token.UserId)
+	c.Set(ctxkey.TokenId, token.Id)
+	c.Set(ctxkey.Group, "default")
+	c.Set(ctxkey.Channel, channeltype.OpenAI)
+	c.Set(ctxkey.ChannelId, 1)
+	c.Set(ctxkey.BaseURL, baseURL)
+	return c, w
+}
+
+// waitChannelUsedQuota returns the used quota of the channel once the request is billed,
+// the used quota of the channel is the last to be updated
+func waitChannelUsedQuota(t *testing.T, id int) int64 {
+	t.Helper()
+	for i := 0; i < 50; i++ {
+		channel := model.Channel{}
+		if err := model.DB.First(&channel, id).Error; err != nil {
+			t.Fatal(err)
+		}
+		if channel.UsedQuota != 0 {
+			return channel.UsedQuota
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return 0
+}
@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/monitor"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/anthropic"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// RelayMessagesHelper relays a native Anthropic Messages API request to an Anthropic channel as is,
+// only the model is replaced if it's mapped. Usage is taken from what upstream reports.
+func RelayMessagesHelper(c *gin.Context) *model.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	textRequest := &model.GeneralOpenAIRequest{}
+	err := common.PeekBodyReusable(c, map[string]any{
+		"model":      &textRequest.Model,
+		"stream":     &textRequest.Stream,
+		"max_tokens": &textRequest.MaxTokens,
+	})
+	if err != nil || textRequest.Model == "" {
+		return openai.ErrorWrapper(fmt.Errorf("model is required"), "invalid_messages_request", http.StatusBadRequest)
+	}
+	meta.IsStream = textRequest.Stream
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_request_body_failed", http.StatusBadRequest)
+	}
+
+	// map model name
+	var isModelMapped bool
+	meta.OriginModelName = textRequest.Model
+	textRequest.Model, isModelMapped = getMappedModelName(textRequest.Model, meta.ModelMapping)
+	meta.ActualModelName = textRequest.Model
+	if isModelMapped {
+		requestBody, err = replaceRequestModel(requestBody, textRequest.Model)
+		if err != nil {
+			return openai.ErrorWrapper(err, "invalid_messages_request", http.StatusBadRequest)
+		}
+	}
+	modelRatio := billingratio.GetModelRatio(textRequest.Model)
+	groupRatio := billingratio.GetGroupRatio(meta.Group)
+	ratio := modelRatio * groupRatio
+	meta.PromptTokens = estimatePromptTokens(c)
+	if bizErr := reserveChannelThroughput(meta, meta.PromptTokens); bizErr != nil {
+		logger.Warnf(ctx, "channel #%d is rate limited", meta.ChannelId)
+		return bizErr
+	}
+	preConsumedQuota, bizErr := getOrPreConsumeQuota(c, textRequest, meta.PromptTokens, ratio, meta)
+	if bizErr != nil {
+		logger.Warnf(ctx, "preConsumeQuota failed: %+v", *bizErr)
+		return bizErr
+	}
+
+	a := relay.GetAdaptor(meta.APIType)
+	if a == nil {
+		return openai.ErrorWrapper(fmt.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
+	}
+	a.Init(meta)
+	resp, err := a.DoRequest(c, meta, bytes.NewReader(requestBody))
+	if err != nil {
+		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if isErrorHappened(meta, resp) {
+		return RelayErrorHandler(resp)
+	}
+
+	var usage *model.Usage
+	var respErr *model.ErrorWithStatusCode
+	restoreWriter := captureFinishReason(c, meta)
+	if meta.IsStream {
+		monitor.StreamStarted()
+		defer monitor.StreamFinished()
+		usage, respErr = relayMessagesStream(c, resp)
+	} else {
+		usage, respErr = relayMessagesResponse(c, resp)
+	}
+	restoreWriter()
+	if respErr != nil {
+		logger.Errorf(ctx, "respErr is not nil: %+v", respErr)
+		return respErr
+	}
+	channelName := c.GetString("channel_name")
+	go postConsumeQuota(ctx, usage, meta, textRequest, ratio, preConsumedQuota, modelRatio, groupRatio, channelName)
+	return nil
+}
+
+func replaceRequestModel(requestBody []byte, modelName string) ([]byte, error) {
+	var rawRequest map[string]json.RawMessage
+	err := json.Unmarshal(requestBody, &rawRequest)
+	if err != nil {
+		return nil, err
+	}
+	rawRequest["model"], err = json.Marshal(modelName)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(rawRequest)
+}
+
+func relayMessagesResponse(c *gin.Context, resp *http.Response) (*model.Usage, *model.ErrorWithStatusCode) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError)
+	}
+	var claudeResponse anthropic.Response
+	err = json.Unmarshal(responseBody, &claudeResponse)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+	}
+	adaptor.SetupResponseHeader(c, resp)
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(responseBody)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "write_response_body_failed", http.StatusInternalServerError)
+	}
+	return &model.Usage{
+		PromptTokens:     claudeResponse.Usage.InputTokens,
+		CompletionTokens: claudeResponse.Usage.OutputTokens,
+		TotalTokens:      claudeResponse.Usage.InputTokens + claudeResponse.Usage.OutputTokens,
+	}, nil
+}
+
+// relayMessagesStream writes the events as they come, the input tokens are in message_start
+// and the output tokens in message_delta
+func relayMessagesStream(c *gin.Context, resp *http.Response) (*model.Usage, *model.ErrorWithStatusCode) {
+	usage := &model.Usage{}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	common.SetEventStreamHeaders(c)
+	c.Writer.WriteHeader(resp.StatusCode)
+	for scanner.Scan() {
+		line := scanner.Text()
+		_, err := c.Writer.WriteString(line + "\n")
+		if err != nil {
+			break
+		}
+		if line == "" {
+			c.Writer.Flush()
+			continue
+		}
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		var event anthropic.StreamResponse
+		if json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &event) != nil {
+			continue
+		}
+		switch event.Type {
+		case "message_start":
+			if event.Message != nil {
+				usage.PromptTokens = event.Message.Usage.InputTokens
+			}
+		case "message_delta":
+			if event.Usage != nil {
+				usage.CompletionTokens = event.Usage.OutputTokens
+			}
+		}
+	}
+	c.Writer.Flush()
+	if err := scanner.Err(); err != nil {
+		logger.SysError("error reading stream: " + err.Error())
+	}
+	err := resp.Body.Close()
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError)
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage, nil
+}
@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor"
+	"github.com/songquanpeng/one-api/relay/adaptor/midjourney"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+func getMidjourneyAction(c *gin.Context, request *midjourney.SubmitRequest) (string, error) {
+	if strings.HasSuffix(c.Request.URL.Path, "/imagine") {
+		if request.Prompt == "" {
+			return "", errors.New("prompt is required")
+		}
+		return midjourney.ActionImagine, nil
+	}
+	switch request.Action {
+	case midjourney.ActionUpscale, midjourney.ActionVariation:
+		if request.Index < 1 || request.Index > 4 {
+			return "", errors.New("index must be between 1 and 4")
+		}
+	case midjourney.ActionReroll:
+	default:
+		return "", fmt.Errorf("unsupported action: %s", request.Action)
+	}
+	if request.TaskId == "" {
+		return "", errors.New("taskId is required")
+	}
+	return request.Action, nil
+}
+
+// RelayMidjourneySubmit submits a task to the proxy, the quota of the action is pre-consumed
+// and settled by SettleMidjourneyTask once the task is finished
+func RelayMidjourneySubmit(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_request_body_failed", http.StatusBadRequest)
+	}
+	var submitRequest midjourney.SubmitRequest
+	err = json.Unmarshal(requestBody, &submitRequest)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_midjourney_request", http.StatusBadRequest)
+	}
+	action, err := getMidjourneyAction(c, &submitRequest)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_midjourney_request", http.StatusBadRequest)
+	}
+	var originTask *model.MidjourneyTask
+	if action != midjourney.ActionImagine {
+		originTask, err = model.GetMidjourneyTaskByMjId(meta.UserId, submitRequest.TaskId)
+		if err != nil {
+			return openai.ErrorWrapper(errors.New("task not found"), "task_not_found", http.StatusNotFound)
+		}
+		if originTask.Status != model.MidjourneyTaskStatusSuccess {
+			return openai.ErrorWrapper(errors.New("task is not finished successfully"), "task_not_finished", http.StatusBadRequest)
+		}
+	}
+	requestBody, err = midjourney.ConvertSubmitRequest(requestBody)
+	if err != nil {
+		return openai.ErrorWrapper(err, "convert_midjourney_request_failed", http.StatusInternalServerError)
+	}
+
+	modelName := midjourney.ModelOf(action)
+	modelRatio := billingratio.GetModelRatio(modelName)
+	groupRatio := billingratio.GetGroupRatio(meta.Group)
+	quota := int64(modelRatio * groupRatio * 1000)
+	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	if err != nil {
+		return openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
+	}
+	if userQuota-quota < 0 {
+		return openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+	}
+	err = model.CacheDecreaseUserQuota(meta.UserId, quota)
+	if err != nil {
+		return openai.ErrorWrapper(err, "decrease_user_quota_failed", http.StatusInternalServerError)
+	}
+	if quota > 0 {
+		err = model.PreConsumeTokenQuota(meta.TokenId, quota)
+		if err != nil {
+			return openai.ErrorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
+		}
+	}
+
+	adaptor := &midjourney.Adaptor{}
+	resp, err := adaptor.DoRequest(c, meta, bytes.NewReader(requestBody))
+	if err != nil {
+		returnMidjourneyQuota(ctx, meta.UserId, meta.TokenId, quota)
+		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	responseBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		returnMidjourneyQuota(ctx, meta.UserId, meta.TokenId, quota)
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	var submitResponse midjourney.SubmitResponse
+	err = json.Unmarshal(responseBody, &submitResponse)
+	if resp.StatusCode != http.StatusOK || err != nil ||
+		(submitResponse.Code != midjourney.CodeSuccess && submitResponse.Code != midjourney.CodeInQueue) || submitResponse.Result == "" {
+		// an existed task isn't a new one either
+		returnMidjourneyQuota(ctx, meta.UserId, meta.TokenId, quota)
+	} else {
+		prompt := submitRequest.Prompt
+		if originTask != nil {
+			prompt = originTask.Prompt
+		}
+		task := &model.MidjourneyTask{
+			MjId:       submitResponse.Result,
+			UserId:     meta.UserId,
+			TokenId:    meta.TokenId,
+			TokenName:  c.GetString(ctxkey.TokenName),
+			ChannelId:  meta.ChannelId,
+			Action:     action,
+			Prompt:     prompt,
+			State:      submitRequest.State,
+			Status:     midjourney.StatusSubmitted,
+			SubmitTime: helper.GetTimestamp(),
+			Quota:      quota,
+			ModelRatio: modelRatio,
+			GroupRatio: groupRatio,
+		}
+		err = task.Insert()
+		if err != nil {
+			// the task can't be tracked, it's free rather than charged forever
+			logger.Errorf(ctx, "failed to insert midjourney task %s: %s", task.MjId, err.Error())
+			returnMidjourneyQuota(ctx, meta.UserId, meta.TokenId, quota)
+		}
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, _ = c.Writer.Write(responseBody)
+	return nil
+}
+
+func returnMidjourneyQuota(ctx context.Context, userId int, tokenId int, quota int64) {
+	if quota == 0 {
+		return
+	}
+	err := model.PostConsumeTokenQuota(tokenId, -quota)
+	if err != nil {
+		logger.Error(ctx, "error return pre-consumed quota: "+err.Error())
+	}
+	err = model.CacheUpdateUserQuota(ctx, userId)
+	if err != nil {
+		logger.Error(ctx, "error update user quota cache: "+err.Error())
+	}
+}
+
+// SettleMidjourneyTask charges a succeeded task and refunds a failed one, it's called once the task is finished
+func SettleMidjourneyTask(ctx context.Context, task *model.MidjourneyTask) {
+	if task.Status != model.MidjourneyTaskStatusSuccess {
+		returnMidjourneyQuota(ctx, task.UserId, task.TokenId, task.Quota)
+		return
+	}
+	if task.Quota == 0 {
+		return
+	}
+	channelName := ""
+	if channel, err := model.GetChannelById(task.ChannelId, false); err == nil {
+		channelName = channel.Name
+	}
+	logContent := fmt.Sprintf("模型倍率 %.2f，分组倍率 %.2f，任务 %s", task.ModelRatio, task.GroupRatio, task.MjId)
+	model.RecordConsumeLog(ctx, task.UserId, task.ChannelId, 0, 0, midjourney.ModelOf(task.Action), task.TokenName, task.TokenId, task.Quota, logContent, channelName)
+	model.UpdateUserUsedQuotaAndRequestCount(task.UserId, task.Quota)
+	model.UpdateChannelUsedQuota(task.ChannelId, task.Quota)
+	monitor.RecordSpend(task.Quota)
+}
@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/image"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/constant/streampolicy"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// getPassthroughTextRequest peeks the few fields we need from a huge request which could be relayed as is,
+// so that its messages are never decoded. The body is still read into memory as a whole, it's kept for the
+// retries, only the decoding and the encoding of it are saved. The second return value is false if the request
+// is not eligible, in that case the request should be decoded as usual.
+func getPassthroughTextRequest(c *gin.Context, meta *meta.Meta) (*relaymodel.GeneralOpenAIRequest, bool) {
+	if config.BodyPassthroughThreshold <= 0 {
+		return nil, false
+	}
+	// only openai compatible channels take the original body, the ones whose requests are changed don't
+	if meta.APIType != apitype.OpenAI || meta.ChannelType == channeltype.Baichuan ||
+		meta.ChannelType == channeltype.OpenRouter || meta.ChannelType == channeltype.DeepSeek ||
+		meta.ChannelType == channeltype.Cerebras {
+		return nil, false
+	}
+	if meta.Mode != relaymode.ChatCompletions && meta.Mode != relaymode.Completions && meta.Mode != relaymode.Embeddings {
+		return nil, false
+	}
+	// the inputs are needed to split the batch
+	if meta.Mode == relaymode.Embeddings && meta.Config.EmbeddingBatchSize > 0 {
+		return nil, false
+	}
+	// the completions of the sandbox group are cut at SandboxMaxTokens, which changes the body
+	if meta.Group == config.SandboxGroup {
+		return nil, false
+	}
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil || len(requestBody) < config.BodyPassthroughThreshold {
+		return nil, false
+	}
+	// the images are decoded to be downscaled, which changes the body
+	if meta.Config.ImageMaxDimension > 0 && bytes.Contains(requestBody, []byte(`"data:`)) {
+		return nil, false
+	}
+	textRequest := &relaymodel.GeneralOpenAIRequest{}
+	err = common.PeekBodyReusable(c, map[string]any{
+		"model":           &textRequest.Model,
+		"stream":          &textRequest.Stream,
+		"stream_options":  &textRequest.StreamOptions,
+		"max_tokens":      &textRequest.MaxTokens,
+		"response_format": &textRequest.ResponseFormat,
+		"tools":           &textRequest.Tools,
+		"functions":       &textRequest.Functions,
+	})
+	if err != nil || textRequest.Model == "" {
+		return nil, false
+	}
+	// the stream policy would change the stream field
+	policy := getStreamPolicy(c, meta)
+	if (!textRequest.Stream && policy == streampolicy.Force) || (textRequest.Stream && policy == streampolicy.Disable) {
+		return nil, false
+	}
+	// streams don't report usage unless asked to, and we are not going to touch the body to ask,
+	// so prompt tokens would have to be counted by us
+	if textRequest.Stream && (textRequest.StreamOptions == nil || !textRequest.StreamOptions.IncludeUsage) {
+		return nil, false
+	}
+	if meta.ModelMapping[textRequest.Model] != "" {
+		return nil, false
+	}
+	return textRequest, true
+}
+
+// validatePassthroughRequest checks the passthrough request like a decoded one, with the fields peeked and the
+// images found in the body instead of the messages
+func validatePassthroughRequest(c *gin.Context, textRequest *relaymodel.GeneralOpenAIRequest, meta *meta.Meta) *relaymodel.ErrorWithStatusCode {
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_request_body_failed", http.StatusInternalServerError)
+	}
+	imageURLs := getInlineImageURLs(requestBody)
+	imageBytes := 0
+	maxSize := config.InlineImageMaxSize * 1024 * 1024
+	for _, imageURL := range imageURLs {
+		imageBytes += len(imageURL)
+		if size := image.GetDataURLSize(string(imageURL)); maxSize > 0 && size > maxSize {
+			return imageError(fmt.Sprintf("An image in the messages is %.1f MB, larger than the limit of %d MB.", float64(size)/1024/1024, config.InlineImageMaxSize),
+				"image_too_large", http.StatusRequestEntityTooLarge)
+		}
+	}
+	// the base64 images would be counted as a lot of text
+	if bizErr := validateContextWindow(textRequest, (len(requestBody)-imageBytes)/4, meta); bizErr != nil {
+		return bizErr
+	}
+	hasImage := len(imageURLs) > 0 || bytes.Contains(requestBody, []byte(`"image_url"`))
+	if bizErr := validateModelCapabilities(textRequest, hasImage, meta); bizErr != nil {
+		return bizErr
+	}
+	return validateResponseFormat(textRequest, meta)
+}
+
+// getInlineImageURLs finds the data URLs in the body without decoding it, there are no quotes in a data URL
+func getInlineImageURLs(body []byte) [][]byte {
+	var imageURLs [][]byte
+	for {
+		start := bytes.Index(body, []byte(`"data:`))
+		if start < 0 {
+			return imageURLs
+		}
+		body = body[start+1:]
+		end := bytes.IndexByte(body, '"')
+		if end < 0 {
+			return imageURLs
+		}
+		imageURLs = append(imageURLs, body[:end])
+		body = body[end+1:]
+	}
+}
+
+// estimatePromptTokens is a rough upper bound used to pre-consume quota for passthrough requests,
+// the actual usage reported by upstream is what gets billed
+func estimatePromptTokens(c *gin.Context) int {
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return 0
+	}
+	return len(requestBody) / 4
+}
@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+func newPassthroughContext(body string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	return c
+}
+
+func TestGetPassthroughTextRequest(t *testing.T) {
+	Convey("getPassthroughTextRequest", t, func() {
+		oldThreshold := config.BodyPassthroughThreshold
+		config.BodyPassthroughThreshold = 64
+		t.Cleanup(func() {
+			config.BodyPassthroughThreshold = oldThreshold
+		})
+		body := `{"model":"gpt-4o","max_tokens":100,"messages":[{"role":"user","content":"` + strings.Repeat("a", 100) + `"}]}`
+		newMeta := func(group string) *meta.Meta {
+			return &meta.Meta{APIType: apitype.OpenAI, ChannelType: channeltype.OpenAI, Mode: relaymode.ChatCompletions, Group: group}
+		}
+
+		Convey("peeks the fields of a huge request", func() {
+			textRequest, ok := getPassthroughTextRequest(newPassthroughContext(body), newMeta("default"))
+			So(ok, ShouldBeTrue)
+			So(textRequest.Model, ShouldEqual, "gpt-4o")
+			So(textRequest.MaxTokens, ShouldEqual, 100)
+		})
+
+		Convey("doesn't pass through the requests of the sandbox group", func() {
+			_, ok := getPassthroughTextRequest(newPassthroughContext(body), newMeta(config.SandboxGroup))
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("passes through the streams asking for the usage only", func() {
+			stream := `{"model":"gpt-4o","stream":true,` + body[len(`{"model":"gpt-4o",`):]
+			_, ok := getPassthroughTextRequest(newPassthroughContext(stream), newMeta("default"))
+			So(ok, ShouldBeFalse)
+			stream = `{"model":"gpt-4o","stream":true,"stream_options":{"include_usage":true},` + body[len(`{"model":"gpt-4o",`):]
+			textRequest, ok := getPassthroughTextRequest(newPassthroughContext(stream), newMeta("default"))
+			So(ok, ShouldBeTrue)
+			So(textRequest.Stream, ShouldBeTrue)
+		})
+
+		Convey("doesn't pass through the images to downscale", func() {
+			withImage := `{"model":"gpt-4o","messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"data:image/png;base64,` +
+				strings.Repeat("A", 100) + `"}}]}]}`
+			meta := newMeta("default")
+			_, ok := getPassthroughTextRequest(newPassthroughContext(withImage), meta)
+			So(ok, ShouldBeTrue)
+			meta.Config.ImageMaxDimension = 1024
+			_, ok = getPassthroughTextRequest(newPassthroughContext(withImage), meta)
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
+
+func TestValidatePassthroughRequest(t *testing.T) {
+	Convey("validatePassthroughRequest", t, func() {
+		oldThreshold, oldContextCheck, oldCapabilityCheck, oldImageMaxSize := config.BodyPassthroughThreshold,
+			config.ContextWindowCheckEnabled, config.ModelCapabilityCheckEnabled, config.InlineImageMaxSize
+		config.BodyPassthroughThreshold, config.ContextWindowCheckEnabled, config.ModelCapabilityCheckEnabled, config.InlineImageMaxSize = 64, true, true, 1
+		t.Cleanup(func() {
+			config.BodyPassthroughThreshold, config.ContextWindowCheckEnabled, config.ModelCapabilityCheckEnabled, config.InlineImageMaxSize =
+				oldThreshold, oldContextCheck, oldCapabilityCheck, oldImageMaxSize
+		})
+		validate := func(body string) *relaymodel.ErrorWithStatusCode {
+			c := newPassthroughContext(body)
+			meta := &meta.Meta{APIType: apitype.OpenAI, ChannelType: channeltype.OpenAI, Mode: relaymode.ChatCompletions, Group: "default"}
+			textRequest, ok := getPassthroughTextRequest(c, meta)
+			So(ok, ShouldBeTrue)
+			meta.OriginModelName = textRequest.Model
+			return validatePassthroughRequest(c, textRequest, meta)
+		}
+		imagePart := func(size int) string {
+			return `{"type":"image_url","image_url":{"url":"data:image/png;base64,` + strings.Repeat("A", size) + `"}}`
+		}
+
+		Convey("lets the valid requests through", func() {
+			So(validate(`{"model":"gpt-4o","messages":[{"role":"user","content":[`+imagePart(1000)+`]}]}`), ShouldBeNil)
+		})
+
+		Convey("checks the context window without the images", func() {
+			So(validate(`{"model":"gpt-4o","max_tokens":100,"messages":[{"role":"user","content":[`+imagePart(600000)+`]}]}`), ShouldBeNil)
+			bizErr := validate(`{"model":"gpt-4","max_tokens":100,"messages":[{"role":"user","content":"` + strings.Repeat("a", 40000) + `"}]}`)
+			So(bizErr, ShouldNotBeNil)
+			So(bizErr.Code, ShouldEqual, "context_length_exceeded")
+		})
+
+		Convey("checks the capabilities of the model", func() {
+			bizErr := validate(`{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":[` + imagePart(100) + `]}]}`)
+			So(bizErr, ShouldNotBeNil)
+			So(bizErr.Code, ShouldEqual, "unsupported_capability")
+		})
+
+		Convey("checks the response format", func() {
+			bizErr := validate(`{"model":"gpt-4o","response_format":{"type":"json_schema","json_schema":{}},"messages":[{"role":"user","content":"` +
+				strings.Repeat("a", 100) + `"}]}`)
+			So(bizErr, ShouldNotBeNil)
+			So(bizErr.Code, ShouldEqual, "unsupported_response_format")
+		})
+
+		Convey("checks the size of the images", func() {
+			bizErr := validate(`{"model":"gpt-4o","messages":[{"role":"user","content":[` + imagePart(2*1024*1024) + `]}]}`)
+			So(bizErr, ShouldNotBeNil)
+			So(bizErr.StatusCode, ShouldEqual, http.StatusRequestEntityTooLarge)
+		})
+	})
+}
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor/cohere"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/billing"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// RelayRerankHelper relays a rerank request in the Cohere format, it's billed per search unit
+func RelayRerankHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	rerankRequest := &cohere.RerankRequest{}
+	err := common.UnmarshalBodyReusable(c, rerankRequest)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_rerank_request", http.StatusBadRequest)
+	}
+	if rerankRequest.Query == "" || len(rerankRequest.Documents) == 0 {
+		return openai.ErrorWrapper(errors.New("query and documents are required"), "invalid_rerank_request", http.StatusBadRequest)
+	}
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_request_body_failed", http.StatusBadRequest)
+	}
+
+	// map model name
+	var isModelMapped bool
+	meta.OriginModelName = rerankRequest.Model
+	rerankRequest.Model, isModelMapped = getMappedModelName(rerankRequest.Model, meta.ModelMapping)
+	meta.ActualModelName = rerankRequest.Model
+	if isModelMapped {
+		requestBody, err = replaceRequestModel(requestBody, rerankRequest.Model)
+		if err != nil {
+			return openai.ErrorWrapper(err, "invalid_rerank_request", http.StatusBadRequest)
+		}
+	}
+
+	modelRatio := billingratio.GetModelRatio(rerankRequest.Model)
+	groupRatio := billingratio.GetGroupRatio(meta.Group)
+	ratio := modelRatio * groupRatio
+	searchUnits := (len(rerankRequest.Documents) + cohere.RerankDocumentsPerSearch - 1) / cohere.RerankDocumentsPerSearch
+	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	if err != nil {
+		return openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
+	}
+	if userQuota-int64(ratio*1000)*int64(searchUnits) < 0 {
+		return openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+	}
+
+	adaptor := relay.GetAdaptor(meta.APIType)
+	if adaptor == nil {
+		return openai.ErrorWrapper(errors.New("invalid api type"), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptor.Init(meta)
+	resp, err := adaptor.DoRequest(c, meta, bytes.NewReader(requestBody))
+	if err != nil {
+		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if isErrorHappened(meta, resp) {
+		return RelayErrorHandler(resp)
+	}
+	respErr, billedSearchUnits := cohere.RerankHandler(c, resp)
+	if respErr != nil {
+		logger.Errorf(ctx, "respErr is not nil: %+v", respErr)
+		return respErr
+	}
+	if billedSearchUnits > 0 {
+		searchUnits = billedSearchUnits
+	}
+	quota := int64(ratio*1000) * int64(searchUnits)
+	go billing.PostConsumeQuota(ctx, meta.TokenId, quota, quota, meta.UserId, meta.ChannelId, modelRatio, groupRatio, rerankRequest.Model, meta.TokenName, c.GetString("channel_name"))
+	return nil
+}
@@ -0,0 +1,213 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/render"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// applySandboxMaxTokens cuts the completion of the sandbox requests at SandboxMaxTokens,
+// it's done before the quota is pre-consumed and reports whether the request is modified
+func applySandboxMaxTokens(textRequest *relaymodel.GeneralOpenAIRequest, meta *meta.Meta) bool {
+	if meta.Group != config.SandboxGroup || config.SandboxMaxTokens <= 0 {
+		return false
+	}
+	if meta.Mode != relaymode.ChatCompletions && meta.Mode != relaymode.Completions {
+		return false
+	}
+	if textRequest.MaxTokens > 0 && textRequest.MaxTokens <= config.SandboxMaxTokens {
+		return false
+	}
+	textRequest.MaxTokens = config.SandboxMaxTokens
+	return true
+}
+
+// watermarkWriter appends SandboxWatermark to the content of every choice. The events of a stream are passed
+// through line by line, with an event of the watermark inserted before the one finishing a choice,
+// a non-stream response is held back until it's complete.
+type watermarkWriter struct {
+	gin.ResponseWriter
+	isStream bool
+	pending  render.LineBuffer
+	status   int
+	// the last event seen and the choices with content not yet watermarked, by index
+	last           openai.ChatCompletionsStreamResponse
+	pendingChoices map[int]bool
+}
+
+func (w *watermarkWriter) Write(data []byte) (int, error) {
+	w.pending.Write(data)
+	if !w.isStream {
+		return len(data), nil
+	}
+	err := w.pending.EachLine(func(line []byte) error {
+		w.watermarkBefore(line)
+		_, err := w.ResponseWriter.Write(line)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (w *watermarkWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// watermarkBefore writes the watermark of the choices the event finishes, or of all the remaining ones at the end
+func (w *watermarkWriter) watermarkBefore(line []byte) {
+	payload, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+	payload = bytes.TrimSpace(payload)
+	if !ok {
+		return
+	}
+	if string(payload) == "[DONE]" {
+		for index := range w.pendingChoices {
+			w.writeWatermarkEvent(index)
+		}
+		return
+	}
+	var chunk openai.ChatCompletionsStreamResponse
+	if json.Unmarshal(payload, &chunk) != nil {
+		return
+	}
+	w.last = chunk
+	for _, choice := range chunk.Choices {
+		if content, ok := choice.Delta.Content.(string); ok && content != "" {
+			w.pendingChoices[choice.Index] = true
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" && w.pendingChoices[choice.Index] {
+			w.writeWatermarkEvent(choice.Index)
+		}
+	}
+}
+
+func (w *watermarkWriter) writeWatermarkEvent(index int) {
+	delete(w.pendingChoices, index)
+	event := openai.ChatCompletionsStreamResponse{
+		Id:      w.last.Id,
+		Object:  "chat.completion.chunk",
+		Created: w.last.Created,
+		Model:   w.last.Model,
+		Choices: []openai.ChatCompletionsStreamResponseChoice{{
+			Index: index,
+			Delta: relaymodel.Message{Content: config.SandboxWatermark},
+		}},
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	_, _ = w.ResponseWriter.Write([]byte("data: " + string(data) + "\n\n"))
+}
+
+func (w *watermarkWriter) WriteHeader(code int) {
+	if w.isStream {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if code > 0 {
+		w.status = code
+	}
+}
+
+func (w *watermarkWriter) WriteHeaderNow() {
+	if w.isStream {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *watermarkWriter) Written() bool {
+	if w.isStream {
+		return w.ResponseWriter.Written()
+	}
+	return false
+}
+
+func (w *watermarkWriter) Status() int {
+	if w.isStream {
+		return w.ResponseWriter.Status()
+	}
+	return w.status
+}
+
+// finish writes the held back response, it must be called after the writer of the context is restored
+func (w *watermarkWriter) finish() {
+	if w.isStream {
+		if w.pending.Len() > 0 {
+			_, _ = w.ResponseWriter.Write(w.pending.Bytes())
+		}
+		return
+	}
+	if w.pending.Len() == 0 {
+		return
+	}
+	body := w.pending.Bytes()
+	if w.status == http.StatusOK {
+		if watermarked, ok := watermarkChatCompletion(body); ok {
+			body = watermarked
+			w.Header().Del("Content-Length")
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	_, _ = w.ResponseWriter.Write(body)
+}
+
+// watermarkChatCompletion appends the watermark to the text content of the choices, the other fields are kept as is
+func watermarkChatCompletion(body []byte) ([]byte, bool) {
+	var response map[string]any
+	if json.Unmarshal(body, &response) != nil {
+		return nil, false
+	}
+	choices, _ := response["choices"].([]any)
+	isModified := false
+	for _, choice := range choices {
+		choice, _ := choice.(map[string]any)
+		message, _ := choice["message"].(map[string]any)
+		if content, ok := message["content"].(string); ok && content != "" {
+			message["content"] = content + config.SandboxWatermark
+			isModified = true
+		}
+	}
+	if !isModified {
+		return nil, false
+	}
+	watermarked, err := json.Marshal(response)
+	if err != nil {
+		return nil, false
+	}
+	return watermarked, true
+}
+
+// appendSandboxWatermark watermarks the chat completions of the sandbox group, except the ones asked for JSON.
+// It must be called before the other writers are set up, so that they see the response without the watermark,
+// the returned function restores the writer of the context and writes the response.
+func appendSandboxWatermark(c *gin.Context, meta *meta.Meta, textRequest *relaymodel.GeneralOpenAIRequest, streamConversion int) func() {
+	if meta.Group != config.SandboxGroup || config.SandboxWatermark == "" || meta.Mode != relaymode.ChatCompletions {
+		return func() {}
+	}
+	if textRequest.ResponseFormat != nil && textRequest.ResponseFormat.Type != "" && textRequest.ResponseFormat.Type != "text" {
+		return func() {}
+	}
+	writer := &watermarkWriter{
+		ResponseWriter: c.Writer,
+		// the stream of the upstream is converted for the client, or the other way around
+		isStream:       meta.IsStream != (streamConversion != streamConversionNone),
+		status:         http.StatusOK,
+		pendingChoices: make(map[int]bool),
+	}
+	c.Writer = writer
+	return func() {
+		c.Writer = writer.ResponseWriter
+		writer.finish()
+	}
+}
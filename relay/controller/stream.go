@@ -0,0 +1,245 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/conv"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/render"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/constant"
+	"github.com/songquanpeng/one-api/relay/constant/role"
+	"github.com/songquanpeng/one-api/relay/constant/streampolicy"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+const (
+	streamConversionNone = iota
+	streamConversionToStream
+	streamConversionToNonStream
+)
+
+// applyStreamPolicy changes the stream field of the request according to the policy of the token or the group,
+// and returns how the response should be converted back to what the client asked for
+func applyStreamPolicy(c *gin.Context, meta *meta.Meta, textRequest *relaymodel.GeneralOpenAIRequest) int {
+	if meta.Mode != relaymode.ChatCompletions {
+		return streamConversionNone
+	}
+	switch getStreamPolicy(c, meta) {
+	case streampolicy.Disable:
+		if textRequest.Stream {
+			textRequest.Stream = false
+			meta.IsStream = false
+			return streamConversionToStream
+		}
+	case streampolicy.Force:
+		isLongGeneration := textRequest.MaxTokens == 0 || textRequest.MaxTokens >= config.ForceStreamMaxTokensThreshold
+		if !textRequest.Stream && isLongGeneration {
+			textRequest.Stream = true
+			meta.IsStream = true
+			return streamConversionToNonStream
+		}
+	}
+	return streamConversionNone
+}
+
+func getStreamPolicy(c *gin.Context, meta *meta.Meta) string {
+	policy := c.GetString(ctxkey.TokenStreamPolicy)
+	if policy == streampolicy.Default {
+		policy = config.GroupStreamPolicy[meta.Group]
+	}
+	return policy
+}
+
+// bufferedResponseWriter holds back everything the adaptor writes, so that it can be converted afterwards
+type bufferedResponseWriter struct {
+	gin.ResponseWriter
+	body   bytes.Buffer
+	status int
+}
+
+func newBufferedResponseWriter(w gin.ResponseWriter) *bufferedResponseWriter {
+	return &bufferedResponseWriter{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (w *bufferedResponseWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedResponseWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedResponseWriter) WriteHeader(code int) {
+	if code > 0 {
+		w.status = code
+	}
+}
+
+func (w *bufferedResponseWriter) WriteHeaderNow() {}
+
+func (w *bufferedResponseWriter) Flush() {}
+
+func (w *bufferedResponseWriter) Written() bool {
+	return false
+}
+
+func (w *bufferedResponseWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferedResponseWriter) Size() int {
+	return w.body.Len()
+}
+
+func clearResponseHeaders(c *gin.Context) {
+	for _, key := range []string{"Content-Type", "Content-Length", "Cache-Control", "Connection", "Transfer-Encoding", "X-Accel-Buffering"} {
+		c.Writer.Header().Del(key)
+	}
+}
+
+// writeConvertedResponse must be called after the original writer of the context is restored
+func writeConvertedResponse(c *gin.Context, w *bufferedResponseWriter, conversion int, usage *relaymodel.Usage) error {
+	clearResponseHeaders(c)
+	switch conversion {
+	case streamConversionToStream:
+		return writeResponseAsStream(c, w.body.Bytes())
+	case streamConversionToNonStream:
+		return writeStreamAsResponse(c, w.body.Bytes(), usage)
+	}
+	return nil
+}
+
+func writeResponseAsStream(c *gin.Context, body []byte) error {
+	var textResponse openai.TextResponse
+	err := json.Unmarshal(body, &textResponse)
+	if err != nil {
+		return err
+	}
+	streamResponse := openai.ChatCompletionsStreamResponse{
+		Id:      textResponse.Id,
+		Object:  constant.StreamObject,
+		Created: textResponse.Created,
+		Model:   textResponse.Model,
+		Usage:   &textResponse.Usage,
+
+		PerplexityExtension: textResponse.PerplexityExtension,
+	}
+	for _, choice := range textResponse.Choices {
+		finishReason := choice.FinishReason
+		streamResponse.Choices = append(streamResponse.Choices, openai.ChatCompletionsStreamResponseChoice{
+			Index:        choice.Index,
+			Delta:        choice.Message,
+			FinishReason: &finishReason,
+		})
+	}
+	common.SetEventStreamHeaders(c)
+	err = render.ObjectData(c, streamResponse)
+	if err != nil {
+		return err
+	}
+	render.Done(c)
+	return nil
+}
+
+func writeStreamAsResponse(c *gin.Context, body []byte, usage *relaymodel.Usage) error {
+	textResponse := openai.TextResponse{
+		Object: constant.NonStreamObject,
+	}
+	var choices []*openai.TextResponseChoice
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), len(body)+1)
+	for scanner.Scan() {
+		data := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(data, "data:") {
+			continue
+		}
+		data = strings.TrimSpace(strings.TrimPrefix(data, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+		var streamResponse openai.ChatCompletionsStreamResponse
+		err := json.Unmarshal([]byte(data), &streamResponse)
+		if err != nil {
+			return err
+		}
+		textResponse.Id = streamResponse.Id
+		textResponse.Model = streamResponse.Model
+		textResponse.Created = streamResponse.Created
+		if streamResponse.Usage != nil {
+			textResponse.Usage = *streamResponse.Usage
+		}
+		mergePerplexityExtension(&textResponse.PerplexityExtension, streamResponse.PerplexityExtension)
+		for _, delta := range streamResponse.Choices {
+			for len(choices) <= delta.Index {
+				choices = append(choices, &openai.TextResponseChoice{Index: len(choices)})
+			}
+			mergeStreamDelta(choices[delta.Index], delta)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	for _, choice := range choices {
+		if choice.Role == "" {
+			continue
+		}
+		textResponse.Choices = append(textResponse.Choices, *choice)
+	}
+	if textResponse.Usage.TotalTokens == 0 && usage != nil {
+		// most upstreams only report usage of a stream when asked to, use what the adaptor counted instead
+		textResponse.Usage = *usage
+	}
+	c.JSON(http.StatusOK, textResponse)
+	return nil
+}
+
+func mergeStreamDelta(choice *openai.TextResponseChoice, delta openai.ChatCompletionsStreamResponseChoice) {
+	if delta.Delta.Role != "" {
+		choice.Role = delta.Delta.Role
+	} else if choice.Role == "" {
+		choice.Role = role.Assistant
+	}
+	choice.ReasoningContent += delta.Delta.ReasoningContent
+	if content := conv.AsString(delta.Delta.Content); content != "" {
+		choice.Content = conv.AsString(choice.Content) + content
+	}
+	choice.Images = append(choice.Images, delta.Delta.Images...)
+	for _, toolCall := range delta.Delta.ToolCalls {
+		// a tool call starts with its id, the following deltas only carry more arguments
+		if toolCall.Id != "" || len(choice.ToolCalls) == 0 {
+			choice.ToolCalls = append(choice.ToolCalls, toolCall)
+			continue
+		}
+		last := &choice.ToolCalls[len(choice.ToolCalls)-1]
+		last.Function.Arguments = conv.AsString(last.Function.Arguments) + conv.AsString(toolCall.Function.Arguments)
+	}
+	if delta.FinishReason != nil && *delta.FinishReason != "" {
+		choice.FinishReason = *delta.FinishReason
+	}
+}
+
+// mergePerplexityExtension keeps the latest of each field, every chunk of Perplexity carries all of them so far
+func mergePerplexityExtension(extension *openai.PerplexityExtension, chunk openai.PerplexityExtension) {
+	if len(chunk.Citations) > 0 {
+		extension.Citations = chunk.Citations
+	}
+	if len(chunk.SearchResults) > 0 {
+		extension.SearchResults = chunk.SearchResults
+	}
+	if len(chunk.RelatedQuestions) > 0 {
+		extension.RelatedQuestions = chunk.RelatedQuestions
+	}
+	if len(chunk.Images) > 0 {
+		extension.Images = chunk.Images
+	}
+}
@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/constant/streampolicy"
+)
+
+func TestRelayTextHelperStreamConversion(t *testing.T) {
+	Convey("a stream which can't be converted is billed with the usage reported by upstream", t, func() {
+		useTestDB(t)
+		// the token encoders aren't loaded in the tests
+		oldApproximateTokenEnabled := config.ApproximateTokenEnabled
+		config.ApproximateTokenEnabled = true
+		t.Cleanup(func() {
+			config.ApproximateTokenEnabled = oldApproximateTokenEnabled
+		})
+		token := createTestToken(t, 1, 1000000, 1000000)
+		So(model.DB.Create(&model.Channel{Id: 1, Type: channeltype.OpenAI, Key: "sk-test", Name: "openai"}).Error, ShouldBeNil)
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = w.Write([]byte("data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hi\"}}]}\n\n" +
+				"data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\n\n" +
+				"data: {\"id\":\"chatcmpl-1\",\"choices\":[],\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":20,\"total_tokens\":30}}\n\n" +
+				"data: [DONE]\n\n"))
+		}))
+		defer upstream.Close()
+
+		c, _ := newRelayTestContext(t, "/v1/chat/completions",
+			`{"model":"gpt-4o-mini","max_tokens":4096,"messages":[{"role":"user","content":"hello"}]}`, token, upstream.URL)
+		c.Set(ctxkey.TokenStreamPolicy, streampolicy.Force)
+
+		bizErr := RelayTextHelper(c)
+		So(bizErr, ShouldNotBeNil)
+		So(bizErr.Code, ShouldEqual, "convert_stream_failed")
+		// the pre-consumed quota is settled, it mustn't be returned by the retries
+		So(c.GetInt64(ctxkey.PreConsumedQuota), ShouldEqual, 0)
+
+		ratio := billingratio.GetModelRatio("gpt-4o-mini") * billingratio.GetGroupRatio("default")
+		quota := int64(math.Ceil((10 + 20*billingratio.GetCompletionRatio("gpt-4o-mini")) * ratio))
+		So(waitChannelUsedQuota(t, 1), ShouldEqual, quota)
+		userQuota, remainQuota := getTestBalances(t, token)
+		So(userQuota, ShouldEqual, 1000000-quota)
+		So(remainQuota, ShouldEqual, 1000000-quota)
+	})
+}
+
+func TestPerplexityExtensionConversion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("the citations of Perplexity are kept through the conversions", t, func() {
+		Convey("a stream converted to a response keeps the latest of them", func() {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			body := "data: {\"id\":\"1\",\"model\":\"sonar\",\"citations\":[\"https://a.example\"],\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"Hel\"}}]}\n\n" +
+				"data: {\"id\":\"1\",\"model\":\"sonar\",\"citations\":[\"https://a.example\",\"https://b.example\"],\"related_questions\":[\"why?\"],\"choices\":[{\"index\":0,\"delta\":{\"content\":\"lo\"},\"finish_reason\":\"stop\"}]}\n\n" +
+				"data: [DONE]\n\n"
+			So(writeStreamAsResponse(c, []byte(body), nil), ShouldBeNil)
+			var response openai.TextResponse
+			So(json.Unmarshal(w.Body.Bytes(), &response), ShouldBeNil)
+			So(response.Citations, ShouldResemble, []string{"https://a.example", "https://b.example"})
+			So(response.RelatedQuestions, ShouldResemble, []string{"why?"})
+			So(response.Choices[0].Content, ShouldEqual, "Hello")
+		})
+
+		Convey("a response converted to a stream keeps them", func() {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			So(writeResponseAsStream(c, []byte(`{"id":"1","model":"sonar","citations":["https://a.example"],
+				"choices":[{"index":0,"message":{"role":"assistant","content":"Hello"},"finish_reason":"stop"}]}`)), ShouldBeNil)
+			So(w.Body.String(), ShouldContainSubstring, `"citations":["https://a.example"]`)
+			So(w.Body.String(), ShouldNotContainSubstring, "search_results")
+		})
+
+		Convey("the merged candidates keep them", func() {
+			merged, err := mergeCandidates([][]byte{
+				[]byte(`{"id":"1","model":"sonar","citations":["https://a.example"],"choices":[{"index":0,"message":{"role":"assistant","content":"a"}}]}`),
+				[]byte(`{"id":"2","model":"sonar","citations":["https://b.example"],"choices":[{"index":0,"message":{"role":"assistant","content":"b"}}]}`),
+			})
+			So(err, ShouldBeNil)
+			So(merged.Citations, ShouldResemble, []string{"https://a.example"})
+		})
+	})
+}
@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/render"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	"github.com/songquanpeng/one-api/relay/controller/validator"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// strictResponseWriter checks what's sent to the client against the OpenAI schema. Invalid stream events are
+// dropped, a non-stream response is held back until it's complete, and replaced with an error if invalid.
+type strictResponseWriter struct {
+	gin.ResponseWriter
+	ctx      context.Context
+	isStream *bool // decided by the content type, once it's set
+	pending  render.LineBuffer
+	status   int
+}
+
+func (w *strictResponseWriter) stream() bool {
+	if w.isStream == nil {
+		contentType := w.Header().Get("Content-Type")
+		isStream := strings.HasPrefix(contentType, "text/event-stream")
+		if contentType == "" {
+			return false
+		}
+		w.isStream = &isStream
+	}
+	return *w.isStream
+}
+
+func (w *strictResponseWriter) Write(data []byte) (int, error) {
+	w.pending.Write(data)
+	if !w.stream() {
+		return len(data), nil
+	}
+	err := w.pending.EachLine(func(line []byte) error {
+		if !w.validEvent(line) {
+			return nil
+		}
+		_, err := w.ResponseWriter.Write(line)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (w *strictResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *strictResponseWriter) validEvent(line []byte) bool {
+	payload, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+	payload = bytes.TrimSpace(payload)
+	if !ok || string(payload) == "[DONE]" {
+		return true
+	}
+	err := validator.ValidateChatCompletionChunk(payload)
+	if err == nil {
+		return true
+	}
+	logger.Errorf(w.ctx, "strict mode dropped an invalid stream event: %s, data: %s", err.Error(), truncate(string(payload), 500))
+	return false
+}
+
+func (w *strictResponseWriter) WriteHeader(code int) {
+	if w.stream() {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if code > 0 {
+		w.status = code
+	}
+}
+
+func (w *strictResponseWriter) WriteHeaderNow() {
+	if w.stream() {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *strictResponseWriter) Written() bool {
+	if w.stream() {
+		return w.ResponseWriter.Written()
+	}
+	return false
+}
+
+func (w *strictResponseWriter) Status() int {
+	if w.stream() {
+		return w.ResponseWriter.Status()
+	}
+	return w.status
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// finish writes the held back response, it must be called after the writer of the context is restored
+func (w *strictResponseWriter) finish() *relaymodel.ErrorWithStatusCode {
+	if w.stream() {
+		if w.pending.Len() > 0 && w.validEvent(w.pending.Bytes()) {
+			_, _ = w.ResponseWriter.Write(w.pending.Bytes())
+		}
+		return nil
+	}
+	if w.pending.Len() == 0 {
+		return nil
+	}
+	if w.status == http.StatusOK {
+		err := validator.ValidateChatCompletion(w.pending.Bytes())
+		if err != nil {
+			logger.Errorf(w.ctx, "strict mode rejected an invalid response: %s, data: %s", err.Error(), truncate(w.pending.String(), 500))
+			w.Header().Del("Content-Length")
+			return openai.ErrorWrapper(fmt.Errorf("the response converted from upstream is invalid: %s", err.Error()), "invalid_converted_response", http.StatusInternalServerError)
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	_, _ = w.ResponseWriter.Write(w.pending.Bytes())
+	return nil
+}
+
+// validateConvertedResponse is the strict mode, only the chat completions converted from other APIs are checked,
+// the returned function restores the writer of the context and writes the response
+func validateConvertedResponse(c *gin.Context, meta *meta.Meta) func() *relaymodel.ErrorWithStatusCode {
+	if !config.StrictResponseValidationEnabled || meta.Mode != relaymode.ChatCompletions || meta.APIType == apitype.OpenAI {
+		return func() *relaymodel.ErrorWithStatusCode { return nil }
+	}
+	writer := &strictResponseWriter{ResponseWriter: c.Writer, ctx: c.Request.Context(), status: http.StatusOK}
+	c.Writer = writer
+	return func() *relaymodel.ErrorWithStatusCode {
+		c.Writer = writer.ResponseWriter
+		return writer.finish()
+	}
+}
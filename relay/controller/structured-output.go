@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	"github.com/songquanpeng/one-api/relay/controller/validator"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// supportsResponseFormat reports whether the channel takes the type of response_format, the OpenAI compatible ones
+// get it as is, the Gemini ones get it converted, other adaptors would drop it silently
+func supportsResponseFormat(meta *meta.Meta, responseFormatType string) bool {
+	switch meta.APIType {
+	case apitype.OpenAI, apitype.Gemini:
+		return true
+	case apitype.VertexAI:
+		return strings.HasPrefix(meta.ActualModelName, "gemini")
+	case apitype.AI21:
+		return responseFormatType == "json_object"
+	}
+	return false
+}
+
+// validateResponseFormat rejects the structured outputs the channel can't produce, and the json_schema without a schema
+func validateResponseFormat(textRequest *relaymodel.GeneralOpenAIRequest, meta *meta.Meta) *relaymodel.ErrorWithStatusCode {
+	if meta.Mode != relaymode.ChatCompletions || textRequest.ResponseFormat == nil {
+		return nil
+	}
+	responseFormat := textRequest.ResponseFormat
+	if responseFormat.Type != "json_object" && responseFormat.Type != "json_schema" {
+		return nil
+	}
+	var message string
+	if responseFormat.Type == "json_schema" && (responseFormat.JsonSchema == nil || responseFormat.JsonSchema.Name == "") {
+		message = "'response_format.json_schema.name' is required when 'response_format' is of type 'json_schema'."
+	} else if !supportsResponseFormat(meta, responseFormat.Type) {
+		message = fmt.Sprintf("The channel of model %s does not support 'response_format' of type '%s'.", meta.OriginModelName, responseFormat.Type)
+	} else {
+		return nil
+	}
+	return &relaymodel.ErrorWithStatusCode{
+		Error: relaymodel.Error{
+			Message: message,
+			Type:    "invalid_request_error",
+			Param:   "response_format",
+			Code:    "unsupported_response_format",
+		},
+		StatusCode: http.StatusBadRequest,
+	}
+}
+
+// structuredOutputWriter holds back the non-stream response until it's complete, so that it can be replaced with an error
+type structuredOutputWriter struct {
+	gin.ResponseWriter
+	ctx     context.Context
+	schema  map[string]any
+	pending bytes.Buffer
+	status  int
+}
+
+func (w *structuredOutputWriter) Write(data []byte) (int, error) {
+	return w.pending.Write(data)
+}
+
+func (w *structuredOutputWriter) WriteString(s string) (int, error) {
+	return w.pending.WriteString(s)
+}
+
+func (w *structuredOutputWriter) WriteHeader(code int) {
+	if code > 0 {
+		w.status = code
+	}
+}
+
+func (w *structuredOutputWriter) WriteHeaderNow() {}
+
+func (w *structuredOutputWriter) Written() bool {
+	return false
+}
+
+func (w *structuredOutputWriter) Status() int {
+	return w.status
+}
+
+// finish writes the held back response, it must be called after the writer of the context is restored
+func (w *structuredOutputWriter) finish() *relaymodel.ErrorWithStatusCode {
+	if w.pending.Len() == 0 {
+		return nil
+	}
+	if w.status == http.StatusOK {
+		err := validator.ValidateStructuredOutput(w.pending.Bytes(), w.schema)
+		if err != nil {
+			logger.Errorf(w.ctx, "structured output doesn't match the schema: %s, data: %s", err.Error(), truncate(w.pending.String(), 500))
+			w.Header().Del("Content-Length")
+			return openai.ErrorWrapper(fmt.Errorf("the response of upstream doesn't match the json_schema: %s", err.Error()), "invalid_structured_output", http.StatusInternalServerError)
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	_, _ = w.ResponseWriter.Write(w.pending.Bytes())
+	return nil
+}
+
+// validateStructuredOutput checks the response sent to the client against the json_schema of the request if enabled,
+// streams are relayed as they are received, so only the non-stream responses are checked.
+// The returned function restores the writer of the context and writes the response.
+func validateStructuredOutput(c *gin.Context, meta *meta.Meta, textRequest *relaymodel.GeneralOpenAIRequest, streamConversion int) func() *relaymodel.ErrorWithStatusCode {
+	// the stream of the upstream is converted for the client, or the other way around
+	isClientStream := meta.IsStream != (streamConversion != streamConversionNone)
+	responseFormat := textRequest.ResponseFormat
+	if !config.StructuredOutputValidationEnabled || meta.Mode != relaymode.ChatCompletions || isClientStream ||
+		responseFormat == nil || responseFormat.JsonSchema == nil || len(responseFormat.JsonSchema.Schema) == 0 {
+		return func() *relaymodel.ErrorWithStatusCode { return nil }
+	}
+	writer := &structuredOutputWriter{ResponseWriter: c.Writer, ctx: c.Request.Context(), schema: responseFormat.JsonSchema.Schema, status: http.StatusOK}
+	c.Writer = writer
+	return func() *relaymodel.ErrorWithStatusCode {
+		c.Writer = writer.ResponseWriter
+		return writer.finish()
+	}
+}
@@ -5,15 +5,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/monitor"
 	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/relay/apitype"
-	"github.com/songquanpeng/one-api/relay/billing"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
 	"io"
 	"net/http"
 )
@@ -22,26 +25,73 @@ func RelayTextHelper(c *gin.Context) *model.ErrorWithStatusCode {
 	ctx := c.Request.Context()
 	meta := meta.GetByContext(c)
 	// get & validate textRequest
-	textRequest, err := getAndValidateTextRequest(c, meta.Mode)
-	if err != nil {
-		logger.Errorf(ctx, "getAndValidateTextRequest failed: %s", err.Error())
-		return openai.ErrorWrapper(err, "invalid_text_request", http.StatusBadRequest)
+	textRequest, isPassthrough := getPassthroughTextRequest(c, meta)
+	if !isPassthrough {
+		var err error
+		textRequest, err = getAndValidateTextRequest(c, meta.Mode)
+		if err != nil {
+			logger.Errorf(ctx, "getAndValidateTextRequest failed: %s", err.Error())
+			return openai.ErrorWrapper(err, "invalid_text_request", http.StatusBadRequest)
+		}
 	}
 	meta.IsStream = textRequest.Stream
+	streamConversion := applyStreamPolicy(c, meta, textRequest)
 
 	// map model name
 	var isModelMapped bool
 	meta.OriginModelName = textRequest.Model
 	textRequest.Model, isModelMapped = getMappedModelName(textRequest.Model, meta.ModelMapping)
 	meta.ActualModelName = textRequest.Model
+	candidates, bizErr := applyCandidateEmulation(textRequest, meta, &streamConversion)
+	if bizErr != nil {
+		logger.Warnf(ctx, "applyCandidateEmulation failed: %s", bizErr.Message)
+		return bizErr
+	}
 	// get model ratio & group ratio
 	modelRatio := billingratio.GetModelRatio(textRequest.Model)
 	groupRatio := billingratio.GetGroupRatio(meta.Group)
 	ratio := modelRatio * groupRatio
 	// pre-consume quota
-	promptTokens := getPromptTokens(textRequest, meta.Mode)
+	var promptTokens int
+	var isImageReplaced bool
+	var isMaxTokensCapped bool
+	if isPassthrough {
+		promptTokens = estimatePromptTokens(c)
+		if bizErr := validatePassthroughRequest(c, textRequest, meta); bizErr != nil {
+			logger.Warnf(ctx, "validatePassthroughRequest failed: %s", bizErr.Message)
+			return bizErr
+		}
+	} else {
+		// images are downscaled first, so that the tokens of the relayed images are counted
+		if meta.Mode == relaymode.ChatCompletions {
+			isImageReplaced, bizErr = processInlineImages(textRequest, meta)
+			if bizErr != nil {
+				logger.Warnf(ctx, "processInlineImages failed: %s", bizErr.Message)
+				return bizErr
+			}
+		}
+		promptTokens = getPromptTokens(textRequest, meta.Mode)
+		if bizErr := validateContextWindow(textRequest, promptTokens, meta); bizErr != nil {
+			logger.Warnf(ctx, "validateContextWindow failed: %s", bizErr.Message)
+			return bizErr
+		}
+		if bizErr := validateModelCapabilities(textRequest, hasImageContent(textRequest.Messages), meta); bizErr != nil {
+			logger.Warnf(ctx, "validateModelCapabilities failed: %s", bizErr.Message)
+			return bizErr
+		}
+		if bizErr := validateResponseFormat(textRequest, meta); bizErr != nil {
+			logger.Warnf(ctx, "validateResponseFormat failed: %s", bizErr.Message)
+			return bizErr
+		}
+		isMaxTokensCapped = applySandboxMaxTokens(textRequest, meta)
+	}
 	meta.PromptTokens = promptTokens
-	preConsumedQuota, bizErr := preConsumeQuota(ctx, textRequest, promptTokens, ratio, meta)
+	if bizErr := reserveChannelThroughput(meta, promptTokens); bizErr != nil {
+		logger.Warnf(ctx, "channel #%d is rate limited", meta.ChannelId)
+		return bizErr
+	}
+	// every emulated candidate is sent the whole prompt
+	preConsumedQuota, bizErr := getOrPreConsumeQuota(c, textRequest, promptTokens*candidates, ratio, meta)
 	if bizErr != nil {
 		logger.Warnf(ctx, "preConsumeQuota failed: %+v", *bizErr)
 		return bizErr
@@ -54,30 +104,30 @@ func RelayTextHelper(c *gin.Context) *model.ErrorWithStatusCode {
 	adaptor.Init(meta)
 
 	// get request body
-	var requestBody io.Reader
-	if meta.APIType == apitype.OpenAI {
-		// no need to convert request for openai
-		shouldResetRequestBody := isModelMapped || meta.ChannelType == channeltype.Baichuan // frequency_penalty 0 is not acceptable for baichuan
-		if shouldResetRequestBody {
-			jsonStr, err := json.Marshal(textRequest)
-			if err != nil {
-				return openai.ErrorWrapper(err, "json_marshal_failed", http.StatusInternalServerError)
-			}
-			requestBody = bytes.NewBuffer(jsonStr)
-		} else {
-			requestBody = c.Request.Body
-		}
-	} else {
-		convertedRequest, err := adaptor.ConvertRequest(c, meta.Mode, textRequest)
-		if err != nil {
-			return openai.ErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
+	isModified := isModelMapped || streamConversion != streamConversionNone || isImageReplaced || isMaxTokensCapped || candidates > 1
+	requestBody, bizErr := getRequestBody(c, meta, adaptor, textRequest, isModified)
+	if bizErr != nil {
+		return bizErr
+	}
+
+	if candidates > 1 {
+		usage, respErr := relayCandidates(c, meta, textRequest, requestBody, candidates, streamConversion)
+		if respErr != nil {
+			logger.Errorf(ctx, "relayCandidates failed: %+v", respErr)
+			return respErr
 		}
-		jsonData, err := json.Marshal(convertedRequest)
-		if err != nil {
-			return openai.ErrorWrapper(err, "json_marshal_failed", http.StatusInternalServerError)
+		go postConsumeQuota(ctx, usage, meta, textRequest, ratio, preConsumedQuota, modelRatio, groupRatio, c.GetString("channel_name"))
+		return nil
+	}
+
+	if batches := getEmbeddingBatches(textRequest, meta); batches != nil {
+		usage, respErr := relayEmbeddingBatches(c, meta, textRequest, batches)
+		if respErr != nil {
+			logger.Errorf(ctx, "relayEmbeddingBatches failed: %+v", respErr)
+			return respErr
 		}
-		logger.Debugf(ctx, "converted request: \n%s", string(jsonData))
-		requestBody = bytes.NewBuffer(jsonData)
+		go postConsumeQuota(ctx, usage, meta, textRequest, ratio, preConsumedQuota, modelRatio, groupRatio, c.GetString("channel_name"))
+		return nil
 	}
 
 	// do request
@@ -87,19 +137,102 @@ func RelayTextHelper(c *gin.Context) *model.ErrorWithStatusCode {
 		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
 	}
 	if isErrorHappened(meta, resp) {
-		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
 		return RelayErrorHandler(resp)
 	}
 
 	// do response
+	finishChatImages := relayChatImages(c, meta, streamConversion)
+	finishTrace := appendStreamTrace(c, meta, streamConversion)
+	finishWatermark := appendSandboxWatermark(c, meta, textRequest, streamConversion)
+	restoreWriter := captureFinishReason(c, meta)
+	finishValidation := validateConvertedResponse(c, meta)
+	finishStructuredOutput := validateStructuredOutput(c, meta, textRequest, streamConversion)
+	var bufferedWriter *bufferedResponseWriter
+	if streamConversion != streamConversionNone {
+		bufferedWriter = newBufferedResponseWriter(c.Writer)
+		c.Writer = bufferedWriter
+	}
+	if meta.IsStream {
+		monitor.StreamStarted()
+		defer monitor.StreamFinished()
+	}
 	usage, respErr := adaptor.DoResponse(c, resp, meta)
+	var isConversionFailed bool
+	if bufferedWriter != nil {
+		c.Writer = bufferedWriter.ResponseWriter
+		if respErr == nil {
+			err = writeConvertedResponse(c, bufferedWriter, streamConversion, usage)
+			if err != nil {
+				isConversionFailed = true
+				respErr = openai.ErrorWrapper(err, "convert_stream_failed", http.StatusInternalServerError)
+			}
+		}
+	}
+	if validationErr := finishStructuredOutput(); respErr == nil {
+		respErr = validationErr
+	}
+	if validationErr := finishValidation(); respErr == nil {
+		respErr = validationErr
+	}
+	restoreWriter()
+	finishWatermark()
+	finishTrace()
+	outputImages := finishChatImages()
+	if usage != nil {
+		usage.OutputImages = outputImages
+	}
+	channelName := c.GetString("channel_name")
 	if respErr != nil {
 		logger.Errorf(ctx, "respErr is not nil: %+v", respErr)
-		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		// the upstream has served the request and billed it, only the conversion failed, or the request was killed
+		// by an admin or given up by the client in the middle of the response, so the usage so far is billed to
+		// the user as well, and the pre-consumed quota is settled instead of being returned
+		if usage != nil && (isConversionFailed || ctx.Err() != nil) {
+			go postConsumeQuota(ctx, usage, meta, textRequest, ratio, preConsumedQuota, modelRatio, groupRatio, channelName)
+			c.Set(ctxkey.PreConsumedQuota, int64(0))
+		}
 		return respErr
 	}
-	channelName := c.GetString("channel_name")
 	// post-consume quota
 	go postConsumeQuota(ctx, usage, meta, textRequest, ratio, preConsumedQuota, modelRatio, groupRatio, channelName)
 	return nil
 }
+
+// getRequestBody converts the request to the body of the upstream,
+// the body of the OpenAI compatible channels is relayed as is unless the request is modified
+func getRequestBody(c *gin.Context, meta *meta.Meta, a adaptor.Adaptor, textRequest *model.GeneralOpenAIRequest, isModified bool) (io.Reader, *model.ErrorWithStatusCode) {
+	if meta.APIType == apitype.OpenAI {
+		isModified = prepareOpenAIRequest(c, meta, textRequest) || isModified
+		if !isModified {
+			return c.Request.Body, nil
+		}
+	}
+	convertedRequest, err := a.ConvertRequest(c, meta.Mode, textRequest)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
+	}
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "json_marshal_failed", http.StatusInternalServerError)
+	}
+	logger.Debugf(c.Request.Context(), "converted request: \n%s", string(jsonData))
+	return bytes.NewBuffer(jsonData), nil
+}
+
+// prepareOpenAIRequest adjusts the request to the OpenAI compatible channel, and reports whether it is modified
+func prepareOpenAIRequest(c *gin.Context, meta *meta.Meta, textRequest *model.GeneralOpenAIRequest) bool {
+	isReasoningStripped := meta.ChannelType == channeltype.DeepSeek && stripReasoningContent(textRequest.Messages)
+	isOpenRouter := meta.ChannelType == channeltype.OpenRouter
+	if isOpenRouter {
+		openai.ConvertOpenRouterRequest(textRequest, meta)
+	}
+	// another one-api only sends the usage of a stream when asked to
+	isUsageRequested := meta.ChannelType == channeltype.OneAPI && textRequest.Stream && textRequest.StreamOptions == nil
+	if isUsageRequested {
+		textRequest.StreamOptions = &model.StreamOptions{IncludeUsage: true}
+		c.Set(ctxkey.HideUsageChunk, true)
+	}
+	return isReasoningStripped || isOpenRouter || isUsageRequested ||
+		meta.ChannelType == channeltype.Baichuan || // frequency_penalty 0 is not acceptable for baichuan
+		meta.ChannelType == channeltype.Cerebras // the penalties are dropped by the adaptor
+}
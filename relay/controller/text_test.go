@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+func TestRelayTextHelperReasoningContent(t *testing.T) {
+	Convey("the reasoning of deepseek-reasoner is relayed but not sent back to it", t, func() {
+		useTestDB(t)
+		// the token encoders aren't loaded in the tests
+		oldApproximateTokenEnabled := config.ApproximateTokenEnabled
+		config.ApproximateTokenEnabled = true
+		t.Cleanup(func() {
+			config.ApproximateTokenEnabled = oldApproximateTokenEnabled
+		})
+		token := createTestToken(t, 1, 1000000, 1000000)
+		So(model.DB.Create(&model.Channel{Id: 1, Type: channeltype.DeepSeek, Key: "sk-test", Name: "deepseek"}).Error, ShouldBeNil)
+		var upstreamBody []byte
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			upstreamBody, _ = io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","created":1700000000,"model":"deepseek-reasoner",
+				"choices":[{"index":0,"message":{"role":"assistant","content":"4","reasoning_content":"2+2=4"},"finish_reason":"stop"}],
+				"usage":{"prompt_tokens":10,"completion_tokens":20,"total_tokens":30}}`))
+		}))
+		defer upstream.Close()
+
+		c, w := newRelayTestContext(t, "/v1/chat/completions", `{"model":"deepseek-reasoner","messages":[{"role":"user","content":"1+1?"},
+			{"role":"assistant","content":"2","reasoning_content":"1+1=2"},{"role":"user","content":"2+2?"}]}`, token, upstream.URL)
+		c.Set(ctxkey.Channel, channeltype.DeepSeek)
+
+		So(RelayTextHelper(c), ShouldBeNil)
+		var request struct {
+			Messages []map[string]any `json:"messages"`
+		}
+		So(json.Unmarshal(upstreamBody, &request), ShouldBeNil)
+		So(request.Messages, ShouldHaveLength, 3)
+		So(request.Messages[1], ShouldNotContainKey, "reasoning_content")
+		So(w.Body.String(), ShouldContainSubstring, `"reasoning_content":"2+2=4"`)
+
+		So(waitChannelUsedQuota(t, 1), ShouldBeGreaterThan, 0)
+	})
+}
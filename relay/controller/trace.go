@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/render"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/meta"
+)
+
+// StreamTrace identifies the token and the channel serving a stream without revealing them, it's the same for all
+// their streams, so that a leaked completion can be traced back to the credential by the admin
+func StreamTrace(tokenId int, channelId int) string {
+	return helper.Sign(config.StreamTraceSecret, fmt.Sprintf("trace:%d:%d", tokenId, channelId))[:16]
+}
+
+// traceWriter writes the trace as an SSE comment before the last event of a stream, the clients ignore the comments,
+// the events are passed through line by line
+type traceWriter struct {
+	gin.ResponseWriter
+	trace   string
+	pending render.LineBuffer
+}
+
+func (w *traceWriter) Write(data []byte) (int, error) {
+	w.pending.Write(data)
+	err := w.pending.EachLine(func(line []byte) error {
+		if payload, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:")); ok && string(bytes.TrimSpace(payload)) == "[DONE]" {
+			_, err := w.ResponseWriter.Write([]byte(": trace=" + w.trace + "\n"))
+			if err != nil {
+				return err
+			}
+		}
+		_, err := w.ResponseWriter.Write(line)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (w *traceWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// appendStreamTrace traces the streams if StreamTraceEnabled, the returned function restores the writer of the context
+func appendStreamTrace(c *gin.Context, meta *meta.Meta, streamConversion int) func() {
+	// the stream of the upstream is converted for the client, or the other way around
+	if !config.StreamTraceEnabled || meta.IsStream == (streamConversion != streamConversionNone) {
+		return func() {}
+	}
+	trace := StreamTrace(meta.TokenId, meta.ChannelId)
+	err := model.SaveStreamTrace(trace, meta.TokenId, meta.ChannelId)
+	if err != nil {
+		// the stream isn't traced rather than sending a trace which can't be looked up
+		logger.Errorf(c, "failed to save the stream trace: %s", err.Error())
+		return func() {}
+	}
+	writer := &traceWriter{
+		ResponseWriter: c.Writer,
+		trace:          trace,
+	}
+	c.Writer = writer
+	return func() {
+		c.Writer = writer.ResponseWriter
+		if writer.pending.Len() > 0 {
+			_, _ = writer.ResponseWriter.Write(writer.pending.Bytes())
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// the fields OpenAI SDKs rely on, a response converted from another API must have them in the right types
+
+func field(object map[string]any, path string, name string) (any, string) {
+	if path == "" {
+		return object[name], name
+	}
+	return object[name], path + "." + name
+}
+
+func requireObject(value any, path string) (map[string]any, error) {
+	object, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s should be an object", path)
+	}
+	return object, nil
+}
+
+func requireString(object map[string]any, path string, name string) error {
+	value, path := field(object, path, name)
+	if _, ok := value.(string); !ok {
+		return fmt.Errorf("%s should be a string", path)
+	}
+	return nil
+}
+
+func optionalString(object map[string]any, path string, name string) error {
+	value, path := field(object, path, name)
+	if _, ok := value.(string); !ok && value != nil {
+		return fmt.Errorf("%s should be a string or null", path)
+	}
+	return nil
+}
+
+func requireInteger(object map[string]any, path string, name string) error {
+	value, path := field(object, path, name)
+	number, ok := value.(float64)
+	if !ok || number != float64(int64(number)) {
+		return fmt.Errorf("%s should be an integer", path)
+	}
+	return nil
+}
+
+func requireArray(object map[string]any, path string, name string) ([]any, error) {
+	value, path := field(object, path, name)
+	array, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s should be an array", path)
+	}
+	return array, nil
+}
+
+func validateCommon(response map[string]any, object string) error {
+	if response["object"] != object {
+		return fmt.Errorf("object should be %q", object)
+	}
+	for _, name := range []string{"id", "model"} {
+		if err := requireString(response, "", name); err != nil {
+			return err
+		}
+	}
+	if err := requireInteger(response, "", "created"); err != nil {
+		return err
+	}
+	if response["usage"] == nil {
+		return nil
+	}
+	usage, err := requireObject(response["usage"], "usage")
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{"prompt_tokens", "completion_tokens", "total_tokens"} {
+		if err := requireInteger(usage, "usage", name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateContent(message map[string]any, path string) error {
+	switch message["content"].(type) {
+	case nil, string, []any:
+		return nil
+	}
+	return fmt.Errorf("%s.content should be a string, an array or null", path)
+}
+
+func validateToolCalls(message map[string]any, path string, isDelta bool) error {
+	if message["tool_calls"] == nil {
+		return nil
+	}
+	toolCalls, err := requireArray(message, path, "tool_calls")
+	if err != nil {
+		return err
+	}
+	for i, value := range toolCalls {
+		toolCallPath := fmt.Sprintf("%s.tool_calls[%d]", path, i)
+		toolCall, err := requireObject(value, toolCallPath)
+		if err != nil {
+			return err
+		}
+		if isDelta {
+			// only the first delta of a tool call has the id and the name
+			if err := requireInteger(toolCall, toolCallPath, "index"); err != nil {
+				return err
+			}
+			if toolCall["function"] == nil {
+				continue
+			}
+		} else {
+			if err := requireString(toolCall, toolCallPath, "id"); err != nil {
+				return err
+			}
+			if toolCall["type"] != "function" {
+				return fmt.Errorf("%s.type should be \"function\"", toolCallPath)
+			}
+		}
+		function, err := requireObject(toolCall["function"], toolCallPath+".function")
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"name", "arguments"} {
+			check := requireString
+			if isDelta {
+				check = optionalString
+			}
+			if err := check(function, toolCallPath+".function", name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateChatCompletion checks a non-stream response of the chat completions API
+func ValidateChatCompletion(data []byte) error {
+	return validateChatCompletion(data, "chat.completion", "message")
+}
+
+// ValidateChatCompletionChunk checks the data of an event of a chat completions stream
+func ValidateChatCompletionChunk(data []byte) error {
+	return validateChatCompletion(data, "chat.completion.chunk", "delta")
+}
+
+func validateChatCompletion(data []byte, object string, messageField string) error {
+	var response map[string]any
+	if err := json.Unmarshal(data, &response); err != nil {
+		return fmt.Errorf("invalid json: %s", err.Error())
+	}
+	if err := validateCommon(response, object); err != nil {
+		return err
+	}
+	choices, err := requireArray(response, "", "choices")
+	if err != nil {
+		return err
+	}
+	isDelta := messageField == "delta"
+	for i, value := range choices {
+		path := fmt.Sprintf("choices[%d]", i)
+		choice, err := requireObject(value, path)
+		if err != nil {
+			return err
+		}
+		if err := requireInteger(choice, path, "index"); err != nil {
+			return err
+		}
+		if err := optionalString(choice, path, "finish_reason"); err != nil {
+			return err
+		}
+		message, err := requireObject(choice[messageField], path+"."+messageField)
+		if err != nil {
+			return err
+		}
+		role := requireString
+		if isDelta {
+			role = optionalString
+		}
+		if err := role(message, path+"."+messageField, "role"); err != nil {
+			return err
+		}
+		if err := validateContent(message, path+"."+messageField); err != nil {
+			return err
+		}
+		if err := optionalString(message, path+"."+messageField, "reasoning_content"); err != nil {
+			return err
+		}
+		if err := validateToolCalls(message, path+"."+messageField, isDelta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
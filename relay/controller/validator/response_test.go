@@ -0,0 +1,31 @@
+package validator
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestValidateChatCompletion(t *testing.T) {
+	Convey("ValidateChatCompletion", t, func() {
+		So(ValidateChatCompletion([]byte(`{"id":"chatcmpl-1","object":"chat.completion","created":1700000000,"model":"claude-3-haiku",
+			"choices":[{"index":0,"message":{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"f","arguments":"{}"}}]},"finish_reason":"tool_calls"}],
+			"usage":{"prompt_tokens":1,"completion_tokens":2,"total_tokens":3}}`)), ShouldBeNil)
+		So(ValidateChatCompletion([]byte(`{"id":"chatcmpl-1","object":"chat.completion","created":1700000000,
+			"choices":[]}`)), ShouldBeError, "model should be a string")
+		So(ValidateChatCompletion([]byte(`{"id":"chatcmpl-1","object":"chat.completion","created":1700000000,"model":"m",
+			"choices":[{"index":0,"message":{"content":"hi"},"finish_reason":"stop"}]}`)), ShouldBeError, "choices[0].message.role should be a string")
+		So(ValidateChatCompletion([]byte(`{"id":"chatcmpl-1","object":"chat.completion","created":1700000000,"model":"deepseek-reasoner",
+			"choices":[{"index":0,"message":{"role":"assistant","content":"2","reasoning_content":"1+1=2"},"finish_reason":"stop"}]}`)), ShouldBeNil)
+		So(ValidateChatCompletion([]byte(`{"id":"chatcmpl-1","object":"chat.completion","created":1700000000,"model":"deepseek-reasoner",
+			"choices":[{"index":0,"message":{"role":"assistant","content":"2","reasoning_content":2},"finish_reason":"stop"}]}`)), ShouldBeError, "choices[0].message.reasoning_content should be a string or null")
+	})
+
+	Convey("ValidateChatCompletionChunk", t, func() {
+		So(ValidateChatCompletionChunk([]byte(`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1700000000,"model":"m",
+			"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"a\""}}]}}]}`)), ShouldBeNil)
+		So(ValidateChatCompletionChunk([]byte(`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1700000000,"model":"m",
+			"choices":[{"index":0,"delta":{"content":"hi"},"finish_reason":1}]}`)), ShouldBeError, "choices[0].finish_reason should be a string or null")
+		So(ValidateChatCompletionChunk([]byte(`{"id":"chatcmpl-1"`)), ShouldNotBeNil)
+	})
+}
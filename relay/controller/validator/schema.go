@@ -0,0 +1,262 @@
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// the subset of JSON Schema which the structured outputs of OpenAI support, unknown keywords are ignored
+
+// ValidateStructuredOutput checks the content of every choice of the chat completion against the schema
+func ValidateStructuredOutput(data []byte, schema map[string]any) error {
+	var response struct {
+		Choices []struct {
+			Message struct {
+				Content *string `json:"content"`
+				Refusal *string `json:"refusal"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+	}
+	err := json.Unmarshal(data, &response)
+	if err != nil {
+		return err
+	}
+	for i, choice := range response.Choices {
+		// a refusal or a truncated response is not supposed to match the schema
+		if choice.Message.Content == nil || choice.Message.Refusal != nil || choice.FinishReason == "length" {
+			continue
+		}
+		var value any
+		err = json.Unmarshal([]byte(*choice.Message.Content), &value)
+		if err != nil {
+			return fmt.Errorf("choices[%d].message.content is not valid JSON: %s", i, err.Error())
+		}
+		err = ValidateJSONSchema(value, schema)
+		if err != nil {
+			return fmt.Errorf("choices[%d].message.content: %s", i, err.Error())
+		}
+	}
+	return nil
+}
+
+// ValidateJSONSchema checks the value decoded by encoding/json against the schema
+func ValidateJSONSchema(value any, schema map[string]any) error {
+	return validateSchema(value, schema, schema, "$")
+}
+
+func validateSchema(value any, schema map[string]any, root map[string]any, path string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved, err := resolveRef(ref, root)
+		if err != nil {
+			return err
+		}
+		return validateSchema(value, resolved, root, path)
+	}
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		var errs []string
+		for _, item := range anyOf {
+			subSchema, _ := item.(map[string]any)
+			err := validateSchema(value, subSchema, root, path)
+			if err == nil {
+				errs = nil
+				break
+			}
+			errs = append(errs, err.Error())
+		}
+		if len(errs) != 0 {
+			return fmt.Errorf("%s should match any of the schemas: %s", path, strings.Join(errs, "; "))
+		}
+	}
+	if constValue, ok := schema["const"]; ok && !jsonEqual(value, constValue) {
+		return fmt.Errorf("%s should be %v", path, constValue)
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		matched := false
+		for _, item := range enum {
+			if jsonEqual(value, item) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s should be one of %v", path, enum)
+		}
+	}
+	if schemaType, ok := schema["type"]; ok && !matchType(value, schemaType) {
+		return fmt.Errorf("%s should be of type %v", path, schemaType)
+	}
+	switch value := value.(type) {
+	case map[string]any:
+		return validateObject(value, schema, root, path)
+	case []any:
+		return validateArray(value, schema, root, path)
+	case string:
+		return validateString(value, schema, path)
+	case float64:
+		return validateNumber(value, schema, path)
+	}
+	return nil
+}
+
+func validateObject(object map[string]any, schema map[string]any, root map[string]any, path string) error {
+	if required, ok := schema["required"].([]any); ok {
+		for _, name := range required {
+			name, _ := name.(string)
+			if _, ok := object[name]; !ok {
+				return fmt.Errorf("%s.%s is required", path, name)
+			}
+		}
+	}
+	properties, _ := schema["properties"].(map[string]any)
+	for name, item := range object {
+		if propertySchema, ok := properties[name].(map[string]any); ok {
+			err := validateSchema(item, propertySchema, root, path+"."+name)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				return fmt.Errorf("%s.%s is not allowed", path, name)
+			}
+		case map[string]any:
+			err := validateSchema(item, additional, root, path+"."+name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateArray(array []any, schema map[string]any, root map[string]any, path string) error {
+	if minItems, ok := schema["minItems"].(float64); ok && float64(len(array)) < minItems {
+		return fmt.Errorf("%s should have at least %v items", path, minItems)
+	}
+	if maxItems, ok := schema["maxItems"].(float64); ok && float64(len(array)) > maxItems {
+		return fmt.Errorf("%s should have at most %v items", path, maxItems)
+	}
+	items, ok := schema["items"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	for i, item := range array {
+		err := validateSchema(item, items, root, fmt.Sprintf("%s[%d]", path, i))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateString(s string, schema map[string]any, path string) error {
+	length := float64(utf8.RuneCountInString(s))
+	if minLength, ok := schema["minLength"].(float64); ok && length < minLength {
+		return fmt.Errorf("%s should be at least %v characters", path, minLength)
+	}
+	if maxLength, ok := schema["maxLength"].(float64); ok && length > maxLength {
+		return fmt.Errorf("%s should be at most %v characters", path, maxLength)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		// patterns Go can't compile are not validated
+		if err == nil && !re.MatchString(s) {
+			return fmt.Errorf("%s should match the pattern %s", path, pattern)
+		}
+	}
+	return nil
+}
+
+func validateNumber(number float64, schema map[string]any, path string) error {
+	if minimum, ok := schema["minimum"].(float64); ok && number < minimum {
+		return fmt.Errorf("%s should be at least %v", path, minimum)
+	}
+	if maximum, ok := schema["maximum"].(float64); ok && number > maximum {
+		return fmt.Errorf("%s should be at most %v", path, maximum)
+	}
+	if minimum, ok := schema["exclusiveMinimum"].(float64); ok && number <= minimum {
+		return fmt.Errorf("%s should be greater than %v", path, minimum)
+	}
+	if maximum, ok := schema["exclusiveMaximum"].(float64); ok && number >= maximum {
+		return fmt.Errorf("%s should be less than %v", path, maximum)
+	}
+	return nil
+}
+
+// matchType supports both a single type and a list of types, like ["string", "null"]
+func matchType(value any, schemaType any) bool {
+	switch schemaType := schemaType.(type) {
+	case string:
+		return matchSingleType(value, schemaType)
+	case []any:
+		for _, item := range schemaType {
+			if name, ok := item.(string); ok && matchSingleType(value, name) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchSingleType(value any, schemaType string) bool {
+	switch schemaType {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == float64(int64(number))
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return true
+}
+
+// resolveRef only resolves the references within the schema, like #/$defs/item
+func resolveRef(ref string, root map[string]any) (map[string]any, error) {
+	if ref == "#" {
+		return root, nil
+	}
+	path, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return nil, fmt.Errorf("unsupported $ref: %s", ref)
+	}
+	var current any = root
+	for _, name := range strings.Split(path, "/") {
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("invalid $ref: %s", ref)
+		}
+		current = object[strings.ReplaceAll(strings.ReplaceAll(name, "~1", "/"), "~0", "~")]
+	}
+	schema, ok := current.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid $ref: %s", ref)
+	}
+	return schema, nil
+}
+
+func jsonEqual(a any, b any) bool {
+	jsonA, errA := json.Marshal(a)
+	jsonB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(jsonA) == string(jsonB)
+}
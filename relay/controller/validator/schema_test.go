@@ -0,0 +1,46 @@
+package validator
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestValidateJSONSchema(t *testing.T) {
+	var schema map[string]any
+	_ = json.Unmarshal([]byte(`{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string"},
+			"age": {"type": ["integer", "null"], "minimum": 0},
+			"tags": {"type": "array", "items": {"$ref": "#/$defs/tag"}}
+		},
+		"required": ["name", "age"],
+		"additionalProperties": false,
+		"$defs": {"tag": {"type": "string", "enum": ["a", "b"]}}
+	}`), &schema)
+
+	validate := func(data string) error {
+		var value any
+		_ = json.Unmarshal([]byte(data), &value)
+		return ValidateJSONSchema(value, schema)
+	}
+
+	Convey("ValidateJSONSchema", t, func() {
+		So(validate(`{"name":"x","age":3,"tags":["a","b"]}`), ShouldBeNil)
+		So(validate(`{"name":"x","age":null}`), ShouldBeNil)
+		So(validate(`{"name":"x"}`), ShouldBeError, "$.age is required")
+		So(validate(`{"name":"x","age":1.5}`), ShouldBeError, "$.age should be of type [integer null]")
+		So(validate(`{"name":"x","age":-1}`), ShouldBeError, "$.age should be at least 0")
+		So(validate(`{"name":"x","age":1,"tags":["c"]}`), ShouldBeError, "$.tags[0] should be one of [a b]")
+		So(validate(`{"name":"x","age":1,"extra":true}`), ShouldBeError, "$.extra is not allowed")
+	})
+
+	Convey("ValidateStructuredOutput", t, func() {
+		So(ValidateStructuredOutput([]byte(`{"choices":[{"message":{"content":"{\"name\":\"x\",\"age\":1}"},"finish_reason":"stop"}]}`), schema), ShouldBeNil)
+		So(ValidateStructuredOutput([]byte(`{"choices":[{"message":{"content":"{\"name\":"},"finish_reason":"length"}]}`), schema), ShouldBeNil)
+		So(ValidateStructuredOutput([]byte(`{"choices":[{"message":{"content":"not json"},"finish_reason":"stop"}]}`), schema), ShouldNotBeNil)
+		So(ValidateStructuredOutput([]byte(`{"choices":[{"message":{"content":"{\"age\":1}"},"finish_reason":"stop"}]}`), schema), ShouldBeError, "choices[0].message.content: $.name is required")
+	})
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/image"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+func imageError(message string, code string, statusCode int) *relaymodel.ErrorWithStatusCode {
+	return &relaymodel.ErrorWithStatusCode{
+		Error: relaymodel.Error{
+			Message: message,
+			Type:    "invalid_request_error",
+			Param:   "messages",
+			Code:    code,
+		},
+		StatusCode: statusCode,
+	}
+}
+
+// processInlineImages checks the size of the base64 images in the messages, and downscales the ones larger than
+// the image_max_dimension of the channel. The urls are replaced in place, it returns true if any is replaced,
+// then the request body has to be marshalled again.
+func processInlineImages(textRequest *relaymodel.GeneralOpenAIRequest, meta *meta.Meta) (bool, *relaymodel.ErrorWithStatusCode) {
+	maxSize := config.InlineImageMaxSize * 1024 * 1024
+	maxDimension := meta.Config.ImageMaxDimension
+	if maxSize <= 0 && maxDimension <= 0 {
+		return false, nil
+	}
+	replaced := false
+	for i, message := range textRequest.Messages {
+		parts, ok := message.Content.([]any)
+		if !ok {
+			continue
+		}
+		for _, part := range parts {
+			partMap, ok := part.(map[string]any)
+			if !ok || partMap["type"] != relaymodel.ContentTypeImageURL {
+				continue
+			}
+			imageURL, ok := partMap["image_url"].(map[string]any)
+			if !ok {
+				continue
+			}
+			url, ok := imageURL["url"].(string)
+			if !ok || !strings.HasPrefix(url, "data:") {
+				continue
+			}
+			if size := image.GetDataURLSize(url); maxSize > 0 && size > maxSize {
+				return false, imageError(fmt.Sprintf("The image in message %d is %.1f MB, larger than the limit of %d MB.", i, float64(size)/1024/1024, config.InlineImageMaxSize),
+					"image_too_large", http.StatusRequestEntityTooLarge)
+			}
+			if maxDimension <= 0 {
+				continue
+			}
+			downscaled, ok, err := image.Downscale(url, maxDimension)
+			if err != nil {
+				return false, imageError(fmt.Sprintf("The image in message %d could not be decoded: %s", i, err.Error()), "invalid_image", http.StatusBadRequest)
+			}
+			if ok {
+				imageURL["url"] = downscaled
+				replaced = true
+			}
+		}
+	}
+	return replaced, nil
+}
@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/meta"
+)
+
+const (
+	webhookTimeout  = 5 * time.Second
+	webhookAttempts = 3
+	// events beyond this many in flight are dropped, a slow receiver must not pile up goroutines
+	maxPendingWebhooks = 256
+)
+
+var pendingWebhooks = make(chan struct{}, maxPendingWebhooks)
+
+// CompletionEvent is posted to the webhook url of the token after a request is billed
+type CompletionEvent struct {
+	Event            string  `json:"event"`
+	RequestId        string  `json:"request_id"`
+	TokenId          int     `json:"token_id"`
+	TokenName        string  `json:"token_name"`
+	Model            string  `json:"model"`
+	IsStream         bool    `json:"is_stream"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Quota            int64   `json:"quota"`
+	Cost             float64 `json:"cost"` // in USD
+	FinishReason     string  `json:"finish_reason"`
+	CreatedAt        int64   `json:"created_at"`
+}
+
+// finish_reason of OpenAI compatible responses, stop_reason of Claude messages
+var finishReasonPattern = regexp.MustCompile(`"(?:finish|stop)_reason"\s*:\s*"([^"]+)"`)
+
+// finishReasonWriter passes everything through and remembers the last finish reason written,
+// in a stream it's only set on the last choice
+type finishReasonWriter struct {
+	gin.ResponseWriter
+	finishReason string
+}
+
+func (w *finishReasonWriter) capture(data []byte) {
+	matches := finishReasonPattern.FindAllSubmatch(data, -1)
+	if len(matches) > 0 {
+		w.finishReason = string(matches[len(matches)-1][1])
+	}
+}
+
+func (w *finishReasonWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *finishReasonWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// captureFinishReason must be called before the response is written, the returned function restores the
+// writer of the context and saves the finish reason in the meta
+func captureFinishReason(c *gin.Context, meta *meta.Meta) func() {
+	if meta.WebhookURL == "" {
+		return func() {}
+	}
+	writer := &finishReasonWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+	return func() {
+		c.Writer = writer.ResponseWriter
+		meta.FinishReason = writer.finishReason
+	}
+}
+
+func signWebhook(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// notifyCompletion posts the event in the background, a failed delivery is retried a few times then only logged
+func notifyCompletion(ctx context.Context, meta *meta.Meta, modelName string, promptTokens int, completionTokens int, quota int64) {
+	if meta.WebhookURL == "" || !config.TokenWebhookEnabled {
+		return
+	}
+	requestId, _ := ctx.Value(helper.RequestIdKey).(string)
+	event := CompletionEvent{
+		Event:            "completion",
+		RequestId:        requestId,
+		TokenId:          meta.TokenId,
+		TokenName:        meta.TokenName,
+		Model:            modelName,
+		IsStream:         meta.IsStream,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		Quota:            quota,
+		Cost:             float64(quota) / config.QuotaPerUnit,
+		FinishReason:     meta.FinishReason,
+		CreatedAt:        helper.GetTimestamp(),
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		logger.Error(ctx, "error marshalling webhook event: "+err.Error())
+		return
+	}
+	select {
+	case pendingWebhooks <- struct{}{}:
+	default:
+		logger.Warnf(ctx, "too many pending webhooks, event of token #%d dropped", meta.TokenId)
+		return
+	}
+	go func() {
+		defer func() { <-pendingWebhooks }()
+		for attempt := 1; attempt <= webhookAttempts; attempt++ {
+			err = postWebhook(meta.WebhookURL, meta.WebhookSecret, body)
+			if err == nil {
+				return
+			}
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+		logger.Warnf(ctx, "failed to deliver webhook of token #%d: %s", meta.TokenId, err.Error())
+	}()
+}
+
+func postWebhook(url string, secret string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(helper.GetTimestamp(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-OneAPI-Timestamp", timestamp)
+	req.Header.Set("X-OneAPI-Signature", signWebhook(secret, timestamp, body))
+	// the url is given by users, it mustn't reach the internal network
+	resp, err := client.WebhookHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	return nil
+}
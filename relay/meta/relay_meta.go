@@ -27,6 +27,9 @@ type Meta struct {
 	ActualModelName string
 	RequestURLPath  string
 	PromptTokens    int // only for DoResponse
+	WebhookURL      string
+	WebhookSecret   string
+	FinishReason    string // only captured if there is a webhook
 }
 
 func GetByContext(c *gin.Context) *Meta {
@@ -36,6 +39,8 @@ func GetByContext(c *gin.Context) *Meta {
 		ChannelId:       c.GetInt(ctxkey.ChannelId),
 		TokenId:         c.GetInt(ctxkey.TokenId),
 		TokenName:       c.GetString(ctxkey.TokenName),
+		WebhookURL:      c.GetString(ctxkey.TokenWebhookURL),
+		WebhookSecret:   c.GetString(ctxkey.TokenKey),
 		UserId:          c.GetInt(ctxkey.Id),
 		Group:           c.GetString(ctxkey.Group),
 		ModelMapping:    c.GetStringMapString(ctxkey.ModelMapping),
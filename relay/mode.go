@@ -0,0 +1,36 @@
+package relay
+
+import (
+	"github.com/songquanpeng/one-api/relay/apitype"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// supportedAPITypes lists the api types able to serve each relay mode, modes not listed are supported by all of them.
+// Adaptors only translate chat requests unless they are listed here, anything else sent to them
+// would be relayed in a format the upstream doesn't understand.
+var supportedAPITypes = map[int][]int{
+	relaymode.Embeddings:         {apitype.OpenAI, apitype.Ali, apitype.Baidu, apitype.Gemini, apitype.Ollama, apitype.Zhipu, apitype.VertexAI},
+	relaymode.Moderations:        {apitype.OpenAI},
+	relaymode.ImagesGenerations:  {apitype.OpenAI, apitype.Ali, apitype.Baidu, apitype.Zhipu, apitype.Replicate, apitype.StabilityAI},
+	relaymode.ImagesEdits:        {apitype.OpenAI},
+	relaymode.ImagesVariations:   {apitype.OpenAI},
+	relaymode.Edits:              {apitype.OpenAI},
+	relaymode.AudioSpeech:        {apitype.OpenAI, apitype.ElevenLabs},
+	relaymode.AudioTranscription: {apitype.OpenAI, apitype.Deepgram, apitype.AssemblyAI},
+	relaymode.AudioTranslation:   {apitype.OpenAI},
+	relaymode.Messages:           {apitype.Anthropic},
+	relaymode.Rerank:             {apitype.Cohere},
+}
+
+func IsModeSupported(apiType int, relayMode int) bool {
+	apiTypes, ok := supportedAPITypes[relayMode]
+	if !ok {
+		return true
+	}
+	for _, supportedAPIType := range apiTypes {
+		if supportedAPIType == apiType {
+			return true
+		}
+	}
+	return false
+}
@@ -1,7 +1,16 @@
 package model
 
 type ResponseFormat struct {
-	Type string `json:"type,omitempty"`
+	Type       string      `json:"type,omitempty"`
+	JsonSchema *JSONSchema `json:"json_schema,omitempty"`
+}
+
+// JSONSchema is the schema of the structured outputs, only with response_format of type json_schema
+type JSONSchema struct {
+	Description string         `json:"description,omitempty"`
+	Name        string         `json:"name"`
+	Schema      map[string]any `json:"schema,omitempty"`
+	Strict      *bool          `json:"strict,omitempty"`
 }
 
 type GeneralOpenAIRequest struct {
@@ -13,7 +22,9 @@ type GeneralOpenAIRequest struct {
 	PresencePenalty  float64         `json:"presence_penalty,omitempty"`
 	ResponseFormat   *ResponseFormat `json:"response_format,omitempty"`
 	Seed             float64         `json:"seed,omitempty"`
+	Stop             any             `json:"stop,omitempty"`
 	Stream           bool            `json:"stream,omitempty"`
+	StreamOptions    *StreamOptions  `json:"stream_options,omitempty"`
 	Temperature      float64         `json:"temperature,omitempty"`
 	TopP             float64         `json:"top_p,omitempty"`
 	TopK             int             `json:"top_k,omitempty"`
@@ -28,6 +39,47 @@ type GeneralOpenAIRequest struct {
 	Dimensions       int             `json:"dimensions,omitempty"`
 	Instruction      string          `json:"instruction,omitempty"`
 	Size             string          `json:"size,omitempty"`
+	// Usage asks OpenRouter to return the cost of the request in the usage
+	Usage *UsageOptions `json:"usage,omitempty"`
+	// the search options of Perplexity
+	SearchDomainFilter     []string `json:"search_domain_filter,omitempty"`
+	SearchRecencyFilter    string   `json:"search_recency_filter,omitempty"`
+	ReturnImages           bool     `json:"return_images,omitempty"`
+	ReturnRelatedQuestions bool     `json:"return_related_questions,omitempty"`
+	// the context caching of Gemini, CachedContent is the name of a cache to reference,
+	// and the system messages are cached for CacheTTL seconds if it's set
+	CachedContent string `json:"cached_content,omitempty"`
+	CacheTTL      int    `json:"cache_ttl,omitempty"`
+	// the output types of the models generating images along with the text, e.g. ["text", "image"]
+	Modalities []string `json:"modalities,omitempty"`
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage,omitempty"`
+}
+
+type UsageOptions struct {
+	Include bool `json:"include"`
+}
+
+// ParseStop returns the stop sequences, which can be either a string or an array of strings
+func (r GeneralOpenAIRequest) ParseStop() []string {
+	switch stop := r.Stop.(type) {
+	case string:
+		if stop == "" {
+			return nil
+		}
+		return []string{stop}
+	case []any:
+		sequences := make([]string, 0, len(stop))
+		for _, item := range stop {
+			if sequence, ok := item.(string); ok && sequence != "" {
+				sequences = append(sequences, sequence)
+			}
+		}
+		return sequences
+	}
+	return nil
 }
 
 func (r GeneralOpenAIRequest) ParseInput() []string {
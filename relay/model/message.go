@@ -1,11 +1,17 @@
 package model
 
+import "encoding/json"
+
 type Message struct {
 	Role       string  `json:"role,omitempty"`
 	Content    any     `json:"content,omitempty"`
 	Name       *string `json:"name,omitempty"`
 	ToolCalls  []Tool  `json:"tool_calls,omitempty"`
 	ToolCallId string  `json:"tool_call_id,omitempty"`
+	// the chain of thought of reasoning models like deepseek-reasoner, only in responses
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+	// the images generated by the model as image_url parts, only in responses
+	Images []MessageContent `json:"images,omitempty"`
 }
 
 func (m Message) IsStringContent() bool {
@@ -63,12 +69,19 @@ func (m Message) ParseContent() []MessageContent {
 					})
 				}
 			case ContentTypeImageURL:
-				if subObj, ok := contentMap["image_url"].(map[string]any); ok {
+				// the url is a string itself in some clients' requests
+				imageURL := &ImageURL{}
+				switch subObj := contentMap["image_url"].(type) {
+				case string:
+					imageURL.Url = subObj
+				case map[string]any:
+					imageURL.Url, _ = subObj["url"].(string)
+					imageURL.Detail, _ = subObj["detail"].(string)
+				}
+				if imageURL.Url != "" {
 					contentList = append(contentList, MessageContent{
-						Type: ContentTypeImageURL,
-						ImageURL: &ImageURL{
-							Url: subObj["url"].(string),
-						},
+						Type:     ContentTypeImageURL,
+						ImageURL: imageURL,
 					})
 				}
 			}
@@ -88,3 +101,21 @@ type MessageContent struct {
 	Text     string    `json:"text"`
 	ImageURL *ImageURL `json:"image_url,omitempty"`
 }
+
+// ToolCallsText is the names and the arguments of the tool calls, they are generated by the model
+// and billed as the completion, like the content
+func (m Message) ToolCallsText() string {
+	var text string
+	for _, toolCall := range m.ToolCalls {
+		text += toolCall.Function.Name
+		switch arguments := toolCall.Function.Arguments.(type) {
+		case nil:
+		case string:
+			text += arguments
+		default:
+			jsonArguments, _ := json.Marshal(arguments)
+			text += string(jsonArguments)
+		}
+	}
+	return text
+}
@@ -0,0 +1,20 @@
+package model
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestToolCallsText(t *testing.T) {
+	Convey("ToolCallsText", t, func() {
+		message := Message{Role: "assistant", ToolCalls: []Tool{
+			{Id: "call_1", Type: "function", Function: Function{Name: "get_weather", Arguments: `{"city":"Paris"}`}},
+			// the arguments of some upstreams are objects rather than strings
+			{Id: "call_2", Type: "function", Function: Function{Name: "get_time", Arguments: map[string]any{"zone": "UTC"}}},
+			{Id: "call_3", Type: "function", Function: Function{Name: "ping"}},
+		}}
+		So(message.ToolCallsText(), ShouldEqual, `get_weather{"city":"Paris"}get_time{"zone":"UTC"}ping`)
+		So(Message{Role: "assistant", Content: "hi"}.ToolCallsText(), ShouldBeEmpty)
+	})
+}
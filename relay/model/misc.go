@@ -4,6 +4,30 @@ type Usage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+	// Cost is the price of the request in USD reported by upstream, only OpenRouter has it
+	Cost float64 `json:"cost,omitempty"`
+	// the cached ones of the prompt tokens, billed with the cached input price
+	PromptTokensDetails *PromptTokensDetails `json:"prompt_tokens_details,omitempty"`
+	// CacheStorage is the context cache created for the request, it's billed but not shown to the client
+	CacheStorage *CacheStorage `json:"-"`
+	// OutputImages is the number of the images generated in the chat completion, billed per image on top of the tokens
+	OutputImages int `json:"-"`
+}
+
+type PromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+type CacheStorage struct {
+	Tokens int
+	Hours  float64
+}
+
+func (u Usage) CachedTokens() int {
+	if u.PromptTokensDetails == nil {
+		return 0
+	}
+	return u.PromptTokensDetails.CachedTokens
 }
 
 type Error struct {
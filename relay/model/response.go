@@ -0,0 +1,44 @@
+package model
+
+// the chat completions in the format of OpenAI, the adaptors of the other providers convert their responses to them
+
+type TextResponseChoice struct {
+	Index        int `json:"index"`
+	Message      `json:"message"`
+	FinishReason string `json:"finish_reason"`
+}
+
+// PerplexityExtension is the search results Perplexity sends along with the chat completions,
+// they are kept when the response is converted so that the client still gets them
+type PerplexityExtension struct {
+	Citations        []string `json:"citations,omitempty"`
+	SearchResults    []any    `json:"search_results,omitempty"`
+	RelatedQuestions []string `json:"related_questions,omitempty"`
+	Images           []any    `json:"images,omitempty"`
+}
+
+type TextResponse struct {
+	Id      string               `json:"id"`
+	Model   string               `json:"model"`
+	Object  string               `json:"object"`
+	Created int64                `json:"created"`
+	Choices []TextResponseChoice `json:"choices"`
+	Usage   `json:"usage"`
+	PerplexityExtension
+}
+
+type ChatCompletionsStreamResponseChoice struct {
+	Index        int     `json:"index"`
+	Delta        Message `json:"delta"`
+	FinishReason *string `json:"finish_reason,omitempty"`
+}
+
+type ChatCompletionsStreamResponse struct {
+	Id      string                                `json:"id"`
+	Object  string                                `json:"object"`
+	Created int64                                 `json:"created"`
+	Model   string                                `json:"model"`
+	Choices []ChatCompletionsStreamResponseChoice `json:"choices"`
+	Usage   *Usage                                `json:"usage,omitempty"`
+	PerplexityExtension
+}
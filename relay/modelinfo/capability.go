@@ -0,0 +1,103 @@
+package modelinfo
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+type Capability struct {
+	Vision     bool `json:"vision"`
+	Tools      bool `json:"tools"`
+	JSONMode   bool `json:"json_mode"`
+	JSONSchema bool `json:"json_schema"`
+}
+
+var allCapabilities = Capability{Vision: true, Tools: true, JSONMode: true, JSONSchema: true}
+
+// ModelCapability only lists models whose capabilities are well known, models not in it are not validated,
+// keys cover the dated versions of the model only, like gpt-4o-2024-08-06, as the other variants named after a model
+// such as gpt-4-1106-vision-preview may support more than it
+var ModelCapability = map[string]Capability{
+	"gpt-3.5-turbo":          {Tools: true, JSONMode: true},
+	"gpt-3.5-turbo-0301":     {},
+	"gpt-3.5-turbo-0613":     {Tools: true},
+	"gpt-3.5-turbo-16k":      {Tools: true},
+	"gpt-3.5-turbo-instruct": {},
+	"gpt-4":                  {Tools: true},
+	"gpt-4-0314":             {},
+	"gpt-4-32k":              {Tools: true},
+	"gpt-4-1106-preview":     {Tools: true, JSONMode: true},
+	"gpt-4-0125-preview":     {Tools: true, JSONMode: true},
+	"gpt-4-turbo":            {Vision: true, Tools: true, JSONMode: true},
+	"gpt-4-turbo-preview":    {Tools: true, JSONMode: true},
+	"gpt-4-vision-preview":   {Vision: true},
+	"gpt-4o":                 allCapabilities,
+	"gpt-4o-2024-05-13":      {Vision: true, Tools: true, JSONMode: true},
+	"gpt-4o-mini":            allCapabilities,
+
+	"gpt-4-1106-vision-preview": {Vision: true},
+
+	"grok-3":             {Tools: true, JSONMode: true, JSONSchema: true},
+	"grok-2-1212":        {Tools: true, JSONMode: true, JSONSchema: true},
+	"grok-2-vision-1212": {Vision: true, Tools: true, JSONMode: true},
+	"grok-beta":          {Tools: true},
+	"grok-vision-beta":   {Vision: true},
+
+	"jamba-1.5-mini":  {Tools: true, JSONMode: true},
+	"jamba-1.5-large": {Tools: true, JSONMode: true},
+
+	"meta/llama-3.1-8b-instruct":   {Tools: true},
+	"meta/llama-3.1-70b-instruct":  {Tools: true},
+	"meta/llama-3.1-405b-instruct": {Tools: true},
+	"meta/llama-3.3-70b-instruct":  {Tools: true},
+
+	"llama-3.3-70b":               {Tools: true, JSONMode: true},
+	"llama-3.3-70b-versatile":     {Tools: true, JSONMode: true},
+	"qwen-3-32b":                  {Tools: true, JSONMode: true},
+	"Meta-Llama-3.3-70B-Instruct": {Tools: true, JSONMode: true},
+	"DeepSeek-R1":                 {},
+}
+
+func ModelCapability2JSONString() string {
+	jsonBytes, err := json.Marshal(ModelCapability)
+	if err != nil {
+		logger.SysError("error marshalling model capability: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModelCapabilityByJSONString(jsonStr string) error {
+	ModelCapability = make(map[string]Capability)
+	return json.Unmarshal([]byte(jsonStr), &ModelCapability)
+}
+
+// GetCapability returns false if the capabilities of the model are unknown
+func GetCapability(name string) (Capability, bool) {
+	if capability, ok := ModelCapability[name]; ok {
+		return capability, true
+	}
+	bestKey := ""
+	for key := range ModelCapability {
+		version, ok := strings.CutPrefix(name, key+"-")
+		if ok && len(key) > len(bestKey) && isDateVersion(version) {
+			bestKey = key
+		}
+	}
+	capability, ok := ModelCapability[bestKey]
+	return capability, ok && bestKey != ""
+}
+
+// isDateVersion tells if the suffix is a date like 0613 or 2024-08-06
+func isDateVersion(version string) bool {
+	if version == "" {
+		return false
+	}
+	for _, r := range version {
+		if (r < '0' || r > '9') && r != '-' {
+			return false
+		}
+	}
+	return true
+}
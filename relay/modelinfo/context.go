@@ -0,0 +1,129 @@
+package modelinfo
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// ContextWindow is the max number of tokens (prompt plus completion) of a model,
+// a key also covers the dated versions of the model, e.g. gpt-4o covers gpt-4o-2024-08-06
+var ContextWindow = map[string]int{
+	"gpt-3.5-turbo":          16385,
+	"gpt-3.5-turbo-0301":     4096,
+	"gpt-3.5-turbo-0613":     4096,
+	"gpt-3.5-turbo-16k":      16385,
+	"gpt-3.5-turbo-instruct": 4096,
+	"gpt-4":                  8192,
+	"gpt-4-32k":              32768,
+	"gpt-4-1106-preview":     128000,
+	"gpt-4-0125-preview":     128000,
+	"gpt-4-turbo":            128000,
+	"gpt-4-vision-preview":   128000,
+	"gpt-4o":                 128000,
+	"gpt-4o-mini":            128000,
+	"claude-instant-1.2":     100000,
+	"claude-2.0":             100000,
+	"claude-2.1":             200000,
+	"claude-3":               200000,
+	"gemini-1.0-pro":         30720,
+	"gemini-pro":             30720,
+	"gemini-1.5-flash":       1048576,
+	"gemini-1.5-pro":         2097152,
+	"moonshot-v1-8k":         8192,
+	"moonshot-v1-32k":        32768,
+	"moonshot-v1-128k":       131072,
+	"deepseek-chat":          32768,
+	"deepseek-coder":         32768,
+	"deepseek-reasoner":      65536,
+	"glm-4":                  128000,
+	"glm-3-turbo":            128000,
+
+	"gpt-4-1106-vision-preview":       128000,
+	"moonshot-v1-8k-vision-preview":   8192,
+	"moonshot-v1-32k-vision-preview":  32768,
+	"moonshot-v1-128k-vision-preview": 131072,
+
+	"grok-3":             131072,
+	"grok-3-mini":        131072,
+	"grok-2-1212":        131072,
+	"grok-2-vision-1212": 32768,
+	"grok-beta":          131072,
+	"grok-vision-beta":   8192,
+
+	"jamba-1.5-mini":  256000,
+	"jamba-1.5-large": 256000,
+	"jamba-instruct":  256000,
+
+	"sonar":               127072,
+	"sonar-pro":           200000,
+	"sonar-reasoning":     127072,
+	"sonar-reasoning-pro": 127072,
+	"sonar-deep-research": 127072,
+	"r1-1776":             128000,
+
+	"meta/meta-llama-3-8b-instruct":        8192,
+	"meta/meta-llama-3-70b-instruct":       8192,
+	"meta/meta-llama-3.1-405b-instruct":    131072,
+	"mistralai/mixtral-8x7b-instruct-v0.1": 32768,
+
+	"nvidia/llama-3.1-nemotron-70b-instruct":  131072,
+	"nvidia/llama-3.1-nemotron-nano-8b-v1":    131072,
+	"nvidia/llama-3.3-nemotron-super-49b-v1":  131072,
+	"nvidia/llama-3.1-nemotron-ultra-253b-v1": 131072,
+	"nvidia/nemotron-4-340b-instruct":         4096,
+	"meta/llama-3.1-8b-instruct":              131072,
+	"meta/llama-3.1-70b-instruct":             131072,
+	"meta/llama-3.1-405b-instruct":            131072,
+	"meta/llama-3.3-70b-instruct":             131072,
+
+	// the ones of Cerebras are shorter than the ones of the same models elsewhere
+	"llama3.1-8b":                        32768,
+	"llama-3.3-70b":                      65536,
+	"llama-3.3-70b-versatile":            131072,
+	"llama-4-scout-17b-16e-instruct":     32768,
+	"qwen-3-32b":                         65536,
+	"gpt-oss-120b":                       65536,
+	"Meta-Llama-3.1-8B-Instruct":         16384,
+	"Meta-Llama-3.3-70B-Instruct":        131072,
+	"Llama-4-Maverick-17B-128E-Instruct": 131072,
+	"DeepSeek-R1":                        32768,
+	"DeepSeek-V3-0324":                   32768,
+	"QwQ-32B":                            16384,
+}
+
+func ContextWindow2JSONString() string {
+	jsonBytes, err := json.Marshal(ContextWindow)
+	if err != nil {
+		logger.SysError("error marshalling context window: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateContextWindowByJSONString(jsonStr string) error {
+	ContextWindow = make(map[string]int)
+	return json.Unmarshal([]byte(jsonStr), &ContextWindow)
+}
+
+// GetContextWindow returns 0 if the context window of the model is unknown
+func GetContextWindow(name string) int {
+	window, _ := lookup(ContextWindow, name)
+	return window
+}
+
+// lookup finds the value of the model in the table, if the model itself is not in the table,
+// the longest key which the name of the model starts with, followed by a dash, is used
+func lookup[V any](table map[string]V, name string) (V, bool) {
+	if value, ok := table[name]; ok {
+		return value, true
+	}
+	bestKey := ""
+	for key := range table {
+		if len(key) > len(bestKey) && strings.HasPrefix(name, key+"-") {
+			bestKey = key
+		}
+	}
+	value, ok := table[bestKey]
+	return value, ok && bestKey != ""
+}
@@ -0,0 +1,54 @@
+package modelinfo
+
+import (
+	"testing"
+
+	"github.com/songquanpeng/one-api/relay/tokenizer"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGetContextWindow(t *testing.T) {
+	Convey("GetContextWindow", t, func() {
+		So(GetContextWindow("gpt-4"), ShouldEqual, 8192)
+		So(GetContextWindow("gpt-4-0613"), ShouldEqual, 8192)
+		So(GetContextWindow("gpt-4-turbo-2024-04-09"), ShouldEqual, 128000)
+		So(GetContextWindow("gpt-4o-mini-2024-07-18"), ShouldEqual, 128000)
+		So(GetContextWindow("claude-3-5-sonnet-20240620"), ShouldEqual, 200000)
+		So(GetContextWindow("gpt-4-1106-vision-preview"), ShouldEqual, 128000)
+		So(GetContextWindow("moonshot-v1-32k-vision-preview"), ShouldEqual, 32768)
+		So(GetContextWindow("gpt-4.5-preview"), ShouldEqual, 0)
+		So(GetContextWindow("my-custom-model"), ShouldEqual, 0)
+	})
+}
+
+func TestGetCapability(t *testing.T) {
+	Convey("GetCapability", t, func() {
+		capability, ok := GetCapability("gpt-4o-2024-08-06")
+		So(ok, ShouldBeTrue)
+		So(capability.JSONSchema, ShouldBeTrue)
+		capability, ok = GetCapability("gpt-4o-2024-05-13")
+		So(ok, ShouldBeTrue)
+		So(capability.JSONSchema, ShouldBeFalse)
+		capability, ok = GetCapability("gpt-4-0613")
+		So(ok, ShouldBeTrue)
+		So(capability.Vision, ShouldBeFalse)
+		capability, ok = GetCapability("gpt-4-1106-vision-preview")
+		So(ok, ShouldBeTrue)
+		So(capability.Vision, ShouldBeTrue)
+		// not a dated version of gpt-4
+		_, ok = GetCapability("gpt-4-vision-custom")
+		So(ok, ShouldBeFalse)
+		_, ok = GetCapability("my-custom-model")
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestGetTokenizer(t *testing.T) {
+	Convey("GetTokenizer", t, func() {
+		So(GetTokenizer("gpt-4o"), ShouldEqual, tokenizer.Tiktoken)
+		So(GetTokenizer("claude-3-5-sonnet-20240620"), ShouldEqual, tokenizer.Anthropic)
+		So(GetTokenizer("qwen2-72b-instruct"), ShouldEqual, tokenizer.Qwen)
+		So(GetTokenizer("llama3-70b-8192"), ShouldEqual, tokenizer.Tiktoken)
+	})
+}
@@ -0,0 +1,45 @@
+package modelinfo
+
+import (
+	"encoding/json"
+
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/tokenizer"
+)
+
+// ModelTokenizer is the tokenizer family used to count the tokens of a model,
+// models not in it are counted with tiktoken, keys cover the dated versions of the model in the same way as ContextWindow
+var ModelTokenizer = map[string]string{
+	"claude":  tokenizer.Anthropic,
+	"llama2":  tokenizer.Llama,
+	"llama-2": tokenizer.Llama,
+	"mistral": tokenizer.Llama,
+	"mixtral": tokenizer.Llama,
+	"qwen":    tokenizer.Qwen,
+	"qwen1.5": tokenizer.Qwen,
+	"qwen2":   tokenizer.Qwen,
+	"gemma":   tokenizer.Heuristic,
+	"yi":      tokenizer.Heuristic,
+}
+
+func ModelTokenizer2JSONString() string {
+	jsonBytes, err := json.Marshal(ModelTokenizer)
+	if err != nil {
+		logger.SysError("error marshalling model tokenizer: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModelTokenizerByJSONString(jsonStr string) error {
+	ModelTokenizer = make(map[string]string)
+	return json.Unmarshal([]byte(jsonStr), &ModelTokenizer)
+}
+
+// GetTokenizer returns the tokenizer family of the model
+func GetTokenizer(name string) string {
+	family, ok := lookup(ModelTokenizer, name)
+	if !ok || family == "" {
+		return tokenizer.Tiktoken
+	}
+	return family
+}
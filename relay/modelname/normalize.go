@@ -0,0 +1,97 @@
+package modelname
+
+import (
+	"regexp"
+	"strings"
+)
+
+var gptVersionWithoutHyphen = regexp.MustCompile(`^gpt(\d)`)
+var dateSuffix = regexp.MustCompile(`-(\d{4}-\d{2}-\d{2}|\d{8}|\d{4})$`)
+
+// aliases are common typos which can't be fixed by the generic rules
+var aliases = map[string]string{
+	"gpt-4-o":       "gpt-4o",
+	"gpt-3-5-turbo": "gpt-3.5-turbo",
+	"claude3-opus":  "claude-3-opus",
+}
+
+func normalizeKey(name string) string {
+	key := strings.ToLower(strings.TrimSpace(name))
+	key = strings.ReplaceAll(key, "_", "-")
+	key = gptVersionWithoutHyphen.ReplaceAllString(key, "gpt-$1")
+	// Azure deployments usually name gpt-3.5 as gpt-35
+	if key == "gpt-35" || strings.HasPrefix(key, "gpt-35-") {
+		key = "gpt-3.5" + strings.TrimPrefix(key, "gpt-35")
+	}
+	if alias, ok := aliases[key]; ok {
+		key = alias
+	}
+	return key
+}
+
+// Lookup holds the normalized names of a list of candidates, so that they aren't normalized again for each request
+type Lookup struct {
+	names map[string]struct{}
+	keys  map[string]string
+}
+
+// NewLookup precomputes the lookup of candidates, the first of the candidates with the same normalized name wins
+func NewLookup(candidates []string) *Lookup {
+	lookup := &Lookup{
+		names: make(map[string]struct{}, len(candidates)),
+		keys:  make(map[string]string, len(candidates)),
+	}
+	for _, candidate := range candidates {
+		lookup.names[candidate] = struct{}{}
+		key := normalizeKey(candidate)
+		if _, ok := lookup.keys[key]; !ok {
+			lookup.keys[key] = candidate
+		}
+	}
+	return lookup
+}
+
+// Normalize maps name to the canonical one in candidates, it tolerates casing differences,
+// common typos and unknown date suffixes, the name is returned as is if nothing matches.
+// Earlier candidate lists take precedence over later ones.
+func Normalize(name string, candidates ...[]string) string {
+	lookups := make([]*Lookup, 0, len(candidates))
+	for _, list := range candidates {
+		lookups = append(lookups, NewLookup(list))
+	}
+	return NormalizeWith(name, lookups...)
+}
+
+// NormalizeWith is Normalize with the candidates looked up in precomputed lookups, nil lookups are skipped
+func NormalizeWith(name string, lookups ...*Lookup) string {
+	for _, lookup := range lookups {
+		if lookup == nil {
+			continue
+		}
+		if _, ok := lookup.names[name]; ok {
+			return name
+		}
+	}
+	key := normalizeKey(name)
+	base := dateSuffix.ReplaceAllString(key, "")
+	for _, lookup := range lookups {
+		if lookup == nil {
+			continue
+		}
+		if canonical, ok := lookup.keys[key]; ok {
+			return canonical
+		}
+	}
+	if base == key {
+		return name
+	}
+	for _, lookup := range lookups {
+		if lookup == nil {
+			continue
+		}
+		if canonical, ok := lookup.keys[base]; ok {
+			return canonical
+		}
+	}
+	return name
+}
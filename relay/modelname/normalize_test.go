@@ -0,0 +1,32 @@
+package modelname
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNormalize(t *testing.T) {
+	candidates := []string{"gpt-4o", "gpt-4", "gpt-4-0613", "gpt-3.5-turbo", "claude-3-opus-20240229"}
+	Convey("Normalize", t, func() {
+		So(Normalize("gpt-4o", candidates), ShouldEqual, "gpt-4o")
+		So(Normalize("GPT-4o", candidates), ShouldEqual, "gpt-4o")
+		So(Normalize("gpt4o", candidates), ShouldEqual, "gpt-4o")
+		So(Normalize("gpt-35-turbo", candidates), ShouldEqual, "gpt-3.5-turbo")
+		So(Normalize("gpt-4-0613", candidates), ShouldEqual, "gpt-4-0613")
+		So(Normalize("gpt-4o-2024-08-06", candidates), ShouldEqual, "gpt-4o")
+		So(Normalize("gpt-4-1106", candidates), ShouldEqual, "gpt-4")
+		So(Normalize("my-custom-model", candidates), ShouldEqual, "my-custom-model")
+	})
+}
+
+func TestNormalizeWith(t *testing.T) {
+	Convey("NormalizeWith", t, func() {
+		groupModels := NewLookup([]string{"GPT-4o"})
+		knownModels := NewLookup([]string{"gpt-4o", "gpt-4"})
+		So(NormalizeWith("gpt-4o", groupModels, knownModels), ShouldEqual, "gpt-4o")
+		So(NormalizeWith("gpt4o", groupModels, knownModels), ShouldEqual, "GPT-4o")
+		So(NormalizeWith("gpt-4-1106", nil, knownModels), ShouldEqual, "gpt-4")
+		So(NormalizeWith("my-custom-model", nil, nil), ShouldEqual, "my-custom-model")
+	})
+}
@@ -11,4 +11,8 @@ const (
 	AudioSpeech
 	AudioTranscription
 	AudioTranslation
+	Messages
+	Rerank
+	ImagesEdits
+	ImagesVariations
 )
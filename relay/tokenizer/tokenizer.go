@@ -0,0 +1,70 @@
+// Package tokenizer counts tokens for the model families whose vocabulary differs from the OpenAI ones,
+// the family of a model is chosen in modelinfo.ModelTokenizer
+package tokenizer
+
+import (
+	"sync"
+	"unicode"
+)
+
+const (
+	Tiktoken  = "tiktoken"
+	Anthropic = "anthropic"
+	Llama     = "llama"
+	Qwen      = "qwen"
+	Heuristic = "heuristic"
+)
+
+type Tokenizer interface {
+	// CountTokens counts the tokens of the text for the given model, the model is only a hint
+	// for tokenizers which have several vocabularies
+	CountTokens(text string, model string) int
+}
+
+var (
+	mutex      sync.RWMutex
+	tokenizers = map[string]Tokenizer{
+		Anthropic: heuristicTokenizer{charsPerToken: 3.5, tokensPerCJK: 1.2},
+		// sentencepiece vocabularies of 32k tokens, most CJK characters fall back to bytes
+		Llama:     heuristicTokenizer{charsPerToken: 3.2, tokensPerCJK: 2},
+		Qwen:      heuristicTokenizer{charsPerToken: 4, tokensPerCJK: 0.7},
+		Heuristic: heuristicTokenizer{charsPerToken: 4, tokensPerCJK: 1},
+	}
+)
+
+// Register adds or replaces the tokenizer of a family
+func Register(family string, tokenizer Tokenizer) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	tokenizers[family] = tokenizer
+}
+
+// Get returns nil if no tokenizer is registered for the family
+func Get(family string) Tokenizer {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return tokenizers[family]
+}
+
+// heuristicTokenizer estimates the token count from the characters of the text,
+// CJK characters are counted apart because vocabularies differ the most on them
+type heuristicTokenizer struct {
+	charsPerToken float64
+	tokensPerCJK  float64
+}
+
+func (t heuristicTokenizer) CountTokens(text string, _ string) int {
+	var cjk, others int
+	for _, r := range text {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			cjk++
+		} else {
+			others++
+		}
+	}
+	tokens := float64(others)/t.charsPerToken + float64(cjk)*t.tokensPerCJK
+	if tokens > 0 && tokens < 1 {
+		return 1
+	}
+	return int(tokens + 0.5)
+}
@@ -0,0 +1,19 @@
+package tokenizer
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHeuristicTokenizer(t *testing.T) {
+	Convey("heuristic tokenizer", t, func() {
+		llama := Get(Llama)
+		qwen := Get(Qwen)
+		So(llama.CountTokens("", ""), ShouldEqual, 0)
+		So(llama.CountTokens("a", ""), ShouldEqual, 1)
+		So(Get(Heuristic).CountTokens("hello world!", ""), ShouldEqual, 3)
+		So(qwen.CountTokens("你好世界", ""), ShouldBeLessThan, llama.CountTokens("你好世界", ""))
+		So(Get("unknown"), ShouldBeNil)
+	})
+}
@@ -10,6 +10,8 @@ import (
 )
 
 func SetApiRouter(router *gin.Engine) {
+	// public and outside of /api, status pages of operators embed it
+	router.GET("/status", middleware.GlobalAPIRateLimit(), controller.GetPublicStatus)
 	apiRouter := router.Group("/api")
 	apiRouter.Use(gzip.Gzip(gzip.DefaultCompression))
 	apiRouter.Use(middleware.GlobalAPIRateLimit())
@@ -19,6 +21,7 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.GET("/notice", controller.GetNotice)
 		apiRouter.GET("/about", controller.GetAbout)
 		apiRouter.GET("/home_page_content", controller.GetHomePageContent)
+		apiRouter.GET("/image/:name", controller.GetHostedImage)
 		apiRouter.GET("/verification", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.SendEmailVerification)
 		apiRouter.GET("/reset_password", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.SendPasswordResetEmail)
 		apiRouter.POST("/user/reset", middleware.CriticalRateLimit(), controller.ResetPassword)
@@ -29,6 +32,10 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.GET("/oauth/wechat/bind", middleware.CriticalRateLimit(), middleware.UserAuth(), auth.WeChatBind)
 		apiRouter.GET("/oauth/email/bind", middleware.CriticalRateLimit(), middleware.UserAuth(), controller.EmailBind)
 		apiRouter.POST("/topup", middleware.AdminAuth(), controller.AdminTopUp)
+		apiRouter.POST("/reconciliation", middleware.RootAuth(), controller.ReconcileQuotas)
+		apiRouter.POST("/bench", middleware.RootAuth(), controller.RunBenchmark)
+		apiRouter.GET("/backup", middleware.RootAuth(), controller.DownloadBackup)
+		apiRouter.GET("/realtime_stats", middleware.AdminAuth(), controller.StreamRealtimeStats)
 
 		userRoute := apiRouter.Group("/user")
 		{
@@ -47,6 +54,9 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.GET("/aff", controller.GetAffCode)
 				selfRoute.POST("/topup", controller.TopUp)
 				selfRoute.GET("/available_models", controller.GetUserAvailableModels)
+				selfRoute.GET("/usage_report", controller.GetSelfUsageReport)
+				selfRoute.PUT("/usage_report", controller.UpdateSelfUsageReport)
+				selfRoute.POST("/transfer", controller.TransferSelfQuota)
 			}
 
 			adminRoute := userRoute.Group("/")
@@ -55,8 +65,11 @@ func SetApiRouter(router *gin.Engine) {
 				adminRoute.GET("/", controller.GetAllUsers)
 				adminRoute.GET("/search", controller.SearchUsers)
 				adminRoute.GET("/:id", controller.GetUser)
+				adminRoute.GET("/:id/ledger", controller.GetUserQuotaLedgers)
+				adminRoute.GET("/:id/quota_snapshot", controller.GetUserQuotaSnapshots)
 				adminRoute.POST("/", controller.CreateUser)
 				adminRoute.POST("/manage", controller.ManageUser)
+				adminRoute.POST("/manage/transfer", controller.AdminTransferQuota)
 				adminRoute.PUT("/", controller.UpdateUser)
 				adminRoute.DELETE("/:id", controller.DeleteUser)
 			}
@@ -78,7 +91,12 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.GET("/test/:id", controller.TestChannel)
 			channelRoute.GET("/update_balance", controller.UpdateAllChannelsBalance)
 			channelRoute.GET("/update_balance/:id", controller.UpdateChannelBalance)
+			channelRoute.GET("/key_stats/:id", controller.GetChannelKeyStats)
+			channelRoute.GET("/key_sweep", controller.GetKeySweepReport)
+			channelRoute.GET("/lane_stats", controller.GetLaneStats)
 			channelRoute.POST("/", controller.AddChannel)
+			channelRoute.POST("/upstream_models", controller.FetchUpstreamModels)
+			channelRoute.POST("/key_sweep", controller.SweepChannelKeys)
 			channelRoute.PUT("/", controller.UpdateChannel)
 			channelRoute.DELETE("/disabled", controller.DeleteDisabledChannel)
 			channelRoute.DELETE("/:id", controller.DeleteChannel)
@@ -89,7 +107,9 @@ func SetApiRouter(router *gin.Engine) {
 			tokenRoute.GET("/", controller.GetAllTokens)
 			tokenRoute.GET("/search", controller.SearchTokens)
 			tokenRoute.GET("/:id", controller.GetToken)
+			tokenRoute.GET("/:id/usage", controller.GetTokenUsage)
 			tokenRoute.POST("/", controller.AddToken)
+			tokenRoute.POST("/transfer", controller.TransferTokenQuota)
 			tokenRoute.PUT("/", controller.UpdateToken)
 			tokenRoute.DELETE("/:id", controller.DeleteToken)
 		}
@@ -107,10 +127,48 @@ func SetApiRouter(router *gin.Engine) {
 		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
 		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
 		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
+		logRoute.GET("/error_stat", middleware.AdminAuth(), controller.GetChannelErrorStat)
+		logRoute.GET("/trace", middleware.AdminAuth(), controller.ResolveStreamTrace)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
 		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), controller.SearchUserLogs)
+		logRoute.POST("/export", middleware.AdminAuth(), controller.ExportLogs)
+		logRoute.POST("/self/export", middleware.UserAuth(), controller.ExportUserLogs)
+		logRoute.GET("/export/:id", middleware.UserAuth(), controller.GetLogExport)
+		logRoute.GET("/export/:id/download", controller.DownloadLogExport)
+		midjourneyRoute := apiRouter.Group("/mj")
+		midjourneyRoute.GET("/", middleware.AdminAuth(), controller.GetAllMidjourneyTasks)
+		midjourneyRoute.GET("/self", middleware.UserAuth(), controller.GetUserMidjourneyTasks)
+		slowRequestRoute := apiRouter.Group("/slow_request")
+		slowRequestRoute.Use(middleware.AdminAuth())
+		{
+			slowRequestRoute.GET("/", controller.GetSlowRequests)
+			slowRequestRoute.GET("/:id", controller.GetSlowRequest)
+			slowRequestRoute.DELETE("/", controller.DeleteHistorySlowRequests)
+		}
+		contentViolationRoute := apiRouter.Group("/content_violation")
+		contentViolationRoute.Use(middleware.AdminAuth())
+		{
+			contentViolationRoute.GET("/stat", controller.GetContentViolationStat)
+			contentViolationRoute.DELETE("/", controller.DeleteHistoryContentViolations)
+		}
+		inflightRoute := apiRouter.Group("/inflight")
+		inflightRoute.Use(middleware.AdminAuth())
+		{
+			inflightRoute.GET("/", controller.GetInflightRequests)
+			inflightRoute.DELETE("/", controller.KillChannelInflightRequests)
+			inflightRoute.DELETE("/:id", controller.KillInflightRequest)
+		}
+		apiRouter.GET("/experiment", middleware.AdminAuth(), controller.GetExperiments)
+		apiRouter.GET("/pricing", middleware.UserAuth(), controller.GetPricing)
+		apiRouter.POST("/pricing/simulate", middleware.AdminAuth(), controller.SimulatePricing)
+		apiRouter.GET("/forecast", middleware.AdminAuth(), controller.GetUsageForecast)
+		regionRoute := apiRouter.Group("/region")
+		{
+			regionRoute.GET("/ledger", middleware.RegionAuth(), controller.GetRegionLedger)
+			regionRoute.GET("/status", middleware.AdminAuth(), controller.GetRegionStatus)
+		}
 		groupRoute := apiRouter.Group("/group")
 		groupRoute.Use(middleware.AdminAuth())
 		{
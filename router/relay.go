@@ -1,72 +1,204 @@
 package router
 
 import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
 	"github.com/songquanpeng/one-api/controller"
 	"github.com/songquanpeng/one-api/middleware"
 
 	"github.com/gin-gonic/gin"
 )
 
+// relayPathPrefixAliases are inbound prefixes used by vendor SDKs by default,
+// requests with them are handled by the /v1 routes
+var relayPathPrefixAliases = []string{"/openai/v1", "/v1beta"}
+
+// unprefixedRelayPaths are accepted without any version prefix
+var unprefixedRelayPaths = []string{
+	"/chat/completions",
+	"/completions",
+	"/embeddings",
+	"/moderations",
+	"/rerank",
+	"/images/generations",
+	"/audio/speech",
+	"/audio/transcriptions",
+	"/audio/translations",
+}
+
 func SetRelayRouter(router *gin.Engine) {
 	router.Use(middleware.CORS())
+	setRelayPathAliases(router)
 	// https://platform.openai.com/docs/api-reference/introduction
 	modelsRouter := router.Group("/v1/models")
 	modelsRouter.Use(middleware.TokenAuth())
 	{
 		modelsRouter.GET("", controller.ListModels)
-		modelsRouter.GET("/:model", controller.RetrieveModel)
+		modelsRouter.GET("/:model", controller.RetrieveModel, middleware.ConversationId(), middleware.DistributeGet(), controller.RelayGet)
+	}
+	ephemeralKeyRouter := router.Group("/v1/ephemeral_keys")
+	ephemeralKeyRouter.Use(middleware.TokenAuth())
+	{
+		ephemeralKeyRouter.POST("", controller.CreateEphemeralKey)
+	}
+	// https://github.com/novicezk/midjourney-proxy
+	midjourneyRouter := router.Group("/mj")
+	midjourneyRouter.Use(middleware.RelayPanicRecover(), middleware.ConversationId(), middleware.TokenAuth(), middleware.Sandbox(), middleware.SpendLimit())
+	{
+		midjourneyRouter.POST("/submit/imagine", middleware.Distribute(), controller.RelayMidjourney)
+		midjourneyRouter.POST("/submit/change", middleware.MidjourneyTaskChannel(), middleware.Distribute(), controller.RelayMidjourney)
+		midjourneyRouter.GET("/task/:id/fetch", controller.GetMidjourneyTask)
+		midjourneyRouter.POST("/task/list-by-condition", controller.ListMidjourneyTasksByCondition)
+	}
+	// https://platform.openai.com/docs/api-reference/fine-tuning
+	fineTuningRouter := router.Group("/v1/fine_tuning/jobs")
+	fineTuningRouter.Use(middleware.RelayPanicRecover(), middleware.ConversationId(), middleware.TokenAuth(), middleware.Sandbox(), middleware.SpendLimit())
+	{
+		fineTuningRouter.GET("", controller.ListFineTuningJobs)
+		fineTuningRouter.POST("", middleware.DistributeFineTuning(), controller.RelayFineTuning)
+		fineTuningRouter.GET("/:id", middleware.DistributeFineTuning(), controller.RelayFineTuning)
+		fineTuningRouter.POST("/:id/cancel", middleware.DistributeFineTuning(), controller.RelayFineTuning)
+		// the events and the checkpoints are relayed as they are, without any quota consumed
+		fineTuningRouter.GET("/:id/events", middleware.DistributeFineTuning(), controller.RelayGet)
+		fineTuningRouter.GET("/:id/checkpoints", middleware.DistributeFineTuning(), controller.RelayGet)
+	}
+	// https://platform.openai.com/docs/api-reference/files
+	filesRouter := router.Group("/v1/files")
+	filesRouter.Use(middleware.RelayPanicRecover(), middleware.ConversationId(), middleware.TokenAuth(), middleware.Sandbox(), middleware.SpendLimit())
+	{
+		filesRouter.GET("", controller.ListFiles)
+		filesRouter.POST("", middleware.DistributeFiles(), controller.RelayFiles)
+		filesRouter.GET("/:id", middleware.DistributeFiles(), controller.RelayGet)
+		filesRouter.GET("/:id/content", middleware.DistributeFiles(), controller.RelayGet)
+		filesRouter.DELETE("/:id", middleware.DistributeFiles(), controller.RelayFiles)
 	}
 	relayV1Router := router.Group("/v1")
-	relayV1Router.Use(middleware.RelayPanicRecover(), middleware.TokenAuth(), middleware.Distribute())
+	relayV1Router.Use(middleware.RelayPanicRecover(), middleware.ConversationId(), middleware.SlowRequestCapture(), middleware.TokenAuth(), middleware.Distribute(), middleware.Sandbox(), middleware.SpendLimit(), middleware.PriorityLane(), middleware.ContentPolicy(), middleware.PromptCompression())
 	{
 		relayV1Router.POST("/completions", controller.Relay)
 		relayV1Router.POST("/chat/completions", controller.Relay)
+		relayV1Router.POST("/messages", controller.Relay)
 		relayV1Router.POST("/edits", controller.Relay)
 		relayV1Router.POST("/images/generations", controller.Relay)
-		relayV1Router.POST("/images/edits", controller.RelayNotImplemented)
-		relayV1Router.POST("/images/variations", controller.RelayNotImplemented)
+		relayV1Router.POST("/images/edits", controller.Relay)
+		relayV1Router.POST("/images/variations", controller.Relay)
 		relayV1Router.POST("/embeddings", controller.Relay)
 		relayV1Router.POST("/engines/:model/embeddings", controller.Relay)
 		relayV1Router.POST("/audio/transcriptions", controller.Relay)
 		relayV1Router.POST("/audio/translations", controller.Relay)
 		relayV1Router.POST("/audio/speech", controller.Relay)
-		relayV1Router.GET("/files", controller.RelayNotImplemented)
-		relayV1Router.POST("/files", controller.RelayNotImplemented)
-		relayV1Router.DELETE("/files/:id", controller.RelayNotImplemented)
-		relayV1Router.GET("/files/:id", controller.RelayNotImplemented)
-		relayV1Router.GET("/files/:id/content", controller.RelayNotImplemented)
-		relayV1Router.POST("/fine_tuning/jobs", controller.RelayNotImplemented)
-		relayV1Router.GET("/fine_tuning/jobs", controller.RelayNotImplemented)
-		relayV1Router.GET("/fine_tuning/jobs/:id", controller.RelayNotImplemented)
-		relayV1Router.POST("/fine_tuning/jobs/:id/cancel", controller.RelayNotImplemented)
-		relayV1Router.GET("/fine_tuning/jobs/:id/events", controller.RelayNotImplemented)
 		relayV1Router.DELETE("/models/:model", controller.RelayNotImplemented)
 		relayV1Router.POST("/moderations", controller.Relay)
-		relayV1Router.POST("/assistants", controller.RelayNotImplemented)
-		relayV1Router.GET("/assistants/:id", controller.RelayNotImplemented)
-		relayV1Router.POST("/assistants/:id", controller.RelayNotImplemented)
-		relayV1Router.DELETE("/assistants/:id", controller.RelayNotImplemented)
-		relayV1Router.GET("/assistants", controller.RelayNotImplemented)
+		relayV1Router.POST("/rerank", controller.Relay)
 		relayV1Router.POST("/assistants/:id/files", controller.RelayNotImplemented)
 		relayV1Router.GET("/assistants/:id/files/:fileId", controller.RelayNotImplemented)
 		relayV1Router.DELETE("/assistants/:id/files/:fileId", controller.RelayNotImplemented)
 		relayV1Router.GET("/assistants/:id/files", controller.RelayNotImplemented)
-		relayV1Router.POST("/threads", controller.RelayNotImplemented)
-		relayV1Router.GET("/threads/:id", controller.RelayNotImplemented)
-		relayV1Router.POST("/threads/:id", controller.RelayNotImplemented)
-		relayV1Router.DELETE("/threads/:id", controller.RelayNotImplemented)
-		relayV1Router.POST("/threads/:id/messages", controller.RelayNotImplemented)
-		relayV1Router.GET("/threads/:id/messages/:messageId", controller.RelayNotImplemented)
-		relayV1Router.POST("/threads/:id/messages/:messageId", controller.RelayNotImplemented)
 		relayV1Router.GET("/threads/:id/messages/:messageId/files/:filesId", controller.RelayNotImplemented)
 		relayV1Router.GET("/threads/:id/messages/:messageId/files", controller.RelayNotImplemented)
-		relayV1Router.POST("/threads/:id/runs", controller.RelayNotImplemented)
-		relayV1Router.GET("/threads/:id/runs/:runsId", controller.RelayNotImplemented)
-		relayV1Router.POST("/threads/:id/runs/:runsId", controller.RelayNotImplemented)
-		relayV1Router.GET("/threads/:id/runs", controller.RelayNotImplemented)
-		relayV1Router.POST("/threads/:id/runs/:runsId/submit_tool_outputs", controller.RelayNotImplemented)
-		relayV1Router.POST("/threads/:id/runs/:runsId/cancel", controller.RelayNotImplemented)
-		relayV1Router.GET("/threads/:id/runs/:runsId/steps/:stepId", controller.RelayNotImplemented)
-		relayV1Router.GET("/threads/:id/runs/:runsId/steps", controller.RelayNotImplemented)
 	}
+	// https://platform.openai.com/docs/api-reference/assistants
+	assistantsRouter := router.Group("/v1")
+	assistantsRouter.Use(middleware.RelayPanicRecover(), middleware.ConversationId(), middleware.TokenAuth(), middleware.DistributeAssistants(), middleware.Sandbox(), middleware.SpendLimit())
+	{
+		assistantsRouter.POST("/assistants", controller.RelayAssistants)
+		assistantsRouter.GET("/assistants", controller.RelayAssistants)
+		assistantsRouter.GET("/assistants/:id", controller.RelayAssistants)
+		assistantsRouter.POST("/assistants/:id", controller.RelayAssistants)
+		assistantsRouter.DELETE("/assistants/:id", controller.RelayAssistants)
+		assistantsRouter.POST("/threads", controller.RelayAssistants)
+		assistantsRouter.POST("/threads/runs", controller.RelayAssistants)
+		assistantsRouter.GET("/threads/:id", controller.RelayAssistants)
+		assistantsRouter.POST("/threads/:id", controller.RelayAssistants)
+		assistantsRouter.DELETE("/threads/:id", controller.RelayAssistants)
+		assistantsRouter.POST("/threads/:id/messages", controller.RelayAssistants)
+		assistantsRouter.GET("/threads/:id/messages", controller.RelayAssistants)
+		assistantsRouter.GET("/threads/:id/messages/:messageId", controller.RelayAssistants)
+		assistantsRouter.POST("/threads/:id/messages/:messageId", controller.RelayAssistants)
+		assistantsRouter.DELETE("/threads/:id/messages/:messageId", controller.RelayAssistants)
+		assistantsRouter.POST("/threads/:id/runs", controller.RelayAssistants)
+		assistantsRouter.GET("/threads/:id/runs", controller.RelayAssistants)
+		assistantsRouter.GET("/threads/:id/runs/:runsId", controller.RelayAssistants)
+		assistantsRouter.POST("/threads/:id/runs/:runsId", controller.RelayAssistants)
+		assistantsRouter.POST("/threads/:id/runs/:runsId/submit_tool_outputs", controller.RelayAssistants)
+		assistantsRouter.POST("/threads/:id/runs/:runsId/cancel", controller.RelayAssistants)
+		assistantsRouter.GET("/threads/:id/runs/:runsId/steps", controller.RelayAssistants)
+		assistantsRouter.GET("/threads/:id/runs/:runsId/steps/:stepId", controller.RelayAssistants)
+	}
+}
+
+func setRelayPathAliases(router *gin.Engine) {
+	for _, prefix := range relayPathPrefixAliases {
+		router.Any(prefix+"/*path", func(c *gin.Context) {
+			// the Gemini OpenAI compatible endpoint is /v1beta/openai/chat/completions
+			path := strings.TrimPrefix(c.Param("path"), "/openai/")
+			c.Request.URL.Path = "/v1/" + strings.TrimPrefix(path, "/")
+			handleRewrittenRequest(router, c)
+		})
+	}
+	for _, path := range unprefixedRelayPaths {
+		router.POST(path, func(c *gin.Context) {
+			c.Request.URL.Path = "/v1" + c.Request.URL.Path
+			handleRewrittenRequest(router, c)
+		})
+	}
+	router.GET("/models", func(c *gin.Context) {
+		c.Request.URL.Path = "/v1/models"
+		handleRewrittenRequest(router, c)
+	})
+	// Azure style: /openai/deployments/{deployment}/chat/completions?api-version=2024-02-01
+	router.POST("/openai/deployments/:model/*task", func(c *gin.Context) {
+		if c.Request.Header.Get("Authorization") == "" && c.Request.Header.Get("api-key") != "" {
+			c.Request.Header.Set("Authorization", "Bearer "+c.Request.Header.Get("api-key"))
+		}
+		err := setRequestModelIfMissing(c, c.Param("model"))
+		if err != nil {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		c.Request.URL.Path = "/v1" + c.Param("task")
+		c.Request.URL.RawQuery = ""
+		handleRewrittenRequest(router, c)
+	})
+}
+
+func handleRewrittenRequest(router *gin.Engine, c *gin.Context) {
+	router.HandleContext(c)
+	// HandleContext restores the handler index but not the handler chain,
+	// abort here so that the handlers of the rewritten route won't be called twice
+	c.Abort()
+}
+
+// setRequestModelIfMissing puts the deployment name of an Azure style request into the JSON body,
+// since Azure clients don't send the model in the body
+func setRequestModelIfMissing(c *gin.Context, modelName string) error {
+	if !strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") {
+		return nil
+	}
+	requestBody, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return err
+	}
+	_ = c.Request.Body.Close()
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	var request map[string]any
+	if json.Unmarshal(requestBody, &request) != nil {
+		// let the relay report the invalid body
+		return nil
+	}
+	if model, ok := request["model"].(string); ok && model != "" {
+		return nil
+	}
+	request["model"] = modelName
+	requestBody, err = json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	c.Request.ContentLength = int64(len(requestBody))
+	return nil
 }
@@ -0,0 +1,86 @@
+package router
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRelayPathAliases(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("the alias paths are handled by the /v1 routes", t, func() {
+		type handled struct {
+			route         string
+			model         string
+			authorization string
+		}
+		var calls []handled
+		record := func(c *gin.Context) {
+			call := handled{route: c.FullPath(), authorization: c.Request.Header.Get("Authorization")}
+			body, _ := io.ReadAll(c.Request.Body)
+			var request struct {
+				Model string `json:"model"`
+			}
+			_ = json.Unmarshal(body, &request)
+			call.model = request.Model
+			calls = append(calls, call)
+			c.Status(http.StatusOK)
+		}
+		router := gin.New()
+		setRelayPathAliases(router)
+		router.POST("/v1/chat/completions", record)
+		router.POST("/v1/embeddings", record)
+		router.POST("/v1/audio/speech", record)
+		router.GET("/v1/models", record)
+		serve := func(method string, path string, body string, header map[string]string) int {
+			calls = nil
+			req := httptest.NewRequest(method, path, strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			for key, value := range header {
+				req.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w.Code
+		}
+
+		Convey("the prefixes of the vendor SDKs", func() {
+			for _, path := range []string{"/v1/chat/completions", "/openai/v1/chat/completions", "/v1beta/chat/completions",
+				"/v1beta/openai/chat/completions", "/chat/completions"} {
+				So(serve(http.MethodPost, path, `{"model":"gpt-4o"}`, nil), ShouldEqual, http.StatusOK)
+				So(calls, ShouldResemble, []handled{{route: "/v1/chat/completions", model: "gpt-4o"}})
+			}
+			So(serve(http.MethodPost, "/embeddings", `{"model":"text-embedding-3-small"}`, nil), ShouldEqual, http.StatusOK)
+			So(calls, ShouldResemble, []handled{{route: "/v1/embeddings", model: "text-embedding-3-small"}})
+			for _, path := range []string{"/models", "/openai/v1/models", "/v1beta/models"} {
+				So(serve(http.MethodGet, path, "", nil), ShouldEqual, http.StatusOK)
+				So(calls, ShouldResemble, []handled{{route: "/v1/models"}})
+			}
+		})
+
+		Convey("the Azure style paths take the model from the deployment", func() {
+			path := "/openai/deployments/gpt-4o/chat/completions?api-version=2024-02-01"
+			So(serve(http.MethodPost, path, `{"messages":[]}`, map[string]string{"api-key": "sk-test"}), ShouldEqual, http.StatusOK)
+			So(calls, ShouldResemble, []handled{{route: "/v1/chat/completions", model: "gpt-4o", authorization: "Bearer sk-test"}})
+
+			// the model of the body and the Authorization header are kept
+			So(serve(http.MethodPost, path, `{"model":"gpt-4o-mini"}`, map[string]string{"api-key": "sk-test", "Authorization": "Bearer sk-other"}),
+				ShouldEqual, http.StatusOK)
+			So(calls, ShouldResemble, []handled{{route: "/v1/chat/completions", model: "gpt-4o-mini", authorization: "Bearer sk-other"}})
+
+			So(serve(http.MethodPost, "/openai/deployments/tts-1/audio/speech?api-version=2024-02-01", `{"input":"hi"}`, nil), ShouldEqual, http.StatusOK)
+			So(calls, ShouldResemble, []handled{{route: "/v1/audio/speech", model: "tts-1"}})
+		})
+
+		Convey("the unknown paths are still not found", func() {
+			So(serve(http.MethodPost, "/openai/v1/unknown", `{}`, nil), ShouldEqual, http.StatusNotFound)
+			So(calls, ShouldBeEmpty)
+		})
+	})
+}
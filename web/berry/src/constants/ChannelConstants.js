@@ -41,6 +41,12 @@ export const CHANNEL_OPTIONS = {
     value: 24,
     color: 'warning'
   },
+  41: {
+    key: 41,
+    text: 'Google Vertex AI',
+    value: 41,
+    color: 'warning'
+  },
   28: {
     key: 28,
     text: 'Mistral AI',
@@ -161,6 +167,96 @@ export const CHANNEL_OPTIONS = {
     value: 39,
     color: 'primary'
   },
+  42: {
+    key: 42,
+    text: 'Fireworks AI',
+    value: 42,
+    color: 'primary'
+  },
+  43: {
+    key: 43,
+    text: 'One API',
+    value: 43,
+    color: 'primary'
+  },
+  44: {
+    key: 44,
+    text: 'xAI Grok',
+    value: 44,
+    color: 'primary'
+  },
+  45: {
+    key: 45,
+    text: 'AI21',
+    value: 45,
+    color: 'primary'
+  },
+  46: {
+    key: 46,
+    text: 'Perplexity',
+    value: 46,
+    color: 'primary'
+  },
+  47: {
+    key: 47,
+    text: 'Hugging Face',
+    value: 47,
+    color: 'primary'
+  },
+  48: {
+    key: 48,
+    text: 'Replicate',
+    value: 48,
+    color: 'primary'
+  },
+  49: {
+    key: 49,
+    text: 'NVIDIA NIM',
+    value: 49,
+    color: 'primary'
+  },
+  50: {
+    key: 50,
+    text: 'Stability AI',
+    value: 50,
+    color: 'primary'
+  },
+  51: {
+    key: 51,
+    text: 'Midjourney Proxy',
+    value: 51,
+    color: 'primary'
+  },
+  52: {
+    key: 52,
+    text: 'ElevenLabs',
+    value: 52,
+    color: 'primary'
+  },
+  53: {
+    key: 53,
+    text: 'Deepgram',
+    value: 53,
+    color: 'primary'
+  },
+  54: {
+    key: 54,
+    text: 'AssemblyAI',
+    value: 54,
+    color: 'primary'
+  },
+  55: {
+    key: 55,
+    text: 'Cerebras',
+    value: 55,
+    color: 'primary'
+  },
+  56: {
+    key: 56,
+    text: 'SambaNova',
+    value: 56,
+    color: 'primary'
+  },
   8: {
     key: 8,
     text: '自定义渠道',
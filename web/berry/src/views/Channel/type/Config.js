@@ -131,6 +131,24 @@ const typeConfig = {
     },
     modelGroup: 'google gemini'
   },
+  41: {
+    inputLabel: {
+      key: 'Service Account',
+      config: {
+        region: 'Region'
+      }
+    },
+    input: {
+      models: ['gemini-1.5-pro-001', 'gemini-1.5-flash-001', 'text-embedding-004']
+    },
+    prompt: {
+      key: '请输入服务账号的 JSON 密钥文件内容',
+      config: {
+        region: 'region，e.g. us-central1，默认为 us-central1'
+      }
+    },
+    modelGroup: 'vertex ai'
+  },
   25: {
     input: {
       models: ['moonshot-v1-8k', 'moonshot-v1-32k', 'moonshot-v1-128k']
@@ -23,7 +23,12 @@ const OperationSetting = () => {
     DisplayInCurrencyEnabled: '',
     DisplayTokenStatEnabled: '',
     ApproximateTokenEnabled: '',
-    RetryTimes: 0
+    RetryTimes: 0,
+    RetryBaseDelay: 0,
+    RetryMaxDelay: 0,
+    RetryJitter: 0,
+    RetryStatusCodes: '',
+    GlobalSpendRateLimit: 0
   });
   const [originInputs, setOriginInputs] = useState({});
   let [loading, setLoading] = useState(false);
@@ -89,6 +94,9 @@ const OperationSetting = () => {
         if (originInputs['QuotaRemindThreshold'] !== inputs.QuotaRemindThreshold) {
           await updateOption('QuotaRemindThreshold', inputs.QuotaRemindThreshold);
         }
+        if (originInputs['GlobalSpendRateLimit'] !== inputs.GlobalSpendRateLimit) {
+          await updateOption('GlobalSpendRateLimit', inputs.GlobalSpendRateLimit);
+        }
         break;
       case 'ratio':
         if (originInputs['ModelRatio'] !== inputs.ModelRatio) {
@@ -140,6 +148,18 @@ const OperationSetting = () => {
         if (originInputs['RetryTimes'] !== inputs.RetryTimes) {
           await updateOption('RetryTimes', inputs.RetryTimes);
         }
+        if (originInputs['RetryBaseDelay'] !== inputs.RetryBaseDelay) {
+          await updateOption('RetryBaseDelay', inputs.RetryBaseDelay);
+        }
+        if (originInputs['RetryMaxDelay'] !== inputs.RetryMaxDelay) {
+          await updateOption('RetryMaxDelay', inputs.RetryMaxDelay);
+        }
+        if (originInputs['RetryJitter'] !== inputs.RetryJitter) {
+          await updateOption('RetryJitter', inputs.RetryJitter);
+        }
+        if (originInputs['RetryStatusCodes'] !== inputs.RetryStatusCodes) {
+          await updateOption('RetryStatusCodes', inputs.RetryStatusCodes);
+        }
         break;
     }
   };
@@ -203,6 +223,50 @@ const OperationSetting = () => {
               placeholder='失败重试次数'
             />
           </Form.Group>
+          <Form.Group widths={4}>
+            <Form.Input
+              label='重试初始延迟（毫秒）'
+              name='RetryBaseDelay'
+              type={'number'}
+              step='1'
+              min='0'
+              onChange={handleInputChange}
+              autoComplete='new-password'
+              value={inputs.RetryBaseDelay}
+              placeholder='每次重试翻倍，0 表示立即重试'
+            />
+            <Form.Input
+              label='重试最大延迟（毫秒）'
+              name='RetryMaxDelay'
+              type={'number'}
+              step='1'
+              min='0'
+              onChange={handleInputChange}
+              autoComplete='new-password'
+              value={inputs.RetryMaxDelay}
+              placeholder='0 表示不限制'
+            />
+            <Form.Input
+              label='重试延迟抖动比例'
+              name='RetryJitter'
+              type={'number'}
+              step='0.1'
+              min='0'
+              max='1'
+              onChange={handleInputChange}
+              autoComplete='new-password'
+              value={inputs.RetryJitter}
+              placeholder='随机减去延迟的比例，0 到 1'
+            />
+            <Form.Input
+              label='重试状态码'
+              name='RetryStatusCodes'
+              onChange={handleInputChange}
+              autoComplete='new-password'
+              value={inputs.RetryStatusCodes}
+              placeholder='例如 429,500-599，留空使用内置规则'
+            />
+          </Form.Group>
           <Form.Group inline>
             <Form.Checkbox
               checked={inputs.DisplayInCurrencyEnabled === 'true'}
@@ -273,6 +337,16 @@ const OperationSetting = () => {
               min='0'
               placeholder='低于此额度时将发送邮件提醒用户'
             />
+            <Form.Input
+              label='全局每分钟消费额度上限'
+              name='GlobalSpendRateLimit'
+              onChange={handleInputChange}
+              autoComplete='new-password'
+              value={inputs.GlobalSpendRateLimit}
+              type='number'
+              min='0'
+              placeholder='超出后拒绝请求并通知管理员，0 表示不限制'
+            />
           </Form.Group>
           <Form.Group inline>
             <Form.Checkbox
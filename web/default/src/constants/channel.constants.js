@@ -5,6 +5,7 @@ export const CHANNEL_OPTIONS = [
     {key: 3, text: 'Azure OpenAI', value: 3, color: 'olive'},
     {key: 11, text: 'Google PaLM2', value: 11, color: 'orange'},
     {key: 24, text: 'Google Gemini', value: 24, color: 'orange'},
+    {key: 41, text: 'Google Vertex AI', value: 41, color: 'orange'},
     {key: 28, text: 'Mistral AI', value: 28, color: 'orange'},
     {key: 40, text: '字节跳动豆包', value: 40, color: 'blue'},
     {key: 15, text: '百度文心千帆', value: 15, color: 'blue'},
@@ -26,6 +27,21 @@ export const CHANNEL_OPTIONS = [
     {key: 37, text: 'Cloudflare', value: 37, color: 'orange'},
     {key: 38, text: 'DeepL', value: 38, color: 'black'},
     {key: 39, text: 'together.ai', value: 39, color: 'blue'},
+    {key: 42, text: 'Fireworks AI', value: 42, color: 'orange'},
+    {key: 43, text: 'One API', value: 43, color: 'green'},
+    {key: 44, text: 'xAI Grok', value: 44, color: 'black'},
+    {key: 45, text: 'AI21', value: 45, color: 'purple'},
+    {key: 46, text: 'Perplexity', value: 46, color: 'teal'},
+    {key: 47, text: 'Hugging Face', value: 47, color: 'yellow'},
+    {key: 48, text: 'Replicate', value: 48, color: 'grey'},
+    {key: 49, text: 'NVIDIA NIM', value: 49, color: 'green'},
+    {key: 50, text: 'Stability AI', value: 50, color: 'purple'},
+    {key: 51, text: 'Midjourney Proxy', value: 51, color: 'blue'},
+    {key: 52, text: 'ElevenLabs', value: 52, color: 'black'},
+    {key: 53, text: 'Deepgram', value: 53, color: 'green'},
+    {key: 54, text: 'AssemblyAI', value: 54, color: 'blue'},
+    {key: 55, text: 'Cerebras', value: 55, color: 'orange'},
+    {key: 56, text: 'SambaNova', value: 56, color: 'red'},
     {key: 8, text: '自定义渠道', value: 8, color: 'pink'},
     {key: 22, text: '知识库：FastGPT', value: 22, color: 'blue'},
     {key: 21, text: '知识库：AI Proxy', value: 21, color: 'purple'},
@@ -10,6 +10,10 @@ const MODEL_MAPPING_EXAMPLE = {
   'gpt-4-32k-0314': 'gpt-4-32k'
 };
 
+const SCHEDULE_EXAMPLE = [
+  { weekdays: [1, 2, 3, 4, 5], start: '09:00', end: '18:00' }
+];
+
 function type2secretPrompt(type) {
   // inputs.type === 15 ? '按照如下格式输入：APIKey|SecretKey' : (inputs.type === 18 ? '按照如下格式输入：APPID|APISecret|APIKey' : '请输入渠道对应的鉴权密钥')
   switch (type) {
@@ -21,6 +25,8 @@ function type2secretPrompt(type) {
       return '按照如下格式输入：APIKey-AppId，例如：fastgpt-0sp2gtvfdgyi4k30jwlgwf1i-64f335d84283f05518e9e041';
     case 23:
       return '按照如下格式输入：AppId|SecretId|SecretKey';
+    case 41:
+      return '请输入服务账号的 JSON 密钥文件内容';
     default:
       return '请输入渠道对应的鉴权密钥';
   }
@@ -55,6 +61,9 @@ const EditChannel = () => {
   const [basicModels, setBasicModels] = useState([]);
   const [fullModels, setFullModels] = useState([]);
   const [customModel, setCustomModel] = useState('');
+  const [schedule, setSchedule] = useState('');
+  const [modelPrefixes, setModelPrefixes] = useState('');
+  const [retryPolicy, setRetryPolicy] = useState('');
   const [config, setConfig] = useState({
     region: '',
     sk: '',
@@ -98,7 +107,17 @@ const EditChannel = () => {
       }
       setInputs(data);
       if (data.config !== '') {
-        setConfig(JSON.parse(data.config));
+        const localConfig = JSON.parse(data.config);
+        setConfig(localConfig);
+        if (localConfig.schedule) {
+          setSchedule(JSON.stringify(localConfig.schedule, null, 2));
+        }
+        if (localConfig.retry) {
+          setRetryPolicy(JSON.stringify(localConfig.retry, null, 2));
+        }
+        if (localConfig.model_prefixes) {
+          setModelPrefixes(JSON.stringify(localConfig.model_prefixes, null, 2));
+        }
       }
       setBasicModels(getChannelModels(data.type));
     } else {
@@ -166,7 +185,7 @@ const EditChannel = () => {
         inputs.key = `${config.ak}|${config.sk}|${config.region}`;
       }
     }
-    if (!isEdit && (inputs.name === '' || inputs.key === '')) {
+    if (!isEdit && (inputs.name === '' || (inputs.key === '' && !config.no_auth))) {
       showInfo('请填写渠道名称和渠道密钥！');
       return;
     }
@@ -178,6 +197,18 @@ const EditChannel = () => {
       showInfo('模型映射必须是合法的 JSON 格式！');
       return;
     }
+    if (schedule !== '' && !verifyJSON(schedule)) {
+      showInfo('时间段必须是合法的 JSON 格式！');
+      return;
+    }
+    if (retryPolicy !== '' && !verifyJSON(retryPolicy)) {
+      showInfo('重试策略必须是合法的 JSON 格式！');
+      return;
+    }
+    if (modelPrefixes !== '' && !verifyJSON(modelPrefixes)) {
+      showInfo('模型前缀规则必须是合法的 JSON 格式！');
+      return;
+    }
     let localInputs = {...inputs};
     if (localInputs.base_url && localInputs.base_url.endsWith('/')) {
       localInputs.base_url = localInputs.base_url.slice(0, localInputs.base_url.length - 1);
@@ -188,7 +219,14 @@ const EditChannel = () => {
     let res;
     localInputs.models = localInputs.models.join(',');
     localInputs.group = localInputs.groups.join(',');
-    localInputs.config = JSON.stringify(config);
+    localInputs.config = JSON.stringify({
+      ...config,
+      schedule: schedule === '' ? undefined : JSON.parse(schedule),
+      model_prefixes: modelPrefixes === '' ? undefined : JSON.parse(modelPrefixes),
+      retry: retryPolicy === '' ? undefined : JSON.parse(retryPolicy),
+      rpm: config.rpm ? parseInt(config.rpm) : undefined,
+      tpm: config.tpm ? parseInt(config.tpm) : undefined
+    });
     if (isEdit) {
       res = await API.put(`/api/channel/`, { ...localInputs, id: parseInt(channelId) });
     } else {
@@ -230,6 +268,30 @@ const EditChannel = () => {
     handleInputChange(null, { name: 'models', value: localModels });
   };
 
+  const fetchUpstreamModels = async () => {
+    let localInputs = { ...inputs, models: '', group: '', config: JSON.stringify(config) };
+    if (isEdit) {
+      localInputs.id = parseInt(channelId);
+    }
+    const res = await API.post(`/api/channel/upstream_models`, localInputs);
+    const { success, message, data } = res.data;
+    if (!success) {
+      showError(message);
+      return;
+    }
+    setModelOptions(modelOptions => {
+      const known = new Set(modelOptions.map(option => option.value));
+      const newOptions = data.filter(model => !known.has(model)).map(model => ({
+        key: model,
+        text: model,
+        value: model
+      }));
+      return [...modelOptions, ...newOptions];
+    });
+    handleInputChange(null, { name: 'models', value: data });
+    showSuccess(`已获取 ${data.length} 个上游模型`);
+  };
+
   return (
     <>
       <Segment loading={loading}>
@@ -274,16 +336,22 @@ const EditChannel = () => {
                     autoComplete='new-password'
                   />
                 </Form.Field>
+                <Form.Checkbox
+                  label='移除响应中的内容过滤标注（content_filter_results、prompt_filter_results）'
+                  name='strip_content_filter_results'
+                  checked={!!config.strip_content_filter_results}
+                  onChange={(e, { checked }) => handleConfigChange(e, { name: 'strip_content_filter_results', value: checked })}
+                />
               </>
             )
           }
           {
-            inputs.type === 8 && (
+            (inputs.type === 8 || inputs.type === 43) && (
               <Form.Field>
                 <Form.Input
                   label='Base URL'
                   name='base_url'
-                  placeholder={'请输入自定义渠道的 Base URL，例如：https://openai.justsong.cn'}
+                  placeholder={inputs.type === 43 ? '请输入上游 One API 的地址，例如：https://one-api.example.com' : '请输入自定义渠道的 Base URL，例如：https://openai.justsong.cn'}
                   onChange={handleInputChange}
                   value={inputs.base_url}
                   autoComplete='new-password'
@@ -371,6 +439,38 @@ const EditChannel = () => {
               </Form.Field>
             )
           }
+          {
+            (inputs.type === 8 || inputs.type === 30) && (
+              <Form.Group widths='equal'>
+                <Form.Input
+                  label='鉴权请求头'
+                  name='auth_header'
+                  placeholder={'此项可选，上游从其他请求头读取密钥时填写，例如：X-API-Key，默认为 Authorization: Bearer'}
+                  onChange={handleConfigChange}
+                  value={config.auth_header || ''}
+                  disabled={!!config.no_auth}
+                  autoComplete=''
+                />
+                <Form.Checkbox
+                  label='上游无需鉴权（例如本地部署的 Ollama、vLLM、LM Studio），无需填写密钥'
+                  name='no_auth'
+                  checked={!!config.no_auth}
+                  onChange={(e, { checked }) => handleConfigChange(e, { name: 'no_auth', value: checked })}
+                />
+              </Form.Group>
+            )
+          }
+          {
+            inputs.type === 41 && (
+              <Form.Input
+                label='Region'
+                name='region'
+                placeholder={'region，e.g. us-central1，默认为 us-central1'}
+                onChange={handleConfigChange}
+                value={config.region}
+                autoComplete=''
+              />)
+          }
           {
             inputs.type === 34 && (
               <Message>
@@ -414,6 +514,11 @@ const EditChannel = () => {
             <Button type={'button'} onClick={() => {
               handleInputChange(null, { name: 'models', value: [] });
             }}>清除所有模型</Button>
+            {
+              (inputs.type === 8 || inputs.type === 30) && (
+                <Button type={'button'} onClick={fetchUpstreamModels}>获取上游模型</Button>
+              )
+            }
             <Input
               action={
                 <Button type={'button'} onClick={addCustomModel}>填入</Button>
@@ -442,6 +547,65 @@ const EditChannel = () => {
               autoComplete='new-password'
             />
           </Form.Field>
+          <Form.Field>
+            <Form.TextArea
+              label='时间段'
+              placeholder={`此项可选，渠道只在这些时间段内被选中（服务器时区），所有可用渠道都不在时间段内时忽略此限制。weekdays 中 0 为周日，留空为每天，end 早于 start 表示跨越午夜，例如工作时间：\n${JSON.stringify(SCHEDULE_EXAMPLE, null, 2)}`}
+              name='schedule'
+              onChange={(e, { value }) => setSchedule(value)}
+              value={schedule}
+              style={{ minHeight: 150, fontFamily: 'JetBrains Mono, Consolas' }}
+              autoComplete='new-password'
+            />
+          </Form.Field>
+          <Form.Field>
+            <Form.TextArea
+              label='重试策略'
+              placeholder={`此项可选，该渠道请求失败时覆盖系统设置中的重试策略，未填写或为 0 的项使用系统设置，延迟单位为毫秒，例如：\n${JSON.stringify({ max_attempts: 3, base_delay: 500, max_delay: 5000, jitter: 0.5, status_codes: '429,500-599' }, null, 2)}`}
+              name='retry'
+              onChange={(e, { value }) => setRetryPolicy(value)}
+              value={retryPolicy}
+              style={{ minHeight: 150, fontFamily: 'JetBrains Mono, Consolas' }}
+              autoComplete='new-password'
+            />
+          </Form.Field>
+          <Form.Group widths='equal'>
+            <Form.Input
+              label='每分钟请求数上限（RPM）'
+              name='rpm'
+              placeholder={'此项可选，超过后该渠道暂不被选中，0 或留空表示不限制'}
+              onChange={handleConfigChange}
+              value={config.rpm || ''}
+              type='number'
+              min='0'
+              autoComplete='new-password'
+            />
+            <Form.Input
+              label='每分钟 token 数上限（TPM）'
+              name='tpm'
+              placeholder={'此项可选，适用于 Groq 等限制严格的上游，0 或留空表示不限制'}
+              onChange={handleConfigChange}
+              value={config.tpm || ''}
+              type='number'
+              min='0'
+              autoComplete='new-password'
+            />
+          </Form.Group>
+          {
+            inputs.type === 20 && (
+              <Form.Field>
+                <Form.TextArea
+                  label='模型前缀规则'
+                  placeholder={`此项可选，模型名以键开头时在前面加上值作为 OpenRouter 的厂商前缀，值为空表示不加，已带 / 的模型不处理，留空使用内置规则，例如：\n${JSON.stringify({ 'claude-': 'anthropic', 'llama-': 'meta-llama' }, null, 2)}`}
+                  name='model_prefixes'
+                  onChange={(e, { value }) => setModelPrefixes(value)}
+                  value={modelPrefixes}
+                  style={{ minHeight: 150, fontFamily: 'JetBrains Mono, Consolas' }}
+                  autoComplete='new-password'
+                />
+              </Form.Field>
+            )
+          }
           {
             inputs.type === 33 && (
               <Form.Field>
@@ -537,7 +701,7 @@ const EditChannel = () => {
             )
           }
           {
-            inputs.type !== 3 && inputs.type !== 33 && inputs.type !== 8 && inputs.type !== 22 && (
+            inputs.type !== 3 && inputs.type !== 33 && inputs.type !== 8 && inputs.type !== 22 && inputs.type !== 43 && inputs.type !== 47 && (
               <Form.Field>
                 <Form.Input
                   label='代理'
@@ -550,6 +714,20 @@ const EditChannel = () => {
               </Form.Field>
             )
           }
+          {
+            inputs.type === 47 && (
+              <Form.Field>
+                <Form.Input
+                  label='Inference Endpoint 地址'
+                  name='base_url'
+                  placeholder={'此项可选，默认使用 Serverless Inference API，也可以输入 Inference Endpoint 或 TGI 服务的地址，格式为：https://xxx.endpoints.huggingface.cloud'}
+                  onChange={handleInputChange}
+                  value={inputs.base_url}
+                  autoComplete='new-password'
+                />
+              </Form.Field>
+            )
+          }
           {
             inputs.type === 22 && (
               <Form.Field>
@@ -17,6 +17,7 @@ const EditToken = () => {
     unlimited_quota: false,
     models: [],
     subnet: "",
+    webhook_url: '',
   };
   const [inputs, setInputs] = useState(originInputs);
   const { name, remain_quota, expired_time, unlimited_quota } = inputs;
@@ -164,6 +165,16 @@ const EditToken = () => {
               autoComplete='new-password'
             />
           </Form.Field>
+          <Form.Field>
+            <Form.Input
+              label='回调地址'
+              name='webhook_url'
+              placeholder={'每次请求计费后向该地址推送用量事件，需管理员开启，留空则不推送'}
+              onChange={handleInputChange}
+              value={inputs.webhook_url}
+              autoComplete='new-password'
+            />
+          </Form.Field>
           <Form.Field>
             <Form.Input
               label='过期时间'